@@ -3,6 +3,7 @@ module github.com/cinode/go
 go 1.23.3
 
 require (
+	bazil.org/fuse v0.0.0-20230120002735-62a210ff1fd5
 	github.com/jbenet/go-base58 v0.0.0-20150317085156-6237cf65f3a6
 	github.com/spf13/cobra v1.8.1
 	golang.org/x/crypto v0.30.0
@@ -0,0 +1,79 @@
+/*
+Copyright © 2022 Bartłomiej Święcki (byo)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package blenc
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"testing"
+
+	"github.com/cinode/go/pkg/blobtypes"
+	"github.com/cinode/go/pkg/datastore"
+	"github.com/cinode/go/pkg/utilities/benchmark"
+)
+
+func BenchmarkStaticCreate(b *testing.B) {
+	ctx := context.Background()
+
+	for _, size := range []int{1024, 64 * 1024, 1024 * 1024} {
+		b.Run(fmt.Sprintf("size=%d", size), func(b *testing.B) {
+			// Different content for consecutive blobs
+			blobs := make([][]byte, 16)
+			for i := range blobs {
+				blobs[i] = benchmark.Data(uint64(i), size)
+			}
+
+			be := FromDatastore(datastore.InMemory())
+
+			b.SetBytes(int64(size))
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				_, _, _, err := be.Create(ctx, blobtypes.Static, bytes.NewReader(blobs[i%len(blobs)]))
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkStaticRead(b *testing.B) {
+	ctx := context.Background()
+	const size = 16 * 1024 * 1024
+
+	be := FromDatastore(datastore.InMemory())
+	name, key, _, err := be.Create(ctx, blobtypes.Static, bytes.NewReader(benchmark.Data(0, size)))
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.SetBytes(size)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		rc, err := be.Open(ctx, name, key)
+		if err != nil {
+			b.Fatal(err)
+		}
+		_, err = io.Copy(io.Discard, rc)
+		if err != nil {
+			b.Fatal(err)
+		}
+		rc.Close()
+	}
+}
@@ -19,27 +19,46 @@ package blenc
 import (
 	"context"
 	"crypto/rand"
+	"errors"
 	"io"
 	"time"
 
 	"github.com/cinode/go/pkg/blobtypes"
 	"github.com/cinode/go/pkg/common"
 	"github.com/cinode/go/pkg/datastore"
+	"github.com/cinode/go/pkg/internal/utilities/cipherfactory"
 	"github.com/cinode/go/pkg/internal/utilities/securefifo"
+	"github.com/cinode/go/pkg/utilities/progress"
 )
 
 // FromDatastore creates Blob Encoder using given datastore implementation as
 // the storage layer
-func FromDatastore(ds datastore.DS) BE {
-	return &beDatastore{
+func FromDatastore(ds datastore.DS, opts ...Option) BE {
+	ret := &beDatastore{
 		ds:              ds,
 		rand:            rand.Reader,
-		generateVersion: func() uint64 { return uint64(time.Now().UnixMicro()) },
+		generateVersion: func(*common.BlobName) uint64 { return uint64(time.Now().UnixMicro()) },
 		newSecureFifo:   securefifo.New,
+
+		concurrentUploadTimeout: defaultConcurrentUploadTimeout,
+		checkpointInterval:      defaultCheckpointInterval,
+	}
+	for _, o := range opts {
+		o(ret)
 	}
+	return ret
 }
 
-type versionSource func() uint64
+// FromDatastores creates Blob Encoder that reads blobs from the primary
+// datastore and falls back to given fallback datastores if the blob is not
+// found there, see datastore.NewFanoutWithBackfill. Blobs found in fallback
+// datastores are stored in the primary one, new blobs are only written
+// to the primary datastore.
+func FromDatastores(primary datastore.DS, fallbacks []datastore.DS, opts ...Option) BE {
+	return FromDatastore(datastore.NewFanoutWithBackfill(primary, fallbacks...), opts...)
+}
+
+type versionSource func(name *common.BlobName) uint64
 
 type secureFifoGenerator func() (securefifo.Writer, error)
 
@@ -48,9 +67,47 @@ type beDatastore struct {
 	rand            io.Reader
 	generateVersion versionSource
 	newSecureFifo   secureFifoGenerator
+	metrics         Metrics
+
+	// versionAboveStored enables reading the stored dynamic link before
+	// the update to ensure the new version takes precedence
+	versionAboveStored bool
+
+	// How long to wait for a concurrent upload of the same static blob
+	concurrentUploadTimeout time.Duration
+
+	// Number of source bytes between checkpoints of resumable creates
+	checkpointInterval int64
+
+	// Encryption algorithm used for newly created static blobs
+	staticAlgorithm cipherfactory.Algorithm
+
+	// If set, newly created static blobs are compressed
+	compressStatic bool
 }
 
 func (be *beDatastore) Open(ctx context.Context, name *common.BlobName, key *common.BlobKey) (io.ReadCloser, error) {
+	if be.metrics == nil {
+		return be.open(ctx, name, key)
+	}
+
+	rc, err := be.open(ctx, name, key)
+	if errors.Is(err, blobtypes.ErrValidationFailed) {
+		be.metrics.IncValidationFailure(name.Type())
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	be.metrics.IncOpen(name.Type())
+	return &validationReportingReader{
+		ReadCloser: rc,
+		metrics:    be.metrics,
+		blobType:   name.Type(),
+	}, nil
+}
+
+func (be *beDatastore) open(ctx context.Context, name *common.BlobName, key *common.BlobKey) (io.ReadCloser, error) {
 	switch name.Type() {
 	case blobtypes.Static:
 		return be.openStatic(ctx, name, key)
@@ -69,6 +126,73 @@ func (be *beDatastore) Create(
 	*common.BlobKey,
 	*common.AuthInfo,
 	error,
+) {
+	if be.metrics == nil {
+		return be.create(ctx, blobType, r)
+	}
+
+	c := progress.NewCounter(0, nil)
+	bn, key, ai, err := be.create(ctx, blobType, c.Reader(r))
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	be.metrics.IncCreate(blobType, c.N())
+	return bn, key, ai, nil
+}
+
+func (be *beDatastore) CreateFromReaderAt(
+	ctx context.Context,
+	blobType common.BlobType,
+	ra io.ReaderAt,
+	size int64,
+) (
+	*common.BlobName,
+	*common.BlobKey,
+	*common.AuthInfo,
+	error,
+) {
+	bn, key, ai, err := be.createFromReaderAt(ctx, blobType, ra, size)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	if be.metrics != nil {
+		be.metrics.IncCreate(blobType, size)
+	}
+	return bn, key, ai, nil
+}
+
+func (be *beDatastore) createFromReaderAt(
+	ctx context.Context,
+	blobType common.BlobType,
+	ra io.ReaderAt,
+	size int64,
+) (
+	*common.BlobName,
+	*common.BlobKey,
+	*common.AuthInfo,
+	error,
+) {
+	switch blobType {
+	case blobtypes.Static:
+		return be.createStaticFromReaderAt(ctx, ra, size)
+	case blobtypes.DynamicLink:
+		// Link data is small, there's no benefit of re-reading the source
+		return be.createDynamicLink(ctx, io.NewSectionReader(ra, 0, size))
+	}
+	return nil, nil, nil, blobtypes.ErrUnknownBlobType
+}
+
+func (be *beDatastore) create(
+	ctx context.Context,
+	blobType common.BlobType,
+	r io.Reader,
+) (
+	*common.BlobName,
+	*common.BlobKey,
+	*common.AuthInfo,
+	error,
 ) {
 	switch blobType {
 	case blobtypes.Static:
@@ -80,6 +204,24 @@ func (be *beDatastore) Create(
 }
 
 func (be *beDatastore) Update(ctx context.Context, name *common.BlobName, authInfo *common.AuthInfo, key *common.BlobKey, r io.Reader) error {
+	if be.metrics == nil {
+		return be.update(ctx, name, authInfo, key, r)
+	}
+
+	c := progress.NewCounter(0, nil)
+	err := be.update(ctx, name, authInfo, key, c.Reader(r))
+	if errors.Is(err, blobtypes.ErrValidationFailed) {
+		be.metrics.IncValidationFailure(name.Type())
+	}
+	if err != nil {
+		return err
+	}
+
+	be.metrics.IncUpdate(name.Type(), c.N())
+	return nil
+}
+
+func (be *beDatastore) update(ctx context.Context, name *common.BlobName, authInfo *common.AuthInfo, key *common.BlobKey, r io.Reader) error {
 	switch name.Type() {
 	case blobtypes.Static:
 		return be.updateStatic(ctx, name, authInfo, key, r)
@@ -94,5 +236,9 @@ func (be *beDatastore) Exists(ctx context.Context, name *common.BlobName) (bool,
 }
 
 func (be *beDatastore) Delete(ctx context.Context, name *common.BlobName) error {
-	return be.ds.Delete(ctx, name)
+	err := be.ds.Delete(ctx, name)
+	if err == nil && be.metrics != nil {
+		be.metrics.IncDelete(name.Type())
+	}
+	return err
 }
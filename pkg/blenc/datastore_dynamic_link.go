@@ -17,12 +17,15 @@ limitations under the License.
 package blenc
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"fmt"
 	"io"
 
+	"github.com/cinode/go/pkg/blobtypes"
 	"github.com/cinode/go/pkg/common"
+	"github.com/cinode/go/pkg/datastore"
 	"github.com/cinode/go/pkg/internal/blobtypes/dynamiclink"
 )
 
@@ -31,8 +34,56 @@ var (
 	ErrDynamicLinkUpdateFailedWriterInfo = fmt.Errorf("%w: invalid writer info", ErrDynamicLinkUpdateFailed)
 	ErrDynamicLinkUpdateFailedWrongKey   = fmt.Errorf("%w: encryption key mismatch", ErrDynamicLinkUpdateFailed)
 	ErrDynamicLinkUpdateFailedWrongName  = fmt.Errorf("%w: blob name mismatch", ErrDynamicLinkUpdateFailed)
+	ErrNotADynamicLink                   = errors.New("blob is not a dynamic link")
+	ErrAuthInfoNameMismatch              = errors.New("auth info does not match the blob name")
 )
 
+// DeriveKey computes the encryption key of the dynamic link with given name
+// from its auth info. The key is derived deterministically from the signing
+// secret thus it can be recovered as long as the auth info is known,
+// the blob itself is not read.
+func DeriveKey(ctx context.Context, name *common.BlobName, ai *common.AuthInfo) (*common.BlobKey, error) {
+	if name.Type() != blobtypes.DynamicLink {
+		return nil, ErrNotADynamicLink
+	}
+
+	dl, err := dynamiclink.FromAuthInfo(ai)
+	if err != nil {
+		return nil, err
+	}
+
+	if !name.Equal(dl.BlobName()) {
+		return nil, ErrAuthInfoNameMismatch
+	}
+
+	return dl.EncryptionKey(), nil
+}
+
+func (be *beDatastore) ContentVersion(ctx context.Context, name *common.BlobName) (uint64, error) {
+	if name.Type() != blobtypes.DynamicLink {
+		return 0, ErrNotADynamicLink
+	}
+
+	rc, err := be.ds.Open(ctx, name)
+	if err != nil {
+		return 0, err
+	}
+	defer rc.Close()
+
+	dl, err := dynamiclink.FromPublicData(name, rc)
+	if err != nil {
+		return 0, err
+	}
+
+	// Link data signature is only validated once the whole data is read
+	_, err = io.Copy(io.Discard, dl.GetEncryptedLinkReader())
+	if err != nil {
+		return 0, err
+	}
+
+	return dl.ContentVersion(), nil
+}
+
 func (be *beDatastore) openDynamicLink(
 	ctx context.Context,
 	name *common.BlobName,
@@ -80,14 +131,12 @@ func (be *beDatastore) createDynamicLink(
 	*common.AuthInfo,
 	error,
 ) {
-	version := be.generateVersion()
-
 	dl, err := dynamiclink.Create(be.rand)
 	if err != nil {
 		return nil, nil, nil, err
 	}
 
-	pr, encryptionKey, err := dl.UpdateLinkData(r, version)
+	pr, encryptionKey, err := dl.UpdateLinkData(r, be.generateVersion(dl.BlobName()))
 	if err != nil {
 		return nil, nil, nil, err
 	}
@@ -112,14 +161,35 @@ func (be *beDatastore) updateDynamicLink(
 	key *common.BlobKey,
 	r io.Reader,
 ) error {
-	newVersion := be.generateVersion()
+	newVersion := be.generateVersion(name)
 
 	dl, err := dynamiclink.FromAuthInfo(authInfo)
 	if err != nil {
 		return err
 	}
 
-	pr, encryptionKey, err := dl.UpdateLinkData(r, newVersion)
+	var stored *dynamiclink.PublicReader
+	if be.versionAboveStored {
+		linkData, err := io.ReadAll(r)
+		if err != nil {
+			return err
+		}
+
+		stored, err = be.storedLinkToOutrank(ctx, name, key, linkData, newVersion)
+		if err != nil {
+			return err
+		}
+		r = bytes.NewReader(linkData)
+	}
+
+	if stored != nil {
+		err = dl.SyncVersion(stored)
+		if err != nil {
+			return err
+		}
+	}
+
+	pr, encryptionKey, err := dl.UpdateLinkDataMinVersion(r, newVersion)
 	if err != nil {
 		return err
 	}
@@ -140,3 +210,50 @@ func (be *beDatastore) updateDynamicLink(
 
 	return nil
 }
+
+// storedLinkToOutrank returns the stored link the update with given data
+// must take precedence over, nil is returned if the generated version
+// is already enough
+func (be *beDatastore) storedLinkToOutrank(
+	ctx context.Context,
+	name *common.BlobName,
+	key *common.BlobKey,
+	linkData []byte,
+	newVersion uint64,
+) (*dynamiclink.PublicReader, error) {
+	rc, err := be.ds.Open(ctx, name)
+	if errors.Is(err, datastore.ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	stored, err := dynamiclink.FromPublicData(name, rc)
+	if err != nil {
+		return nil, err
+	}
+
+	if stored.ContentVersion() < newVersion {
+		return nil, nil
+	}
+
+	linkReader, err := stored.GetLinkDataReader(key)
+	if err != nil {
+		return nil, err
+	}
+
+	storedLinkData, err := io.ReadAll(linkReader)
+	if err != nil {
+		return nil, err
+	}
+
+	if bytes.Equal(storedLinkData, linkData) {
+		// Same data is stored with the generated version to keep
+		// repeated updates reproducible
+		return nil, nil
+	}
+
+	return stored, nil
+}
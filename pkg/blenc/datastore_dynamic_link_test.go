@@ -29,6 +29,7 @@ import (
 	"github.com/cinode/go/pkg/blobtypes"
 	"github.com/cinode/go/pkg/common"
 	"github.com/cinode/go/pkg/datastore"
+	"github.com/cinode/go/pkg/internal/blobtypes/dynamiclink"
 	"github.com/stretchr/testify/require"
 )
 
@@ -160,3 +161,99 @@ func TestDynamicLinkErrors(t *testing.T) {
 		dsw.updateFn = nil
 	})
 }
+
+func TestDynamicLinkContentVersion(t *testing.T) {
+	ctx := context.Background()
+	ds := datastore.InMemory()
+	be := FromDatastore(ds, VersionSource(func() uint64 { return 10 }))
+
+	bn, key, ai, err := be.Create(ctx, blobtypes.DynamicLink, bytes.NewReader([]byte("data")))
+	require.NoError(t, err)
+
+	version, err := be.ContentVersion(ctx, bn)
+	require.NoError(t, err)
+	require.EqualValues(t, 10, version)
+
+	be2 := FromDatastore(ds, VersionSource(func() uint64 { return 20 }))
+	err = be2.Update(ctx, bn, ai, key, bytes.NewReader([]byte("data2")))
+	require.NoError(t, err)
+
+	version, err = be.ContentVersion(ctx, bn)
+	require.NoError(t, err)
+	require.EqualValues(t, 20, version)
+
+	t.Run("static blob", func(t *testing.T) {
+		bn, _, _, err := be.Create(ctx, blobtypes.Static, bytes.NewReader([]byte("static")))
+		require.NoError(t, err)
+
+		_, err = be.ContentVersion(ctx, bn)
+		require.ErrorIs(t, err, ErrNotADynamicLink)
+	})
+
+	t.Run("missing link", func(t *testing.T) {
+		link, err := dynamiclink.Create(rand.Reader)
+		require.NoError(t, err)
+
+		_, err = be.ContentVersion(ctx, link.BlobName())
+		require.ErrorIs(t, err, datastore.ErrNotFound)
+	})
+
+	t.Run("corrupted link data", func(t *testing.T) {
+		rc, err := ds.Open(ctx, bn)
+		require.NoError(t, err)
+		data, err := io.ReadAll(rc)
+		require.NoError(t, err)
+		require.NoError(t, rc.Close())
+
+		data[len(data)-1] ^= 0xFF
+		be := FromDatastore(&dsWrapper{
+			DS: ds,
+			openFn: func(ctx context.Context, name *common.BlobName) (io.ReadCloser, error) {
+				return io.NopCloser(bytes.NewReader(data)), nil
+			},
+		})
+
+		_, err = be.ContentVersion(ctx, bn)
+		require.ErrorIs(t, err, blobtypes.ErrValidationFailed)
+	})
+}
+
+func TestDeriveKey(t *testing.T) {
+	ctx := context.Background()
+	be := FromDatastore(datastore.InMemory())
+
+	bn, key, ai, err := be.Create(ctx, blobtypes.DynamicLink, bytes.NewReader([]byte("data")))
+	require.NoError(t, err)
+
+	derivedKey, err := DeriveKey(ctx, bn, ai)
+	require.NoError(t, err)
+	require.True(t, key.Equal(derivedKey))
+
+	rc, err := be.Open(ctx, bn, derivedKey)
+	require.NoError(t, err)
+	data, err := io.ReadAll(rc)
+	require.NoError(t, err)
+	require.NoError(t, rc.Close())
+	require.Equal(t, "data", string(data))
+
+	t.Run("static blob", func(t *testing.T) {
+		bn, _, _, err := be.Create(ctx, blobtypes.Static, bytes.NewReader([]byte("static")))
+		require.NoError(t, err)
+
+		_, err = DeriveKey(ctx, bn, ai)
+		require.ErrorIs(t, err, ErrNotADynamicLink)
+	})
+
+	t.Run("auth info of a different link", func(t *testing.T) {
+		bn2, _, _, err := be.Create(ctx, blobtypes.DynamicLink, bytes.NewReader([]byte("data")))
+		require.NoError(t, err)
+
+		_, err = DeriveKey(ctx, bn2, ai)
+		require.ErrorIs(t, err, ErrAuthInfoNameMismatch)
+	})
+
+	t.Run("invalid auth info", func(t *testing.T) {
+		_, err := DeriveKey(ctx, bn, common.AuthInfoFromBytes([]byte{1, 2, 3}))
+		require.ErrorIs(t, err, dynamiclink.ErrInvalidDynamicLinkAuthInfo)
+	})
+}
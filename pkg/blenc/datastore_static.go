@@ -20,11 +20,15 @@ import (
 	"context"
 	"crypto/sha256"
 	"errors"
+	"fmt"
 	"io"
+	"time"
 
 	"github.com/cinode/go/pkg/blobtypes"
 	"github.com/cinode/go/pkg/common"
+	"github.com/cinode/go/pkg/datastore"
 	"github.com/cinode/go/pkg/internal/utilities/cipherfactory"
+	"github.com/cinode/go/pkg/internal/utilities/securefifo"
 	"github.com/cinode/go/pkg/internal/utilities/validatingreader"
 )
 
@@ -32,7 +36,15 @@ var (
 	ErrCanNotUpdateStaticBlob = errors.New("blob update is not supported for static blobs")
 )
 
+const (
+	defaultConcurrentUploadTimeout = 30 * time.Second
+	concurrentUploadPollInterval   = 10 * time.Millisecond
+)
+
 func (be *beDatastore) openStatic(ctx context.Context, name *common.BlobName, key *common.BlobKey) (io.ReadCloser, error) {
+	if isCompressedKey(key) {
+		return be.openStaticCompressed(ctx, name, key)
+	}
 
 	rc, err := be.ds.Open(ctx, name)
 	if err != nil {
@@ -44,7 +56,7 @@ func (be *beDatastore) openStatic(ctx context.Context, name *common.BlobName, ke
 		return nil, err
 	}
 
-	keyGenerator := cipherfactory.NewKeyGenerator(blobtypes.Static)
+	keyGenerator := cipherfactory.NewKeyGenerator(cipherfactory.KeyAlgorithm(key), blobtypes.Static)
 
 	return &struct {
 		io.Reader
@@ -72,6 +84,10 @@ func (be *beDatastore) createStatic(
 	*common.AuthInfo,
 	error,
 ) {
+	if be.compressStatic {
+		return be.createStaticCompressed(ctx, r)
+	}
+
 	tempWriteBufferPlain, err := be.newSecureFifo()
 	if err != nil {
 		return nil, nil, nil, err
@@ -84,14 +100,13 @@ func (be *beDatastore) createStatic(
 	}
 	defer tempWriteBufferEncrypted.Close()
 
-	keyGenerator := cipherfactory.NewKeyGenerator(blobtypes.Static)
+	keyGenerator := cipherfactory.NewKeyGenerator(be.staticAlgorithm, blobtypes.Static)
 	_, err = io.Copy(tempWriteBufferPlain, io.TeeReader(r, keyGenerator))
 	if err != nil {
 		return nil, nil, nil, err
 	}
 
 	key := keyGenerator.Generate()
-	iv := cipherfactory.DefaultIV(key) // We can use this since each blob will have different key
 
 	rClone, err := tempWriteBufferPlain.Done() // rClone will allow re-reading the source data
 	if err != nil {
@@ -99,6 +114,28 @@ func (be *beDatastore) createStatic(
 	}
 	defer rClone.Close()
 
+	name, err := be.encryptAndStoreStatic(ctx, key, rClone, tempWriteBufferEncrypted)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	return name, key, nil, nil
+}
+
+// encryptAndStoreStatic encrypts the plain data with given key and sends
+// it to the datastore. Encrypted data is buffered in the tempWriteBufferEncrypted
+// fifo since the blob name is known only after all the data is encrypted.
+func (be *beDatastore) encryptAndStoreStatic(
+	ctx context.Context,
+	key *common.BlobKey,
+	plain io.Reader,
+	tempWriteBufferEncrypted securefifo.Writer,
+) (
+	*common.BlobName,
+	error,
+) {
+	iv := cipherfactory.DefaultIV(key) // We can use this since each blob will have different key
+
 	// Encrypt data with calculated key, hash encrypted data to generate blob name
 	blobNameHasher := sha256.New()
 	encWriter, err := cipherfactory.StreamCipherWriter(
@@ -109,33 +146,33 @@ func (be *beDatastore) createStatic(
 		),
 	)
 	if err != nil {
-		return nil, nil, nil, err
+		return nil, err
 	}
 
-	_, err = io.Copy(encWriter, rClone)
+	_, err = io.Copy(encWriter, plain)
 	if err != nil {
-		return nil, nil, nil, err
+		return nil, err
 	}
 
 	encReader, err := tempWriteBufferEncrypted.Done()
 	if err != nil {
-		return nil, nil, nil, err
+		return nil, err
 	}
 	defer encReader.Close()
 
 	// Generate blob name from the encrypted data
 	name, err := common.BlobNameFromHashAndType(blobNameHasher.Sum(nil), blobtypes.Static)
 	if err != nil {
-		return nil, nil, nil, err
+		return nil, err
 	}
 
 	// Send encrypted blob into the datastore
-	err = be.ds.Update(ctx, name, encReader)
+	err = be.storeStatic(ctx, name, encReader)
 	if err != nil {
-		return nil, nil, nil, err
+		return nil, err
 	}
 
-	return name, key, nil, nil
+	return name, nil
 }
 
 func (be *beDatastore) updateStatic(
@@ -147,3 +184,170 @@ func (be *beDatastore) updateStatic(
 ) error {
 	return ErrCanNotUpdateStaticBlob
 }
+
+// createStaticFromReaderAt creates static blob re-reading the source instead
+// of using temporary buffers. The source is read three times - to compute
+// the encryption key, to compute the blob name and finally to send encrypted
+// data to the datastore. If the source changes in the meantime, the datastore
+// rejects the data due to a blob name mismatch.
+func (be *beDatastore) createStaticFromReaderAt(
+	ctx context.Context,
+	ra io.ReaderAt,
+	size int64,
+) (
+	*common.BlobName,
+	*common.BlobKey,
+	*common.AuthInfo,
+	error,
+) {
+	if be.compressStatic {
+		// The compressed data must be buffered anyway
+		return be.createStatic(ctx, io.NewSectionReader(ra, 0, size))
+	}
+
+	name, key, err := staticBlobName(be.staticAlgorithm, ra, size)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	// Encrypt the data again while sending it to the datastore
+	iv := cipherfactory.DefaultIV(key)
+	encReader, err := cipherfactory.StreamCipherReader(key, iv, io.NewSectionReader(ra, 0, size))
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	err = be.storeStatic(ctx, name, encReader)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	return name, key, nil, nil
+}
+
+// StaticBlobName computes the name and the key of the static blob that would
+// be created from given data without storing anything. Since the static blob
+// name is derived from the content, it can be used to check whether the data
+// is already stored in the datastore. The source is read twice - to compute
+// the encryption key and to compute the blob name.
+//
+// The name is computed for blobs encrypted with the default XChaCha20
+// algorithm, see StaticBlobNameForAlgorithm for other algorithms.
+func StaticBlobName(ra io.ReaderAt, size int64) (*common.BlobName, *common.BlobKey, error) {
+	return staticBlobName(XChaCha20, ra, size)
+}
+
+// StaticBlobNameForAlgorithm works like StaticBlobName but computes the name
+// of the blob encrypted with given algorithm
+func StaticBlobNameForAlgorithm(alg EncryptionAlgorithm, ra io.ReaderAt, size int64) (*common.BlobName, *common.BlobKey, error) {
+	if !alg.Valid() {
+		return nil, nil, fmt.Errorf("%w: %s", ErrUnsupportedEncryptionAlgorithm, alg)
+	}
+	return staticBlobName(alg, ra, size)
+}
+
+// StaticBlobNameForKey works like StaticBlobName but computes the name of the
+// blob created the same way as the blob with given key - with the same
+// encryption algorithm and, if the key is of a compressed blob, from the
+// compressed data. It is used to check whether the data matches an existing
+// blob regardless of options used to create that blob.
+func StaticBlobNameForKey(key *common.BlobKey, ra io.ReaderAt, size int64) (*common.BlobName, *common.BlobKey, error) {
+	if !isCompressedKey(key) {
+		return StaticBlobNameForAlgorithm(cipherfactory.KeyAlgorithm(key), ra, size)
+	}
+
+	alg := cipherfactory.KeyAlgorithm(setCompressedKeyFlag(key, false))
+	name, plainKey, err := staticBlobNameFromSource(alg, func() (io.Reader, error) {
+		return compressedReader(io.NewSectionReader(ra, 0, size))
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return name, setCompressedKeyFlag(plainKey, true), nil
+}
+
+func staticBlobName(alg EncryptionAlgorithm, ra io.ReaderAt, size int64) (*common.BlobName, *common.BlobKey, error) {
+	return staticBlobNameFromSource(alg, func() (io.Reader, error) {
+		return io.NewSectionReader(ra, 0, size), nil
+	})
+}
+
+// staticBlobNameFromSource computes the name and the key of the static blob,
+// the source function is called twice to read the same data - to compute the
+// encryption key and to compute the blob name
+func staticBlobNameFromSource(
+	alg EncryptionAlgorithm,
+	source func() (io.Reader, error),
+) (*common.BlobName, *common.BlobKey, error) {
+	r, err := source()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	keyGenerator := cipherfactory.NewKeyGenerator(alg, blobtypes.Static)
+	_, err = io.Copy(keyGenerator, r)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	key := keyGenerator.Generate()
+	iv := cipherfactory.DefaultIV(key) // We can use this since each blob will have different key
+
+	// Encrypt data with calculated key, hash encrypted data to generate blob name
+	blobNameHasher := sha256.New()
+	encWriter, err := cipherfactory.StreamCipherWriter(key, iv, blobNameHasher)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	r, err = source()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	_, err = io.Copy(encWriter, r)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	name, err := common.BlobNameFromHashAndType(blobNameHasher.Sum(nil), blobtypes.Static)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return name, key, nil
+}
+
+// storeStatic sends encrypted static blob data to the datastore.
+//
+// Static blob name is derived from its content thus a concurrent upload of
+// the same blob name always contains identical data. Instead of failing,
+// wait for such concurrent upload to finish. The original error is returned
+// if the blob does not show up in the datastore in time.
+func (be *beDatastore) storeStatic(ctx context.Context, name *common.BlobName, r io.Reader) error {
+	err := be.ds.Update(ctx, name, r)
+	if !errors.Is(err, datastore.ErrUploadInProgress) {
+		return err
+	}
+
+	deadline := time.Now().Add(be.concurrentUploadTimeout)
+	for {
+		exists, existsErr := be.ds.Exists(ctx, name)
+		if existsErr != nil {
+			return existsErr
+		}
+		if exists {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(concurrentUploadPollInterval):
+		}
+	}
+}
@@ -0,0 +1,210 @@
+/*
+Copyright © 2023 Bartłomiej Święcki (byo)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package blenc
+
+import (
+	"bufio"
+	"compress/flate"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/cinode/go/pkg/blobtypes"
+	"github.com/cinode/go/pkg/common"
+	"github.com/cinode/go/pkg/internal/utilities/cipherfactory"
+)
+
+var (
+	ErrInvalidCompressedData = fmt.Errorf("%w: invalid compressed data", blobtypes.ErrValidationFailed)
+)
+
+// Keys of compressed static blobs have this bit set in the key type byte,
+// remaining bits identify the encryption algorithm
+const compressedKeyFlag = 0x80
+
+func isCompressedKey(key *common.BlobKey) bool {
+	keyBytes := key.Bytes()
+	return len(keyBytes) > 0 &&
+		keyBytes[0]&compressedKeyFlag != 0 &&
+		cipherfactory.Algorithm(keyBytes[0]&^compressedKeyFlag).Valid()
+}
+
+func setCompressedKeyFlag(key *common.BlobKey, compressed bool) *common.BlobKey {
+	keyBytes := key.Bytes()
+	if len(keyBytes) == 0 {
+		return key
+	}
+	if compressed {
+		keyBytes[0] |= compressedKeyFlag
+	} else {
+		keyBytes[0] &^= compressedKeyFlag
+	}
+	return common.BlobKeyFromBytes(keyBytes)
+}
+
+// countingWriter counts bytes written to the underlying writer
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(b []byte) (int, error) {
+	n, err := c.w.Write(b)
+	c.n += int64(n)
+	return n, err
+}
+
+// compressedReader returns the data compressed the same way as the content
+// of compressed static blobs, the reader must be read until EOF
+func compressedReader(r io.Reader) (io.Reader, error) {
+	pr, pw := io.Pipe()
+	fw, err := flate.NewWriter(pw, flate.BestCompression)
+	if err != nil {
+		return nil, err
+	}
+
+	go func() {
+		_, err := io.Copy(fw, r)
+		if err == nil {
+			err = fw.Close()
+		}
+		pw.CloseWithError(err)
+	}()
+
+	return pr, nil
+}
+
+// createStaticCompressed creates the static blob from the data compressed
+// with DEFLATE. Both the original and the compressed data are buffered, the
+// original one is stored if it is not larger than the compressed one.
+func (be *beDatastore) createStaticCompressed(
+	ctx context.Context,
+	r io.Reader,
+) (
+	*common.BlobName,
+	*common.BlobKey,
+	*common.AuthInfo,
+	error,
+) {
+	tempWriteBufferPlain, err := be.newSecureFifo()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	defer tempWriteBufferPlain.Close()
+
+	tempWriteBufferCompressed, err := be.newSecureFifo()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	defer tempWriteBufferCompressed.Close()
+
+	tempWriteBufferEncrypted, err := be.newSecureFifo()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	defer tempWriteBufferEncrypted.Close()
+
+	plainKeyGenerator := cipherfactory.NewKeyGenerator(be.staticAlgorithm, blobtypes.Static)
+	compressedKeyGenerator := cipherfactory.NewKeyGenerator(be.staticAlgorithm, blobtypes.Static)
+
+	compressedWriter := &countingWriter{w: io.MultiWriter(tempWriteBufferCompressed, compressedKeyGenerator)}
+	fw, err := flate.NewWriter(compressedWriter, flate.BestCompression)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	plainSize, err := io.Copy(io.MultiWriter(tempWriteBufferPlain, plainKeyGenerator, fw), r)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	err = fw.Close()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	compressed := compressedWriter.n < plainSize
+
+	keyGenerator, tempWriteBuffer := plainKeyGenerator, tempWriteBufferPlain
+	if compressed {
+		keyGenerator, tempWriteBuffer = compressedKeyGenerator, tempWriteBufferCompressed
+	}
+
+	key := keyGenerator.Generate()
+
+	rClone, err := tempWriteBuffer.Done()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	defer rClone.Close()
+
+	name, err := be.encryptAndStoreStatic(ctx, key, rClone, tempWriteBufferEncrypted)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	return name, setCompressedKeyFlag(key, compressed), nil, nil
+}
+
+// openStaticCompressed opens the static blob with compressed data, the
+// blob is validated as any other static blob and then decompressed
+func (be *beDatastore) openStaticCompressed(ctx context.Context, name *common.BlobName, key *common.BlobKey) (io.ReadCloser, error) {
+	rc, err := be.openStatic(ctx, name, setCompressedKeyFlag(key, false))
+	if err != nil {
+		return nil, err
+	}
+
+	// Buffered reader implements io.ByteReader, flate does not read
+	// past the end of the compressed stream in such case
+	compressed := bufio.NewReader(rc)
+
+	return &decompressingReader{
+		compressed:   compressed,
+		decompressor: flate.NewReader(compressed),
+		closer:       rc,
+	}, nil
+}
+
+type decompressingReader struct {
+	compressed   *bufio.Reader
+	decompressor io.ReadCloser
+	closer       io.Closer
+}
+
+func (d *decompressingReader) Read(b []byte) (int, error) {
+	n, err := d.decompressor.Read(b)
+	switch {
+	case err == io.EOF:
+		// There must be no data after the compressed stream, reaching the
+		// end of the blob data also completes its validation
+		_, err = d.compressed.ReadByte()
+		if err == nil {
+			return n, fmt.Errorf("%w: data after the end of the compressed stream", ErrInvalidCompressedData)
+		}
+		return n, err
+
+	case errors.Is(err, io.ErrUnexpectedEOF),
+		errors.As(err, new(flate.CorruptInputError)):
+		return n, fmt.Errorf("%w: %w", ErrInvalidCompressedData, err)
+	}
+	return n, err
+}
+
+func (d *decompressingReader) Close() error {
+	d.decompressor.Close()
+	return d.closer.Close()
+}
@@ -0,0 +1,165 @@
+/*
+Copyright © 2023 Bartłomiej Święcki (byo)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package blenc
+
+import (
+	"bytes"
+	"compress/flate"
+	"context"
+	"crypto/rand"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/cinode/go/pkg/blobtypes"
+	"github.com/cinode/go/pkg/common"
+	"github.com/cinode/go/pkg/datastore"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompressedStatic(t *testing.T) {
+	ctx := context.Background()
+	ds := datastore.InMemory()
+	be := FromDatastore(ds, CompressStatic())
+
+	readBack := func(t *testing.T, name *common.BlobName, key *common.BlobKey) []byte {
+		rc, err := FromDatastore(ds).Open(ctx, name, key)
+		require.NoError(t, err)
+		data, err := io.ReadAll(rc)
+		require.NoError(t, err)
+		require.NoError(t, rc.Close())
+		return data
+	}
+
+	t.Run("compressible data", func(t *testing.T) {
+		data := []byte(strings.Repeat("Some compressible text content. ", 1000))
+
+		name, key, _, err := be.Create(ctx, blobtypes.Static, bytes.NewReader(data))
+		require.NoError(t, err)
+		require.True(t, isCompressedKey(key))
+		require.Equal(t, data, readBack(t, name, key))
+
+		size, err := ds.Size(ctx, name)
+		require.NoError(t, err)
+		require.Less(t, size, int64(len(data))/10)
+
+		plainName, _, _, err := FromDatastore(ds).Create(ctx, blobtypes.Static, bytes.NewReader(data))
+		require.NoError(t, err)
+		require.False(t, name.Equal(plainName))
+
+		name2, key2, _, err := be.CreateFromReaderAt(ctx, blobtypes.Static, bytes.NewReader(data), int64(len(data)))
+		require.NoError(t, err)
+		require.True(t, name.Equal(name2))
+		require.True(t, key.Equal(key2))
+
+		_, err = be.OpenSeekable(ctx, name, key)
+		require.ErrorIs(t, err, ErrSeekNotSupported)
+	})
+
+	t.Run("incompressible data", func(t *testing.T) {
+		data := make([]byte, 64*1024)
+		_, err := rand.Read(data)
+		require.NoError(t, err)
+
+		name, key, _, err := be.Create(ctx, blobtypes.Static, bytes.NewReader(data))
+		require.NoError(t, err)
+		require.False(t, isCompressedKey(key))
+		require.Equal(t, data, readBack(t, name, key))
+
+		size, err := ds.Size(ctx, name)
+		require.NoError(t, err)
+		require.EqualValues(t, len(data), size)
+
+		plainName, plainKey, _, err := FromDatastore(ds).Create(ctx, blobtypes.Static, bytes.NewReader(data))
+		require.NoError(t, err)
+		require.True(t, name.Equal(plainName))
+		require.True(t, key.Equal(plainKey))
+	})
+
+	t.Run("empty data", func(t *testing.T) {
+		name, key, _, err := be.Create(ctx, blobtypes.Static, bytes.NewReader(nil))
+		require.NoError(t, err)
+		require.False(t, isCompressedKey(key))
+		require.Empty(t, readBack(t, name, key))
+	})
+
+	t.Run("with AES encryption", func(t *testing.T) {
+		data := []byte(strings.Repeat("AES encrypted compressed data. ", 100))
+		be := FromDatastore(ds, CompressStatic(), StaticEncryption(AES256CTR))
+
+		name, key, _, err := be.Create(ctx, blobtypes.Static, bytes.NewReader(data))
+		require.NoError(t, err)
+		require.True(t, isCompressedKey(key))
+		require.EqualValues(t, AES256CTR, setCompressedKeyFlag(key, false).Bytes()[0])
+		require.Equal(t, data, readBack(t, name, key))
+	})
+}
+
+func TestCompressedStaticInvalidData(t *testing.T) {
+	ctx := context.Background()
+	ds := datastore.InMemory()
+	be := FromDatastore(ds)
+
+	compress := func(data []byte) []byte {
+		buf := bytes.NewBuffer(nil)
+		fw, err := flate.NewWriter(buf, flate.BestCompression)
+		require.NoError(t, err)
+		_, err = fw.Write(data)
+		require.NoError(t, err)
+		require.NoError(t, fw.Close())
+		return buf.Bytes()
+	}
+	compressed := compress([]byte(strings.Repeat("data", 100)))
+
+	for _, d := range []struct {
+		desc string
+		data []byte
+	}{
+		{"not compressed", []byte("plain data that is not compressed")},
+		{"truncated", compressed[:len(compressed)/2]},
+		{"data after the compressed stream", append(compressed[:len(compressed):len(compressed)], 0x00)},
+		{"empty", []byte{}},
+	} {
+		t.Run(d.desc, func(t *testing.T) {
+			// Uncompressed blob with the compressed data as its content
+			name, key, _, err := be.Create(ctx, blobtypes.Static, bytes.NewReader(d.data))
+			require.NoError(t, err)
+
+			rc, err := be.Open(ctx, name, setCompressedKeyFlag(key, true))
+			require.NoError(t, err)
+			defer rc.Close()
+
+			_, err = io.ReadAll(rc)
+			require.ErrorIs(t, err, ErrInvalidCompressedData)
+			require.ErrorIs(t, err, blobtypes.ErrValidationFailed)
+		})
+	}
+
+	t.Run("invalid key", func(t *testing.T) {
+		name, key, _, err := be.Create(ctx, blobtypes.Static, bytes.NewReader(compressed))
+		require.NoError(t, err)
+
+		keyBytes := key.Bytes()
+		keyBytes[len(keyBytes)-1] ^= 0xFF
+		rc, err := be.Open(ctx, name, setCompressedKeyFlag(common.BlobKeyFromBytes(keyBytes), true))
+		require.NoError(t, err)
+		defer rc.Close()
+
+		_, err = io.ReadAll(rc)
+		require.ErrorIs(t, err, blobtypes.ErrValidationFailed)
+	})
+}
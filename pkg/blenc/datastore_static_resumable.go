@@ -0,0 +1,288 @@
+/*
+Copyright © 2022 Bartłomiej Święcki (byo)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package blenc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/cinode/go/pkg/blobtypes"
+	"github.com/cinode/go/pkg/common"
+	"github.com/cinode/go/pkg/internal/utilities/cipherfactory"
+	"github.com/cinode/go/pkg/internal/utilities/securefifo"
+)
+
+var (
+	ErrInvalidCheckpoint = errors.New("invalid create checkpoint")
+)
+
+const (
+	defaultCheckpointInterval = 64 * 1024 * 1024
+
+	checkpointVersion        = 1
+	checkpointDataFileSuffix = ".data"
+	checkpointTempFileSuffix = ".tmp"
+	resumableReadBufferSize  = 32 * 1024
+)
+
+// staticCreateCheckpoint is stored in the checkpoint sidecar file, it
+// describes how much of the source data was already processed
+type staticCreateCheckpoint struct {
+	Version      int    `json:"version"`
+	Offset       int64  `json:"offset"`
+	FifoKey      []byte `json:"fifoKey"`
+	FifoNonce    []byte `json:"fifoNonce"`
+	KeyHashState []byte `json:"keyHashState"`
+	Algorithm    byte   `json:"algorithm,omitempty"`
+}
+
+func (be *beDatastore) CreateStaticResumable(
+	ctx context.Context,
+	checkpointPath string,
+	open func(offset int64) (io.ReadCloser, error),
+) (
+	*common.BlobName,
+	*common.BlobKey,
+	error,
+) {
+	name, key, size, err := be.createStaticResumable(ctx, checkpointPath, open)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if be.metrics != nil {
+		be.metrics.IncCreate(blobtypes.Static, size)
+	}
+	return name, key, nil
+}
+
+func (be *beDatastore) createStaticResumable(
+	ctx context.Context,
+	checkpointPath string,
+	open func(offset int64) (io.ReadCloser, error),
+) (
+	*common.BlobName,
+	*common.BlobKey,
+	int64,
+	error,
+) {
+	dataPath := checkpointPath + checkpointDataFileSuffix
+
+	tempWriteBufferPlain, keyGenerator, err := be.resumeStaticCreate(checkpointPath, dataPath)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	defer tempWriteBufferPlain.Close()
+
+	tempWriteBufferEncrypted, err := be.newSecureFifo()
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	defer tempWriteBufferEncrypted.Close()
+
+	size, err := be.readResumableSource(ctx, checkpointPath, open, tempWriteBufferPlain, keyGenerator)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+
+	key := keyGenerator.Generate()
+
+	rClone, err := tempWriteBufferPlain.Done()
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	defer rClone.Close()
+
+	name, err := be.encryptAndStoreStatic(ctx, key, rClone, tempWriteBufferEncrypted)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+
+	// The blob is stored, checkpoint files are no longer needed
+	err = os.Remove(checkpointPath)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, nil, 0, err
+	}
+	err = os.Remove(dataPath)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+
+	return name, key, size, nil
+}
+
+// resumeStaticCreate restores the state of the interrupted create from the
+// checkpoint file or starts from scratch if there's no checkpoint
+func (be *beDatastore) resumeStaticCreate(checkpointPath, dataPath string) (
+	securefifo.PersistentWriter,
+	cipherfactory.KeyGenerator,
+	error,
+) {
+	data, err := os.ReadFile(checkpointPath)
+	if errors.Is(err, os.ErrNotExist) {
+		w, err := securefifo.NewPersistent(dataPath)
+		if err != nil {
+			return nil, nil, err
+		}
+		return w, cipherfactory.NewKeyGenerator(be.staticAlgorithm, blobtypes.Static), nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var cp staticCreateCheckpoint
+	err = json.Unmarshal(data, &cp)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %w", ErrInvalidCheckpoint, err)
+	}
+	if cp.Version != checkpointVersion {
+		return nil, nil, fmt.Errorf("%w: unsupported version %d", ErrInvalidCheckpoint, cp.Version)
+	}
+
+	// The create is continued with the algorithm it was started with
+	keyGenerator, err := cipherfactory.KeyGeneratorFromState(
+		cipherfactory.Algorithm(cp.Algorithm),
+		cp.KeyHashState,
+	)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %w", ErrInvalidCheckpoint, err)
+	}
+
+	w, err := securefifo.ResumePersistent(dataPath, securefifo.State{
+		Key:    cp.FifoKey,
+		Nonce:  cp.FifoNonce,
+		Offset: cp.Offset,
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %w", ErrInvalidCheckpoint, err)
+	}
+
+	return w, keyGenerator, nil
+}
+
+// readResumableSource reads the remaining source data into the temporary
+// fifo and the key generator. The checkpoint is stored periodically and
+// when reading is interrupted by the source or context errors.
+func (be *beDatastore) readResumableSource(
+	ctx context.Context,
+	checkpointPath string,
+	open func(offset int64) (io.ReadCloser, error),
+	w securefifo.PersistentWriter,
+	keyGenerator cipherfactory.KeyGenerator,
+) (int64, error) {
+	state, err := w.Checkpoint()
+	if err != nil {
+		return 0, err
+	}
+
+	rc, err := open(state.Offset)
+	if err != nil {
+		return 0, err
+	}
+	defer rc.Close()
+
+	offset := state.Offset
+	lastCheckpoint := offset
+	buf := make([]byte, resumableReadBufferSize)
+	for {
+		n, readErr := rc.Read(buf)
+		if n > 0 {
+			// On write errors the fifo and the key generator can get out
+			// of sync, the last stored checkpoint must be used in such case
+			_, err = w.Write(buf[:n])
+			if err != nil {
+				return 0, err
+			}
+			keyGenerator.Write(buf[:n])
+			offset += int64(n)
+		}
+
+		if errors.Is(readErr, io.EOF) {
+			return offset, nil
+		}
+		if readErr == nil {
+			readErr = ctx.Err()
+		}
+		if readErr != nil {
+			err = storeStaticCreateCheckpoint(checkpointPath, w, keyGenerator)
+			if err != nil {
+				return 0, errors.Join(readErr, err)
+			}
+			return 0, readErr
+		}
+
+		if offset-lastCheckpoint >= be.checkpointInterval {
+			err = storeStaticCreateCheckpoint(checkpointPath, w, keyGenerator)
+			if err != nil {
+				return 0, err
+			}
+			lastCheckpoint = offset
+		}
+	}
+}
+
+// storeStaticCreateCheckpoint atomically replaces the checkpoint file
+func storeStaticCreateCheckpoint(
+	checkpointPath string,
+	w securefifo.PersistentWriter,
+	keyGenerator cipherfactory.KeyGenerator,
+) error {
+	state, err := w.Checkpoint()
+	if err != nil {
+		return err
+	}
+
+	keyHashState, err := keyGenerator.MarshalBinary()
+	if err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(staticCreateCheckpoint{
+		Version:      checkpointVersion,
+		Offset:       state.Offset,
+		FifoKey:      state.Key,
+		FifoNonce:    state.Nonce,
+		KeyHashState: keyHashState,
+		Algorithm:    byte(keyGenerator.Algorithm()),
+	})
+	if err != nil {
+		return err
+	}
+
+	tempPath := checkpointPath + checkpointTempFileSuffix
+	fl, err := os.OpenFile(tempPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	_, err = fl.Write(data)
+	if err == nil {
+		err = fl.Sync()
+	}
+	if closeErr := fl.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tempPath)
+		return err
+	}
+
+	return os.Rename(tempPath, checkpointPath)
+}
@@ -0,0 +1,184 @@
+/*
+Copyright © 2022 Bartłomiej Święcki (byo)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package blenc
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/iotest"
+
+	"github.com/cinode/go/pkg/blobtypes"
+	"github.com/cinode/go/pkg/datastore"
+	"github.com/stretchr/testify/require"
+)
+
+func resumableTestData() []byte {
+	data := make([]byte, 1024*1024)
+	for i := range data {
+		data[i] = byte(i*7 + i/1000)
+	}
+	return data
+}
+
+func TestStaticCreateResumable(t *testing.T) {
+	data := resumableTestData()
+	ds := datastore.InMemory()
+
+	expectedName, expectedKey, _, err := FromDatastore(datastore.InMemory()).
+		Create(context.Background(), blobtypes.Static, bytes.NewReader(data))
+	require.NoError(t, err)
+
+	t.Run("uninterrupted", func(t *testing.T) {
+		be := FromDatastore(datastore.InMemory())
+		checkpoint := filepath.Join(t.TempDir(), "checkpoint")
+
+		name, key, err := be.CreateStaticResumable(context.Background(), checkpoint,
+			func(offset int64) (io.ReadCloser, error) {
+				require.Zero(t, offset)
+				return io.NopCloser(bytes.NewReader(data)), nil
+			},
+		)
+		require.NoError(t, err)
+		require.Equal(t, expectedName, name)
+		require.Equal(t, expectedKey, key)
+		require.NoFileExists(t, checkpoint)
+		require.NoFileExists(t, checkpoint+checkpointDataFileSuffix)
+	})
+
+	t.Run("interrupted and resumed", func(t *testing.T) {
+		checkpoint := filepath.Join(t.TempDir(), "checkpoint")
+		const interruptAt = 300*1024 + 17
+		injectedErr := errors.New("connection lost")
+
+		be := FromDatastore(ds, CheckpointInterval(64*1024))
+		_, _, err := be.CreateStaticResumable(context.Background(), checkpoint,
+			func(offset int64) (io.ReadCloser, error) {
+				require.Zero(t, offset)
+				return io.NopCloser(io.MultiReader(
+					bytes.NewReader(data[:interruptAt]),
+					iotest.ErrReader(injectedErr),
+				)), nil
+			},
+		)
+		require.ErrorIs(t, err, injectedErr)
+		require.FileExists(t, checkpoint)
+		require.FileExists(t, checkpoint+checkpointDataFileSuffix)
+
+		exists, err := ds.Exists(context.Background(), expectedName)
+		require.NoError(t, err)
+		require.False(t, exists)
+
+		// Simulate a crash after some data was written without a checkpoint,
+		// such data must be discarded when resuming
+		fl, err := os.OpenFile(checkpoint+checkpointDataFileSuffix, os.O_WRONLY|os.O_APPEND, 0)
+		require.NoError(t, err)
+		_, err = fl.Write([]byte("not checkpointed data"))
+		require.NoError(t, err)
+		require.NoError(t, fl.Close())
+
+		// New instance simulates the retry done by a different process
+		be = FromDatastore(ds, CheckpointInterval(64*1024))
+		name, key, err := be.CreateStaticResumable(context.Background(), checkpoint,
+			func(offset int64) (io.ReadCloser, error) {
+				require.EqualValues(t, interruptAt, offset)
+				return io.NopCloser(bytes.NewReader(data[offset:])), nil
+			},
+		)
+		require.NoError(t, err)
+		require.Equal(t, expectedName, name)
+		require.Equal(t, expectedKey, key)
+		require.NoFileExists(t, checkpoint)
+		require.NoFileExists(t, checkpoint+checkpointDataFileSuffix)
+
+		rc, err := be.Open(context.Background(), name, key)
+		require.NoError(t, err)
+		readBack, err := io.ReadAll(rc)
+		require.NoError(t, err)
+		require.NoError(t, rc.Close())
+		require.Equal(t, data, readBack)
+	})
+
+	t.Run("interrupted by context cancellation", func(t *testing.T) {
+		checkpoint := filepath.Join(t.TempDir(), "checkpoint")
+		be := FromDatastore(datastore.InMemory(), CheckpointInterval(64*1024))
+
+		// Cancel the context in the middle of reading the source
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		_, _, err := be.CreateStaticResumable(ctx, checkpoint,
+			func(offset int64) (io.ReadCloser, error) {
+				return io.NopCloser(io.MultiReader(
+					bytes.NewReader(data[:200*1024]),
+					readerFunc(func(b []byte) (int, error) {
+						cancel()
+						return 0, nil
+					}),
+				)), nil
+			},
+		)
+		require.ErrorIs(t, err, context.Canceled)
+
+		var resumedAt int64
+		name, key, err := be.CreateStaticResumable(context.Background(), checkpoint,
+			func(offset int64) (io.ReadCloser, error) {
+				resumedAt = offset
+				return io.NopCloser(bytes.NewReader(data[offset:])), nil
+			},
+		)
+		require.NoError(t, err)
+		require.EqualValues(t, 200*1024, resumedAt)
+		require.Equal(t, expectedName, name)
+		require.Equal(t, expectedKey, key)
+	})
+
+	t.Run("invalid checkpoint", func(t *testing.T) {
+		checkpoint := filepath.Join(t.TempDir(), "checkpoint")
+		be := FromDatastore(datastore.InMemory())
+
+		for _, content := range []string{
+			"not a json",
+			`{"version":2}`,
+			`{"version":1,"keyHashState":"aW52YWxpZA=="}`,
+		} {
+			require.NoError(t, os.WriteFile(checkpoint, []byte(content), 0600))
+
+			_, _, err := be.CreateStaticResumable(context.Background(), checkpoint,
+				func(offset int64) (io.ReadCloser, error) {
+					require.FailNow(t, "source must not be opened")
+					return nil, nil
+				},
+			)
+			require.ErrorIs(t, err, ErrInvalidCheckpoint)
+		}
+	})
+
+	t.Run("source open error", func(t *testing.T) {
+		checkpoint := filepath.Join(t.TempDir(), "checkpoint")
+		be := FromDatastore(datastore.InMemory())
+		injectedErr := errors.New("can not open")
+
+		_, _, err := be.CreateStaticResumable(context.Background(), checkpoint,
+			func(offset int64) (io.ReadCloser, error) { return nil, injectedErr },
+		)
+		require.ErrorIs(t, err, injectedErr)
+	})
+}
@@ -0,0 +1,206 @@
+/*
+Copyright © 2022 Bartłomiej Święcki (byo)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package blenc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+
+	"github.com/cinode/go/pkg/blobtypes"
+	"github.com/cinode/go/pkg/common"
+	"github.com/cinode/go/pkg/datastore"
+	"github.com/cinode/go/pkg/internal/utilities/cipherfactory"
+)
+
+var (
+	ErrSeekNotSupported = errors.New("seeking is not supported for this blob type")
+	ErrInvalidSeek      = errors.New("invalid seek")
+)
+
+func (be *beDatastore) OpenSeekable(ctx context.Context, name *common.BlobName, key *common.BlobKey) (io.ReadSeekCloser, error) {
+	if name.Type() != blobtypes.Static {
+		// Dynamic link data can only be validated as a whole
+		return nil, ErrSeekNotSupported
+	}
+	if isCompressedKey(key) {
+		// Compressed data can only be read sequentially
+		return nil, ErrSeekNotSupported
+	}
+
+	r := &staticSeekableReader{
+		ctx:          ctx,
+		ds:           be.ds,
+		name:         name,
+		key:          key,
+		size:         -1,
+		keyGenerator: cipherfactory.NewKeyGenerator(cipherfactory.KeyAlgorithm(key), blobtypes.Static),
+	}
+
+	// Open the blob upfront to report missing blobs and invalid keys early
+	err := r.open()
+	if err != nil {
+		return nil, err
+	}
+
+	if be.metrics != nil {
+		be.metrics.IncOpen(name.Type())
+	}
+	return r, nil
+}
+
+// staticSeekableReader gives random access to decrypted static blob data.
+//
+// Blob data can only be validated once all of it is read, the key is
+// calculated from the data read sequentially from the beginning of the
+// blob and is checked when the end of data is reached. Data read after
+// seeking to a position the hashing did not reach yet is not validated.
+type staticSeekableReader struct {
+	ctx  context.Context
+	ds   datastore.DS
+	name *common.BlobName
+	key  *common.BlobKey
+
+	// Underlying encrypted data and the decrypting reader, both positioned
+	// at pos, nil if the data has to be opened before next read
+	rc io.ReadCloser
+	r  io.Reader
+
+	pos    int64
+	size   int64
+	closed bool
+
+	// Number of bytes from the beginning of the blob fed into the key
+	// generator so far
+	hashed       int64
+	keyGenerator cipherfactory.KeyGenerator
+}
+
+func (s *staticSeekableReader) open() error {
+	rc, err := s.ds.Open(s.ctx, s.name)
+	if err != nil {
+		return err
+	}
+
+	if s.pos > 0 {
+		if seeker, ok := rc.(io.Seeker); ok {
+			_, err = seeker.Seek(s.pos, io.SeekStart)
+		} else {
+			_, err = io.CopyN(io.Discard, rc, s.pos)
+		}
+		if err != nil && !errors.Is(err, io.EOF) {
+			rc.Close()
+			return err
+		}
+	}
+
+	r, err := cipherfactory.StreamCipherReaderAt(s.key, cipherfactory.DefaultIV(s.key), rc, s.pos)
+	if err != nil {
+		rc.Close()
+		return err
+	}
+
+	s.rc, s.r = rc, r
+	return nil
+}
+
+func (s *staticSeekableReader) Read(b []byte) (int, error) {
+	if s.closed {
+		return 0, fs.ErrClosed
+	}
+
+	if s.r == nil {
+		err := s.open()
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := s.r.Read(b)
+	if s.pos <= s.hashed && s.hashed < s.pos+int64(n) {
+		// Only data not yet hashed is fed into the key generator
+		s.keyGenerator.Write(b[s.hashed-s.pos : n])
+		s.hashed = s.pos + int64(n)
+	}
+	s.pos += int64(n)
+
+	if errors.Is(err, io.EOF) {
+		if s.size < 0 {
+			s.size = s.pos
+		}
+		if s.pos == s.hashed && !s.key.Equal(s.keyGenerator.Generate()) {
+			return n, blobtypes.ErrValidationFailed
+		}
+	}
+
+	return n, err
+}
+
+func (s *staticSeekableReader) Seek(offset int64, whence int) (int64, error) {
+	if s.closed {
+		return 0, fs.ErrClosed
+	}
+
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += s.pos
+	case io.SeekEnd:
+		if s.size < 0 {
+			// Stream cipher does not change the size of the data
+			size, err := s.ds.Size(s.ctx, s.name)
+			if err != nil {
+				return 0, err
+			}
+			s.size = size
+		}
+		offset += s.size
+	default:
+		return 0, fmt.Errorf("%w: invalid whence %d", ErrInvalidSeek, whence)
+	}
+	if offset < 0 {
+		return 0, fmt.Errorf("%w: negative position", ErrInvalidSeek)
+	}
+
+	if offset == s.pos {
+		return offset, nil
+	}
+
+	// Data is re-opened at the new position on next read
+	if s.rc != nil {
+		s.rc.Close()
+		s.rc, s.r = nil, nil
+	}
+	s.pos = offset
+	return offset, nil
+}
+
+func (s *staticSeekableReader) Close() error {
+	if s.closed {
+		return fs.ErrClosed
+	}
+	s.closed = true
+
+	if s.rc == nil {
+		return nil
+	}
+	err := s.rc.Close()
+	s.rc, s.r = nil, nil
+	return err
+}
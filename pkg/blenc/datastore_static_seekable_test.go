@@ -0,0 +1,198 @@
+/*
+Copyright © 2022 Bartłomiej Święcki (byo)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package blenc
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/fs"
+	"testing"
+
+	"github.com/cinode/go/pkg/blobtypes"
+	"github.com/cinode/go/pkg/common"
+	"github.com/cinode/go/pkg/datastore"
+	"github.com/cinode/go/pkg/internal/utilities/cipherfactory"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOpenSeekable(t *testing.T) {
+	ctx := context.Background()
+
+	data := make([]byte, 1000)
+	for i := range data {
+		data[i] = byte(i * 7)
+	}
+
+	fsDS, err := datastore.InFileSystem(t.TempDir())
+	require.NoError(t, err)
+
+	for _, d := range []struct {
+		desc string
+		ds   datastore.DS
+	}{
+		{"in memory", datastore.InMemory()},
+		{"in filesystem", fsDS},
+	} {
+		t.Run(d.desc, func(t *testing.T) {
+			be := FromDatastore(d.ds)
+			bn, key, _, err := be.Create(ctx, blobtypes.Static, bytes.NewReader(data))
+			require.NoError(t, err)
+
+			rsc, err := be.OpenSeekable(ctx, bn, key)
+			require.NoError(t, err)
+			defer rsc.Close()
+
+			for _, pos := range []int64{500, 0, 63, 64, 999, 130, 1} {
+				n, err := rsc.Seek(pos, io.SeekStart)
+				require.NoError(t, err)
+				require.Equal(t, pos, n)
+
+				buf := make([]byte, 100)
+				read, err := io.ReadFull(rsc, buf)
+				if err != io.ErrUnexpectedEOF {
+					require.NoError(t, err)
+				}
+				require.Equal(t, data[pos:pos+int64(read)], buf[:read], "position %d", pos)
+			}
+
+			n, err := rsc.Seek(-10, io.SeekEnd)
+			require.NoError(t, err)
+			require.EqualValues(t, 990, n)
+
+			n, err = rsc.Seek(-90, io.SeekCurrent)
+			require.NoError(t, err)
+			require.EqualValues(t, 900, n)
+
+			rest, err := io.ReadAll(rsc)
+			require.NoError(t, err)
+			require.Equal(t, data[900:], rest)
+
+			// Seeking past the end is allowed
+			n, err = rsc.Seek(2000, io.SeekStart)
+			require.NoError(t, err)
+			require.EqualValues(t, 2000, n)
+			rest, err = io.ReadAll(rsc)
+			require.NoError(t, err)
+			require.Empty(t, rest)
+
+			// Reading sequentially from the beginning validates the data
+			_, err = rsc.Seek(0, io.SeekStart)
+			require.NoError(t, err)
+			all, err := io.ReadAll(rsc)
+			require.NoError(t, err)
+			require.Equal(t, data, all)
+		})
+	}
+
+	t.Run("validation failure", func(t *testing.T) {
+		ds := datastore.InMemory()
+		be := FromDatastore(ds)
+		bn, _, _, err := be.Create(ctx, blobtypes.Static, bytes.NewReader(data))
+		require.NoError(t, err)
+
+		// Key of different data leads to data that does not match the key
+		_, key2, _, err := be.Create(ctx, blobtypes.Static, bytes.NewReader([]byte("other")))
+		require.NoError(t, err)
+
+		rsc, err := be.OpenSeekable(ctx, bn, key2)
+		require.NoError(t, err)
+		defer rsc.Close()
+
+		// Partial reads are not validated
+		_, err = rsc.Seek(500, io.SeekStart)
+		require.NoError(t, err)
+		_, err = io.ReadAll(rsc)
+		require.NoError(t, err)
+
+		// Data read from the beginning to the end is validated
+		_, err = rsc.Seek(0, io.SeekStart)
+		require.NoError(t, err)
+		_, err = io.ReadAll(rsc)
+		require.ErrorIs(t, err, blobtypes.ErrValidationFailed)
+	})
+
+	t.Run("validation with seeks within hashed data", func(t *testing.T) {
+		be := FromDatastore(datastore.InMemory())
+		bn, key, _, err := be.Create(ctx, blobtypes.Static, bytes.NewReader([]byte("other data")))
+		require.NoError(t, err)
+		_, key2, _, err := be.Create(ctx, blobtypes.Static, bytes.NewReader(data))
+		require.NoError(t, err)
+
+		for _, k := range []struct {
+			key *common.BlobKey
+			err error
+		}{{key, nil}, {key2, blobtypes.ErrValidationFailed}} {
+			rsc, err := be.OpenSeekable(ctx, bn, k.key)
+			require.NoError(t, err)
+
+			buf := make([]byte, 5)
+			_, err = io.ReadFull(rsc, buf)
+			require.NoError(t, err)
+
+			// Jump back, hashing continues once the read reaches
+			// the hashed position again
+			_, err = rsc.Seek(2, io.SeekStart)
+			require.NoError(t, err)
+			_, err = io.ReadAll(rsc)
+			require.ErrorIs(t, err, k.err)
+			require.NoError(t, rsc.Close())
+		}
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		ds := datastore.InMemory()
+		be := FromDatastore(ds)
+
+		bn, key, _, err := be.Create(ctx, blobtypes.Static, bytes.NewReader(data))
+		require.NoError(t, err)
+
+		linkName, linkKey, _, err := be.Create(ctx, blobtypes.DynamicLink, bytes.NewReader(data))
+		require.NoError(t, err)
+
+		_, err = be.OpenSeekable(ctx, linkName, linkKey)
+		require.ErrorIs(t, err, ErrSeekNotSupported)
+
+		require.NoError(t, ds.Delete(ctx, bn))
+		_, err = be.OpenSeekable(ctx, bn, key)
+		require.ErrorIs(t, err, datastore.ErrNotFound)
+
+		bn, key, _, err = be.Create(ctx, blobtypes.Static, bytes.NewReader(data))
+		require.NoError(t, err)
+
+		_, err = be.OpenSeekable(ctx, bn, common.BlobKeyFromBytes([]byte{0xFF}))
+		require.ErrorIs(t, err, cipherfactory.ErrInvalidEncryptionConfig)
+
+		rsc, err := be.OpenSeekable(ctx, bn, key)
+		require.NoError(t, err)
+
+		_, err = rsc.Seek(0, 100)
+		require.ErrorIs(t, err, ErrInvalidSeek)
+
+		_, err = rsc.Seek(-1, io.SeekStart)
+		require.ErrorIs(t, err, ErrInvalidSeek)
+
+		require.NoError(t, rsc.Close())
+		require.ErrorIs(t, rsc.Close(), fs.ErrClosed)
+
+		_, err = rsc.Read(make([]byte, 1))
+		require.ErrorIs(t, err, fs.ErrClosed)
+
+		_, err = rsc.Seek(0, io.SeekStart)
+		require.ErrorIs(t, err, fs.ErrClosed)
+	})
+}
@@ -22,8 +22,10 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"sync"
 	"testing"
 	"testing/iotest"
+	"time"
 
 	"github.com/cinode/go/pkg/blobtypes"
 	"github.com/cinode/go/pkg/common"
@@ -279,3 +281,301 @@ func TestStaticErrorTruncatedDatastore(t *testing.T) {
 		require.Equal(t, secureFifosCreated, secureFifosClosed)
 	})
 }
+
+type readerAtFunc func(b []byte, off int64) (int, error)
+
+func (f readerAtFunc) ReadAt(b []byte, off int64) (int, error) { return f(b, off) }
+
+func TestStaticCreateFromReaderAt(t *testing.T) {
+	ctx := context.Background()
+	data := bytes.Repeat([]byte("Hello world! "), 10000)
+
+	t.Run("same result as Create without secure fifo", func(t *testing.T) {
+		be := FromDatastore(datastore.InMemory())
+		fifoCreated := false
+		be.(*beDatastore).newSecureFifo = func() (securefifo.Writer, error) {
+			fifoCreated = true
+			return securefifo.New()
+		}
+
+		bn, key, ai, err := be.CreateFromReaderAt(ctx, blobtypes.Static, bytes.NewReader(data), int64(len(data)))
+		require.NoError(t, err)
+		require.Nil(t, ai)
+		require.False(t, fifoCreated)
+
+		bn2, key2, _, err := be.Create(ctx, blobtypes.Static, bytes.NewReader(data))
+		require.NoError(t, err)
+		require.True(t, fifoCreated)
+		require.True(t, bn.Equal(bn2))
+		require.True(t, key.Equal(key2))
+
+		rc, err := be.Open(ctx, bn, key)
+		require.NoError(t, err)
+		readBack, err := io.ReadAll(rc)
+		require.NoError(t, err)
+		require.NoError(t, rc.Close())
+		require.Equal(t, data, readBack)
+	})
+
+	t.Run("only given size is read", func(t *testing.T) {
+		be := FromDatastore(datastore.InMemory())
+
+		bn, key, _, err := be.CreateFromReaderAt(ctx, blobtypes.Static, bytes.NewReader(data), 5)
+		require.NoError(t, err)
+
+		bn2, key2, _, err := be.Create(ctx, blobtypes.Static, bytes.NewReader(data[:5]))
+		require.NoError(t, err)
+		require.True(t, bn.Equal(bn2))
+		require.True(t, key.Equal(key2))
+	})
+
+	t.Run("read errors", func(t *testing.T) {
+		for failingPass := 1; failingPass <= 3; failingPass++ {
+			t.Run(fmt.Sprint(failingPass), func(t *testing.T) {
+				be := FromDatastore(datastore.InMemory())
+				injectedErr := errors.New("test")
+
+				pass := 0
+				ra := readerAtFunc(func(b []byte, off int64) (int, error) {
+					if off == 0 {
+						pass++
+					}
+					if pass == failingPass {
+						return 0, injectedErr
+					}
+					return bytes.NewReader(data).ReadAt(b, off)
+				})
+
+				bn, key, ai, err := be.CreateFromReaderAt(ctx, blobtypes.Static, ra, int64(len(data)))
+				require.ErrorIs(t, err, injectedErr)
+				require.Nil(t, bn)
+				require.Nil(t, key)
+				require.Nil(t, ai)
+			})
+		}
+	})
+
+	t.Run("source modified while creating", func(t *testing.T) {
+		be := FromDatastore(datastore.InMemory())
+
+		pass := 0
+		ra := readerAtFunc(func(b []byte, off int64) (int, error) {
+			if off == 0 {
+				pass++
+			}
+			if pass == 3 {
+				return bytes.NewReader(bytes.ToUpper(data)).ReadAt(b, off)
+			}
+			return bytes.NewReader(data).ReadAt(b, off)
+		})
+
+		_, _, _, err := be.CreateFromReaderAt(ctx, blobtypes.Static, ra, int64(len(data)))
+		require.ErrorIs(t, err, blobtypes.ErrValidationFailed)
+	})
+
+	t.Run("dynamic link", func(t *testing.T) {
+		be := FromDatastore(datastore.InMemory())
+
+		bn, key, ai, err := be.CreateFromReaderAt(ctx, blobtypes.DynamicLink, bytes.NewReader(data), 5)
+		require.NoError(t, err)
+		require.NotNil(t, ai)
+
+		rc, err := be.Open(ctx, bn, key)
+		require.NoError(t, err)
+		readBack, err := io.ReadAll(rc)
+		require.NoError(t, err)
+		require.NoError(t, rc.Close())
+		require.Equal(t, data[:5], readBack)
+	})
+
+	t.Run("unknown blob type", func(t *testing.T) {
+		be := FromDatastore(datastore.InMemory())
+
+		_, _, _, err := be.CreateFromReaderAt(ctx, common.NewBlobType(0xFF), bytes.NewReader(data), 5)
+		require.ErrorIs(t, err, blobtypes.ErrUnknownBlobType)
+	})
+}
+
+// racingDatastore blocks the first upload until the blob's existence
+// is checked by a concurrent uploader, concurrent uploads are rejected
+// as if the first upload was done by a different process
+type racingDatastore struct {
+	datastore.DS
+	uploadStarted chan struct{}
+	existsCalled  chan struct{}
+	existsOnce    sync.Once
+	failUpload    bool
+}
+
+func (r *racingDatastore) Update(ctx context.Context, name *common.BlobName, rd io.Reader) error {
+	select {
+	case <-r.uploadStarted:
+		// Concurrent upload
+		return datastore.ErrUploadInProgress
+	default:
+	}
+
+	return r.DS.Update(ctx, name, readerFunc(func(b []byte) (int, error) {
+		select {
+		case <-r.uploadStarted:
+		default:
+			close(r.uploadStarted)
+			<-r.existsCalled
+			if r.failUpload {
+				return 0, errors.New("upload failed")
+			}
+		}
+		return rd.Read(b)
+	}))
+}
+
+func (r *racingDatastore) Exists(ctx context.Context, name *common.BlobName) (bool, error) {
+	r.existsOnce.Do(func() { close(r.existsCalled) })
+	return r.DS.Exists(ctx, name)
+}
+
+type readerFunc func(b []byte) (int, error)
+
+func (f readerFunc) Read(b []byte) (int, error) { return f(b) }
+
+func TestStaticConcurrentUploadOfTheSameBlob(t *testing.T) {
+	ctx := context.Background()
+	data := []byte("Hello world!")
+
+	t.Run("both uploads succeed", func(t *testing.T) {
+		ds := &racingDatastore{
+			DS:            datastore.InMemory(),
+			uploadStarted: make(chan struct{}),
+			existsCalled:  make(chan struct{}),
+		}
+		be := FromDatastore(ds)
+
+		type result struct {
+			bn  *common.BlobName
+			key *common.BlobKey
+			err error
+		}
+		firstDone := make(chan result)
+		go func() {
+			bn, key, _, err := be.Create(ctx, blobtypes.Static, bytes.NewReader(data))
+			firstDone <- result{bn, key, err}
+		}()
+
+		<-ds.uploadStarted
+		bn2, key2, _, err := be.Create(ctx, blobtypes.Static, bytes.NewReader(data))
+		require.NoError(t, err)
+
+		first := <-firstDone
+		require.NoError(t, first.err)
+		require.True(t, first.bn.Equal(bn2))
+		require.True(t, first.key.Equal(key2))
+
+		exists, err := ds.Exists(ctx, bn2)
+		require.NoError(t, err)
+		require.True(t, exists)
+	})
+
+	t.Run("concurrent upload fails", func(t *testing.T) {
+		ds := &racingDatastore{
+			DS:            datastore.InMemory(),
+			uploadStarted: make(chan struct{}),
+			existsCalled:  make(chan struct{}),
+			failUpload:    true,
+		}
+		be := FromDatastore(ds)
+		be.(*beDatastore).concurrentUploadTimeout = 50 * time.Millisecond
+
+		firstDone := make(chan error)
+		go func() {
+			_, _, _, err := be.CreateFromReaderAt(ctx, blobtypes.Static, bytes.NewReader(data), int64(len(data)))
+			firstDone <- err
+		}()
+
+		<-ds.uploadStarted
+		_, _, _, err := be.CreateFromReaderAt(ctx, blobtypes.Static, bytes.NewReader(data), int64(len(data)))
+		require.ErrorIs(t, err, datastore.ErrUploadInProgress)
+
+		require.ErrorContains(t, <-firstDone, "upload failed")
+	})
+
+	t.Run("cancelled context", func(t *testing.T) {
+		ds := &racingDatastore{
+			DS:            datastore.InMemory(),
+			uploadStarted: make(chan struct{}),
+			existsCalled:  make(chan struct{}),
+			failUpload:    true,
+		}
+		be := FromDatastore(ds)
+
+		firstDone := make(chan error)
+		go func() {
+			_, _, _, err := be.Create(ctx, blobtypes.Static, bytes.NewReader(data))
+			firstDone <- err
+		}()
+
+		<-ds.uploadStarted
+		ctx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+		defer cancel()
+		_, _, _, err := be.Create(ctx, blobtypes.Static, bytes.NewReader(data))
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+
+		require.Error(t, <-firstDone)
+	})
+}
+
+func TestStaticBlobName(t *testing.T) {
+	ctx := context.Background()
+	ds := datastore.InMemory()
+	be := FromDatastore(ds)
+
+	for _, data := range [][]byte{
+		{},
+		[]byte("Hello world!"),
+		bytes.Repeat([]byte("Hello world! "), 10000),
+	} {
+		bn, key, err := StaticBlobName(bytes.NewReader(data), int64(len(data)))
+		require.NoError(t, err)
+
+		// Nothing is stored
+		exists, err := ds.Exists(ctx, bn)
+		require.NoError(t, err)
+		require.False(t, exists)
+
+		bn2, key2, _, err := be.Create(ctx, blobtypes.Static, bytes.NewReader(data))
+		require.NoError(t, err)
+		require.True(t, bn.Equal(bn2))
+		require.True(t, key.Equal(key2))
+	}
+}
+
+func TestStaticBlobNameForKey(t *testing.T) {
+	ctx := context.Background()
+
+	for _, opts := range [][]Option{
+		nil,
+		{StaticEncryption(AES256CTR)},
+		{CompressStatic()},
+		{CompressStatic(), StaticEncryption(AES256CTR)},
+	} {
+		be := FromDatastore(datastore.InMemory(), opts...)
+
+		for _, data := range [][]byte{
+			{},
+			[]byte("Hello world!"),
+			bytes.Repeat([]byte("Hello world! "), 10000),
+		} {
+			bn, key, _, err := be.Create(ctx, blobtypes.Static, bytes.NewReader(data))
+			require.NoError(t, err)
+
+			bn2, key2, err := StaticBlobNameForKey(key, bytes.NewReader(data), int64(len(data)))
+			require.NoError(t, err)
+			require.True(t, bn.Equal(bn2))
+			require.True(t, key.Equal(key2))
+
+			changed := append([]byte("!"), data...)
+			bn3, _, err := StaticBlobNameForKey(key, bytes.NewReader(changed), int64(len(changed)))
+			require.NoError(t, err)
+			require.False(t, bn.Equal(bn3))
+		}
+	}
+}
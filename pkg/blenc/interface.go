@@ -18,17 +18,33 @@ package blenc
 
 import (
 	"context"
+	"errors"
 	"io"
 
 	"github.com/cinode/go/pkg/common"
 	"github.com/cinode/go/pkg/datastore"
+	"github.com/cinode/go/pkg/internal/utilities/cipherfactory"
 )
 
 // AuthInfo is an opaque data that is necessary to perform update of a blob with the same name
 type AuthInfo = []byte
 
 var (
-	ErrNotFound = datastore.ErrNotFound
+	ErrNotFound                       = datastore.ErrNotFound
+	ErrUnsupportedEncryptionAlgorithm = errors.New("unsupported encryption algorithm")
+)
+
+// EncryptionAlgorithm identifies the algorithm used to encrypt the blob data,
+// it is encoded in the first byte of the blob key
+type EncryptionAlgorithm = cipherfactory.Algorithm
+
+const (
+	// XChaCha20 is the default encryption algorithm
+	XChaCha20 EncryptionAlgorithm = cipherfactory.AlgorithmXChaCha20
+
+	// AES256CTR is the AES-256 cipher in the counter mode, it is usually
+	// faster than XChaCha20 on CPUs with AES hardware acceleration
+	AES256CTR EncryptionAlgorithm = cipherfactory.AlgorithmAES256CTR
 )
 
 // BE interface describes functionality exposed by Blob Encryption layer
@@ -41,16 +57,49 @@ type BE interface {
 	// close the reader once done working with it.
 	Open(ctx context.Context, name *common.BlobName, key *common.BlobKey) (io.ReadCloser, error)
 
+	// OpenSeekable opens given static blob data for random access reads.
+	//
+	// The data is validated only when it is read sequentially from the
+	// beginning up to its end. Seeking is not supported for dynamic links
+	// since their data can only be validated as a whole.
+	OpenSeekable(ctx context.Context, name *common.BlobName, key *common.BlobKey) (io.ReadSeekCloser, error)
+
 	// Create completely new blob with given dataset, as a result, the blob name and optional
 	// AuthInfo that allows blob's update is returned
 	Create(ctx context.Context, blobType common.BlobType, r io.Reader) (*common.BlobName, *common.BlobKey, *common.AuthInfo, error)
 
+	// CreateFromReaderAt works like Create but reads the data of given size
+	// from a source that can be read multiple times. The source is re-read
+	// instead of being buffered in temporary storage, it must not change
+	// until the call finishes.
+	CreateFromReaderAt(ctx context.Context, blobType common.BlobType, ra io.ReaderAt, size int64) (*common.BlobName, *common.BlobKey, *common.AuthInfo, error)
+
+	// CreateStaticResumable creates a static blob from the source that may
+	// need more than one attempt to be read, e.g. a huge file downloaded
+	// over an unreliable link.
+	//
+	// The progress of reading the source is periodically stored in the
+	// checkpoint file at given path, the data read so far is kept in an
+	// encrypted file next to it. If the call is interrupted, it can be
+	// retried with the same checkpoint path, even in a different process,
+	// and continues where the last checkpoint was taken. The open function
+	// must return the source data starting at given offset. Checkpoint
+	// files contain the key needed to decrypt the temporary data and must
+	// be protected the same way as the source. They are removed once the
+	// blob is created.
+	CreateStaticResumable(ctx context.Context, checkpointPath string, open func(offset int64) (io.ReadCloser, error)) (*common.BlobName, *common.BlobKey, error)
+
 	// Update updates given blob type with new data,
 	// The update must happen within a single blob name (i.e. it can not end up with blob with different name)
 	// and may not be available for certain blob types such as static blobs.
 	// A valid auth info is necessary to ensure a correct new content can be created
 	Update(ctx context.Context, name *common.BlobName, ai *common.AuthInfo, key *common.BlobKey, r io.Reader) error
 
+	// ContentVersion returns the content version of the dynamic link data
+	// currently stored under given name. The link data is validated
+	// but it is not decrypted thus the key is not needed.
+	ContentVersion(ctx context.Context, name *common.BlobName) (uint64, error)
+
 	// Exists does check whether blob of given name exists. It forwards the call
 	// to underlying datastore.
 	Exists(ctx context.Context, name *common.BlobName) (bool, error)
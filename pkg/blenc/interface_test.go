@@ -30,6 +30,7 @@ import (
 	"github.com/cinode/go/pkg/datastore"
 	"github.com/cinode/go/pkg/internal/blobtypes/dynamiclink"
 	"github.com/cinode/go/pkg/internal/utilities/cipherfactory"
+	"github.com/stretchr/testify/require"
 	"github.com/stretchr/testify/suite"
 )
 
@@ -44,6 +45,47 @@ func TestBlencTestSuite(t *testing.T) {
 	})
 }
 
+func TestBlencTestSuiteFromDatastores(t *testing.T) {
+	suite.Run(t, &BlencTestSuite{
+		be: FromDatastores(datastore.InMemory(), []datastore.DS{datastore.InMemory()}),
+	})
+}
+
+func TestFromDatastoresFallback(t *testing.T) {
+	ctx := context.Background()
+	primary := datastore.InMemory()
+	fallback := datastore.InMemory()
+
+	data := []byte("Hello world!!!")
+	bn, key, _, err := FromDatastore(fallback).Create(ctx, blobtypes.Static, bytes.NewReader(data))
+	require.NoError(t, err)
+
+	be := FromDatastores(primary, []datastore.DS{fallback})
+
+	exists, err := be.Exists(ctx, bn)
+	require.NoError(t, err)
+	require.True(t, exists)
+
+	rc, err := be.Open(ctx, bn, key)
+	require.NoError(t, err)
+	readData, err := io.ReadAll(rc)
+	require.NoError(t, err)
+	require.NoError(t, rc.Close())
+	require.Equal(t, data, readData)
+
+	// New blobs are only stored in the primary datastore
+	bn2, _, _, err := be.Create(ctx, blobtypes.Static, bytes.NewReader([]byte("new blob")))
+	require.NoError(t, err)
+
+	exists, err = primary.Exists(ctx, bn2)
+	require.NoError(t, err)
+	require.True(t, exists)
+
+	exists, err = fallback.Exists(ctx, bn2)
+	require.NoError(t, err)
+	require.False(t, exists)
+}
+
 func (s *BlencTestSuite) TestStaticBlobs() {
 	data := []byte("Hello world!!!")
 
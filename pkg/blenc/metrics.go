@@ -0,0 +1,72 @@
+/*
+Copyright © 2023 Bartłomiej Święcki (byo)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package blenc
+
+import (
+	"errors"
+	"io"
+
+	"github.com/cinode/go/pkg/blobtypes"
+	"github.com/cinode/go/pkg/common"
+)
+
+// Metrics receives counters of operations performed by the Blob Encryption
+// layer. Only successful operations are counted, validation failures are
+// reported separately. Implementations must be safe for concurrent use.
+type Metrics interface {
+	// IncCreate is called after a new blob was created from given number
+	// of unencrypted bytes
+	IncCreate(blobType common.BlobType, bytes int64)
+
+	// IncOpen is called after a blob was opened for reading
+	IncOpen(blobType common.BlobType)
+
+	// IncUpdate is called after a blob was updated with given number
+	// of unencrypted bytes
+	IncUpdate(blobType common.BlobType, bytes int64)
+
+	// IncDelete is called after a blob was deleted
+	IncDelete(blobType common.BlobType)
+
+	// IncValidationFailure is called when blob data fails validation,
+	// either when opening it or while reading its content
+	IncValidationFailure(blobType common.BlobType)
+}
+
+// WithMetrics sets the receiver of operation counters. Without this option
+// no metrics are collected and there's no additional overhead.
+func WithMetrics(m Metrics) Option {
+	return func(be *beDatastore) { be.metrics = m }
+}
+
+// validationReportingReader reports validation failures detected while
+// reading blob data
+type validationReportingReader struct {
+	io.ReadCloser
+	metrics  Metrics
+	blobType common.BlobType
+	reported bool
+}
+
+func (v *validationReportingReader) Read(b []byte) (int, error) {
+	n, err := v.ReadCloser.Read(b)
+	if !v.reported && errors.Is(err, blobtypes.ErrValidationFailed) {
+		v.reported = true
+		v.metrics.IncValidationFailure(v.blobType)
+	}
+	return n, err
+}
@@ -0,0 +1,160 @@
+/*
+Copyright © 2023 Bartłomiej Święcki (byo)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package blenc
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"maps"
+	"sync"
+	"testing"
+
+	"github.com/cinode/go/pkg/blobtypes"
+	"github.com/cinode/go/pkg/common"
+	"github.com/cinode/go/pkg/datastore"
+	"github.com/stretchr/testify/require"
+)
+
+type mockMetrics struct {
+	m      sync.Mutex
+	counts map[string]int
+	bytes  map[string]int64
+}
+
+func newMockMetrics() *mockMetrics {
+	return &mockMetrics{
+		counts: map[string]int{},
+		bytes:  map[string]int64{},
+	}
+}
+
+func (m *mockMetrics) inc(op string, blobType common.BlobType, bytes int64) {
+	m.m.Lock()
+	defer m.m.Unlock()
+	key := fmt.Sprintf("%s:%d", op, blobType.IDByte())
+	m.counts[key]++
+	m.bytes[key] += bytes
+}
+
+func (m *mockMetrics) IncCreate(t common.BlobType, b int64) { m.inc("create", t, b) }
+func (m *mockMetrics) IncOpen(t common.BlobType)            { m.inc("open", t, 0) }
+func (m *mockMetrics) IncUpdate(t common.BlobType, b int64) { m.inc("update", t, b) }
+func (m *mockMetrics) IncDelete(t common.BlobType)          { m.inc("delete", t, 0) }
+func (m *mockMetrics) IncValidationFailure(t common.BlobType) {
+	m.inc("validation", t, 0)
+}
+
+func TestMetrics(t *testing.T) {
+	ctx := context.Background()
+	dsw := dsWrapper{DS: datastore.InMemory()}
+	m := newMockMetrics()
+	be := FromDatastore(&dsw, WithMetrics(m))
+
+	static := fmt.Sprint(blobtypes.Static.IDByte())
+	link := fmt.Sprint(blobtypes.DynamicLink.IDByte())
+
+	staticData := []byte("Hello world!")
+	bnStatic, keyStatic, _, err := be.Create(ctx, blobtypes.Static, bytes.NewReader(staticData))
+	require.NoError(t, err)
+
+	bnLink, keyLink, ai, err := be.Create(ctx, blobtypes.DynamicLink, bytes.NewReader([]byte("link")))
+	require.NoError(t, err)
+
+	require.Equal(t, 1, m.counts["create:"+static])
+	require.EqualValues(t, len(staticData), m.bytes["create:"+static])
+	require.Equal(t, 1, m.counts["create:"+link])
+	require.EqualValues(t, 4, m.bytes["create:"+link])
+
+	err = be.Update(ctx, bnLink, ai, keyLink, bytes.NewReader([]byte("new link")))
+	require.NoError(t, err)
+	require.Equal(t, 1, m.counts["update:"+link])
+	require.EqualValues(t, 8, m.bytes["update:"+link])
+
+	for _, d := range []struct {
+		bn  *common.BlobName
+		key *common.BlobKey
+	}{
+		{bnStatic, keyStatic},
+		{bnLink, keyLink},
+	} {
+		rc, err := be.Open(ctx, d.bn, d.key)
+		require.NoError(t, err)
+		_, err = io.ReadAll(rc)
+		require.NoError(t, err)
+		require.NoError(t, rc.Close())
+	}
+	require.Equal(t, 1, m.counts["open:"+static])
+	require.Equal(t, 1, m.counts["open:"+link])
+	require.Zero(t, m.counts["validation:"+static])
+	require.Zero(t, m.counts["validation:"+link])
+
+	t.Run("validation failure of static blob", func(t *testing.T) {
+		dsw.openFn = func(ctx context.Context, name *common.BlobName) (io.ReadCloser, error) {
+			return io.NopCloser(bytes.NewReader(make([]byte, len(staticData)))), nil
+		}
+		defer func() { dsw.openFn = nil }()
+
+		rc, err := be.Open(ctx, bnStatic, keyStatic)
+		require.NoError(t, err)
+		_, err = io.ReadAll(rc)
+		require.ErrorIs(t, err, blobtypes.ErrValidationFailed)
+		require.NoError(t, rc.Close())
+
+		require.Equal(t, 1, m.counts["validation:"+static])
+	})
+
+	t.Run("validation failure of dynamic link", func(t *testing.T) {
+		dsw.openFn = func(ctx context.Context, name *common.BlobName) (io.ReadCloser, error) {
+			return io.NopCloser(bytes.NewReader([]byte{0xFF})), nil
+		}
+		defer func() { dsw.openFn = nil }()
+
+		_, err := be.Open(ctx, bnLink, keyLink)
+		require.ErrorIs(t, err, blobtypes.ErrValidationFailed)
+
+		require.Equal(t, 1, m.counts["validation:"+link])
+		require.Equal(t, 1, m.counts["open:"+link])
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		err := be.Delete(ctx, bnStatic)
+		require.NoError(t, err)
+		err = be.Delete(ctx, bnLink)
+		require.NoError(t, err)
+
+		require.Equal(t, 1, m.counts["delete:"+static])
+		require.Equal(t, 1, m.counts["delete:"+link])
+
+		err = be.Delete(ctx, bnStatic)
+		require.ErrorIs(t, err, datastore.ErrNotFound)
+		require.Equal(t, 1, m.counts["delete:"+static])
+	})
+
+	t.Run("failed operations are not counted", func(t *testing.T) {
+		before := maps.Clone(m.counts)
+
+		_, _, _, err := be.Create(ctx, common.NewBlobType(0xFF), bytes.NewReader(nil))
+		require.ErrorIs(t, err, blobtypes.ErrUnknownBlobType)
+
+		_, err = be.Open(ctx, bnStatic, keyStatic)
+		require.ErrorIs(t, err, datastore.ErrNotFound)
+
+		require.Equal(t, before, m.counts)
+	})
+}
@@ -0,0 +1,94 @@
+/*
+Copyright © 2023 Bartłomiej Święcki (byo)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package blenc
+
+import "github.com/cinode/go/pkg/common"
+
+// Option can be used to customize the behavior of the Blob Encryption layer
+type Option func(be *beDatastore)
+
+// VersionSource sets the function used to generate content versions of
+// dynamic links. By default the version is based on the current time.
+//
+// Using a constant version source (i.e. always returning 0) produces
+// timestamp-free dynamic link blobs that are fully reproducible. Note that
+// with a constant version, a link update is only accepted by the datastore
+// if its signature hash wins the tie-break against the current link data
+// unless the VersionAboveStored option is also used.
+func VersionSource(f func() uint64) Option {
+	return ContentVersionFunc(func(*common.BlobName) uint64 { return f() })
+}
+
+// ContentVersionFunc sets the function used to generate content versions of
+// dynamic links, the function is given the name of the link being created or
+// updated. It allows versions to be allocated per link, e.g. from a build
+// counter, instead of being based on the wall-clock time. Same rules as for
+// VersionSource apply to versions not above the currently stored one.
+func ContentVersionFunc(f func(blobName *common.BlobName) uint64) Option {
+	return func(be *beDatastore) { be.generateVersion = f }
+}
+
+// VersionAboveStored makes dynamic link updates take precedence over the
+// currently stored link data even if the generated version is not above
+// the stored one. In such case the stored version increased by one is used.
+// Updates that do not change the link data keep the generated version, that
+// way repeated updates with a constant version source produce identical
+// blobs.
+//
+// This requires reading and decrypting the stored link before each update,
+// the update fails if the stored link can not be read.
+func VersionAboveStored() Option {
+	return func(be *beDatastore) { be.versionAboveStored = true }
+}
+
+// CheckpointInterval sets the number of source bytes read between
+// consecutive checkpoints stored by CreateStaticResumable, non-positive
+// values are ignored. By default the checkpoint is taken every 64MiB.
+func CheckpointInterval(bytes int64) Option {
+	return func(be *beDatastore) {
+		if bytes > 0 {
+			be.checkpointInterval = bytes
+		}
+	}
+}
+
+// StaticEncryption sets the algorithm used to encrypt newly created static
+// blobs, unsupported algorithms are ignored. By default XChaCha20 is used.
+//
+// The algorithm is encoded in the blob key thus blobs encrypted with any
+// supported algorithm can be read regardless of this option. Since the key
+// depends on the algorithm, the same data results in different blobs for
+// different algorithms. Dynamic links are always encrypted with XChaCha20.
+func StaticEncryption(alg EncryptionAlgorithm) Option {
+	return func(be *beDatastore) {
+		if alg.Valid() {
+			be.staticAlgorithm = alg
+		}
+	}
+}
+
+// CompressStatic enables compression of newly created static blobs. The data
+// is compressed with DEFLATE before it is encrypted and a flag stored in the
+// blob key makes Open decompress it transparently. Data that does not get
+// smaller is stored uncompressed so it never expands.
+//
+// Compressed blobs have different names than uncompressed ones with the same
+// content and they can not be opened with OpenSeekable. CreateStaticResumable
+// does not compress the data.
+func CompressStatic() Option {
+	return func(be *beDatastore) { be.compressStatic = true }
+}
@@ -0,0 +1,240 @@
+/*
+Copyright © 2023 Bartłomiej Święcki (byo)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package blenc
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"testing"
+	"testing/iotest"
+
+	"github.com/cinode/go/pkg/blobtypes"
+	"github.com/cinode/go/pkg/common"
+	"github.com/cinode/go/pkg/datastore"
+	"github.com/cinode/go/pkg/internal/blobtypes/dynamiclink"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVersionSourceOption(t *testing.T) {
+	ds := datastore.InMemory()
+	be := FromDatastore(ds, VersionSource(func() uint64 { return 0 }))
+
+	name, key, ai, err := be.Create(context.Background(), blobtypes.DynamicLink, bytes.NewReader([]byte("data")))
+	require.NoError(t, err)
+
+	rc, err := ds.Open(context.Background(), name)
+	require.NoError(t, err)
+	data1, err := io.ReadAll(rc)
+	require.NoError(t, err)
+	rc.Close()
+
+	// Re-publishing the same content with a constant version must produce the same link data
+	err = be.Update(context.Background(), name, ai, key, bytes.NewReader([]byte("data")))
+	require.NoError(t, err)
+
+	rc, err = ds.Open(context.Background(), name)
+	require.NoError(t, err)
+	data2, err := io.ReadAll(rc)
+	require.NoError(t, err)
+	rc.Close()
+
+	require.Equal(t, data1, data2)
+}
+
+func TestVersionAboveStoredOption(t *testing.T) {
+	ctx := context.Background()
+	ds := datastore.InMemory()
+	be := FromDatastore(ds,
+		VersionSource(func() uint64 { return 0 }),
+		VersionAboveStored(),
+	)
+
+	storedVersion := func(bn *common.BlobName) uint64 {
+		rc, err := ds.Open(ctx, bn)
+		require.NoError(t, err)
+		defer rc.Close()
+
+		pr, err := dynamiclink.FromPublicData(bn, rc)
+		require.NoError(t, err)
+		return pr.ContentVersion()
+	}
+
+	bn, key, ai, err := be.Create(ctx, blobtypes.DynamicLink, bytes.NewReader([]byte("data0")))
+	require.NoError(t, err)
+	require.EqualValues(t, 0, storedVersion(bn))
+
+	for i := 1; i <= 3; i++ {
+		data := []byte(fmt.Sprintf("data%d", i))
+		err = be.Update(ctx, bn, ai, key, bytes.NewReader(data))
+		require.NoError(t, err)
+		require.EqualValues(t, i, storedVersion(bn))
+
+		rc, err := be.Open(ctx, bn, key)
+		require.NoError(t, err)
+		readData, err := io.ReadAll(rc)
+		require.NoError(t, err)
+		require.NoError(t, rc.Close())
+		require.Equal(t, data, readData)
+	}
+
+	t.Run("same data keeps the version", func(t *testing.T) {
+		err = be.Update(ctx, bn, ai, key, bytes.NewReader([]byte("data3")))
+		require.NoError(t, err)
+		require.EqualValues(t, 3, storedVersion(bn))
+	})
+
+	t.Run("generated version above stored one is used", func(t *testing.T) {
+		be := FromDatastore(ds,
+			VersionSource(func() uint64 { return 100 }),
+			VersionAboveStored(),
+		)
+		err = be.Update(ctx, bn, ai, key, bytes.NewReader([]byte("data4")))
+		require.NoError(t, err)
+		require.EqualValues(t, 100, storedVersion(bn))
+	})
+
+	t.Run("unreadable stored link", func(t *testing.T) {
+		err = be.Update(ctx, bn, ai, common.BlobKeyFromBytes([]byte("invalid")), bytes.NewReader([]byte("data5")))
+		require.Error(t, err)
+		require.EqualValues(t, 100, storedVersion(bn))
+	})
+}
+
+func TestContentVersionFuncOption(t *testing.T) {
+	ctx := context.Background()
+	ds := datastore.InMemory()
+
+	versions := map[string][]uint64{}
+	counter := uint64(100)
+	be := FromDatastore(ds, ContentVersionFunc(func(blobName *common.BlobName) uint64 {
+		counter++
+		versions[blobName.String()] = append(versions[blobName.String()], counter)
+		return counter
+	}))
+
+	name, key, ai, err := be.Create(ctx, blobtypes.DynamicLink, bytes.NewReader([]byte("data")))
+	require.NoError(t, err)
+
+	err = be.Update(ctx, name, ai, key, bytes.NewReader([]byte("data2")))
+	require.NoError(t, err)
+
+	// Version function is called with the name of the link being published
+	require.Equal(t, map[string][]uint64{name.String(): {101, 102}}, versions)
+
+	rc, err := ds.Open(ctx, name)
+	require.NoError(t, err)
+	defer rc.Close()
+
+	dl, err := dynamiclink.FromPublicData(name, rc)
+	require.NoError(t, err)
+	require.EqualValues(t, 102, dl.ContentVersion())
+}
+
+func TestStaticEncryptionOption(t *testing.T) {
+	ctx := context.Background()
+	ds := datastore.InMemory()
+	be := FromDatastore(ds, StaticEncryption(AES256CTR))
+	data := resumableTestData()
+
+	name, key, _, err := be.Create(ctx, blobtypes.Static, bytes.NewReader(data))
+	require.NoError(t, err)
+	require.EqualValues(t, AES256CTR, key.Bytes()[0])
+
+	readAll := func(t *testing.T, rc io.ReadCloser) []byte {
+		readBack, err := io.ReadAll(rc)
+		require.NoError(t, err)
+		require.NoError(t, rc.Close())
+		return readBack
+	}
+
+	t.Run("readable with default options", func(t *testing.T) {
+		rc, err := FromDatastore(ds).Open(ctx, name, key)
+		require.NoError(t, err)
+		require.Equal(t, data, readAll(t, rc))
+	})
+
+	t.Run("seekable read", func(t *testing.T) {
+		rsc, err := FromDatastore(ds).OpenSeekable(ctx, name, key)
+		require.NoError(t, err)
+		defer rsc.Close()
+
+		_, err = rsc.Seek(1000, io.SeekStart)
+		require.NoError(t, err)
+		readBack, err := io.ReadAll(rsc)
+		require.NoError(t, err)
+		require.Equal(t, data[1000:], readBack)
+	})
+
+	t.Run("different blob than with default algorithm", func(t *testing.T) {
+		name2, key2, _, err := FromDatastore(ds).Create(ctx, blobtypes.Static, bytes.NewReader(data))
+		require.NoError(t, err)
+		require.False(t, name.Equal(name2))
+		require.False(t, key.Equal(key2))
+	})
+
+	t.Run("create from reader at", func(t *testing.T) {
+		name2, key2, _, err := be.CreateFromReaderAt(ctx, blobtypes.Static, bytes.NewReader(data), int64(len(data)))
+		require.NoError(t, err)
+		require.True(t, name.Equal(name2))
+		require.True(t, key.Equal(key2))
+
+		name3, key3, err := StaticBlobNameForAlgorithm(AES256CTR, bytes.NewReader(data), int64(len(data)))
+		require.NoError(t, err)
+		require.True(t, name.Equal(name3))
+		require.True(t, key.Equal(key3))
+
+		_, _, err = StaticBlobNameForAlgorithm(EncryptionAlgorithm(0xFB), bytes.NewReader(data), int64(len(data)))
+		require.ErrorIs(t, err, ErrUnsupportedEncryptionAlgorithm)
+	})
+
+	t.Run("resumed create keeps the algorithm", func(t *testing.T) {
+		checkpoint := filepath.Join(t.TempDir(), "checkpoint")
+		injectedErr := errors.New("connection lost")
+
+		be := FromDatastore(datastore.InMemory(), StaticEncryption(AES256CTR), CheckpointInterval(64*1024))
+		_, _, err := be.CreateStaticResumable(ctx, checkpoint,
+			func(offset int64) (io.ReadCloser, error) {
+				return io.NopCloser(io.MultiReader(
+					bytes.NewReader(data[:300*1024]),
+					iotest.ErrReader(injectedErr),
+				)), nil
+			},
+		)
+		require.ErrorIs(t, err, injectedErr)
+
+		// Resumed with a different default algorithm
+		name2, key2, err := FromDatastore(datastore.InMemory()).CreateStaticResumable(ctx, checkpoint,
+			func(offset int64) (io.ReadCloser, error) {
+				return io.NopCloser(bytes.NewReader(data[offset:])), nil
+			},
+		)
+		require.NoError(t, err)
+		require.True(t, name.Equal(name2))
+		require.True(t, key.Equal(key2))
+	})
+
+	t.Run("unsupported algorithm is ignored", func(t *testing.T) {
+		_, key, _, err := FromDatastore(ds, StaticEncryption(EncryptionAlgorithm(0xFB))).
+			Create(ctx, blobtypes.Static, bytes.NewReader([]byte("data")))
+		require.NoError(t, err)
+		require.EqualValues(t, XChaCha20, key.Bytes()[0])
+	})
+}
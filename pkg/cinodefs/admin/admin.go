@@ -0,0 +1,298 @@
+/*
+Copyright © 2023 Bartłomiej Święcki (byo)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package admin
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/cinode/go/pkg/blenc"
+	"github.com/cinode/go/pkg/cinodefs"
+	"github.com/cinode/go/pkg/common"
+	"github.com/cinode/go/pkg/datastore"
+	"golang.org/x/exp/slog"
+)
+
+const (
+	FlushPath = "/flush"
+	GCPath    = "/gc"
+	StatsPath = "/stats"
+
+	defaultMaxLinkRedirects = 10
+)
+
+// Handler exposes administrative operations on a running filesystem
+// instance. It is meant to be mounted separately from the content serving
+// handler, every request must carry the `Authorization: Bearer <Token>`
+// header.
+//
+// Available endpoints:
+//   - POST /flush - flush pending changes to the datastore
+//   - POST /gc - remove blobs not reachable from the root entrypoint,
+//     with `?dry-run=true` the orphaned blobs are only reported; the
+//     request is rejected if there are unsaved changes since their blobs
+//     would be treated as orphans, writes must not run concurrently with gc
+//   - GET /stats - dataset summary and in-memory cache statistics
+type Handler struct {
+	FS cinodefs.FS
+	BE blenc.BE
+	DS datastore.DS
+
+	// Token required to access the admin endpoints, all requests are
+	// rejected if the token is empty
+	Token string
+
+	// MaxLinkRedirects limits the depth of links followed while walking
+	// the dataset, a default limit is used if zero
+	MaxLinkRedirects int
+
+	// WalkPolicy determines how unreadable entries are handled while walking
+	// the dataset, the garbage collection never removes any blob if some
+	// entries were skipped
+	WalkPolicy cinodefs.WalkPolicy
+
+	Log *slog.Logger
+}
+
+type flushResponse struct {
+	Result     string `json:"result"`
+	Entrypoint string `json:"entrypoint"`
+}
+
+type gcResponse struct {
+	Result       string   `json:"result"`
+	DryRun       bool     `json:"dry-run"`
+	Reachable    int      `json:"reachable"`
+	Orphans      []string `json:"orphans"`
+	OrphansBytes int64    `json:"orphans-bytes"`
+	Deleted      int      `json:"deleted"`
+}
+
+type statsResponse struct {
+	Result     string              `json:"result"`
+	Entrypoint string              `json:"entrypoint"`
+	Reachable  int                 `json:"reachable"`
+	Cache      cinodefs.CacheStats `json:"cache"`
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	log := h.log().With(
+		slog.String("RemoteAddr", r.RemoteAddr),
+		slog.String("URL", r.URL.String()),
+		slog.String("Method", r.Method),
+	)
+
+	if !h.authorized(r) {
+		log.Warn("Unauthorized admin request")
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	type endpoint struct {
+		method string
+		serve  func(w http.ResponseWriter, r *http.Request, log *slog.Logger)
+	}
+
+	var ep endpoint
+	switch r.URL.Path {
+	case FlushPath:
+		ep = endpoint{http.MethodPost, h.serveFlush}
+	case GCPath:
+		ep = endpoint{http.MethodPost, h.serveGC}
+	case StatsPath:
+		ep = endpoint{http.MethodGet, h.serveStats}
+	default:
+		log.Warn("Not found")
+		http.NotFound(w, r)
+		return
+	}
+
+	if r.Method != ep.method {
+		log.Error("Method not allowed")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	ep.serve(w, r, log)
+}
+
+func (h *Handler) log() *slog.Logger {
+	if h.Log == nil {
+		return slog.Default()
+	}
+	return h.Log
+}
+
+func (h *Handler) authorized(r *http.Request) bool {
+	if h.Token == "" {
+		return false
+	}
+
+	token, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !found {
+		return false
+	}
+
+	return subtle.ConstantTimeCompare([]byte(token), []byte(h.Token)) == 1
+}
+
+func (h *Handler) serveFlush(w http.ResponseWriter, r *http.Request, log *slog.Logger) {
+	err := h.FS.Flush(r.Context())
+	if h.handleHttpError(err, w, log, "Error flushing filesystem") {
+		return
+	}
+
+	ep, err := h.FS.RootEntrypoint()
+	if h.handleHttpError(err, w, log, "Error getting root entrypoint") {
+		return
+	}
+
+	log.Info("Filesystem flushed")
+	h.sendJSON(w, &flushResponse{
+		Result:     "OK",
+		Entrypoint: ep.String(),
+	})
+}
+
+func (h *Handler) serveGC(w http.ResponseWriter, r *http.Request, log *slog.Logger) {
+	dryRun := false
+	if v := r.URL.Query().Get("dry-run"); v != "" {
+		var err error
+		dryRun, err = strconv.ParseBool(v)
+		if err != nil {
+			log.Warn("Invalid dry-run parameter", "err", err)
+			http.Error(w, "Invalid dry-run parameter", http.StatusBadRequest)
+			return
+		}
+	}
+
+	cache, err := cinodefs.GetCacheStats(h.FS)
+	if h.handleHttpError(err, w, log, "Error getting cache stats") {
+		return
+	}
+	if cache.DirtyNodes > 0 {
+		log.Warn("Unsaved changes, refusing to collect garbage")
+		http.Error(w, "Filesystem has unsaved changes, flush first", http.StatusConflict)
+		return
+	}
+
+	reachable, err := h.reachableBlobs(r.Context())
+	if h.handleHttpError(err, w, log, "Error finding reachable blobs") {
+		return
+	}
+
+	orphans, size, err := datastore.FindBlobsNotIn(r.Context(), h.DS, reachable)
+	if h.handleHttpError(err, w, log, "Error finding orphaned blobs") {
+		return
+	}
+
+	resp := gcResponse{
+		Result:       "OK",
+		DryRun:       dryRun,
+		Reachable:    len(reachable),
+		Orphans:      make([]string, 0, len(orphans)),
+		OrphansBytes: size,
+	}
+	for _, bn := range orphans {
+		resp.Orphans = append(resp.Orphans, bn.String())
+	}
+
+	if !dryRun {
+		for _, bn := range orphans {
+			err := h.DS.Delete(r.Context(), bn)
+			if errors.Is(err, datastore.ErrNotFound) {
+				// Removed in the meantime
+				continue
+			}
+			if h.handleHttpError(err, w, log, "Error deleting orphaned blob") {
+				return
+			}
+			resp.Deleted++
+		}
+	}
+
+	log.Info("Garbage collection finished",
+		"dryRun", dryRun,
+		"orphans", len(orphans),
+		"deleted", resp.Deleted,
+	)
+	h.sendJSON(w, &resp)
+}
+
+func (h *Handler) serveStats(w http.ResponseWriter, r *http.Request, log *slog.Logger) {
+	ep, err := h.FS.RootEntrypoint()
+	if h.handleHttpError(err, w, log, "Error getting root entrypoint") {
+		return
+	}
+
+	reachable, err := h.reachableBlobs(r.Context())
+	if h.handleHttpError(err, w, log, "Error finding reachable blobs") {
+		return
+	}
+
+	cache, err := cinodefs.GetCacheStats(h.FS)
+	if h.handleHttpError(err, w, log, "Error getting cache stats") {
+		return
+	}
+
+	h.sendJSON(w, &statsResponse{
+		Result:     "OK",
+		Entrypoint: ep.String(),
+		Reachable:  len(reachable),
+		Cache:      cache,
+	})
+}
+
+// reachableBlobs lists blobs reachable from the current root, unsaved
+// changes are not taken into account
+func (h *Handler) reachableBlobs(ctx context.Context) ([]*common.BlobName, error) {
+	ep, err := h.FS.RootEntrypoint()
+	if err != nil {
+		return nil, err
+	}
+
+	maxLinkRedirects := h.MaxLinkRedirects
+	if maxLinkRedirects == 0 {
+		maxLinkRedirects = defaultMaxLinkRedirects
+	}
+
+	return cinodefs.ReachableBlobs(ctx, h.BE, ep, maxLinkRedirects, h.WalkPolicy)
+}
+
+func (h *Handler) sendJSON(w http.ResponseWriter, resp any) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+func (h *Handler) handleHttpError(err error, w http.ResponseWriter, log *slog.Logger, logMsg string) bool {
+	if err != nil {
+		log.Error(logMsg, "err", err)
+		http.Error(w,
+			fmt.Sprintf("%s: %v", http.StatusText(http.StatusInternalServerError), err),
+			http.StatusInternalServerError,
+		)
+		return true
+	}
+	return false
+}
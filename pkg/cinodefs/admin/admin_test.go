@@ -0,0 +1,272 @@
+/*
+Copyright © 2023 Bartłomiej Święcki (byo)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/cinode/go/pkg/blenc"
+	"github.com/cinode/go/pkg/cinodefs"
+	"github.com/cinode/go/pkg/datastore"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/exp/slog"
+)
+
+const testToken = "secret-token"
+
+type adminTestEnv struct {
+	ds      datastore.DS
+	fs      cinodefs.FS
+	handler *Handler
+	server  *httptest.Server
+}
+
+func newAdminTestEnv(t *testing.T) *adminTestEnv {
+	ctx := context.Background()
+	ds := datastore.InMemory()
+	be := blenc.FromDatastore(ds)
+	fs, err := cinodefs.New(ctx, be, cinodefs.NewRootDynamicLink())
+	require.NoError(t, err)
+
+	handler := &Handler{
+		FS:    fs,
+		BE:    be,
+		DS:    ds,
+		Token: testToken,
+		Log:   slog.New(slog.NewTextHandler(io.Discard, nil)),
+	}
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	return &adminTestEnv{ds: ds, fs: fs, handler: handler, server: server}
+}
+
+func (e *adminTestEnv) request(t *testing.T, method, path, token string, resp any) int {
+	req, err := http.NewRequest(method, e.server.URL+path, nil)
+	require.NoError(t, err)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	r, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer r.Body.Close()
+
+	if r.StatusCode == http.StatusOK && resp != nil {
+		require.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		require.NoError(t, json.NewDecoder(r.Body).Decode(resp))
+	}
+	return r.StatusCode
+}
+
+func (e *adminTestEnv) setEntry(t *testing.T, data string, path ...string) {
+	_, err := e.fs.SetEntryFile(context.Background(), path, strings.NewReader(data))
+	require.NoError(t, err)
+}
+
+func TestAdminAuthorization(t *testing.T) {
+	e := newAdminTestEnv(t)
+
+	for _, d := range []struct {
+		method string
+		path   string
+	}{
+		{http.MethodPost, FlushPath},
+		{http.MethodPost, GCPath},
+		{http.MethodGet, StatsPath},
+		{http.MethodGet, "/unknown"},
+	} {
+		t.Run(d.path, func(t *testing.T) {
+			code := e.request(t, d.method, d.path, "", nil)
+			require.Equal(t, http.StatusUnauthorized, code)
+
+			code = e.request(t, d.method, d.path, "invalid-token", nil)
+			require.Equal(t, http.StatusUnauthorized, code)
+		})
+	}
+
+	t.Run("empty token rejects all requests", func(t *testing.T) {
+		e.handler.Token = ""
+		defer func() { e.handler.Token = testToken }()
+
+		code := e.request(t, http.MethodGet, StatsPath, "", nil)
+		require.Equal(t, http.StatusUnauthorized, code)
+
+		req, err := http.NewRequest(http.MethodGet, e.server.URL+StatsPath, nil)
+		require.NoError(t, err)
+		req.Header.Set("Authorization", "Bearer ")
+		r, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		r.Body.Close()
+		require.Equal(t, http.StatusUnauthorized, r.StatusCode)
+	})
+
+	t.Run("unknown endpoint", func(t *testing.T) {
+		code := e.request(t, http.MethodGet, "/unknown", testToken, nil)
+		require.Equal(t, http.StatusNotFound, code)
+	})
+
+	t.Run("invalid method", func(t *testing.T) {
+		code := e.request(t, http.MethodGet, FlushPath, testToken, nil)
+		require.Equal(t, http.StatusMethodNotAllowed, code)
+
+		code = e.request(t, http.MethodPost, StatsPath, testToken, nil)
+		require.Equal(t, http.StatusMethodNotAllowed, code)
+	})
+}
+
+func TestAdminFlush(t *testing.T) {
+	e := newAdminTestEnv(t)
+	e.setEntry(t, "hello", "file.txt")
+
+	resp := flushResponse{}
+	code := e.request(t, http.MethodPost, FlushPath, testToken, &resp)
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, "OK", resp.Result)
+
+	ep, err := e.fs.RootEntrypoint()
+	require.NoError(t, err)
+	require.Equal(t, ep.String(), resp.Entrypoint)
+
+	stats, err := cinodefs.GetCacheStats(e.fs)
+	require.NoError(t, err)
+	require.Zero(t, stats.DirtyNodes)
+}
+
+func TestAdminStats(t *testing.T) {
+	e := newAdminTestEnv(t)
+	e.setEntry(t, "hello", "dir", "file.txt")
+	require.NoError(t, e.fs.Flush(context.Background()))
+
+	resp := statsResponse{}
+	code := e.request(t, http.MethodGet, StatsPath, testToken, &resp)
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, "OK", resp.Result)
+
+	ep, err := e.fs.RootEntrypoint()
+	require.NoError(t, err)
+	require.Equal(t, ep.String(), resp.Entrypoint)
+
+	// Root link, root directory, sub-directory and the file
+	require.Equal(t, 4, resp.Reachable)
+	require.Equal(t, 1, resp.Cache.WriterInfos)
+	require.Zero(t, resp.Cache.DirtyNodes)
+
+	t.Run("unsaved changes", func(t *testing.T) {
+		e.setEntry(t, "world", "dir", "file2.txt")
+		defer func() { require.NoError(t, e.fs.Flush(context.Background())) }()
+
+		resp := statsResponse{}
+		code := e.request(t, http.MethodGet, StatsPath, testToken, &resp)
+		require.Equal(t, http.StatusOK, code)
+		require.Positive(t, resp.Cache.DirtyNodes)
+
+		code = e.request(t, http.MethodPost, GCPath, testToken, nil)
+		require.Equal(t, http.StatusConflict, code)
+	})
+}
+
+func TestAdminGC(t *testing.T) {
+	ctx := context.Background()
+	e := newAdminTestEnv(t)
+	e.setEntry(t, "hello", "file.txt")
+	require.NoError(t, e.fs.Flush(ctx))
+
+	oldEP, err := e.fs.FindEntry(ctx, []string{"file.txt"})
+	require.NoError(t, err)
+
+	e.setEntry(t, "updated", "file.txt")
+	require.NoError(t, e.fs.Flush(ctx))
+
+	t.Run("dry run", func(t *testing.T) {
+		resp := gcResponse{}
+		code := e.request(t, http.MethodPost, GCPath+"?dry-run=true", testToken, &resp)
+		require.Equal(t, http.StatusOK, code)
+		require.True(t, resp.DryRun)
+		require.Equal(t, 3, resp.Reachable)
+		require.Contains(t, resp.Orphans, oldEP.BlobName().String())
+		require.Positive(t, resp.OrphansBytes)
+		require.Zero(t, resp.Deleted)
+
+		raw := map[string]any{}
+		code = e.request(t, http.MethodPost, GCPath+"?dry-run=true", testToken, &raw)
+		require.Equal(t, http.StatusOK, code)
+		require.Equal(t, true, raw["dry-run"])
+		require.Contains(t, raw, "orphans-bytes")
+
+		exists, err := e.ds.Exists(ctx, oldEP.BlobName())
+		require.NoError(t, err)
+		require.True(t, exists)
+	})
+
+	t.Run("invalid dry run parameter", func(t *testing.T) {
+		code := e.request(t, http.MethodPost, GCPath+"?dry-run=maybe", testToken, nil)
+		require.Equal(t, http.StatusBadRequest, code)
+	})
+
+	t.Run("collect garbage", func(t *testing.T) {
+		resp := gcResponse{}
+		code := e.request(t, http.MethodPost, GCPath, testToken, &resp)
+		require.Equal(t, http.StatusOK, code)
+		require.False(t, resp.DryRun)
+		require.Len(t, resp.Orphans, resp.Deleted)
+		require.Contains(t, resp.Orphans, oldEP.BlobName().String())
+
+		exists, err := e.ds.Exists(ctx, oldEP.BlobName())
+		require.NoError(t, err)
+		require.False(t, exists)
+
+		data, err := e.fs.OpenEntryData(ctx, []string{"file.txt"})
+		require.NoError(t, err)
+		require.NoError(t, data.Close())
+
+		resp = gcResponse{}
+		code = e.request(t, http.MethodPost, GCPath, testToken, &resp)
+		require.Equal(t, http.StatusOK, code)
+		require.Empty(t, resp.Orphans)
+		require.Zero(t, resp.Deleted)
+	})
+
+	t.Run("skipped entries", func(t *testing.T) {
+		e.handler.WalkPolicy = cinodefs.SkipAndReport()
+		defer func() { e.handler.WalkPolicy = cinodefs.FailFast() }()
+
+		e.setEntry(t, "nested", "dir", "nested.txt")
+		require.NoError(t, e.fs.Flush(ctx))
+
+		dirEP, err := e.fs.FindEntry(ctx, []string{"dir"})
+		require.NoError(t, err)
+		fileEP, err := e.fs.FindEntry(ctx, []string{"dir", "nested.txt"})
+		require.NoError(t, err)
+		require.NoError(t, e.ds.Delete(ctx, dirEP.BlobName()))
+
+		// Blobs behind the unreadable directory look like orphans,
+		// those must not be removed
+		code := e.request(t, http.MethodPost, GCPath, testToken, nil)
+		require.Equal(t, http.StatusInternalServerError, code)
+
+		exists, err := e.ds.Exists(ctx, fileEP.BlobName())
+		require.NoError(t, err)
+		require.True(t, exists)
+	})
+}
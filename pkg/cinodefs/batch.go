@@ -0,0 +1,200 @@
+/*
+Copyright © 2023 Bartłomiej Święcki (byo)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cinodefs
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+)
+
+var (
+	ErrBatchFinished = errors.New("batch already finished")
+)
+
+// BatchFS gives access to modifications done within a single batch,
+// see FS.Batch
+type BatchFS interface {
+	SetEntryFile(
+		ctx context.Context,
+		path []string,
+		data io.Reader,
+		opts ...EntrypointOption,
+	) (*Entrypoint, error)
+
+	SetEntry(
+		ctx context.Context,
+		path []string,
+		ep *Entrypoint,
+	) error
+
+	DeleteEntry(
+		ctx context.Context,
+		path []string,
+	) error
+}
+
+// Batch runs given function applying multiple modifications at once. Changed
+// directories are saved only once, when the function returns without an
+// error, instead of rewriting them after each change. If the function fails,
+// none of the modifications done within the batch are applied and the error
+// is returned.
+//
+// Data of files is stored while the function runs, changes to directories are
+// recorded and applied together once the function returns. Errors of those
+// changes, such as a missing entry to delete, are thus returned from Batch.
+// Unsaved changes done before the batch are saved when the batch starts.
+//
+// The batch is applied atomically - if any change or saving the batch fails,
+// the filesystem is left in the state from before the batch, blobs written
+// before the failure may still remain in the datastore.
+func (fs *cinodeFS) Batch(ctx context.Context, f func(b BatchFS) error) error {
+	err := fs.withLock(ctx, fs.flushDirtyLocked)
+	if err != nil {
+		return err
+	}
+
+	b := &batchFS{fs: fs}
+	err = func() error {
+		defer b.finish()
+		return f(b)
+	}()
+	if err != nil {
+		return err
+	}
+
+	return fs.withLock(ctx, b.apply)
+}
+
+// batchFS records modifications done within a batch
+type batchFS struct {
+	fs *cinodeFS
+
+	lock     sync.Mutex
+	changes  []func(ctx context.Context) error
+	finished bool
+}
+
+func (b *batchFS) finish() {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.finished = true
+}
+
+func (b *batchFS) record(change func(ctx context.Context) error) error {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if b.finished {
+		return ErrBatchFinished
+	}
+	b.changes = append(b.changes, change)
+	return nil
+}
+
+// apply does all recorded changes and saves them, must be called from
+// a function run through withLock
+func (b *batchFS) apply(ctx context.Context) error {
+	fs := b.fs
+
+	err := fs.flushDirtyLocked(ctx)
+	if err != nil {
+		return err
+	}
+
+	startEP, err := fs.rootEP.entrypoint()
+	if err != nil {
+		return err
+	}
+
+	err = func() error {
+		for _, change := range b.changes {
+			err := change(ctx)
+			if err != nil {
+				return err
+			}
+		}
+		return fs.flushLocked(ctx)
+	}()
+	if err != nil {
+		// Nodes are modified in place, the whole in-memory tree is dropped
+		// and will be loaded again from the datastore. This also happens
+		// when the batch waits for blob data, the restarted attempt applies
+		// all changes again.
+		fs.rootEP = &nodeUnloaded{ep: startEP}
+		return err
+	}
+
+	return nil
+}
+
+func (b *batchFS) SetEntryFile(
+	ctx context.Context,
+	path []string,
+	data io.Reader,
+	opts ...EntrypointOption,
+) (*Entrypoint, error) {
+	if b.isFinished() {
+		return nil, ErrBatchFinished
+	}
+
+	path, ep, err := b.fs.createFileEntrypointForPath(ctx, path, data, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	err = b.SetEntry(ctx, path, ep)
+	if err != nil {
+		return nil, err
+	}
+
+	return ep, nil
+}
+
+func (b *batchFS) SetEntry(ctx context.Context, path []string, ep *Entrypoint) error {
+	// The change is applied later, the caller may reuse the path slice in
+	// the meantime, validatePath always returns a copy
+	path, err := validatePath(path)
+	if err != nil {
+		return err
+	}
+
+	return b.record(func(ctx context.Context) error {
+		return b.fs.setEntryLocked(ctx, path, ep)
+	})
+}
+
+func (b *batchFS) DeleteEntry(ctx context.Context, path []string) error {
+	if len(path) == 0 {
+		return ErrCantDeleteRoot
+	}
+	path, err := validatePath(path)
+	if err != nil {
+		return err
+	}
+
+	return b.record(func(ctx context.Context) error {
+		return b.fs.deleteEntryLocked(ctx, path)
+	})
+}
+
+func (b *batchFS) isFinished() bool {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.finished
+}
@@ -0,0 +1,243 @@
+/*
+Copyright © 2023 Bartłomiej Święcki (byo)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cinodefs_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/cinode/go/pkg/blenc"
+	"github.com/cinode/go/pkg/cinodefs"
+	"github.com/cinode/go/pkg/common"
+	"github.com/cinode/go/pkg/datastore"
+	"github.com/stretchr/testify/require"
+)
+
+type createCountingBE struct {
+	blenc.BE
+	creates atomic.Int64
+}
+
+func (c *createCountingBE) Create(
+	ctx context.Context,
+	blobType common.BlobType,
+	r io.Reader,
+) (*common.BlobName, *common.BlobKey, *common.AuthInfo, error) {
+	c.creates.Add(1)
+	return c.BE.Create(ctx, blobType, r)
+}
+
+func TestBatch(t *testing.T) {
+	ctx := context.Background()
+
+	newFS := func(t *testing.T) (cinodefs.FS, *createCountingBE) {
+		be := &createCountingBE{BE: blenc.FromDatastore(datastore.InMemory())}
+		fs, err := cinodefs.New(ctx, be, cinodefs.NewRootStaticDirectory())
+		require.NoError(t, err)
+
+		_, err = fs.SetEntryFile(ctx, []string{"existing.txt"}, strings.NewReader("existing"))
+		require.NoError(t, err)
+		require.NoError(t, fs.Flush(ctx))
+
+		be.creates.Store(0)
+		return fs, be
+	}
+
+	t.Run("changes are saved once", func(t *testing.T) {
+		fs, be := newFS(t)
+		rootBefore, err := fs.RootEntrypoint()
+		require.NoError(t, err)
+
+		var batchEP *cinodefs.Entrypoint
+		err = fs.Batch(ctx, func(b cinodefs.BatchFS) error {
+			_, err := b.SetEntryFile(ctx, []string{"a", "1.txt"}, strings.NewReader("1"))
+			require.NoError(t, err)
+			_, err = b.SetEntryFile(ctx, []string{"a", "2.txt"}, strings.NewReader("2"))
+			require.NoError(t, err)
+			batchEP, err = b.SetEntryFile(ctx, []string{"b", "3.txt"}, strings.NewReader("3"))
+			require.NoError(t, err)
+			require.NoError(t, b.SetEntry(ctx, []string{"b", "copy.txt"}, batchEP))
+			require.NoError(t, b.DeleteEntry(ctx, []string{"existing.txt"}))
+			return nil
+		})
+		require.NoError(t, err)
+
+		// 3 files and 3 directories: root, a and b
+		require.EqualValues(t, 6, be.creates.Load())
+
+		rootAfter, err := fs.RootEntrypoint()
+		require.NoError(t, err)
+		require.NotEqual(t, rootBefore.String(), rootAfter.String())
+
+		require.Equal(t, "1", readFile(t, fs, []string{"a", "1.txt"}))
+		require.Equal(t, "2", readFile(t, fs, []string{"a", "2.txt"}))
+		require.Equal(t, "3", readFile(t, fs, []string{"b", "copy.txt"}))
+		_, err = fs.FindEntry(ctx, []string{"existing.txt"})
+		require.ErrorIs(t, err, cinodefs.ErrEntryNotFound)
+
+		// Changes are persisted
+		fs2, err := cinodefs.New(ctx, be, cinodefs.RootEntrypoint(rootAfter))
+		require.NoError(t, err)
+		require.Equal(t, "3", readFile(t, fs2, []string{"b", "3.txt"}))
+	})
+
+	t.Run("failed batch is rolled back", func(t *testing.T) {
+		fs, _ := newFS(t)
+
+		// Pending change done before the batch is kept
+		_, err := fs.SetEntryFile(ctx, []string{"pending.txt"}, strings.NewReader("pending"))
+		require.NoError(t, err)
+
+		injectedErr := errors.New("batch error")
+		err = fs.Batch(ctx, func(b cinodefs.BatchFS) error {
+			_, err := b.SetEntryFile(ctx, []string{"new.txt"}, strings.NewReader("new"))
+			require.NoError(t, err)
+			require.NoError(t, b.DeleteEntry(ctx, []string{"existing.txt"}))
+			return injectedErr
+		})
+		require.ErrorIs(t, err, injectedErr)
+
+		rootEP, err := fs.RootEntrypoint()
+		require.NoError(t, err)
+
+		require.Equal(t, "existing", readFile(t, fs, []string{"existing.txt"}))
+		require.Equal(t, "pending", readFile(t, fs, []string{"pending.txt"}))
+		_, err = fs.FindEntry(ctx, []string{"new.txt"})
+		require.ErrorIs(t, err, cinodefs.ErrEntryNotFound)
+
+		rootAfterRead, err := fs.RootEntrypoint()
+		require.NoError(t, err)
+		require.Equal(t, rootEP.String(), rootAfterRead.String())
+	})
+
+	t.Run("path slice reused by the caller", func(t *testing.T) {
+		fs, _ := newFS(t)
+		fileEP, err := fs.FindEntry(ctx, []string{"existing.txt"})
+		require.NoError(t, err)
+
+		err = fs.Batch(ctx, func(b cinodefs.BatchFS) error {
+			p := []string{""}
+			for _, name := range []string{"a", "b", "c"} {
+				p[0] = name
+				require.NoError(t, b.SetEntry(ctx, p, fileEP))
+			}
+			p[0] = "existing.txt"
+			require.NoError(t, b.DeleteEntry(ctx, p))
+			p[0] = "a"
+			return nil
+		})
+		require.NoError(t, err)
+
+		for _, name := range []string{"a", "b", "c"} {
+			require.Equal(t, "existing", readFile(t, fs, []string{name}))
+		}
+		_, err = fs.FindEntry(ctx, []string{"existing.txt"})
+		require.ErrorIs(t, err, cinodefs.ErrEntryNotFound)
+	})
+
+	t.Run("batch operation error", func(t *testing.T) {
+		fs, _ := newFS(t)
+
+		err := fs.Batch(ctx, func(b cinodefs.BatchFS) error {
+			_, err := b.SetEntryFile(ctx, []string{"new.txt"}, strings.NewReader("new"))
+			require.NoError(t, err)
+			return b.DeleteEntry(ctx, []string{"missing.txt"})
+		})
+		require.ErrorIs(t, err, cinodefs.ErrEntryNotFound)
+
+		_, err = fs.FindEntry(ctx, []string{"new.txt"})
+		require.ErrorIs(t, err, cinodefs.ErrEntryNotFound)
+
+		err = fs.Batch(ctx, func(b cinodefs.BatchFS) error {
+			return b.SetEntry(ctx, []string{"dir", "", "file"}, nil)
+		})
+		require.ErrorIs(t, err, cinodefs.ErrEmptyName)
+	})
+
+	t.Run("panic in batch", func(t *testing.T) {
+		fs, _ := newFS(t)
+
+		require.Panics(t, func() {
+			fs.Batch(ctx, func(b cinodefs.BatchFS) error {
+				_, err := b.SetEntryFile(ctx, []string{"new.txt"}, strings.NewReader("new"))
+				require.NoError(t, err)
+				panic("batch panic")
+			})
+		})
+
+		// Filesystem is unlocked and rolled back
+		_, err := fs.FindEntry(ctx, []string{"new.txt"})
+		require.ErrorIs(t, err, cinodefs.ErrEntryNotFound)
+		require.Equal(t, "existing", readFile(t, fs, []string{"existing.txt"}))
+	})
+
+	t.Run("filesystem is not locked during the batch", func(t *testing.T) {
+		fs, _ := newFS(t)
+
+		err := fs.Batch(ctx, func(b cinodefs.BatchFS) error {
+			_, err := b.SetEntryFile(ctx, []string{"new.txt"}, strings.NewReader("new"))
+			require.NoError(t, err)
+
+			// Recorded changes are not visible until the batch is applied
+			require.Equal(t, "existing", readFile(t, fs, []string{"existing.txt"}))
+			_, err = fs.FindEntry(ctx, []string{"new.txt"})
+			require.ErrorIs(t, err, cinodefs.ErrEntryNotFound)
+			return nil
+		})
+		require.NoError(t, err)
+		require.Equal(t, "new", readFile(t, fs, []string{"new.txt"}))
+	})
+
+	t.Run("use after the batch", func(t *testing.T) {
+		fs, _ := newFS(t)
+
+		var batch cinodefs.BatchFS
+		err := fs.Batch(ctx, func(b cinodefs.BatchFS) error {
+			batch = b
+			return nil
+		})
+		require.NoError(t, err)
+
+		_, err = batch.SetEntryFile(ctx, []string{"new.txt"}, strings.NewReader("new"))
+		require.ErrorIs(t, err, cinodefs.ErrBatchFinished)
+		err = batch.SetEntry(ctx, []string{"new.txt"}, nil)
+		require.ErrorIs(t, err, cinodefs.ErrBatchFinished)
+		err = batch.DeleteEntry(ctx, []string{"existing.txt"})
+		require.ErrorIs(t, err, cinodefs.ErrBatchFinished)
+	})
+
+	t.Run("read-only filesystem", func(t *testing.T) {
+		ds := datastore.InMemory()
+		writer := prepareLinkedDataset(t, ds, []string{"dir", "file.txt"})
+		rootEP, err := writer.RootEntrypoint()
+		require.NoError(t, err)
+
+		fs, err := cinodefs.New(ctx, blenc.FromDatastore(ds), cinodefs.RootEntrypoint(rootEP))
+		require.NoError(t, err)
+
+		err = fs.Batch(ctx, func(b cinodefs.BatchFS) error {
+			_, err := b.SetEntryFile(ctx, []string{"new.txt"}, strings.NewReader("new"))
+			return err
+		})
+		require.ErrorIs(t, err, cinodefs.ErrMissingWriterInfo)
+		require.Equal(t, "initial content", readFile(t, fs, []string{"dir", "file.txt"}))
+	})
+}
@@ -0,0 +1,126 @@
+/*
+Copyright © 2022 Bartłomiej Święcki (byo)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cinodefs_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/cinode/go/pkg/blenc"
+	"github.com/cinode/go/pkg/cinodefs"
+	"github.com/cinode/go/pkg/datastore"
+	"github.com/cinode/go/pkg/utilities/benchmark"
+)
+
+// newBenchmarkFS creates a filesystem with deterministic time
+// and random source
+func newBenchmarkFS(b *testing.B, opts ...cinodefs.Option) cinodefs.FS {
+	fs, err := cinodefs.New(context.Background(),
+		blenc.FromDatastore(datastore.InMemory()),
+		append([]cinodefs.Option{
+			cinodefs.TimeFunc(func() time.Time { return time.Unix(0, 0) }),
+			cinodefs.RandSource(benchmark.RandSource(0)),
+		}, opts...)...,
+	)
+	if err != nil {
+		b.Fatal(err)
+	}
+	return fs
+}
+
+func BenchmarkDirectoryFlush(b *testing.B) {
+	ctx := context.Background()
+
+	for _, entries := range []int{10, 100, 1000} {
+		b.Run(fmt.Sprintf("entries=%d", entries), func(b *testing.B) {
+			fs := newBenchmarkFS(b, cinodefs.NewRootStaticDirectory())
+
+			for i := 0; i < entries; i++ {
+				_, err := fs.SetEntryFile(ctx,
+					[]string{fmt.Sprintf("file-%04d.txt", i)},
+					bytes.NewReader(benchmark.Data(uint64(i), 64)),
+				)
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+			if err := fs.Flush(ctx); err != nil {
+				b.Fatal(err)
+			}
+
+			ep, err := fs.FindEntry(ctx, []string{"file-0000.txt"})
+			if err != nil {
+				b.Fatal(err)
+			}
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				// Setting an entry marks the directory as modified,
+				// flush must store the whole directory blob again
+				err := fs.SetEntry(ctx, []string{"file-0000.txt"}, ep)
+				if err != nil {
+					b.Fatal(err)
+				}
+				err = fs.Flush(ctx)
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkPathResolutionThroughLinks(b *testing.B) {
+	ctx := context.Background()
+
+	for _, links := range []int{0, 1, 4, 8} {
+		b.Run(fmt.Sprintf("links=%d", links), func(b *testing.B) {
+			fs := newBenchmarkFS(b, cinodefs.NewRootStaticDirectory())
+
+			path := []string{}
+			for i := 0; i < links; i++ {
+				path = append(path, fmt.Sprintf("dir-%d", i))
+			}
+			path = append(path, "file.txt")
+
+			_, err := fs.SetEntryFile(ctx, path, bytes.NewReader(benchmark.Data(0, 64)))
+			if err != nil {
+				b.Fatal(err)
+			}
+			for i := 1; i <= links; i++ {
+				_, err := fs.InjectDynamicLink(ctx, path[:i])
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+			if err := fs.Flush(ctx); err != nil {
+				b.Fatal(err)
+			}
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				_, err := fs.FindEntry(ctx, path)
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
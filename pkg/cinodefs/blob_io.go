@@ -0,0 +1,162 @@
+/*
+Copyright © 2023 Bartłomiej Święcki (byo)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cinodefs
+
+import (
+	"context"
+	"errors"
+
+	"github.com/cinode/go/pkg/common"
+)
+
+// errBlobIOPending is returned from graph operations that need to access
+// the datastore while the filesystem lock is held. Such operation is aborted
+// without changing the tree and restarted once the requested blob
+// operations are done.
+var errBlobIOPending = errors.New("blob operation pending")
+
+type blobIOResult struct {
+	data []byte
+	ep   *Entrypoint
+	ai   *common.AuthInfo
+	err  error
+}
+
+// blobIO defers datastore access of a single filesystem operation until the
+// filesystem lock is released. Requested blob operations are queued, once
+// executed, their results are returned to the restarted operation.
+type blobIO struct {
+	results  map[string]blobIOResult
+	pending  map[string]func() blobIOResult
+	reported map[string]struct{}
+
+	// tracing spans of steps continued by restarted attempts
+	spans map[string]stepSpan
+
+	// number of times each step was started by the current attempt
+	stepCounts map[string]int
+
+	// limit of link redirects taken when the operation started, the limit
+	// can be changed while the operation is running
+	maxLinkRedirects int
+}
+
+type blobIOContextKey struct{}
+
+func contextWithBlobIO(ctx context.Context, bio *blobIO) context.Context {
+	return context.WithValue(ctx, blobIOContextKey{}, bio)
+}
+
+func blobIOFromContext(ctx context.Context) *blobIO {
+	bio, _ := ctx.Value(blobIOContextKey{}).(*blobIO)
+	return bio
+}
+
+// do returns the result of a blob operation identified by given key. If there
+// is no deferred blob IO in the context, the operation is executed directly.
+// Deferred operation gets the context of the request without the blob IO
+// thus it is traced as part of the step that requested it.
+func (b *blobIO) do(
+	ctx context.Context,
+	key string,
+	op func(ctx context.Context) blobIOResult,
+) (blobIOResult, error) {
+	if b == nil {
+		return op(ctx), nil
+	}
+	if res, found := b.results[key]; found {
+		return res, nil
+	}
+	b.pending[key] = func() blobIOResult {
+		return op(contextWithBlobIO(ctx, nil))
+	}
+	return blobIOResult{}, errBlobIOPending
+}
+
+// firstReport returns true only for the first call with given key, it avoids
+// repeating reports such as logs when the operation is restarted
+func (b *blobIO) firstReport(key string) bool {
+	if b == nil {
+		return true
+	}
+	if _, found := b.reported[key]; found {
+		return false
+	}
+	b.reported[key] = struct{}{}
+	return true
+}
+
+func (b *blobIO) run() {
+	for key, op := range b.pending {
+		b.results[key] = op()
+		delete(b.pending, key)
+	}
+}
+
+// withLock executes given function with the filesystem lock held.
+//
+// The lock only protects the in-memory node tree, datastore is never accessed
+// while the lock is held. Once the function needs blob data that is not yet
+// known, it fails with errBlobIOPending, the lock is released, pending blob
+// operations are executed and the function is restarted. Such function must
+// not modify the tree before all its blob operations succeed.
+//
+// The function is thus run any number of times and must follow the re-run
+// contract:
+//   - every attempt starts from scratch, values computed by a failed attempt
+//     (including variables captured by the closure) must be reset or
+//     recomputed, not accumulated,
+//   - side effects outside of the tree (e.g. calling user callbacks or
+//     sending data to channels) must only happen once the function can no
+//     longer fail with errBlobIOPending,
+//   - the tree may be modified by other operations between attempts, nodes
+//     found by a previous attempt must not be reused,
+//   - results of blob operations are kept between attempts of the same
+//     withLock call, a blob is not read twice within one call.
+func (fs *cinodeFS) withLock(ctx context.Context, f func(ctx context.Context) error) error {
+	bio := &blobIO{
+		results:  map[string]blobIOResult{},
+		pending:  map[string]func() blobIOResult{},
+		reported: map[string]struct{}{},
+		spans:    map[string]stepSpan{},
+
+		stepCounts: map[string]int{},
+
+		maxLinkRedirects: int(fs.maxLinkRedirects.Load()),
+	}
+	ctx = contextWithBlobIO(ctx, bio)
+
+	for {
+		clear(bio.stepCounts)
+
+		fs.lock.Lock()
+		err := f(ctx)
+		fs.lock.Unlock()
+
+		if !errors.Is(err, errBlobIOPending) {
+			// Steps not reached again by the last attempt, the tree could
+			// have been changed in the meantime
+			for _, s := range bio.spans {
+				if !s.done {
+					s.span.End()
+				}
+			}
+			return err
+		}
+		bio.run()
+	}
+}
@@ -0,0 +1,138 @@
+/*
+Copyright © 2022 Bartłomiej Święcki (byo)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cinodefs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/cinode/go/pkg/common"
+)
+
+var (
+	ErrUnsupportedFS = errors.New("unsupported filesystem implementation")
+)
+
+// BlobsForPath returns names of blobs that have to be fetched in order to
+// resolve and read the entry at given path, starting from the root of the
+// filesystem. Those are blobs of directories along the path (including shards
+// covering names from the path), blobs of followed dynamic links and the blob
+// of the entry itself, symbolic links are followed from the root directory.
+// Blobs are returned in the order in which a cold read of the path fetches
+// them.
+//
+// Contrary to ReachableBlobs, only the single path is followed, the result
+// can be used to pre-warm a cache for a frequently accessed entry. Links are
+// followed up to the limit configured in the filesystem. The filesystem must
+// not contain unflushed changes.
+func BlobsForPath(ctx context.Context, fs FS, path []string) ([]*common.BlobName, error) {
+	cfs, ok := fs.(*cinodeFS)
+	if !ok {
+		return nil, fmt.Errorf("%w: %T", ErrUnsupportedFS, fs)
+	}
+
+	path, err := CanonicalPath(path)
+	if err != nil {
+		return nil, err
+	}
+
+	rootEP, err := cfs.RootEntrypoint()
+	if err != nil {
+		return nil, err
+	}
+	ep := rootEP
+
+	// Use a separate graph context, nodes loaded here must not interfere
+	// with the in-memory state of the filesystem
+	gc := graphContext{
+		be:        cfs.c.be,
+		authInfos: map[string]*common.AuthInfo{},
+		log:       cfs.c.log,
+	}
+	maxLinkRedirects := cfs.MaxLinkRedirects()
+
+	ret := []*common.BlobName{}
+	seen := map[string]struct{}{}
+	addBlob := func(bn *common.BlobName) {
+		if _, found := seen[bn.String()]; !found {
+			seen[bn.String()] = struct{}{}
+			ret = append(ret, bn)
+		}
+	}
+	pathPosition, linkDepth, symlinkRedirects := 0, 0, 0
+	for {
+		addBlob(ep.BlobName())
+
+		if ep.IsLink() {
+			if linkDepth >= maxLinkRedirects {
+				return nil, ErrTooManyRedirects
+			}
+			linkDepth++
+		} else if pathPosition == len(path) {
+			return ret, nil
+		} else if !ep.IsDir() {
+			return nil, ErrNotADirectory
+		}
+
+		loaded, err := (&nodeUnloaded{ep: ep}).load(ctx, &gc)
+		if err != nil {
+			return nil, err
+		}
+
+		switch n := loaded.(type) {
+		case *nodeLink:
+			ep, err = n.target.entrypoint()
+			if err != nil {
+				return nil, err
+			}
+
+		case *nodeDirectory:
+			// Only shards of a split directory covering the name are fetched
+			entry, found, err := n.resolveEntry(ctx, &gc, path[pathPosition])
+			if err != nil {
+				return nil, err
+			}
+			for _, shard := range n.shards {
+				addBlob(shard.ep.BlobName())
+			}
+			if !found {
+				return nil, ErrEntryNotFound
+			}
+			if symlink, isSymlink := entry.(*nodeSymlink); isSymlink {
+				// Symbolic links are resolved from the root
+				if symlinkRedirects >= maxLinkRedirects {
+					return nil, ErrTooManyRedirects
+				}
+				symlinkRedirects++
+				path = append(slices.Clone(symlink.target), path[pathPosition+1:]...)
+				pathPosition, linkDepth, ep = 0, 0, rootEP
+				continue
+			}
+			ep, err = entry.entrypoint()
+			if err != nil {
+				return nil, err
+			}
+			pathPosition++
+			linkDepth = 0
+
+		default:
+			return nil, ErrNotADirectory
+		}
+	}
+}
@@ -0,0 +1,167 @@
+/*
+Copyright © 2022 Bartłomiej Święcki (byo)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cinodefs_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/cinode/go/pkg/blenc"
+	"github.com/cinode/go/pkg/cinodefs"
+	"github.com/cinode/go/pkg/datastore"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBlobsForPath(t *testing.T) {
+	ctx := context.Background()
+	be := blenc.FromDatastore(datastore.InMemory())
+
+	fs, err := cinodefs.New(ctx, be, cinodefs.NewRootDynamicLink())
+	require.NoError(t, err)
+
+	for _, path := range []string{
+		"index.html",
+		"dir/other.txt",
+		"dir/linked/file.txt",
+		"dir/linked/sub/deep.txt",
+	} {
+		_, err := fs.SetEntryFile(ctx, strings.Split(path, "/"), strings.NewReader(path))
+		require.NoError(t, err)
+	}
+	_, err = fs.InjectDynamicLink(ctx, []string{"dir", "linked"})
+	require.NoError(t, err)
+	require.NoError(t, fs.Flush(ctx))
+
+	rootEP, err := fs.RootEntrypoint()
+	require.NoError(t, err)
+
+	// Compare with blobs fetched by a cold read of the path
+	coldRead := func(t *testing.T, path []string, read func(fs cinodefs.FS) error) {
+		countingBE := &openCountingBE{BE: be, opened: map[string]int{}}
+		coldFS, err := cinodefs.New(ctx, countingBE, cinodefs.RootEntrypoint(rootEP))
+		require.NoError(t, err)
+
+		blobs, err := cinodefs.BlobsForPath(ctx, coldFS, path)
+		require.NoError(t, err)
+
+		countingBE.opened = map[string]int{}
+		require.NoError(t, read(coldFS))
+
+		names := []string{}
+		for _, bn := range blobs {
+			names = append(names, bn.String())
+		}
+		fetched := []string{}
+		for name := range countingBE.opened {
+			fetched = append(fetched, name)
+		}
+		require.ElementsMatch(t, fetched, names)
+	}
+
+	readFile := func(path []string) func(fs cinodefs.FS) error {
+		return func(fs cinodefs.FS) error {
+			rc, err := fs.OpenEntryData(ctx, path)
+			if err != nil {
+				return err
+			}
+			defer rc.Close()
+			_, err = io.Copy(io.Discard, rc)
+			return err
+		}
+	}
+
+	listDir := func(path []string) func(fs cinodefs.FS) error {
+		return func(fs cinodefs.FS) error {
+			// Stop at the first entry, only the directory itself is read
+			errStop := errors.New("stop")
+			err := fs.Walk(ctx, path, func(cinodefs.WalkEntry) error { return errStop })
+			if errors.Is(err, errStop) {
+				return nil
+			}
+			return err
+		}
+	}
+
+	t.Run("file in the root directory", func(t *testing.T) {
+		path := []string{"index.html"}
+		coldRead(t, path, readFile(path))
+	})
+
+	t.Run("file behind a link", func(t *testing.T) {
+		path := []string{"dir", "linked", "sub", "deep.txt"}
+		coldRead(t, path, readFile(path))
+	})
+
+	t.Run("linked directory", func(t *testing.T) {
+		path := []string{"dir", "linked"}
+		coldRead(t, path, listDir(path))
+	})
+
+	t.Run("root", func(t *testing.T) {
+		coldRead(t, []string{}, listDir([]string{}))
+
+		blobs, err := cinodefs.BlobsForPath(ctx, fs, nil)
+		require.NoError(t, err)
+		require.Len(t, blobs, 2) // root link and root directory
+		require.Equal(t, rootEP.BlobName(), blobs[0])
+	})
+
+	t.Run("invalid paths", func(t *testing.T) {
+		_, err := cinodefs.BlobsForPath(ctx, fs, []string{"missing"})
+		require.ErrorIs(t, err, cinodefs.ErrEntryNotFound)
+
+		_, err = cinodefs.BlobsForPath(ctx, fs, []string{"index.html", "sub"})
+		require.ErrorIs(t, err, cinodefs.ErrNotADirectory)
+
+		_, err = cinodefs.BlobsForPath(ctx, fs, []string{"dir", ""})
+		require.ErrorIs(t, err, cinodefs.ErrEmptyName)
+	})
+
+	t.Run("too many redirects", func(t *testing.T) {
+		fs, err := cinodefs.New(ctx, be,
+			cinodefs.RootEntrypoint(rootEP),
+			cinodefs.MaxLinkRedirects(1),
+		)
+		require.NoError(t, err)
+
+		_, err = cinodefs.BlobsForPath(ctx, fs, []string{"index.html"})
+		require.NoError(t, err)
+
+		_, err = cinodefs.BlobsForPath(ctx, fs, []string{"dir", "linked", "file.txt"})
+		require.NoError(t, err)
+
+		require.NoError(t, fs.SetMaxLinkRedirects(0))
+		_, err = cinodefs.BlobsForPath(ctx, fs, []string{"index.html"})
+		require.ErrorIs(t, err, cinodefs.ErrTooManyRedirects)
+	})
+
+	t.Run("unflushed changes", func(t *testing.T) {
+		fs, err := cinodefs.New(ctx, be, cinodefs.NewRootStaticDirectory())
+		require.NoError(t, err)
+
+		_, err = cinodefs.BlobsForPath(ctx, fs, nil)
+		require.ErrorIs(t, err, cinodefs.ErrModifiedDirectory)
+	})
+
+	t.Run("unsupported filesystem", func(t *testing.T) {
+		_, err := cinodefs.BlobsForPath(ctx, struct{ cinodefs.FS }{fs}, nil)
+		require.ErrorIs(t, err, cinodefs.ErrUnsupportedFS)
+	})
+}
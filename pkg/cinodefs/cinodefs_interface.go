@@ -17,22 +17,28 @@ limitations under the License.
 package cinodefs
 
 import (
+	"bytes"
 	"context"
 	"crypto/rand"
 	"errors"
 	"fmt"
 	"io"
+	"iter"
 	"mime"
 	"net/http"
+	"os"
 	"path/filepath"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/cinode/go/pkg/blenc"
 	"github.com/cinode/go/pkg/blobtypes"
 	"github.com/cinode/go/pkg/common"
 	"github.com/cinode/go/pkg/internal/blobtypes/dynamiclink"
-	"github.com/cinode/go/pkg/internal/utilities/headwriter"
 	"github.com/cinode/go/pkg/utilities/golang"
+	"github.com/cinode/go/pkg/utilities/progress"
+	"golang.org/x/exp/slog"
 )
 
 var (
@@ -53,10 +59,17 @@ var (
 	ErrInvalidDirectoryData      = errors.New("invalid directory data")
 	ErrCantWriteDirectory        = errors.New("can not write directory")
 	ErrMissingRootInfo           = errors.New("root info not specified")
+	ErrInvalidMimeType           = errors.New("invalid mime type")
+	ErrMimeTypeRequired          = errors.New("mime type could not be determined")
+	ErrNegativePrefixLength      = errors.New("prefix length can not be negative")
 )
 
 const (
 	CinodeDirMimeType = "application/cinode-dir"
+
+	// CinodeDirShardMimeType marks entries of a split directory blob
+	// that point to blobs holding a part of directory entries
+	CinodeDirShardMimeType = "application/cinode-dir-shard"
 )
 
 type FS interface {
@@ -67,6 +80,12 @@ type FS interface {
 		opts ...EntrypointOption,
 	) (*Entrypoint, error)
 
+	CreateFileWriter(
+		ctx context.Context,
+		path []string,
+		opts ...EntrypointOption,
+	) (io.WriteCloser, error)
+
 	CreateFileEntrypoint(
 		ctx context.Context,
 		data io.Reader,
@@ -79,25 +98,84 @@ type FS interface {
 		ep *Entrypoint,
 	) error
 
+	SetEntryIfAbsent(
+		ctx context.Context,
+		path []string,
+		ep *Entrypoint,
+	) (bool, error)
+
 	ResetDir(
 		ctx context.Context,
 		path []string,
 	) error
 
+	SetEntryMimeType(
+		ctx context.Context,
+		path []string,
+		mimeType string,
+	) error
+
+	RebuildDirectory(
+		ctx context.Context,
+		path []string,
+		entries map[string]*Entrypoint,
+	) error
+
+	ListDir(
+		ctx context.Context,
+		path []string,
+		opts ...ListOption,
+	) ([]DirEntry, error)
+
+	Walk(
+		ctx context.Context,
+		root []string,
+		fn func(entry WalkEntry) error,
+		opts ...ListOption,
+	) error
+
+	WalkStream(
+		ctx context.Context,
+		root []string,
+		opts ...ListOption,
+	) iter.Seq2[WalkEntry, error]
+
 	Flush(
 		ctx context.Context,
 	) error
 
+	Batch(
+		ctx context.Context,
+		f func(b BatchFS) error,
+	) error
+
 	FindEntry(
 		ctx context.Context,
 		path []string,
 	) (*Entrypoint, error)
 
+	EntryMetadata(
+		ctx context.Context,
+		path []string,
+	) (map[string]string, error)
+
 	DeleteEntry(
 		ctx context.Context,
 		path []string,
 	) error
 
+	Move(
+		ctx context.Context,
+		from []string,
+		to []string,
+	) error
+
+	Copy(
+		ctx context.Context,
+		from []string,
+		to []string,
+	) error
+
 	InjectDynamicLink(
 		ctx context.Context,
 		path []string,
@@ -106,11 +184,28 @@ type FS interface {
 		error,
 	)
 
+	SetSymlink(
+		ctx context.Context,
+		path []string,
+		target []string,
+	) error
+
+	ReadSymlink(
+		ctx context.Context,
+		path []string,
+	) ([]string, error)
+
 	OpenEntryData(
 		ctx context.Context,
 		path []string,
 	) (io.ReadCloser, error)
 
+	OpenEntryDataPrefix(
+		ctx context.Context,
+		path []string,
+		n int,
+	) ([]byte, error)
+
 	OpenEntrypointData(
 		ctx context.Context,
 		ep *Entrypoint,
@@ -118,6 +213,10 @@ type FS interface {
 
 	RootEntrypoint() (*Entrypoint, error)
 
+	MaxLinkRedirects() int
+
+	SetMaxLinkRedirects(n int) error
+
 	EntrypointWriterInfo(
 		ctx context.Context,
 		ep *Entrypoint,
@@ -126,14 +225,55 @@ type FS interface {
 	RootWriterInfo(
 		ctx context.Context,
 	) (*WriterInfo, error)
+
+	ListWriterInfos(
+		ctx context.Context,
+	) ([]PathWriterInfo, error)
+
+	ForgetWriterInfo(
+		ctx context.Context,
+		path []string,
+	) error
+
+	AddWriterInfo(
+		wi *WriterInfo,
+	) error
+
+	EntrypointContentVersion(
+		ctx context.Context,
+		ep *Entrypoint,
+	) (uint64, error)
+
+	PathLinks(
+		ctx context.Context,
+		path []string,
+	) ([]*Entrypoint, error)
 }
 
 type cinodeFS struct {
-	c                graphContext
-	maxLinkRedirects int
-	timeFunc         func() time.Time
-	randSource       io.Reader
+	c          graphContext
+	timeFunc   func() time.Time
+	randSource io.Reader
+
+	// maximum number of consecutive link redirects, read by every traversal
+	// at its start thus can be changed at any time
+	maxLinkRedirects atomic.Int64
+
+	// mimeTypeDetector, if set, is used to detect mime type of the content
+	// before falling back to the content sniffing
+	mimeTypeDetector        func(head []byte) string
+	requireExplicitMimeType bool
 
+	// if set, missing intermediate directories are not created automatically
+	noCreateParents bool
+
+	// parameters of the link cache, disabled if the size is 0
+	linkCacheSize int
+	linkCacheTTL  time.Duration
+
+	// lock protects the in-memory node tree and known writer infos, it is
+	// never held while accessing the datastore, see withLock for details
+	lock   sync.Mutex
 	rootEP node
 }
 
@@ -147,15 +287,17 @@ func New(
 	}
 
 	ret := cinodeFS{
-		maxLinkRedirects: DefaultMaxLinksRedirects,
-		timeFunc:         time.Now,
-		randSource:       rand.Reader,
+		timeFunc:   time.Now,
+		randSource: rand.Reader,
 		c: graphContext{
 			be:        be,
 			authInfos: map[string]*common.AuthInfo{},
+			log:       slog.Default(),
 		},
 	}
 
+	ret.maxLinkRedirects.Store(DefaultMaxLinksRedirects)
+
 	for _, opt := range options {
 		err := opt.apply(ctx, &ret)
 		if err != nil {
@@ -167,6 +309,10 @@ func New(
 		return nil, ErrMissingRootInfo
 	}
 
+	if ret.linkCacheSize > 0 {
+		ret.c.links = newLinkCache(ret.linkCacheSize, ret.linkCacheTTL, ret.timeFunc)
+	}
+
 	return &ret, nil
 }
 
@@ -176,13 +322,7 @@ func (fs *cinodeFS) SetEntryFile(
 	data io.Reader,
 	opts ...EntrypointOption,
 ) (*Entrypoint, error) {
-	ep := entrypointFromOptions(ctx, opts...)
-	if ep.ep.MimeType == "" && len(path) > 0 {
-		// Try detecting mime type from filename extension
-		ep.ep.MimeType = mime.TypeByExtension(filepath.Ext(path[len(path)-1]))
-	}
-
-	ep, err := fs.createFileEntrypoint(ctx, data, ep)
+	path, ep, err := fs.createFileEntrypointForPath(ctx, path, data, opts...)
 	if err != nil {
 		return nil, err
 	}
@@ -195,12 +335,45 @@ func (fs *cinodeFS) SetEntryFile(
 	return ep, nil
 }
 
+// createFileEntrypointForPath stores the file data, the mime type is detected
+// from the name extension if not given explicitly. Returns the validated path.
+func (fs *cinodeFS) createFileEntrypointForPath(
+	ctx context.Context,
+	path []string,
+	data io.Reader,
+	opts ...EntrypointOption,
+) ([]string, *Entrypoint, error) {
+	path, err := validatePath(path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ep, err := entrypointFromOptions(ctx, opts...)
+	if err != nil {
+		return nil, nil, err
+	}
+	if ep.ep.MimeType == "" && len(path) > 0 {
+		// Try detecting mime type from filename extension
+		ep.ep.MimeType = mime.TypeByExtension(filepath.Ext(path[len(path)-1]))
+	}
+
+	ep, err = fs.createFileEntrypoint(ctx, data, ep)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return path, ep, nil
+}
+
 func (fs *cinodeFS) CreateFileEntrypoint(
 	ctx context.Context,
 	data io.Reader,
 	opts ...EntrypointOption,
 ) (*Entrypoint, error) {
-	ep := entrypointFromOptions(ctx, opts...)
+	ep, err := entrypointFromOptions(ctx, opts...)
+	if err != nil {
+		return nil, err
+	}
 	return fs.createFileEntrypoint(ctx, data, ep)
 }
 
@@ -209,30 +382,123 @@ func (fs *cinodeFS) createFileEntrypoint(
 	data io.Reader,
 	ep *Entrypoint,
 ) (*Entrypoint, error) {
-	var hw headwriter.Writer
+	if sr, ok := regularFileSection(data); ok {
+		return fs.createFileEntrypointFromSection(ctx, sr, ep)
+	}
 
 	if ep.ep.MimeType == "" {
-		// detect mimetype from the content
-		hw = headwriter.New(512)
-		data = io.TeeReader(data, &hw)
+		// detect mimetype from the content, this is done before storing
+		// the blob so that nothing is written if the mime type is rejected
+		head := make([]byte, 512)
+		n, err := io.ReadFull(data, head)
+		if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+			return nil, err
+		}
+		head = head[:n]
+
+		ep.ep.MimeType, err = fs.detectMimeType(head)
+		if err != nil {
+			return nil, err
+		}
+		data = io.MultiReader(bytes.NewReader(head), data)
 	}
 
-	bn, key, _, err := fs.c.be.Create(ctx, blobtypes.Static, data)
+	c := progress.NewCounter(0, nil)
+	bn, key, _, err := fs.c.be.Create(ctx, blobtypes.Static, c.Reader(data))
 	if err != nil {
 		return nil, err
 	}
+	ep.ep.ContentLength = c.N()
 
+	return setEntrypointBlobNameAndKey(bn, key, ep), nil
+}
+
+// createFileEntrypointFromSection creates file blob from a source that can
+// be re-read thus avoiding storing the data in a temporary buffer
+func (fs *cinodeFS) createFileEntrypointFromSection(
+	ctx context.Context,
+	sr *io.SectionReader,
+	ep *Entrypoint,
+) (*Entrypoint, error) {
 	if ep.ep.MimeType == "" {
-		ep.ep.MimeType = http.DetectContentType(hw.Head())
+		head := make([]byte, min(sr.Size(), 512))
+		_, err := sr.ReadAt(head, 0)
+		if err != nil {
+			return nil, err
+		}
+
+		ep.ep.MimeType, err = fs.detectMimeType(head)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	bn, key, _, err := fs.c.be.CreateFromReaderAt(ctx, blobtypes.Static, sr, sr.Size())
+	if err != nil {
+		return nil, err
 	}
+	ep.ep.ContentLength = sr.Size()
 
 	return setEntrypointBlobNameAndKey(bn, key, ep), nil
 }
 
+// regularFileSection returns the unread part of a regular file, other
+// sources can only be read once
+func regularFileSection(data io.Reader) (*io.SectionReader, bool) {
+	f, ok := data.(*os.File)
+	if !ok {
+		return nil, false
+	}
+
+	st, err := f.Stat()
+	if err != nil || !st.Mode().IsRegular() {
+		return nil, false
+	}
+
+	// Move to the end of the file, same as if the data was consumed
+	// by reading it
+	offset, err := f.Seek(0, io.SeekCurrent)
+	if err != nil || offset > st.Size() {
+		return nil, false
+	}
+	_, err = f.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, false
+	}
+
+	return io.NewSectionReader(f, offset, st.Size()-offset), true
+}
+
+func (fs *cinodeFS) detectMimeType(head []byte) (string, error) {
+	if fs.mimeTypeDetector != nil {
+		if mimeType := fs.mimeTypeDetector(head); mimeType != "" {
+			return mimeType, nil
+		}
+	}
+
+	if fs.requireExplicitMimeType {
+		return "", ErrMimeTypeRequired
+	}
+
+	return http.DetectContentType(head), nil
+}
+
 func (fs *cinodeFS) SetEntry(
 	ctx context.Context,
 	path []string,
 	ep *Entrypoint,
+) error {
+	return fs.withLock(ctx, func(ctx context.Context) error {
+		return fs.setEntryLocked(ctx, path, ep)
+	})
+}
+
+// setEntryLocked is the same as SetEntry but must be called from a function
+// run through withLock
+func (fs *cinodeFS) setEntryLocked(
+	ctx context.Context,
+	path []string,
+	ep *Entrypoint,
 ) error {
 	whenReached := func(
 		ctx context.Context,
@@ -245,17 +511,64 @@ func (fs *cinodeFS) SetEntry(
 		return &nodeUnloaded{ep: ep}, dsDirty, nil
 	}
 
-	return fs.traverseGraph(
+	return fs.traverseGraphLocked(
 		ctx,
 		path,
 		traverseOptions{
-			createNodes:      true,
-			maxLinkRedirects: fs.maxLinkRedirects,
+			createNodes:     true,
+			noFollowSymlink: true,
 		},
 		whenReached,
 	)
 }
 
+// SetEntryIfAbsent sets the entry at given path only if there's no entry there
+// yet, an existing entry of any type is left untouched. Missing intermediate
+// directories are created the same way as with SetEntry. Returns true if the
+// entry was created.
+func (fs *cinodeFS) SetEntryIfAbsent(
+	ctx context.Context,
+	path []string,
+	ep *Entrypoint,
+) (bool, error) {
+	if ep == nil {
+		return false, ErrNilEntrypoint
+	}
+
+	created := false
+	whenReached := func(
+		ctx context.Context,
+		current node,
+		isWriteable bool,
+	) (node, dirtyState, error) {
+		if current != nil {
+			// Entry already exists, leave it as it is
+			return current, dsClean, nil
+		}
+		if !isWriteable {
+			return nil, 0, ErrMissingWriterInfo
+		}
+		created = true
+		return &nodeUnloaded{ep: ep}, dsDirty, nil
+	}
+
+	err := fs.traverseGraph(
+		ctx,
+		path,
+		traverseOptions{
+			createNodes:     true,
+			doNotLoadTarget: true,
+			noFollowSymlink: true,
+		},
+		whenReached,
+	)
+	if err != nil {
+		return false, err
+	}
+
+	return created, nil
+}
+
 func (fs *cinodeFS) ResetDir(ctx context.Context, path []string) error {
 	whenReached := func(
 		ctx context.Context,
@@ -275,14 +588,62 @@ func (fs *cinodeFS) ResetDir(ctx context.Context, path []string) error {
 		ctx,
 		path,
 		traverseOptions{
-			createNodes:      true,
-			maxLinkRedirects: fs.maxLinkRedirects,
+			createNodes:     true,
+			noFollowSymlink: true,
 		},
 		whenReached,
 	)
 }
 
-func (fs *cinodeFS) Flush(ctx context.Context) error {
+func (fs *cinodeFS) SetEntryMimeType(
+	ctx context.Context,
+	path []string,
+	mimeType string,
+) error {
+	if mimeType == CinodeDirMimeType || mimeType == CinodeDirShardMimeType {
+		return fmt.Errorf("%w: %s is reserved for directories", ErrInvalidMimeType, mimeType)
+	}
+
+	whenReached := func(
+		ctx context.Context,
+		current node,
+		isWriteable bool,
+	) (node, dirtyState, error) {
+		file, isFile := current.(*nodeFile)
+		if !isFile {
+			return nil, 0, ErrIsADirectory
+		}
+		if !isWriteable {
+			return nil, 0, ErrMissingWriterInfo
+		}
+
+		ep, err := entrypointFromProtobuf(&file.ep.ep)
+		if err != nil {
+			return nil, 0, err
+		}
+		ep.ep.MimeType = mimeType
+
+		return &nodeFile{ep: ep}, dsDirty, nil
+	}
+
+	return fs.traverseGraph(
+		ctx,
+		path,
+		traverseOptions{},
+		whenReached,
+	)
+}
+
+func (fs *cinodeFS) Flush(ctx context.Context) (err error) {
+	ctx, span := fs.c.startSpan(ctx, SpanFlush)
+	defer func() { endSpan(span, err) }()
+
+	return fs.withLock(ctx, fs.flushLocked)
+}
+
+// flushLocked saves all pending changes, must be called from a function run
+// through withLock
+func (fs *cinodeFS) flushLocked(ctx context.Context) error {
 	_, newRootEP, err := fs.rootEP.flush(ctx, &fs.c)
 	if err != nil {
 		return err
@@ -292,9 +653,40 @@ func (fs *cinodeFS) Flush(ctx context.Context) error {
 	return nil
 }
 
+// flushDirtyLocked is the same as flushLocked but the filesystem is only
+// saved if there are any pending changes
+func (fs *cinodeFS) flushDirtyLocked(ctx context.Context) error {
+	if fs.rootEP.dirty() == dsClean {
+		return nil
+	}
+	return fs.flushLocked(ctx)
+}
+
+// MaxLinkRedirects returns the current limit of consecutive link redirects,
+// symbolic links resolved by a traversal count towards the same limit
+func (fs *cinodeFS) MaxLinkRedirects() int {
+	return int(fs.maxLinkRedirects.Load())
+}
+
+// SetMaxLinkRedirects changes the limit of consecutive link redirects.
+// The new limit applies to traversals started after the change,
+// traversals in progress keep using the previous one.
+func (fs *cinodeFS) SetMaxLinkRedirects(n int) error {
+	if n < 0 {
+		return ErrNegativeMaxLinksRedirects
+	}
+	fs.maxLinkRedirects.Store(int64(n))
+	return nil
+}
+
 func (fs *cinodeFS) FindEntry(ctx context.Context, path []string) (*Entrypoint, error) {
+	path, err := validatePath(path)
+	if err != nil {
+		return nil, err
+	}
+
 	var ret *Entrypoint
-	err := fs.traverseGraph(
+	err = fs.traverseGraph(
 		ctx,
 		path,
 		traverseOptions{
@@ -312,18 +704,41 @@ func (fs *cinodeFS) FindEntry(ctx context.Context, path []string) (*Entrypoint,
 	return ret, nil
 }
 
+// EntryMetadata returns custom metadata attached to the entry at given path,
+// nil is returned if the entry has no metadata
+func (fs *cinodeFS) EntryMetadata(ctx context.Context, path []string) (map[string]string, error) {
+	ep, err := fs.FindEntry(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+
+	return ep.Metadata(), nil
+}
+
 func (fs *cinodeFS) DeleteEntry(ctx context.Context, path []string) error {
+	return fs.withLock(ctx, func(ctx context.Context) error {
+		return fs.deleteEntryLocked(ctx, path)
+	})
+}
+
+// deleteEntryLocked is the same as DeleteEntry but must be called from
+// a function run through withLock
+func (fs *cinodeFS) deleteEntryLocked(ctx context.Context, path []string) error {
 	// Entry removal is done on the parent level, we find the parent directory
 	// and remove the entry from its list
 	if len(path) == 0 {
 		return ErrCantDeleteRoot
 	}
+	path, err := validatePath(path)
+	if err != nil {
+		return err
+	}
 
-	return fs.traverseGraph(
+	return fs.traverseGraphLocked(
 		ctx,
 		path[:len(path)-1],
 		traverseOptions{createNodes: true},
-		func(_ context.Context, reachedEntrypoint node, isWriteable bool) (node, dirtyState, error) {
+		func(ctx context.Context, reachedEntrypoint node, isWriteable bool) (node, dirtyState, error) {
 			if !isWriteable {
 				return nil, 0, ErrMissingWriterInfo
 			}
@@ -333,7 +748,11 @@ func (fs *cinodeFS) DeleteEntry(ctx context.Context, path []string) error {
 				return nil, 0, ErrNotADirectory
 			}
 
-			if !dir.deleteEntry(path[len(path)-1]) {
+			deleted, err := dir.deleteEntry(ctx, &fs.c, path[len(path)-1])
+			if err != nil {
+				return nil, 0, err
+			}
+			if !deleted {
 				return nil, 0, ErrEntryNotFound
 			}
 
@@ -376,7 +795,8 @@ func (fs *cinodeFS) InjectDynamicLink(
 				target: current,
 				// Link itself must be marked as dirty - even if the content is clean,
 				// the link itself must be persisted
-				dState: dsSubDirty,
+				dState:        dsSubDirty,
+				targetChanged: true,
 			},
 			// Parent node becomes dirty - new link is a new blob
 			dsDirty,
@@ -387,8 +807,7 @@ func (fs *cinodeFS) InjectDynamicLink(
 		ctx,
 		path,
 		traverseOptions{
-			createNodes:      true,
-			maxLinkRedirects: fs.maxLinkRedirects,
+			createNodes: true,
 		},
 		whenReached,
 	)
@@ -428,7 +847,41 @@ func (fs *cinodeFS) OpenEntryData(ctx context.Context, path []string) (io.ReadCl
 		"assumed that fs.FindEntry does not return a link",
 	)
 
-	return fs.OpenEntrypointData(ctx, ep)
+	rc, err := fs.OpenEntrypointData(ctx, ep)
+	if err != nil {
+		return nil, wrapMissingKeyError(err, path)
+	}
+	return rc, nil
+}
+
+// OpenEntryDataPrefix returns up to n first bytes of the file at given path.
+//
+// Static blobs are validated over their whole content thus the file is still
+// read until the end, only the prefix is kept in memory. A prefix of an
+// invalid file is never returned.
+func (fs *cinodeFS) OpenEntryDataPrefix(ctx context.Context, path []string, n int) ([]byte, error) {
+	if n < 0 {
+		return nil, ErrNegativePrefixLength
+	}
+
+	rc, err := fs.OpenEntryData(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	prefix, err := io.ReadAll(io.LimitReader(rc, int64(n)))
+	if err != nil {
+		return nil, err
+	}
+
+	// Read the rest of the data to trigger the validation
+	_, err = io.Copy(io.Discard, rc)
+	if err != nil {
+		return nil, err
+	}
+
+	return prefix, nil
 }
 
 func (fs *cinodeFS) OpenEntrypointData(ctx context.Context, ep *Entrypoint) (io.ReadCloser, error) {
@@ -440,6 +893,9 @@ func (fs *cinodeFS) OpenEntrypointData(ctx context.Context, ep *Entrypoint) (io.
 }
 
 func (fs *cinodeFS) RootEntrypoint() (*Entrypoint, error) {
+	fs.lock.Lock()
+	defer fs.lock.Unlock()
+
 	return fs.rootEP.entrypoint()
 }
 
@@ -455,7 +911,9 @@ func (fs *cinodeFS) EntrypointWriterInfo(ctx context.Context, ep *Entrypoint) (*
 		return nil, err
 	}
 
+	fs.lock.Lock()
 	authInfo, found := fs.c.authInfos[bn.String()]
+	fs.lock.Unlock()
 	if !found {
 		return nil, ErrMissingWriterInfo
 	}
@@ -463,6 +921,56 @@ func (fs *cinodeFS) EntrypointWriterInfo(ctx context.Context, ep *Entrypoint) (*
 	return writerInfoFromBlobNameKeyAndAuthInfo(bn, key, authInfo), nil
 }
 
+// EntrypointContentVersion returns the content version of the dynamic link
+// given entrypoint points to. The version can be used to order link updates.
+func (fs *cinodeFS) EntrypointContentVersion(ctx context.Context, ep *Entrypoint) (uint64, error) {
+	if ep == nil {
+		return 0, ErrNilEntrypoint
+	}
+	if !ep.IsLink() {
+		return 0, ErrNotALink
+	}
+
+	return fs.c.be.ContentVersion(ctx, ep.BlobName())
+}
+
+// PathLinks returns entrypoints of dynamic links followed while resolving
+// given path, including the root link and the link at the end of the path,
+// in the order in which those are followed. Content of the entry can only
+// change if one of those links is updated.
+func (fs *cinodeFS) PathLinks(ctx context.Context, path []string) ([]*Entrypoint, error) {
+	path, err := validatePath(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var links []*Entrypoint
+	err = fs.withLock(ctx, func(ctx context.Context) error {
+		// Restarted traversal follows all links again
+		links = nil
+
+		return fs.traverseGraphLocked(
+			ctx,
+			path,
+			traverseOptions{
+				doNotCache:      true,
+				doNotLoadTarget: true,
+				linkFollowed: func(ep *Entrypoint) {
+					links = append(links, ep)
+				},
+			},
+			func(_ context.Context, reached node, _ bool) (node, dirtyState, error) {
+				return reached, dsClean, nil
+			},
+		)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return links, nil
+}
+
 func (fs *cinodeFS) RootWriterInfo(ctx context.Context) (*WriterInfo, error) {
 	rootEP, err := fs.RootEntrypoint()
 	if err != nil {
@@ -23,12 +23,16 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"os"
+	"path/filepath"
 	"strings"
+	"sync"
 	"testing"
 	"testing/iotest"
 	"time"
 
 	"github.com/cinode/go/pkg/blenc"
+	"github.com/cinode/go/pkg/blobtypes"
 	"github.com/cinode/go/pkg/cinodefs"
 	"github.com/cinode/go/pkg/cinodefs/protobuf"
 	"github.com/cinode/go/pkg/common"
@@ -865,6 +869,83 @@ func (c *CinodeFSMultiFileTestSuite) TestReadFailureMissingKey() {
 	require.Nil(c.T(), r)
 }
 
+func (c *CinodeFSMultiFileTestSuite) TestNoLockDuringBlobWrite() {
+	ctx := context.Background()
+
+	_, err := c.fs.SetEntryFile(ctx, []string{"file"}, strings.NewReader("test"))
+	require.NoError(c.T(), err)
+
+	writeStarted := make(chan struct{})
+	releaseWrite := make(chan struct{})
+	once := sync.Once{}
+	c.be.createFunc = func(ctx context.Context, blobType common.BlobType, r io.Reader,
+	) (*common.BlobName, *common.BlobKey, *common.AuthInfo, error) {
+		once.Do(func() { close(writeStarted) })
+		<-releaseWrite
+		return c.be.BE.Create(ctx, blobType, r)
+	}
+
+	flushErr := make(chan error)
+	go func() { flushErr <- c.fs.Flush(ctx) }()
+
+	<-writeStarted
+
+	// Filesystem must be usable while the flush waits for the datastore
+	ep, err := c.fs.FindEntry(ctx, c.contentMap[0].path)
+	require.NoError(c.T(), err)
+
+	err = c.fs.SetEntry(ctx, []string{"file2"}, ep)
+	require.NoError(c.T(), err)
+
+	close(releaseWrite)
+	require.NoError(c.T(), <-flushErr)
+
+	_, err = c.fs.FindEntry(ctx, []string{"file"})
+	require.NoError(c.T(), err)
+	_, err = c.fs.FindEntry(ctx, []string{"file2"})
+	require.NoError(c.T(), err)
+}
+
+func (c *CinodeFSMultiFileTestSuite) TestConcurrentModifications() {
+	ctx := context.Background()
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < 8; i++ {
+		wg.Add(3)
+		go func(i int) {
+			defer wg.Done()
+			_, err := c.fs.SetEntryFile(ctx,
+				[]string{"concurrent", fmt.Sprintf("dir%d", i%3), fmt.Sprintf("file%d.txt", i)},
+				strings.NewReader(fmt.Sprintf("concurrent file %d", i)),
+			)
+			require.NoError(c.T(), err)
+		}(i)
+		go func(i int) {
+			defer wg.Done()
+			_, err := c.fs.FindEntry(ctx, c.contentMap[i].path)
+			require.NoError(c.T(), err)
+		}(i)
+		go func() {
+			defer wg.Done()
+			require.NoError(c.T(), c.fs.Flush(ctx))
+		}()
+	}
+	wg.Wait()
+
+	require.NoError(c.T(), c.fs.Flush(ctx))
+	for i := 0; i < 8; i++ {
+		rc, err := c.fs.OpenEntryData(ctx,
+			[]string{"concurrent", fmt.Sprintf("dir%d", i%3), fmt.Sprintf("file%d.txt", i)},
+		)
+		require.NoError(c.T(), err)
+		data, err := io.ReadAll(rc)
+		require.NoError(c.T(), err)
+		require.NoError(c.T(), rc.Close())
+		require.Equal(c.T(), fmt.Sprintf("concurrent file %d", i), string(data))
+	}
+	c.checkContentMap(c.T(), c.fs)
+}
+
 func TestFetchingWriterInfo(t *testing.T) {
 	t.Run("not a dynamic link", func(t *testing.T) {
 		fs, err := cinodefs.New(
@@ -904,3 +985,474 @@ func TestFetchingWriterInfo(t *testing.T) {
 		require.Nil(t, wi)
 	})
 }
+
+func TestEntrypointContentVersion(t *testing.T) {
+	ctx := context.Background()
+	version := uint64(1000)
+	fs, err := cinodefs.New(
+		ctx,
+		blenc.FromDatastore(
+			datastore.InMemory(),
+			blenc.VersionSource(func() uint64 { return version }),
+		),
+		cinodefs.NewRootDynamicLink(),
+	)
+	require.NoError(t, err)
+
+	_, err = fs.SetEntryFile(ctx, []string{"file.txt"}, strings.NewReader("hello"))
+	require.NoError(t, err)
+	require.NoError(t, fs.Flush(ctx))
+
+	rootEP, err := fs.RootEntrypoint()
+	require.NoError(t, err)
+
+	v, err := fs.EntrypointContentVersion(ctx, rootEP)
+	require.NoError(t, err)
+	require.EqualValues(t, 1000, v)
+
+	version = 2000
+	_, err = fs.SetEntryFile(ctx, []string{"file.txt"}, strings.NewReader("hello again"))
+	require.NoError(t, err)
+	require.NoError(t, fs.Flush(ctx))
+
+	v, err = fs.EntrypointContentVersion(ctx, rootEP)
+	require.NoError(t, err)
+	require.EqualValues(t, 2000, v)
+
+	fileEP, err := fs.FindEntry(ctx, []string{"file.txt"})
+	require.NoError(t, err)
+
+	_, err = fs.EntrypointContentVersion(ctx, fileEP)
+	require.ErrorIs(t, err, cinodefs.ErrNotALink)
+
+	_, err = fs.EntrypointContentVersion(ctx, nil)
+	require.ErrorIs(t, err, cinodefs.ErrNilEntrypoint)
+}
+
+func TestPathLinks(t *testing.T) {
+	ctx := context.Background()
+	fs, err := cinodefs.New(
+		ctx,
+		blenc.FromDatastore(datastore.InMemory()),
+		cinodefs.NewRootDynamicLink(),
+	)
+	require.NoError(t, err)
+
+	_, err = fs.SetEntryFile(ctx, []string{"dir", "linked", "file.txt"}, strings.NewReader("hello"))
+	require.NoError(t, err)
+	_, err = fs.SetEntryFile(ctx, []string{"other.txt"}, strings.NewReader("world"))
+	require.NoError(t, err)
+	linkWI, err := fs.InjectDynamicLink(ctx, []string{"dir", "linked"})
+	require.NoError(t, err)
+	require.NoError(t, fs.Flush(ctx))
+
+	rootEP, err := fs.RootEntrypoint()
+	require.NoError(t, err)
+	linkFS, err := cinodefs.New(ctx, blenc.FromDatastore(datastore.InMemory()), cinodefs.RootWriterInfo(linkWI))
+	require.NoError(t, err)
+	linkEP, err := linkFS.RootEntrypoint()
+	require.NoError(t, err)
+
+	links, err := fs.PathLinks(ctx, []string{"other.txt"})
+	require.NoError(t, err)
+	require.Len(t, links, 1)
+	require.Equal(t, rootEP.BlobName(), links[0].BlobName())
+
+	for _, path := range [][]string{
+		{"dir", "linked"},
+		{"dir", "linked", "file.txt"},
+	} {
+		links, err = fs.PathLinks(ctx, path)
+		require.NoError(t, err)
+		require.Len(t, links, 2)
+		require.Equal(t, rootEP.BlobName(), links[0].BlobName())
+		require.Equal(t, linkEP.BlobName(), links[1].BlobName())
+	}
+
+	_, err = fs.PathLinks(ctx, []string{"missing.txt"})
+	require.ErrorIs(t, err, cinodefs.ErrEntryNotFound)
+}
+
+func TestMissingKeyInTraversal(t *testing.T) {
+	ctx := context.Background()
+	fs, err := cinodefs.New(ctx,
+		blenc.FromDatastore(datastore.InMemory()),
+		cinodefs.NewRootStaticDirectory(),
+	)
+	require.NoError(t, err)
+
+	_, err = fs.SetEntryFile(ctx, []string{"dir", "subdir", "file.txt"}, strings.NewReader("hello"))
+	require.NoError(t, err)
+	require.NoError(t, fs.Flush(ctx))
+
+	stripKey := func(path []string) {
+		var epProto protobuf.Entrypoint
+		err := proto.Unmarshal(golang.Must(fs.FindEntry(ctx, path)).Bytes(), &epProto)
+		require.NoError(t, err)
+
+		epProto.KeyInfo.Key = nil
+		ep := golang.Must(cinodefs.EntrypointFromBytes(golang.Must(proto.Marshal(&epProto))))
+
+		err = fs.SetEntry(ctx, path, ep)
+		require.NoError(t, err)
+		require.NoError(t, fs.Flush(ctx))
+	}
+
+	t.Run("missing key of the file", func(t *testing.T) {
+		stripKey([]string{"dir", "subdir", "file.txt"})
+
+		r, err := fs.OpenEntryData(ctx, []string{"dir", "subdir", "file.txt"})
+		require.ErrorIs(t, err, cinodefs.ErrMissingKeyInfo)
+		require.ErrorContains(t, err, "key needed at path: /dir/subdir/file.txt")
+		require.Nil(t, r)
+	})
+
+	t.Run("missing key of intermediate directory", func(t *testing.T) {
+		stripKey([]string{"dir", "subdir"})
+
+		ep, err := fs.FindEntry(ctx, []string{"dir", "subdir", "file.txt"})
+		require.ErrorIs(t, err, cinodefs.ErrMissingKeyInfo)
+		require.ErrorIs(t, err, cinodefs.ErrCantOpenDir)
+		require.ErrorContains(t, err, "key needed at path: /dir/subdir")
+		require.NotContains(t, err.Error(), "/dir/subdir/file.txt")
+		require.Nil(t, ep)
+
+		r, err := fs.OpenEntryData(ctx, []string{"dir", "subdir", "file.txt"})
+		require.ErrorIs(t, err, cinodefs.ErrMissingKeyInfo)
+		require.ErrorContains(t, err, "key needed at path: /dir/subdir")
+		require.Nil(t, r)
+	})
+}
+
+func TestSetEntryMimeType(t *testing.T) {
+	ctx := context.Background()
+	be := blenc.FromDatastore(datastore.InMemory())
+	fs, err := cinodefs.New(ctx, be, cinodefs.NewRootDynamicLink())
+	require.NoError(t, err)
+
+	ep1, err := fs.SetEntryFile(ctx, []string{"dir", "file.txt"}, strings.NewReader("hello"))
+	require.NoError(t, err)
+	require.NoError(t, fs.Flush(ctx))
+
+	err = fs.SetEntryMimeType(ctx, []string{"dir", "file.txt"}, "application/x-test")
+	require.NoError(t, err)
+	require.NoError(t, fs.Flush(ctx))
+
+	ep2, err := fs.FindEntry(ctx, []string{"dir", "file.txt"})
+	require.NoError(t, err)
+	require.Equal(t, "application/x-test", ep2.MimeType())
+	require.Equal(t, ep1.BlobName(), ep2.BlobName())
+
+	// Original entrypoint must not be modified
+	require.Equal(t, "text/plain; charset=utf-8", ep1.MimeType())
+
+	rc, err := fs.OpenEntryData(ctx, []string{"dir", "file.txt"})
+	require.NoError(t, err)
+	data, err := io.ReadAll(rc)
+	require.NoError(t, err)
+	require.NoError(t, rc.Close())
+	require.Equal(t, "hello", string(data))
+
+	t.Run("errors", func(t *testing.T) {
+		err := fs.SetEntryMimeType(ctx, []string{"dir"}, "text/plain")
+		require.ErrorIs(t, err, cinodefs.ErrIsADirectory)
+
+		err = fs.SetEntryMimeType(ctx, []string{"dir", "missing"}, "text/plain")
+		require.ErrorIs(t, err, cinodefs.ErrEntryNotFound)
+
+		err = fs.SetEntryMimeType(ctx, []string{"dir", "file.txt"}, cinodefs.CinodeDirMimeType)
+		require.ErrorIs(t, err, cinodefs.ErrInvalidMimeType)
+
+		rootEP, err := fs.RootEntrypoint()
+		require.NoError(t, err)
+		fsRO, err := cinodefs.New(ctx, be, cinodefs.RootEntrypoint(rootEP))
+		require.NoError(t, err)
+
+		err = fsRO.SetEntryMimeType(ctx, []string{"dir", "file.txt"}, "text/plain")
+		require.ErrorIs(t, err, cinodefs.ErrMissingWriterInfo)
+	})
+}
+
+func TestCreateFileEntrypointFromFile(t *testing.T) {
+	ctx := context.Background()
+	content := strings.Repeat("Hello world! ", 1000)
+
+	be := &testBEWrapper{
+		BE: blenc.FromDatastore(datastore.InMemory()),
+		createFunc: func(
+			ctx context.Context, blobType common.BlobType, r io.Reader,
+		) (*common.BlobName, *common.BlobKey, *common.AuthInfo, error) {
+			return nil, nil, nil, errors.New("regular files must not be buffered")
+		},
+	}
+	fs, err := cinodefs.New(ctx, be, cinodefs.NewRootStaticDirectory())
+	require.NoError(t, err)
+
+	fileName := filepath.Join(t.TempDir(), "file.txt")
+	require.NoError(t, os.WriteFile(fileName, []byte("skipped:"+content), 0644))
+
+	fl, err := os.Open(fileName)
+	require.NoError(t, err)
+	defer fl.Close()
+
+	// Only the unread part of the file is stored
+	_, err = fl.Seek(int64(len("skipped:")), io.SeekStart)
+	require.NoError(t, err)
+
+	ep, err := fs.CreateFileEntrypoint(ctx, fl)
+	require.NoError(t, err)
+	require.EqualValues(t, len(content), ep.ContentLength())
+	require.Equal(t, "text/plain; charset=utf-8", ep.MimeType())
+
+	// The file is consumed same as with any other reader
+	rest, err := io.ReadAll(fl)
+	require.NoError(t, err)
+	require.Empty(t, rest)
+
+	be.createFunc = nil
+	ep2, err := fs.CreateFileEntrypoint(ctx, strings.NewReader(content))
+	require.NoError(t, err)
+	require.Equal(t, ep2.String(), ep.String())
+}
+
+func TestSetEntryIfAbsent(t *testing.T) {
+	ctx := context.Background()
+	ds := datastore.InMemory()
+	fs, err := cinodefs.New(ctx,
+		blenc.FromDatastore(ds),
+		cinodefs.NewRootDynamicLink(),
+	)
+	require.NoError(t, err)
+
+	ep1, err := fs.CreateFileEntrypoint(ctx, strings.NewReader("first"))
+	require.NoError(t, err)
+	ep2, err := fs.CreateFileEntrypoint(ctx, strings.NewReader("second"))
+	require.NoError(t, err)
+
+	t.Run("nil entrypoint", func(t *testing.T) {
+		created, err := fs.SetEntryIfAbsent(ctx, []string{"file.txt"}, nil)
+		require.ErrorIs(t, err, cinodefs.ErrNilEntrypoint)
+		require.False(t, created)
+	})
+
+	t.Run("create with intermediate directories", func(t *testing.T) {
+		created, err := fs.SetEntryIfAbsent(ctx, []string{"dir", "subdir", "file.txt"}, ep1)
+		require.NoError(t, err)
+		require.True(t, created)
+
+		ep, err := fs.FindEntry(ctx, []string{"dir", "subdir", "file.txt"})
+		require.NoError(t, err)
+		require.Equal(t, ep1.String(), ep.String())
+	})
+
+	t.Run("existing file is not overwritten", func(t *testing.T) {
+		created, err := fs.SetEntryIfAbsent(ctx, []string{"dir", "subdir", "file.txt"}, ep2)
+		require.NoError(t, err)
+		require.False(t, created)
+
+		ep, err := fs.FindEntry(ctx, []string{"dir", "subdir", "file.txt"})
+		require.NoError(t, err)
+		require.Equal(t, ep1.String(), ep.String())
+	})
+
+	t.Run("existing directory is not overwritten", func(t *testing.T) {
+		created, err := fs.SetEntryIfAbsent(ctx, []string{"dir", "subdir"}, ep2)
+		require.NoError(t, err)
+		require.False(t, created)
+
+		entries := 0
+		err = fs.Walk(ctx, []string{"dir", "subdir"}, func(cinodefs.WalkEntry) error {
+			entries++
+			return nil
+		})
+		require.NoError(t, err)
+		require.Equal(t, 1, entries)
+	})
+
+	t.Run("existing entry after flush", func(t *testing.T) {
+		err := fs.Flush(ctx)
+		require.NoError(t, err)
+
+		created, err := fs.SetEntryIfAbsent(ctx, []string{"dir", "subdir", "file.txt"}, ep2)
+		require.NoError(t, err)
+		require.False(t, created)
+
+		// Nothing changed, no flush needed
+		rootEP, err := fs.RootEntrypoint()
+		require.NoError(t, err)
+
+		fs2, err := cinodefs.New(ctx,
+			blenc.FromDatastore(ds),
+			cinodefs.RootEntrypoint(rootEP),
+		)
+		require.NoError(t, err)
+
+		ep, err := fs2.FindEntry(ctx, []string{"dir", "subdir", "file.txt"})
+		require.NoError(t, err)
+		require.Equal(t, ep1.String(), ep.String())
+	})
+
+	t.Run("missing writer info", func(t *testing.T) {
+		rootEP, err := fs.RootEntrypoint()
+		require.NoError(t, err)
+
+		fs2, err := cinodefs.New(ctx,
+			blenc.FromDatastore(ds),
+			cinodefs.RootEntrypoint(rootEP),
+		)
+		require.NoError(t, err)
+
+		created, err := fs2.SetEntryIfAbsent(ctx, []string{"dir", "subdir", "file.txt"}, ep2)
+		require.NoError(t, err)
+		require.False(t, created)
+
+		created, err = fs2.SetEntryIfAbsent(ctx, []string{"dir", "subdir", "other.txt"}, ep2)
+		require.ErrorIs(t, err, cinodefs.ErrMissingWriterInfo)
+		require.False(t, created)
+
+		created, err = fs2.SetEntryIfAbsent(ctx, []string{"dir", "new", "other.txt"}, ep2)
+		require.ErrorIs(t, err, cinodefs.ErrMissingWriterInfo)
+		require.False(t, created)
+	})
+}
+
+type corruptingBE struct {
+	blenc.BE
+	corrupted *common.BlobName
+}
+
+func (c *corruptingBE) Open(ctx context.Context, name *common.BlobName, key *common.BlobKey) (io.ReadCloser, error) {
+	rc, err := c.BE.Open(ctx, name, key)
+	if err != nil || !name.Equal(c.corrupted) {
+		return rc, err
+	}
+	return io.NopCloser(io.MultiReader(rc, iotest.ErrReader(blobtypes.ErrValidationFailed))), nil
+}
+
+func TestOpenEntryDataPrefix(t *testing.T) {
+	ctx := context.Background()
+	be := blenc.FromDatastore(datastore.InMemory())
+	fs, err := cinodefs.New(ctx, be, cinodefs.NewRootStaticDirectory())
+	require.NoError(t, err)
+
+	content := "Hello world!"
+	_, err = fs.SetEntryFile(ctx, []string{"dir", "file.txt"}, strings.NewReader(content))
+	require.NoError(t, err)
+
+	for _, n := range []int{0, 1, 5, len(content), len(content) + 1, 1000} {
+		t.Run(fmt.Sprint(n), func(t *testing.T) {
+			prefix, err := fs.OpenEntryDataPrefix(ctx, []string{"dir", "file.txt"}, n)
+			require.NoError(t, err)
+			require.Equal(t, content[:min(n, len(content))], string(prefix))
+		})
+	}
+
+	t.Run("negative length", func(t *testing.T) {
+		prefix, err := fs.OpenEntryDataPrefix(ctx, []string{"dir", "file.txt"}, -1)
+		require.ErrorIs(t, err, cinodefs.ErrNegativePrefixLength)
+		require.Nil(t, prefix)
+	})
+
+	t.Run("directory", func(t *testing.T) {
+		require.NoError(t, fs.Flush(ctx))
+
+		prefix, err := fs.OpenEntryDataPrefix(ctx, []string{"dir"}, 5)
+		require.ErrorIs(t, err, cinodefs.ErrIsADirectory)
+		require.Nil(t, prefix)
+	})
+
+	t.Run("missing entry", func(t *testing.T) {
+		prefix, err := fs.OpenEntryDataPrefix(ctx, []string{"dir", "missing.txt"}, 5)
+		require.ErrorIs(t, err, cinodefs.ErrEntryNotFound)
+		require.Nil(t, prefix)
+	})
+
+	t.Run("invalid data", func(t *testing.T) {
+		rootEP, err := fs.RootEntrypoint()
+		require.NoError(t, err)
+
+		fileEP, err := fs.FindEntry(ctx, []string{"dir", "file.txt"})
+		require.NoError(t, err)
+
+		fs2, err := cinodefs.New(ctx,
+			&corruptingBE{BE: be, corrupted: fileEP.BlobName()},
+			cinodefs.RootEntrypoint(rootEP),
+		)
+		require.NoError(t, err)
+
+		prefix, err := fs2.OpenEntryDataPrefix(ctx, []string{"dir", "file.txt"}, 5)
+		require.ErrorIs(t, err, blobtypes.ErrValidationFailed)
+		require.Nil(t, prefix)
+	})
+}
+
+type blockingOpenBE struct {
+	blenc.BE
+	openFunc func(name *common.BlobName)
+}
+
+func (b *blockingOpenBE) Open(ctx context.Context, name *common.BlobName, key *common.BlobKey) (io.ReadCloser, error) {
+	if b.openFunc != nil {
+		b.openFunc(name)
+	}
+	return b.BE.Open(ctx, name, key)
+}
+
+func TestSetMaxLinkRedirects(t *testing.T) {
+	ctx := context.Background()
+	be := &blockingOpenBE{BE: blenc.FromDatastore(datastore.InMemory())}
+	fs, err := cinodefs.New(ctx, be, cinodefs.NewRootStaticDirectory())
+	require.NoError(t, err)
+	require.Equal(t, cinodefs.DefaultMaxLinksRedirects, fs.MaxLinkRedirects())
+
+	path := []string{"dir", "file.txt"}
+	_, err = fs.SetEntryFile(ctx, path, strings.NewReader("hello"))
+	require.NoError(t, err)
+
+	// Two nested links on the path
+	_, err = fs.InjectDynamicLink(ctx, path[:1])
+	require.NoError(t, err)
+	_, err = fs.InjectDynamicLink(ctx, path[:1])
+	require.NoError(t, err)
+	require.NoError(t, fs.Flush(ctx))
+
+	err = fs.SetMaxLinkRedirects(-1)
+	require.ErrorIs(t, err, cinodefs.ErrNegativeMaxLinksRedirects)
+	require.Equal(t, cinodefs.DefaultMaxLinksRedirects, fs.MaxLinkRedirects())
+
+	require.NoError(t, fs.SetMaxLinkRedirects(1))
+	require.Equal(t, 1, fs.MaxLinkRedirects())
+	_, err = fs.FindEntry(ctx, path)
+	require.ErrorIs(t, err, cinodefs.ErrTooManyRedirects)
+
+	require.NoError(t, fs.SetMaxLinkRedirects(2))
+	_, err = fs.FindEntry(ctx, path)
+	require.NoError(t, err)
+
+	t.Run("in-flight traversal keeps the previous limit", func(t *testing.T) {
+		blocked := make(chan struct{})
+		release := make(chan struct{})
+		var once sync.Once
+		be.openFunc = func(name *common.BlobName) {
+			once.Do(func() {
+				close(blocked)
+				<-release
+			})
+		}
+		defer func() { be.openFunc = nil }()
+
+		done := make(chan error)
+		go func() {
+			_, err := fs.FindEntry(ctx, path)
+			done <- err
+		}()
+
+		<-blocked
+		require.NoError(t, fs.SetMaxLinkRedirects(0))
+		close(release)
+		require.NoError(t, <-done)
+
+		_, err = fs.FindEntry(ctx, path)
+		require.ErrorIs(t, err, cinodefs.ErrTooManyRedirects)
+	})
+}
@@ -24,6 +24,7 @@ import (
 	"time"
 
 	"github.com/cinode/go/pkg/common"
+	"golang.org/x/exp/slog"
 )
 
 const (
@@ -31,9 +32,15 @@ const (
 )
 
 var (
-	ErrNegativeMaxLinksRedirects = errors.New("negative value of maximum links redirects")
-	ErrInvalidNilTimeFunc        = errors.New("nil time function")
-	ErrInvalidNilRandSource      = errors.New("nil random source")
+	ErrNegativeMaxLinksRedirects  = errors.New("negative value of maximum links redirects")
+	ErrInvalidNilTimeFunc         = errors.New("nil time function")
+	ErrInvalidNilRandSource       = errors.New("nil random source")
+	ErrInvalidNilMimeTypeDetector = errors.New("nil mime type detector")
+	ErrInvalidNilLogger           = errors.New("nil logger")
+	ErrInvalidNilTracer           = errors.New("nil tracer")
+	ErrInvalidDirSizeLimit        = errors.New("invalid directory size limit")
+	ErrInvalidLinkCacheParams     = errors.New("invalid link cache parameters")
+	ErrInvalidDirSplitThreshold   = errors.New("invalid directory split threshold")
 )
 
 type Option interface {
@@ -55,7 +62,7 @@ func MaxLinkRedirects(maxLinkRedirects int) Option {
 		return errOption{ErrNegativeMaxLinksRedirects}
 	}
 	return optionFunc(func(ctx context.Context, fs *cinodeFS) error {
-		fs.maxLinkRedirects = maxLinkRedirects
+		fs.maxLinkRedirects.Store(int64(maxLinkRedirects))
 		return nil
 	})
 }
@@ -130,6 +137,137 @@ func RandSource(r io.Reader) Option {
 	})
 }
 
+// MimeTypeDetector sets the function used to detect the mime type of a file
+// that has no explicit mime type and whose name extension is not recognized.
+// The detector is given up to 512 first bytes of the content and returns
+// an empty string if the type can not be determined.
+func MimeTypeDetector(f func(head []byte) string) Option {
+	if f == nil {
+		return errOption{ErrInvalidNilMimeTypeDetector}
+	}
+	return optionFunc(func(ctx context.Context, fs *cinodeFS) error {
+		fs.mimeTypeDetector = f
+		return nil
+	})
+}
+
+// RequireExplicitMimeType disables guessing the mime type by sniffing the
+// content. Creating a file fails with ErrMimeTypeRequired if the mime type
+// is not given explicitly, can not be deduced from the name extension and
+// the mime type detector (if set) does not recognize the content.
+func RequireExplicitMimeType() Option {
+	return optionFunc(func(ctx context.Context, fs *cinodeFS) error {
+		fs.requireExplicitMimeType = true
+		return nil
+	})
+}
+
+// NoCreateParents disables automatic creation of missing intermediate
+// directories. Operations creating new entries, such as SetEntryFile or
+// SetEntry, fail with ErrEntryNotFound if the parent directory does not
+// exist instead of silently creating it.
+func NoCreateParents() Option {
+	return optionFunc(func(ctx context.Context, fs *cinodeFS) error {
+		fs.noCreateParents = true
+		return nil
+	})
+}
+
+// Logger sets the logger used to report warnings, slog.Default() is used
+// if not set
+func Logger(log *slog.Logger) Option {
+	if log == nil {
+		return errOption{ErrInvalidNilLogger}
+	}
+	return optionFunc(func(ctx context.Context, fs *cinodeFS) error {
+		fs.c.log = log
+		return nil
+	})
+}
+
+// LinkCache enables the cache of resolved dynamic link targets.
+//
+// Without the cache, every lookup through a dynamic link reads and validates
+// the link blob. Cached targets are used for up to ttl time, thus updates
+// of links done by other writers may not be visible for that long. Updates
+// done through the same filesystem instance are visible immediately. Once
+// maxEntries links are cached, the least recently used one is evicted.
+//
+// The cache is disabled by default.
+func LinkCache(maxEntries int, ttl time.Duration) Option {
+	if maxEntries <= 0 || ttl <= 0 {
+		return errOption{fmt.Errorf("%w: size %d, ttl %v", ErrInvalidLinkCacheParams, maxEntries, ttl)}
+	}
+	return optionFunc(func(ctx context.Context, fs *cinodeFS) error {
+		fs.linkCacheSize = maxEntries
+		fs.linkCacheTTL = ttl
+		return nil
+	})
+}
+
+// Tracing enables reporting tracing spans of graph traversals, node loads,
+// blob opens and flushes to given tracer. Each load of a link or directory
+// done by a traversal gets its own span thus the trace shows how many link
+// redirects and blob fetches a single operation costs.
+func Tracing(t Tracer) Option {
+	if t == nil {
+		return errOption{ErrInvalidNilTracer}
+	}
+	return optionFunc(func(ctx context.Context, fs *cinodeFS) error {
+		fs.c.tracer = t
+		return nil
+	})
+}
+
+// DirSizeLimitMode determines what happens when a directory blob exceeds
+// the limit set with DirSizeLimit
+type DirSizeLimitMode int
+
+const (
+	// DirSizeLimitWarn logs a warning, the directory is stored anyway
+	DirSizeLimitWarn DirSizeLimitMode = iota
+
+	// DirSizeLimitError fails the flush with ErrDirectoryTooLarge
+	DirSizeLimitError
+)
+
+// DirSizeLimit sets the maximal size of the serialized directory blob,
+// exceeding the limit either logs a warning or fails the flush depending
+// on the mode. Directories are not limited by default.
+func DirSizeLimit(bytes int64, mode DirSizeLimitMode) Option {
+	if bytes <= 0 {
+		return errOption{fmt.Errorf("%w: %d", ErrInvalidDirSizeLimit, bytes)}
+	}
+	if mode != DirSizeLimitWarn && mode != DirSizeLimitError {
+		return errOption{fmt.Errorf("%w: unknown mode %d", ErrInvalidDirSizeLimit, mode)}
+	}
+	return optionFunc(func(ctx context.Context, fs *cinodeFS) error {
+		fs.c.dirSizeLimit = bytes
+		fs.c.dirSizeLimitMode = mode
+		return nil
+	})
+}
+
+// DirSplitThreshold sets the maximal number of entries stored in a single
+// directory blob. Directories with more entries are split into shards stored
+// in separate blobs forming a balanced tree, splitting is transparent to
+// directory operations. Looking up a name only fetches shards covering that
+// name, unchanged shards are not stored again when the directory is modified.
+// The size limit set with DirSizeLimit applies to each of those blobs.
+// Directories are not split by default.
+func DirSplitThreshold(entries int) Option {
+	if entries < minDirSplitThreshold {
+		return errOption{fmt.Errorf(
+			"%w: %d, must be at least %d",
+			ErrInvalidDirSplitThreshold, entries, minDirSplitThreshold,
+		)}
+	}
+	return optionFunc(func(ctx context.Context, fs *cinodeFS) error {
+		fs.c.dirSplitThreshold = entries
+		return nil
+	})
+}
+
 // NewRootDynamicLink option can be used to create completely new, random
 // dynamic link as the root
 func NewRootDynamicLink() Option {
@@ -144,8 +282,9 @@ func NewRootDynamicLink() Option {
 		// creation and have to be flushed first to generate any
 		// blobs
 		fs.rootEP = &nodeLink{
-			ep:     newLinkEntrypoint,
-			dState: dsSubDirty,
+			ep:            newLinkEntrypoint,
+			dState:        dsSubDirty,
+			targetChanged: true,
 			target: &nodeDirectory{
 				entries: map[string]node{},
 				dState:  dsDirty,
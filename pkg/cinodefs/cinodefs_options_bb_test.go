@@ -17,8 +17,11 @@ limitations under the License.
 package cinodefs_test
 
 import (
+	"bytes"
 	"context"
 	"errors"
+	"fmt"
+	"strings"
 	"testing"
 	"testing/iotest"
 
@@ -26,6 +29,7 @@ import (
 	"github.com/cinode/go/pkg/cinodefs"
 	"github.com/cinode/go/pkg/datastore"
 	"github.com/stretchr/testify/require"
+	"golang.org/x/exp/slog"
 )
 
 func TestInvalidCinodeFSOptions(t *testing.T) {
@@ -100,6 +104,36 @@ func TestInvalidCinodeFSOptions(t *testing.T) {
 		require.Nil(t, cfs)
 	})
 
+	t.Run("invalid nil mime type detector", func(t *testing.T) {
+		cfs, err := cinodefs.New(context.Background(), be,
+			cinodefs.MimeTypeDetector(nil),
+		)
+		require.ErrorIs(t, err, cinodefs.ErrInvalidNilMimeTypeDetector)
+		require.Nil(t, cfs)
+	})
+
+	t.Run("invalid nil logger", func(t *testing.T) {
+		cfs, err := cinodefs.New(context.Background(), be,
+			cinodefs.Logger(nil),
+		)
+		require.ErrorIs(t, err, cinodefs.ErrInvalidNilLogger)
+		require.Nil(t, cfs)
+	})
+
+	t.Run("invalid directory size limit", func(t *testing.T) {
+		cfs, err := cinodefs.New(context.Background(), be,
+			cinodefs.DirSizeLimit(0, cinodefs.DirSizeLimitWarn),
+		)
+		require.ErrorIs(t, err, cinodefs.ErrInvalidDirSizeLimit)
+		require.Nil(t, cfs)
+
+		cfs, err = cinodefs.New(context.Background(), be,
+			cinodefs.DirSizeLimit(1024, cinodefs.DirSizeLimitMode(100)),
+		)
+		require.ErrorIs(t, err, cinodefs.ErrInvalidDirSizeLimit)
+		require.Nil(t, cfs)
+	})
+
 	t.Run("invalid random source", func(t *testing.T) {
 		// Error will manifest itself while random data source
 		// is needed which only takes place when new random
@@ -113,3 +147,246 @@ func TestInvalidCinodeFSOptions(t *testing.T) {
 		require.Nil(t, cfs)
 	})
 }
+
+func TestRequireExplicitMimeType(t *testing.T) {
+	ctx := context.Background()
+	ds := datastore.InMemory()
+	be := blenc.FromDatastore(ds)
+
+	detector := func(head []byte) string {
+		if strings.HasPrefix(string(head), "#!") {
+			return "text/x-script"
+		}
+		return ""
+	}
+
+	fs, err := cinodefs.New(ctx, be,
+		cinodefs.NewRootStaticDirectory(),
+		cinodefs.RequireExplicitMimeType(),
+		cinodefs.MimeTypeDetector(detector),
+	)
+	require.NoError(t, err)
+
+	t.Run("no mime type source", func(t *testing.T) {
+		_, err := fs.SetEntryFile(ctx, []string{"file"}, strings.NewReader("<html></html>"))
+		require.ErrorIs(t, err, cinodefs.ErrMimeTypeRequired)
+
+		_, err = fs.CreateFileEntrypoint(ctx, strings.NewReader("<html></html>"))
+		require.ErrorIs(t, err, cinodefs.ErrMimeTypeRequired)
+
+		_, err = fs.FindEntry(ctx, []string{"file"})
+		require.ErrorIs(t, err, cinodefs.ErrEntryNotFound)
+
+		// Rejected data must not be stored
+		for _, err := range ds.List(ctx) {
+			require.NoError(t, err)
+			require.Fail(t, "unexpected blob in the datastore")
+		}
+	})
+
+	t.Run("explicit mime type", func(t *testing.T) {
+		ep, err := fs.SetEntryFile(ctx, []string{"file"},
+			strings.NewReader("<html></html>"),
+			cinodefs.SetMimeType("application/x-test"),
+		)
+		require.NoError(t, err)
+		require.Equal(t, "application/x-test", ep.MimeType())
+	})
+
+	t.Run("extension match", func(t *testing.T) {
+		ep, err := fs.SetEntryFile(ctx, []string{"file.html"}, strings.NewReader("<html></html>"))
+		require.NoError(t, err)
+		require.Equal(t, "text/html; charset=utf-8", ep.MimeType())
+	})
+
+	t.Run("mime type detector", func(t *testing.T) {
+		ep, err := fs.SetEntryFile(ctx, []string{"script"}, strings.NewReader("#!/bin/sh"))
+		require.NoError(t, err)
+		require.Equal(t, "text/x-script", ep.MimeType())
+
+		ep, err = fs.CreateFileEntrypoint(ctx, strings.NewReader("#!/bin/sh"))
+		require.NoError(t, err)
+		require.Equal(t, "text/x-script", ep.MimeType())
+	})
+
+	t.Run("detector without strict mode", func(t *testing.T) {
+		fs, err := cinodefs.New(ctx, be,
+			cinodefs.NewRootStaticDirectory(),
+			cinodefs.MimeTypeDetector(detector),
+		)
+		require.NoError(t, err)
+
+		ep, err := fs.CreateFileEntrypoint(ctx, strings.NewReader("#!/bin/sh"))
+		require.NoError(t, err)
+		require.Equal(t, "text/x-script", ep.MimeType())
+
+		// Fallback to content sniffing
+		ep, err = fs.CreateFileEntrypoint(ctx, strings.NewReader("<html></html>"))
+		require.NoError(t, err)
+		require.Equal(t, "text/html; charset=utf-8", ep.MimeType())
+	})
+}
+
+func TestDirSizeLimit(t *testing.T) {
+	ctx := context.Background()
+
+	fillDir := func(t *testing.T, fs cinodefs.FS, count int) {
+		ep, err := fs.CreateFileEntrypoint(ctx, strings.NewReader("content"))
+		require.NoError(t, err)
+		for i := 0; i < count; i++ {
+			err = fs.SetEntry(ctx, []string{"dir", fmt.Sprintf("file-%03d", i)}, ep)
+			require.NoError(t, err)
+		}
+	}
+
+	t.Run("below the limit", func(t *testing.T) {
+		logBuf := bytes.NewBuffer(nil)
+		fs, err := cinodefs.New(ctx,
+			blenc.FromDatastore(datastore.InMemory()),
+			cinodefs.NewRootStaticDirectory(),
+			cinodefs.Logger(slog.New(slog.NewTextHandler(logBuf, nil))),
+			cinodefs.DirSizeLimit(100*1024, cinodefs.DirSizeLimitError),
+		)
+		require.NoError(t, err)
+
+		fillDir(t, fs, 10)
+		require.NoError(t, fs.Flush(ctx))
+		require.Empty(t, logBuf.String())
+	})
+
+	t.Run("warn mode", func(t *testing.T) {
+		logBuf := bytes.NewBuffer(nil)
+		fs, err := cinodefs.New(ctx,
+			blenc.FromDatastore(datastore.InMemory()),
+			cinodefs.NewRootStaticDirectory(),
+			cinodefs.Logger(slog.New(slog.NewTextHandler(logBuf, nil))),
+			cinodefs.DirSizeLimit(1024, cinodefs.DirSizeLimitWarn),
+		)
+		require.NoError(t, err)
+
+		fillDir(t, fs, 100)
+		require.NoError(t, fs.Flush(ctx))
+		require.Contains(t, logBuf.String(), "level=WARN")
+		require.Equal(t, 1, strings.Count(logBuf.String(), "directory blob exceeds the size limit"))
+		require.Contains(t, logBuf.String(), "entries=100")
+
+		entries := 0
+		err = fs.Walk(ctx, []string{"dir"}, func(cinodefs.WalkEntry) error {
+			entries++
+			return nil
+		})
+		require.NoError(t, err)
+		require.Equal(t, 100, entries)
+	})
+
+	t.Run("error mode", func(t *testing.T) {
+		fs, err := cinodefs.New(ctx,
+			blenc.FromDatastore(datastore.InMemory()),
+			cinodefs.NewRootStaticDirectory(),
+			cinodefs.DirSizeLimit(4096, cinodefs.DirSizeLimitError),
+		)
+		require.NoError(t, err)
+
+		fillDir(t, fs, 100)
+		err = fs.Flush(ctx)
+		require.ErrorIs(t, err, cinodefs.ErrDirectoryTooLarge)
+
+		// Changes are kept, the flush can be retried once the directory shrinks
+		for i := 10; i < 100; i++ {
+			err = fs.DeleteEntry(ctx, []string{"dir", fmt.Sprintf("file-%03d", i)})
+			require.NoError(t, err)
+		}
+		require.NoError(t, fs.Flush(ctx))
+
+		entries := 0
+		err = fs.Walk(ctx, []string{"dir"}, func(cinodefs.WalkEntry) error {
+			entries++
+			return nil
+		})
+		require.NoError(t, err)
+		require.Equal(t, 10, entries)
+	})
+}
+
+func TestNoCreateParents(t *testing.T) {
+	ctx := context.Background()
+	be := blenc.FromDatastore(datastore.InMemory())
+
+	t.Run("default mode creates parents", func(t *testing.T) {
+		fs, err := cinodefs.New(ctx, be, cinodefs.NewRootStaticDirectory())
+		require.NoError(t, err)
+
+		_, err = fs.SetEntryFile(ctx, []string{"missing", "file"}, strings.NewReader("data"))
+		require.NoError(t, err)
+
+		entries := 0
+		err = fs.Walk(ctx, []string{"missing"}, func(cinodefs.WalkEntry) error {
+			entries++
+			return nil
+		})
+		require.NoError(t, err)
+		require.Equal(t, 1, entries)
+	})
+
+	fs, err := cinodefs.New(ctx, be,
+		cinodefs.NewRootDynamicLink(),
+		cinodefs.NoCreateParents(),
+	)
+	require.NoError(t, err)
+
+	t.Run("missing parent", func(t *testing.T) {
+		_, err := fs.SetEntryFile(ctx, []string{"missing", "file"}, strings.NewReader("data"))
+		require.ErrorIs(t, err, cinodefs.ErrEntryNotFound)
+
+		ep, err := fs.CreateFileEntrypoint(ctx, strings.NewReader("data"))
+		require.NoError(t, err)
+
+		err = fs.SetEntry(ctx, []string{"missing", "sub", "file"}, ep)
+		require.ErrorIs(t, err, cinodefs.ErrEntryNotFound)
+
+		_, err = fs.FindEntry(ctx, []string{"missing"})
+		require.ErrorIs(t, err, cinodefs.ErrEntryNotFound)
+	})
+
+	t.Run("existing parent", func(t *testing.T) {
+		_, err := fs.SetEntryFile(ctx, []string{"file"}, strings.NewReader("data"))
+		require.NoError(t, err)
+
+		err = fs.ResetDir(ctx, []string{"dir"})
+		require.NoError(t, err)
+
+		_, err = fs.SetEntryFile(ctx, []string{"dir", "file"}, strings.NewReader("data"))
+		require.NoError(t, err)
+	})
+
+	t.Run("writer info checks", func(t *testing.T) {
+		err := fs.ResetDir(ctx, []string{"linked"})
+		require.NoError(t, err)
+
+		_, err = fs.InjectDynamicLink(ctx, []string{"linked"})
+		require.NoError(t, err)
+
+		err = fs.Flush(ctx)
+		require.NoError(t, err)
+
+		rootWriterInfo, err := fs.RootWriterInfo(ctx)
+		require.NoError(t, err)
+
+		// Reopen with the root writer info only, the linked directory
+		// is read-only then
+		fs2, err := cinodefs.New(ctx, be,
+			cinodefs.RootWriterInfo(rootWriterInfo),
+			cinodefs.NoCreateParents(),
+		)
+		require.NoError(t, err)
+
+		_, err = fs2.SetEntryFile(ctx, []string{"linked", "file"}, strings.NewReader("data"))
+		require.ErrorIs(t, err, cinodefs.ErrMissingWriterInfo)
+
+		_, err = fs2.SetEntryFile(ctx, []string{"linked", "missing", "file"}, strings.NewReader("data"))
+		require.ErrorIs(t, err, cinodefs.ErrEntryNotFound)
+
+		_, err = fs2.SetEntryFile(ctx, []string{"dir", "other"}, strings.NewReader("data"))
+		require.NoError(t, err)
+	})
+}
@@ -18,6 +18,9 @@ package cinodefs
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"strings"
 )
 
 type traverseGoalFunc func(
@@ -34,39 +37,116 @@ type traverseOptions struct {
 	createNodes      bool
 	doNotCache       bool
 	maxLinkRedirects int
+
+	// symlinkRedirects is the number of symbolic links resolved so far,
+	// symbolic links and dynamic links share the same redirects budget thus
+	// chains of dynamic links start at that depth
+	symlinkRedirects int
+
+	// noCreateParents allows creating the final path segment only,
+	// missing intermediate directories result in ErrEntryNotFound
+	noCreateParents bool
+
+	// doNotLoadTarget passes the target node to the callback without loading
+	// its content, links are still followed
+	doNotLoadTarget bool
+
+	// noFollowSymlink passes the symbolic link at the end of the path to the
+	// callback instead of resolving it, used when the entry is replaced
+	noFollowSymlink bool
+
+	// linkFollowed, if set, is called with the entrypoint of each dynamic
+	// link followed during the traversal
+	linkFollowed func(ep *Entrypoint)
 }
 
 // Generic graph traversal function, it follows given path, once the endpoint
 // is reached, it executed given callback function.
+//
+// The traversal is done with the filesystem lock held and may be restarted
+// if blob data has to be loaded, see withLock for details. The callback
+// may thus be called more than once and must not have side effects before
+// all blob operations it needs are done.
 func (fs *cinodeFS) traverseGraph(
 	ctx context.Context,
 	path []string,
 	opts traverseOptions,
 	whenReached traverseGoalFunc,
 ) error {
-	for _, p := range path {
-		if p == "" {
-			return ErrEmptyName
-		}
-	}
+	return fs.withLock(ctx, func(ctx context.Context) error {
+		return fs.traverseGraphLocked(ctx, path, opts, whenReached)
+	})
+}
 
-	opts.maxLinkRedirects = fs.maxLinkRedirects
-
-	changedEntrypoint, _, err := fs.rootEP.traverse(
-		ctx,         // context
-		&fs.c,       // graph context
-		path,        // path
-		0,           // pathPosition - start at the beginning
-		0,           // linkDepth - we don't come from any link
-		true,        // isWritable - root is always writable
-		opts,        // traverseOptions
-		whenReached, // callback
-	)
+// traverseGraphLocked is the same as traverseGraph but must be called from
+// a function run through withLock, it allows doing multiple traversals
+// atomically
+func (fs *cinodeFS) traverseGraphLocked(
+	ctx context.Context,
+	path []string,
+	opts traverseOptions,
+	whenReached traverseGoalFunc,
+) (err error) {
+	// All operations go through the traversal, paths are thus validated
+	// the same way everywhere
+	path, err = validatePath(path)
 	if err != nil {
 		return err
 	}
-	if !opts.doNotCache {
-		fs.rootEP = changedEntrypoint
+
+	ctx, span, finishSpan := fs.c.startStepSpan(ctx, SpanTraverse, func() string {
+		return "traverse:" + tracePath(path)
+	})
+	defer func() { finishSpan(err) }()
+	if fs.c.tracer != nil {
+		span.SetAttribute(AttrPath, tracePath(path))
+	}
+
+	opts.maxLinkRedirects = blobIOFromContext(ctx).maxLinkRedirects
+	opts.noCreateParents = fs.noCreateParents
+
+	for {
+		var changedEntrypoint node
+		changedEntrypoint, _, err = fs.rootEP.traverse(
+			ctx,                   // context
+			&fs.c,                 // graph context
+			path,                  // path
+			0,                     // pathPosition - start at the beginning
+			opts.symlinkRedirects, // linkDepth - symbolic links taken so far
+			true,                  // isWritable - root is always writable
+			opts,                  // traverseOptions
+			whenReached,           // callback
+		)
+
+		// Symbolic links are resolved from the root, traversal is restarted
+		// with the target path. The symbolic link counts as a redirect,
+		// the restarted traversal continues with the remaining budget.
+		var redirect *symlinkRedirect
+		if errors.As(err, &redirect) {
+			if opts.symlinkRedirects >= opts.maxLinkRedirects {
+				return ErrTooManyRedirects
+			}
+			opts.symlinkRedirects++
+			path = redirect.path
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		if !opts.doNotCache {
+			fs.rootEP = changedEntrypoint
+		}
+		return nil
+	}
+}
+
+// wrapMissingKeyError adds information about the path where the key is needed
+// if the error was caused by missing key information, other errors are
+// returned unchanged
+func wrapMissingKeyError(err error, path []string) error {
+	if !errors.Is(err, ErrMissingKeyInfo) {
+		return err
 	}
-	return nil
+	return fmt.Errorf("%w, key needed at path: /%s", err, strings.Join(path, "/"))
 }
@@ -19,27 +19,79 @@ package cinodefs
 import (
 	"bytes"
 	"context"
+	"crypto/sha256"
 	"errors"
 	"fmt"
 	"io"
 
 	"github.com/cinode/go/pkg/blenc"
-	"github.com/cinode/go/pkg/cinodefs/protobuf"
 	"github.com/cinode/go/pkg/common"
+	"golang.org/x/exp/slog"
 	"google.golang.org/protobuf/proto"
 )
 
 var (
 	ErrMissingKeyInfo    = errors.New("missing key info")
 	ErrMissingWriterInfo = errors.New("missing writer info")
+	ErrDirectoryTooLarge = errors.New("directory too large")
 )
 
+// Serialization of protobuf maps (such as entry metadata) must not depend on
+// the iteration order, otherwise the same content would produce different
+// blobs and entrypoints
+var marshalOptions = proto.MarshalOptions{Deterministic: true}
+
 type graphContext struct {
 	// blenc layer used in the graph
 	be blenc.BE
 
 	// known writer info data
 	authInfos map[string]*common.AuthInfo
+
+	// serialized directory size above which dirSizeLimitMode applies,
+	// no limit if 0
+	dirSizeLimit     int64
+	dirSizeLimitMode DirSizeLimitMode
+
+	// maximal number of entries in a single directory blob, directories
+	// with more entries are split into shards, no splitting if 0
+	dirSplitThreshold int
+
+	log *slog.Logger
+
+	// cache of resolved link targets, nil if disabled
+	links *linkCache
+
+	// receiver of tracing spans, nil if disabled
+	tracer Tracer
+}
+
+// checkDirSize ensures the size of the serialized directory blob does not
+// exceed the configured limit
+func (c *graphContext) checkDirSize(size int64, entries int) error {
+	if c.dirSizeLimit <= 0 || size <= c.dirSizeLimit ||
+		c.dirSizeLimitMode != DirSizeLimitError {
+		return nil
+	}
+
+	return fmt.Errorf(
+		"%w: %d bytes (%d entries) exceeds the limit of %d bytes",
+		ErrDirectoryTooLarge, size, entries, c.dirSizeLimit,
+	)
+}
+
+// warnDirSize reports stored directory blob exceeding the configured limit
+func (c *graphContext) warnDirSize(ctx context.Context, ep *Entrypoint, size int64, entries int) {
+	if c.dirSizeLimit <= 0 || size <= c.dirSizeLimit ||
+		!blobIOFromContext(ctx).firstReport("dir-size:"+ep.BlobName().String()) {
+		return
+	}
+
+	c.log.WarnContext(ctx, "directory blob exceeds the size limit",
+		"size", size,
+		"entries", entries,
+		"limit", c.dirSizeLimit,
+	)
 }
 
 // Get symmetric encryption key for given entrypoint.
@@ -63,9 +115,13 @@ func (c *graphContext) getDataReader(
 	ctx context.Context,
 	ep *Entrypoint,
 ) (
-	io.ReadCloser,
-	error,
+	_ io.ReadCloser,
+	err error,
 ) {
+	ctx, span := c.startSpan(ctx, SpanOpenBlob)
+	defer func() { endSpan(span, err) }()
+	span.SetAttribute(AttrBlobName, ep.BlobName().String())
+
 	key, err := c.keyFromEntrypoint(ctx, ep)
 	if err != nil {
 		return nil, err
@@ -83,16 +139,10 @@ func (c *graphContext) readProtobufMessage(
 	ep *Entrypoint,
 	msg proto.Message,
 ) error {
-	rc, err := c.getDataReader(ctx, ep)
+	data, err := c.readBlobData(ctx, ep)
 	if err != nil {
 		return err
 	}
-	defer rc.Close()
-
-	data, err := io.ReadAll(rc)
-	if err != nil {
-		return fmt.Errorf("failed to read blob: %w", err)
-	}
 
 	err = proto.Unmarshal(data, msg)
 	if err != nil {
@@ -102,6 +152,41 @@ func (c *graphContext) readProtobufMessage(
 	return nil
 }
 
+// return raw data of the blob behind entrypoint
+func (c *graphContext) readBlobData(
+	ctx context.Context,
+	ep *Entrypoint,
+) (
+	[]byte,
+	error,
+) {
+	res, err := blobIOFromContext(ctx).do(
+		ctx,
+		"read:"+ep.BlobName().String()+":"+string(ep.ep.GetKeyInfo().GetKey()),
+		func(ctx context.Context) blobIOResult {
+			rc, err := c.getDataReader(ctx, ep)
+			if err != nil {
+				return blobIOResult{err: err}
+			}
+			defer rc.Close()
+
+			data, err := io.ReadAll(rc)
+			if err != nil {
+				return blobIOResult{err: fmt.Errorf("failed to read blob: %w", err)}
+			}
+			return blobIOResult{data: data}
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+	if res.err != nil {
+		return nil, res.err
+	}
+
+	return res.data, nil
+}
+
 func (c *graphContext) createProtobufMessage(
 	ctx context.Context,
 	blobType common.BlobType,
@@ -110,29 +195,45 @@ func (c *graphContext) createProtobufMessage(
 	*Entrypoint,
 	error,
 ) {
-	data, err := proto.Marshal(msg)
+	data, err := marshalOptions.Marshal(msg)
 	if err != nil {
 		return nil, fmt.Errorf("serialization failed: %w", err)
 	}
 
-	bn, key, ai, err := c.be.Create(ctx, blobType, bytes.NewReader(data))
+	return c.createBlob(ctx, blobType, data)
+}
+
+func (c *graphContext) createBlob(
+	ctx context.Context,
+	blobType common.BlobType,
+	data []byte,
+) (
+	*Entrypoint,
+	error,
+) {
+	res, err := blobIOFromContext(ctx).do(
+		ctx,
+		"create:"+string([]byte{blobType.IDByte()})+":"+dataHash(data),
+		func(ctx context.Context) blobIOResult {
+			bn, key, ai, err := c.be.Create(ctx, blobType, bytes.NewReader(data))
+			if err != nil {
+				return blobIOResult{err: fmt.Errorf("write failed: %w", err)}
+			}
+			return blobIOResult{ep: EntrypointFromBlobNameAndKey(bn, key), ai: ai}
+		},
+	)
 	if err != nil {
-		return nil, fmt.Errorf("write failed: %w", err)
+		return nil, err
+	}
+	if res.err != nil {
+		return nil, res.err
 	}
 
-	if ai != nil {
-		c.authInfos[bn.String()] = ai
+	if res.ai != nil {
+		c.authInfos[res.ep.BlobName().String()] = res.ai
 	}
 
-	return &Entrypoint{
-		bn: bn,
-		ep: protobuf.Entrypoint{
-			BlobName: bn.Bytes(),
-			KeyInfo: &protobuf.KeyInfo{
-				Key: key.Bytes(),
-			},
-		},
-	}, nil
+	return res.ep, nil
 }
 
 func (c *graphContext) updateProtobufMessage(
@@ -150,15 +251,35 @@ func (c *graphContext) updateProtobufMessage(
 		return err
 	}
 
-	data, err := proto.Marshal(msg)
+	data, err := marshalOptions.Marshal(msg)
 	if err != nil {
 		return fmt.Errorf("serialization failed: %w", err)
 	}
 
-	err = c.be.Update(ctx, ep.BlobName(), wi, key, bytes.NewReader(data))
+	res, err := blobIOFromContext(ctx).do(
+		ctx,
+		"update:"+ep.BlobName().String()+":"+dataHash(data),
+		func(ctx context.Context) blobIOResult {
+			err := c.be.Update(ctx, ep.BlobName(), wi, key, bytes.NewReader(data))
+
+			// Cached link target is outdated, even if the update failed, the stored
+			// data could still have changed
+			c.links.invalidate(ep.BlobName())
+
+			if err != nil {
+				return blobIOResult{err: fmt.Errorf("write failed: %w", err)}
+			}
+			return blobIOResult{}
+		},
+	)
 	if err != nil {
-		return fmt.Errorf("write failed: %w", err)
+		return err
 	}
 
-	return nil
+	return res.err
+}
+
+func dataHash(data []byte) string {
+	h := sha256.Sum256(data)
+	return string(h[:])
 }
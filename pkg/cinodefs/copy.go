@@ -0,0 +1,161 @@
+/*
+Copyright © 2022 Bartłomiej Święcki (byo)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cinodefs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/cinode/go/pkg/utilities/golang"
+)
+
+var (
+	ErrCantCopyLink = errors.New("dynamic link can not be copied by reference")
+)
+
+// Copy sets the entry at the destination path to the same entrypoint as the
+// entry at the source path. Static blobs are immutable thus both entries
+// share the same data without duplicating it, further changes done to one
+// of the entries do not affect the other one.
+//
+// Dynamic links can not be shared that way, both entries would point to the
+// same link thus changes done through one path would be visible through the
+// other one. ErrCantCopyLink is returned when copying a link or a directory
+// containing a link at any depth, sub-directories of the copied directory
+// are read to find such links. Directories with unsaved changes must be
+// flushed first. An existing entry at the destination path is overwritten,
+// missing parent directories of the destination are created. Symbolic links
+// are copied as they are, the copy points to the same target path.
+func (fs *cinodeFS) Copy(ctx context.Context, from, to []string) error {
+	from, err := validatePath(from)
+	if err != nil {
+		return err
+	}
+	to, err = validatePath(to)
+	if err != nil {
+		return err
+	}
+
+	if len(to) == 0 {
+		return ErrCantDeleteRoot
+	}
+	if slices.Equal(from, to) {
+		return nil
+	}
+
+	// New node is created, in-memory nodes must not be shared
+	// since those are modified in place
+	var copied node
+	err = fs.withLock(ctx, func(ctx context.Context) error {
+		source := fs.rootEP
+		if len(from) > 0 {
+			source, err = fs.findEntryNodeLocked(ctx, from, false)
+			if err != nil {
+				return err
+			}
+		}
+
+		if symlink, isSymlink := source.(*nodeSymlink); isSymlink {
+			copied = &nodeSymlink{target: symlink.target}
+			return nil
+		}
+
+		ep, err := source.entrypoint()
+		if err != nil {
+			return err
+		}
+		if ep.IsLink() {
+			return ErrCantCopyLink
+		}
+		copied = &nodeUnloaded{ep: ep}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if ep, _ := copied.entrypoint(); ep != nil && ep.IsDir() {
+		// Stored directory can not change, it is checked without the lock
+		err = fs.checkNoLinks(ctx, ep, from, map[string]struct{}{})
+		if err != nil {
+			return err
+		}
+	}
+
+	return fs.withLock(ctx, func(ctx context.Context) error {
+		return fs.traverseGraphLocked(
+			ctx,
+			to,
+			traverseOptions{createNodes: true, noFollowSymlink: true},
+			func(_ context.Context, _ node, isWriteable bool) (node, dirtyState, error) {
+				if !isWriteable {
+					return nil, 0, ErrMissingWriterInfo
+				}
+				return copied, dsDirty, nil
+			},
+		)
+	})
+}
+
+// checkNoLinks returns ErrCantCopyLink if the stored directory contains
+// a dynamic link at any depth
+func (fs *cinodeFS) checkNoLinks(
+	ctx context.Context,
+	ep *Entrypoint,
+	path []string,
+	visited map[string]struct{},
+) error {
+	if _, found := visited[ep.BlobName().String()]; found {
+		return nil
+	}
+	visited[ep.BlobName().String()] = struct{}{}
+
+	loaded, err := (&nodeUnloaded{ep: ep}).load(ctx, &fs.c)
+	if err != nil {
+		return err
+	}
+	dir := loaded.(*nodeDirectory)
+	err = dir.loadAllShards(ctx, &fs.c)
+	if err != nil {
+		return err
+	}
+
+	for name, entry := range dir.entries {
+		if _, isSymlink := entry.(*nodeSymlink); isSymlink {
+			continue
+		}
+
+		entryPath := append(slices.Clone(path), name)
+		ep, err := entry.entrypoint()
+		golang.Assert(err == nil, "entries of a stored directory must have entrypoints")
+
+		if ep.IsLink() {
+			return fmt.Errorf("%w: directory contains a link at /%s", ErrCantCopyLink, strings.Join(entryPath, "/"))
+		}
+		if ep.IsDir() {
+			err = fs.checkNoLinks(ctx, ep, entryPath, visited)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
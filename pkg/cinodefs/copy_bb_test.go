@@ -0,0 +1,210 @@
+/*
+Copyright © 2023 Bartłomiej Święcki (byo)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cinodefs_test
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/cinode/go/pkg/blenc"
+	"github.com/cinode/go/pkg/cinodefs"
+	"github.com/cinode/go/pkg/datastore"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCopy(t *testing.T) {
+	ctx := context.Background()
+
+	setFile := func(t *testing.T, fs cinodefs.FS, path, content string, opts ...cinodefs.EntrypointOption) *cinodefs.Entrypoint {
+		ep, err := fs.SetEntryFile(ctx, strings.Split(path, "/"), strings.NewReader(content), opts...)
+		require.NoError(t, err)
+		return ep
+	}
+
+	readFile := func(t *testing.T, fs cinodefs.FS, path string) string {
+		rc, err := fs.OpenEntryData(ctx, strings.Split(path, "/"))
+		require.NoError(t, err)
+		defer rc.Close()
+		data, err := io.ReadAll(rc)
+		require.NoError(t, err)
+		return string(data)
+	}
+
+	newFS := func(t *testing.T) cinodefs.FS {
+		fs, err := cinodefs.New(ctx,
+			blenc.FromDatastore(datastore.InMemory()),
+			cinodefs.NewRootDynamicLink(),
+		)
+		require.NoError(t, err)
+		return fs
+	}
+
+	t.Run("copy file", func(t *testing.T) {
+		fs := newFS(t)
+		ep := setFile(t, fs, "dir/file.bin", "data", cinodefs.SetMimeType("application/x-test"))
+
+		err := fs.Copy(ctx, []string{"dir", "file.bin"}, []string{"other", "copy.txt"})
+		require.NoError(t, err)
+
+		// The same blob is referenced, the mime type is not re-detected
+		copyEP, err := fs.FindEntry(ctx, []string{"other", "copy.txt"})
+		require.NoError(t, err)
+		require.Equal(t, ep.BlobName(), copyEP.BlobName())
+		require.Equal(t, "application/x-test", copyEP.MimeType())
+		require.Equal(t, "data", readFile(t, fs, "other/copy.txt"))
+
+		// Modifying the source does not change the copy
+		setFile(t, fs, "dir/file.bin", "modified")
+		require.NoError(t, fs.Flush(ctx))
+		require.Equal(t, "modified", readFile(t, fs, "dir/file.bin"))
+		require.Equal(t, "data", readFile(t, fs, "other/copy.txt"))
+	})
+
+	t.Run("copy directory", func(t *testing.T) {
+		fs := newFS(t)
+		setFile(t, fs, "dir/a.txt", "a")
+		setFile(t, fs, "dir/sub/b.txt", "b")
+
+		// Unsaved directory content can not be referenced
+		err := fs.Copy(ctx, []string{"dir"}, []string{"copy"})
+		require.ErrorIs(t, err, cinodefs.ErrModifiedDirectory)
+
+		require.NoError(t, fs.Flush(ctx))
+
+		err = fs.Copy(ctx, []string{"dir"}, []string{"copy"})
+		require.NoError(t, err)
+
+		srcEP, err := fs.FindEntry(ctx, []string{"dir"})
+		require.NoError(t, err)
+		copyEP, err := fs.FindEntry(ctx, []string{"copy"})
+		require.NoError(t, err)
+		require.Equal(t, srcEP.BlobName(), copyEP.BlobName())
+
+		// Both directories are modified independently
+		setFile(t, fs, "copy/sub/b.txt", "b2")
+		setFile(t, fs, "dir/c.txt", "c")
+		require.NoError(t, fs.Flush(ctx))
+
+		require.Equal(t, "b", readFile(t, fs, "dir/sub/b.txt"))
+		require.Equal(t, "b2", readFile(t, fs, "copy/sub/b.txt"))
+		require.Equal(t, "a", readFile(t, fs, "copy/a.txt"))
+		_, err = fs.FindEntry(ctx, []string{"copy", "c.txt"})
+		require.ErrorIs(t, err, cinodefs.ErrEntryNotFound)
+	})
+
+	t.Run("overwrite existing entry", func(t *testing.T) {
+		fs := newFS(t)
+		setFile(t, fs, "a.txt", "a")
+		setFile(t, fs, "b.txt", "b")
+
+		err := fs.Copy(ctx, []string{"a.txt"}, []string{"b.txt"})
+		require.NoError(t, err)
+		require.NoError(t, fs.Flush(ctx))
+		require.Equal(t, "a", readFile(t, fs, "a.txt"))
+		require.Equal(t, "a", readFile(t, fs, "b.txt"))
+	})
+
+	t.Run("invalid copies", func(t *testing.T) {
+		fs := newFS(t)
+		setFile(t, fs, "linked/a.txt", "a")
+		setFile(t, fs, "file.txt", "data")
+		_, err := fs.InjectDynamicLink(ctx, []string{"linked"})
+		require.NoError(t, err)
+		require.NoError(t, fs.Flush(ctx))
+
+		err = fs.Copy(ctx, []string{"linked"}, []string{"copy"})
+		require.ErrorIs(t, err, cinodefs.ErrCantCopyLink)
+
+		// Root is a dynamic link too
+		err = fs.Copy(ctx, nil, []string{"copy"})
+		require.ErrorIs(t, err, cinodefs.ErrCantCopyLink)
+
+		err = fs.Copy(ctx, []string{"file.txt"}, nil)
+		require.ErrorIs(t, err, cinodefs.ErrCantDeleteRoot)
+
+		err = fs.Copy(ctx, []string{"missing"}, []string{"copy"})
+		require.ErrorIs(t, err, cinodefs.ErrEntryNotFound)
+
+		err = fs.Copy(ctx, []string{"file.txt", "sub"}, []string{"copy"})
+		require.ErrorIs(t, err, cinodefs.ErrNotADirectory)
+
+		err = fs.Copy(ctx, []string{"file.txt", ""}, []string{"copy"})
+		require.ErrorIs(t, err, cinodefs.ErrEmptyName)
+
+		// Files inside the link can still be copied
+		err = fs.Copy(ctx, []string{"linked", "a.txt"}, []string{"copy.txt"})
+		require.NoError(t, err)
+		require.Equal(t, "a", readFile(t, fs, "copy.txt"))
+
+		// Copying to the same path is a no-op
+		err = fs.Copy(ctx, []string{"file.txt"}, []string{"file.txt"})
+		require.NoError(t, err)
+		require.Equal(t, "data", readFile(t, fs, "file.txt"))
+	})
+
+	t.Run("directory containing a link", func(t *testing.T) {
+		fs := newFS(t)
+		setFile(t, fs, "dir/a.txt", "a")
+		setFile(t, fs, "dir/sub/linked/b.txt", "b")
+		_, err := fs.InjectDynamicLink(ctx, []string{"dir", "sub", "linked"})
+		require.NoError(t, err)
+		require.NoError(t, fs.Flush(ctx))
+
+		// Links are rejected at any depth, the same way as copied links
+		err = fs.Copy(ctx, []string{"dir"}, []string{"copy"})
+		require.ErrorIs(t, err, cinodefs.ErrCantCopyLink)
+		require.ErrorContains(t, err, "/dir/sub/linked")
+		_, err = fs.FindEntry(ctx, []string{"copy"})
+		require.ErrorIs(t, err, cinodefs.ErrEntryNotFound)
+
+		// Parts without links can still be copied
+		err = fs.Copy(ctx, []string{"dir", "sub", "linked", "b.txt"}, []string{"copy", "b.txt"})
+		require.NoError(t, err)
+		require.Equal(t, "b", readFile(t, fs, "copy/b.txt"))
+	})
+
+	t.Run("missing writer info", func(t *testing.T) {
+		be := blenc.FromDatastore(datastore.InMemory())
+		fs, err := cinodefs.New(ctx, be, cinodefs.NewRootDynamicLink())
+		require.NoError(t, err)
+
+		setFile(t, fs, "linked/a.txt", "a")
+		setFile(t, fs, "b.txt", "b")
+		_, err = fs.InjectDynamicLink(ctx, []string{"linked"})
+		require.NoError(t, err)
+		require.NoError(t, fs.Flush(ctx))
+
+		rootWI, err := fs.RootWriterInfo(ctx)
+		require.NoError(t, err)
+
+		// Only the root writer info is known, linked directory is read-only
+		fs2, err := cinodefs.New(ctx, be, cinodefs.RootWriterInfo(rootWI))
+		require.NoError(t, err)
+
+		err = fs2.Copy(ctx, []string{"b.txt"}, []string{"linked", "b.txt"})
+		require.ErrorIs(t, err, cinodefs.ErrMissingWriterInfo)
+		_, err = fs2.FindEntry(ctx, []string{"linked", "b.txt"})
+		require.ErrorIs(t, err, cinodefs.ErrEntryNotFound)
+
+		// Reading from the read-only part is allowed
+		err = fs2.Copy(ctx, []string{"linked", "a.txt"}, []string{"a.txt"})
+		require.NoError(t, err)
+		require.Equal(t, "a", readFile(t, fs2, "a.txt"))
+	})
+}
@@ -0,0 +1,236 @@
+/*
+Copyright © 2023 Bartłomiej Święcki (byo)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cinodefs
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+
+	"github.com/cinode/go/pkg/blenc"
+	"github.com/cinode/go/pkg/common"
+)
+
+// ChangeType describes the kind of change of a single path
+type ChangeType int
+
+const (
+	PathAdded ChangeType = iota + 1
+	PathRemoved
+	PathModified
+)
+
+func (c ChangeType) String() string {
+	switch c {
+	case PathAdded:
+		return "added"
+	case PathRemoved:
+		return "removed"
+	case PathModified:
+		return "modified"
+	}
+	return fmt.Sprintf("ChangeType(%d)", int(c))
+}
+
+// PathChange describes a change of a single path between two dataset versions
+type PathChange struct {
+	Path []string
+	Type ChangeType
+
+	// Old and New entrypoints of the path, Old is nil for added
+	// and New is nil for removed paths, symbolic links have no entrypoint
+	Old *Entrypoint
+	New *Entrypoint
+}
+
+// DiffTrees compares two versions of a dataset and returns the list of paths
+// that differ between them, sorted by the path.
+//
+// Links are followed and entries are compared by their target. Files
+// differ if they point to different blobs - static blobs are content-addressed
+// thus files with the same content are considered equal regardless of other
+// attributes such as the mime type. Directories are compared entry by entry,
+// those with the same blob are skipped without loading. A path that changed
+// its type (e.g. a file replaced with a directory) is reported as modified.
+// Symbolic links are not followed, those differ if their target paths differ.
+//
+// Added or removed directories are reported as a single change,
+// their content is not listed.
+func DiffTrees(
+	ctx context.Context,
+	be blenc.BE,
+	oldRoot *Entrypoint,
+	newRoot *Entrypoint,
+) ([]PathChange, error) {
+	if be == nil {
+		return nil, ErrInvalidBE
+	}
+	if oldRoot == nil || newRoot == nil {
+		return nil, ErrNilEntrypoint
+	}
+
+	d := treeDiff{
+		gc: graphContext{
+			be:        be,
+			authInfos: map[string]*common.AuthInfo{},
+		},
+		changes: []PathChange{},
+	}
+
+	err := d.diff(ctx, []string{}, oldRoot, newRoot)
+	if err != nil {
+		return nil, err
+	}
+
+	return d.changes, nil
+}
+
+type treeDiff struct {
+	gc      graphContext
+	changes []PathChange
+}
+
+func (d *treeDiff) diff(ctx context.Context, path []string, oldEP, newEP *Entrypoint) error {
+	if oldEP.BlobName().Equal(newEP.BlobName()) {
+		// Same blob, for links this also means the same target
+		return nil
+	}
+
+	oldTarget, err := d.resolveLinks(ctx, oldEP)
+	if err != nil {
+		return err
+	}
+	newTarget, err := d.resolveLinks(ctx, newEP)
+	if err != nil {
+		return err
+	}
+
+	if oldTarget.BlobName().Equal(newTarget.BlobName()) {
+		return nil
+	}
+
+	if !oldTarget.IsDir() || !newTarget.IsDir() {
+		d.changes = append(d.changes, PathChange{
+			Path: slices.Clone(path),
+			Type: PathModified,
+			Old:  oldEP,
+			New:  newEP,
+		})
+		return nil
+	}
+
+	oldEntries, oldSymlinks, err := d.loadDir(ctx, oldTarget)
+	if err != nil {
+		return err
+	}
+	newEntries, newSymlinks, err := d.loadDir(ctx, newTarget)
+	if err != nil {
+		return err
+	}
+
+	names := []string{}
+	for _, m := range []map[string]*Entrypoint{oldEntries, newEntries} {
+		names = slices.AppendSeq(names, maps.Keys(m))
+	}
+	for _, m := range []map[string][]string{oldSymlinks, newSymlinks} {
+		names = slices.AppendSeq(names, maps.Keys(m))
+	}
+	slices.Sort(names)
+	names = slices.Compact(names)
+
+	for _, name := range names {
+		entryPath := append(slices.Clone(path), name)
+		oldEntry, newEntry := oldEntries[name], newEntries[name]
+		oldSymlink, newSymlink := oldSymlinks[name], newSymlinks[name]
+
+		switch {
+		case oldEntry == nil && oldSymlink == nil:
+			d.changes = append(d.changes, PathChange{Path: entryPath, Type: PathAdded, New: newEntry})
+		case newEntry == nil && newSymlink == nil:
+			d.changes = append(d.changes, PathChange{Path: entryPath, Type: PathRemoved, Old: oldEntry})
+		case oldSymlink != nil || newSymlink != nil:
+			if !slices.Equal(oldSymlink, newSymlink) {
+				d.changes = append(d.changes, PathChange{
+					Path: entryPath,
+					Type: PathModified,
+					Old:  oldEntry,
+					New:  newEntry,
+				})
+			}
+		default:
+			err := d.diff(ctx, entryPath, oldEntry, newEntry)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (d *treeDiff) resolveLinks(ctx context.Context, ep *Entrypoint) (*Entrypoint, error) {
+	for linkDepth := 0; ep.IsLink(); linkDepth++ {
+		if linkDepth >= DefaultMaxLinksRedirects {
+			return nil, ErrTooManyRedirects
+		}
+
+		loaded, err := (&nodeUnloaded{ep: ep}).loadEntrypointLink(ctx, &d.gc)
+		if err != nil {
+			return nil, err
+		}
+
+		ep, err = loaded.(*nodeLink).target.entrypoint()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return ep, nil
+}
+
+// loadDir returns entrypoints of directory entries and targets of symbolic
+// links stored in the directory
+func (d *treeDiff) loadDir(ctx context.Context, ep *Entrypoint) (
+	map[string]*Entrypoint,
+	map[string][]string,
+	error,
+) {
+	loaded, err := (&nodeUnloaded{ep: ep}).loadEntrypointDir(ctx, &d.gc)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	dir := loaded.(*nodeDirectory)
+	err = dir.loadAllShards(ctx, &d.gc)
+	if err != nil {
+		return nil, nil, err
+	}
+	entries := make(map[string]*Entrypoint, len(dir.entries))
+	symlinks := map[string][]string{}
+	for name, entry := range dir.entries {
+		if symlink, isSymlink := entry.(*nodeSymlink); isSymlink {
+			symlinks[name] = symlink.target
+			continue
+		}
+
+		entries[name], err = entry.entrypoint()
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	return entries, symlinks, nil
+}
@@ -0,0 +1,156 @@
+/*
+Copyright © 2023 Bartłomiej Święcki (byo)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cinodefs_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/cinode/go/pkg/blenc"
+	"github.com/cinode/go/pkg/cinodefs"
+	"github.com/cinode/go/pkg/datastore"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiffTrees(t *testing.T) {
+	ctx := context.Background()
+	be := blenc.FromDatastore(datastore.InMemory())
+	fs, err := cinodefs.New(ctx, be, cinodefs.NewRootStaticDirectory())
+	require.NoError(t, err)
+
+	setFile := func(path string, content string) {
+		_, err := fs.SetEntryFile(ctx, strings.Split(path, "/"), strings.NewReader(content))
+		require.NoError(t, err)
+	}
+	snapshot := func() *cinodefs.Entrypoint {
+		require.NoError(t, fs.Flush(ctx))
+		ep, err := fs.RootEntrypoint()
+		require.NoError(t, err)
+		return ep
+	}
+	type change struct {
+		path string
+		tp   cinodefs.ChangeType
+	}
+	diff := func(oldRoot, newRoot *cinodefs.Entrypoint) []change {
+		changes, err := cinodefs.DiffTrees(ctx, be, oldRoot, newRoot)
+		require.NoError(t, err)
+
+		ret := []change{}
+		for _, c := range changes {
+			require.Equal(t, c.Type != cinodefs.PathAdded, c.Old != nil)
+			require.Equal(t, c.Type != cinodefs.PathRemoved, c.New != nil)
+			ret = append(ret, change{strings.Join(c.Path, "/"), c.Type})
+		}
+		return ret
+	}
+
+	setFile("a.txt", "a")
+	setFile("dir/b.txt", "b")
+	setFile("dir/c.txt", "c")
+	setFile("unchanged/d.txt", "d")
+	root1 := snapshot()
+
+	require.NoError(t, fs.DeleteEntry(ctx, []string{"a.txt"}))
+	setFile("dir/b.txt", "b modified")
+	setFile("dir/new.txt", "new")
+	root2 := snapshot()
+
+	t.Run("added, removed and modified", func(t *testing.T) {
+		require.Equal(t, []change{
+			{"a.txt", cinodefs.PathRemoved},
+			{"dir/b.txt", cinodefs.PathModified},
+			{"dir/new.txt", cinodefs.PathAdded},
+		}, diff(root1, root2))
+
+		require.Equal(t, []change{
+			{"a.txt", cinodefs.PathAdded},
+			{"dir/b.txt", cinodefs.PathModified},
+			{"dir/new.txt", cinodefs.PathRemoved},
+		}, diff(root2, root1))
+	})
+
+	t.Run("identical trees", func(t *testing.T) {
+		require.Empty(t, diff(root1, root1))
+	})
+
+	t.Run("same content is not a change", func(t *testing.T) {
+		setFile("dir/b.txt", "b")
+		setFile("dir/new.txt", "b")
+		root3 := snapshot()
+
+		require.Equal(t, []change{
+			{"a.txt", cinodefs.PathRemoved},
+			{"dir/new.txt", cinodefs.PathAdded},
+		}, diff(root1, root3))
+	})
+
+	t.Run("type change", func(t *testing.T) {
+		require.NoError(t, fs.DeleteEntry(ctx, []string{"dir"}))
+		setFile("dir", "now a file")
+		setFile("new-dir/file.txt", "file")
+		root4 := snapshot()
+
+		require.Equal(t, []change{
+			{"a.txt", cinodefs.PathRemoved},
+			{"dir", cinodefs.PathModified},
+			{"new-dir", cinodefs.PathAdded},
+		}, diff(root1, root4))
+	})
+
+	t.Run("links are compared by target", func(t *testing.T) {
+		linkedFS, err := cinodefs.New(ctx, be, cinodefs.NewRootDynamicLink())
+		require.NoError(t, err)
+		for _, path := range []string{"dir/b.txt", "dir/c.txt", "unchanged/d.txt"} {
+			_, err := linkedFS.SetEntryFile(ctx, strings.Split(path, "/"), strings.NewReader(path[len(path)-5:len(path)-4]))
+			require.NoError(t, err)
+		}
+		_, err = linkedFS.InjectDynamicLink(ctx, []string{"unchanged"})
+		require.NoError(t, err)
+		require.NoError(t, linkedFS.Flush(ctx))
+		linkRoot, err := linkedFS.RootEntrypoint()
+		require.NoError(t, err)
+		require.True(t, linkRoot.IsLink())
+
+		require.Equal(t, []change{
+			{"a.txt", cinodefs.PathRemoved},
+		}, diff(root1, linkRoot))
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		_, err := cinodefs.DiffTrees(ctx, nil, root1, root2)
+		require.ErrorIs(t, err, cinodefs.ErrInvalidBE)
+
+		_, err = cinodefs.DiffTrees(ctx, be, nil, root2)
+		require.ErrorIs(t, err, cinodefs.ErrNilEntrypoint)
+
+		_, err = cinodefs.DiffTrees(ctx, be, root1, nil)
+		require.ErrorIs(t, err, cinodefs.ErrNilEntrypoint)
+
+		otherBE := blenc.FromDatastore(datastore.InMemory())
+		_, err = cinodefs.DiffTrees(ctx, otherBE, root1, root2)
+		require.ErrorIs(t, err, cinodefs.ErrCantOpenDir)
+	})
+
+	t.Run("change type names", func(t *testing.T) {
+		require.Equal(t, "added", cinodefs.PathAdded.String())
+		require.Equal(t, "removed", cinodefs.PathRemoved.String())
+		require.Equal(t, "modified", cinodefs.PathModified.String())
+		require.Equal(t, "ChangeType(0)", cinodefs.ChangeType(0).String())
+	})
+}
@@ -0,0 +1,51 @@
+/*
+Copyright © 2023 Bartłomiej Święcki (byo)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cinodefs
+
+import (
+	"context"
+	"time"
+)
+
+// DirEntry contains information about a single directory entry
+type DirEntry struct {
+	Name       string
+	IsDir      bool
+	IsLink     bool
+	IsSymlink  bool
+	MimeType   string
+	ModTime    time.Time
+	SortWeight int64
+}
+
+// ListDir returns entries of the directory at given path, by default
+// sorted by name.
+//
+// The listing reflects the current state of the directory, including
+// modifications that were not yet flushed.
+func (fs *cinodeFS) ListDir(ctx context.Context, path []string, opts ...ListOption) ([]DirEntry, error) {
+	entries, err := fs.walkDir(ctx, path, listOptionsFrom(opts))
+	if err != nil {
+		return nil, err
+	}
+
+	ret := make([]DirEntry, len(entries))
+	for i := range entries {
+		ret[i] = entries[i].DirEntry
+	}
+	return ret, nil
+}
@@ -0,0 +1,90 @@
+/*
+Copyright © 2023 Bartłomiej Święcki (byo)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cinodefs_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/cinode/go/pkg/blenc"
+	"github.com/cinode/go/pkg/cinodefs"
+	"github.com/cinode/go/pkg/datastore"
+	"github.com/stretchr/testify/require"
+)
+
+func TestListDir(t *testing.T) {
+	ctx := context.Background()
+	be := blenc.FromDatastore(datastore.InMemory())
+	fs, err := cinodefs.New(ctx, be, cinodefs.NewRootDynamicLink())
+	require.NoError(t, err)
+
+	_, err = fs.SetEntryFile(ctx, []string{"b.txt"}, strings.NewReader("b"))
+	require.NoError(t, err)
+	_, err = fs.SetEntryFile(ctx, []string{"a", "file.html"}, strings.NewReader("a"))
+	require.NoError(t, err)
+	_, err = fs.SetEntryFile(ctx, []string{"c", "file.txt"}, strings.NewReader("c"))
+	require.NoError(t, err)
+	_, err = fs.InjectDynamicLink(ctx, []string{"c"})
+	require.NoError(t, err)
+
+	expected := []cinodefs.DirEntry{
+		{Name: "a", IsDir: true, MimeType: cinodefs.CinodeDirMimeType},
+		{Name: "b.txt", MimeType: "text/plain; charset=utf-8"},
+		{Name: "c", IsLink: true},
+	}
+
+	t.Run("unflushed directory", func(t *testing.T) {
+		entries, err := fs.ListDir(ctx, []string{})
+		require.NoError(t, err)
+		require.Equal(t, expected, entries)
+	})
+
+	require.NoError(t, fs.Flush(ctx))
+
+	t.Run("flushed directory", func(t *testing.T) {
+		entries, err := fs.ListDir(ctx, []string{})
+		require.NoError(t, err)
+		require.Equal(t, expected, entries)
+	})
+
+	t.Run("directory read from datastore", func(t *testing.T) {
+		wi, err := fs.RootWriterInfo(ctx)
+		require.NoError(t, err)
+
+		fs2, err := cinodefs.New(ctx, be, cinodefs.RootWriterInfo(wi))
+		require.NoError(t, err)
+
+		entries, err := fs2.ListDir(ctx, []string{})
+		require.NoError(t, err)
+		require.Equal(t, expected, entries)
+
+		entries, err = fs2.ListDir(ctx, []string{"c"})
+		require.NoError(t, err)
+		require.Equal(t, []cinodefs.DirEntry{
+			{Name: "file.txt", MimeType: "text/plain; charset=utf-8"},
+		}, entries)
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		_, err := fs.ListDir(ctx, []string{"b.txt"})
+		require.ErrorIs(t, err, cinodefs.ErrNotADirectory)
+
+		_, err = fs.ListDir(ctx, []string{"missing"})
+		require.ErrorIs(t, err, cinodefs.ErrEntryNotFound)
+	})
+}
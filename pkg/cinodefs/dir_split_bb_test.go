@@ -0,0 +1,359 @@
+/*
+Copyright © 2022 Bartłomiej Święcki (byo)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cinodefs_test
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/cinode/go/pkg/blenc"
+	"github.com/cinode/go/pkg/cinodefs"
+	"github.com/cinode/go/pkg/cinodefs/protobuf"
+	"github.com/cinode/go/pkg/common"
+	"github.com/cinode/go/pkg/datastore"
+	"github.com/cinode/go/pkg/utilities/golang"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestDirSplitThreshold(t *testing.T) {
+	ctx := context.Background()
+
+	countBlobs := func(t *testing.T, ds datastore.DS) int {
+		count := 0
+		for _, err := range ds.List(ctx) {
+			require.NoError(t, err)
+			count++
+		}
+		return count
+	}
+
+	entryName := func(i int) string { return fmt.Sprintf("file%04d.txt", i) }
+	entryMimeType := func(i int) string { return fmt.Sprintf("text/x-test-%d", i%7) }
+
+	const entriesCount = 500
+
+	setup := func(t *testing.T) (datastore.DS, cinodefs.FS) {
+		ds := datastore.InMemory()
+		fs, err := cinodefs.New(ctx,
+			blenc.FromDatastore(ds),
+			cinodefs.NewRootStaticDirectory(),
+			cinodefs.DirSplitThreshold(8),
+		)
+		require.NoError(t, err)
+
+		for i := 0; i < entriesCount; i++ {
+			_, err := fs.SetEntryFile(ctx,
+				[]string{"dir", entryName(i)},
+				strings.NewReader(entryName(i)),
+				cinodefs.SetMimeType(entryMimeType(i)),
+			)
+			require.NoError(t, err)
+		}
+		require.NoError(t, fs.Flush(ctx))
+		return ds, fs
+	}
+
+	reopen := func(t *testing.T, ds datastore.DS, fs cinodefs.FS, opts ...cinodefs.Option) cinodefs.FS {
+		// Reading split directories does not depend on the split threshold
+		rootEP, err := fs.RootEntrypoint()
+		require.NoError(t, err)
+		fs2, err := cinodefs.New(ctx, blenc.FromDatastore(ds), append(opts, cinodefs.RootEntrypoint(rootEP))...)
+		require.NoError(t, err)
+		return fs2
+	}
+
+	t.Run("invalid threshold", func(t *testing.T) {
+		for _, threshold := range []int{-1, 0, 3} {
+			_, err := cinodefs.New(ctx,
+				blenc.FromDatastore(datastore.InMemory()),
+				cinodefs.NewRootStaticDirectory(),
+				cinodefs.DirSplitThreshold(threshold),
+			)
+			require.ErrorIs(t, err, cinodefs.ErrInvalidDirSplitThreshold)
+		}
+	})
+
+	t.Run("round trip", func(t *testing.T) {
+		ds, fs := setup(t)
+
+		// Entries, file blobs and directories are not enough to account
+		// for all blobs, the rest are shards of the split directory
+		require.Greater(t, countBlobs(t, ds), entriesCount+2+entriesCount/8)
+
+		fs2 := reopen(t, ds, fs)
+		entries, err := fs2.ListDir(ctx, []string{"dir"})
+		require.NoError(t, err)
+		require.Len(t, entries, entriesCount)
+		for i, e := range entries {
+			require.Equal(t, entryName(i), e.Name)
+			require.Equal(t, entryMimeType(i), e.MimeType)
+			require.False(t, e.IsDir)
+		}
+
+		data, err := fs2.OpenEntryDataPrefix(ctx, []string{"dir", entryName(123)}, 100)
+		require.NoError(t, err)
+		require.Equal(t, entryName(123), string(data))
+	})
+
+	t.Run("all blobs are reachable", func(t *testing.T) {
+		ds, fs := setup(t)
+		rootEP, err := fs.RootEntrypoint()
+		require.NoError(t, err)
+
+		be := blenc.FromDatastore(ds)
+		require.NoError(t, cinodefs.VerifyReachable(ctx, be, rootEP, 10))
+
+		reachable, err := cinodefs.ReachableBlobs(ctx, be, rootEP, 10)
+		require.NoError(t, err)
+		require.Len(t, reachable, countBlobs(t, ds))
+
+		// Path lookup fetches only shards covering the name - root and
+		// directory blobs, shards along the path and the file itself
+		blobs, err := cinodefs.BlobsForPath(ctx, reopen(t, ds, fs), []string{"dir", entryName(0)})
+		require.NoError(t, err)
+		require.Greater(t, len(blobs), 3)
+		require.Less(t, len(blobs), 10)
+	})
+
+	t.Run("names are resolved lazily", func(t *testing.T) {
+		ds, fs := setup(t)
+		counting := &countingDatastore{DS: ds}
+		fs2 := reopen(t, counting, fs)
+
+		ep, err := fs2.FindEntry(ctx, []string{"dir", entryName(321)})
+		require.NoError(t, err)
+		require.Equal(t, entryMimeType(321), ep.MimeType())
+		require.Less(t, int(counting.opens.Load()), 10)
+
+		_, err = fs2.FindEntry(ctx, []string{"dir", entryName(321) + "-missing"})
+		require.ErrorIs(t, err, cinodefs.ErrEntryNotFound)
+
+		entries, err := fs2.ListDir(ctx, []string{"dir"})
+		require.NoError(t, err)
+		require.Len(t, entries, entriesCount)
+		require.Greater(t, int(counting.opens.Load()), entriesCount/8)
+	})
+
+	t.Run("flush rewrites only modified shards", func(t *testing.T) {
+		ds, fs := setup(t)
+		counting := &countingDatastore{DS: ds}
+		fs2 := reopen(t, counting, fs, cinodefs.DirSplitThreshold(8))
+
+		_, err := fs2.SetEntryFile(ctx, []string{"dir", entryName(250)}, strings.NewReader("modified"))
+		require.NoError(t, err)
+		require.NoError(t, fs2.Flush(ctx))
+
+		// New file, root and directory blobs and shards along the path
+		require.Less(t, int(counting.updates.Load()), 10)
+
+		entries, err := reopen(t, ds, fs2).ListDir(ctx, []string{"dir"})
+		require.NoError(t, err)
+		require.Len(t, entries, entriesCount)
+
+		data, err := reopen(t, ds, fs2).OpenEntryDataPrefix(ctx, []string{"dir", entryName(250)}, 100)
+		require.NoError(t, err)
+		require.Equal(t, "modified", string(data))
+
+		// Split directory does not depend on the history of changes
+		_, err = fs2.SetEntryFile(ctx, []string{"dir", entryName(250)},
+			strings.NewReader(entryName(250)),
+			cinodefs.SetMimeType(entryMimeType(250)),
+		)
+		require.NoError(t, err)
+		require.NoError(t, fs2.Flush(ctx))
+
+		ep1, err := fs.RootEntrypoint()
+		require.NoError(t, err)
+		ep2, err := fs2.RootEntrypoint()
+		require.NoError(t, err)
+		require.Equal(t, ep1.BlobName().String(), ep2.BlobName().String())
+	})
+
+	t.Run("modification rewrites few shards", func(t *testing.T) {
+		ds, fs := setup(t)
+		before := countBlobs(t, ds)
+
+		_, err := fs.SetEntryFile(ctx, []string{"dir", entryName(250) + "-new"}, strings.NewReader("new"))
+		require.NoError(t, err)
+		require.NoError(t, fs.Flush(ctx))
+
+		// New file, root and directory blobs and shards along the path,
+		// the directory is split into more than a hundred shards
+		require.Less(t, countBlobs(t, ds)-before, 20)
+
+		require.NoError(t, fs.DeleteEntry(ctx, []string{"dir", entryName(100)}))
+		require.NoError(t, fs.Flush(ctx))
+
+		entries, err := reopen(t, ds, fs).ListDir(ctx, []string{"dir"})
+		require.NoError(t, err)
+		require.Len(t, entries, entriesCount)
+
+		names := map[string]bool{}
+		for _, e := range entries {
+			names[e.Name] = true
+		}
+		require.True(t, names[entryName(250)+"-new"])
+		require.False(t, names[entryName(100)])
+	})
+
+	t.Run("small directory is not split", func(t *testing.T) {
+		ds := datastore.InMemory()
+		fs, err := cinodefs.New(ctx,
+			blenc.FromDatastore(ds),
+			cinodefs.NewRootStaticDirectory(),
+			cinodefs.DirSplitThreshold(8),
+		)
+		require.NoError(t, err)
+
+		for i := 0; i < 8; i++ {
+			_, err := fs.SetEntryFile(ctx, []string{entryName(i)}, strings.NewReader(entryName(i)))
+			require.NoError(t, err)
+		}
+		require.NoError(t, fs.Flush(ctx))
+
+		// Files and the root directory
+		require.Equal(t, 9, countBlobs(t, ds))
+	})
+
+	t.Run("reserved mime type", func(t *testing.T) {
+		fs, err := cinodefs.New(ctx,
+			blenc.FromDatastore(datastore.InMemory()),
+			cinodefs.NewRootStaticDirectory(),
+		)
+		require.NoError(t, err)
+
+		_, err = fs.SetEntryFile(ctx, []string{"file"}, strings.NewReader("data"))
+		require.NoError(t, err)
+
+		err = fs.SetEntryMimeType(ctx, []string{"file"}, cinodefs.CinodeDirShardMimeType)
+		require.ErrorIs(t, err, cinodefs.ErrInvalidMimeType)
+
+		_, err = fs.SetEntryFile(ctx, []string{"file2"}, strings.NewReader("data"),
+			cinodefs.SetMimeType(cinodefs.CinodeDirShardMimeType),
+		)
+		require.NoError(t, err)
+
+		err = fs.Flush(ctx)
+		require.ErrorIs(t, err, cinodefs.ErrInvalidMimeType)
+	})
+
+	t.Run("invalid shards", func(t *testing.T) {
+		ds := datastore.InMemory()
+		be := blenc.FromDatastore(ds)
+		fs, err := cinodefs.New(ctx, be, cinodefs.NewRootStaticDirectory())
+		require.NoError(t, err)
+
+		fileEP, err := fs.SetEntryFile(ctx, []string{"file"}, strings.NewReader("data"))
+		require.NoError(t, err)
+		fileProto := &protobuf.Entrypoint{}
+		require.NoError(t, proto.Unmarshal(fileEP.Bytes(), fileProto))
+
+		storeDir := func(entries ...*protobuf.Directory_Entry) *protobuf.Entrypoint {
+			data := golang.Must(proto.Marshal(&protobuf.Directory{Entries: entries}))
+			ep, err := fs.SetEntryFile(ctx, []string{"tmp"}, strings.NewReader(string(data)))
+			require.NoError(t, err)
+			require.NoError(t, fs.DeleteEntry(ctx, []string{"tmp"}))
+
+			ret := &protobuf.Entrypoint{}
+			require.NoError(t, proto.Unmarshal(ep.Bytes(), ret))
+			ret.MimeType = cinodefs.CinodeDirShardMimeType
+			return ret
+		}
+
+		shard := storeDir(&protobuf.Directory_Entry{Name: "a", Ep: fileProto})
+		emptyShard := storeDir()
+		shardB := storeDir(&protobuf.Directory_Entry{Name: "b", Ep: fileProto})
+		shardBD := storeDir(
+			&protobuf.Directory_Entry{Name: "b", Ep: fileProto},
+			&protobuf.Directory_Entry{Name: "d", Ep: fileProto},
+		)
+
+		for _, d := range []struct {
+			desc    string
+			entries []*protobuf.Directory_Entry
+		}{
+			{"mixed entries", []*protobuf.Directory_Entry{
+				{Name: "a", Ep: shard},
+				{Name: "b", Ep: fileProto},
+			}},
+			{"empty shard", []*protobuf.Directory_Entry{
+				{Name: "a", Ep: emptyShard},
+			}},
+			{"shard name mismatch", []*protobuf.Directory_Entry{
+				{Name: "b", Ep: shard},
+			}},
+			{"unsorted shards", []*protobuf.Directory_Entry{
+				{Name: "b", Ep: shardB},
+				{Name: "a", Ep: shard},
+			}},
+			{"entry outside of the shard", []*protobuf.Directory_Entry{
+				{Name: "b", Ep: shardBD},
+				{Name: "c", Ep: shardB},
+			}},
+		} {
+			t.Run(d.desc, func(t *testing.T) {
+				data := golang.Must(proto.Marshal(&protobuf.Directory{Entries: d.entries}))
+				_, err := fs.SetEntryFile(ctx, []string{"dir"}, strings.NewReader(string(data)),
+					cinodefs.SetMimeType(cinodefs.CinodeDirMimeType),
+				)
+				require.NoError(t, err)
+
+				// Name covered by the first shard
+				_, err = fs.FindEntry(ctx, []string{"dir", "b"})
+				require.ErrorIs(t, err, cinodefs.ErrCantOpenDir)
+				require.ErrorIs(t, err, cinodefs.ErrInvalidDirShard)
+
+				require.NoError(t, fs.DeleteEntry(ctx, []string{"dir"}))
+			})
+		}
+
+		t.Run("valid shard", func(t *testing.T) {
+			data := golang.Must(proto.Marshal(&protobuf.Directory{Entries: []*protobuf.Directory_Entry{
+				{Name: "a", Ep: shard},
+			}}))
+			_, err := fs.SetEntryFile(ctx, []string{"dir"}, strings.NewReader(string(data)),
+				cinodefs.SetMimeType(cinodefs.CinodeDirMimeType),
+			)
+			require.NoError(t, err)
+
+			ep, err := fs.FindEntry(ctx, []string{"dir", "a"})
+			require.NoError(t, err)
+			require.True(t, ep.BlobName().Equal(fileEP.BlobName()))
+		})
+	})
+}
+
+type countingDatastore struct {
+	datastore.DS
+	opens   atomic.Int32
+	updates atomic.Int32
+}
+
+func (c *countingDatastore) Open(ctx context.Context, name *common.BlobName) (io.ReadCloser, error) {
+	c.opens.Add(1)
+	return c.DS.Open(ctx, name)
+}
+
+func (c *countingDatastore) Update(ctx context.Context, name *common.BlobName, r io.Reader) error {
+	c.updates.Add(1)
+	return c.DS.Update(ctx, name, r)
+}
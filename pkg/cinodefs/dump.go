@@ -0,0 +1,111 @@
+/*
+Copyright © 2023 Bartłomiej Święcki (byo)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cinodefs
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+var (
+	ErrDumpNotSupported = errors.New("tree dump not supported for given filesystem")
+)
+
+// DumpTree writes a human-readable representation of the in-memory node tree
+// of given filesystem. Each node is printed with its type, dirty state and
+// blob name if the node is not dirty. Nodes that were not yet loaded from the
+// datastore are printed without children.
+//
+// The tree is only read, no data is loaded from the datastore. The dump is
+// taken with the filesystem lock held thus it can be done while other
+// operations are running.
+//
+// This function is meant for debugging and tests only, the output format
+// is not stable.
+func DumpTree(fs FS, w io.Writer) error {
+	cfs, ok := fs.(*cinodeFS)
+	if !ok {
+		return fmt.Errorf("%w: %T", ErrDumpNotSupported, fs)
+	}
+
+	cfs.lock.Lock()
+	sb := strings.Builder{}
+	dumpNode(&sb, "/", cfs.rootEP, 0)
+	cfs.lock.Unlock()
+
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+func dumpNode(sb *strings.Builder, name string, n node, depth int) {
+	indent := strings.Repeat("  ", depth)
+
+	var nodeType string
+	var children []string
+	var childNodes map[string]node
+	switch n := n.(type) {
+	case *nodeUnloaded:
+		nodeType = "unloaded"
+	case *nodeFile:
+		nodeType = "file"
+	case *nodeDirectory:
+		nodeType = "directory"
+		if len(n.pending) > 0 {
+			nodeType = fmt.Sprintf("directory, %d unloaded shards", len(n.pending))
+		}
+		childNodes = n.entries
+		for name := range n.entries {
+			children = append(children, name)
+		}
+		sort.Strings(children)
+	case *nodeLink:
+		nodeType = "link"
+		childNodes = map[string]node{"->": n.target}
+		children = []string{"->"}
+	case *nodeSymlink:
+		nodeType = "symlink -> /" + strings.Join(n.target, "/")
+	default:
+		nodeType = fmt.Sprintf("%T", n)
+	}
+
+	fmt.Fprintf(sb, "%s%s: %s [%s]", indent, name, nodeType, dirtyStateName(n.dirty()))
+	if n.dirty() != dsDirty {
+		if ep, err := n.entrypoint(); err == nil && ep != nil {
+			fmt.Fprintf(sb, " %s", ep.BlobName())
+		}
+	}
+	sb.WriteString("\n")
+
+	for _, child := range children {
+		dumpNode(sb, child, childNodes[child], depth+1)
+	}
+}
+
+func dirtyStateName(ds dirtyState) string {
+	switch ds {
+	case dsClean:
+		return "clean"
+	case dsDirty:
+		return "dirty"
+	case dsSubDirty:
+		return "sub-dirty"
+	}
+	return fmt.Sprintf("unknown(%d)", ds)
+}
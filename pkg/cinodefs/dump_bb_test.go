@@ -0,0 +1,92 @@
+/*
+Copyright © 2023 Bartłomiej Święcki (byo)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cinodefs_test
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/cinode/go/pkg/blenc"
+	"github.com/cinode/go/pkg/cinodefs"
+	"github.com/cinode/go/pkg/datastore"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDumpTree(t *testing.T) {
+	ctx := context.Background()
+	be := blenc.FromDatastore(datastore.InMemory())
+	fs, err := cinodefs.New(ctx, be, cinodefs.NewRootDynamicLink())
+	require.NoError(t, err)
+
+	dump := func(t *testing.T) string {
+		buf := bytes.NewBuffer(nil)
+		err := cinodefs.DumpTree(fs, buf)
+		require.NoError(t, err)
+		return buf.String()
+	}
+
+	fileEP, err := fs.SetEntryFile(ctx, []string{"dir", "file.txt"}, strings.NewReader("hello"))
+	require.NoError(t, err)
+
+	rootEP, err := fs.RootEntrypoint()
+	require.NoError(t, err)
+
+	t.Run("dirty nodes after setting a file", func(t *testing.T) {
+		require.Equal(t,
+			"/: link [sub-dirty] "+rootEP.BlobName().String()+"\n"+
+				"  ->: directory [dirty]\n"+
+				"    dir: directory [dirty]\n"+
+				"      file.txt: unloaded [clean] "+fileEP.BlobName().String()+"\n",
+			dump(t),
+		)
+	})
+
+	require.NoError(t, fs.Flush(ctx))
+
+	t.Run("clean nodes after flush", func(t *testing.T) {
+		require.Equal(t,
+			"/: unloaded [clean] "+rootEP.BlobName().String()+"\n",
+			dump(t),
+		)
+	})
+
+	t.Run("dump concurrently with reads", func(t *testing.T) {
+		wg := sync.WaitGroup{}
+		for i := 0; i < 4; i++ {
+			wg.Add(2)
+			go func() {
+				defer wg.Done()
+				_, err := fs.FindEntry(ctx, []string{"dir", "file.txt"})
+				require.NoError(t, err)
+			}()
+			go func() {
+				defer wg.Done()
+				err := cinodefs.DumpTree(fs, &bytes.Buffer{})
+				require.NoError(t, err)
+			}()
+		}
+		wg.Wait()
+	})
+
+	t.Run("unsupported filesystem", func(t *testing.T) {
+		err := cinodefs.DumpTree(nil, &bytes.Buffer{})
+		require.ErrorIs(t, err, cinodefs.ErrDumpNotSupported)
+	})
+}
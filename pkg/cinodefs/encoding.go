@@ -0,0 +1,113 @@
+/*
+Copyright © 2022 Bartłomiej Święcki (byo)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cinodefs
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/jbenet/go-base58"
+)
+
+var (
+	ErrInvalidEncodingAlphabet = errors.New("invalid encoding alphabet")
+)
+
+const (
+	// Base58 alphabets used by different ecosystems
+	Base58AlphabetBitcoin = base58.BTCAlphabet
+	Base58AlphabetFlickr  = base58.FlickrAlphabet
+	Base58AlphabetRipple  = "rpshnaf39wBUDNEGHJKLM4PQRST7VWXYZ2bcdeCg65jkm8oFqi1tuvAxyz"
+)
+
+// Encoding converts entrypoints and writer infos to and from strings using
+// base58 encoding with a specific alphabet. Strings produced with one
+// alphabet can only be parsed with the same one.
+type Encoding struct {
+	alphabet string
+}
+
+// DefaultEncoding is the encoding used by String methods and by
+// EntrypointFromString and WriterInfoFromString functions
+var DefaultEncoding = Encoding{alphabet: Base58AlphabetBitcoin}
+
+// EncodingAlphabet returns the encoding using given base58 alphabet,
+// the alphabet must consist of 58 distinct ASCII characters
+func EncodingAlphabet(alphabet string) (Encoding, error) {
+	if len(alphabet) != 58 {
+		return Encoding{}, fmt.Errorf("%w: expected 58 characters, got %d", ErrInvalidEncodingAlphabet, len(alphabet))
+	}
+
+	seen := map[rune]struct{}{}
+	for _, c := range alphabet {
+		if c > 0x7F {
+			return Encoding{}, fmt.Errorf("%w: non-ASCII character", ErrInvalidEncodingAlphabet)
+		}
+		if _, found := seen[c]; found {
+			return Encoding{}, fmt.Errorf("%w: duplicated character '%c'", ErrInvalidEncodingAlphabet, c)
+		}
+		seen[c] = struct{}{}
+	}
+
+	return Encoding{alphabet: alphabet}, nil
+}
+
+func (e Encoding) encode(b []byte) string {
+	return base58.EncodeAlphabet(b, e.alphabet)
+}
+
+func (e Encoding) decode(s string) []byte {
+	return base58.DecodeAlphabet(s, e.alphabet)
+}
+
+// EntrypointString returns the string representation of the entrypoint
+func (e Encoding) EntrypointString(ep *Entrypoint) string {
+	return e.encode(ep.Bytes())
+}
+
+// EntrypointFromString parses the entrypoint string representation
+func (e Encoding) EntrypointFromString(s string) (*Entrypoint, error) {
+	if len(s) == 0 {
+		return nil, fmt.Errorf("%w: empty string", ErrInvalidEntrypointData)
+	}
+
+	b := e.decode(s)
+	if len(b) == 0 {
+		return nil, fmt.Errorf("%w: not a base58 string", ErrInvalidEntrypointData)
+	}
+
+	return EntrypointFromBytes(b)
+}
+
+// WriterInfoString returns the string representation of the writer info
+func (e Encoding) WriterInfoString(wi *WriterInfo) string {
+	return e.encode(wi.Bytes())
+}
+
+// WriterInfoFromString parses the writer info string representation
+func (e Encoding) WriterInfoFromString(s string) (*WriterInfo, error) {
+	if len(s) == 0 {
+		return nil, fmt.Errorf("%w: empty string", ErrInvalidWriterInfoData)
+	}
+
+	b := e.decode(s)
+	if len(b) == 0 {
+		return nil, fmt.Errorf("%w: not a base58 string", ErrInvalidWriterInfoData)
+	}
+
+	return WriterInfoFromBytes(b)
+}
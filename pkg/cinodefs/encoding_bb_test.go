@@ -0,0 +1,100 @@
+/*
+Copyright © 2022 Bartłomiej Święcki (byo)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cinodefs_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/cinode/go/pkg/blenc"
+	"github.com/cinode/go/pkg/cinodefs"
+	"github.com/cinode/go/pkg/datastore"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEncodingAlphabet(t *testing.T) {
+	ctx := context.Background()
+	fs, err := cinodefs.New(ctx,
+		blenc.FromDatastore(datastore.InMemory()),
+		cinodefs.NewRootDynamicLink(),
+	)
+	require.NoError(t, err)
+
+	ep, err := fs.SetEntryFile(ctx, []string{"file.txt"}, strings.NewReader("hello"))
+	require.NoError(t, err)
+	wi, err := fs.RootWriterInfo(ctx)
+	require.NoError(t, err)
+
+	t.Run("default encoding is unchanged", func(t *testing.T) {
+		bitcoin, err := cinodefs.EncodingAlphabet(cinodefs.Base58AlphabetBitcoin)
+		require.NoError(t, err)
+
+		require.Equal(t, ep.String(), cinodefs.DefaultEncoding.EntrypointString(ep))
+		require.Equal(t, ep.String(), bitcoin.EntrypointString(ep))
+		require.Equal(t, wi.String(), cinodefs.DefaultEncoding.WriterInfoString(wi))
+		require.Equal(t, wi.String(), bitcoin.WriterInfoString(wi))
+	})
+
+	for _, alphabet := range []string{
+		cinodefs.Base58AlphabetFlickr,
+		cinodefs.Base58AlphabetRipple,
+	} {
+		t.Run(alphabet, func(t *testing.T) {
+			enc, err := cinodefs.EncodingAlphabet(alphabet)
+			require.NoError(t, err)
+
+			epStr := enc.EntrypointString(ep)
+			require.NotEqual(t, ep.String(), epStr)
+
+			ep2, err := enc.EntrypointFromString(epStr)
+			require.NoError(t, err)
+			require.Equal(t, ep.Bytes(), ep2.Bytes())
+
+			wiStr := enc.WriterInfoString(wi)
+			require.NotEqual(t, wi.String(), wiStr)
+
+			wi2, err := enc.WriterInfoFromString(wiStr)
+			require.NoError(t, err)
+			require.Equal(t, wi.Bytes(), wi2.Bytes())
+
+			// Strings must be parsed with the same alphabet
+			_, err = cinodefs.EntrypointFromString(epStr)
+			require.ErrorIs(t, err, cinodefs.ErrInvalidEntrypointData)
+
+			_, err = enc.EntrypointFromString("")
+			require.ErrorIs(t, err, cinodefs.ErrInvalidEntrypointData)
+			_, err = enc.WriterInfoFromString("")
+			require.ErrorIs(t, err, cinodefs.ErrInvalidWriterInfoData)
+			_, err = enc.WriterInfoFromString("!@#$")
+			require.ErrorIs(t, err, cinodefs.ErrInvalidWriterInfoData)
+		})
+	}
+
+	t.Run("invalid alphabet", func(t *testing.T) {
+		for _, alphabet := range []string{
+			"",
+			cinodefs.Base58AlphabetBitcoin[1:],
+			cinodefs.Base58AlphabetBitcoin[1:] + "2",
+			"1" + cinodefs.Base58AlphabetBitcoin[2:] + "1",
+			"ż" + cinodefs.Base58AlphabetBitcoin[2:],
+		} {
+			_, err := cinodefs.EncodingAlphabet(alphabet)
+			require.ErrorIs(t, err, cinodefs.ErrInvalidEncodingAlphabet)
+		}
+	})
+}
@@ -0,0 +1,196 @@
+/*
+Copyright © 2022 Bartłomiej Święcki (byo)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cinodefs_test
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/cinode/go/pkg/blenc"
+	"github.com/cinode/go/pkg/cinodefs"
+	"github.com/cinode/go/pkg/cinodefs/protobuf"
+	"github.com/cinode/go/pkg/datastore"
+	"github.com/cinode/go/pkg/utilities/golang"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestEntryMetadata(t *testing.T) {
+	ctx := context.Background()
+	ds := datastore.InMemory()
+
+	fs, err := cinodefs.New(ctx, blenc.FromDatastore(ds), cinodefs.NewRootStaticDirectory())
+	require.NoError(t, err)
+
+	_, err = fs.SetEntryFile(ctx, []string{"dir", "file.txt"}, strings.NewReader("hello"),
+		cinodefs.SetMetadata("cache-control", "max-age=3600"),
+		cinodefs.SetMetadata("author", "someone"),
+		cinodefs.SetMetadata("author", "someone else"),
+	)
+	require.NoError(t, err)
+
+	_, err = fs.SetEntryFile(ctx, []string{"dir", "plain.txt"}, strings.NewReader("hello"))
+	require.NoError(t, err)
+	require.NoError(t, fs.Flush(ctx))
+
+	expected := map[string]string{
+		"cache-control": "max-age=3600",
+		"author":        "someone else",
+	}
+
+	t.Run("metadata is persisted", func(t *testing.T) {
+		rootEP, err := fs.RootEntrypoint()
+		require.NoError(t, err)
+		fs2, err := cinodefs.New(ctx, blenc.FromDatastore(ds), cinodefs.RootEntrypoint(rootEP))
+		require.NoError(t, err)
+
+		metadata, err := fs2.EntryMetadata(ctx, []string{"dir", "file.txt"})
+		require.NoError(t, err)
+		require.Equal(t, expected, metadata)
+
+		metadata, err = fs2.EntryMetadata(ctx, []string{"dir", "plain.txt"})
+		require.NoError(t, err)
+		require.Nil(t, metadata)
+
+		_, err = fs2.EntryMetadata(ctx, []string{"dir", "missing.txt"})
+		require.ErrorIs(t, err, cinodefs.ErrEntryNotFound)
+	})
+
+	t.Run("returned metadata is a copy", func(t *testing.T) {
+		ep, err := fs.FindEntry(ctx, []string{"dir", "file.txt"})
+		require.NoError(t, err)
+
+		metadata := ep.Metadata()
+		metadata["author"] = "modified"
+		require.Equal(t, expected, ep.Metadata())
+	})
+
+	t.Run("metadata is kept when changing mime type", func(t *testing.T) {
+		err := fs.SetEntryMimeType(ctx, []string{"dir", "file.txt"}, "text/x-other")
+		require.NoError(t, err)
+
+		metadata, err := fs.EntryMetadata(ctx, []string{"dir", "file.txt"})
+		require.NoError(t, err)
+		require.Equal(t, expected, metadata)
+	})
+
+	t.Run("limits", func(t *testing.T) {
+		tooManyKeys := []cinodefs.EntrypointOption{}
+		for i := 0; i <= cinodefs.MaxMetadataKeysInNode; i++ {
+			tooManyKeys = append(tooManyKeys, cinodefs.SetMetadata(fmt.Sprintf("key%d", i), "value"))
+		}
+
+		for _, d := range []struct {
+			desc string
+			opts []cinodefs.EntrypointOption
+		}{
+			{"too many keys", tooManyKeys},
+			{"empty key", []cinodefs.EntrypointOption{
+				cinodefs.SetMetadata("", "value"),
+			}},
+			{"key too long", []cinodefs.EntrypointOption{
+				cinodefs.SetMetadata(strings.Repeat("k", cinodefs.MaxMetadataKeyLength+1), "value"),
+			}},
+			{"value too long", []cinodefs.EntrypointOption{
+				cinodefs.SetMetadata("key", strings.Repeat("v", cinodefs.MaxMetadataValueLength+1)),
+			}},
+		} {
+			t.Run(d.desc, func(t *testing.T) {
+				_, err := fs.SetEntryFile(ctx, []string{"invalid"}, strings.NewReader("data"), d.opts...)
+				require.ErrorIs(t, err, cinodefs.ErrInvalidEntrypointMetadata)
+
+				_, err = fs.CreateFileEntrypoint(ctx, strings.NewReader("data"), d.opts...)
+				require.ErrorIs(t, err, cinodefs.ErrInvalidEntrypointMetadata)
+
+				_, err = fs.CreateFileWriter(ctx, []string{"invalid"}, d.opts...)
+				require.ErrorIs(t, err, cinodefs.ErrInvalidEntrypointMetadata)
+			})
+		}
+
+		t.Run("maximal metadata", func(t *testing.T) {
+			opts := []cinodefs.EntrypointOption{}
+			for i := 0; i < cinodefs.MaxMetadataKeysInNode; i++ {
+				opts = append(opts, cinodefs.SetMetadata(
+					fmt.Sprintf("%0*d", cinodefs.MaxMetadataKeyLength, i),
+					strings.Repeat("v", cinodefs.MaxMetadataValueLength),
+				))
+			}
+			_, err := fs.SetEntryFile(ctx, []string{"maximal"}, strings.NewReader("data"), opts...)
+			require.NoError(t, err)
+		})
+	})
+
+	t.Run("invalid metadata in entrypoint data", func(t *testing.T) {
+		ep, err := fs.FindEntry(ctx, []string{"dir", "plain.txt"})
+		require.NoError(t, err)
+
+		epProto := &protobuf.Entrypoint{}
+		require.NoError(t, proto.Unmarshal(ep.Bytes(), epProto))
+		epProto.Metadata = map[string]string{"": "value"}
+
+		_, err = cinodefs.EntrypointFromBytes(golang.Must(proto.Marshal(epProto)))
+		require.ErrorIs(t, err, cinodefs.ErrInvalidEntrypointData)
+		require.ErrorIs(t, err, cinodefs.ErrInvalidEntrypointMetadata)
+	})
+
+	t.Run("serialization is deterministic", func(t *testing.T) {
+		opts := []cinodefs.EntrypointOption{}
+		for i := 0; i < 16; i++ {
+			opts = append(opts, cinodefs.SetMetadata(fmt.Sprintf("key%d", i), fmt.Sprintf("value%d", i)))
+		}
+
+		buildRoot := func() *cinodefs.Entrypoint {
+			fs, err := cinodefs.New(ctx,
+				blenc.FromDatastore(datastore.InMemory()),
+				cinodefs.NewRootStaticDirectory(),
+			)
+			require.NoError(t, err)
+
+			_, err = fs.SetEntryFile(ctx, []string{"dir", "file.txt"}, strings.NewReader("hello"), opts...)
+			require.NoError(t, err)
+			require.NoError(t, fs.Flush(ctx))
+
+			rootEP, err := fs.RootEntrypoint()
+			require.NoError(t, err)
+			return rootEP
+		}
+
+		firstRoot := buildRoot()
+		for i := 0; i < 10; i++ {
+			root := buildRoot()
+			require.Equal(t, firstRoot.BlobName().String(), root.BlobName().String())
+		}
+
+		ep, err := cinodefs.EntrypointFromBytes(firstRoot.Bytes())
+		require.NoError(t, err)
+		_, err = fs.SetEntryFile(ctx, []string{"deterministic"}, strings.NewReader("data"), opts...)
+		require.NoError(t, err)
+		fileEP, err := fs.FindEntry(ctx, []string{"deterministic"})
+		require.NoError(t, err)
+
+		// ETag served over http is computed from the entrypoint bytes
+		for _, e := range []*cinodefs.Entrypoint{ep, fileEP} {
+			etag := sha256.Sum256(e.Bytes())
+			for i := 0; i < 10; i++ {
+				require.Equal(t, etag, sha256.Sum256(e.Bytes()))
+			}
+		}
+	})
+}
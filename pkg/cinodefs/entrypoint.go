@@ -19,20 +19,40 @@ package cinodefs
 import (
 	"errors"
 	"fmt"
+	"maps"
+	"time"
 
 	"github.com/cinode/go/pkg/blobtypes"
 	"github.com/cinode/go/pkg/cinodefs/protobuf"
 	"github.com/cinode/go/pkg/common"
 	"github.com/cinode/go/pkg/utilities/golang"
-	"github.com/jbenet/go-base58"
 	"google.golang.org/protobuf/proto"
 )
 
+const (
+	// Limits of the custom metadata attached to a single entry.
+	//
+	// Those limits are introduced together with entry metadata, entrypoints
+	// exceeding them are rejected both when set and when read from the
+	// datastore. Changing them may make existing entrypoints unreadable.
+
+	// MaxMetadataKeyLength is the maximal length of a metadata key in bytes
+	MaxMetadataKeyLength = 256
+
+	// MaxMetadataValueLength is the maximal length of a metadata value in bytes
+	MaxMetadataValueLength = 4096
+
+	// MaxMetadataKeysInNode is the maximal number of metadata keys of a single
+	// entry
+	MaxMetadataKeysInNode = 64
+)
+
 var (
 	ErrInvalidEntrypointData             = errors.New("invalid entrypoint data")
 	ErrInvalidEntrypointDataParse        = fmt.Errorf("%w: protobuf parse error", ErrInvalidEntrypointData)
 	ErrInvalidEntrypointDataLinkMimetype = fmt.Errorf("%w: link can not have mimetype set", ErrInvalidEntrypointData)
 	ErrInvalidEntrypointDataNil          = fmt.Errorf("%w: nil data", ErrInvalidEntrypointData)
+	ErrInvalidEntrypointMetadata         = fmt.Errorf("%w: invalid metadata", ErrInvalidEntrypointData)
 	ErrInvalidEntrypointTime             = errors.New("time validation failed")
 	ErrExpired                           = fmt.Errorf("%w: entry expired", ErrInvalidEntrypointTime)
 	ErrNotYetValid                       = fmt.Errorf("%w: entry not yet valid", ErrInvalidEntrypointTime)
@@ -44,16 +64,7 @@ type Entrypoint struct {
 }
 
 func EntrypointFromString(s string) (*Entrypoint, error) {
-	if len(s) == 0 {
-		return nil, fmt.Errorf("%w: empty string", ErrInvalidEntrypointData)
-	}
-
-	b := base58.Decode(s)
-	if len(b) == 0 {
-		return nil, fmt.Errorf("%w: not a base58 string", ErrInvalidEntrypointData)
-	}
-
-	return EntrypointFromBytes(b)
+	return DefaultEncoding.EntrypointFromString(s)
 }
 
 func EntrypointFromBytes(b []byte) (*Entrypoint, error) {
@@ -99,6 +110,35 @@ func expandEntrypointProto(ep *Entrypoint) error {
 		return ErrInvalidEntrypointDataLinkMimetype
 	}
 
+	return validateEntrypointMetadata(ep.ep.Metadata)
+}
+
+func validateEntrypointMetadata(metadata map[string]string) error {
+	if len(metadata) > MaxMetadataKeysInNode {
+		return fmt.Errorf(
+			"%w: %d keys, at most %d allowed",
+			ErrInvalidEntrypointMetadata, len(metadata), MaxMetadataKeysInNode,
+		)
+	}
+
+	for key, value := range metadata {
+		if key == "" {
+			return fmt.Errorf("%w: empty key", ErrInvalidEntrypointMetadata)
+		}
+		if len(key) > MaxMetadataKeyLength {
+			return fmt.Errorf(
+				"%w: key of %d bytes, at most %d allowed",
+				ErrInvalidEntrypointMetadata, len(key), MaxMetadataKeyLength,
+			)
+		}
+		if len(value) > MaxMetadataValueLength {
+			return fmt.Errorf(
+				"%w: value of key '%s' has %d bytes, at most %d allowed",
+				ErrInvalidEntrypointMetadata, key, len(value), MaxMetadataValueLength,
+			)
+		}
+	}
+
 	return nil
 }
 
@@ -114,17 +154,22 @@ func setEntrypointBlobNameAndKey(bn *common.BlobName, key *common.BlobKey, ep *E
 }
 
 func (e *Entrypoint) String() string {
-	return base58.Encode(e.Bytes())
+	return DefaultEncoding.EntrypointString(e)
 }
 
 func (e *Entrypoint) Bytes() []byte {
-	return golang.Must(proto.Marshal(&e.ep))
+	return golang.Must(marshalOptions.Marshal(&e.ep))
 }
 
 func (e *Entrypoint) BlobName() *common.BlobName {
 	return e.bn
 }
 
+// BlobKey returns the key of the blob the entrypoint points to
+func (e *Entrypoint) BlobKey() *common.BlobKey {
+	return common.BlobKeyFromBytes(e.ep.GetKeyInfo().GetKey())
+}
+
 func (e *Entrypoint) IsLink() bool {
 	return e.bn.Type() == blobtypes.DynamicLink
 }
@@ -136,3 +181,30 @@ func (e *Entrypoint) IsDir() bool {
 func (e *Entrypoint) MimeType() string {
 	return e.ep.MimeType
 }
+
+// ModTime returns the modification time of the entry, zero time is returned
+// if the modification time is not set
+func (e *Entrypoint) ModTime() time.Time {
+	if e.ep.ModTimeUnixMicro == 0 {
+		return time.Time{}
+	}
+	return time.UnixMicro(e.ep.ModTimeUnixMicro)
+}
+
+// SortWeight returns the weight used to order the entry in directory listings
+func (e *Entrypoint) SortWeight() int64 {
+	return e.ep.SortWeight
+}
+
+// Metadata returns a copy of custom metadata attached to the entry,
+// nil is returned if the entry has no metadata
+func (e *Entrypoint) Metadata() map[string]string {
+	return maps.Clone(e.ep.Metadata)
+}
+
+// ContentLength returns the length of the plaintext file content, 0 is
+// returned if the length is not known (i.e. for entries created before
+// the length was recorded)
+func (e *Entrypoint) ContentLength() int64 {
+	return e.ep.ContentLength
+}
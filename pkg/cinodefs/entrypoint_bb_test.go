@@ -17,10 +17,14 @@ limitations under the License.
 package cinodefs_test
 
 import (
+	"context"
+	"strings"
 	"testing"
 
+	"github.com/cinode/go/pkg/blenc"
 	"github.com/cinode/go/pkg/cinodefs"
 	"github.com/cinode/go/pkg/cinodefs/protobuf"
+	"github.com/cinode/go/pkg/datastore"
 	"github.com/cinode/go/testvectors/testblobs"
 	"github.com/stretchr/testify/require"
 	"google.golang.org/protobuf/proto"
@@ -75,3 +79,31 @@ func TestInvalidEntrypointData(t *testing.T) {
 		})
 	}
 }
+
+func TestEntrypointContentLength(t *testing.T) {
+	ctx := context.Background()
+	be := blenc.FromDatastore(datastore.InMemory())
+	fs, err := cinodefs.New(ctx, be, cinodefs.NewRootStaticDirectory())
+	require.NoError(t, err)
+
+	for _, content := range []string{"", "hello", strings.Repeat("a", 1<<20)} {
+		ep, err := fs.SetEntryFile(ctx, []string{"file.txt"}, strings.NewReader(content))
+		require.NoError(t, err)
+		require.EqualValues(t, len(content), ep.ContentLength())
+
+		require.NoError(t, fs.Flush(ctx))
+
+		rootEP, err := fs.RootEntrypoint()
+		require.NoError(t, err)
+		fs2, err := cinodefs.New(ctx, be, cinodefs.RootEntrypoint(rootEP))
+		require.NoError(t, err)
+
+		ep, err = fs2.FindEntry(ctx, []string{"file.txt"})
+		require.NoError(t, err)
+		require.EqualValues(t, len(content), ep.ContentLength())
+	}
+
+	rootEP, err := fs.RootEntrypoint()
+	require.NoError(t, err)
+	require.Zero(t, rootEP.ContentLength())
+}
@@ -18,6 +18,7 @@ package cinodefs
 
 import (
 	"context"
+	"time"
 )
 
 type EntrypointOption interface {
@@ -34,10 +35,45 @@ func SetMimeType(mimeType string) EntrypointOption {
 	})
 }
 
-func entrypointFromOptions(ctx context.Context, opts ...EntrypointOption) *Entrypoint {
+func SetModTime(t time.Time) EntrypointOption {
+	return entrypointOptionBasicFunc(func(ep *Entrypoint) {
+		if t.IsZero() {
+			ep.ep.ModTimeUnixMicro = 0
+			return
+		}
+		ep.ep.ModTimeUnixMicro = t.UnixMicro()
+	})
+}
+
+func SetSortWeight(weight int64) EntrypointOption {
+	return entrypointOptionBasicFunc(func(ep *Entrypoint) {
+		ep.ep.SortWeight = weight
+	})
+}
+
+// SetMetadata attaches custom metadata value under given key to the entry,
+// the value of an already existing key is replaced. Metadata must fit
+// within MaxMetadataKeysInNode, MaxMetadataKeyLength and
+// MaxMetadataValueLength limits.
+func SetMetadata(key, value string) EntrypointOption {
+	return entrypointOptionBasicFunc(func(ep *Entrypoint) {
+		if ep.ep.Metadata == nil {
+			ep.ep.Metadata = map[string]string{}
+		}
+		ep.ep.Metadata[key] = value
+	})
+}
+
+func entrypointFromOptions(ctx context.Context, opts ...EntrypointOption) (*Entrypoint, error) {
 	ep := &Entrypoint{}
 	for _, o := range opts {
 		o.apply(ctx, ep)
 	}
-	return ep
+
+	err := validateEntrypointMetadata(ep.ep.Metadata)
+	if err != nil {
+		return nil, err
+	}
+
+	return ep, nil
 }
@@ -0,0 +1,131 @@
+/*
+Copyright © 2023 Bartłomiej Święcki (byo)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cinodefs
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/cinode/go/pkg/cinodefs/protobuf"
+	"github.com/cinode/go/pkg/utilities/golang"
+	"golang.org/x/crypto/chacha20poly1305"
+	"google.golang.org/protobuf/proto"
+)
+
+var (
+	ErrInvalidWrapKey               = errors.New("invalid wrap key")
+	ErrInvalidWrappedEntrypoint     = fmt.Errorf("%w: invalid wrapped entrypoint", ErrInvalidEntrypointData)
+	ErrWrappedEntrypointAuthFailure = fmt.Errorf("%w: authentication failed", ErrInvalidWrappedEntrypoint)
+)
+
+const (
+	wrappedEntrypointVersion = 0
+
+	// WrapKeySize is the required size of the key used to wrap entrypoints
+	WrapKeySize = chacha20poly1305.KeySize
+)
+
+// WrapEntrypoint serializes given entrypoint encrypting its key information
+// with the wrap key. The remaining entrypoint data such as the blob name
+// or the mime type is stored in plaintext but is authenticated together
+// with the encrypted key.
+//
+// This allows storing entrypoints in a place where only the location of the
+// data should be revealed, reading the data requires the wrap key.
+//
+// The wrap key is used with XChaCha20-Poly1305 and must be WrapKeySize
+// bytes long.
+func WrapEntrypoint(ep *Entrypoint, wrapKey []byte) ([]byte, error) {
+	if ep == nil {
+		return nil, ErrNilEntrypoint
+	}
+
+	aead, err := chacha20poly1305.NewX(wrapKey)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidWrapKey, err)
+	}
+
+	public := proto.Clone(&ep.ep).(*protobuf.Entrypoint)
+	public.KeyInfo = nil
+	publicBytes := golang.Must(marshalOptions.Marshal(public))
+	keyInfoBytes := golang.Must(marshalOptions.Marshal(ep.ep.KeyInfo))
+
+	// Version and the public part are authenticated by the AEAD
+	header := []byte{wrappedEntrypointVersion}
+	header = binary.AppendUvarint(header, uint64(len(publicBytes)))
+	header = append(header, publicBytes...)
+
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(keyInfoBytes)+aead.Overhead())
+	_, err = rand.Read(nonce)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(header, aead.Seal(nonce, nonce, keyInfoBytes, header)...), nil
+}
+
+// UnwrapEntrypoint restores the entrypoint serialized with WrapEntrypoint
+func UnwrapEntrypoint(data []byte, wrapKey []byte) (*Entrypoint, error) {
+	aead, err := chacha20poly1305.NewX(wrapKey)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidWrapKey, err)
+	}
+
+	if len(data) == 0 {
+		return nil, fmt.Errorf("%w: empty data", ErrInvalidWrappedEntrypoint)
+	}
+	if data[0] != wrappedEntrypointVersion {
+		return nil, fmt.Errorf("%w: unsupported version %d", ErrInvalidWrappedEntrypoint, data[0])
+	}
+
+	publicLen, n := binary.Uvarint(data[1:])
+	if n <= 0 || publicLen > uint64(len(data)-1-n) {
+		return nil, fmt.Errorf("%w: invalid length", ErrInvalidWrappedEntrypoint)
+	}
+
+	headerLen := 1 + n + int(publicLen)
+	header, sealed := data[:headerLen], data[headerLen:]
+	if len(sealed) < aead.NonceSize()+aead.Overhead() {
+		return nil, fmt.Errorf("%w: data too short", ErrInvalidWrappedEntrypoint)
+	}
+
+	keyInfoBytes, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], header)
+	if err != nil {
+		return nil, ErrWrappedEntrypointAuthFailure
+	}
+
+	ep := &Entrypoint{}
+	err = proto.Unmarshal(header[1+n:], &ep.ep)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidEntrypointDataParse, err)
+	}
+
+	ep.ep.KeyInfo = &protobuf.KeyInfo{}
+	err = proto.Unmarshal(keyInfoBytes, ep.ep.KeyInfo)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidEntrypointDataParse, err)
+	}
+
+	err = expandEntrypointProto(ep)
+	if err != nil {
+		return nil, err
+	}
+
+	return ep, nil
+}
@@ -0,0 +1,127 @@
+/*
+Copyright © 2023 Bartłomiej Święcki (byo)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cinodefs_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cinode/go/pkg/blenc"
+	"github.com/cinode/go/pkg/blobtypes"
+	"github.com/cinode/go/pkg/cinodefs"
+	"github.com/cinode/go/pkg/datastore"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWrapEntrypoint(t *testing.T) {
+	ctx := context.Background()
+	fs, err := cinodefs.New(ctx,
+		blenc.FromDatastore(datastore.InMemory()),
+		cinodefs.NewRootStaticDirectory(),
+	)
+	require.NoError(t, err)
+
+	ep, err := fs.CreateFileEntrypoint(ctx,
+		strings.NewReader("Hello world!"),
+		cinodefs.SetMimeType("text/plain"),
+		cinodefs.SetModTime(time.UnixMicro(123456789)),
+	)
+	require.NoError(t, err)
+
+	wrapKey := bytes.Repeat([]byte{0x5A}, cinodefs.WrapKeySize)
+	otherKey := bytes.Repeat([]byte{0xA5}, cinodefs.WrapKeySize)
+
+	wrapped, err := cinodefs.WrapEntrypoint(ep, wrapKey)
+	require.NoError(t, err)
+
+	t.Run("key material is not stored in plaintext", func(t *testing.T) {
+		be := blenc.FromDatastore(datastore.InMemory())
+		bn, key, _, err := be.Create(ctx, blobtypes.Static, strings.NewReader("Hello world!"))
+		require.NoError(t, err)
+
+		wrapped, err := cinodefs.WrapEntrypoint(cinodefs.EntrypointFromBlobNameAndKey(bn, key), wrapKey)
+		require.NoError(t, err)
+		require.NotContains(t, string(wrapped), string(key.Bytes()))
+
+		// Blob name is still visible
+		require.Contains(t, string(wrapped), string(bn.Bytes()))
+	})
+
+	t.Run("wrapping is randomized", func(t *testing.T) {
+		wrapped2, err := cinodefs.WrapEntrypoint(ep, wrapKey)
+		require.NoError(t, err)
+		require.NotEqual(t, wrapped, wrapped2)
+	})
+
+	t.Run("unwrap restores the entrypoint", func(t *testing.T) {
+		ep2, err := cinodefs.UnwrapEntrypoint(wrapped, wrapKey)
+		require.NoError(t, err)
+		require.Equal(t, ep.String(), ep2.String())
+		require.Equal(t, "text/plain", ep2.MimeType())
+		require.Equal(t, ep.ModTime(), ep2.ModTime())
+
+		rc, err := fs.OpenEntrypointData(ctx, ep2)
+		require.NoError(t, err)
+		data, err := io.ReadAll(rc)
+		require.NoError(t, err)
+		require.NoError(t, rc.Close())
+		require.Equal(t, "Hello world!", string(data))
+	})
+
+	t.Run("wrong wrap key", func(t *testing.T) {
+		ep2, err := cinodefs.UnwrapEntrypoint(wrapped, otherKey)
+		require.ErrorIs(t, err, cinodefs.ErrWrappedEntrypointAuthFailure)
+		require.ErrorIs(t, err, cinodefs.ErrInvalidEntrypointData)
+		require.Nil(t, ep2)
+	})
+
+	t.Run("tampered data", func(t *testing.T) {
+		for i := range wrapped {
+			tampered := bytes.Clone(wrapped)
+			tampered[i] ^= 0x01
+
+			ep2, err := cinodefs.UnwrapEntrypoint(tampered, wrapKey)
+			require.ErrorIs(t, err, cinodefs.ErrInvalidWrappedEntrypoint, "byte %d", i)
+			require.Nil(t, ep2)
+		}
+	})
+
+	t.Run("truncated data", func(t *testing.T) {
+		for i := range len(wrapped) {
+			ep2, err := cinodefs.UnwrapEntrypoint(wrapped[:i], wrapKey)
+			require.ErrorIs(t, err, cinodefs.ErrInvalidWrappedEntrypoint, "length %d", i)
+			require.Nil(t, ep2)
+		}
+	})
+
+	t.Run("invalid wrap key", func(t *testing.T) {
+		_, err := cinodefs.WrapEntrypoint(ep, wrapKey[1:])
+		require.ErrorIs(t, err, cinodefs.ErrInvalidWrapKey)
+
+		_, err = cinodefs.UnwrapEntrypoint(wrapped, nil)
+		require.ErrorIs(t, err, cinodefs.ErrInvalidWrapKey)
+	})
+
+	t.Run("nil entrypoint", func(t *testing.T) {
+		_, err := cinodefs.WrapEntrypoint(nil, wrapKey)
+		require.ErrorIs(t, err, cinodefs.ErrNilEntrypoint)
+	})
+}
@@ -0,0 +1,97 @@
+/*
+Copyright © 2023 Bartłomiej Święcki (byo)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cinodefs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/cinode/go/pkg/blenc"
+	"github.com/cinode/go/pkg/datastore"
+)
+
+var (
+	ErrInvalidDatastore = errors.New("invalid datastore argument")
+)
+
+// ExportPublicBlobs copies all blobs reachable from given root entrypoint
+// from the src datastore into the dst datastore. Returns the number of
+// exported blobs.
+//
+// Blobs are copied at the datastore level in their encrypted form, the
+// entrypoint key is only used to discover blobs referenced by directories
+// and links. No key material nor writer info is written to the destination
+// thus the result is suitable for a propagation-only mirror that can serve
+// the dataset without being able to read or modify it.
+//
+// With the SkipAndReport policy, blobs that could be read are exported and
+// the remaining ones are reported through *SkippedEntriesError.
+func ExportPublicBlobs(
+	ctx context.Context,
+	src datastore.DS,
+	dst datastore.DS,
+	root *Entrypoint,
+	maxRedirects int,
+	opts ...WalkOption,
+) (int, error) {
+	if src == nil || dst == nil {
+		return 0, ErrInvalidDatastore
+	}
+	if root == nil {
+		return 0, ErrNilEntrypoint
+	}
+	if maxRedirects < 0 {
+		return 0, ErrNegativeMaxLinksRedirects
+	}
+	o, err := walkOptionsFrom(opts)
+	if err != nil {
+		return 0, err
+	}
+
+	v := newReachabilityVerifier(blenc.FromDatastore(src), maxRedirects, false, o.policy)
+	err = v.verify(ctx, root, nil, 0)
+	if err != nil {
+		return 0, err
+	}
+
+	exported := 0
+	for i, bn := range v.reached {
+		err := v.errs.do(ctx, func() error {
+			rc, err := src.Open(ctx, bn)
+			if err != nil {
+				return err
+			}
+			defer rc.Close()
+
+			return dst.Update(ctx, bn, rc)
+		})
+		if err != nil {
+			err = v.errs.handle(
+				v.reachedPaths[i], bn,
+				fmt.Errorf("couldn't export blob %s: %w", bn, err),
+			)
+			if err != nil {
+				return 0, err
+			}
+			continue
+		}
+		exported++
+	}
+
+	return exported, v.errs.result()
+}
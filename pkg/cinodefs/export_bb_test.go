@@ -0,0 +1,154 @@
+/*
+Copyright © 2023 Bartłomiej Święcki (byo)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cinodefs_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/cinode/go/pkg/blenc"
+	"github.com/cinode/go/pkg/cinodefs"
+	"github.com/cinode/go/pkg/datastore"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExportPublicBlobs(t *testing.T) {
+	ctx := context.Background()
+	src := datastore.InMemory()
+
+	fs, err := cinodefs.New(ctx,
+		blenc.FromDatastore(src),
+		cinodefs.NewRootDynamicLink(),
+	)
+	require.NoError(t, err)
+
+	files := map[string]string{
+		"index.html":           "<html>index</html>",
+		"dir/file.txt":         "file content",
+		"dir/linked/file2.txt": "linked file content",
+	}
+
+	fileEPs := []*cinodefs.Entrypoint{}
+	for name, content := range files {
+		ep, err := fs.SetEntryFile(ctx, strings.Split(name, "/"), strings.NewReader(content))
+		require.NoError(t, err)
+		fileEPs = append(fileEPs, ep)
+	}
+
+	linkWI, err := fs.InjectDynamicLink(ctx, []string{"dir", "linked"})
+	require.NoError(t, err)
+	require.NoError(t, fs.Flush(ctx))
+
+	// Blob not referenced by the dataset
+	_, err = fs.CreateFileEntrypoint(ctx, strings.NewReader("unreferenced"))
+	require.NoError(t, err)
+
+	rootEP, err := fs.RootEntrypoint()
+	require.NoError(t, err)
+	rootWI, err := fs.RootWriterInfo(ctx)
+	require.NoError(t, err)
+
+	reachable, err := cinodefs.ReachableBlobs(ctx, blenc.FromDatastore(src), rootEP, cinodefs.DefaultMaxLinksRedirects)
+	require.NoError(t, err)
+
+	dst := datastore.InMemory()
+	count, err := cinodefs.ExportPublicBlobs(ctx, src, dst, rootEP, cinodefs.DefaultMaxLinksRedirects)
+	require.NoError(t, err)
+	require.Equal(t, len(reachable), count)
+
+	t.Run("contains all reachable blobs only", func(t *testing.T) {
+		for _, bn := range reachable {
+			exists, err := dst.Exists(ctx, bn)
+			require.NoError(t, err)
+			require.True(t, exists, bn)
+		}
+
+		orphans, _, err := datastore.FindBlobsNotIn(ctx, dst, reachable)
+		require.NoError(t, err)
+		require.Empty(t, orphans)
+	})
+
+	t.Run("no key material", func(t *testing.T) {
+		secrets := [][]byte{rootEP.Bytes(), rootWI.Bytes(), linkWI.Bytes()}
+		for _, ep := range fileEPs {
+			secrets = append(secrets, ep.Bytes())
+		}
+
+		for _, bn := range reachable {
+			rc, err := dst.Open(ctx, bn)
+			require.NoError(t, err)
+			data, err := io.ReadAll(rc)
+			require.NoError(t, err)
+			require.NoError(t, rc.Close())
+
+			for _, s := range secrets {
+				require.False(t, bytes.Contains(data, s), bn)
+			}
+		}
+	})
+
+	t.Run("served from propagation-only mirror", func(t *testing.T) {
+		server := httptest.NewServer(datastore.WebInterface(dst))
+		defer server.Close()
+
+		mirror, err := datastore.FromWeb(server.URL + "/")
+		require.NoError(t, err)
+
+		fs2, err := cinodefs.New(ctx,
+			blenc.FromDatastore(mirror),
+			cinodefs.RootEntrypoint(rootEP),
+		)
+		require.NoError(t, err)
+
+		for name, content := range files {
+			rc, err := fs2.OpenEntryData(ctx, strings.Split(name, "/"))
+			require.NoError(t, err)
+			data, err := io.ReadAll(rc)
+			require.NoError(t, err)
+			require.NoError(t, rc.Close())
+			require.Equal(t, content, string(data))
+		}
+	})
+
+	t.Run("missing blob", func(t *testing.T) {
+		src := datastore.InMemory()
+		for _, bn := range reachable[:len(reachable)-1] {
+			rc, err := dst.Open(ctx, bn)
+			require.NoError(t, err)
+			require.NoError(t, src.Update(ctx, bn, rc))
+			rc.Close()
+		}
+
+		_, err := cinodefs.ExportPublicBlobs(ctx, src, datastore.InMemory(), rootEP, cinodefs.DefaultMaxLinksRedirects)
+		require.ErrorIs(t, err, datastore.ErrNotFound)
+	})
+
+	t.Run("invalid arguments", func(t *testing.T) {
+		_, err := cinodefs.ExportPublicBlobs(ctx, nil, dst, rootEP, cinodefs.DefaultMaxLinksRedirects)
+		require.ErrorIs(t, err, cinodefs.ErrInvalidDatastore)
+
+		_, err = cinodefs.ExportPublicBlobs(ctx, src, nil, rootEP, cinodefs.DefaultMaxLinksRedirects)
+		require.ErrorIs(t, err, cinodefs.ErrInvalidDatastore)
+
+		_, err = cinodefs.ExportPublicBlobs(ctx, src, dst, nil, cinodefs.DefaultMaxLinksRedirects)
+		require.ErrorIs(t, err, cinodefs.ErrNilEntrypoint)
+	})
+}
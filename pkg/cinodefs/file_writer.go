@@ -0,0 +1,127 @@
+/*
+Copyright © 2022 Bartłomiej Święcki (byo)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cinodefs
+
+import (
+	"context"
+	"errors"
+	"io"
+	"mime"
+	"path/filepath"
+	"sync"
+)
+
+var (
+	ErrFileWriterClosed = errors.New("file writer already closed")
+)
+
+// CreateFileWriter returns a writer used to stream the content of a new file
+// stored at given path. The content is encrypted and stored in a static blob
+// while being written, the entry is set once the writer is successfully
+// closed. An error from storing the blob or from setting the entry is
+// returned from the Close call. If the writer is not closed, the path is
+// left unchanged, cancelling the context releases resources held by the
+// writer in such case.
+func (fs *cinodeFS) CreateFileWriter(
+	ctx context.Context,
+	path []string,
+	opts ...EntrypointOption,
+) (io.WriteCloser, error) {
+	path, err := validatePath(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(path) == 0 {
+		return nil, ErrCantDeleteRoot
+	}
+
+	ep, err := entrypointFromOptions(ctx, opts...)
+	if err != nil {
+		return nil, err
+	}
+	if ep.ep.MimeType == "" {
+		// Try detecting mime type from filename extension
+		ep.ep.MimeType = mime.TypeByExtension(filepath.Ext(path[len(path)-1]))
+	}
+
+	pr, pw := io.Pipe()
+	w := &fileWriter{
+		fs:   fs,
+		ctx:  ctx,
+		path: path,
+		pw:   pw,
+		done: make(chan struct{}),
+	}
+
+	// Unblock the blob creation if the writer is abandoned
+	w.stopCancel = context.AfterFunc(ctx, func() {
+		pw.CloseWithError(ctx.Err())
+	})
+
+	go func() {
+		defer close(w.done)
+		w.ep, w.err = fs.createFileEntrypoint(ctx, pr, ep)
+		// Stop further writes if the blob could not be created
+		pr.CloseWithError(w.err)
+	}()
+
+	return w, nil
+}
+
+type fileWriter struct {
+	fs         *cinodeFS
+	ctx        context.Context
+	path       []string
+	pw         *io.PipeWriter
+	done       chan struct{}
+	stopCancel func() bool
+
+	// result of the blob creation, valid once done is closed
+	ep  *Entrypoint
+	err error
+
+	closeOnce sync.Once
+	closeErr  error
+}
+
+func (w *fileWriter) Write(b []byte) (int, error) {
+	if err := w.ctx.Err(); err != nil {
+		return 0, err
+	}
+	n, err := w.pw.Write(b)
+	if errors.Is(err, io.ErrClosedPipe) {
+		return n, ErrFileWriterClosed
+	}
+	return n, err
+}
+
+func (w *fileWriter) Close() error {
+	w.closeOnce.Do(func() {
+		// Abort the blob creation if the context is already cancelled,
+		// the cancellation callback may not have been called yet
+		w.pw.CloseWithError(w.ctx.Err())
+		<-w.done
+		w.stopCancel()
+
+		if w.err != nil {
+			w.closeErr = w.err
+			return
+		}
+		w.closeErr = w.fs.SetEntry(w.ctx, w.path, w.ep)
+	})
+	return w.closeErr
+}
@@ -0,0 +1,164 @@
+/*
+Copyright © 2023 Bartłomiej Święcki (byo)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cinodefs_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/cinode/go/pkg/blenc"
+	"github.com/cinode/go/pkg/cinodefs"
+	"github.com/cinode/go/pkg/common"
+	"github.com/cinode/go/pkg/datastore"
+	"github.com/stretchr/testify/require"
+)
+
+type failingUpdateDS struct {
+	datastore.DS
+	fail bool
+}
+
+var errUpdateFailed = errors.New("update failed")
+
+func (f *failingUpdateDS) Update(ctx context.Context, name *common.BlobName, r io.Reader) error {
+	if f.fail {
+		return errUpdateFailed
+	}
+	return f.DS.Update(ctx, name, r)
+}
+
+func TestCreateFileWriter(t *testing.T) {
+	ctx := context.Background()
+
+	newFS := func(t *testing.T) (cinodefs.FS, *failingUpdateDS) {
+		ds := &failingUpdateDS{DS: datastore.InMemory()}
+		fs, err := cinodefs.New(ctx,
+			blenc.FromDatastore(ds),
+			cinodefs.NewRootStaticDirectory(),
+		)
+		require.NoError(t, err)
+		return fs, ds
+	}
+
+	readFile := func(t *testing.T, fs cinodefs.FS, path []string) string {
+		rc, err := fs.OpenEntryData(ctx, path)
+		require.NoError(t, err)
+		defer rc.Close()
+		data, err := io.ReadAll(rc)
+		require.NoError(t, err)
+		return string(data)
+	}
+
+	t.Run("write in chunks", func(t *testing.T) {
+		fs, _ := newFS(t)
+
+		w, err := fs.CreateFileWriter(ctx, []string{"dir", "file.txt"})
+		require.NoError(t, err)
+
+		for i := 0; i < 100; i++ {
+			_, err = io.WriteString(w, "line of generated content\n")
+			require.NoError(t, err)
+		}
+
+		// Entry is not visible until the writer is closed
+		_, err = fs.FindEntry(ctx, []string{"dir", "file.txt"})
+		require.ErrorIs(t, err, cinodefs.ErrEntryNotFound)
+
+		require.NoError(t, w.Close())
+		require.NoError(t, w.Close())
+
+		ep, err := fs.FindEntry(ctx, []string{"dir", "file.txt"})
+		require.NoError(t, err)
+		require.Equal(t, "text/plain; charset=utf-8", ep.MimeType())
+		require.EqualValues(t, 2600, ep.ContentLength())
+
+		expected := strings.Repeat("line of generated content\n", 100)
+		require.Equal(t, expected, readFile(t, fs, []string{"dir", "file.txt"}))
+		require.NoError(t, fs.Flush(ctx))
+		require.Equal(t, expected, readFile(t, fs, []string{"dir", "file.txt"}))
+
+		_, err = w.Write([]byte("more"))
+		require.ErrorIs(t, err, cinodefs.ErrFileWriterClosed)
+	})
+
+	t.Run("same result as SetEntryFile", func(t *testing.T) {
+		fs, _ := newFS(t)
+
+		ep1, err := fs.SetEntryFile(ctx, []string{"a.bin"}, strings.NewReader("data"),
+			cinodefs.SetMimeType("application/x-test"))
+		require.NoError(t, err)
+
+		w, err := fs.CreateFileWriter(ctx, []string{"b.bin"},
+			cinodefs.SetMimeType("application/x-test"))
+		require.NoError(t, err)
+		_, err = io.WriteString(w, "data")
+		require.NoError(t, err)
+		require.NoError(t, w.Close())
+
+		ep2, err := fs.FindEntry(ctx, []string{"b.bin"})
+		require.NoError(t, err)
+		require.Equal(t, ep1.String(), ep2.String())
+	})
+
+	t.Run("datastore failure is reported on close", func(t *testing.T) {
+		fs, ds := newFS(t)
+		ds.fail = true
+
+		w, err := fs.CreateFileWriter(ctx, []string{"file.txt"})
+		require.NoError(t, err)
+		_, err = io.WriteString(w, "data")
+		require.NoError(t, err)
+
+		err = w.Close()
+		require.ErrorIs(t, err, errUpdateFailed)
+
+		_, err = fs.FindEntry(ctx, []string{"file.txt"})
+		require.ErrorIs(t, err, cinodefs.ErrEntryNotFound)
+	})
+
+	t.Run("abandoned writer", func(t *testing.T) {
+		fs, _ := newFS(t)
+
+		ctx, cancel := context.WithCancel(ctx)
+		w, err := fs.CreateFileWriter(ctx, []string{"file.txt"})
+		require.NoError(t, err)
+		_, err = io.WriteString(w, "data")
+		require.NoError(t, err)
+
+		cancel()
+
+		_, err = io.WriteString(w, "more data")
+		require.ErrorIs(t, err, context.Canceled)
+		require.ErrorIs(t, w.Close(), context.Canceled)
+
+		_, err = fs.FindEntry(context.Background(), []string{"file.txt"})
+		require.ErrorIs(t, err, cinodefs.ErrEntryNotFound)
+	})
+
+	t.Run("invalid path", func(t *testing.T) {
+		fs, _ := newFS(t)
+
+		_, err := fs.CreateFileWriter(ctx, nil)
+		require.ErrorIs(t, err, cinodefs.ErrCantDeleteRoot)
+
+		_, err = fs.CreateFileWriter(ctx, []string{"dir", ""})
+		require.ErrorIs(t, err, cinodefs.ErrEmptyName)
+	})
+}
@@ -0,0 +1,30 @@
+/*
+Copyright © 2023 Bartłomiej Święcki (byo)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package fuse mounts the cinodefs filesystem as a read-only POSIX directory
+// for tools that can not use the HTTP interface.
+//
+// The mapping between cinodefs paths and inodes is independent of the FUSE
+// library and is always built. The FUSE adapter itself lives behind the
+// `fuse` build tag so that the core build does not link the FUSE library,
+// it can be enabled with:
+//
+//	go build -tags fuse ./...
+//
+// The adapter is only supported on Linux, it requires the fuse kernel module
+// and the fusermount binary. The underlying bazil.org/fuse library does not
+// support other platforms.
+package fuse
@@ -0,0 +1,186 @@
+//go:build fuse && linux
+
+/*
+Copyright © 2023 Bartłomiej Święcki (byo)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fuse
+
+import (
+	"context"
+	"errors"
+	"syscall"
+
+	bfuse "bazil.org/fuse"
+	bfusefs "bazil.org/fuse/fs"
+	"github.com/cinode/go/pkg/cinodefs"
+)
+
+var (
+	_ bfusefs.FS                 = (*fuseFS)(nil)
+	_ bfusefs.Node               = (*fuseDir)(nil)
+	_ bfusefs.NodeStringLookuper = (*fuseDir)(nil)
+	_ bfusefs.HandleReadDirAller = (*fuseDir)(nil)
+	_ bfusefs.Node               = (*fuseFile)(nil)
+	_ bfusefs.NodeOpener         = (*fuseFile)(nil)
+	_ bfusefs.HandleReader       = (*fuseHandle)(nil)
+	_ bfusefs.HandleReleaser     = (*fuseHandle)(nil)
+)
+
+// Mount mounts the filesystem in read-only mode at given mountpoint and serves
+// it until the context is cancelled or the filesystem is unmounted externally
+func Mount(ctx context.Context, fs cinodefs.FS, mountpoint string) error {
+	conn, err := bfuse.Mount(
+		mountpoint,
+		bfuse.ReadOnly(),
+		bfuse.FSName("cinode"),
+		bfuse.Subtype("cinodefs"),
+	)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			bfuse.Unmount(mountpoint)
+		case <-done:
+		}
+	}()
+
+	err = bfusefs.Serve(conn, &fuseFS{tree: newInodeTree(fs)})
+	if err != nil {
+		return err
+	}
+	return ctx.Err()
+}
+
+// fuseErrno converts the cinodefs error to the error reported to the kernel
+func fuseErrno(err error) error {
+	switch {
+	case errors.Is(err, cinodefs.ErrEntryNotFound),
+		errors.Is(err, cinodefs.ErrNotADirectory):
+		return bfuse.Errno(syscall.ENOENT)
+	case errors.Is(err, cinodefs.ErrMissingKeyInfo):
+		return bfuse.Errno(syscall.EACCES)
+	case errors.Is(err, context.Canceled),
+		errors.Is(err, context.DeadlineExceeded):
+		return bfuse.Errno(syscall.EINTR)
+	}
+	return bfuse.Errno(syscall.EIO)
+}
+
+type fuseFS struct {
+	tree *inodeTree
+}
+
+func (f *fuseFS) Root() (bfusefs.Node, error) {
+	return &fuseDir{tree: f.tree, path: []string{}}, nil
+}
+
+func setAttr(a *bfuse.Attr, at *attr) {
+	a.Inode = at.inode
+	a.Size = at.size
+	a.Mode = at.mode
+	a.Mtime = at.modTime
+	a.Ctime = at.modTime
+	a.Nlink = 1
+}
+
+type fuseDir struct {
+	tree *inodeTree
+	path []string
+}
+
+func (d *fuseDir) Attr(ctx context.Context, a *bfuse.Attr) error {
+	at, err := d.tree.stat(ctx, d.path)
+	if err != nil {
+		return fuseErrno(err)
+	}
+	setAttr(a, at)
+	return nil
+}
+
+func (d *fuseDir) Lookup(ctx context.Context, name string) (bfusefs.Node, error) {
+	p := append(d.path[:len(d.path):len(d.path)], name)
+
+	at, err := d.tree.stat(ctx, p)
+	if err != nil {
+		return nil, fuseErrno(err)
+	}
+
+	if at.isDir {
+		return &fuseDir{tree: d.tree, path: p}, nil
+	}
+	return &fuseFile{tree: d.tree, path: p}, nil
+}
+
+func (d *fuseDir) ReadDirAll(ctx context.Context) ([]bfuse.Dirent, error) {
+	entries, err := d.tree.readDir(ctx, d.path)
+	if err != nil {
+		return nil, fuseErrno(err)
+	}
+
+	ret := make([]bfuse.Dirent, 0, len(entries))
+	for _, e := range entries {
+		t := bfuse.DT_File
+		if e.isDir {
+			t = bfuse.DT_Dir
+		}
+		ret = append(ret, bfuse.Dirent{Inode: e.inode, Type: t, Name: e.name})
+	}
+	return ret, nil
+}
+
+type fuseFile struct {
+	tree *inodeTree
+	path []string
+}
+
+func (f *fuseFile) Attr(ctx context.Context, a *bfuse.Attr) error {
+	at, err := f.tree.stat(ctx, f.path)
+	if err != nil {
+		return fuseErrno(err)
+	}
+	setAttr(a, at)
+	return nil
+}
+
+func (f *fuseFile) Open(ctx context.Context, req *bfuse.OpenRequest, resp *bfuse.OpenResponse) (bfusefs.Handle, error) {
+	if !req.Flags.IsReadOnly() {
+		return nil, bfuse.Errno(syscall.EROFS)
+	}
+	return &fuseHandle{r: f.tree.openFile(f.path)}, nil
+}
+
+type fuseHandle struct {
+	r *fileReader
+}
+
+func (h *fuseHandle) Read(ctx context.Context, req *bfuse.ReadRequest, resp *bfuse.ReadResponse) error {
+	data, err := h.r.readAt(ctx, req.Offset, req.Size)
+	if err != nil {
+		return fuseErrno(err)
+	}
+	resp.Data = data
+	return nil
+}
+
+func (h *fuseHandle) Release(ctx context.Context, req *bfuse.ReleaseRequest) error {
+	return h.r.close()
+}
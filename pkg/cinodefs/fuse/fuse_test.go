@@ -0,0 +1,129 @@
+//go:build fuse && linux
+
+/*
+Copyright © 2023 Bartłomiej Święcki (byo)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fuse
+
+import (
+	"context"
+	"errors"
+	"syscall"
+	"testing"
+
+	bfuse "bazil.org/fuse"
+	"github.com/cinode/go/pkg/cinodefs"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFuseAdapter(t *testing.T) {
+	ctx := context.Background()
+	tree, _ := testTree(t)
+	fs := &fuseFS{tree: tree}
+
+	rootNode, err := fs.Root()
+	require.NoError(t, err)
+	root := rootNode.(*fuseDir)
+
+	t.Run("root attributes", func(t *testing.T) {
+		a := bfuse.Attr{}
+		require.NoError(t, root.Attr(ctx, &a))
+		require.EqualValues(t, rootInode, a.Inode)
+		require.True(t, a.Mode.IsDir())
+	})
+
+	t.Run("read directory", func(t *testing.T) {
+		entries, err := root.ReadDirAll(ctx)
+		require.NoError(t, err)
+
+		types := map[string]bfuse.DirentType{}
+		for _, e := range entries {
+			require.NotZero(t, e.Inode)
+			types[e.Name] = e.Type
+		}
+		require.Equal(t, map[string]bfuse.DirentType{
+			"file.txt": bfuse.DT_File,
+			"dir":      bfuse.DT_Dir,
+		}, types)
+	})
+
+	t.Run("lookup", func(t *testing.T) {
+		node, err := root.Lookup(ctx, "dir")
+		require.NoError(t, err)
+		dir := node.(*fuseDir)
+
+		node, err = dir.Lookup(ctx, "sub.txt")
+		require.NoError(t, err)
+		require.IsType(t, &fuseFile{}, node)
+
+		_, err = root.Lookup(ctx, "missing")
+		require.Equal(t, bfuse.Errno(syscall.ENOENT), err)
+	})
+
+	t.Run("read file", func(t *testing.T) {
+		node, err := root.Lookup(ctx, "file.txt")
+		require.NoError(t, err)
+		file := node.(*fuseFile)
+
+		a := bfuse.Attr{}
+		require.NoError(t, file.Attr(ctx, &a))
+		require.EqualValues(t, len("Hello world"), a.Size)
+		require.False(t, a.Mode.IsDir())
+
+		h, err := file.Open(ctx,
+			&bfuse.OpenRequest{Flags: bfuse.OpenReadOnly},
+			&bfuse.OpenResponse{},
+		)
+		require.NoError(t, err)
+		handle := h.(*fuseHandle)
+
+		resp := bfuse.ReadResponse{}
+		err = handle.Read(ctx, &bfuse.ReadRequest{Offset: 6, Size: 100}, &resp)
+		require.NoError(t, err)
+		require.Equal(t, "world", string(resp.Data))
+
+		require.NoError(t, handle.Release(ctx, &bfuse.ReleaseRequest{}))
+	})
+
+	t.Run("read-only", func(t *testing.T) {
+		node, err := root.Lookup(ctx, "file.txt")
+		require.NoError(t, err)
+
+		for _, flags := range []bfuse.OpenFlags{bfuse.OpenWriteOnly, bfuse.OpenReadWrite} {
+			_, err = node.(*fuseFile).Open(ctx,
+				&bfuse.OpenRequest{Flags: flags},
+				&bfuse.OpenResponse{},
+			)
+			require.Equal(t, bfuse.Errno(syscall.EROFS), err)
+		}
+	})
+
+	t.Run("error mapping", func(t *testing.T) {
+		for _, d := range []struct {
+			err   error
+			errno syscall.Errno
+		}{
+			{cinodefs.ErrEntryNotFound, syscall.ENOENT},
+			{cinodefs.ErrNotADirectory, syscall.ENOENT},
+			{cinodefs.ErrMissingKeyInfo, syscall.EACCES},
+			{context.Canceled, syscall.EINTR},
+			{context.DeadlineExceeded, syscall.EINTR},
+			{errors.New("other"), syscall.EIO},
+		} {
+			require.Equal(t, bfuse.Errno(d.errno), fuseErrno(d.err))
+		}
+	})
+}
@@ -0,0 +1,235 @@
+/*
+Copyright © 2023 Bartłomiej Święcki (byo)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fuse
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cinode/go/pkg/cinodefs"
+)
+
+// Inode number of the root directory
+const rootInode = 1
+
+// attr contains information about a single node in the tree
+type attr struct {
+	inode   uint64
+	isDir   bool
+	size    uint64
+	modTime time.Time
+	mode    fs.FileMode
+}
+
+// dirent is a single entry of the directory listing
+type dirent struct {
+	name  string
+	inode uint64
+	isDir bool
+}
+
+// inodeTree maps paths in the cinodefs filesystem to stable inode numbers,
+// the same path always gets the same inode during the lifetime of the tree
+type inodeTree struct {
+	fs cinodefs.FS
+
+	mu        sync.Mutex
+	inodes    map[string]uint64
+	nextInode uint64
+}
+
+func newInodeTree(fs cinodefs.FS) *inodeTree {
+	return &inodeTree{
+		fs:        fs,
+		inodes:    map[string]uint64{"": rootInode},
+		nextInode: rootInode + 1,
+	}
+}
+
+func (t *inodeTree) inode(path []string) uint64 {
+	key := strings.Join(path, "/")
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if inode, found := t.inodes[key]; found {
+		return inode
+	}
+
+	inode := t.nextInode
+	t.nextInode++
+	t.inodes[key] = inode
+	return inode
+}
+
+// stat returns attributes of the entry at given path, links are followed
+func (t *inodeTree) stat(ctx context.Context, path []string) (*attr, error) {
+	ep, err := t.fs.FindEntry(ctx, path)
+	if errors.Is(err, cinodefs.ErrModifiedDirectory) {
+		return &attr{
+			inode: t.inode(path),
+			isDir: true,
+			mode:  fs.ModeDir | 0o555,
+		}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if ep.IsDir() {
+		return &attr{
+			inode:   t.inode(path),
+			isDir:   true,
+			modTime: ep.ModTime(),
+			mode:    fs.ModeDir | 0o555,
+		}, nil
+	}
+
+	size := ep.ContentLength()
+	if size == 0 {
+		// Entries created before the content length was recorded,
+		// the size reported to the kernel must match the data read
+		size, err = t.fileSize(ctx, ep)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if size < 0 {
+		size = 0
+	}
+
+	return &attr{
+		inode:   t.inode(path),
+		size:    uint64(size),
+		modTime: ep.ModTime(),
+		mode:    0o444,
+	}, nil
+}
+
+// fileSize calculates the size of the file by reading all of its data
+func (t *inodeTree) fileSize(ctx context.Context, ep *cinodefs.Entrypoint) (int64, error) {
+	rc, err := t.fs.OpenEntrypointData(ctx, ep)
+	if err != nil {
+		return 0, err
+	}
+	defer rc.Close()
+
+	return io.Copy(io.Discard, rc)
+}
+
+// readDir lists the directory at given path. Links and symbolic links are
+// resolved to report the type of their target, entries that can not be
+// resolved are skipped.
+func (t *inodeTree) readDir(ctx context.Context, path []string) ([]dirent, error) {
+	entries, err := t.fs.ListDir(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := make([]dirent, 0, len(entries))
+	for _, e := range entries {
+		childPath := append(path[:len(path):len(path)], e.Name)
+		isDir := e.IsDir
+
+		if e.IsLink || e.IsSymlink {
+			a, err := t.stat(ctx, childPath)
+			if err != nil {
+				continue
+			}
+			isDir = a.isDir
+		}
+
+		ret = append(ret, dirent{
+			name:  e.Name,
+			inode: t.inode(childPath),
+			isDir: isDir,
+		})
+	}
+	return ret, nil
+}
+
+// fileReader serves reads at arbitrary offsets from a single file, the data
+// is encrypted thus reading before the current position requires reading the
+// file again from the beginning
+type fileReader struct {
+	tree *inodeTree
+	path []string
+
+	mu  sync.Mutex
+	rc  io.ReadCloser
+	pos int64
+}
+
+func (t *inodeTree) openFile(path []string) *fileReader {
+	return &fileReader{tree: t, path: path}
+}
+
+// readAt reads up to size bytes at given offset, fewer bytes are only
+// returned at the end of the file
+func (f *fileReader) readAt(ctx context.Context, offset int64, size int) ([]byte, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.rc != nil && offset < f.pos {
+		f.rc.Close()
+		f.rc = nil
+	}
+
+	if f.rc == nil {
+		rc, err := f.tree.fs.OpenEntryData(ctx, f.path)
+		if err != nil {
+			return nil, err
+		}
+		f.rc, f.pos = rc, 0
+	}
+
+	if offset > f.pos {
+		n, err := io.CopyN(io.Discard, f.rc, offset-f.pos)
+		f.pos += n
+		if errors.Is(err, io.EOF) {
+			return []byte{}, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	buf := make([]byte, size)
+	n, err := io.ReadFull(f.rc, buf)
+	f.pos += int64(n)
+	if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return nil, err
+	}
+	return buf[:n], nil
+}
+
+func (f *fileReader) close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.rc == nil {
+		return nil
+	}
+	err := f.rc.Close()
+	f.rc = nil
+	return err
+}
@@ -0,0 +1,168 @@
+/*
+Copyright © 2023 Bartłomiej Święcki (byo)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fuse
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/cinode/go/pkg/blenc"
+	"github.com/cinode/go/pkg/cinodefs"
+	"github.com/cinode/go/pkg/cinodefs/protobuf"
+	"github.com/cinode/go/pkg/datastore"
+	"github.com/cinode/go/pkg/utilities/golang"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+)
+
+func testTree(t *testing.T) (*inodeTree, cinodefs.FS) {
+	ctx := context.Background()
+	fs, err := cinodefs.New(
+		ctx,
+		blenc.FromDatastore(datastore.InMemory()),
+		cinodefs.NewRootStaticDirectory(),
+	)
+	require.NoError(t, err)
+
+	_, err = fs.SetEntryFile(ctx, []string{"file.txt"}, strings.NewReader("Hello world"))
+	require.NoError(t, err)
+	_, err = fs.SetEntryFile(ctx, []string{"dir", "sub.txt"}, strings.NewReader("sub"))
+	require.NoError(t, err)
+	_, err = fs.InjectDynamicLink(ctx, []string{"dir"})
+	require.NoError(t, err)
+	require.NoError(t, fs.Flush(ctx))
+
+	return newInodeTree(fs), fs
+}
+
+func TestInodeTreeStat(t *testing.T) {
+	ctx := context.Background()
+	tree, _ := testTree(t)
+
+	root, err := tree.stat(ctx, []string{})
+	require.NoError(t, err)
+	require.True(t, root.isDir)
+	require.EqualValues(t, rootInode, root.inode)
+
+	file, err := tree.stat(ctx, []string{"file.txt"})
+	require.NoError(t, err)
+	require.False(t, file.isDir)
+	require.EqualValues(t, 11, file.size)
+	require.EqualValues(t, 0o444, file.mode)
+	require.NotEqual(t, root.inode, file.inode)
+
+	again, err := tree.stat(ctx, []string{"file.txt"})
+	require.NoError(t, err)
+	require.Equal(t, file.inode, again.inode)
+
+	dir, err := tree.stat(ctx, []string{"dir"})
+	require.NoError(t, err)
+	require.True(t, dir.isDir)
+
+	_, err = tree.stat(ctx, []string{"missing"})
+	require.ErrorIs(t, err, cinodefs.ErrEntryNotFound)
+
+	_, err = tree.stat(ctx, []string{"file.txt", "sub"})
+	require.ErrorIs(t, err, cinodefs.ErrNotADirectory)
+}
+
+func TestInodeTreeStatWithoutContentLength(t *testing.T) {
+	ctx := context.Background()
+	tree, fs := testTree(t)
+
+	ep, err := fs.FindEntry(ctx, []string{"file.txt"})
+	require.NoError(t, err)
+
+	// Strip the content length from the entrypoint
+	msg := &protobuf.Entrypoint{}
+	require.NoError(t, proto.Unmarshal(ep.Bytes(), msg))
+	msg.ContentLength = 0
+	legacyEP, err := cinodefs.EntrypointFromBytes(golang.Must(proto.Marshal(msg)))
+	require.NoError(t, err)
+	require.NoError(t, fs.SetEntry(ctx, []string{"legacy.txt"}, legacyEP))
+
+	file, err := tree.stat(ctx, []string{"legacy.txt"})
+	require.NoError(t, err)
+	require.False(t, file.isDir)
+	require.EqualValues(t, 11, file.size)
+}
+
+func TestInodeTreeReadDir(t *testing.T) {
+	ctx := context.Background()
+	tree, _ := testTree(t)
+
+	entries, err := tree.readDir(ctx, []string{})
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+
+	require.Equal(t, "dir", entries[0].name)
+	require.True(t, entries[0].isDir, "link target must be reported as a directory")
+	require.Equal(t, "file.txt", entries[1].name)
+	require.False(t, entries[1].isDir)
+
+	dir, err := tree.stat(ctx, []string{"dir"})
+	require.NoError(t, err)
+	require.Equal(t, dir.inode, entries[0].inode)
+
+	entries, err = tree.readDir(ctx, []string{"dir"})
+	require.NoError(t, err)
+	require.Equal(t, []dirent{{
+		name:  "sub.txt",
+		inode: tree.inode([]string{"dir", "sub.txt"}),
+	}}, entries)
+
+	_, err = tree.readDir(ctx, []string{"missing"})
+	require.ErrorIs(t, err, cinodefs.ErrEntryNotFound)
+}
+
+func TestFileReader(t *testing.T) {
+	ctx := context.Background()
+	tree, _ := testTree(t)
+
+	r := tree.openFile([]string{"file.txt"})
+	defer r.close()
+
+	for _, d := range []struct {
+		offset   int64
+		size     int
+		expected string
+	}{
+		{0, 5, "Hello"},
+		{6, 5, "world"},
+		{6, 100, "world"},
+		{2, 3, "llo"},
+		{0, 11, "Hello world"},
+		{11, 10, ""},
+		{20, 10, ""},
+		{4, 1, "o"},
+	} {
+		data, err := r.readAt(ctx, d.offset, d.size)
+		require.NoError(t, err)
+		require.Equal(t, d.expected, string(data))
+	}
+
+	require.NoError(t, r.close())
+	require.NoError(t, r.close())
+
+	data, err := r.readAt(ctx, 6, 5)
+	require.NoError(t, err)
+	require.Equal(t, "world", string(data))
+
+	_, err = tree.openFile([]string{"missing"}).readAt(ctx, 0, 1)
+	require.ErrorIs(t, err, cinodefs.ErrEntryNotFound)
+}
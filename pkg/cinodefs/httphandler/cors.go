@@ -0,0 +1,124 @@
+/*
+Copyright © 2023 Bartłomiej Święcki (byo)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package httphandler
+
+import (
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/exp/slog"
+)
+
+// CORSConfig contains the Cross-Origin Resource Sharing configuration
+type CORSConfig struct {
+	// AllowedOrigins is the list of origins allowed to access the content,
+	// the "*" entry allows any origin
+	AllowedOrigins []string
+
+	// AllowedMethods is the list of methods allowed in cross-origin requests,
+	// GET and HEAD are allowed if empty
+	AllowedMethods []string
+
+	// AllowedHeaders is the list of request headers allowed in cross-origin
+	// requests, only CORS-safelisted headers are allowed if empty
+	AllowedHeaders []string
+
+	// MaxAge is the time for which the preflight response can be cached,
+	// not sent if zero
+	MaxAge time.Duration
+}
+
+func (c *CORSConfig) allowsAnyOrigin() bool {
+	return slices.Contains(c.AllowedOrigins, "*")
+}
+
+func (c *CORSConfig) allowsOrigin(origin string) bool {
+	if origin == "" {
+		return false
+	}
+	if c.allowsAnyOrigin() {
+		return true
+	}
+	return slices.ContainsFunc(c.AllowedOrigins, func(o string) bool {
+		return strings.EqualFold(o, origin)
+	})
+}
+
+func (c *CORSConfig) allowedMethods() []string {
+	if len(c.AllowedMethods) == 0 {
+		return []string{http.MethodGet, http.MethodHead}
+	}
+	return c.AllowedMethods
+}
+
+func (c *CORSConfig) allowsMethod(method string) bool {
+	return slices.Contains(c.allowedMethods(), method)
+}
+
+// setAllowOrigin sets the header allowing the origin of the request to read
+// the response, returns false if the origin is not allowed
+func (c *CORSConfig) setAllowOrigin(w http.ResponseWriter, r *http.Request) bool {
+	if !c.allowsAnyOrigin() {
+		// Response depends on the origin of the request
+		w.Header().Add("Vary", "Origin")
+	}
+
+	origin := r.Header.Get("Origin")
+	if !c.allowsOrigin(origin) {
+		return false
+	}
+
+	if c.allowsAnyOrigin() {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+	} else {
+		w.Header().Set("Access-Control-Allow-Origin", origin)
+	}
+	return true
+}
+
+// isPreflightRequest checks whether the request is the CORS preflight one
+func isPreflightRequest(r *http.Request) bool {
+	return r.Method == http.MethodOptions &&
+		r.Header.Get("Origin") != "" &&
+		r.Header.Get("Access-Control-Request-Method") != ""
+}
+
+func (h *Handler) servePreflight(w http.ResponseWriter, r *http.Request, log *slog.Logger) {
+	if !h.CORS.setAllowOrigin(w, r) ||
+		!h.CORS.allowsMethod(r.Header.Get("Access-Control-Request-Method")) {
+		log.Warn("CORS preflight request not allowed",
+			"origin", r.Header.Get("Origin"),
+			"method", r.Header.Get("Access-Control-Request-Method"),
+		)
+		http.Error(w, "CORS request not allowed", http.StatusForbidden)
+		return
+	}
+
+	w.Header().Set("Access-Control-Allow-Methods", strings.Join(h.CORS.allowedMethods(), ", "))
+	if len(h.CORS.AllowedHeaders) > 0 {
+		w.Header().Set("Access-Control-Allow-Headers", strings.Join(h.CORS.AllowedHeaders, ", "))
+	}
+	if h.CORS.MaxAge > 0 {
+		w.Header().Set("Access-Control-Max-Age", strconv.FormatInt(int64(h.CORS.MaxAge/time.Second), 10))
+	}
+
+	log.Debug("CORS preflight request allowed")
+	w.WriteHeader(http.StatusNoContent)
+}
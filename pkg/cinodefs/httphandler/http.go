@@ -17,21 +17,143 @@ limitations under the License.
 package httphandler
 
 import (
+	"compress/gzip"
+	"context"
 	"crypto/sha256"
 	"errors"
 	"fmt"
 	"io"
+	"math"
+	"mime"
 	"net/http"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 
+	"github.com/cinode/go/pkg/blobtypes"
 	"github.com/cinode/go/pkg/cinodefs"
+	"github.com/cinode/go/pkg/common"
+	"github.com/cinode/go/pkg/datastore"
 	"golang.org/x/exp/slog"
 )
 
+const (
+	// RawBlobPathPrefix is the path prefix under which raw encrypted blobs
+	// are served if ExposeRawBlobs is enabled
+	RawBlobPathPrefix = "/.cinode/blob/"
+
+	// DownloadQueryParam is the query parameter requesting the file to be
+	// downloaded instead of being displayed inline if Downloads is enabled
+	DownloadQueryParam = "download"
+
+	// DownloadMetadataKey is the entry metadata key that, set to a true
+	// value, makes the file always downloaded if Downloads is enabled
+	DownloadMetadataKey = "download"
+
+	// DefaultUnavailableCacheTime is the time for which the dataset is
+	// considered unavailable once the root could not be read
+	DefaultUnavailableCacheTime = 10 * time.Second
+
+	// DefaultLinkVersionCacheTime is the time for which the content version
+	// of a dynamic link is cached
+	DefaultLinkVersionCacheTime = 10 * time.Second
+
+	// maxCachedLinkVersions limits the number of cached link versions
+	maxCachedLinkVersions = 1024
+)
+
+// minLinkVersionTime is the earliest link update time accepted as the
+// Last-Modified time, smaller link versions are assumed to be custom
+// counters that do not represent the time of the update
+var minLinkVersionTime = time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+
 type Handler struct {
 	FS        cinodefs.FS
 	IndexFile string
 	Log       *slog.Logger
+
+	// ExposeRawBlobs enables serving raw, encrypted blobs by their name
+	// under the RawBlobPathPrefix path. Blobs are read from the RawBlobs
+	// datastore which must be the one used by the FS.
+	//
+	// This allows clients to cache encrypted blobs and decrypt them locally.
+	ExposeRawBlobs bool
+	RawBlobs       datastore.DS
+
+	// DirectorySlashRedirect switches the redirect issued for directory
+	// paths without the trailing slash (e.g. `/dir` => `/dir/`) to a
+	// permanent one (301). By default the temporary redirect (307) is used.
+	DirectorySlashRedirect bool
+
+	// UnavailableHandler, if set, is used to serve a maintenance response
+	// when the root of the dataset can not be read, e.g. because the
+	// datastore is down. The response is sent with the 503 status code
+	// unless the handler sets a different error code and with the
+	// Retry-After header set. Once detected, the unavailability is cached
+	// for UnavailableCacheTime (DefaultUnavailableCacheTime if zero) to avoid
+	// hitting the failing datastore with every request.
+	UnavailableHandler   http.Handler
+	UnavailableCacheTime time.Duration
+
+	// Compression enables gzip compression of compressible content (text,
+	// json, javascript) for clients accepting it. Compressed responses use
+	// a separate ETag and are always sent in full, without range support.
+	Compression bool
+
+	// CacheControl, if set, is sent as the Cache-Control header of file
+	// responses. CacheControlByMimeType overrides it for selected mime types,
+	// mime type parameters such as charset are ignored when matching.
+	CacheControl           string
+	CacheControlByMimeType map[string]string
+
+	// ImmutableStaticEntries marks responses for static entries as immutable
+	// so that browsers skip revalidation entirely. The content of a static
+	// entry never changes for its blob name but the path may later point
+	// to a different entry, thus it should only be enabled for datasets
+	// where paths are not reused, e.g. with content-hashed file names.
+	ImmutableStaticEntries bool
+
+	// Downloads enables sending the `Content-Disposition: attachment` header
+	// so that the browser saves the file instead of displaying it. The header
+	// is sent if the request contains the DownloadQueryParam query parameter
+	// or if the entry has the DownloadMetadataKey metadata set. The file name
+	// is taken from the last segment of the path.
+	Downloads bool
+
+	// CORS, if set, enables cross-origin access to the content. Preflight
+	// OPTIONS requests are answered according to the configuration and
+	// responses to requests from allowed origins contain the
+	// Access-Control-Allow-Origin header. Disabled by default.
+	CORS *CORSConfig
+
+	// LinkVersionCacheTime is the time for which content versions of dynamic
+	// links are cached (DefaultLinkVersionCacheTime if zero). Versions of
+	// links followed to reach the entry are used as the Last-Modified time
+	// of entries without their own modification time. It should not exceed
+	// the link cache ttl of the FS, otherwise the header could lag behind
+	// the served content.
+	LinkVersionCacheTime time.Duration
+
+	unavailableMutex sync.Mutex
+	unavailableUntil time.Time
+	timeFunc         func() time.Time
+
+	linkVersionsMutex  sync.Mutex
+	linkVersions       map[string]cachedLinkVersion // keyed by the link blob name
+	linkVersionFetches map[string]*linkVersionFetch // fetches in progress
+}
+
+type cachedLinkVersion struct {
+	modTime time.Time // zero if the version does not represent time
+	expires time.Time
+}
+
+// linkVersionFetch is a link version read from the datastore, concurrent
+// requests for the same link wait for a single fetch
+type linkVersionFetch struct {
+	done    chan struct{}
+	modTime time.Time
 }
 
 func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
@@ -41,8 +163,18 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		slog.String("Method", r.Method),
 	)
 
+	if h.CORS != nil {
+		if isPreflightRequest(r) {
+			h.servePreflight(w, r, log)
+			return
+		}
+		h.CORS.setAllowOrigin(w, r)
+	}
+
 	switch r.Method {
-	case "GET":
+	case "GET", "HEAD":
+		// HEAD requests go through the same logic as GET ones
+		// except that the data is not read
 		h.serveGet(w, r, log)
 		return
 	default:
@@ -53,6 +185,16 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *Handler) serveGet(w http.ResponseWriter, r *http.Request, log *slog.Logger) {
+	if h.ExposeRawBlobs && strings.HasPrefix(r.URL.Path, RawBlobPathPrefix) {
+		h.serveRawBlob(w, r, log)
+		return
+	}
+
+	if h.isUnavailable() {
+		h.serveUnavailable(w, r, log)
+		return
+	}
+
 	path := r.URL.Path
 	if strings.HasSuffix(path, "/") {
 		path += h.IndexFile
@@ -70,19 +212,42 @@ func (h *Handler) serveGet(w http.ResponseWriter, r *http.Request, log *slog.Log
 		// Can't get the entrypoint, but since it's a directory
 		// (only with unsaved changes), redirect to the directory itself
 		// that will in the end load the index file if present.
-		http.Redirect(w, r, r.URL.Path+"/", http.StatusTemporaryRedirect)
+		h.redirectToDirectory(w, r, log)
+		return
+	case err != nil && h.checkUnavailable(r, log):
+		h.serveUnavailable(w, r, log)
 		return
 	case h.handleHttpError(err, w, log, "Error finding entrypoint"):
 		return
 	}
 
 	if fileEP.IsDir() {
-		http.Redirect(w, r, r.URL.Path+"/", http.StatusTemporaryRedirect)
+		h.redirectToDirectory(w, r, log)
 		return
 	}
 
-	if h.handleEtag(w, r, fileEP, log) {
-		// Client ETag matches, can optimize out the data
+	compress := false
+	if h.Compression && isCompressible(fileEP.MimeType()) {
+		// Response depends on the Accept-Encoding header even if not
+		// compressed for this particular request
+		w.Header().Add("Vary", "Accept-Encoding")
+		compress = acceptsGzip(r)
+	}
+
+	h.setCacheControl(w, fileEP)
+	h.setContentDisposition(w, r, fileEP, pathList[len(pathList)-1])
+	lastModified := h.lastModified(r, pathList, fileEP, log)
+	if !lastModified.IsZero() {
+		w.Header().Set("Last-Modified", lastModified.UTC().Format(http.TimeFormat))
+	}
+
+	if h.handleEtag(w, r, fileEP, compress, lastModified, log) {
+		// Client's copy is up to date, can optimize out the data
+		return
+	}
+
+	if r.Method == http.MethodHead {
+		h.serveHead(w, r, fileEP, compress)
 		return
 	}
 
@@ -93,10 +258,358 @@ func (h *Handler) serveGet(w http.ResponseWriter, r *http.Request, log *slog.Log
 	defer rc.Close()
 
 	w.Header().Set("Content-Type", fileEP.MimeType())
+	if compress {
+		h.serveCompressed(w, rc, log)
+		return
+	}
+
+	l := fileEP.ContentLength()
+	if l <= 0 {
+		// Entries created without recorded length are sent
+		// with chunked transfer encoding, ranges are not supported
+		// since the size is not known upfront
+		_, err = io.Copy(w, rc)
+		h.handleHttpError(err, w, log, "Error sending file")
+		return
+	}
+
+	w.Header().Set("Accept-Ranges", "bytes")
+	if start, end, ok := requestedRange(r, w.Header().Get("ETag"), l); ok {
+		h.servePartial(w, rc, start, end, l, log)
+		return
+	}
+
+	w.Header().Set("Content-Length", strconv.FormatInt(l, 10))
 	_, err = io.Copy(w, rc)
 	h.handleHttpError(err, w, log, "Error sending file")
 }
 
+// serveHead sends headers of the response that would be sent for the GET
+// request without reading the file data
+func (h *Handler) serveHead(
+	w http.ResponseWriter,
+	r *http.Request,
+	ep *cinodefs.Entrypoint,
+	compress bool,
+) {
+	w.Header().Set("Content-Type", ep.MimeType())
+	if compress {
+		// Size of the compressed data is not known without compressing it
+		w.Header().Set("Content-Encoding", "gzip")
+		return
+	}
+
+	l := ep.ContentLength()
+	if l <= 0 {
+		return
+	}
+
+	w.Header().Set("Accept-Ranges", "bytes")
+	if start, end, ok := requestedRange(r, w.Header().Get("ETag"), l); ok {
+		writePartialHeader(w, start, end, l)
+		return
+	}
+
+	w.Header().Set("Content-Length", strconv.FormatInt(l, 10))
+}
+
+// serveCompressed sends the whole file data compressed with gzip, the length
+// of the compressed data is not known upfront
+func (h *Handler) serveCompressed(w http.ResponseWriter, rc io.Reader, log *slog.Logger) {
+	w.Header().Set("Content-Encoding", "gzip")
+
+	gw := gzip.NewWriter(w)
+	_, err := io.Copy(gw, rc)
+	if err == nil {
+		err = gw.Close()
+	}
+	h.handleHttpError(err, w, log, "Error sending compressed file")
+}
+
+// isCompressible returns true for mime types that benefit from compression,
+// other types such as images are usually compressed already
+func isCompressible(mimeType string) bool {
+	mimeType, _, _ = strings.Cut(mimeType, ";")
+	mimeType = strings.ToLower(strings.TrimSpace(mimeType))
+
+	switch {
+	case strings.HasPrefix(mimeType, "text/"),
+		mimeType == "application/json",
+		mimeType == "application/javascript":
+		return true
+	}
+	return false
+}
+
+// acceptsGzip checks whether the client accepts gzip encoded content
+func acceptsGzip(r *http.Request) bool {
+	for _, header := range r.Header.Values("Accept-Encoding") {
+		for _, enc := range strings.Split(header, ",") {
+			name, params, _ := strings.Cut(enc, ";")
+			if !strings.EqualFold(strings.TrimSpace(name), "gzip") {
+				continue
+			}
+
+			q, found := strings.CutPrefix(strings.TrimSpace(params), "q=")
+			if !found {
+				return true
+			}
+			qVal, err := strconv.ParseFloat(q, 64)
+			return err == nil && qVal > 0
+		}
+	}
+	return false
+}
+
+// servePartial sends the inclusive range of the file data. The data is
+// an encrypted stream thus the content before the range start has to be
+// decrypted and discarded. The rest of the blob after the range is read
+// as well since the blob is only validated once all of its data is read.
+// If the validation fails, the response is aborted so that the client
+// does not end up with a successful response containing unverified data.
+func (h *Handler) servePartial(
+	w http.ResponseWriter,
+	rc io.Reader,
+	start, end, size int64,
+	log *slog.Logger,
+) {
+	_, err := io.CopyN(io.Discard, rc, start)
+	if h.handleHttpError(err, w, log, "Error skipping to the range start") {
+		return
+	}
+
+	writePartialHeader(w, start, end, size)
+
+	_, err = io.CopyN(w, rc, end-start+1)
+	if err != nil {
+		// Too late to send the error response
+		log.Error("Error sending file range", "err", err)
+		panic(http.ErrAbortHandler)
+	}
+
+	_, err = io.Copy(io.Discard, rc)
+	if err != nil {
+		log.Error("Error validating file data", "err", err)
+		panic(http.ErrAbortHandler)
+	}
+}
+
+func writePartialHeader(w http.ResponseWriter, start, end, size int64) {
+	w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, size))
+	w.Header().Set("Content-Length", strconv.FormatInt(end-start+1, 10))
+	w.WriteHeader(http.StatusPartialContent)
+}
+
+// requestedRange returns the inclusive byte range requested with the Range
+// header. Only a single range is supported, ok is false if there's no range,
+// the range can not be satisfied or the If-Range condition does not match
+// in which case the whole content should be sent.
+func requestedRange(r *http.Request, etag string, size int64) (start, end int64, ok bool) {
+	rangeHeader := r.Header.Get("Range")
+	if rangeHeader == "" {
+		return 0, 0, false
+	}
+	if ifRange := r.Header.Get("If-Range"); ifRange != "" && ifRange != etag {
+		return 0, 0, false
+	}
+
+	spec, found := strings.CutPrefix(rangeHeader, "bytes=")
+	if !found || strings.Contains(spec, ",") {
+		return 0, 0, false
+	}
+
+	startStr, endStr, found := strings.Cut(strings.TrimSpace(spec), "-")
+	if !found {
+		return 0, 0, false
+	}
+
+	if startStr == "" {
+		// Suffix range - last n bytes
+		n, err := strconv.ParseInt(endStr, 10, 64)
+		if err != nil || n <= 0 {
+			return 0, 0, false
+		}
+		if n > size {
+			n = size
+		}
+		return size - n, size - 1, true
+	}
+
+	start, err := strconv.ParseInt(startStr, 10, 64)
+	if err != nil || start < 0 || start >= size {
+		return 0, 0, false
+	}
+
+	end = size - 1
+	if endStr != "" {
+		end, err = strconv.ParseInt(endStr, 10, 64)
+		if err != nil || end < start {
+			return 0, 0, false
+		}
+		if end >= size {
+			end = size - 1
+		}
+	}
+
+	return start, end, true
+}
+
+func (h *Handler) now() time.Time {
+	if h.timeFunc != nil {
+		return h.timeFunc()
+	}
+	return time.Now()
+}
+
+func (h *Handler) unavailableCacheTime() time.Duration {
+	if h.UnavailableCacheTime > 0 {
+		return h.UnavailableCacheTime
+	}
+	return DefaultUnavailableCacheTime
+}
+
+func (h *Handler) isUnavailable() bool {
+	if h.UnavailableHandler == nil {
+		return false
+	}
+
+	h.unavailableMutex.Lock()
+	defer h.unavailableMutex.Unlock()
+
+	return h.now().Before(h.unavailableUntil)
+}
+
+// checkUnavailable checks whether the error while looking for an entry was
+// caused by the dataset root not being readable, the result is cached
+func (h *Handler) checkUnavailable(r *http.Request, log *slog.Logger) bool {
+	if h.UnavailableHandler == nil {
+		return false
+	}
+
+	_, err := h.FS.FindEntry(r.Context(), []string{})
+	if err == nil || errors.Is(err, cinodefs.ErrModifiedDirectory) {
+		return false
+	}
+
+	log.Error("Dataset root unavailable", "err", err)
+
+	h.unavailableMutex.Lock()
+	defer h.unavailableMutex.Unlock()
+
+	h.unavailableUntil = h.now().Add(h.unavailableCacheTime())
+	return true
+}
+
+func (h *Handler) serveUnavailable(w http.ResponseWriter, r *http.Request, log *slog.Logger) {
+	log.Warn("Dataset unavailable, serving maintenance response")
+
+	retryAfter := int64((h.unavailableCacheTime() + time.Second - 1) / time.Second)
+	w.Header().Set("Retry-After", strconv.FormatInt(retryAfter, 10))
+	w.Header().Set("Cache-Control", "no-store")
+	h.UnavailableHandler.ServeHTTP(&unavailableResponseWriter{ResponseWriter: w}, r)
+}
+
+// unavailableResponseWriter replaces success status codes with 503
+type unavailableResponseWriter struct {
+	http.ResponseWriter
+	wroteHeader bool
+}
+
+func (w *unavailableResponseWriter) WriteHeader(code int) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+
+	if code < 400 {
+		code = http.StatusServiceUnavailable
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *unavailableResponseWriter) Write(b []byte) (int, error) {
+	w.WriteHeader(http.StatusOK)
+	return w.ResponseWriter.Write(b)
+}
+
+// redirectToDirectory redirects to the directory path with the trailing slash
+// so that relative links in the index file are resolved against the directory
+func (h *Handler) redirectToDirectory(w http.ResponseWriter, r *http.Request, log *slog.Logger) {
+	code := http.StatusTemporaryRedirect
+	if h.DirectorySlashRedirect {
+		code = http.StatusMovedPermanently
+	}
+
+	log.Debug("Directory path without trailing slash, redirecting", "code", code)
+	http.Redirect(w, r, r.URL.Path+"/", code)
+}
+
+func (h *Handler) serveRawBlob(w http.ResponseWriter, r *http.Request, log *slog.Logger) {
+	if h.RawBlobs == nil {
+		log.Error("Raw blobs datastore not configured")
+		http.NotFound(w, r)
+		return
+	}
+
+	name, err := common.BlobNameFromString(strings.TrimPrefix(r.URL.Path, RawBlobPathPrefix))
+	if err != nil {
+		log.Warn("Invalid blob name", "err", err)
+		http.Error(w, "Invalid blob name", http.StatusBadRequest)
+		return
+	}
+
+	staticEtag := fmt.Sprintf("\"%s\"", name.String())
+	if name.Type() == blobtypes.Static &&
+		strings.Contains(r.Header.Get("If-None-Match"), staticEtag) {
+		// Static blob content never changes for given name
+		log.Debug("Valid ETag found, sending 304 Not Modified")
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	if r.Method == http.MethodHead {
+		size, err := h.RawBlobs.Size(r.Context(), name)
+		if errors.Is(err, datastore.ErrNotFound) {
+			log.Warn("Blob not found")
+			http.NotFound(w, r)
+			return
+		}
+		if h.handleHttpError(err, w, log, "Error checking blob size") {
+			return
+		}
+
+		setRawBlobHeaders(w, name, staticEtag)
+		w.Header().Set("Content-Length", strconv.FormatInt(size, 10))
+		return
+	}
+
+	rc, err := h.RawBlobs.Open(r.Context(), name)
+	if errors.Is(err, datastore.ErrNotFound) {
+		log.Warn("Blob not found")
+		http.NotFound(w, r)
+		return
+	}
+	if h.handleHttpError(err, w, log, "Error opening blob") {
+		return
+	}
+	defer rc.Close()
+
+	setRawBlobHeaders(w, name, staticEtag)
+	_, err = io.Copy(w, rc)
+	h.handleHttpError(err, w, log, "Error sending blob")
+}
+
+func setRawBlobHeaders(w http.ResponseWriter, name *common.BlobName, staticEtag string) {
+	if name.Type() == blobtypes.Static {
+		w.Header().Set("ETag", staticEtag)
+		w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	} else {
+		// Dynamic links can change at any time
+		w.Header().Set("Cache-Control", "no-cache")
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+}
+
 func (h *Handler) handleHttpError(err error, w http.ResponseWriter, log *slog.Logger, logMsg string) bool {
 	if err != nil {
 		log.Error(logMsg, "err", err)
@@ -109,15 +622,232 @@ func (h *Handler) handleHttpError(err error, w http.ResponseWriter, log *slog.Lo
 	return false
 }
 
-func (h *Handler) handleEtag(w http.ResponseWriter, r *http.Request, ep *cinodefs.Entrypoint, log *slog.Logger) bool {
+func (h *Handler) handleEtag(
+	w http.ResponseWriter,
+	r *http.Request,
+	ep *cinodefs.Entrypoint,
+	compressed bool,
+	lastModified time.Time,
+	log *slog.Logger,
+) bool {
 	currentEtag := fmt.Sprintf("\"%X\"", sha256.Sum256(ep.Bytes()))
+	if compressed {
+		// Compressed data is a different representation of the content
+		currentEtag = fmt.Sprintf("\"%X-gzip\"", sha256.Sum256(ep.Bytes()))
+	}
 
-	if strings.Contains(r.Header.Get("If-None-Match"), currentEtag) {
+	if etagMatches(r.Header.Get("If-None-Match"), currentEtag) {
 		log.Debug("Valid ETag found, sending 304 Not Modified")
 		w.WriteHeader(http.StatusNotModified)
 		return true
 	}
 
+	if r.Header.Get("If-None-Match") == "" && notModifiedSince(r, lastModified) {
+		// If-Modified-Since is only used without If-None-Match
+		log.Debug("Not modified since the client's copy, sending 304 Not Modified")
+		w.WriteHeader(http.StatusNotModified)
+		return true
+	}
+
 	w.Header().Set("ETag", currentEtag)
 	return false
 }
+
+// notModifiedSince checks whether the content was not modified since the time
+// sent in the If-Modified-Since header, the header has a one second precision
+func notModifiedSince(r *http.Request, lastModified time.Time) bool {
+	if lastModified.IsZero() {
+		return false
+	}
+
+	since, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+	if err != nil {
+		return false
+	}
+
+	return !lastModified.Truncate(time.Second).After(since)
+}
+
+func (h *Handler) setCacheControl(w http.ResponseWriter, ep *cinodefs.Entrypoint) {
+	if h.ImmutableStaticEntries && ep.BlobName().Type() == blobtypes.Static {
+		w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+		return
+	}
+
+	mimeType, _, _ := strings.Cut(ep.MimeType(), ";")
+	mimeType = strings.ToLower(strings.TrimSpace(mimeType))
+	if cc, found := h.CacheControlByMimeType[mimeType]; found {
+		w.Header().Set("Cache-Control", cc)
+		return
+	}
+
+	if h.CacheControl != "" {
+		w.Header().Set("Cache-Control", h.CacheControl)
+	}
+}
+
+func (h *Handler) setContentDisposition(
+	w http.ResponseWriter,
+	r *http.Request,
+	ep *cinodefs.Entrypoint,
+	fileName string,
+) {
+	if !h.Downloads {
+		return
+	}
+
+	download := r.URL.Query().Has(DownloadQueryParam)
+	if !download {
+		download, _ = strconv.ParseBool(ep.Metadata()[DownloadMetadataKey])
+	}
+	if !download {
+		return
+	}
+
+	disposition := "attachment"
+	if fileName != "" {
+		// Properly escapes the name, including non-ASCII characters
+		disposition = mime.FormatMediaType(disposition, map[string]string{"filename": fileName})
+	}
+	w.Header().Set("Content-Disposition", disposition)
+}
+
+// lastModified returns the modification time of the entry. If the entry does
+// not have one, the most recent content version of dynamic links followed to
+// reach the entry is used instead, link versions are by default the time of
+// the update in microseconds.
+// Zero time is returned if the modification time is not known.
+func (h *Handler) lastModified(
+	r *http.Request,
+	path []string,
+	ep *cinodefs.Entrypoint,
+	log *slog.Logger,
+) time.Time {
+	if modTime := ep.ModTime(); !modTime.IsZero() {
+		return modTime
+	}
+
+	// Content of the entry only changes if one of links on the path is
+	// updated, links closer to the entry may be updated independently of the
+	// root and outer links may switch to an older link, thus the most recent
+	// update of all of them is used
+	links, err := h.FS.PathLinks(r.Context(), path)
+	if err != nil {
+		log.Debug("Could not get links of the path", "err", err)
+		return time.Time{}
+	}
+
+	ret := time.Time{}
+	for _, link := range links {
+		modTime := h.linkModTime(r.Context(), link, log)
+		if modTime.IsZero() {
+			// Can not tell when the link was updated
+			return time.Time{}
+		}
+		if modTime.After(ret) {
+			ret = modTime
+		}
+	}
+	return ret
+}
+
+// linkModTime returns the update time of the link, the value is cached to
+// avoid reading the link blob with every request
+func (h *Handler) linkModTime(ctx context.Context, linkEP *cinodefs.Entrypoint, log *slog.Logger) time.Time {
+	link := linkEP.BlobName().String()
+
+	h.linkVersionsMutex.Lock()
+	if cached, found := h.linkVersions[link]; found && h.now().Before(cached.expires) {
+		h.linkVersionsMutex.Unlock()
+		return cached.modTime
+	}
+	fetch, inProgress := h.linkVersionFetches[link]
+	if !inProgress {
+		fetch = &linkVersionFetch{done: make(chan struct{})}
+		if h.linkVersionFetches == nil {
+			h.linkVersionFetches = map[string]*linkVersionFetch{}
+		}
+		h.linkVersionFetches[link] = fetch
+	}
+	h.linkVersionsMutex.Unlock()
+
+	if inProgress {
+		select {
+		case <-ctx.Done():
+			return time.Time{}
+		case <-fetch.done:
+			return fetch.modTime
+		}
+	}
+
+	// The datastore is accessed without holding the lock, requests for
+	// other links or with cached versions are not blocked
+	version, err := h.FS.EntrypointContentVersion(ctx, linkEP)
+	if err != nil {
+		log.Debug("Could not get the link content version", "link", link, "err", err)
+	} else {
+		fetch.modTime = linkVersionModTime(version, h.now())
+	}
+
+	h.linkVersionsMutex.Lock()
+	delete(h.linkVersionFetches, link)
+	if err == nil {
+		h.cacheLinkVersionLocked(link, fetch.modTime)
+	}
+	h.linkVersionsMutex.Unlock()
+
+	close(fetch.done)
+	return fetch.modTime
+}
+
+// linkVersionModTime converts the link content version to the update time,
+// link versions are by default the time of the update in microseconds, zero
+// time is returned for custom versions not representing the update time
+func linkVersionModTime(version uint64, now time.Time) time.Time {
+	if version > math.MaxInt64 {
+		return time.Time{}
+	}
+
+	modTime := time.UnixMicro(int64(version))
+	if modTime.Before(minLinkVersionTime) || modTime.After(now) {
+		return time.Time{}
+	}
+	return modTime
+}
+
+func (h *Handler) cacheLinkVersionLocked(link string, modTime time.Time) {
+	now := h.now()
+
+	cacheTime := h.LinkVersionCacheTime
+	if cacheTime <= 0 {
+		cacheTime = DefaultLinkVersionCacheTime
+	}
+
+	if len(h.linkVersions) >= maxCachedLinkVersions {
+		for name, cached := range h.linkVersions {
+			if !now.Before(cached.expires) {
+				delete(h.linkVersions, name)
+			}
+		}
+		if len(h.linkVersions) >= maxCachedLinkVersions {
+			clear(h.linkVersions)
+		}
+	}
+	if h.linkVersions == nil {
+		h.linkVersions = map[string]cachedLinkVersion{}
+	}
+	h.linkVersions[link] = cachedLinkVersion{modTime: modTime, expires: now.Add(cacheTime)}
+}
+
+// etagMatches checks whether the list of ETags from the If-None-Match header
+// contains given ETag, substring matches are not enough since ETags of
+// compressed content contain the ETag of the uncompressed one
+func etagMatches(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == etag {
+			return true
+		}
+	}
+	return false
+}
@@ -18,22 +18,29 @@ package httphandler
 
 import (
 	"bytes"
+	"compress/gzip"
 	"context"
 	"errors"
 	"io"
+	"mime"
 	"net/http"
 	"net/http/httptest"
 	"strings"
+	"sync/atomic"
 	"testing"
 	"testing/iotest"
+	"time"
 
 	"github.com/cinode/go/pkg/blenc"
 	"github.com/cinode/go/pkg/cinodefs"
+	"github.com/cinode/go/pkg/cinodefs/protobuf"
 	"github.com/cinode/go/pkg/common"
 	"github.com/cinode/go/pkg/datastore"
+	"github.com/cinode/go/pkg/utilities/golang"
 	"github.com/stretchr/testify/require"
 	"github.com/stretchr/testify/suite"
 	"golang.org/x/exp/slog"
+	"google.golang.org/protobuf/proto"
 )
 
 type mockDatastore struct {
@@ -131,6 +138,59 @@ func (s *HandlerTestSuite) TestSuccessfulFileDownload() {
 	require.Equal(s.T(), "hello", readBack)
 }
 
+func (s *HandlerTestSuite) TestContentLength() {
+	s.setEntry(s.T(), "hello world", "file.txt")
+	s.setEntry(s.T(), "", "empty.txt")
+
+	for _, d := range []struct {
+		path   string
+		length int64
+	}{
+		{"/file.txt", 11},
+		{"/empty.txt", 0},
+	} {
+		s.T().Run(d.path, func(t *testing.T) {
+			resp, err := http.Get(s.server.URL + d.path)
+			require.NoError(t, err)
+			defer resp.Body.Close()
+
+			require.Equal(t, http.StatusOK, resp.StatusCode)
+			require.Equal(t, d.length, resp.ContentLength)
+			require.Empty(t, resp.TransferEncoding)
+		})
+	}
+
+	s.T().Run("legacy entry without length", func(t *testing.T) {
+		// Content must exceed the response buffer, otherwise the length
+		// of short responses is filled in by the http server
+		content := strings.Repeat("hello world", 10000)
+		s.setEntry(t, content, "large.txt")
+
+		ep, err := s.fs.FindEntry(context.Background(), []string{"large.txt"})
+		require.NoError(t, err)
+		require.EqualValues(t, len(content), ep.ContentLength())
+
+		// Strip the content length from the entrypoint
+		msg := &protobuf.Entrypoint{}
+		require.NoError(t, proto.Unmarshal(ep.Bytes(), msg))
+		msg.ContentLength = 0
+		legacyEP, err := cinodefs.EntrypointFromBytes(golang.Must(proto.Marshal(msg)))
+		require.NoError(t, err)
+		require.NoError(t, s.fs.SetEntry(context.Background(), []string{"legacy.txt"}, legacyEP))
+
+		resp, err := http.Get(s.server.URL + "/legacy.txt")
+		require.NoError(t, err)
+		defer resp.Body.Close()
+
+		data, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		require.EqualValues(t, -1, resp.ContentLength)
+		require.Equal(t, []string{"chunked"}, resp.TransferEncoding)
+		require.Equal(t, content, string(data))
+	})
+}
+
 func (s *HandlerTestSuite) TestEtag() {
 	s.setEntry(s.T(), "hello", "file.txt")
 
@@ -153,6 +213,225 @@ func (s *HandlerTestSuite) TestEtag() {
 	require.Equal(s.T(), "updated", readBack)
 }
 
+func (s *HandlerTestSuite) TestRange() {
+	content := "0123456789abcdefghij"
+	s.setEntry(s.T(), content, "file.txt")
+
+	_, _, etag, _ := s.getEntryETag(s.T(), "/file.txt", "")
+
+	get := func(t *testing.T, headers map[string]string) *http.Response {
+		req, err := http.NewRequest(http.MethodGet, s.server.URL+"/file.txt", nil)
+		require.NoError(t, err)
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		t.Cleanup(func() { resp.Body.Close() })
+		return resp
+	}
+
+	for _, d := range []struct {
+		rangeHeader  string
+		contentRange string
+		data         string
+	}{
+		{"bytes=0-4", "bytes 0-4/20", "01234"},
+		{"bytes=5-9", "bytes 5-9/20", "56789"},
+		{"bytes=15-", "bytes 15-19/20", "fghij"},
+		{"bytes=-3", "bytes 17-19/20", "hij"},
+		{"bytes=-100", "bytes 0-19/20", content},
+		{"bytes=18-100", "bytes 18-19/20", "ij"},
+		{"bytes=19-19", "bytes 19-19/20", "j"},
+	} {
+		s.T().Run(d.rangeHeader, func(t *testing.T) {
+			resp := get(t, map[string]string{"Range": d.rangeHeader})
+			data, err := io.ReadAll(resp.Body)
+			require.NoError(t, err)
+
+			require.Equal(t, http.StatusPartialContent, resp.StatusCode)
+			require.Equal(t, d.contentRange, resp.Header.Get("Content-Range"))
+			require.EqualValues(t, len(d.data), resp.ContentLength)
+			require.Equal(t, etag, resp.Header.Get("ETag"))
+			require.Equal(t, d.data, string(data))
+		})
+	}
+
+	for _, rangeHeader := range []string{
+		"",
+		"bytes=20-",
+		"bytes=5-2",
+		"bytes=-0",
+		"bytes=0-1,5-6",
+		"bytes=a-b",
+		"bytes=5",
+		"items=0-4",
+	} {
+		s.T().Run("full response for "+rangeHeader, func(t *testing.T) {
+			resp := get(t, map[string]string{"Range": rangeHeader})
+			data, err := io.ReadAll(resp.Body)
+			require.NoError(t, err)
+
+			require.Equal(t, http.StatusOK, resp.StatusCode)
+			require.Equal(t, "bytes", resp.Header.Get("Accept-Ranges"))
+			require.Empty(t, resp.Header.Get("Content-Range"))
+			require.EqualValues(t, len(content), resp.ContentLength)
+			require.Equal(t, content, string(data))
+		})
+	}
+
+	s.T().Run("if-range", func(t *testing.T) {
+		resp := get(t, map[string]string{"Range": "bytes=0-4", "If-Range": etag})
+		require.Equal(t, http.StatusPartialContent, resp.StatusCode)
+
+		resp = get(t, map[string]string{"Range": "bytes=0-4", "If-Range": `"outdated"`})
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+	})
+
+	s.T().Run("if-none-match", func(t *testing.T) {
+		resp := get(t, map[string]string{"Range": "bytes=0-4", "If-None-Match": etag})
+		require.Equal(t, http.StatusNotModified, resp.StatusCode)
+	})
+
+	s.T().Run("corrupted blob", func(t *testing.T) {
+		s.ds.openFunc = func(ctx context.Context, name *common.BlobName) (io.ReadCloser, error) {
+			rc, err := s.ds.DS.Open(ctx, name)
+			require.NoError(t, err)
+			defer rc.Close()
+			data, err := io.ReadAll(rc)
+			require.NoError(t, err)
+			data[len(data)-1] ^= 0xFF
+			return io.NopCloser(bytes.NewReader(data)), nil
+		}
+		t.Cleanup(func() { s.ds.openFunc = nil })
+
+		req, err := http.NewRequest(http.MethodGet, s.server.URL+"/file.txt", nil)
+		require.NoError(t, err)
+		req.Header.Set("Range", "bytes=0-4")
+
+		resp, err := http.DefaultClient.Do(req)
+		if err == nil {
+			defer resp.Body.Close()
+			_, err = io.ReadAll(resp.Body)
+		}
+		require.Error(t, err)
+		require.Contains(t, s.logData.String(), "Error validating file data")
+	})
+}
+
+func (s *HandlerTestSuite) TestCompression() {
+	content := strings.Repeat("compressible text content ", 100)
+	s.setEntry(s.T(), content, "file.txt")
+	s.setEntry(s.T(), `{"key": "value"}`, "data.json")
+	s.setEntry(s.T(), "\x89PNG\r\n\x1a\n"+content, "image.png")
+
+	get := func(t *testing.T, path string, headers map[string]string) (*http.Response, string) {
+		req, err := http.NewRequest(http.MethodGet, s.server.URL+path, nil)
+		require.NoError(t, err)
+		for k, v := range headers {
+			// Explicit Accept-Encoding disables transparent decompression
+			req.Header.Set(k, v)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+
+		var body io.Reader = resp.Body
+		if resp.Header.Get("Content-Encoding") == "gzip" {
+			gr, err := gzip.NewReader(resp.Body)
+			require.NoError(t, err)
+			body = gr
+		}
+		data, err := io.ReadAll(body)
+		require.NoError(t, err)
+		return resp, string(data)
+	}
+
+	gzipHeaders := map[string]string{"Accept-Encoding": "gzip, deflate"}
+	identityHeaders := map[string]string{"Accept-Encoding": "identity"}
+
+	s.T().Run("disabled by default", func(t *testing.T) {
+		resp, data := get(t, "/file.txt", gzipHeaders)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		require.Empty(t, resp.Header.Get("Content-Encoding"))
+		require.Empty(t, resp.Header.Get("Vary"))
+		require.Equal(t, content, data)
+	})
+
+	s.handler.Compression = true
+
+	resp, _ := get(s.T(), "/file.txt", identityHeaders)
+	identityEtag := resp.Header.Get("ETag")
+
+	s.T().Run("compressed response", func(t *testing.T) {
+		resp, data := get(t, "/file.txt", gzipHeaders)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		require.Equal(t, "gzip", resp.Header.Get("Content-Encoding"))
+		require.Equal(t, "Accept-Encoding", resp.Header.Get("Vary"))
+		require.Equal(t, "text/plain; charset=utf-8", resp.Header.Get("Content-Type"))
+		require.Empty(t, resp.Header.Get("Accept-Ranges"))
+		require.Less(t, resp.ContentLength, int64(len(content)))
+		require.Equal(t, content, data)
+
+		gzipEtag := resp.Header.Get("ETag")
+		require.NotEmpty(t, gzipEtag)
+		require.NotEqual(t, identityEtag, gzipEtag)
+
+		resp, _ = get(t, "/file.txt", map[string]string{"Accept-Encoding": "gzip", "If-None-Match": gzipEtag})
+		require.Equal(t, http.StatusNotModified, resp.StatusCode)
+
+		// ETag of the compressed content does not match the identity one
+		resp, data = get(t, "/file.txt", map[string]string{"Accept-Encoding": "gzip", "If-None-Match": identityEtag})
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		require.Equal(t, content, data)
+
+		resp, _ = get(t, "/file.txt", map[string]string{"Accept-Encoding": "identity", "If-None-Match": gzipEtag})
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+	})
+
+	s.T().Run("json", func(t *testing.T) {
+		resp, data := get(t, "/data.json", gzipHeaders)
+		require.Equal(t, "gzip", resp.Header.Get("Content-Encoding"))
+		require.Equal(t, `{"key": "value"}`, data)
+	})
+
+	s.T().Run("gzip not accepted", func(t *testing.T) {
+		for _, headers := range []map[string]string{
+			identityHeaders,
+			{"Accept-Encoding": "gzip;q=0, deflate"},
+			{"Accept-Encoding": "br"},
+		} {
+			resp, data := get(t, "/file.txt", headers)
+			require.Equal(t, http.StatusOK, resp.StatusCode)
+			require.Empty(t, resp.Header.Get("Content-Encoding"))
+			require.Equal(t, "Accept-Encoding", resp.Header.Get("Vary"))
+			require.Equal(t, identityEtag, resp.Header.Get("ETag"))
+			require.EqualValues(t, len(content), resp.ContentLength)
+			require.Equal(t, content, data)
+		}
+	})
+
+	s.T().Run("not compressible", func(t *testing.T) {
+		resp, data := get(t, "/image.png", gzipHeaders)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		require.Equal(t, "image/png", resp.Header.Get("Content-Type"))
+		require.Empty(t, resp.Header.Get("Content-Encoding"))
+		require.Empty(t, resp.Header.Get("Vary"))
+		require.Equal(t, "\x89PNG\r\n\x1a\n"+content, data)
+	})
+
+	s.T().Run("range request", func(t *testing.T) {
+		resp, data := get(t, "/file.txt", map[string]string{"Accept-Encoding": "gzip", "Range": "bytes=0-4"})
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		require.Equal(t, "gzip", resp.Header.Get("Content-Encoding"))
+		require.Equal(t, content, data)
+
+		resp, data = get(t, "/file.txt", map[string]string{"Accept-Encoding": "identity", "Range": "bytes=0-4"})
+		require.Equal(t, http.StatusPartialContent, resp.StatusCode)
+		require.Equal(t, content[:5], data)
+	})
+}
+
 func (s *HandlerTestSuite) TestNonGetRequest() {
 	t := s.T()
 	resp, err := http.Post(s.server.URL, "text/plain", strings.NewReader("Hello world!"))
@@ -161,6 +440,101 @@ func (s *HandlerTestSuite) TestNonGetRequest() {
 	require.Equal(t, http.StatusMethodNotAllowed, resp.StatusCode)
 }
 
+func (s *HandlerTestSuite) TestHead() {
+	s.setEntry(s.T(), "hello world", "file.txt")
+	s.setEntry(s.T(), "<html></html>", "dir", "index.html")
+
+	head := func(t *testing.T, path string, headers map[string]string) *http.Response {
+		req, err := http.NewRequest(http.MethodHead, s.server.URL+path, nil)
+		require.NoError(t, err)
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		client := &http.Client{
+			CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+		}
+		resp, err := client.Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+		return resp
+	}
+
+	// Data must not be read for HEAD requests
+	s.ds.openFunc = func(ctx context.Context, name *common.BlobName) (io.ReadCloser, error) {
+		return nil, errors.New("data read for HEAD request")
+	}
+	defer func() { s.ds.openFunc = nil }()
+
+	s.T().Run("file", func(t *testing.T) {
+		resp := head(t, "/file.txt", nil)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		require.EqualValues(t, 11, resp.ContentLength)
+		require.Equal(t, "text/plain; charset=utf-8", resp.Header.Get("Content-Type"))
+		require.Equal(t, "bytes", resp.Header.Get("Accept-Ranges"))
+		require.NotEmpty(t, resp.Header.Get("ETag"))
+
+		resp = head(t, "/file.txt", map[string]string{"If-None-Match": resp.Header.Get("ETag")})
+		require.Equal(t, http.StatusNotModified, resp.StatusCode)
+	})
+
+	s.T().Run("range", func(t *testing.T) {
+		resp := head(t, "/file.txt", map[string]string{"Range": "bytes=6-"})
+		require.Equal(t, http.StatusPartialContent, resp.StatusCode)
+		require.EqualValues(t, 5, resp.ContentLength)
+		require.Equal(t, "bytes 6-10/11", resp.Header.Get("Content-Range"))
+	})
+
+	s.T().Run("compressed", func(t *testing.T) {
+		s.handler.Compression = true
+		defer func() { s.handler.Compression = false }()
+
+		resp := head(t, "/file.txt", map[string]string{"Accept-Encoding": "gzip"})
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		require.Equal(t, "gzip", resp.Header.Get("Content-Encoding"))
+		require.True(t, strings.HasSuffix(resp.Header.Get("ETag"), "-gzip\""))
+	})
+
+	s.T().Run("directory redirect", func(t *testing.T) {
+		resp := head(t, "/dir", nil)
+		require.Equal(t, http.StatusTemporaryRedirect, resp.StatusCode)
+		require.Equal(t, "/dir/", resp.Header.Get("Location"))
+
+		resp = head(t, "/dir/", nil)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		require.EqualValues(t, 13, resp.ContentLength)
+	})
+
+	s.T().Run("not found", func(t *testing.T) {
+		resp := head(t, "/missing.txt", nil)
+		require.Equal(t, http.StatusNotFound, resp.StatusCode)
+	})
+
+	s.T().Run("raw blob", func(t *testing.T) {
+		s.ds.openFunc = nil
+		require.NoError(t, s.fs.Flush(context.Background()))
+		ep, err := s.fs.FindEntry(context.Background(), []string{"file.txt"})
+		require.NoError(t, err)
+		size, err := s.ds.Size(context.Background(), ep.BlobName())
+		require.NoError(t, err)
+
+		s.handler.ExposeRawBlobs = true
+		s.handler.RawBlobs = &s.ds
+		defer func() {
+			s.handler.ExposeRawBlobs = false
+			s.handler.RawBlobs = nil
+		}()
+
+		resp := head(t, RawBlobPathPrefix+ep.BlobName().String(), nil)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		require.Equal(t, size, resp.ContentLength)
+		require.Equal(t, "application/octet-stream", resp.Header.Get("Content-Type"))
+		require.NotEmpty(t, resp.Header.Get("ETag"))
+
+		resp = head(t, RawBlobPathPrefix+"KDc2ijtWc9mGxb5hP29YSBgkMLH8wCWnVimpvP3M6jdAk", nil)
+		require.Equal(t, http.StatusNotFound, resp.StatusCode)
+	})
+}
+
 func (s *HandlerTestSuite) TestNotFound() {
 	_, err := s.fs.SetEntryFile(context.Background(), []string{"hello.txt"}, strings.NewReader("hello"))
 	require.NoError(s.T(), err)
@@ -185,10 +559,63 @@ func (s *HandlerTestSuite) TestReadIndexFile() {
 	}
 }
 
+func (s *HandlerTestSuite) TestDirectorySlashRedirect() {
+	s.setEntry(s.T(), "hello", "dir", "index.html")
+	s.setEntry(s.T(), "file", "file.txt")
+	require.NoError(s.T(), s.fs.Flush(context.Background()))
+
+	client := &http.Client{
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	get := func(t *testing.T, path string) (int, string) {
+		resp, err := client.Get(s.server.URL + path)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		return resp.StatusCode, resp.Header.Get("Location")
+	}
+
+	s.T().Run("temporary redirect by default", func(t *testing.T) {
+		code, location := get(t, "/dir")
+		require.Equal(t, http.StatusTemporaryRedirect, code)
+		require.Equal(t, "/dir/", location)
+	})
+
+	s.handler.DirectorySlashRedirect = true
+	defer func() { s.handler.DirectorySlashRedirect = false }()
+
+	s.T().Run("permanent redirect for directory", func(t *testing.T) {
+		code, location := get(t, "/dir")
+		require.Equal(t, http.StatusMovedPermanently, code)
+		require.Equal(t, "/dir/", location)
+
+		readBack := s.getData(t, "/dir")
+		require.Equal(t, "hello", readBack)
+	})
+
+	s.T().Run("permanent redirect for modified directory", func(t *testing.T) {
+		s.setEntry(t, "world", "dir", "other.html")
+		defer func() { require.NoError(t, s.fs.Flush(context.Background())) }()
+
+		code, location := get(t, "/dir")
+		require.Equal(t, http.StatusMovedPermanently, code)
+		require.Equal(t, "/dir/", location)
+	})
+
+	s.T().Run("no redirect for files", func(t *testing.T) {
+		for _, path := range []string{"/dir/", "/dir/index.html", "/file.txt"} {
+			code, location := get(t, path)
+			require.Equal(t, http.StatusOK, code, path)
+			require.Empty(t, location, path)
+		}
+	})
+}
+
 func (s *HandlerTestSuite) TestReadErrors() {
 	// Strictly controlled list of blob ids accessed, if at any time blob names
 	// would change, that would mean change in blob hashing algorithm
-	const bNameDir = "KAJgH9GYbmHxp4MUZvLswDh4t2TjTfVECAMmmv7MAzSZF"
+	const bNameDir = "h3H8QH5v9VKjBcWvcECEwEKvpY4RZ3X1gcjFD19LFdHgD"
 	const bNameFile = "pKFmwKyCeLeHjFRiwhGaajuhupPg5tS61tcL6F7sjBHRW"
 
 	s.setEntry(s.T(), "hello", "file.txt")
@@ -261,7 +688,7 @@ func (s *HandlerTestSuite) TestReadErrors() {
 				return s.ds.DS.Open(ctx, name)
 			case bNameFile:
 				return io.NopCloser(io.MultiReader(
-					strings.NewReader("hello world!"),
+					strings.NewReader("hel"),
 					iotest.ErrReader(mockErr),
 				)), nil
 			default:
@@ -270,10 +697,642 @@ func (s *HandlerTestSuite) TestReadErrors() {
 		}
 		defer func() { s.ds.openFunc = nil }()
 
-		content, _, _ := s.getEntry(t, "/file.txt")
+		resp, err := http.Get(s.server.URL + "/file.txt")
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		require.EqualValues(t, len("hello"), resp.ContentLength)
+
 		// Since headers were already sent, there's no way to report back an error,
-		// we can only check if logs contain some error information
+		// the client detects truncated data thanks to the content length
+		_, err = io.ReadAll(resp.Body)
+		require.ErrorIs(t, err, io.ErrUnexpectedEOF)
+		require.Contains(t, s.logData.String(), mockErr.Error())
+	})
+}
+
+func (s *HandlerTestSuite) TestRawBlobs() {
+	s.setEntry(s.T(), "hello", "file.txt")
+	require.NoError(s.T(), s.fs.Flush(context.Background()))
+
+	ep, err := s.fs.FindEntry(context.Background(), []string{"file.txt"})
+	require.NoError(s.T(), err)
+	rawPath := RawBlobPathPrefix + ep.BlobName().String()
+
+	s.T().Run("disabled by default", func(t *testing.T) {
+		_, _, code := s.getEntry(t, rawPath)
+		require.Equal(t, http.StatusNotFound, code)
+	})
+
+	s.handler.ExposeRawBlobs = true
+	defer func() {
+		s.handler.ExposeRawBlobs = false
+		s.handler.RawBlobs = nil
+	}()
+
+	s.T().Run("missing datastore", func(t *testing.T) {
+		_, _, code := s.getEntry(t, rawPath)
+		require.Equal(t, http.StatusNotFound, code)
+	})
+
+	s.handler.RawBlobs = &s.ds
+
+	s.T().Run("serve raw blob", func(t *testing.T) {
+		rc, err := s.ds.Open(context.Background(), ep.BlobName())
+		require.NoError(t, err)
+		expected, err := io.ReadAll(rc)
+		require.NoError(t, err)
+		require.NoError(t, rc.Close())
+
+		data, contentType, etag, code := s.getEntryETag(t, rawPath, "")
+		require.Equal(t, http.StatusOK, code)
+		require.Equal(t, "application/octet-stream", contentType)
+		require.Equal(t, string(expected), data)
+		require.NotEqual(t, "hello", data)
+
+		_, _, _, code = s.getEntryETag(t, rawPath, etag)
+		require.Equal(t, http.StatusNotModified, code)
+	})
+
+	s.T().Run("serve raw dynamic link", func(t *testing.T) {
+		_, err := s.fs.InjectDynamicLink(context.Background(), []string{})
+		require.NoError(t, err)
+		require.NoError(t, s.fs.Flush(context.Background()))
+
+		rootEP, err := s.fs.RootEntrypoint()
+		require.NoError(t, err)
+
+		resp, err := http.Get(s.server.URL + RawBlobPathPrefix + rootEP.BlobName().String())
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		require.Equal(t, "no-cache", resp.Header.Get("Cache-Control"))
+		require.Empty(t, resp.Header.Get("ETag"))
+	})
+
+	s.T().Run("invalid blob name", func(t *testing.T) {
+		_, _, code := s.getEntry(t, RawBlobPathPrefix+"not-a-blob-name")
+		require.Equal(t, http.StatusBadRequest, code)
+	})
+
+	s.T().Run("blob not found", func(t *testing.T) {
+		_, _, code := s.getEntry(t, RawBlobPathPrefix+"KDc2ijtWc9mGxb5hP29YSBgkMLH8wCWnVimpvP3M6jdAk")
+		require.Equal(t, http.StatusNotFound, code)
+	})
+
+	s.T().Run("open error", func(t *testing.T) {
+		mockErr := errors.New("mock error raw blob")
+		s.ds.openFunc = func(ctx context.Context, name *common.BlobName) (io.ReadCloser, error) {
+			return nil, mockErr
+		}
+		defer func() { s.ds.openFunc = nil }()
+
+		_, _, code := s.getEntry(t, rawPath)
+		require.Equal(t, http.StatusInternalServerError, code)
+		require.Contains(t, s.logData.String(), mockErr.Error())
+	})
+}
+
+func (s *HandlerTestSuite) TestUnavailableHandler() {
+	s.setEntry(s.T(), "hello", "file.txt")
+	require.NoError(s.T(), s.fs.Flush(context.Background()))
+
+	mockErr := errors.New("mock datastore down")
+	failing := true
+	s.ds.openFunc = func(ctx context.Context, name *common.BlobName) (io.ReadCloser, error) {
+		if failing {
+			return nil, mockErr
+		}
+		return s.ds.DS.Open(ctx, name)
+	}
+	defer func() { s.ds.openFunc = nil }()
+
+	s.T().Run("no unavailable handler", func(t *testing.T) {
+		_, _, code := s.getEntry(t, "/file.txt")
+		require.Equal(t, http.StatusInternalServerError, code)
+	})
+
+	now := time.Now()
+	s.handler.timeFunc = func() time.Time { return now }
+	s.handler.UnavailableCacheTime = 30 * time.Second
+	s.handler.UnavailableHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("maintenance"))
+	})
+
+	s.T().Run("root not readable", func(t *testing.T) {
+		resp, err := http.Get(s.server.URL + "/file.txt")
+		require.NoError(t, err)
+		defer resp.Body.Close()
+
+		data, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+		require.Equal(t, "30", resp.Header.Get("Retry-After"))
+		require.Equal(t, "maintenance", string(data))
 		require.Contains(t, s.logData.String(), mockErr.Error())
-		require.Contains(t, content, http.StatusText(http.StatusInternalServerError))
+	})
+
+	s.T().Run("unavailability is cached", func(t *testing.T) {
+		failing = false
+
+		data, _, code := s.getEntry(t, "/file.txt")
+		require.Equal(t, http.StatusServiceUnavailable, code)
+		require.Equal(t, "maintenance", data)
+	})
+
+	s.T().Run("recovers after cache time", func(t *testing.T) {
+		now = now.Add(31 * time.Second)
+
+		require.Equal(t, "hello", s.getData(t, "/file.txt"))
+	})
+
+	s.T().Run("not found with readable root", func(t *testing.T) {
+		_, _, code := s.getEntry(t, "/missing.txt")
+		require.Equal(t, http.StatusNotFound, code)
+	})
+
+	s.T().Run("file error with readable root", func(t *testing.T) {
+		ep, err := s.fs.FindEntry(context.Background(), []string{"file.txt"})
+		require.NoError(t, err)
+
+		s.ds.openFunc = func(ctx context.Context, name *common.BlobName) (io.ReadCloser, error) {
+			if name.Equal(ep.BlobName()) {
+				return nil, mockErr
+			}
+			return s.ds.DS.Open(ctx, name)
+		}
+
+		_, _, code := s.getEntry(t, "/file.txt")
+		require.Equal(t, http.StatusInternalServerError, code)
+	})
+}
+
+func (s *HandlerTestSuite) TestCacheControl() {
+	s.setEntry(s.T(), "hello", "file.txt")
+	s.setEntry(s.T(), "{}", "file.json")
+
+	getCacheControl := func(t *testing.T, path string) string {
+		resp, err := http.Get(s.server.URL + path)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		return resp.Header.Get("Cache-Control")
+	}
+
+	s.T().Run("not set by default", func(t *testing.T) {
+		require.Empty(t, getCacheControl(t, "/file.txt"))
+	})
+
+	s.handler.CacheControl = "public, max-age=60"
+	s.handler.CacheControlByMimeType = map[string]string{
+		"application/json": "no-cache",
+	}
+	defer func() {
+		s.handler.CacheControl = ""
+		s.handler.CacheControlByMimeType = nil
+		s.handler.ImmutableStaticEntries = false
+	}()
+
+	s.T().Run("default value", func(t *testing.T) {
+		require.Equal(t, "public, max-age=60", getCacheControl(t, "/file.txt"))
+	})
+
+	s.T().Run("mime type override", func(t *testing.T) {
+		require.Equal(t, "no-cache", getCacheControl(t, "/file.json"))
+	})
+
+	s.T().Run("immutable static entries", func(t *testing.T) {
+		s.handler.ImmutableStaticEntries = true
+		require.Equal(t, "public, max-age=31536000, immutable", getCacheControl(t, "/file.txt"))
+		require.Equal(t, "public, max-age=31536000, immutable", getCacheControl(t, "/file.json"))
+	})
+
+	s.T().Run("sent with 304 response", func(t *testing.T) {
+		_, _, etag, _ := s.getEntryETag(t, "/file.txt", "")
+
+		req, err := http.NewRequest(http.MethodGet, s.server.URL+"/file.txt", nil)
+		require.NoError(t, err)
+		req.Header.Set("If-None-Match", etag)
+
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		require.Equal(t, http.StatusNotModified, resp.StatusCode)
+		require.Equal(t, "public, max-age=31536000, immutable", resp.Header.Get("Cache-Control"))
+	})
+}
+
+func (s *HandlerTestSuite) TestLastModified() {
+	modTime := time.Date(2023, 5, 10, 12, 30, 15, 123456000, time.UTC)
+	_, err := s.fs.SetEntryFile(
+		context.Background(),
+		[]string{"file.txt"},
+		strings.NewReader("hello"),
+		cinodefs.SetModTime(modTime),
+	)
+	require.NoError(s.T(), err)
+	s.setEntry(s.T(), "no mod time", "nomodtime.txt")
+
+	get := func(t *testing.T, path string, headers map[string]string) *http.Response {
+		req, err := http.NewRequest(http.MethodGet, s.server.URL+path, nil)
+		require.NoError(t, err)
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+		return resp
+	}
+
+	s.T().Run("entry modification time", func(t *testing.T) {
+		resp := get(t, "/file.txt", nil)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		require.Equal(t, "Wed, 10 May 2023 12:30:15 GMT", resp.Header.Get("Last-Modified"))
+	})
+
+	s.T().Run("no modification time", func(t *testing.T) {
+		resp := get(t, "/nomodtime.txt", nil)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		require.Empty(t, resp.Header.Get("Last-Modified"))
+	})
+
+	s.T().Run("if modified since", func(t *testing.T) {
+		for _, d := range []struct {
+			name   string
+			since  string
+			status int
+		}{
+			{"same time", "Wed, 10 May 2023 12:30:15 GMT", http.StatusNotModified},
+			{"later time", "Thu, 11 May 2023 12:30:15 GMT", http.StatusNotModified},
+			{"earlier time", "Wed, 10 May 2023 12:30:14 GMT", http.StatusOK},
+			{"invalid time", "yesterday", http.StatusOK},
+		} {
+			t.Run(d.name, func(t *testing.T) {
+				resp := get(t, "/file.txt", map[string]string{
+					"If-Modified-Since": d.since,
+				})
+				require.Equal(t, d.status, resp.StatusCode)
+			})
+		}
+	})
+
+	s.T().Run("if none match takes precedence", func(t *testing.T) {
+		resp := get(t, "/file.txt", map[string]string{
+			"If-None-Match":     `"invalid-etag"`,
+			"If-Modified-Since": "Thu, 11 May 2023 12:30:15 GMT",
+		})
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+	})
+
+	s.T().Run("root link content version", func(t *testing.T) {
+		linkTime := time.Date(2023, 6, 1, 8, 0, 0, 0, time.UTC)
+		fs, err := cinodefs.New(
+			context.Background(),
+			blenc.FromDatastore(
+				datastore.InMemory(),
+				blenc.VersionSource(func() uint64 { return uint64(linkTime.UnixMicro()) }),
+			),
+			cinodefs.NewRootDynamicLink(),
+		)
+		require.NoError(t, err)
+
+		_, err = fs.SetEntryFile(context.Background(), []string{"file.txt"}, strings.NewReader("hello"))
+		require.NoError(t, err)
+		require.NoError(t, fs.Flush(context.Background()))
+
+		server := httptest.NewServer(&Handler{FS: fs, Log: s.handler.Log})
+		defer server.Close()
+
+		resp, err := http.Get(server.URL + "/file.txt")
+		require.NoError(t, err)
+		resp.Body.Close()
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		require.Equal(t, "Thu, 01 Jun 2023 08:00:00 GMT", resp.Header.Get("Last-Modified"))
+	})
+
+	s.T().Run("root link content version is cached", func(t *testing.T) {
+		linkTime := time.Date(2023, 6, 1, 8, 0, 0, 0, time.UTC)
+		fs, err := cinodefs.New(
+			context.Background(),
+			blenc.FromDatastore(
+				datastore.InMemory(),
+				blenc.VersionSource(func() uint64 { return uint64(linkTime.UnixMicro()) }),
+			),
+			cinodefs.NewRootDynamicLink(),
+		)
+		require.NoError(t, err)
+
+		_, err = fs.SetEntryFile(context.Background(), []string{"file.txt"}, strings.NewReader("hello"))
+		require.NoError(t, err)
+		require.NoError(t, fs.Flush(context.Background()))
+
+		countingFS := &contentVersionCountingFS{FS: fs}
+		now := linkTime.Add(time.Hour)
+		handler := &Handler{
+			FS:                   countingFS,
+			Log:                  s.handler.Log,
+			LinkVersionCacheTime: time.Minute,
+			timeFunc:             func() time.Time { return now },
+		}
+		server := httptest.NewServer(handler)
+		defer server.Close()
+
+		getLastModified := func() string {
+			resp, err := http.Get(server.URL + "/file.txt")
+			require.NoError(t, err)
+			resp.Body.Close()
+			require.Equal(t, http.StatusOK, resp.StatusCode)
+			return resp.Header.Get("Last-Modified")
+		}
+
+		for i := 0; i < 3; i++ {
+			require.Equal(t, "Thu, 01 Jun 2023 08:00:00 GMT", getLastModified())
+		}
+		require.EqualValues(t, 1, countingFS.calls.Load())
+
+		// Link update is noticed once the cached version expires
+		linkTime = linkTime.Add(30 * time.Minute)
+		_, err = fs.SetEntryFile(context.Background(), []string{"file.txt"}, strings.NewReader("updated"))
+		require.NoError(t, err)
+		require.NoError(t, fs.Flush(context.Background()))
+
+		require.Equal(t, "Thu, 01 Jun 2023 08:00:00 GMT", getLastModified())
+		require.EqualValues(t, 1, countingFS.calls.Load())
+
+		now = now.Add(2 * time.Minute)
+		require.Equal(t, "Thu, 01 Jun 2023 08:30:00 GMT", getLastModified())
+		require.EqualValues(t, 2, countingFS.calls.Load())
+	})
+
+	s.T().Run("nested link content version", func(t *testing.T) {
+		ctx := context.Background()
+		linkTime := time.Date(2023, 6, 1, 8, 0, 0, 0, time.UTC)
+		ds := datastore.InMemory()
+		versionSource := blenc.VersionSource(func() uint64 { return uint64(linkTime.UnixMicro()) })
+		fs, err := cinodefs.New(ctx, blenc.FromDatastore(ds, versionSource), cinodefs.NewRootDynamicLink())
+		require.NoError(t, err)
+
+		_, err = fs.SetEntryFile(ctx, []string{"sub", "file.txt"}, strings.NewReader("hello"))
+		require.NoError(t, err)
+		subWI, err := fs.InjectDynamicLink(ctx, []string{"sub"})
+		require.NoError(t, err)
+		require.NoError(t, fs.Flush(ctx))
+
+		// Update the nested link through a separate FS, the root stays intact
+		linkTime = linkTime.Add(30 * time.Minute)
+		subFS, err := cinodefs.New(
+			ctx,
+			blenc.FromDatastore(ds, versionSource),
+			cinodefs.RootWriterInfo(subWI),
+		)
+		require.NoError(t, err)
+		_, err = subFS.SetEntryFile(ctx, []string{"file.txt"}, strings.NewReader("updated"))
+		require.NoError(t, err)
+		require.NoError(t, subFS.Flush(ctx))
+
+		server := httptest.NewServer(&Handler{FS: fs, Log: s.handler.Log})
+		defer server.Close()
+
+		resp, err := http.Get(server.URL + "/sub/file.txt")
+		require.NoError(t, err)
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		require.Equal(t, "updated", string(body))
+		require.Equal(t, "Thu, 01 Jun 2023 08:30:00 GMT", resp.Header.Get("Last-Modified"))
+	})
+
+	s.T().Run("custom link versions", func(t *testing.T) {
+		ctx := context.Background()
+		version := uint64(1)
+		fs, err := cinodefs.New(
+			ctx,
+			blenc.FromDatastore(
+				datastore.InMemory(),
+				blenc.VersionSource(func() uint64 { return version }),
+			),
+			cinodefs.NewRootDynamicLink(),
+		)
+		require.NoError(t, err)
+
+		_, err = fs.SetEntryFile(ctx, []string{"file.txt"}, strings.NewReader("hello"))
+		require.NoError(t, err)
+		require.NoError(t, fs.Flush(ctx))
+
+		server := httptest.NewServer(&Handler{FS: fs, Log: s.handler.Log})
+		defer server.Close()
+
+		// Counter versions do not represent the update time
+		resp, err := http.Get(server.URL + "/file.txt")
+		require.NoError(t, err)
+		resp.Body.Close()
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		require.Empty(t, resp.Header.Get("Last-Modified"))
+	})
+
+	s.T().Run("concurrent requests read the link version once", func(t *testing.T) {
+		ctx := context.Background()
+		linkTime := time.Date(2023, 6, 1, 8, 0, 0, 0, time.UTC)
+		fs, err := cinodefs.New(
+			ctx,
+			blenc.FromDatastore(
+				datastore.InMemory(),
+				blenc.VersionSource(func() uint64 { return uint64(linkTime.UnixMicro()) }),
+			),
+			cinodefs.NewRootDynamicLink(),
+		)
+		require.NoError(t, err)
+
+		_, err = fs.SetEntryFile(ctx, []string{"file.txt"}, strings.NewReader("hello"))
+		require.NoError(t, err)
+		require.NoError(t, fs.Flush(ctx))
+
+		countingFS := &contentVersionCountingFS{FS: fs, release: make(chan struct{})}
+		server := httptest.NewServer(&Handler{FS: countingFS, Log: s.handler.Log})
+		defer server.Close()
+
+		const requests = 5
+		results := make(chan string, requests)
+		for i := 0; i < requests; i++ {
+			go func() {
+				resp, err := http.Get(server.URL + "/file.txt")
+				if err != nil {
+					results <- err.Error()
+					return
+				}
+				resp.Body.Close()
+				results <- resp.Header.Get("Last-Modified")
+			}()
+		}
+
+		require.Eventually(t, func() bool { return countingFS.calls.Load() > 0 }, time.Second, time.Millisecond)
+		close(countingFS.release)
+
+		for i := 0; i < requests; i++ {
+			require.Equal(t, "Thu, 01 Jun 2023 08:00:00 GMT", <-results)
+		}
+		require.EqualValues(t, 1, countingFS.calls.Load())
+	})
+}
+
+type contentVersionCountingFS struct {
+	cinodefs.FS
+	calls   atomic.Int32
+	release chan struct{} // if set, reading the version waits until closed
+}
+
+func (c *contentVersionCountingFS) EntrypointContentVersion(ctx context.Context, ep *cinodefs.Entrypoint) (uint64, error) {
+	c.calls.Add(1)
+	if c.release != nil {
+		<-c.release
+	}
+	return c.FS.EntrypointContentVersion(ctx, ep)
+}
+
+func (s *HandlerTestSuite) TestContentDisposition() {
+	s.setEntry(s.T(), "hello", "dir", "file.txt")
+	s.setEntry(s.T(), "hello", "dir", "zażółć.txt")
+	_, err := s.fs.SetEntryFile(
+		context.Background(),
+		[]string{"dir", "always.bin"},
+		strings.NewReader("binary"),
+		cinodefs.SetMetadata(DownloadMetadataKey, "true"),
+	)
+	require.NoError(s.T(), err)
+
+	getDisposition := func(t *testing.T, path string) string {
+		resp, err := http.Get(s.server.URL + path)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		return resp.Header.Get("Content-Disposition")
+	}
+
+	s.T().Run("disabled by default", func(t *testing.T) {
+		require.Empty(t, getDisposition(t, "/dir/file.txt?download"))
+		require.Empty(t, getDisposition(t, "/dir/always.bin"))
+	})
+
+	s.handler.Downloads = true
+	defer func() { s.handler.Downloads = false }()
+
+	s.T().Run("inline without query parameter", func(t *testing.T) {
+		require.Empty(t, getDisposition(t, "/dir/file.txt"))
+	})
+
+	s.T().Run("query parameter", func(t *testing.T) {
+		require.Equal(t, `attachment; filename=file.txt`, getDisposition(t, "/dir/file.txt?download"))
+		require.Equal(t, `attachment; filename=file.txt`, getDisposition(t, "/dir/file.txt?download=1"))
+	})
+
+	s.T().Run("non-ascii file name", func(t *testing.T) {
+		disposition := getDisposition(t, "/dir/za%C5%BC%C3%B3%C5%82%C4%87.txt?download")
+		_, params, err := mime.ParseMediaType(disposition)
+		require.NoError(t, err)
+		require.Equal(t, "zażółć.txt", params["filename"])
+	})
+
+	s.T().Run("entry metadata", func(t *testing.T) {
+		require.Equal(t, `attachment; filename=always.bin`, getDisposition(t, "/dir/always.bin"))
+	})
+}
+
+func (s *HandlerTestSuite) TestCORS() {
+	s.setEntry(s.T(), "hello", "file.txt")
+
+	do := func(t *testing.T, method, origin string, headers map[string]string) *http.Response {
+		req, err := http.NewRequest(method, s.server.URL+"/file.txt", nil)
+		require.NoError(t, err)
+		if origin != "" {
+			req.Header.Set("Origin", origin)
+		}
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+		return resp
+	}
+	preflight := func(t *testing.T, origin, method string) *http.Response {
+		return do(t, http.MethodOptions, origin, map[string]string{
+			"Access-Control-Request-Method": method,
+		})
+	}
+
+	s.T().Run("disabled by default", func(t *testing.T) {
+		resp := preflight(t, "https://example.com", http.MethodGet)
+		require.Equal(t, http.StatusMethodNotAllowed, resp.StatusCode)
+
+		resp = do(t, http.MethodGet, "https://example.com", nil)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		require.Empty(t, resp.Header.Get("Access-Control-Allow-Origin"))
+	})
+
+	s.handler.CORS = &CORSConfig{
+		AllowedOrigins: []string{"https://example.com"},
+		AllowedHeaders: []string{"Range", "If-None-Match"},
+		MaxAge:         time.Hour,
+	}
+	defer func() { s.handler.CORS = nil }()
+
+	s.T().Run("preflight from allowed origin", func(t *testing.T) {
+		resp := preflight(t, "https://example.com", http.MethodGet)
+		require.Equal(t, http.StatusNoContent, resp.StatusCode)
+		require.Equal(t, "https://example.com", resp.Header.Get("Access-Control-Allow-Origin"))
+		require.Equal(t, "GET, HEAD", resp.Header.Get("Access-Control-Allow-Methods"))
+		require.Equal(t, "Range, If-None-Match", resp.Header.Get("Access-Control-Allow-Headers"))
+		require.Equal(t, "3600", resp.Header.Get("Access-Control-Max-Age"))
+		require.Equal(t, "Origin", resp.Header.Get("Vary"))
+	})
+
+	s.T().Run("preflight from disallowed origin", func(t *testing.T) {
+		resp := preflight(t, "https://other.com", http.MethodGet)
+		require.Equal(t, http.StatusForbidden, resp.StatusCode)
+		require.Empty(t, resp.Header.Get("Access-Control-Allow-Origin"))
+	})
+
+	s.T().Run("preflight with disallowed method", func(t *testing.T) {
+		resp := preflight(t, "https://example.com", http.MethodPut)
+		require.Equal(t, http.StatusForbidden, resp.StatusCode)
+	})
+
+	s.T().Run("options request that is not a preflight", func(t *testing.T) {
+		resp := do(t, http.MethodOptions, "https://example.com", nil)
+		require.Equal(t, http.StatusMethodNotAllowed, resp.StatusCode)
+	})
+
+	s.T().Run("simple request from allowed origin", func(t *testing.T) {
+		for _, method := range []string{http.MethodGet, http.MethodHead} {
+			resp := do(t, method, "https://example.com", nil)
+			require.Equal(t, http.StatusOK, resp.StatusCode)
+			require.Equal(t, "https://example.com", resp.Header.Get("Access-Control-Allow-Origin"))
+		}
+	})
+
+	s.T().Run("simple request from disallowed origin", func(t *testing.T) {
+		resp := do(t, http.MethodGet, "https://other.com", nil)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		require.Empty(t, resp.Header.Get("Access-Control-Allow-Origin"))
+		require.Equal(t, "Origin", resp.Header.Get("Vary"))
+	})
+
+	s.T().Run("any origin", func(t *testing.T) {
+		s.handler.CORS = &CORSConfig{AllowedOrigins: []string{"*"}}
+
+		resp := preflight(t, "https://other.com", http.MethodHead)
+		require.Equal(t, http.StatusNoContent, resp.StatusCode)
+		require.Equal(t, "*", resp.Header.Get("Access-Control-Allow-Origin"))
+		require.Empty(t, resp.Header.Get("Access-Control-Allow-Headers"))
+		require.Empty(t, resp.Header.Get("Access-Control-Max-Age"))
+
+		resp = do(t, http.MethodGet, "https://other.com", nil)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		require.Equal(t, "*", resp.Header.Get("Access-Control-Allow-Origin"))
+		require.Empty(t, resp.Header.Get("Vary"))
 	})
 }
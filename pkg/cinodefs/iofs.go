@@ -0,0 +1,347 @@
+/*
+Copyright © 2022 Bartłomiej Święcki (byo)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cinodefs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"strings"
+	"time"
+)
+
+// MimeTypeFileInfo is implemented by file information returned from
+// the io/fs adapter, it exposes the mime type of the entry
+type MimeTypeFileInfo interface {
+	fs.FileInfo
+	MimeType() string
+}
+
+// AsIOFS returns a read-only io/fs view of the filesystem. Slash-separated
+// names are split into path segments, the root directory is named ".". Links
+// are followed transparently.
+//
+// Given context is used for all operations done through the adapter.
+func AsIOFS(cfs FS, ctx context.Context) fs.FS {
+	return &ioFS{fs: cfs, ctx: ctx}
+}
+
+type ioFS struct {
+	fs  FS
+	ctx context.Context
+}
+
+var (
+	_ fs.FS          = (*ioFS)(nil)
+	_ fs.ReadDirFS   = (*ioFS)(nil)
+	_ fs.StatFS      = (*ioFS)(nil)
+	_ fs.ReadDirFile = (*ioDir)(nil)
+	_ io.Seeker      = (*ioFile)(nil)
+)
+
+func ioFSPath(op, name string) ([]string, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	if name == "." {
+		return []string{}, nil
+	}
+	return strings.Split(name, "/"), nil
+}
+
+// ioFSError converts the error to the form expected from io/fs
+// implementations, the original error is still kept in the error chain
+func ioFSError(op, name string, err error) error {
+	switch {
+	case errors.Is(err, ErrEntryNotFound),
+		errors.Is(err, ErrNotADirectory):
+		err = fmt.Errorf("%w: %w", fs.ErrNotExist, err)
+	case errors.Is(err, ErrMissingKeyInfo),
+		errors.Is(err, ErrMissingWriterInfo):
+		err = fmt.Errorf("%w: %w", fs.ErrPermission, err)
+	}
+	return &fs.PathError{Op: op, Path: name, Err: err}
+}
+
+func (f *ioFS) Open(name string) (fs.File, error) {
+	p, err := ioFSPath("open", name)
+	if err != nil {
+		return nil, err
+	}
+
+	ep, info, err := f.stat(p)
+	if err != nil {
+		return nil, ioFSError("open", name, err)
+	}
+
+	if info.isDir {
+		return &ioDir{fs: f, name: name, path: p, info: info}, nil
+	}
+
+	rc, err := f.fs.OpenEntrypointData(f.ctx, ep)
+	if err != nil {
+		return nil, ioFSError("open", name, wrapMissingKeyError(err, p))
+	}
+	return &ioFile{fs: f, path: p, ep: ep, info: info, rc: rc}, nil
+}
+
+func (f *ioFS) Stat(name string) (fs.FileInfo, error) {
+	p, err := ioFSPath("stat", name)
+	if err != nil {
+		return nil, err
+	}
+
+	_, info, err := f.stat(p)
+	if err != nil {
+		return nil, ioFSError("stat", name, err)
+	}
+	return info, nil
+}
+
+func (f *ioFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	p, err := ioFSPath("readdir", name)
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := f.readDir(p)
+	if err != nil {
+		return nil, ioFSError("readdir", name, err)
+	}
+	return entries, nil
+}
+
+// stat returns information about the entry at given path, the entrypoint is
+// not returned for directories with unsaved changes
+func (f *ioFS) stat(p []string) (*Entrypoint, *ioFileInfo, error) {
+	name := "."
+	if len(p) > 0 {
+		name = p[len(p)-1]
+	}
+
+	ep, err := f.fs.FindEntry(f.ctx, p)
+	if errors.Is(err, ErrModifiedDirectory) {
+		return nil, &ioFileInfo{name: name, isDir: true, mimeType: CinodeDirMimeType}, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	size := ep.ContentLength()
+	if size == 0 && !ep.IsDir() {
+		// Entries created before the content length was recorded,
+		// the size can only be found by reading the data
+		size, err = f.dataSize(ep, p)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	return ep, &ioFileInfo{
+		name:     name,
+		isDir:    ep.IsDir(),
+		size:     size,
+		mimeType: ep.MimeType(),
+		modTime:  ep.ModTime(),
+	}, nil
+}
+
+func (f *ioFS) dataSize(ep *Entrypoint, p []string) (int64, error) {
+	rc, err := f.fs.OpenEntrypointData(f.ctx, ep)
+	if err != nil {
+		return 0, wrapMissingKeyError(err, p)
+	}
+	defer rc.Close()
+
+	return io.Copy(io.Discard, rc)
+}
+
+func (f *ioFS) readDir(p []string) ([]fs.DirEntry, error) {
+	entries, err := f.fs.ListDir(f.ctx, p)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := make([]fs.DirEntry, 0, len(entries))
+	for _, e := range entries {
+		info := &ioFileInfo{
+			name:     e.Name,
+			isDir:    e.IsDir,
+			mimeType: e.MimeType,
+			modTime:  e.ModTime,
+		}
+		if e.IsLink || !e.IsDir {
+			// Links must be resolved to know the type of the target,
+			// size of files is only known from the entrypoint
+			_, info, err = f.stat(append(p[:len(p):len(p)], e.Name))
+			if e.IsSymlink && errors.Is(err, ErrEntryNotFound) {
+				// Dangling symbolic link, there's nothing to report
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+		}
+		ret = append(ret, fs.FileInfoToDirEntry(info))
+	}
+	return ret, nil
+}
+
+type ioFileInfo struct {
+	name     string
+	isDir    bool
+	size     int64
+	mimeType string
+	modTime  time.Time
+}
+
+func (i *ioFileInfo) Name() string       { return i.name }
+func (i *ioFileInfo) Size() int64        { return i.size }
+func (i *ioFileInfo) ModTime() time.Time { return i.modTime }
+func (i *ioFileInfo) IsDir() bool        { return i.isDir }
+func (i *ioFileInfo) Sys() any           { return nil }
+func (i *ioFileInfo) MimeType() string   { return i.mimeType }
+
+func (i *ioFileInfo) Mode() fs.FileMode {
+	if i.isDir {
+		return fs.ModeDir | 0o555
+	}
+	return 0o444
+}
+
+type ioFile struct {
+	fs   *ioFS
+	path []string
+	ep   *Entrypoint
+	info *ioFileInfo
+	rc   io.ReadCloser
+	pos  int64
+}
+
+func (f *ioFile) Stat() (fs.FileInfo, error) { return f.info, nil }
+
+func (f *ioFile) Read(b []byte) (int, error) {
+	if f.rc == nil {
+		return 0, fs.ErrClosed
+	}
+	n, err := f.rc.Read(b)
+	f.pos += int64(n)
+	return n, err
+}
+
+func (f *ioFile) Close() error {
+	if f.rc == nil {
+		return fs.ErrClosed
+	}
+	err := f.rc.Close()
+	f.rc = nil
+	return err
+}
+
+// Seek changes the read position, the data is encrypted thus moving to
+// a different position requires reading the file from the beginning
+func (f *ioFile) Seek(offset int64, whence int) (int64, error) {
+	if f.rc == nil {
+		return 0, fs.ErrClosed
+	}
+
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += f.pos
+	case io.SeekEnd:
+		offset += f.info.size
+	default:
+		return 0, fs.ErrInvalid
+	}
+	if offset < 0 {
+		return 0, fs.ErrInvalid
+	}
+
+	if offset < f.pos {
+		rc, err := f.fs.fs.OpenEntrypointData(f.fs.ctx, f.ep)
+		if err != nil {
+			return 0, wrapMissingKeyError(err, f.path)
+		}
+		f.rc.Close()
+		f.rc, f.pos = rc, 0
+	}
+
+	n, err := io.CopyN(io.Discard, f.rc, offset-f.pos)
+	f.pos += n
+	if err != nil && !errors.Is(err, io.EOF) {
+		return f.pos, err
+	}
+
+	// Seeking past the end is allowed, subsequent reads return io.EOF
+	f.pos = offset
+	return offset, nil
+}
+
+type ioDir struct {
+	fs      *ioFS
+	name    string
+	path    []string
+	info    *ioFileInfo
+	entries []fs.DirEntry
+	loaded  bool
+	closed  bool
+}
+
+func (d *ioDir) Stat() (fs.FileInfo, error) { return d.info, nil }
+
+func (d *ioDir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.name, Err: ErrIsADirectory}
+}
+
+func (d *ioDir) Close() error {
+	if d.closed {
+		return fs.ErrClosed
+	}
+	d.closed = true
+	return nil
+}
+
+func (d *ioDir) ReadDir(n int) ([]fs.DirEntry, error) {
+	if d.closed {
+		return nil, fs.ErrClosed
+	}
+
+	if !d.loaded {
+		entries, err := d.fs.readDir(d.path)
+		if err != nil {
+			return nil, err
+		}
+		d.entries, d.loaded = entries, true
+	}
+
+	if n <= 0 {
+		ret := d.entries
+		d.entries = nil
+		return ret, nil
+	}
+	if len(d.entries) == 0 {
+		return nil, io.EOF
+	}
+
+	n = min(n, len(d.entries))
+	ret := d.entries[:n]
+	d.entries = d.entries[n:]
+	return ret, nil
+}
@@ -0,0 +1,251 @@
+/*
+Copyright © 2023 Bartłomiej Święcki (byo)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cinodefs_test
+
+import (
+	"context"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"text/template"
+
+	"github.com/cinode/go/pkg/blenc"
+	"github.com/cinode/go/pkg/cinodefs"
+	"github.com/cinode/go/pkg/cinodefs/protobuf"
+	"github.com/cinode/go/pkg/datastore"
+	"github.com/cinode/go/pkg/utilities/golang"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestAsIOFS(t *testing.T) {
+	ctx := context.Background()
+
+	cfs, err := cinodefs.New(ctx,
+		blenc.FromDatastore(datastore.InMemory()),
+		cinodefs.NewRootDynamicLink(),
+	)
+	require.NoError(t, err)
+
+	for path, content := range map[string]string{
+		"index.html":            "<html>{{.}}</html>",
+		"dir/a.txt":             "a",
+		"dir/sub/b.txt":         "b",
+		"linked/c.txt":          "c",
+		"linked/sub/d.tmpl":     "Hello {{.}}",
+		"dir/sub/deep/data.bin": strings.Repeat("0123456789", 1000),
+	} {
+		_, err := cfs.SetEntryFile(ctx, strings.Split(path, "/"), strings.NewReader(content))
+		require.NoError(t, err)
+	}
+	_, err = cfs.InjectDynamicLink(ctx, []string{"linked"})
+	require.NoError(t, err)
+
+	iofs := cinodefs.AsIOFS(cfs, ctx)
+
+	t.Run("unflushed directories", func(t *testing.T) {
+		err := fstest.TestFS(iofs, "index.html", "dir/a.txt", "dir/sub/deep/data.bin")
+		require.NoError(t, err)
+	})
+
+	require.NoError(t, cfs.Flush(ctx))
+
+	t.Run("fstest", func(t *testing.T) {
+		err := fstest.TestFS(iofs,
+			"index.html",
+			"dir/a.txt",
+			"dir/sub/b.txt",
+			"dir/sub/deep/data.bin",
+			"linked/c.txt",
+			"linked/sub/d.tmpl",
+		)
+		require.NoError(t, err)
+	})
+
+	t.Run("walk", func(t *testing.T) {
+		found := []string{}
+		err := fs.WalkDir(iofs, ".", func(path string, d fs.DirEntry, err error) error {
+			require.NoError(t, err)
+			if !d.IsDir() {
+				found = append(found, path)
+			}
+			return nil
+		})
+		require.NoError(t, err)
+		require.Equal(t, []string{
+			"dir/a.txt",
+			"dir/sub/b.txt",
+			"dir/sub/deep/data.bin",
+			"index.html",
+			"linked/c.txt",
+			"linked/sub/d.tmpl",
+		}, found)
+	})
+
+	t.Run("stat", func(t *testing.T) {
+		fi, err := fs.Stat(iofs, "dir/sub/deep/data.bin")
+		require.NoError(t, err)
+		require.Equal(t, "data.bin", fi.Name())
+		require.EqualValues(t, 10000, fi.Size())
+		require.False(t, fi.IsDir())
+		require.Equal(t, "application/octet-stream", fi.(cinodefs.MimeTypeFileInfo).MimeType())
+
+		fi, err = fs.Stat(iofs, "linked")
+		require.NoError(t, err)
+		require.True(t, fi.IsDir())
+		require.Equal(t, cinodefs.CinodeDirMimeType, fi.(cinodefs.MimeTypeFileInfo).MimeType())
+
+		fi, err = fs.Stat(iofs, ".")
+		require.NoError(t, err)
+		require.True(t, fi.IsDir())
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		_, err := iofs.Open("missing.txt")
+		require.ErrorIs(t, err, fs.ErrNotExist)
+		require.ErrorIs(t, err, cinodefs.ErrEntryNotFound)
+
+		_, err = iofs.Open("index.html/file.txt")
+		require.ErrorIs(t, err, fs.ErrNotExist)
+
+		_, err = iofs.Open("/index.html")
+		require.ErrorIs(t, err, fs.ErrInvalid)
+
+		_, err = fs.ReadDir(iofs, "index.html")
+		require.ErrorIs(t, err, fs.ErrNotExist)
+
+		_, err = fs.Stat(iofs, "dir/../index.html")
+		require.ErrorIs(t, err, fs.ErrInvalid)
+
+		d, err := iofs.Open("dir")
+		require.NoError(t, err)
+		_, err = d.Read(make([]byte, 1))
+		require.ErrorIs(t, err, cinodefs.ErrIsADirectory)
+		require.NoError(t, d.Close())
+		require.ErrorIs(t, d.Close(), fs.ErrClosed)
+	})
+
+	t.Run("seek", func(t *testing.T) {
+		f, err := iofs.Open("dir/sub/deep/data.bin")
+		require.NoError(t, err)
+		defer f.Close()
+
+		rs := f.(io.ReadSeeker)
+		buf := make([]byte, 4)
+
+		pos, err := rs.Seek(5003, io.SeekStart)
+		require.NoError(t, err)
+		require.EqualValues(t, 5003, pos)
+		_, err = io.ReadFull(rs, buf)
+		require.NoError(t, err)
+		require.Equal(t, "3456", string(buf))
+
+		pos, err = rs.Seek(-10, io.SeekCurrent)
+		require.NoError(t, err)
+		require.EqualValues(t, 4997, pos)
+		_, err = io.ReadFull(rs, buf)
+		require.NoError(t, err)
+		require.Equal(t, "7890", string(buf))
+
+		pos, err = rs.Seek(-2, io.SeekEnd)
+		require.NoError(t, err)
+		require.EqualValues(t, 9998, pos)
+		rest, err := io.ReadAll(rs)
+		require.NoError(t, err)
+		require.Equal(t, "89", string(rest))
+
+		_, err = rs.Seek(-1, io.SeekStart)
+		require.ErrorIs(t, err, fs.ErrInvalid)
+	})
+
+	t.Run("http file server", func(t *testing.T) {
+		server := httptest.NewServer(http.FileServer(http.FS(iofs)))
+		defer server.Close()
+
+		resp, err := http.Get(server.URL + "/linked/c.txt")
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		require.Equal(t, "c", string(body))
+
+		req, err := http.NewRequest(http.MethodGet, server.URL+"/dir/sub/deep/data.bin", nil)
+		require.NoError(t, err)
+		req.Header.Set("Range", "bytes=10-14")
+		resp2, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer resp2.Body.Close()
+		require.Equal(t, http.StatusPartialContent, resp2.StatusCode)
+		body, err = io.ReadAll(resp2.Body)
+		require.NoError(t, err)
+		require.Equal(t, "01234", string(body))
+	})
+
+	t.Run("templates", func(t *testing.T) {
+		tmpl, err := template.ParseFS(iofs, "linked/sub/*.tmpl")
+		require.NoError(t, err)
+
+		sb := strings.Builder{}
+		err = tmpl.Execute(&sb, "world")
+		require.NoError(t, err)
+		require.Equal(t, "Hello world", sb.String())
+	})
+}
+
+func TestAsIOFSWithoutContentLength(t *testing.T) {
+	ctx := context.Background()
+
+	cfs, err := cinodefs.New(ctx,
+		blenc.FromDatastore(datastore.InMemory()),
+		cinodefs.NewRootStaticDirectory(),
+	)
+	require.NoError(t, err)
+
+	content := strings.Repeat("0123456789", 1000)
+	ep, err := cfs.SetEntryFile(ctx, []string{"data.bin"}, strings.NewReader(content))
+	require.NoError(t, err)
+
+	// Strip the content length from the entrypoint
+	msg := &protobuf.Entrypoint{}
+	require.NoError(t, proto.Unmarshal(ep.Bytes(), msg))
+	msg.ContentLength = 0
+	legacyEP, err := cinodefs.EntrypointFromBytes(golang.Must(proto.Marshal(msg)))
+	require.NoError(t, err)
+	require.NoError(t, cfs.SetEntry(ctx, []string{"legacy.bin"}, legacyEP))
+
+	iofs := cinodefs.AsIOFS(cfs, ctx)
+
+	fi, err := fs.Stat(iofs, "legacy.bin")
+	require.NoError(t, err)
+	require.EqualValues(t, len(content), fi.Size())
+
+	entries, err := fs.ReadDir(iofs, ".")
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	info, err := entries[1].Info()
+	require.NoError(t, err)
+	require.Equal(t, "legacy.bin", info.Name())
+	require.EqualValues(t, len(content), info.Size())
+
+	err = fstest.TestFS(iofs, "data.bin", "legacy.bin")
+	require.NoError(t, err)
+}
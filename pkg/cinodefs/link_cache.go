@@ -0,0 +1,127 @@
+/*
+Copyright © 2023 Bartłomiej Święcki (byo)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cinodefs
+
+import (
+	"container/list"
+	"sync"
+	"time"
+
+	"github.com/cinode/go/pkg/common"
+)
+
+// linkCache keeps recently resolved link targets to avoid reading and
+// validating link blobs on every traversal. Entries expire after the ttl
+// so that link updates done by other writers are eventually noticed,
+// updates done through the same graph context invalidate entries
+// immediately. The least recently used entry is evicted once the cache
+// is full.
+type linkCache struct {
+	mutex      sync.Mutex
+	maxEntries int
+	ttl        time.Duration
+	timeFunc   func() time.Time
+	entries    map[string]*list.Element
+	lru        list.List
+}
+
+type linkCacheEntry struct {
+	name    string
+	key     *common.BlobKey
+	target  *Entrypoint
+	expires time.Time
+}
+
+func newLinkCache(maxEntries int, ttl time.Duration, timeFunc func() time.Time) *linkCache {
+	return &linkCache{
+		maxEntries: maxEntries,
+		ttl:        ttl,
+		timeFunc:   timeFunc,
+		entries:    map[string]*list.Element{},
+	}
+}
+
+// get returns the cached target of the link, the key must match the one
+// used when the target was resolved so that the cache never reveals the
+// target to those not able to decrypt the link
+func (c *linkCache) get(name *common.BlobName, key *common.BlobKey) *Entrypoint {
+	if c == nil {
+		return nil
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	elem, found := c.entries[name.String()]
+	if !found {
+		return nil
+	}
+
+	entry := elem.Value.(*linkCacheEntry)
+	if !c.timeFunc().Before(entry.expires) {
+		c.removeElement(elem)
+		return nil
+	}
+	if !entry.key.Equal(key) {
+		return nil
+	}
+
+	c.lru.MoveToFront(elem)
+	return entry.target
+}
+
+func (c *linkCache) put(name *common.BlobName, key *common.BlobKey, target *Entrypoint) {
+	if c == nil {
+		return
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if elem, found := c.entries[name.String()]; found {
+		c.removeElement(elem)
+	}
+
+	for c.lru.Len() >= c.maxEntries {
+		c.removeElement(c.lru.Back())
+	}
+
+	c.entries[name.String()] = c.lru.PushFront(&linkCacheEntry{
+		name:    name.String(),
+		key:     key,
+		target:  target,
+		expires: c.timeFunc().Add(c.ttl),
+	})
+}
+
+func (c *linkCache) invalidate(name *common.BlobName) {
+	if c == nil {
+		return
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if elem, found := c.entries[name.String()]; found {
+		c.removeElement(elem)
+	}
+}
+
+func (c *linkCache) removeElement(elem *list.Element) {
+	delete(c.entries, elem.Value.(*linkCacheEntry).name)
+	c.lru.Remove(elem)
+}
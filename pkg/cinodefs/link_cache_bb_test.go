@@ -0,0 +1,221 @@
+/*
+Copyright © 2023 Bartłomiej Święcki (byo)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cinodefs_test
+
+import (
+	"context"
+	"io"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/cinode/go/pkg/blenc"
+	"github.com/cinode/go/pkg/blobtypes"
+	"github.com/cinode/go/pkg/cinodefs"
+	"github.com/cinode/go/pkg/common"
+	"github.com/cinode/go/pkg/datastore"
+	"github.com/stretchr/testify/require"
+)
+
+type linkOpenCountingBE struct {
+	blenc.BE
+	linkOpens atomic.Int64
+}
+
+func (c *linkOpenCountingBE) Open(ctx context.Context, name *common.BlobName, key *common.BlobKey) (io.ReadCloser, error) {
+	if name.Type() == blobtypes.DynamicLink {
+		c.linkOpens.Add(1)
+	}
+	return c.BE.Open(ctx, name, key)
+}
+
+// prepareLinkedDataset creates a dataset with the file placed behind
+// the root link and one more nested link
+func prepareLinkedDataset(t testing.TB, ds datastore.DS, path []string) cinodefs.FS {
+	ctx := context.Background()
+	fs, err := cinodefs.New(ctx,
+		blenc.FromDatastore(ds),
+		cinodefs.NewRootDynamicLink(),
+	)
+	require.NoError(t, err)
+
+	_, err = fs.SetEntryFile(ctx, path, strings.NewReader("initial content"))
+	require.NoError(t, err)
+	_, err = fs.InjectDynamicLink(ctx, path[:1])
+	require.NoError(t, err)
+	require.NoError(t, fs.Flush(ctx))
+
+	return fs
+}
+
+func readFile(t testing.TB, fs cinodefs.FS, path []string) string {
+	rc, err := fs.OpenEntryData(context.Background(), path)
+	require.NoError(t, err)
+	defer rc.Close()
+
+	data, err := io.ReadAll(rc)
+	require.NoError(t, err)
+	return string(data)
+}
+
+func TestLinkCache(t *testing.T) {
+	ctx := context.Background()
+	path := []string{"dir", "sub", "file.txt"}
+
+	t.Run("invalid parameters", func(t *testing.T) {
+		be := blenc.FromDatastore(datastore.InMemory())
+		for _, p := range []struct {
+			size int
+			ttl  time.Duration
+		}{
+			{0, time.Second},
+			{-1, time.Second},
+			{10, 0},
+			{10, -time.Second},
+		} {
+			fs, err := cinodefs.New(ctx, be,
+				cinodefs.NewRootStaticDirectory(),
+				cinodefs.LinkCache(p.size, p.ttl),
+			)
+			require.ErrorIs(t, err, cinodefs.ErrInvalidLinkCacheParams)
+			require.Nil(t, fs)
+		}
+	})
+
+	t.Run("link updated by other writer", func(t *testing.T) {
+		ds := datastore.InMemory()
+		writer := prepareLinkedDataset(t, ds, path)
+		rootEP, err := writer.RootEntrypoint()
+		require.NoError(t, err)
+
+		now := time.Now()
+		be := &linkOpenCountingBE{BE: blenc.FromDatastore(ds)}
+		reader, err := cinodefs.New(ctx, be,
+			cinodefs.RootEntrypoint(rootEP),
+			cinodefs.LinkCache(10, time.Minute),
+			cinodefs.TimeFunc(func() time.Time { return now }),
+		)
+		require.NoError(t, err)
+
+		require.Equal(t, "initial content", readFile(t, reader, path))
+		require.EqualValues(t, 2, be.linkOpens.Load())
+
+		// Links are not read again
+		require.Equal(t, "initial content", readFile(t, reader, path))
+		require.EqualValues(t, 2, be.linkOpens.Load())
+
+		_, err = writer.SetEntryFile(ctx, path, strings.NewReader("modified content"))
+		require.NoError(t, err)
+		require.NoError(t, writer.Flush(ctx))
+
+		// Still cached
+		now = now.Add(time.Minute - time.Second)
+		require.Equal(t, "initial content", readFile(t, reader, path))
+
+		// Expired
+		now = now.Add(time.Second)
+		require.Equal(t, "modified content", readFile(t, reader, path))
+		require.EqualValues(t, 4, be.linkOpens.Load())
+	})
+
+	t.Run("link updated through the same filesystem", func(t *testing.T) {
+		ds := datastore.InMemory()
+		rootWI, err := prepareLinkedDataset(t, ds, path).RootWriterInfo(ctx)
+		require.NoError(t, err)
+
+		fs, err := cinodefs.New(ctx,
+			blenc.FromDatastore(ds),
+			cinodefs.RootWriterInfo(rootWI),
+			cinodefs.LinkCache(10, time.Hour),
+		)
+		require.NoError(t, err)
+		require.Equal(t, "initial content", readFile(t, fs, path))
+
+		// Changing the file behind the root link only, the nested link
+		// is not writable
+		_, err = fs.SetEntryFile(ctx, []string{"other.txt"}, strings.NewReader("other content"))
+		require.NoError(t, err)
+		require.NoError(t, fs.Flush(ctx))
+
+		require.Equal(t, "other content", readFile(t, fs, []string{"other.txt"}))
+		require.Equal(t, "initial content", readFile(t, fs, path))
+
+		rootEP, err := fs.RootEntrypoint()
+		require.NoError(t, err)
+		fs2, err := cinodefs.New(ctx,
+			blenc.FromDatastore(ds),
+			cinodefs.RootEntrypoint(rootEP),
+		)
+		require.NoError(t, err)
+		require.Equal(t, "other content", readFile(t, fs2, []string{"other.txt"}))
+	})
+
+	t.Run("evicted entries", func(t *testing.T) {
+		ds := datastore.InMemory()
+		rootEP, err := prepareLinkedDataset(t, ds, path).RootEntrypoint()
+		require.NoError(t, err)
+
+		be := &linkOpenCountingBE{BE: blenc.FromDatastore(ds)}
+		fs, err := cinodefs.New(ctx, be,
+			cinodefs.RootEntrypoint(rootEP),
+			cinodefs.LinkCache(1, time.Hour),
+		)
+		require.NoError(t, err)
+
+		for i := 0; i < 3; i++ {
+			require.Equal(t, "initial content", readFile(t, fs, path))
+		}
+
+		// Both links on the path evict each other, results are still correct
+		// but links must be read on every lookup
+		require.EqualValues(t, 6, be.linkOpens.Load())
+	})
+}
+
+func BenchmarkFindEntryThroughLinks(b *testing.B) {
+	ctx := context.Background()
+	path := []string{"dir", "sub", "file.txt"}
+
+	ds := datastore.InMemory()
+	rootEP, err := prepareLinkedDataset(b, ds, path).RootEntrypoint()
+	require.NoError(b, err)
+
+	for _, d := range []struct {
+		name string
+		opts []cinodefs.Option
+	}{
+		{"no cache", nil},
+		{"cache", []cinodefs.Option{cinodefs.LinkCache(10, time.Minute)}},
+	} {
+		b.Run(d.name, func(b *testing.B) {
+			fs, err := cinodefs.New(ctx,
+				blenc.FromDatastore(ds),
+				append(d.opts, cinodefs.RootEntrypoint(rootEP))...,
+			)
+			require.NoError(b, err)
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				_, err := fs.FindEntry(ctx, path)
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,142 @@
+/*
+Copyright © 2022 Bartłomiej Święcki (byo)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cinodefs
+
+import (
+	"context"
+	"errors"
+	"slices"
+)
+
+var (
+	ErrInvalidMovePath = errors.New("can not move entry into itself or its parent")
+)
+
+// Move relocates the entry from one path to another one. The entry is moved
+// together with its in-memory state thus no data is re-encrypted nor
+// uploaded, directories are moved with the whole subtree and links keep their
+// writer info. An existing entry at the destination path is overwritten,
+// missing parent directories of the destination are created.
+func (fs *cinodeFS) Move(ctx context.Context, from, to []string) error {
+	from, err := validatePath(from)
+	if err != nil {
+		return err
+	}
+	to, err = validatePath(to)
+	if err != nil {
+		return err
+	}
+
+	if len(from) == 0 || len(to) == 0 {
+		return ErrCantDeleteRoot
+	}
+	if slices.Equal(from, to) {
+		return nil
+	}
+	if isPathPrefix(from, to) || isPathPrefix(to, from) {
+		return ErrInvalidMovePath
+	}
+
+	fromParent, fromName := from[:len(from)-1], from[len(from)-1]
+
+	return fs.withLock(ctx, func(ctx context.Context) error {
+		// Find the moved node first, nothing is modified until
+		// it is known that the source can be removed
+		moved, err := fs.findEntryNodeLocked(ctx, from, true)
+		if err != nil {
+			return err
+		}
+
+		err = fs.traverseGraphLocked(
+			ctx,
+			to,
+			traverseOptions{createNodes: true, noFollowSymlink: true},
+			func(_ context.Context, _ node, isWriteable bool) (node, dirtyState, error) {
+				if !isWriteable {
+					return nil, 0, ErrMissingWriterInfo
+				}
+				return moved, dsDirty, nil
+			},
+		)
+		if err != nil {
+			return err
+		}
+
+		// Path to the source and the shard with the source entry were
+		// loaded in the first step, no blob data is needed here thus the
+		// move can not be left half-done
+		return fs.traverseGraphLocked(
+			ctx,
+			fromParent,
+			traverseOptions{},
+			func(ctx context.Context, reachedEntrypoint node, _ bool) (node, dirtyState, error) {
+				dir := reachedEntrypoint.(*nodeDirectory)
+				_, err := dir.deleteEntry(ctx, &fs.c, fromName)
+				if err != nil {
+					return nil, 0, err
+				}
+				return dir, dsDirty, nil
+			},
+		)
+	})
+}
+
+// findEntryNodeLocked returns the node of the entry at given path as stored
+// in the parent directory, links at the end of the path are not followed.
+// Must be called from a function run through withLock.
+func (fs *cinodeFS) findEntryNodeLocked(
+	ctx context.Context,
+	path []string,
+	requireWriteable bool,
+) (node, error) {
+	var ret node
+	err := fs.traverseGraphLocked(
+		ctx,
+		path[:len(path)-1],
+		traverseOptions{},
+		func(ctx context.Context, reachedEntrypoint node, isWriteable bool) (node, dirtyState, error) {
+			dir, isDir := reachedEntrypoint.(*nodeDirectory)
+			if !isDir {
+				return nil, 0, ErrNotADirectory
+			}
+
+			entry, found, err := dir.resolveEntry(ctx, &fs.c, path[len(path)-1])
+			if err != nil {
+				return nil, 0, err
+			}
+			if !found {
+				return nil, 0, ErrEntryNotFound
+			}
+			if requireWriteable && !isWriteable {
+				return nil, 0, ErrMissingWriterInfo
+			}
+
+			ret = entry
+			return dir, dsClean, nil
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// isPathPrefix checks whether the prefix path points to the path itself
+// or to one of its parents
+func isPathPrefix(prefix, path []string) bool {
+	return len(prefix) <= len(path) && slices.Equal(prefix, path[:len(prefix)])
+}
@@ -0,0 +1,208 @@
+/*
+Copyright © 2022 Bartłomiej Święcki (byo)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cinodefs_test
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/cinode/go/pkg/blenc"
+	"github.com/cinode/go/pkg/cinodefs"
+	"github.com/cinode/go/pkg/datastore"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMove(t *testing.T) {
+	ctx := context.Background()
+
+	setFile := func(t *testing.T, fs cinodefs.FS, path, content string, opts ...cinodefs.EntrypointOption) *cinodefs.Entrypoint {
+		ep, err := fs.SetEntryFile(ctx, strings.Split(path, "/"), strings.NewReader(content), opts...)
+		require.NoError(t, err)
+		return ep
+	}
+
+	readFile := func(t *testing.T, fs cinodefs.FS, path string) string {
+		rc, err := fs.OpenEntryData(ctx, strings.Split(path, "/"))
+		require.NoError(t, err)
+		defer rc.Close()
+		data, err := io.ReadAll(rc)
+		require.NoError(t, err)
+		return string(data)
+	}
+
+	requireNotFound := func(t *testing.T, fs cinodefs.FS, path string) {
+		_, err := fs.FindEntry(ctx, strings.Split(path, "/"))
+		require.ErrorIs(t, err, cinodefs.ErrEntryNotFound)
+	}
+
+	newFS := func(t *testing.T) cinodefs.FS {
+		fs, err := cinodefs.New(ctx,
+			blenc.FromDatastore(datastore.InMemory()),
+			cinodefs.NewRootDynamicLink(),
+		)
+		require.NoError(t, err)
+		return fs
+	}
+
+	t.Run("move file", func(t *testing.T) {
+		fs := newFS(t)
+		ep := setFile(t, fs, "dir/file.bin", "data", cinodefs.SetMimeType("application/x-test"))
+
+		err := fs.Move(ctx, []string{"dir", "file.bin"}, []string{"other", "sub", "moved.txt"})
+		require.NoError(t, err)
+		requireNotFound(t, fs, "dir/file.bin")
+
+		// The same blob is referenced, the mime type is not re-detected
+		movedEP, err := fs.FindEntry(ctx, []string{"other", "sub", "moved.txt"})
+		require.NoError(t, err)
+		require.Equal(t, ep.BlobName(), movedEP.BlobName())
+		require.Equal(t, "application/x-test", movedEP.MimeType())
+		require.Equal(t, "data", readFile(t, fs, "other/sub/moved.txt"))
+
+		// Source directory is kept even if empty
+		entries := 0
+		err = fs.Walk(ctx, []string{"dir"}, func(cinodefs.WalkEntry) error {
+			entries++
+			return nil
+		})
+		require.NoError(t, err)
+		require.Zero(t, entries)
+
+		require.NoError(t, fs.Flush(ctx))
+		require.Equal(t, "data", readFile(t, fs, "other/sub/moved.txt"))
+	})
+
+	t.Run("overwrite existing entry", func(t *testing.T) {
+		fs := newFS(t)
+		setFile(t, fs, "a.txt", "a")
+		setFile(t, fs, "b.txt", "b")
+		require.NoError(t, fs.Flush(ctx))
+
+		err := fs.Move(ctx, []string{"a.txt"}, []string{"b.txt"})
+		require.NoError(t, err)
+		requireNotFound(t, fs, "a.txt")
+		require.Equal(t, "a", readFile(t, fs, "b.txt"))
+	})
+
+	t.Run("move directory subtree", func(t *testing.T) {
+		fs := newFS(t)
+		setFile(t, fs, "dir/a.txt", "a")
+		setFile(t, fs, "dir/sub/b.txt", "b")
+		require.NoError(t, fs.Flush(ctx))
+
+		// Unsaved changes are moved as well
+		setFile(t, fs, "dir/sub/c.txt", "c")
+
+		err := fs.Move(ctx, []string{"dir"}, []string{"moved"})
+		require.NoError(t, err)
+		requireNotFound(t, fs, "dir")
+
+		require.NoError(t, fs.Flush(ctx))
+		require.Equal(t, "a", readFile(t, fs, "moved/a.txt"))
+		require.Equal(t, "b", readFile(t, fs, "moved/sub/b.txt"))
+		require.Equal(t, "c", readFile(t, fs, "moved/sub/c.txt"))
+	})
+
+	t.Run("move link", func(t *testing.T) {
+		fs := newFS(t)
+		setFile(t, fs, "linked/a.txt", "a")
+		_, err := fs.InjectDynamicLink(ctx, []string{"linked"})
+		require.NoError(t, err)
+		require.NoError(t, fs.Flush(ctx))
+
+		err = fs.Move(ctx, []string{"linked"}, []string{"moved"})
+		require.NoError(t, err)
+
+		// Writer info is still known, content behind the link can be modified
+		setFile(t, fs, "moved/b.txt", "b")
+		require.NoError(t, fs.Flush(ctx))
+		require.Equal(t, "a", readFile(t, fs, "moved/a.txt"))
+		require.Equal(t, "b", readFile(t, fs, "moved/b.txt"))
+	})
+
+	t.Run("invalid moves", func(t *testing.T) {
+		fs := newFS(t)
+		setFile(t, fs, "dir/sub/file.txt", "data")
+		setFile(t, fs, "file.txt", "data")
+
+		err := fs.Move(ctx, []string{}, []string{"moved"})
+		require.ErrorIs(t, err, cinodefs.ErrCantDeleteRoot)
+
+		err = fs.Move(ctx, []string{"dir"}, nil)
+		require.ErrorIs(t, err, cinodefs.ErrCantDeleteRoot)
+
+		err = fs.Move(ctx, []string{"dir"}, []string{"dir", "sub", "moved"})
+		require.ErrorIs(t, err, cinodefs.ErrInvalidMovePath)
+
+		err = fs.Move(ctx, []string{"dir", "sub"}, []string{"dir"})
+		require.ErrorIs(t, err, cinodefs.ErrInvalidMovePath)
+
+		err = fs.Move(ctx, []string{"missing"}, []string{"moved"})
+		require.ErrorIs(t, err, cinodefs.ErrEntryNotFound)
+
+		err = fs.Move(ctx, []string{"file.txt", "sub"}, []string{"moved"})
+		require.ErrorIs(t, err, cinodefs.ErrNotADirectory)
+
+		err = fs.Move(ctx, []string{"dir", ""}, []string{"moved"})
+		require.ErrorIs(t, err, cinodefs.ErrEmptyName)
+
+		err = fs.Move(ctx, []string{"dir"}, []string{"file.txt", "moved"})
+		require.Error(t, err)
+		require.Equal(t, "data", readFile(t, fs, "dir/sub/file.txt"))
+
+		// Moving to the same path is a no-op
+		err = fs.Move(ctx, []string{"file.txt"}, []string{"file.txt"})
+		require.NoError(t, err)
+		require.Equal(t, "data", readFile(t, fs, "file.txt"))
+	})
+
+	t.Run("missing writer info", func(t *testing.T) {
+		be := blenc.FromDatastore(datastore.InMemory())
+		fs, err := cinodefs.New(ctx, be, cinodefs.NewRootDynamicLink())
+		require.NoError(t, err)
+
+		setFile(t, fs, "linked/a.txt", "a")
+		setFile(t, fs, "b.txt", "b")
+		_, err = fs.InjectDynamicLink(ctx, []string{"linked"})
+		require.NoError(t, err)
+		require.NoError(t, fs.Flush(ctx))
+
+		rootWI, err := fs.RootWriterInfo(ctx)
+		require.NoError(t, err)
+
+		// Only the root writer info is known, linked directory is read-only
+		fs2, err := cinodefs.New(ctx, be, cinodefs.RootWriterInfo(rootWI))
+		require.NoError(t, err)
+
+		err = fs2.Move(ctx, []string{"linked", "a.txt"}, []string{"a.txt"})
+		require.ErrorIs(t, err, cinodefs.ErrMissingWriterInfo)
+		require.Equal(t, "a", readFile(t, fs2, "linked/a.txt"))
+		requireNotFound(t, fs2, "a.txt")
+
+		err = fs2.Move(ctx, []string{"b.txt"}, []string{"linked", "b.txt"})
+		require.ErrorIs(t, err, cinodefs.ErrMissingWriterInfo)
+		require.Equal(t, "b", readFile(t, fs2, "b.txt"))
+		requireNotFound(t, fs2, "linked/b.txt")
+
+		// The whole link can be moved within the writable part
+		err = fs2.Move(ctx, []string{"linked"}, []string{"moved"})
+		require.NoError(t, err)
+		require.Equal(t, "a", readFile(t, fs2, "moved/a.txt"))
+	})
+}
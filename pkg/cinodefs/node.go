@@ -22,6 +22,7 @@ package cinodefs
 //  * directory - either clean (with existing entrypoint) or dirty (modified entries, not yet flushed)
 //  * link - either clean (with tarted stored) or dirty (target changed but not yet flushed)
 //  * file - entrypoint to static blob
+//  * symlink - path to another entry in the same tree, stored in the parent directory
 //
 // node states:
 //  * if unloaded entry - contains entrypoint to the element, from entrypoint it can be deduced if this
@@ -18,9 +18,12 @@ package cinodefs
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"slices"
 	"sort"
+	"strings"
 
-	"github.com/cinode/go/pkg/blobtypes"
 	"github.com/cinode/go/pkg/cinodefs/protobuf"
 	"github.com/cinode/go/pkg/utilities/golang"
 )
@@ -28,7 +31,9 @@ import (
 // nodeDirectory holds a directory entry loaded into memory
 type nodeDirectory struct {
 	entries map[string]node
+	pending []*dirShard // shards of a split directory with entries not loaded yet, sorted by name
 	stored  *Entrypoint // current entrypoint, will be nil if directory was modified
+	shards  []*dirShard // loaded shards of the stored directory if it was split
 	dState  dirtyState  // true if any subtree is dirty
 }
 
@@ -45,59 +50,98 @@ func (d *nodeDirectory) flush(ctx context.Context, gc *graphContext) (node, *Ent
 	if d.dState == dsSubDirty {
 		// Some sub-nodes are dirty, need to propagate flush to
 		flushedEntries := make(map[string]node, len(d.entries))
+		pending := false
 		for name, entry := range d.entries {
 			target, _, err := entry.flush(ctx, gc)
+			if errors.Is(err, errBlobIOPending) {
+				// continue with other entries to gather more blob operations
+				pending = true
+				continue
+			}
 			if err != nil {
 				return nil, nil, err
 			}
 
 			flushedEntries[name] = target
 		}
+		if pending {
+			return nil, nil, errBlobIOPending
+		}
 
 		// directory itself was not modified and does not need flush, don't bother
 		// saving it to datastore
 		return &nodeDirectory{
 			entries: flushedEntries,
+			pending: slices.Clone(d.pending),
 			stored:  d.stored,
+			shards:  slices.Clone(d.shards),
 			dState:  dsClean,
 		}, d.stored, nil
 	}
 
 	golang.Assert(d.dState == dsDirty, "ensure correct dirtiness state")
 
-	// Directory has changed, have to recalculate its blob and save it in data store
-	dir := protobuf.Directory{
-		Entries: make([]*protobuf.Directory_Entry, 0, len(d.entries)),
+	// Directory has changed, have to recalculate its blob and save it in data
+	// store, all entries are needed to split it into shards again
+	err := d.loadAllShards(ctx, gc)
+	if err != nil {
+		return nil, nil, err
 	}
+
+	entries := make([]*protobuf.Directory_Entry, 0, len(d.entries))
 	flushedEntries := make(map[string]node, len(d.entries))
+	pending := false
 	for name, entry := range d.entries {
+		if symlink, isSymlink := entry.(*nodeSymlink); isSymlink {
+			flushedEntries[name] = symlink
+			entries = append(entries, &protobuf.Directory_Entry{
+				Name:          name,
+				SymlinkTarget: symlink.target,
+			})
+			continue
+		}
+
 		target, targetEP, err := entry.flush(ctx, gc)
+		if errors.Is(err, errBlobIOPending) {
+			pending = true
+			continue
+		}
 		if err != nil {
 			return nil, nil, err
 		}
+		if targetEP.ep.MimeType == CinodeDirShardMimeType {
+			return nil, nil, fmt.Errorf(
+				"%w: entry %s uses %s which is reserved for directory shards",
+				ErrInvalidMimeType, name, CinodeDirShardMimeType,
+			)
+		}
 
 		flushedEntries[name] = target
-		dir.Entries = append(dir.Entries, &protobuf.Directory_Entry{
+		entries = append(entries, &protobuf.Directory_Entry{
 			Name: name,
 			Ep:   &targetEP.ep,
 		})
 	}
 
+	if pending {
+		return nil, nil, errBlobIOPending
+	}
+
 	// Sort by name - that way we gain deterministic order during
 	// serialization od the directory
-	sort.Slice(dir.Entries, func(i, j int) bool {
-		return dir.Entries[i].Name < dir.Entries[j].Name
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Name < entries[j].Name
 	})
 
-	ep, err := gc.createProtobufMessage(ctx, blobtypes.Static, &dir)
+	ep, shards, err := gc.storeDirectory(ctx, entries, d.shards)
 	if err != nil {
 		return nil, nil, err
 	}
-	ep.ep.MimeType = CinodeDirMimeType
 
 	return &nodeDirectory{
 		entries: flushedEntries,
 		stored:  ep,
+		shards:  shards,
 		dState:  dsClean,
 	}, ep, nil
 }
@@ -120,11 +164,20 @@ func (c *nodeDirectory) traverse(
 		return whenReached(ctx, c, isWritable)
 	}
 
-	subNode, found := c.entries[path[pathPosition]]
+	subNode, found, err := c.resolveEntry(ctx, gc, path[pathPosition])
+	if err != nil {
+		return nil, 0, err
+	}
 	if !found {
 		if !opts.createNodes {
 			return nil, 0, ErrEntryNotFound
 		}
+		if opts.noCreateParents && pathPosition+1 < len(path) {
+			return nil, 0, fmt.Errorf(
+				"%w: parent directory %s does not exist",
+				ErrEntryNotFound, strings.Join(path[:pathPosition+1], "/"),
+			)
+		}
 		if !isWritable {
 			return nil, 0, ErrMissingWriterInfo
 		}
@@ -144,13 +197,14 @@ func (c *nodeDirectory) traverse(
 		return c, dsDirty, nil
 	}
 
-	// found path entry, descend to sub-node
+	// found path entry, descend to sub-node, chains of dynamic links
+	// start at the depth reached by symbolic links
 	replacement, replacementState, err := subNode.traverse(
 		ctx,
 		gc,
 		path,
 		pathPosition+1,
-		0,
+		opts.symlinkRedirects,
 		isWritable,
 		opts,
 		whenReached,
@@ -232,11 +286,12 @@ func (c *nodeDirectory) entrypoint() (*Entrypoint, error) {
 	return c.stored, nil
 }
 
-func (c *nodeDirectory) deleteEntry(name string) bool {
-	if _, hasEntry := c.entries[name]; !hasEntry {
-		return false
+func (c *nodeDirectory) deleteEntry(ctx context.Context, gc *graphContext, name string) (bool, error) {
+	_, hasEntry, err := c.resolveEntry(ctx, gc, name)
+	if err != nil || !hasEntry {
+		return false, err
 	}
 	delete(c.entries, name)
 	c.dState = dsDirty
-	return true
+	return true, nil
 }
@@ -0,0 +1,366 @@
+/*
+Copyright © 2022 Bartłomiej Święcki (byo)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cinodefs
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+
+	"github.com/cinode/go/pkg/blobtypes"
+	"github.com/cinode/go/pkg/cinodefs/protobuf"
+	"google.golang.org/protobuf/proto"
+)
+
+var (
+	ErrInvalidDirShard = errors.New("invalid directory shard")
+)
+
+const (
+	// Minimal value of the directory split threshold, lower values would
+	// not allow reducing the number of entries on each level of the tree
+	minDirSplitThreshold = 4
+)
+
+// dirShard describes a single shard blob of a split directory.
+//
+// Shards cover continuous ranges of entry names, the first entry of the shard
+// is named after the shard and all entries must be lower than the name of the
+// next shard. That way names can be resolved by loading only shards covering
+// the name instead of the whole directory.
+type dirShard struct {
+	ep *Entrypoint
+
+	// range of names stored in the shard, end is exclusive, the range has no
+	// upper bound if end is empty
+	name string
+	end  string
+
+	// hash of the shard blob data, only known once the shard is loaded
+	fingerprint [sha256.Size]byte
+}
+
+func (s *dirShard) covers(name string) bool {
+	return name >= s.name && (s.end == "" || name < s.end)
+}
+
+// storeDirectory saves directory entries sorted by name in the datastore.
+//
+// If the number of entries exceeds the split threshold, entries are split
+// into shards, each stored in a separate blob. Shards are referenced from
+// the parent blob through entries named after the first entry of the shard
+// and marked with the CinodeDirShardMimeType, if there are too many shards,
+// those are split further building a balanced tree. Shards with the same
+// content as one of the current shards are not stored again, their
+// entrypoints are reused instead. All shards of the new directory are
+// returned along with its entrypoint.
+func (c *graphContext) storeDirectory(
+	ctx context.Context,
+	entries []*protobuf.Directory_Entry,
+	current []*dirShard,
+) (
+	*Entrypoint,
+	[]*dirShard,
+	error,
+) {
+	stored := make(map[[sha256.Size]byte]*dirShard, len(current))
+	for _, shard := range current {
+		stored[shard.fingerprint] = shard
+	}
+
+	var shards []*dirShard
+	for c.dirSplitThreshold > 0 && len(entries) > c.dirSplitThreshold {
+		var shardEntries []*protobuf.Directory_Entry
+		pending := false
+		for _, chunk := range splitDirEntries(entries, c.dirSplitThreshold) {
+			data, fingerprint, err := marshalDirectory(chunk)
+			if err != nil {
+				return nil, nil, err
+			}
+
+			shard, found := stored[fingerprint]
+			if !found {
+				ep, err := c.storeDirectoryBlob(ctx, data, len(chunk))
+				if errors.Is(err, errBlobIOPending) {
+					// continue with other shards to gather more blob operations
+					pending = true
+					continue
+				}
+				if err != nil {
+					return nil, nil, err
+				}
+				ep.ep.MimeType = CinodeDirShardMimeType
+
+				shard = &dirShard{ep: ep, fingerprint: fingerprint}
+			}
+
+			shards = append(shards, &dirShard{
+				ep:          shard.ep,
+				name:        chunk[0].Name,
+				fingerprint: fingerprint,
+			})
+			shardEntries = append(shardEntries, &protobuf.Directory_Entry{
+				Name: chunk[0].Name,
+				Ep:   &shard.ep.ep,
+			})
+		}
+		if pending {
+			return nil, nil, errBlobIOPending
+		}
+		entries = shardEntries
+	}
+
+	data, _, err := marshalDirectory(entries)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ep, err := c.storeDirectoryBlob(ctx, data, len(entries))
+	if err != nil {
+		return nil, nil, err
+	}
+	ep.ep.MimeType = CinodeDirMimeType
+
+	return ep, shards, nil
+}
+
+func marshalDirectory(entries []*protobuf.Directory_Entry) ([]byte, [sha256.Size]byte, error) {
+	data, err := marshalOptions.Marshal(&protobuf.Directory{Entries: entries})
+	if err != nil {
+		return nil, [sha256.Size]byte{}, fmt.Errorf("serialization failed: %w", err)
+	}
+	return data, sha256.Sum256(data), nil
+}
+
+func (c *graphContext) storeDirectoryBlob(
+	ctx context.Context,
+	data []byte,
+	entriesCount int,
+) (
+	*Entrypoint,
+	error,
+) {
+	err := c.checkDirSize(int64(len(data)), entriesCount)
+	if err != nil {
+		return nil, err
+	}
+
+	ep, err := c.createBlob(ctx, blobtypes.Static, data)
+	if err != nil {
+		return nil, err
+	}
+	c.warnDirSize(ctx, ep, int64(len(data)), entriesCount)
+
+	return ep, nil
+}
+
+// splitDirEntries splits sorted entries into chunks of at most maxEntries
+// entries.
+//
+// Chunk boundaries depend on entry names, not on entry positions, thus
+// adding or removing an entry usually changes only a single chunk and
+// the rest of shard blobs stay the same. Each chunk except the last one
+// contains at least two entries so that the number of chunks is always
+// lower than the number of entries.
+func splitDirEntries(entries []*protobuf.Directory_Entry, maxEntries int) [][]*protobuf.Directory_Entry {
+	minEntries := max(2, maxEntries/4)
+	boundaryModulo := uint32(maxEntries / 2)
+
+	isBoundary := func(name string) bool {
+		h := sha256.Sum256([]byte(name))
+		return binary.BigEndian.Uint32(h[:4])%boundaryModulo == 0
+	}
+
+	var chunks [][]*protobuf.Directory_Entry
+	start := 0
+	for i, entry := range entries {
+		size := i - start + 1
+		if size >= maxEntries || (size >= minEntries && isBoundary(entry.Name)) {
+			chunks = append(chunks, entries[start:i+1])
+			start = i + 1
+		}
+	}
+	if start < len(entries) {
+		chunks = append(chunks, entries[start:])
+	}
+
+	return chunks
+}
+
+// readDirectoryBlob reads the directory blob, the hash of the blob data is
+// returned along with the directory message
+func (c *graphContext) readDirectoryBlob(
+	ctx context.Context,
+	ep *Entrypoint,
+) (
+	*protobuf.Directory,
+	[sha256.Size]byte,
+	error,
+) {
+	data, err := c.readBlobData(ctx, ep)
+	if err != nil {
+		return nil, [sha256.Size]byte{}, err
+	}
+
+	msg := &protobuf.Directory{}
+	err = proto.Unmarshal(data, msg)
+	if err != nil {
+		return nil, [sha256.Size]byte{}, fmt.Errorf("malformed data: %w", err)
+	}
+
+	return msg, sha256.Sum256(data), nil
+}
+
+// dirShardsFromEntries returns shards referenced by directory entries, end
+// is the upper bound of names covered by the last shard. Nil is returned if
+// entries are not shards.
+func dirShardsFromEntries(
+	entries []*protobuf.Directory_Entry,
+	end string,
+) (
+	[]*dirShard,
+	error,
+) {
+	shardsCount := 0
+	for _, entry := range entries {
+		if entry.GetEp().GetMimeType() == CinodeDirShardMimeType {
+			shardsCount++
+		}
+	}
+	if shardsCount == 0 {
+		return nil, nil
+	}
+	if shardsCount != len(entries) {
+		return nil, fmt.Errorf("%w: mixed shard and regular entries", ErrInvalidDirShard)
+	}
+
+	shards := make([]*dirShard, 0, len(entries))
+	for i, entry := range entries {
+		shardEP, err := entrypointFromProtobuf(entry.Ep)
+		if err != nil {
+			return nil, err
+		}
+		if shardEP.IsLink() {
+			return nil, fmt.Errorf("%w: shard %s is a link", ErrInvalidDirShard, entry.Name)
+		}
+
+		shard := &dirShard{ep: shardEP, name: entry.Name, end: end}
+		if i+1 < len(entries) {
+			shard.end = entries[i+1].Name
+		}
+		if shard.name >= shard.end && shard.end != "" {
+			return nil, fmt.Errorf("%w: shard %s is not sorted", ErrInvalidDirShard, entry.Name)
+		}
+		shards = append(shards, shard)
+	}
+
+	return shards, nil
+}
+
+// loadShard loads the i-th pending shard of the directory. Shards of further
+// tree levels replace the loaded shard in the list of pending shards while
+// entries of the final level are added to directory entries.
+func (d *nodeDirectory) loadShard(ctx context.Context, gc *graphContext, i int) error {
+	shard := d.pending[i]
+
+	msg, fingerprint, err := gc.readDirectoryBlob(ctx, shard.ep)
+	if err != nil {
+		return err
+	}
+	shard.fingerprint = fingerprint
+
+	if len(msg.Entries) == 0 || msg.Entries[0].Name != shard.name {
+		return fmt.Errorf("%w: shard %s does not start with its name", ErrInvalidDirShard, shard.name)
+	}
+
+	subShards, err := dirShardsFromEntries(msg.Entries, shard.end)
+	if err != nil {
+		return err
+	}
+	if subShards != nil {
+		d.pending = slices.Replace(d.pending, i, i+1, subShards...)
+		d.shards = append(d.shards, shard)
+		return nil
+	}
+
+	for _, entry := range msg.Entries {
+		if !shard.covers(entry.Name) {
+			return fmt.Errorf("%w: entry %s outside of shard %s", ErrInvalidDirShard, entry.Name, shard.name)
+		}
+		if _, exists := d.entries[entry.Name]; exists {
+			return fmt.Errorf("%w: %s", ErrCantOpenDirDuplicateEntry, entry.Name)
+		}
+
+		n, err := nodeFromDirEntry(entry)
+		if err != nil {
+			return err
+		}
+		d.entries[entry.Name] = n
+	}
+
+	d.pending = slices.Delete(d.pending, i, i+1)
+	d.shards = append(d.shards, shard)
+	return nil
+}
+
+// loadAllShards loads all pending shards of the directory
+func (d *nodeDirectory) loadAllShards(ctx context.Context, gc *graphContext) error {
+	for len(d.pending) > 0 {
+		// Blobs of all shards on the current level are requested at once
+		pending := false
+		for i := 0; i < len(d.pending); {
+			err := d.loadShard(ctx, gc, i)
+			if errors.Is(err, errBlobIOPending) {
+				pending = true
+				i++
+				continue
+			}
+			if err != nil {
+				return fmt.Errorf("%w: %w", ErrCantOpenDir, err)
+			}
+		}
+		if pending {
+			return errBlobIOPending
+		}
+	}
+	return nil
+}
+
+// resolveEntry finds the entry with given name, the shard covering the name
+// is loaded if needed
+func (d *nodeDirectory) resolveEntry(ctx context.Context, gc *graphContext, name string) (node, bool, error) {
+	for {
+		if entry, found := d.entries[name]; found {
+			return entry, true, nil
+		}
+
+		// Find the last pending shard starting at or before the name
+		i := sort.Search(len(d.pending), func(i int) bool { return d.pending[i].name > name }) - 1
+		if i < 0 || !d.pending[i].covers(name) {
+			return nil, false, nil
+		}
+
+		err := d.loadShard(ctx, gc, i)
+		if err != nil {
+			return nil, false, fmt.Errorf("%w: %w", ErrCantOpenDir, err)
+		}
+	}
+}
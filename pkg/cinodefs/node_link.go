@@ -27,6 +27,10 @@ type nodeLink struct {
 	ep     *Entrypoint // entrypoint of the link itself
 	target node        // target for the link
 	dState dirtyState
+
+	// targetChanged is set if link data must be updated during flush, it is
+	// not needed if dirty nodes are only deeper in the tree
+	targetChanged bool
 }
 
 func (c *nodeLink) dirty() dirtyState {
@@ -45,9 +49,15 @@ func (c *nodeLink) flush(ctx context.Context, gc *graphContext) (node, *Entrypoi
 		return nil, nil, err
 	}
 
-	err = gc.updateProtobufMessage(ctx, c.ep, &targetEP.ep)
-	if err != nil {
-		return nil, nil, err
+	// Changes deeper in the tree could be behind other writeable links,
+	// link data is updated only if the target entrypoint has changed. That
+	// way changes behind a writeable sub-link can be flushed even if the
+	// writer info of this link is not known (e.g. imported with AddWriterInfo)
+	if c.targetChanged {
+		err = gc.updateProtobufMessage(ctx, c.ep, &targetEP.ep)
+		if err != nil {
+			return nil, nil, err
+		}
 	}
 
 	ret := &nodeLink{
@@ -76,6 +86,9 @@ func (c *nodeLink) traverse(
 	if linkDepth >= opts.maxLinkRedirects {
 		return nil, 0, ErrTooManyRedirects
 	}
+	if opts.linkFollowed != nil {
+		opts.linkFollowed(c.ep)
+	}
 
 	// Note: we don't stop here even if we've reached the end of
 	// traverse path, delegate traversal to target node instead
@@ -119,6 +132,9 @@ func (c *nodeLink) traverse(
 	// sub-dirty propagates normally, dirty becomes sub-dirty
 	// because link's entrypoint never changes
 	c.dState = dsSubDirty
+	if targetState == dsDirty {
+		c.targetChanged = true
+	}
 	return c, dsSubDirty, nil
 }
 
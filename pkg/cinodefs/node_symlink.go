@@ -0,0 +1,75 @@
+/*
+Copyright © 2023 Bartłomiej Święcki (byo)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cinodefs
+
+import (
+	"context"
+	"slices"
+)
+
+// Entry is a symbolic link pointing to another path in the same filesystem
+type nodeSymlink struct {
+	target []string
+}
+
+func (c *nodeSymlink) dirty() dirtyState {
+	// Symbolic link is stored in the parent directory, any change
+	// to it makes the parent dirty instead
+	return dsClean
+}
+
+func (c *nodeSymlink) flush(ctx context.Context, gc *graphContext) (node, *Entrypoint, error) {
+	return c, nil, nil
+}
+
+func (c *nodeSymlink) traverse(
+	ctx context.Context,
+	gc *graphContext,
+	path []string,
+	pathPosition int,
+	linkDepth int,
+	isWritable bool,
+	opts traverseOptions,
+	whenReached traverseGoalFunc,
+) (
+	node,
+	dirtyState,
+	error,
+) {
+	if pathPosition == len(path) && opts.noFollowSymlink {
+		return whenReached(ctx, c, isWritable)
+	}
+
+	// Traversal must be restarted from the root with the target path
+	return nil, 0, &symlinkRedirect{
+		path: append(slices.Clone(c.target), path[pathPosition:]...),
+	}
+}
+
+func (c *nodeSymlink) entrypoint() (*Entrypoint, error) {
+	return nil, ErrIsASymlink
+}
+
+// symlinkRedirect is returned while traversing through a symbolic link,
+// path is the new path to traverse from the root
+type symlinkRedirect struct {
+	path []string
+}
+
+func (r *symlinkRedirect) Error() string {
+	return "unresolved symbolic link"
+}
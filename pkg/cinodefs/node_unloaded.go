@@ -49,9 +49,13 @@ func (c *nodeUnloaded) traverse(
 	dirtyState,
 	error,
 ) {
-	loaded, err := c.load(ctx, gc)
+	if opts.doNotLoadTarget && pathPosition == len(path) && !c.ep.IsLink() {
+		return whenReached(ctx, c, isWritable)
+	}
+
+	loaded, err := c.loadTraced(ctx, gc, path, pathPosition, linkDepth)
 	if err != nil {
-		return nil, 0, err
+		return nil, 0, wrapMissingKeyError(err, path[:pathPosition])
 	}
 
 	return loaded.traverse(
@@ -66,6 +70,45 @@ func (c *nodeUnloaded) traverse(
 	)
 }
 
+// loadTraced loads the node within a tracing span describing the place
+// in the traversed path where the node was reached
+func (c *nodeUnloaded) loadTraced(
+	ctx context.Context,
+	gc *graphContext,
+	path []string,
+	pathPosition int,
+	linkDepth int,
+) (_ node, err error) {
+	if gc.tracer == nil || (!c.ep.IsLink() && !c.ep.IsDir()) {
+		// Loading file nodes does not read any data
+		return c.load(ctx, gc)
+	}
+
+	ctx, span, finishSpan := gc.startStepSpan(ctx, SpanLoad, func() string {
+		return fmt.Sprintf("load:%d:%d:%s", pathPosition, linkDepth, c.ep.BlobName())
+	})
+	defer func() { finishSpan(err) }()
+
+	segment := "/"
+	if pathPosition > 0 {
+		segment = path[pathPosition-1]
+	}
+	span.SetAttribute(AttrPathSegment, segment)
+	span.SetAttribute(AttrBlobName, c.ep.BlobName().String())
+	span.SetAttribute(AttrEntryType, entryType(c.ep))
+	span.SetAttribute(AttrLinkDepth, linkDepth)
+
+	if c.ep.IsLink() {
+		loaded, cacheHit, err := c.loadEntrypointLinkCached(ctx, gc)
+		if gc.links != nil {
+			span.SetAttribute(AttrLinkCacheHit, cacheHit)
+		}
+		return loaded, err
+	}
+
+	return c.load(ctx, gc)
+}
+
 func (c *nodeUnloaded) load(ctx context.Context, gc *graphContext) (node, error) {
 	// Data is behind some entrypoint, try to load it
 	if c.ep.IsLink() {
@@ -80,47 +123,78 @@ func (c *nodeUnloaded) load(ctx context.Context, gc *graphContext) (node, error)
 }
 
 func (c *nodeUnloaded) loadEntrypointLink(ctx context.Context, gc *graphContext) (node, error) {
+	loaded, _, err := c.loadEntrypointLinkCached(ctx, gc)
+	return loaded, err
+}
+
+// loadEntrypointLinkCached loads the link, it also returns whether the target
+// was found in the link cache
+func (c *nodeUnloaded) loadEntrypointLinkCached(ctx context.Context, gc *graphContext) (node, bool, error) {
+	key, err := gc.keyFromEntrypoint(ctx, c.ep)
+	if err != nil {
+		return nil, false, fmt.Errorf("%w: %w", ErrCantOpenLink, err)
+	}
+
+	if cached := gc.links.get(c.ep.BlobName(), key); cached != nil {
+		return &nodeLink{
+			ep:     c.ep,
+			target: &nodeUnloaded{ep: cached},
+			dState: dsClean,
+		}, true, nil
+	}
+
 	targetEP := &Entrypoint{}
-	err := gc.readProtobufMessage(ctx, c.ep, &targetEP.ep)
+	err = gc.readProtobufMessage(ctx, c.ep, &targetEP.ep)
 	if err != nil {
-		return nil, fmt.Errorf("%w: %w", ErrCantOpenLink, err)
+		return nil, false, fmt.Errorf("%w: %w", ErrCantOpenLink, err)
 	}
 
 	err = expandEntrypointProto(targetEP)
 	if err != nil {
-		return nil, fmt.Errorf("%w: %w", ErrCantOpenLink, err)
+		return nil, false, fmt.Errorf("%w: %w", ErrCantOpenLink, err)
 	}
 
+	gc.links.put(c.ep.BlobName(), key, targetEP)
+
 	return &nodeLink{
 		ep:     c.ep,
 		target: &nodeUnloaded{ep: targetEP},
 		dState: dsClean,
-	}, nil
+	}, false, nil
 }
 
 func (c *nodeUnloaded) loadEntrypointDir(ctx context.Context, gc *graphContext) (node, error) {
-	msg := &protobuf.Directory{}
-	err := gc.readProtobufMessage(ctx, c.ep, msg)
+	msg, _, err := gc.readDirectoryBlob(ctx, c.ep)
 	if err != nil {
 		return nil, fmt.Errorf("%w: %w", ErrCantOpenDir, err)
 	}
 
+	// Entries of a split directory are loaded from shards on demand
+	pending, err := dirShardsFromEntries(msg.Entries, "")
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrCantOpenDir, err)
+	}
+	if pending != nil {
+		return &nodeDirectory{
+			stored:  c.ep,
+			entries: map[string]node{},
+			pending: pending,
+			dState:  dsClean,
+		}, nil
+	}
+
 	dir := make(map[string]node, len(msg.Entries))
 
 	for _, entry := range msg.Entries {
-		if entry.Name == "" {
-			return nil, fmt.Errorf("%w: %w", ErrCantOpenDir, ErrEmptyName)
-		}
 		if _, exists := dir[entry.Name]; exists {
 			return nil, fmt.Errorf("%w: %s", ErrCantOpenDirDuplicateEntry, entry.Name)
 		}
 
-		ep, err := entrypointFromProtobuf(entry.Ep)
+		n, err := nodeFromDirEntry(entry)
 		if err != nil {
 			return nil, fmt.Errorf("%w: %w", ErrCantOpenDir, err)
 		}
-
-		dir[entry.Name] = &nodeUnloaded{ep: ep}
+		dir[entry.Name] = n
 	}
 
 	return &nodeDirectory{
@@ -130,6 +204,25 @@ func (c *nodeUnloaded) loadEntrypointDir(ctx context.Context, gc *graphContext)
 	}, nil
 }
 
+// nodeFromDirEntry creates the node of a directory entry read from the
+// directory blob
+func nodeFromDirEntry(entry *protobuf.Directory_Entry) (node, error) {
+	if entry.Name == "" {
+		return nil, ErrEmptyName
+	}
+
+	if len(entry.SymlinkTarget) > 0 {
+		return symlinkFromProtobuf(entry)
+	}
+
+	ep, err := entrypointFromProtobuf(entry.Ep)
+	if err != nil {
+		return nil, err
+	}
+
+	return &nodeUnloaded{ep: ep}, nil
+}
+
 func (c *nodeUnloaded) entrypoint() (*Entrypoint, error) {
 	return c.ep, nil
 }
@@ -0,0 +1,57 @@
+/*
+Copyright © 2022 Bartłomiej Święcki (byo)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cinodefs
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var (
+	ErrInvalidPath = errors.New("invalid path")
+)
+
+// CanonicalPath returns the normalized form of a path given by the user,
+// surrounding whitespace is trimmed from every segment, segments must not
+// be empty (ErrEmptyName) and must not contain the path separator
+// (ErrInvalidPath). The original path is never modified.
+//
+// FS operations do not trim names, entries may contain whitespace, they only
+// validate the path the same way as CanonicalPath does.
+func CanonicalPath(path []string) ([]string, error) {
+	ret := make([]string, len(path))
+	for i, p := range path {
+		ret[i] = strings.TrimSpace(p)
+	}
+	return validatePath(ret)
+}
+
+// validatePath checks that segments of the path are not empty and do not
+// contain the path separator, names are not modified. A copy of the path
+// is returned thus it can be kept after the caller reuses the original one.
+func validatePath(path []string) ([]string, error) {
+	for i, p := range path {
+		if p == "" {
+			return nil, fmt.Errorf("%w: segment %d", ErrEmptyName, i)
+		}
+		if strings.Contains(p, "/") {
+			return nil, fmt.Errorf("%w: segment %d contains the path separator", ErrInvalidPath, i)
+		}
+	}
+	return append(make([]string, 0, len(path)), path...), nil
+}
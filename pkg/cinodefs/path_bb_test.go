@@ -0,0 +1,107 @@
+/*
+Copyright © 2022 Bartłomiej Święcki (byo)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cinodefs_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/cinode/go/pkg/blenc"
+	"github.com/cinode/go/pkg/cinodefs"
+	"github.com/cinode/go/pkg/datastore"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCanonicalPath(t *testing.T) {
+	for _, d := range []struct {
+		desc     string
+		path     []string
+		expected []string
+		err      error
+	}{
+		{desc: "empty path", path: []string{}, expected: []string{}},
+		{desc: "clean path", path: []string{"dir", "file.txt"}, expected: []string{"dir", "file.txt"}},
+		{desc: "surrounding whitespace", path: []string{" dir\t", "file.txt\n"}, expected: []string{"dir", "file.txt"}},
+		{desc: "inner whitespace", path: []string{"sub dir", "file name.txt"}, expected: []string{"sub dir", "file name.txt"}},
+		{desc: "empty segment", path: []string{"dir", ""}, err: cinodefs.ErrEmptyName},
+		{desc: "whitespace-only segment", path: []string{" \t", "file.txt"}, err: cinodefs.ErrEmptyName},
+		{desc: "embedded slash", path: []string{"dir/sub", "file.txt"}, err: cinodefs.ErrInvalidPath},
+		{desc: "slash only", path: []string{"/"}, err: cinodefs.ErrInvalidPath},
+	} {
+		t.Run(d.desc, func(t *testing.T) {
+			orig := append([]string{}, d.path...)
+
+			canonical, err := cinodefs.CanonicalPath(d.path)
+			require.ErrorIs(t, err, d.err)
+			require.Equal(t, d.expected, canonical)
+			require.Equal(t, orig, d.path)
+		})
+	}
+}
+
+func TestPathsInFS(t *testing.T) {
+	ctx := context.Background()
+	fs, err := cinodefs.New(ctx,
+		blenc.FromDatastore(datastore.InMemory()),
+		cinodefs.NewRootStaticDirectory(),
+	)
+	require.NoError(t, err)
+
+	// Names are not trimmed, entries differing by whitespace are distinct
+	ep, err := fs.SetEntryFile(ctx, []string{"dir", "file.txt"}, strings.NewReader("hello"))
+	require.NoError(t, err)
+	epSpace, err := fs.SetEntryFile(ctx, []string{"dir", "file.txt "}, strings.NewReader("hello "))
+	require.NoError(t, err)
+
+	found, err := fs.FindEntry(ctx, []string{"dir", "file.txt"})
+	require.NoError(t, err)
+	require.Equal(t, ep.String(), found.String())
+
+	found, err = fs.FindEntry(ctx, []string{"dir", "file.txt "})
+	require.NoError(t, err)
+	require.Equal(t, epSpace.String(), found.String())
+
+	_, err = fs.FindEntry(ctx, []string{" dir", "file.txt"})
+	require.ErrorIs(t, err, cinodefs.ErrEntryNotFound)
+
+	var walked [][]string
+	err = fs.Walk(ctx, []string{"dir"}, func(entry cinodefs.WalkEntry) error {
+		walked = append(walked, entry.Path)
+		return nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, [][]string{{"dir", "file.txt"}, {"dir", "file.txt "}}, walked)
+
+	err = fs.DeleteEntry(ctx, []string{"dir", "file.txt "})
+	require.NoError(t, err)
+	_, err = fs.FindEntry(ctx, []string{"dir", "file.txt"})
+	require.NoError(t, err)
+
+	// Invalid segments are rejected
+	_, err = fs.SetEntryFile(ctx, []string{"dir/file.txt"}, strings.NewReader("hello"))
+	require.ErrorIs(t, err, cinodefs.ErrInvalidPath)
+
+	_, err = fs.FindEntry(ctx, []string{"dir", ""})
+	require.ErrorIs(t, err, cinodefs.ErrEmptyName)
+
+	_, err = fs.FindEntry(ctx, []string{"dir/file.txt"})
+	require.ErrorIs(t, err, cinodefs.ErrInvalidPath)
+
+	err = fs.SetEntry(ctx, []string{"dir/file.txt"}, ep)
+	require.ErrorIs(t, err, cinodefs.ErrInvalidPath)
+}
@@ -93,6 +93,15 @@ type Entrypoint struct {
 	MimeType                string   `protobuf:"bytes,3,opt,name=mimeType,proto3" json:"mimeType,omitempty"`
 	NotValidBeforeUnixMicro int64    `protobuf:"varint,4,opt,name=notValidBeforeUnixMicro,proto3" json:"notValidBeforeUnixMicro,omitempty"`
 	NotValidAfterUnixMicro  int64    `protobuf:"varint,5,opt,name=notValidAfterUnixMicro,proto3" json:"notValidAfterUnixMicro,omitempty"`
+	// Modification time of the entry, 0 if not set
+	ModTimeUnixMicro int64 `protobuf:"varint,6,opt,name=modTimeUnixMicro,proto3" json:"modTimeUnixMicro,omitempty"`
+	// Weight used to order entries in directory listings, entries are
+	// always stored sorted by name, this only affects the presentation order
+	SortWeight int64 `protobuf:"varint,7,opt,name=sortWeight,proto3" json:"sortWeight,omitempty"`
+	// Length of the plaintext file content, 0 if not known
+	ContentLength int64 `protobuf:"varint,8,opt,name=contentLength,proto3" json:"contentLength,omitempty"`
+	// Custom key/value metadata of the entry
+	Metadata map[string]string `protobuf:"bytes,9,rep,name=metadata,proto3" json:"metadata,omitempty" protobuf_key:"bytes,1,opt,name=key,proto3" protobuf_val:"bytes,2,opt,name=value,proto3"`
 }
 
 func (x *Entrypoint) Reset() {
@@ -162,6 +171,34 @@ func (x *Entrypoint) GetNotValidAfterUnixMicro() int64 {
 	return 0
 }
 
+func (x *Entrypoint) GetModTimeUnixMicro() int64 {
+	if x != nil {
+		return x.ModTimeUnixMicro
+	}
+	return 0
+}
+
+func (x *Entrypoint) GetSortWeight() int64 {
+	if x != nil {
+		return x.SortWeight
+	}
+	return 0
+}
+
+func (x *Entrypoint) GetContentLength() int64 {
+	if x != nil {
+		return x.ContentLength
+	}
+	return 0
+}
+
+func (x *Entrypoint) GetMetadata() map[string]string {
+	if x != nil {
+		return x.Metadata
+	}
+	return nil
+}
+
 // Directory represents a content of a static directory
 type Directory struct {
 	state         protoimpl.MessageState
@@ -282,12 +319,14 @@ type Directory_Entry struct {
 
 	Name string      `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
 	Ep   *Entrypoint `protobuf:"bytes,2,opt,name=ep,proto3" json:"ep,omitempty"`
+	// Path the symbolic link points to, entrypoint is not set for symbolic links
+	SymlinkTarget []string `protobuf:"bytes,3,rep,name=symlinkTarget,proto3" json:"symlinkTarget,omitempty"`
 }
 
 func (x *Directory_Entry) Reset() {
 	*x = Directory_Entry{}
 	if protoimpl.UnsafeEnabled {
-		mi := &file_protobuf_proto_msgTypes[4]
+		mi := &file_protobuf_proto_msgTypes[5]
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		ms.StoreMessageInfo(mi)
 	}
@@ -300,7 +339,7 @@ func (x *Directory_Entry) String() string {
 func (*Directory_Entry) ProtoMessage() {}
 
 func (x *Directory_Entry) ProtoReflect() protoreflect.Message {
-	mi := &file_protobuf_proto_msgTypes[4]
+	mi := &file_protobuf_proto_msgTypes[5]
 	if protoimpl.UnsafeEnabled && x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -330,12 +369,19 @@ func (x *Directory_Entry) GetEp() *Entrypoint {
 	return nil
 }
 
+func (x *Directory_Entry) GetSymlinkTarget() []string {
+	if x != nil {
+		return x.SymlinkTarget
+	}
+	return nil
+}
+
 var File_protobuf_proto protoreflect.FileDescriptor
 
 var file_protobuf_proto_rawDesc = []byte{
 	0x0a, 0x0e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x75, 0x66, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f,
 	0x22, 0x1b, 0x0a, 0x07, 0x4b, 0x65, 0x79, 0x49, 0x6e, 0x66, 0x6f, 0x12, 0x10, 0x0a, 0x03, 0x6b,
-	0x65, 0x79, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x03, 0x6b, 0x65, 0x79, 0x22, 0xda, 0x01,
+	0x65, 0x79, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x03, 0x6b, 0x65, 0x79, 0x22, 0xc0, 0x03,
 	0x0a, 0x0a, 0x45, 0x6e, 0x74, 0x72, 0x79, 0x70, 0x6f, 0x69, 0x6e, 0x74, 0x12, 0x1a, 0x0a, 0x08,
 	0x62, 0x6c, 0x6f, 0x62, 0x4e, 0x61, 0x6d, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x08,
 	0x62, 0x6c, 0x6f, 0x62, 0x4e, 0x61, 0x6d, 0x65, 0x12, 0x22, 0x0a, 0x07, 0x6b, 0x65, 0x79, 0x49,
@@ -349,21 +395,38 @@ var file_protobuf_proto_rawDesc = []byte{
 	0x72, 0x6f, 0x12, 0x36, 0x0a, 0x16, 0x6e, 0x6f, 0x74, 0x56, 0x61, 0x6c, 0x69, 0x64, 0x41, 0x66,
 	0x74, 0x65, 0x72, 0x55, 0x6e, 0x69, 0x78, 0x4d, 0x69, 0x63, 0x72, 0x6f, 0x18, 0x05, 0x20, 0x01,
 	0x28, 0x03, 0x52, 0x16, 0x6e, 0x6f, 0x74, 0x56, 0x61, 0x6c, 0x69, 0x64, 0x41, 0x66, 0x74, 0x65,
-	0x72, 0x55, 0x6e, 0x69, 0x78, 0x4d, 0x69, 0x63, 0x72, 0x6f, 0x22, 0x71, 0x0a, 0x09, 0x44, 0x69,
-	0x72, 0x65, 0x63, 0x74, 0x6f, 0x72, 0x79, 0x12, 0x2a, 0x0a, 0x07, 0x65, 0x6e, 0x74, 0x72, 0x69,
-	0x65, 0x73, 0x18, 0x01, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x10, 0x2e, 0x44, 0x69, 0x72, 0x65, 0x63,
-	0x74, 0x6f, 0x72, 0x79, 0x2e, 0x45, 0x6e, 0x74, 0x72, 0x79, 0x52, 0x07, 0x65, 0x6e, 0x74, 0x72,
-	0x69, 0x65, 0x73, 0x1a, 0x38, 0x0a, 0x05, 0x45, 0x6e, 0x74, 0x72, 0x79, 0x12, 0x12, 0x0a, 0x04,
-	0x6e, 0x61, 0x6d, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x04, 0x6e, 0x61, 0x6d, 0x65,
-	0x12, 0x1b, 0x0a, 0x02, 0x65, 0x70, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x0b, 0x2e, 0x45,
-	0x6e, 0x74, 0x72, 0x79, 0x70, 0x6f, 0x69, 0x6e, 0x74, 0x52, 0x02, 0x65, 0x70, 0x22, 0x56, 0x0a,
-	0x0a, 0x57, 0x72, 0x69, 0x74, 0x65, 0x72, 0x49, 0x6e, 0x66, 0x6f, 0x12, 0x1a, 0x0a, 0x08, 0x62,
-	0x6c, 0x6f, 0x62, 0x4e, 0x61, 0x6d, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x08, 0x62,
-	0x6c, 0x6f, 0x62, 0x4e, 0x61, 0x6d, 0x65, 0x12, 0x10, 0x0a, 0x03, 0x6b, 0x65, 0x79, 0x18, 0x02,
-	0x20, 0x01, 0x28, 0x0c, 0x52, 0x03, 0x6b, 0x65, 0x79, 0x12, 0x1a, 0x0a, 0x08, 0x61, 0x75, 0x74,
-	0x68, 0x49, 0x6e, 0x66, 0x6f, 0x18, 0x03, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x08, 0x61, 0x75, 0x74,
-	0x68, 0x49, 0x6e, 0x66, 0x6f, 0x42, 0x0c, 0x5a, 0x0a, 0x2e, 0x3b, 0x70, 0x72, 0x6f, 0x74, 0x6f,
-	0x62, 0x75, 0x66, 0x62, 0x06, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x33,
+	0x72, 0x55, 0x6e, 0x69, 0x78, 0x4d, 0x69, 0x63, 0x72, 0x6f, 0x12, 0x2a, 0x0a, 0x10, 0x6d, 0x6f,
+	0x64, 0x54, 0x69, 0x6d, 0x65, 0x55, 0x6e, 0x69, 0x78, 0x4d, 0x69, 0x63, 0x72, 0x6f, 0x18, 0x06,
+	0x20, 0x01, 0x28, 0x03, 0x52, 0x10, 0x6d, 0x6f, 0x64, 0x54, 0x69, 0x6d, 0x65, 0x55, 0x6e, 0x69,
+	0x78, 0x4d, 0x69, 0x63, 0x72, 0x6f, 0x12, 0x1e, 0x0a, 0x0a, 0x73, 0x6f, 0x72, 0x74, 0x57, 0x65,
+	0x69, 0x67, 0x68, 0x74, 0x18, 0x07, 0x20, 0x01, 0x28, 0x03, 0x52, 0x0a, 0x73, 0x6f, 0x72, 0x74,
+	0x57, 0x65, 0x69, 0x67, 0x68, 0x74, 0x12, 0x24, 0x0a, 0x0d, 0x63, 0x6f, 0x6e, 0x74, 0x65, 0x6e,
+	0x74, 0x4c, 0x65, 0x6e, 0x67, 0x74, 0x68, 0x18, 0x08, 0x20, 0x01, 0x28, 0x03, 0x52, 0x0d, 0x63,
+	0x6f, 0x6e, 0x74, 0x65, 0x6e, 0x74, 0x4c, 0x65, 0x6e, 0x67, 0x74, 0x68, 0x12, 0x35, 0x0a, 0x08,
+	0x6d, 0x65, 0x74, 0x61, 0x64, 0x61, 0x74, 0x61, 0x18, 0x09, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x19,
+	0x2e, 0x45, 0x6e, 0x74, 0x72, 0x79, 0x70, 0x6f, 0x69, 0x6e, 0x74, 0x2e, 0x4d, 0x65, 0x74, 0x61,
+	0x64, 0x61, 0x74, 0x61, 0x45, 0x6e, 0x74, 0x72, 0x79, 0x52, 0x08, 0x6d, 0x65, 0x74, 0x61, 0x64,
+	0x61, 0x74, 0x61, 0x1a, 0x3b, 0x0a, 0x0d, 0x4d, 0x65, 0x74, 0x61, 0x64, 0x61, 0x74, 0x61, 0x45,
+	0x6e, 0x74, 0x72, 0x79, 0x12, 0x10, 0x0a, 0x03, 0x6b, 0x65, 0x79, 0x18, 0x01, 0x20, 0x01, 0x28,
+	0x09, 0x52, 0x03, 0x6b, 0x65, 0x79, 0x12, 0x14, 0x0a, 0x05, 0x76, 0x61, 0x6c, 0x75, 0x65, 0x18,
+	0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x05, 0x76, 0x61, 0x6c, 0x75, 0x65, 0x3a, 0x02, 0x38, 0x01,
+	0x22, 0x97, 0x01, 0x0a, 0x09, 0x44, 0x69, 0x72, 0x65, 0x63, 0x74, 0x6f, 0x72, 0x79, 0x12, 0x2a,
+	0x0a, 0x07, 0x65, 0x6e, 0x74, 0x72, 0x69, 0x65, 0x73, 0x18, 0x01, 0x20, 0x03, 0x28, 0x0b, 0x32,
+	0x10, 0x2e, 0x44, 0x69, 0x72, 0x65, 0x63, 0x74, 0x6f, 0x72, 0x79, 0x2e, 0x45, 0x6e, 0x74, 0x72,
+	0x79, 0x52, 0x07, 0x65, 0x6e, 0x74, 0x72, 0x69, 0x65, 0x73, 0x1a, 0x5e, 0x0a, 0x05, 0x45, 0x6e,
+	0x74, 0x72, 0x79, 0x12, 0x12, 0x0a, 0x04, 0x6e, 0x61, 0x6d, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28,
+	0x09, 0x52, 0x04, 0x6e, 0x61, 0x6d, 0x65, 0x12, 0x1b, 0x0a, 0x02, 0x65, 0x70, 0x18, 0x02, 0x20,
+	0x01, 0x28, 0x0b, 0x32, 0x0b, 0x2e, 0x45, 0x6e, 0x74, 0x72, 0x79, 0x70, 0x6f, 0x69, 0x6e, 0x74,
+	0x52, 0x02, 0x65, 0x70, 0x12, 0x24, 0x0a, 0x0d, 0x73, 0x79, 0x6d, 0x6c, 0x69, 0x6e, 0x6b, 0x54,
+	0x61, 0x72, 0x67, 0x65, 0x74, 0x18, 0x03, 0x20, 0x03, 0x28, 0x09, 0x52, 0x0d, 0x73, 0x79, 0x6d,
+	0x6c, 0x69, 0x6e, 0x6b, 0x54, 0x61, 0x72, 0x67, 0x65, 0x74, 0x22, 0x56, 0x0a, 0x0a, 0x57, 0x72,
+	0x69, 0x74, 0x65, 0x72, 0x49, 0x6e, 0x66, 0x6f, 0x12, 0x1a, 0x0a, 0x08, 0x62, 0x6c, 0x6f, 0x62,
+	0x4e, 0x61, 0x6d, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x08, 0x62, 0x6c, 0x6f, 0x62,
+	0x4e, 0x61, 0x6d, 0x65, 0x12, 0x10, 0x0a, 0x03, 0x6b, 0x65, 0x79, 0x18, 0x02, 0x20, 0x01, 0x28,
+	0x0c, 0x52, 0x03, 0x6b, 0x65, 0x79, 0x12, 0x1a, 0x0a, 0x08, 0x61, 0x75, 0x74, 0x68, 0x49, 0x6e,
+	0x66, 0x6f, 0x18, 0x03, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x08, 0x61, 0x75, 0x74, 0x68, 0x49, 0x6e,
+	0x66, 0x6f, 0x42, 0x0c, 0x5a, 0x0a, 0x2e, 0x3b, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x75, 0x66,
+	0x62, 0x06, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x33,
 }
 
 var (
@@ -378,23 +441,25 @@ func file_protobuf_proto_rawDescGZIP() []byte {
 	return file_protobuf_proto_rawDescData
 }
 
-var file_protobuf_proto_msgTypes = make([]protoimpl.MessageInfo, 5)
+var file_protobuf_proto_msgTypes = make([]protoimpl.MessageInfo, 6)
 var file_protobuf_proto_goTypes = []interface{}{
 	(*KeyInfo)(nil),         // 0: KeyInfo
 	(*Entrypoint)(nil),      // 1: Entrypoint
 	(*Directory)(nil),       // 2: Directory
 	(*WriterInfo)(nil),      // 3: WriterInfo
-	(*Directory_Entry)(nil), // 4: Directory.Entry
+	nil,                     // 4: Entrypoint.MetadataEntry
+	(*Directory_Entry)(nil), // 5: Directory.Entry
 }
 var file_protobuf_proto_depIdxs = []int32{
 	0, // 0: Entrypoint.keyInfo:type_name -> KeyInfo
-	4, // 1: Directory.entries:type_name -> Directory.Entry
-	1, // 2: Directory.Entry.ep:type_name -> Entrypoint
-	3, // [3:3] is the sub-list for method output_type
-	3, // [3:3] is the sub-list for method input_type
-	3, // [3:3] is the sub-list for extension type_name
-	3, // [3:3] is the sub-list for extension extendee
-	0, // [0:3] is the sub-list for field type_name
+	4, // 1: Entrypoint.metadata:type_name -> Entrypoint.MetadataEntry
+	5, // 2: Directory.entries:type_name -> Directory.Entry
+	1, // 3: Directory.Entry.ep:type_name -> Entrypoint
+	4, // [4:4] is the sub-list for method output_type
+	4, // [4:4] is the sub-list for method input_type
+	4, // [4:4] is the sub-list for extension type_name
+	4, // [4:4] is the sub-list for extension extendee
+	0, // [0:4] is the sub-list for field type_name
 }
 
 func init() { file_protobuf_proto_init() }
@@ -451,7 +516,7 @@ func file_protobuf_proto_init() {
 				return nil
 			}
 		}
-		file_protobuf_proto_msgTypes[4].Exporter = func(v interface{}, i int) interface{} {
+		file_protobuf_proto_msgTypes[5].Exporter = func(v interface{}, i int) interface{} {
 			switch v := v.(*Directory_Entry); i {
 			case 0:
 				return &v.state
@@ -470,7 +535,7 @@ func file_protobuf_proto_init() {
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: file_protobuf_proto_rawDesc,
 			NumEnums:      0,
-			NumMessages:   5,
+			NumMessages:   6,
 			NumExtensions: 0,
 			NumServices:   0,
 		},
@@ -0,0 +1,87 @@
+/*
+Copyright © 2023 Bartłomiej Święcki (byo)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cinodefs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+var (
+	ErrRebuildMissingBlob = errors.New("blob referenced by the rebuilt directory does not exist")
+)
+
+// RebuildDirectory replaces the directory at given path with a fresh one
+// consisting of given entries. This is meant for disaster recovery where the
+// directory blob is lost but the blobs of its children are still present and
+// the mapping between names and entrypoints is known from other sources.
+//
+// The previous directory content is never read thus the directory blob may
+// be missing or corrupted. Every entrypoint must point to a blob present
+// in the datastore, otherwise ErrRebuildMissingBlob is returned and the
+// filesystem is left unchanged.
+func (fs *cinodeFS) RebuildDirectory(
+	ctx context.Context,
+	path []string,
+	entries map[string]*Entrypoint,
+) error {
+	dir := make(map[string]node, len(entries))
+	for name, ep := range entries {
+		if name == "" {
+			return ErrEmptyName
+		}
+		if ep == nil {
+			return fmt.Errorf("%w: entry '%s'", ErrNilEntrypoint, name)
+		}
+
+		exists, err := fs.c.be.Exists(ctx, ep.BlobName())
+		if err != nil {
+			return err
+		}
+		if !exists {
+			return fmt.Errorf("%w: entry '%s', blob %s", ErrRebuildMissingBlob, name, ep.BlobName())
+		}
+
+		dir[name] = &nodeUnloaded{ep: ep}
+	}
+
+	whenReached := func(
+		ctx context.Context,
+		current node,
+		isWriteable bool,
+	) (node, dirtyState, error) {
+		if !isWriteable {
+			return nil, 0, ErrMissingWriterInfo
+		}
+		return &nodeDirectory{
+			entries: dir,
+			dState:  dsDirty,
+		}, dsDirty, nil
+	}
+
+	return fs.traverseGraph(
+		ctx,
+		path,
+		traverseOptions{
+			createNodes:     true,
+			doNotLoadTarget: true,
+			noFollowSymlink: true,
+		},
+		whenReached,
+	)
+}
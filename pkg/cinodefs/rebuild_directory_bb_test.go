@@ -0,0 +1,126 @@
+/*
+Copyright © 2023 Bartłomiej Święcki (byo)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cinodefs_test
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/cinode/go/pkg/blenc"
+	"github.com/cinode/go/pkg/cinodefs"
+	"github.com/cinode/go/pkg/datastore"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRebuildDirectory(t *testing.T) {
+	ctx := context.Background()
+	ds := datastore.InMemory()
+	be := blenc.FromDatastore(ds)
+	fs, err := cinodefs.New(ctx, be, cinodefs.NewRootDynamicLink())
+	require.NoError(t, err)
+
+	for path, content := range map[string]string{
+		"dir/a.txt":     "a",
+		"dir/sub/b.txt": "b",
+		"other.txt":     "other",
+	} {
+		_, err := fs.SetEntryFile(ctx, strings.Split(path, "/"), strings.NewReader(content))
+		require.NoError(t, err)
+	}
+	require.NoError(t, fs.Flush(ctx))
+
+	// Mapping known to the application
+	known := map[string]*cinodefs.Entrypoint{}
+	for _, name := range []string{"a.txt", "sub"} {
+		ep, err := fs.FindEntry(ctx, []string{"dir", name})
+		require.NoError(t, err)
+		known[name] = ep
+	}
+
+	dirEP, err := fs.FindEntry(ctx, []string{"dir"})
+	require.NoError(t, err)
+	require.NoError(t, ds.Delete(ctx, dirEP.BlobName()))
+
+	wi, err := fs.RootWriterInfo(ctx)
+	require.NoError(t, err)
+	fs, err = cinodefs.New(ctx, be, cinodefs.RootWriterInfo(wi))
+	require.NoError(t, err)
+
+	err = fs.Walk(ctx, []string{"dir"}, func(cinodefs.WalkEntry) error { return nil })
+	require.ErrorIs(t, err, cinodefs.ErrCantOpenDir)
+
+	t.Run("errors", func(t *testing.T) {
+		for _, d := range []struct {
+			name    string
+			entries map[string]*cinodefs.Entrypoint
+			err     error
+		}{
+			{"missing blob", map[string]*cinodefs.Entrypoint{"a.txt": known["a.txt"], "x": dirEP}, cinodefs.ErrRebuildMissingBlob},
+			{"nil entrypoint", map[string]*cinodefs.Entrypoint{"x": nil}, cinodefs.ErrNilEntrypoint},
+			{"empty name", map[string]*cinodefs.Entrypoint{"": known["a.txt"]}, cinodefs.ErrEmptyName},
+		} {
+			t.Run(d.name, func(t *testing.T) {
+				err := fs.RebuildDirectory(ctx, []string{"dir"}, d.entries)
+				require.ErrorIs(t, err, d.err)
+			})
+		}
+
+		// Filesystem is left untouched
+		err = fs.Walk(ctx, []string{"dir"}, func(cinodefs.WalkEntry) error { return nil })
+		require.ErrorIs(t, err, cinodefs.ErrCantOpenDir)
+
+		rootEP, err := fs.RootEntrypoint()
+		require.NoError(t, err)
+		fsRO, err := cinodefs.New(ctx, be, cinodefs.RootEntrypoint(rootEP))
+		require.NoError(t, err)
+
+		err = fsRO.RebuildDirectory(ctx, []string{"dir"}, known)
+		require.ErrorIs(t, err, cinodefs.ErrMissingWriterInfo)
+	})
+
+	t.Run("rebuild", func(t *testing.T) {
+		err := fs.RebuildDirectory(ctx, []string{"dir"}, known)
+		require.NoError(t, err)
+		require.NoError(t, fs.Flush(ctx))
+
+		fs2, err := cinodefs.New(ctx, be, cinodefs.RootWriterInfo(wi))
+		require.NoError(t, err)
+
+		for path, content := range map[string]string{
+			"dir/a.txt":     "a",
+			"dir/sub/b.txt": "b",
+			"other.txt":     "other",
+		} {
+			rc, err := fs2.OpenEntryData(ctx, strings.Split(path, "/"))
+			require.NoError(t, err)
+			data, err := io.ReadAll(rc)
+			require.NoError(t, err)
+			require.NoError(t, rc.Close())
+			require.Equal(t, content, string(data))
+		}
+
+		entries := []string{}
+		err = fs2.Walk(ctx, []string{"dir"}, func(e cinodefs.WalkEntry) error {
+			entries = append(entries, strings.Join(e.Path, "/"))
+			return nil
+		})
+		require.NoError(t, err)
+		require.Equal(t, []string{"dir/a.txt", "dir/sub", "dir/sub/b.txt"}, entries)
+	})
+}
@@ -0,0 +1,135 @@
+/*
+Copyright © 2023 Bartłomiej Święcki (byo)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cinodefs
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"golang.org/x/exp/slog"
+)
+
+const (
+	ShareLinkScheme = "cinode"
+)
+
+var (
+	ErrInvalidShareLink = errors.New("invalid share link")
+)
+
+// ShareLink is a reference to a path within a dataset in a form suitable
+// for sharing as a single URL:
+//
+//	cinode://host/path/to/entry#<entrypoint>
+//
+// The host points to the node serving the dataset. The entrypoint is carried
+// in the URL fragment which is never sent to servers by web clients. Since
+// the entrypoint contains the read key, only the FullLink method reveals it,
+// the String method and logged ShareLink values are redacted.
+type ShareLink struct {
+	Host string
+	Path []string
+
+	// Entrypoint of the dataset root, nil if the link does not carry one
+	Entrypoint *Entrypoint
+}
+
+// NewShareLink creates a share link for given path within the dataset
+// identified by the root entrypoint, the entrypoint may be nil
+func NewShareLink(host string, path []string, ep *Entrypoint) ShareLink {
+	return ShareLink{
+		Host:       host,
+		Path:       path,
+		Entrypoint: ep,
+	}
+}
+
+// ParseShareLink parses the share link string. Errors do not include the
+// parsed string to avoid leaking the key.
+func ParseShareLink(s string) (ShareLink, error) {
+	u, err := url.Parse(s)
+	if err != nil {
+		return ShareLink{}, fmt.Errorf("%w: malformed url", ErrInvalidShareLink)
+	}
+	if u.Scheme != ShareLinkScheme {
+		return ShareLink{}, fmt.Errorf("%w: scheme must be '%s'", ErrInvalidShareLink, ShareLinkScheme)
+	}
+	if u.Host == "" {
+		return ShareLink{}, fmt.Errorf("%w: missing host", ErrInvalidShareLink)
+	}
+	if u.User != nil || u.RawQuery != "" {
+		return ShareLink{}, fmt.Errorf("%w: unexpected url component", ErrInvalidShareLink)
+	}
+
+	path := []string{}
+	for _, p := range strings.Split(strings.Trim(u.EscapedPath(), "/"), "/") {
+		if p == "" {
+			continue
+		}
+		segment, err := url.PathUnescape(p)
+		if err != nil {
+			return ShareLink{}, fmt.Errorf("%w: malformed path", ErrInvalidShareLink)
+		}
+		path = append(path, segment)
+	}
+
+	var ep *Entrypoint
+	if u.Fragment != "" {
+		ep, err = EntrypointFromString(u.Fragment)
+		if err != nil {
+			return ShareLink{}, fmt.Errorf("%w: %w", ErrInvalidShareLink, err)
+		}
+	}
+
+	return NewShareLink(u.Host, path, ep), nil
+}
+
+// HasKey returns true if the link carries the entrypoint with the key
+// needed to read the dataset. Links without the key can only be used
+// to locate the data.
+func (l ShareLink) HasKey() bool {
+	return l.Entrypoint != nil &&
+		l.Entrypoint.ep.KeyInfo != nil &&
+		len(l.Entrypoint.ep.KeyInfo.Key) > 0
+}
+
+// FullLink returns the complete share link including the entrypoint, this
+// is the form that should be given to the recipient of the link
+func (l ShareLink) FullLink() string {
+	s := l.String()
+	if l.Entrypoint != nil {
+		s += "#" + l.Entrypoint.String()
+	}
+	return s
+}
+
+// String returns the share link without the entrypoint, the link can thus
+// be safely formatted or included in error messages
+func (l ShareLink) String() string {
+	segments := make([]string, len(l.Path))
+	for i, p := range l.Path {
+		segments[i] = url.PathEscape(p)
+	}
+	return ShareLinkScheme + "://" + l.Host + "/" + strings.Join(segments, "/")
+}
+
+// LogValue ensures the entrypoint is not revealed in logs
+func (l ShareLink) LogValue() slog.Value {
+	return slog.StringValue(l.String())
+}
@@ -0,0 +1,145 @@
+/*
+Copyright © 2023 Bartłomiej Święcki (byo)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cinodefs_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/url"
+	"testing"
+
+	"github.com/cinode/go/pkg/blenc"
+	"github.com/cinode/go/pkg/cinodefs"
+	"github.com/cinode/go/pkg/cinodefs/protobuf"
+	"github.com/cinode/go/pkg/datastore"
+	"github.com/cinode/go/pkg/utilities/golang"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/exp/slog"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestShareLink(t *testing.T) {
+	ctx := context.Background()
+	fs, err := cinodefs.New(ctx,
+		blenc.FromDatastore(datastore.InMemory()),
+		cinodefs.NewRootDynamicLink(),
+	)
+	require.NoError(t, err)
+	require.NoError(t, fs.Flush(ctx))
+
+	ep, err := fs.RootEntrypoint()
+	require.NoError(t, err)
+
+	t.Run("round trip", func(t *testing.T) {
+		for _, path := range [][]string{
+			{},
+			{"index.html"},
+			{"dir", "sub dir", "file?name#1.txt"},
+		} {
+			link := cinodefs.NewShareLink("example.com:8080", path, ep)
+			s := link.FullLink()
+
+			parsed, err := cinodefs.ParseShareLink(s)
+			require.NoError(t, err)
+			require.Equal(t, "example.com:8080", parsed.Host)
+			require.Equal(t, path, parsed.Path)
+			require.Equal(t, ep.String(), parsed.Entrypoint.String())
+			require.True(t, parsed.HasKey())
+			require.Equal(t, s, parsed.FullLink())
+		}
+	})
+
+	t.Run("key rides in the fragment", func(t *testing.T) {
+		link := cinodefs.NewShareLink("example.com", []string{"dir", "file.txt"}, ep)
+		require.Equal(t, "cinode://example.com/dir/file.txt#"+ep.String(), link.FullLink())
+
+		u, err := url.Parse(link.FullLink())
+		require.NoError(t, err)
+		require.Equal(t, ep.String(), u.Fragment)
+
+		// Only the fragment carries the entrypoint
+		u.Fragment = ""
+		require.NotContains(t, u.String(), ep.String())
+	})
+
+	t.Run("key is not formatted", func(t *testing.T) {
+		link := cinodefs.NewShareLink("example.com", []string{"dir", "file.txt"}, ep)
+		require.Equal(t, "cinode://example.com/dir/file.txt", link.String())
+		require.Equal(t, "cinode://example.com/dir/file.txt", fmt.Sprintf("%v", link))
+		require.NotContains(t, fmt.Sprintf("%+v", link), ep.String())
+		require.NotContains(t, fmt.Errorf("can't open %v", link).Error(), ep.String())
+	})
+
+	t.Run("key is not logged", func(t *testing.T) {
+		link := cinodefs.NewShareLink("example.com", []string{"file.txt"}, ep)
+
+		buf := bytes.NewBuffer(nil)
+		log := slog.New(slog.NewTextHandler(buf, nil))
+		log.Info("opening", "link", link)
+
+		require.Contains(t, buf.String(), "cinode://example.com/file.txt")
+		require.NotContains(t, buf.String(), ep.String())
+	})
+
+	t.Run("parse errors do not reveal the key", func(t *testing.T) {
+		_, err := cinodefs.ParseShareLink("http://example.com/file.txt#" + ep.String())
+		require.ErrorIs(t, err, cinodefs.ErrInvalidShareLink)
+		require.NotContains(t, err.Error(), ep.String())
+
+		_, err = cinodefs.ParseShareLink("cinode://example.com/%zz#" + ep.String())
+		require.ErrorIs(t, err, cinodefs.ErrInvalidShareLink)
+		require.NotContains(t, err.Error(), ep.String())
+	})
+
+	t.Run("link without a key", func(t *testing.T) {
+		parsed, err := cinodefs.ParseShareLink("cinode://example.com/dir/file.txt")
+		require.NoError(t, err)
+		require.Equal(t, []string{"dir", "file.txt"}, parsed.Path)
+		require.Nil(t, parsed.Entrypoint)
+		require.False(t, parsed.HasKey())
+		require.Equal(t, "cinode://example.com/dir/file.txt", parsed.FullLink())
+
+		// Entrypoint with the key stripped only identifies the blob
+		withoutKey, err := cinodefs.EntrypointFromBytes(golang.Must(proto.Marshal(
+			&protobuf.Entrypoint{BlobName: ep.BlobName().Bytes()},
+		)))
+		require.NoError(t, err)
+		parsed, err = cinodefs.ParseShareLink(
+			cinodefs.NewShareLink("example.com", nil, withoutKey).FullLink(),
+		)
+		require.NoError(t, err)
+		require.NotNil(t, parsed.Entrypoint)
+		require.True(t, parsed.Entrypoint.BlobName().Equal(ep.BlobName()))
+		require.False(t, parsed.HasKey())
+	})
+
+	t.Run("invalid links", func(t *testing.T) {
+		for _, s := range []string{
+			"",
+			"://",
+			"cinode:///file.txt",
+			"https://example.com/file.txt",
+			"cinode://user@example.com/file.txt",
+			"cinode://example.com/file.txt?query=1",
+			"cinode://example.com/file.txt#invalid-entrypoint!",
+		} {
+			_, err := cinodefs.ParseShareLink(s)
+			require.ErrorIs(t, err, cinodefs.ErrInvalidShareLink, s)
+		}
+	})
+}
@@ -0,0 +1,81 @@
+/*
+Copyright © 2023 Bartłomiej Święcki (byo)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cinodefs
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	ErrStatsNotSupported = errors.New("stats not supported for given filesystem")
+)
+
+// CacheStats describes the in-memory state of the filesystem
+type CacheStats struct {
+	// WriterInfos is the number of known writer infos for dynamic links
+	WriterInfos int `json:"writer-infos"`
+
+	// LoadedNodes is the number of nodes loaded into memory
+	LoadedNodes int `json:"loaded-nodes"`
+
+	// UnloadedNodes is the number of nodes known only by their entrypoint
+	UnloadedNodes int `json:"unloaded-nodes"`
+
+	// DirtyNodes is the number of nodes with changes not yet flushed
+	DirtyNodes int `json:"dirty-nodes"`
+}
+
+// GetCacheStats returns statistics of the in-memory node tree
+// and known writer infos of given filesystem.
+func GetCacheStats(fs FS) (CacheStats, error) {
+	cfs, ok := fs.(*cinodeFS)
+	if !ok {
+		return CacheStats{}, fmt.Errorf("%w: %T", ErrStatsNotSupported, fs)
+	}
+
+	cfs.lock.Lock()
+	defer cfs.lock.Unlock()
+
+	stats := CacheStats{
+		WriterInfos: len(cfs.c.authInfos),
+	}
+	collectNodeStats(&stats, cfs.rootEP)
+	return stats, nil
+}
+
+func collectNodeStats(stats *CacheStats, n node) {
+	if n.dirty() == dsDirty {
+		stats.DirtyNodes++
+	}
+
+	switch n := n.(type) {
+	case *nodeUnloaded:
+		stats.UnloadedNodes++
+	case *nodeDirectory:
+		stats.LoadedNodes++
+		stats.UnloadedNodes += len(n.pending)
+		for _, child := range n.entries {
+			collectNodeStats(stats, child)
+		}
+	case *nodeLink:
+		stats.LoadedNodes++
+		collectNodeStats(stats, n.target)
+	default:
+		stats.LoadedNodes++
+	}
+}
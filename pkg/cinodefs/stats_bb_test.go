@@ -0,0 +1,81 @@
+/*
+Copyright © 2023 Bartłomiej Święcki (byo)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cinodefs_test
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/cinode/go/pkg/blenc"
+	"github.com/cinode/go/pkg/cinodefs"
+	"github.com/cinode/go/pkg/datastore"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetCacheStats(t *testing.T) {
+	ctx := context.Background()
+	be := blenc.FromDatastore(datastore.InMemory())
+	fs, err := cinodefs.New(ctx, be, cinodefs.NewRootStaticDirectory())
+	require.NoError(t, err)
+
+	_, err = fs.SetEntryFile(ctx, []string{"dir", "file.txt"}, strings.NewReader("hello"))
+	require.NoError(t, err)
+	_, err = fs.InjectDynamicLink(ctx, []string{"dir"})
+	require.NoError(t, err)
+
+	stats, err := cinodefs.GetCacheStats(fs)
+	require.NoError(t, err)
+	require.Equal(t, 1, stats.WriterInfos)
+	require.Positive(t, stats.DirtyNodes)
+
+	require.NoError(t, fs.Flush(ctx))
+
+	stats, err = cinodefs.GetCacheStats(fs)
+	require.NoError(t, err)
+	require.Equal(t, 1, stats.WriterInfos)
+	require.Zero(t, stats.DirtyNodes)
+
+	rootEP, err := fs.RootEntrypoint()
+	require.NoError(t, err)
+	fs2, err := cinodefs.New(ctx, be, cinodefs.RootEntrypoint(rootEP))
+	require.NoError(t, err)
+
+	stats, err = cinodefs.GetCacheStats(fs2)
+	require.NoError(t, err)
+	require.Equal(t, cinodefs.CacheStats{UnloadedNodes: 1}, stats)
+
+	t.Run("json", func(t *testing.T) {
+		data, err := json.Marshal(cinodefs.CacheStats{
+			WriterInfos:   1,
+			LoadedNodes:   2,
+			UnloadedNodes: 3,
+			DirtyNodes:    4,
+		})
+		require.NoError(t, err)
+		require.JSONEq(t,
+			`{"writer-infos":1,"loaded-nodes":2,"unloaded-nodes":3,"dirty-nodes":4}`,
+			string(data),
+		)
+	})
+
+	t.Run("not supported", func(t *testing.T) {
+		_, err := cinodefs.GetCacheStats(nil)
+		require.ErrorIs(t, err, cinodefs.ErrStatsNotSupported)
+	})
+}
@@ -0,0 +1,84 @@
+/*
+Copyright © 2023 Bartłomiej Święcki (byo)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cinodefs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/cinode/go/pkg/blenc"
+	"github.com/cinode/go/pkg/common"
+)
+
+var (
+	ErrSwapRootFailed         = errors.New("could not swap root")
+	ErrSwapRootNotALink       = fmt.Errorf("%w: writer info does not identify a dynamic link", ErrSwapRootFailed)
+	ErrSwapRootSelfReference  = fmt.Errorf("%w: link can not point to itself", ErrSwapRootFailed)
+	ErrSwapRootUnreadableRoot = fmt.Errorf("%w: new root is not readable", ErrSwapRootFailed)
+)
+
+// SwapRoot changes the target of the dynamic link identified by given writer
+// info to an already stored root entrypoint.
+//
+// The change is done with a single link update thus readers either see the
+// old or the new root, never a mix of both. All blobs reachable from the new
+// root are read and validated before the switch to ensure the whole dataset
+// is present in the datastore. Swapping back to the previous root entrypoint
+// can be used as an instant rollback.
+func SwapRoot(
+	ctx context.Context,
+	be blenc.BE,
+	wi *WriterInfo,
+	newRoot *Entrypoint,
+) error {
+	if be == nil {
+		return ErrInvalidBE
+	}
+	if wi == nil {
+		return fmt.Errorf("%w: nil", ErrInvalidWriterInfoData)
+	}
+	if newRoot == nil {
+		return ErrNilEntrypoint
+	}
+
+	bn, err := common.BlobNameFromBytes(wi.wi.BlobName)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidWriterInfoData, err)
+	}
+	linkEP := EntrypointFromBlobNameAndKey(bn, common.BlobKeyFromBytes(wi.wi.Key))
+	if !linkEP.IsLink() {
+		return ErrSwapRootNotALink
+	}
+	if newRoot.BlobName().Equal(bn) {
+		return ErrSwapRootSelfReference
+	}
+
+	gc := graphContext{
+		be: be,
+		authInfos: map[string]*common.AuthInfo{
+			bn.String(): common.AuthInfoFromBytes(wi.wi.AuthInfo),
+		},
+	}
+
+	err = VerifyReachable(ctx, be, newRoot, DefaultMaxLinksRedirects)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrSwapRootUnreadableRoot, err)
+	}
+
+	return gc.updateProtobufMessage(ctx, linkEP, &newRoot.ep)
+}
@@ -0,0 +1,182 @@
+/*
+Copyright © 2023 Bartłomiej Święcki (byo)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cinodefs_test
+
+import (
+	"context"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/cinode/go/pkg/blenc"
+	"github.com/cinode/go/pkg/cinodefs"
+	"github.com/cinode/go/pkg/cinodefs/protobuf"
+	"github.com/cinode/go/pkg/common"
+	"github.com/cinode/go/pkg/datastore"
+	"github.com/cinode/go/pkg/utilities/golang"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestSwapRoot(t *testing.T) {
+	ctx := context.Background()
+	be := blenc.FromDatastore(datastore.InMemory())
+
+	prepareRoot := func(content string) *cinodefs.Entrypoint {
+		fs, err := cinodefs.New(ctx, be, cinodefs.NewRootStaticDirectory())
+		require.NoError(t, err)
+		for _, name := range []string{"a.txt", "b.txt"} {
+			_, err = fs.SetEntryFile(ctx, []string{name}, strings.NewReader(content))
+			require.NoError(t, err)
+		}
+		require.NoError(t, fs.Flush(ctx))
+		ep, err := fs.RootEntrypoint()
+		require.NoError(t, err)
+		return ep
+	}
+
+	blue := prepareRoot("blue")
+	green := prepareRoot("green")
+
+	liveFS, err := cinodefs.New(ctx, be, cinodefs.NewRootDynamicLink())
+	require.NoError(t, err)
+	require.NoError(t, liveFS.Flush(ctx))
+	wi, err := liveFS.RootWriterInfo(ctx)
+	require.NoError(t, err)
+	linkEP, err := liveFS.RootEntrypoint()
+	require.NoError(t, err)
+
+	// readDataset returns content of both files
+	readDataset := func(t *testing.T) []string {
+		fs, err := cinodefs.New(ctx, be, cinodefs.RootEntrypoint(linkEP))
+		require.NoError(t, err)
+
+		ret := []string{}
+		for _, name := range []string{"a.txt", "b.txt"} {
+			rc, err := fs.OpenEntryData(ctx, []string{name})
+			require.NoError(t, err)
+			data, err := io.ReadAll(rc)
+			require.NoError(t, err)
+			require.NoError(t, rc.Close())
+			ret = append(ret, string(data))
+		}
+		return ret
+	}
+
+	t.Run("swap between roots", func(t *testing.T) {
+		for _, d := range []struct {
+			root     *cinodefs.Entrypoint
+			expected string
+		}{
+			{blue, "blue"},
+			{green, "green"},
+			{blue, "blue"},
+			{green, "green"},
+		} {
+			err := cinodefs.SwapRoot(ctx, be, wi, d.root)
+			require.NoError(t, err)
+			require.Equal(t, []string{d.expected, d.expected}, readDataset(t))
+		}
+	})
+
+	t.Run("readers see the switch atomically", func(t *testing.T) {
+		wg := sync.WaitGroup{}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 20; i++ {
+				root := blue
+				if i%2 == 0 {
+					root = green
+				}
+				err := cinodefs.SwapRoot(ctx, be, wi, root)
+				require.NoError(t, err)
+			}
+		}()
+
+		// Every read sees either the old or the new root
+		for i := 0; i < 20; i++ {
+			for _, data := range readDataset(t) {
+				require.Contains(t, []string{"blue", "green"}, data)
+			}
+		}
+		wg.Wait()
+	})
+
+	t.Run("invalid parameters", func(t *testing.T) {
+		err := cinodefs.SwapRoot(ctx, nil, wi, blue)
+		require.ErrorIs(t, err, cinodefs.ErrInvalidBE)
+
+		err = cinodefs.SwapRoot(ctx, be, nil, blue)
+		require.ErrorIs(t, err, cinodefs.ErrInvalidWriterInfoData)
+
+		err = cinodefs.SwapRoot(ctx, be, wi, nil)
+		require.ErrorIs(t, err, cinodefs.ErrNilEntrypoint)
+
+		err = cinodefs.SwapRoot(ctx, be, wi, linkEP)
+		require.ErrorIs(t, err, cinodefs.ErrSwapRootSelfReference)
+	})
+
+	t.Run("writer info of a static blob", func(t *testing.T) {
+		staticFS, err := cinodefs.New(ctx, be, cinodefs.RootEntrypoint(blue))
+		require.NoError(t, err)
+		ep, err := staticFS.FindEntry(ctx, []string{"a.txt"})
+		require.NoError(t, err)
+
+		// Construct writer info pointing to a static blob
+		staticWI, err := cinodefs.WriterInfoFromBytes(golang.Must(proto.Marshal(&protobuf.WriterInfo{
+			BlobName: ep.BlobName().Bytes(),
+			Key:      []byte("key"),
+			AuthInfo: []byte("auth"),
+		})))
+		require.NoError(t, err)
+
+		err = cinodefs.SwapRoot(ctx, be, staticWI, green)
+		require.ErrorIs(t, err, cinodefs.ErrSwapRootNotALink)
+	})
+
+	t.Run("unreadable new root", func(t *testing.T) {
+		missing := cinodefs.EntrypointFromBlobNameAndKey(
+			blue.BlobName(),
+			common.BlobKeyFromBytes([]byte("invalid key")),
+		)
+		err := cinodefs.SwapRoot(ctx, be, wi, missing)
+		require.ErrorIs(t, err, cinodefs.ErrSwapRootUnreadableRoot)
+
+		// The link still points to the previous root
+		data := readDataset(t)
+		require.Equal(t, data[0], data[1])
+	})
+
+	t.Run("missing blob in the new root subtree", func(t *testing.T) {
+		red := prepareRoot("red")
+		redFS, err := cinodefs.New(ctx, be, cinodefs.RootEntrypoint(red))
+		require.NoError(t, err)
+		ep, err := redFS.FindEntry(ctx, []string{"b.txt"})
+		require.NoError(t, err)
+		require.NoError(t, be.Delete(ctx, ep.BlobName()))
+
+		err = cinodefs.SwapRoot(ctx, be, wi, red)
+		require.ErrorIs(t, err, cinodefs.ErrSwapRootUnreadableRoot)
+		require.ErrorIs(t, err, datastore.ErrNotFound)
+
+		// The link still points to the previous root
+		data := readDataset(t)
+		require.NotEqual(t, "red", data[0])
+	})
+}
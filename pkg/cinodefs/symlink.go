@@ -0,0 +1,142 @@
+/*
+Copyright © 2023 Bartłomiej Święcki (byo)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cinodefs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/cinode/go/pkg/cinodefs/protobuf"
+)
+
+var (
+	ErrIsASymlink           = errors.New("entry is a symbolic link")
+	ErrNotASymlink          = errors.New("entry is not a symbolic link")
+	ErrInvalidSymlinkTarget = errors.New("invalid symbolic link target")
+)
+
+// SetSymlink creates a symbolic link at given path pointing to the target
+// path. Contrary to dynamic links, symbolic links point to a path within the
+// same filesystem and are resolved each time the path is traversed. The
+// target is always resolved from the root, it does not have to exist when
+// the symbolic link is created.
+//
+// Resolving a symbolic link counts as a single link redirect, too many
+// redirects (including cycles of symbolic links) result in
+// ErrTooManyRedirects. Operations replacing the whole entry (such as SetEntry,
+// Move or another SetSymlink) replace the symbolic link at the end of the
+// path instead of following it.
+func (fs *cinodeFS) SetSymlink(ctx context.Context, path []string, target []string) error {
+	if len(path) == 0 {
+		return fmt.Errorf("%w: can not replace the root", ErrInvalidPath)
+	}
+	target, err := canonicalSymlinkTarget(target)
+	if err != nil {
+		return err
+	}
+
+	whenReached := func(
+		ctx context.Context,
+		current node,
+		isWriteable bool,
+	) (node, dirtyState, error) {
+		if !isWriteable {
+			return nil, 0, ErrMissingWriterInfo
+		}
+		return &nodeSymlink{target: target}, dsDirty, nil
+	}
+
+	return fs.traverseGraph(
+		ctx,
+		path,
+		traverseOptions{
+			createNodes:     true,
+			noFollowSymlink: true,
+		},
+		whenReached,
+	)
+}
+
+// ReadSymlink returns the target path of the symbolic link at given path,
+// symbolic links at the end of the path are not followed
+func (fs *cinodeFS) ReadSymlink(ctx context.Context, path []string) ([]string, error) {
+	path, err := validatePath(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(path) == 0 {
+		return nil, ErrNotASymlink
+	}
+
+	var target []string
+	err = fs.withLock(ctx, func(ctx context.Context) error {
+		n, err := fs.findEntryNodeLocked(ctx, path, false)
+		if err != nil {
+			return err
+		}
+
+		symlink, isSymlink := n.(*nodeSymlink)
+		if !isSymlink {
+			return ErrNotASymlink
+		}
+
+		target = slices.Clone(symlink.target)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return target, nil
+}
+
+func canonicalSymlinkTarget(target []string) ([]string, error) {
+	if len(target) == 0 {
+		return nil, fmt.Errorf("%w: empty path", ErrInvalidSymlinkTarget)
+	}
+
+	target, err := validatePath(target)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidSymlinkTarget, err)
+	}
+
+	return target, nil
+}
+
+func symlinkFromProtobuf(entry *protobuf.Directory_Entry) (node, error) {
+	if entry.Ep != nil {
+		return nil, fmt.Errorf(
+			"%w: symbolic link %s must not have the entrypoint set",
+			ErrInvalidSymlinkTarget, entry.Name,
+		)
+	}
+
+	target, err := canonicalSymlinkTarget(entry.SymlinkTarget)
+	if err != nil {
+		return nil, err
+	}
+	if !slices.Equal(target, entry.SymlinkTarget) {
+		return nil, fmt.Errorf(
+			"%w: symbolic link %s target is not in the canonical form",
+			ErrInvalidSymlinkTarget, entry.Name,
+		)
+	}
+
+	return &nodeSymlink{target: target}, nil
+}
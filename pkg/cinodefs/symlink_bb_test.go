@@ -0,0 +1,356 @@
+/*
+Copyright © 2023 Bartłomiej Święcki (byo)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cinodefs_test
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/cinode/go/pkg/blenc"
+	"github.com/cinode/go/pkg/cinodefs"
+	"github.com/cinode/go/pkg/datastore"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSymlink(t *testing.T) {
+	ctx := context.Background()
+
+	newFS := func(t *testing.T, opts ...cinodefs.Option) (cinodefs.FS, blenc.BE) {
+		be := blenc.FromDatastore(datastore.InMemory())
+		fs, err := cinodefs.New(ctx, be, append(
+			[]cinodefs.Option{cinodefs.NewRootDynamicLink()},
+			opts...,
+		)...)
+		require.NoError(t, err)
+
+		for _, p := range [][]string{
+			{"dir", "file.txt"},
+			{"dir", "sub", "other.txt"},
+		} {
+			_, err = fs.SetEntryFile(ctx, p, strings.NewReader(strings.Join(p, "/")))
+			require.NoError(t, err)
+		}
+		return fs, be
+	}
+
+	t.Run("resolve symbolic links", func(t *testing.T) {
+		fs, _ := newFS(t)
+
+		require.NoError(t, fs.SetSymlink(ctx, []string{"to-file"}, []string{"dir", "file.txt"}))
+		require.NoError(t, fs.SetSymlink(ctx, []string{"to-dir"}, []string{"dir"}))
+		require.NoError(t, fs.SetSymlink(ctx, []string{"dir", "sub", "to-parent"}, []string{"dir"}))
+
+		fileEP, err := fs.FindEntry(ctx, []string{"dir", "file.txt"})
+		require.NoError(t, err)
+
+		ep, err := fs.FindEntry(ctx, []string{"to-file"})
+		require.NoError(t, err)
+		require.Equal(t, fileEP.String(), ep.String())
+
+		ep, err = fs.FindEntry(ctx, []string{"to-dir", "file.txt"})
+		require.NoError(t, err)
+		require.Equal(t, fileEP.String(), ep.String())
+
+		ep, err = fs.FindEntry(ctx, []string{"to-dir", "sub", "to-parent", "sub", "to-parent", "file.txt"})
+		require.NoError(t, err)
+		require.Equal(t, fileEP.String(), ep.String())
+
+		require.Equal(t, "dir/sub/other.txt", readFile(t, fs, []string{"to-dir", "sub", "other.txt"}))
+
+		target, err := fs.ReadSymlink(ctx, []string{"to-dir", "sub", "to-parent"})
+		require.NoError(t, err)
+		require.Equal(t, []string{"dir"}, target)
+
+		entries, err := fs.ListDir(ctx, []string{})
+		require.NoError(t, err)
+		require.Equal(t, []cinodefs.DirEntry{
+			{Name: "dir", IsDir: true, MimeType: cinodefs.CinodeDirMimeType},
+			{Name: "to-dir", IsSymlink: true},
+			{Name: "to-file", IsSymlink: true},
+		}, entries)
+
+		entries, err = fs.ListDir(ctx, []string{"to-dir"})
+		require.NoError(t, err)
+		require.Len(t, entries, 2)
+	})
+
+	t.Run("persist symbolic links", func(t *testing.T) {
+		fs, be := newFS(t, cinodefs.DirSplitThreshold(4))
+
+		// Enough entries to split the directory into shards
+		require.NoError(t, fs.SetSymlink(ctx, []string{"dir", "a-link"}, []string{"dir", "sub"}))
+		require.NoError(t, fs.SetSymlink(ctx, []string{"dir", "b-link"}, []string{"dir", "sub"}))
+		require.NoError(t, fs.SetSymlink(ctx, []string{"dir", "c-link"}, []string{"dir", "sub"}))
+		require.NoError(t, fs.SetSymlink(ctx, []string{"dir", "z-link"}, []string{"dir", "file.txt"}))
+		require.NoError(t, fs.Flush(ctx))
+
+		rootEP, err := fs.RootEntrypoint()
+		require.NoError(t, err)
+
+		fs2, err := cinodefs.New(ctx, be, cinodefs.RootEntrypoint(rootEP))
+		require.NoError(t, err)
+
+		target, err := fs2.ReadSymlink(ctx, []string{"dir", "a-link"})
+		require.NoError(t, err)
+		require.Equal(t, []string{"dir", "sub"}, target)
+
+		require.Equal(t, "dir/sub/other.txt", readFile(t, fs2, []string{"dir", "a-link", "other.txt"}))
+		require.Equal(t, "dir/file.txt", readFile(t, fs2, []string{"dir", "z-link"}))
+
+		blobs, err := cinodefs.BlobsForPath(ctx, fs2, []string{"dir", "a-link", "other.txt"})
+		require.NoError(t, err)
+		directBlobs, err := cinodefs.BlobsForPath(ctx, fs2, []string{"dir", "sub", "other.txt"})
+		require.NoError(t, err)
+		for _, bn := range directBlobs {
+			require.Contains(t, blobs, bn)
+		}
+
+		err = cinodefs.VerifyReachable(ctx, be, rootEP, cinodefs.DefaultMaxLinksRedirects)
+		require.NoError(t, err)
+	})
+
+	t.Run("write through symbolic link", func(t *testing.T) {
+		fs, _ := newFS(t)
+		require.NoError(t, fs.SetSymlink(ctx, []string{"to-dir"}, []string{"dir"}))
+
+		_, err := fs.SetEntryFile(ctx, []string{"to-dir", "new.txt"}, strings.NewReader("new"))
+		require.NoError(t, err)
+		require.Equal(t, "new", readFile(t, fs, []string{"dir", "new.txt"}))
+
+		err = fs.DeleteEntry(ctx, []string{"to-dir", "new.txt"})
+		require.NoError(t, err)
+		_, err = fs.FindEntry(ctx, []string{"dir", "new.txt"})
+		require.ErrorIs(t, err, cinodefs.ErrEntryNotFound)
+
+		_, err = fs.InjectDynamicLink(ctx, []string{"to-dir", "sub"})
+		require.NoError(t, err)
+		entries, err := fs.ListDir(ctx, []string{"dir"})
+		require.NoError(t, err)
+		require.Equal(t, "sub", entries[1].Name)
+		require.True(t, entries[1].IsLink)
+	})
+
+	t.Run("replace and delete symbolic link", func(t *testing.T) {
+		fs, _ := newFS(t)
+		require.NoError(t, fs.SetSymlink(ctx, []string{"link"}, []string{"dir", "file.txt"}))
+
+		require.NoError(t, fs.SetSymlink(ctx, []string{"link"}, []string{"dir", "sub", "other.txt"}))
+		require.Equal(t, "dir/sub/other.txt", readFile(t, fs, []string{"link"}))
+		require.Equal(t, "dir/file.txt", readFile(t, fs, []string{"dir", "file.txt"}))
+
+		_, err := fs.SetEntryFile(ctx, []string{"link"}, strings.NewReader("replaced"))
+		require.NoError(t, err)
+		require.Equal(t, "replaced", readFile(t, fs, []string{"link"}))
+		require.Equal(t, "dir/sub/other.txt", readFile(t, fs, []string{"dir", "sub", "other.txt"}))
+
+		_, err = fs.ReadSymlink(ctx, []string{"link"})
+		require.ErrorIs(t, err, cinodefs.ErrNotASymlink)
+
+		require.NoError(t, fs.SetSymlink(ctx, []string{"link"}, []string{"dir", "file.txt"}))
+		require.NoError(t, fs.DeleteEntry(ctx, []string{"link"}))
+		_, err = fs.FindEntry(ctx, []string{"link"})
+		require.ErrorIs(t, err, cinodefs.ErrEntryNotFound)
+		require.Equal(t, "dir/file.txt", readFile(t, fs, []string{"dir", "file.txt"}))
+	})
+
+	t.Run("copy and move symbolic link", func(t *testing.T) {
+		fs, _ := newFS(t)
+		require.NoError(t, fs.SetSymlink(ctx, []string{"link"}, []string{"dir", "file.txt"}))
+
+		require.NoError(t, fs.Copy(ctx, []string{"link"}, []string{"copy"}))
+		require.NoError(t, fs.Move(ctx, []string{"link"}, []string{"dir", "moved"}))
+
+		for _, p := range [][]string{{"copy"}, {"dir", "moved"}} {
+			target, err := fs.ReadSymlink(ctx, p)
+			require.NoError(t, err)
+			require.Equal(t, []string{"dir", "file.txt"}, target)
+		}
+
+		_, err := fs.FindEntry(ctx, []string{"link"})
+		require.ErrorIs(t, err, cinodefs.ErrEntryNotFound)
+	})
+
+	t.Run("dangling symbolic link", func(t *testing.T) {
+		fs, _ := newFS(t)
+		require.NoError(t, fs.SetSymlink(ctx, []string{"link"}, []string{"missing"}))
+
+		_, err := fs.FindEntry(ctx, []string{"link"})
+		require.ErrorIs(t, err, cinodefs.ErrEntryNotFound)
+
+		_, err = fs.SetEntryFile(ctx, []string{"missing"}, strings.NewReader("found"))
+		require.NoError(t, err)
+		require.Equal(t, "found", readFile(t, fs, []string{"link"}))
+	})
+
+	t.Run("too many redirects", func(t *testing.T) {
+		fs, _ := newFS(t)
+
+		require.NoError(t, fs.SetSymlink(ctx, []string{"self"}, []string{"self"}))
+		require.NoError(t, fs.SetSymlink(ctx, []string{"a"}, []string{"b"}))
+		require.NoError(t, fs.SetSymlink(ctx, []string{"b"}, []string{"a"}))
+		require.NoError(t, fs.SetSymlink(ctx, []string{"loop"}, []string{"loop", "x"}))
+
+		for _, p := range [][]string{{"self"}, {"a"}, {"b", "file.txt"}, {"loop"}} {
+			_, err := fs.FindEntry(ctx, p)
+			require.ErrorIs(t, err, cinodefs.ErrTooManyRedirects)
+		}
+
+		_, err := fs.SetEntryFile(ctx, []string{"a", "file.txt"}, strings.NewReader("data"))
+		require.ErrorIs(t, err, cinodefs.ErrTooManyRedirects)
+
+		require.NoError(t, fs.SetSymlink(ctx, []string{"chain1"}, []string{"dir"}))
+		require.NoError(t, fs.SetSymlink(ctx, []string{"chain2"}, []string{"chain1"}))
+		require.NoError(t, fs.SetSymlink(ctx, []string{"chain3"}, []string{"chain2"}))
+
+		// The root link is followed after each symbolic link, it is part
+		// of the redirects chain
+		require.NoError(t, fs.SetMaxLinkRedirects(3))
+		_, err = fs.FindEntry(ctx, []string{"chain2", "file.txt"})
+		require.NoError(t, err)
+		_, err = fs.FindEntry(ctx, []string{"chain3", "file.txt"})
+		require.ErrorIs(t, err, cinodefs.ErrTooManyRedirects)
+	})
+
+	t.Run("symbolic and dynamic links share the redirects budget", func(t *testing.T) {
+		fs, _ := newFS(t)
+
+		for i := 0; i < 2; i++ {
+			_, err := fs.InjectDynamicLink(ctx, []string{"dir"})
+			require.NoError(t, err)
+		}
+		require.NoError(t, fs.SetSymlink(ctx, []string{"link"}, []string{"dir"}))
+		require.NoError(t, fs.SetMaxLinkRedirects(2))
+
+		_, err := fs.FindEntry(ctx, []string{"dir", "file.txt"})
+		require.NoError(t, err)
+		_, err = fs.FindEntry(ctx, []string{"link", "file.txt"})
+		require.ErrorIs(t, err, cinodefs.ErrTooManyRedirects)
+
+		require.NoError(t, fs.SetMaxLinkRedirects(3))
+		_, err = fs.FindEntry(ctx, []string{"link", "file.txt"})
+		require.NoError(t, err)
+	})
+
+	t.Run("invalid symbolic links", func(t *testing.T) {
+		fs, _ := newFS(t)
+
+		err := fs.SetSymlink(ctx, []string{}, []string{"dir"})
+		require.ErrorIs(t, err, cinodefs.ErrInvalidPath)
+
+		err = fs.SetSymlink(ctx, []string{"link"}, []string{})
+		require.ErrorIs(t, err, cinodefs.ErrInvalidSymlinkTarget)
+
+		err = fs.SetSymlink(ctx, []string{"link"}, []string{"dir", ""})
+		require.ErrorIs(t, err, cinodefs.ErrInvalidSymlinkTarget)
+
+		err = fs.SetSymlink(ctx, []string{"link"}, []string{"dir/file.txt"})
+		require.ErrorIs(t, err, cinodefs.ErrInvalidSymlinkTarget)
+
+		err = fs.SetSymlink(ctx, []string{"dir", ""}, []string{"dir"})
+		require.ErrorIs(t, err, cinodefs.ErrEmptyName)
+
+		_, err = fs.ReadSymlink(ctx, []string{"dir", "file.txt"})
+		require.ErrorIs(t, err, cinodefs.ErrNotASymlink)
+
+		_, err = fs.ReadSymlink(ctx, []string{})
+		require.ErrorIs(t, err, cinodefs.ErrNotASymlink)
+
+		// Target names are kept as they are
+		require.NoError(t, fs.SetSymlink(ctx, []string{"link"}, []string{" dir", "file.txt"}))
+		target, err := fs.ReadSymlink(ctx, []string{"link"})
+		require.NoError(t, err)
+		require.Equal(t, []string{" dir", "file.txt"}, target)
+
+		require.NoError(t, fs.Flush(ctx))
+		err = fs.ForgetWriterInfo(ctx, []string{"link"})
+		require.ErrorIs(t, err, cinodefs.ErrIsASymlink)
+	})
+
+	t.Run("read-only filesystem", func(t *testing.T) {
+		fs, be := newFS(t)
+		require.NoError(t, fs.Flush(ctx))
+		rootEP, err := fs.RootEntrypoint()
+		require.NoError(t, err)
+
+		ro, err := cinodefs.New(ctx, be, cinodefs.RootEntrypoint(rootEP))
+		require.NoError(t, err)
+
+		err = ro.SetSymlink(ctx, []string{"link"}, []string{"dir"})
+		require.ErrorIs(t, err, cinodefs.ErrMissingWriterInfo)
+	})
+
+	t.Run("walk and dump", func(t *testing.T) {
+		fs, _ := newFS(t)
+		require.NoError(t, fs.SetSymlink(ctx, []string{"dir", "sub", "to-parent"}, []string{"dir"}))
+
+		paths := []string{}
+		for entry, err := range fs.WalkStream(ctx, []string{}) {
+			require.NoError(t, err)
+			if entry.IsSymlink {
+				require.Nil(t, entry.Entrypoint)
+			}
+			paths = append(paths, strings.Join(entry.Path, "/"))
+		}
+		require.Equal(t, []string{
+			"dir",
+			"dir/file.txt",
+			"dir/sub",
+			"dir/sub/other.txt",
+			"dir/sub/to-parent",
+		}, paths)
+
+		buf := bytes.NewBuffer(nil)
+		require.NoError(t, cinodefs.DumpTree(fs, buf))
+		require.Contains(t, buf.String(), "to-parent: symlink -> /dir [clean]\n")
+	})
+
+	t.Run("diff trees", func(t *testing.T) {
+		fs, be := newFS(t)
+		require.NoError(t, fs.SetSymlink(ctx, []string{"same"}, []string{"dir"}))
+		require.NoError(t, fs.SetSymlink(ctx, []string{"changed"}, []string{"dir"}))
+		require.NoError(t, fs.SetSymlink(ctx, []string{"removed"}, []string{"dir"}))
+		require.NoError(t, fs.SetSymlink(ctx, []string{"replaced"}, []string{"dir"}))
+		require.NoError(t, fs.Flush(ctx))
+		oldEP, err := fs.FindEntry(ctx, []string{})
+		require.NoError(t, err)
+
+		require.NoError(t, fs.SetSymlink(ctx, []string{"changed"}, []string{"dir", "sub"}))
+		require.NoError(t, fs.DeleteEntry(ctx, []string{"removed"}))
+		_, err = fs.SetEntryFile(ctx, []string{"replaced"}, strings.NewReader("file"))
+		require.NoError(t, err)
+		require.NoError(t, fs.SetSymlink(ctx, []string{"added"}, []string{"dir"}))
+		require.NoError(t, fs.Flush(ctx))
+		newEP, err := fs.FindEntry(ctx, []string{})
+		require.NoError(t, err)
+
+		changes, err := cinodefs.DiffTrees(ctx, be, oldEP, newEP)
+		require.NoError(t, err)
+
+		got := map[string]cinodefs.ChangeType{}
+		for _, c := range changes {
+			got[strings.Join(c.Path, "/")] = c.Type
+		}
+		require.Equal(t, map[string]cinodefs.ChangeType{
+			"added":    cinodefs.PathAdded,
+			"changed":  cinodefs.PathModified,
+			"removed":  cinodefs.PathRemoved,
+			"replaced": cinodefs.PathModified,
+		}, got)
+	})
+}
@@ -0,0 +1,245 @@
+/*
+Copyright © 2023 Bartłomiej Święcki (byo)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cinodefs
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+var (
+	ErrSyncNotSupported = errors.New("subtree sync not supported for given filesystem")
+)
+
+type syncOptions struct {
+	onEntry func(path []string, skipped bool)
+}
+
+type SyncOption func(o *syncOptions)
+
+// SyncOnEntry sets the callback executed for every synchronized file,
+// the path is the one in the destination filesystem
+func SyncOnEntry(f func(path []string, skipped bool)) SyncOption {
+	return func(o *syncOptions) { o.onEntry = f }
+}
+
+// SyncSubtree copies the content of the subtree at srcPath in src into dstPath
+// in dst.
+//
+// Files already present at the same location in the destination with the same
+// entrypoint are skipped. Blobs that already exist in the destination
+// datastore are reused without copying the data. Entries present only
+// in the destination are left untouched. Changes are not flushed.
+//
+// Links in the source are followed and their targets are copied as regular
+// entries. Symbolic links are not followed, those are copied with the same
+// target path. The destination path must be writable.
+func SyncSubtree(
+	ctx context.Context,
+	src FS,
+	srcPath []string,
+	dst FS,
+	dstPath []string,
+	opts ...SyncOption,
+) (copied, skipped int, err error) {
+	srcFS, ok := src.(*cinodeFS)
+	if !ok {
+		return 0, 0, fmt.Errorf("%w: %T", ErrSyncNotSupported, src)
+	}
+	dstFS, ok := dst.(*cinodeFS)
+	if !ok {
+		return 0, 0, fmt.Errorf("%w: %T", ErrSyncNotSupported, dst)
+	}
+
+	s := subtreeSync{src: srcFS, dst: dstFS}
+	for _, o := range opts {
+		o(&s.opts)
+	}
+
+	err = dstFS.ensureWritable(ctx, dstPath)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	err = s.syncEntry(ctx, srcPath, dstPath, true)
+	return s.copied, s.skipped, err
+}
+
+type subtreeSync struct {
+	src     *cinodeFS
+	dst     *cinodeFS
+	opts    syncOptions
+	copied  int
+	skipped int
+}
+
+func (s *subtreeSync) syncEntry(ctx context.Context, srcPath, dstPath []string, isDir bool) error {
+	if isDir {
+		entries, err := s.src.walkDir(ctx, srcPath, listOptionsFrom(nil))
+		switch {
+		case errors.Is(err, ErrNotADirectory):
+			// Link or root pointing to a file
+		case err != nil:
+			return fmt.Errorf("couldn't list directory /%s: %w", strings.Join(srcPath, "/"), err)
+		default:
+			return s.syncDir(ctx, entries, srcPath, dstPath)
+		}
+	}
+
+	return s.syncFile(ctx, srcPath, dstPath)
+}
+
+func (s *subtreeSync) syncDir(ctx context.Context, entries []WalkEntry, srcPath, dstPath []string) error {
+	if len(entries) == 0 {
+		// Ensure empty directories are recreated, don't touch existing ones
+		_, err := s.dst.walkDir(ctx, dstPath, listOptionsFrom(nil))
+		if errors.Is(err, ErrEntryNotFound) {
+			return s.dst.ResetDir(ctx, dstPath)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, e := range entries {
+		if e.IsSymlink {
+			err := s.syncSymlink(
+				ctx,
+				append(append([]string{}, srcPath...), e.Name),
+				append(append([]string{}, dstPath...), e.Name),
+			)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		err := s.syncEntry(
+			ctx,
+			append(append([]string{}, srcPath...), e.Name),
+			append(append([]string{}, dstPath...), e.Name),
+			e.IsDir || e.IsLink,
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *subtreeSync) syncFile(ctx context.Context, srcPath, dstPath []string) error {
+	ep, err := s.src.FindEntry(ctx, srcPath)
+	if err != nil {
+		return fmt.Errorf("couldn't find entry /%s: %w", strings.Join(srcPath, "/"), err)
+	}
+
+	dstEP, err := s.dst.FindEntry(ctx, dstPath)
+	if err == nil && bytes.Equal(dstEP.Bytes(), ep.Bytes()) {
+		s.skipped++
+		s.notify(dstPath, true)
+		return nil
+	}
+
+	exists, err := s.dst.c.be.Exists(ctx, ep.BlobName())
+	if err != nil {
+		return err
+	}
+
+	if !exists {
+		rc, err := s.src.OpenEntrypointData(ctx, ep)
+		if err != nil {
+			return fmt.Errorf("couldn't open file /%s: %w", strings.Join(srcPath, "/"), err)
+		}
+		defer rc.Close()
+
+		// Keep metadata of the source entry, blob name and key will be
+		// set once the data is stored
+		newEP, err := entrypointFromProtobuf(&ep.ep)
+		if err != nil {
+			return err
+		}
+
+		ep, err = s.dst.createFileEntrypoint(ctx, rc, newEP)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = s.dst.SetEntry(ctx, dstPath, ep)
+	if err != nil {
+		return err
+	}
+
+	s.copied++
+	s.notify(dstPath, false)
+	return nil
+}
+
+func (s *subtreeSync) syncSymlink(ctx context.Context, srcPath, dstPath []string) error {
+	target, err := s.src.ReadSymlink(ctx, srcPath)
+	if err != nil {
+		return fmt.Errorf("couldn't read symbolic link /%s: %w", strings.Join(srcPath, "/"), err)
+	}
+
+	dstTarget, err := s.dst.ReadSymlink(ctx, dstPath)
+	if err == nil && slices.Equal(dstTarget, target) {
+		s.skipped++
+		s.notify(dstPath, true)
+		return nil
+	}
+
+	err = s.dst.SetSymlink(ctx, dstPath, target)
+	if err != nil {
+		return err
+	}
+
+	s.copied++
+	s.notify(dstPath, false)
+	return nil
+}
+
+func (s *subtreeSync) notify(path []string, skipped bool) {
+	if s.opts.onEntry != nil {
+		s.opts.onEntry(path, skipped)
+	}
+}
+
+// ensureWritable checks if entry at given path can be modified, if the entry
+// does not exist, the check is done for the closest existing parent
+func (fs *cinodeFS) ensureWritable(ctx context.Context, path []string) error {
+	for i := len(path); i >= 0; i-- {
+		err := fs.traverseGraph(
+			ctx,
+			path[:i],
+			traverseOptions{doNotCache: true},
+			func(_ context.Context, reached node, isWritable bool) (node, dirtyState, error) {
+				if !isWritable {
+					return nil, 0, ErrMissingWriterInfo
+				}
+				return reached, dsClean, nil
+			},
+		)
+		if !errors.Is(err, ErrEntryNotFound) {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,172 @@
+/*
+Copyright © 2023 Bartłomiej Święcki (byo)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cinodefs_test
+
+import (
+	"context"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/cinode/go/pkg/blenc"
+	"github.com/cinode/go/pkg/cinodefs"
+	"github.com/cinode/go/pkg/common"
+	"github.com/cinode/go/pkg/datastore"
+	"github.com/stretchr/testify/require"
+)
+
+type openCountingBE struct {
+	blenc.BE
+	m      sync.Mutex
+	opened map[string]int
+}
+
+func (be *openCountingBE) Open(ctx context.Context, name *common.BlobName, key *common.BlobKey) (io.ReadCloser, error) {
+	be.m.Lock()
+	be.opened[name.String()]++
+	be.m.Unlock()
+	return be.BE.Open(ctx, name, key)
+}
+
+func TestSyncSubtree(t *testing.T) {
+	ctx := context.Background()
+
+	srcBE := &openCountingBE{
+		BE:     blenc.FromDatastore(datastore.InMemory()),
+		opened: map[string]int{},
+	}
+	src, err := cinodefs.New(ctx, srcBE, cinodefs.NewRootStaticDirectory())
+	require.NoError(t, err)
+
+	setFile := func(fs cinodefs.FS, path, content string) *cinodefs.Entrypoint {
+		ep, err := fs.SetEntryFile(ctx, strings.Split(path, "/"), strings.NewReader(content))
+		require.NoError(t, err)
+		return ep
+	}
+
+	readFile := func(fs cinodefs.FS, path string) string {
+		rc, err := fs.OpenEntryData(ctx, strings.Split(path, "/"))
+		require.NoError(t, err)
+		defer rc.Close()
+		data, err := io.ReadAll(rc)
+		require.NoError(t, err)
+		return string(data)
+	}
+
+	setFile(src, "site/a.txt", "file a")
+	bEP := setFile(src, "site/sub/b.txt", "file b")
+	setFile(src, "other/x.txt", "not synced")
+	require.NoError(t, src.ResetDir(ctx, []string{"site", "empty"}))
+	require.NoError(t, src.Flush(ctx))
+
+	dstBE := blenc.FromDatastore(datastore.InMemory())
+	dst, err := cinodefs.New(ctx, dstBE, cinodefs.NewRootDynamicLink())
+	require.NoError(t, err)
+	setFile(dst, "keep.txt", "keep me")
+	// Same content as the one in the source, the blob will be reused
+	setFile(dst, "copy-of-b.txt", "file b")
+
+	t.Run("initial sync", func(t *testing.T) {
+		synced := []string{}
+		copied, skipped, err := cinodefs.SyncSubtree(
+			ctx,
+			src, []string{"site"},
+			dst, []string{"mirror"},
+			cinodefs.SyncOnEntry(func(path []string, skipped bool) {
+				require.False(t, skipped)
+				synced = append(synced, strings.Join(path, "/"))
+			}),
+		)
+		require.NoError(t, err)
+		require.Equal(t, 2, copied)
+		require.Equal(t, 0, skipped)
+		require.Equal(t, []string{"mirror/a.txt", "mirror/sub/b.txt"}, synced)
+
+		// Existing blob was reused without reading the source
+		require.Zero(t, srcBE.opened[bEP.BlobName().String()])
+
+		require.NoError(t, dst.Flush(ctx))
+
+		require.Equal(t, "file a", readFile(dst, "mirror/a.txt"))
+		require.Equal(t, "file b", readFile(dst, "mirror/sub/b.txt"))
+		require.Equal(t, "keep me", readFile(dst, "keep.txt"))
+
+		entries := 0
+		err = dst.Walk(ctx, []string{"mirror", "empty"}, func(cinodefs.WalkEntry) error {
+			entries++
+			return nil
+		})
+		require.NoError(t, err)
+		require.Zero(t, entries)
+
+		_, err = dst.FindEntry(ctx, []string{"mirror", "other"})
+		require.ErrorIs(t, err, cinodefs.ErrEntryNotFound)
+	})
+
+	t.Run("unchanged files are skipped", func(t *testing.T) {
+		copied, skipped, err := cinodefs.SyncSubtree(ctx, src, []string{"site"}, dst, []string{"mirror"})
+		require.NoError(t, err)
+		require.Equal(t, 0, copied)
+		require.Equal(t, 2, skipped)
+	})
+
+	t.Run("changed files are copied", func(t *testing.T) {
+		setFile(src, "site/a.txt", "file a - updated")
+
+		copied, skipped, err := cinodefs.SyncSubtree(ctx, src, []string{"site"}, dst, []string{"mirror"})
+		require.NoError(t, err)
+		require.Equal(t, 1, copied)
+		require.Equal(t, 1, skipped)
+		require.Equal(t, "file a - updated", readFile(dst, "mirror/a.txt"))
+	})
+
+	t.Run("sync a single file", func(t *testing.T) {
+		copied, skipped, err := cinodefs.SyncSubtree(ctx, src, []string{"other", "x.txt"}, dst, []string{"x.txt"})
+		require.NoError(t, err)
+		require.Equal(t, 1, copied)
+		require.Equal(t, 0, skipped)
+		require.Equal(t, "not synced", readFile(dst, "x.txt"))
+	})
+
+	t.Run("destination without writer info", func(t *testing.T) {
+		require.NoError(t, dst.Flush(ctx))
+		ep, err := dst.RootEntrypoint()
+		require.NoError(t, err)
+
+		readOnly, err := cinodefs.New(ctx, dstBE, cinodefs.RootEntrypoint(ep))
+		require.NoError(t, err)
+
+		_, _, err = cinodefs.SyncSubtree(ctx, src, []string{"site"}, readOnly, []string{"new", "path"})
+		require.ErrorIs(t, err, cinodefs.ErrMissingWriterInfo)
+	})
+
+	t.Run("missing source path", func(t *testing.T) {
+		_, _, err := cinodefs.SyncSubtree(ctx, src, []string{"missing"}, dst, []string{"mirror"})
+		require.ErrorIs(t, err, cinodefs.ErrEntryNotFound)
+	})
+
+	t.Run("unsupported source", func(t *testing.T) {
+		_, _, err := cinodefs.SyncSubtree(ctx, nil, []string{"site"}, dst, []string{"mirror"})
+		require.ErrorIs(t, err, cinodefs.ErrSyncNotSupported)
+	})
+
+	t.Run("unsupported destination", func(t *testing.T) {
+		_, _, err := cinodefs.SyncSubtree(ctx, src, []string{"site"}, nil, []string{"mirror"})
+		require.ErrorIs(t, err, cinodefs.ErrSyncNotSupported)
+	})
+}
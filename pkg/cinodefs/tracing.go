@@ -0,0 +1,159 @@
+/*
+Copyright © 2023 Bartłomiej Święcki (byo)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cinodefs
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// Names of spans created by the filesystem
+const (
+	// SpanTraverse covers a single traversal of the directory graph,
+	// started by most filesystem operations
+	SpanTraverse = "cinodefs.traverse"
+
+	// SpanLoad covers loading a single node of the graph - a link or
+	// a directory, loading files does not read any data and is not traced
+	SpanLoad = "cinodefs.load"
+
+	// SpanOpenBlob covers opening a blob through the blenc layer
+	SpanOpenBlob = "cinodefs.open_blob"
+
+	// SpanFlush covers writing all pending changes to the datastore
+	SpanFlush = "cinodefs.flush"
+)
+
+// Attributes recorded on spans created by the filesystem
+const (
+	AttrPath         = "cinodefs.path"
+	AttrPathSegment  = "cinodefs.path_segment"
+	AttrBlobName     = "cinodefs.blob_name"
+	AttrEntryType    = "cinodefs.entry_type"
+	AttrLinkDepth    = "cinodefs.link_depth" // consecutive link redirects
+	AttrLinkCacheHit = "cinodefs.link_cache_hit"
+)
+
+// Tracer creates spans describing operations done by the filesystem, it can
+// be adapted to an OpenTelemetry tracer. Implementations must be safe for
+// concurrent use.
+type Tracer interface {
+	// Start creates a new span that is a child of the span found in given
+	// context, returned context contains the new span
+	Start(ctx context.Context, name string) (context.Context, Span)
+}
+
+// Span is a single operation reported to the Tracer
+type Span interface {
+	SetAttribute(key string, value any)
+	SetError(err error)
+	End()
+}
+
+type noopSpan struct{}
+
+func (noopSpan) SetAttribute(key string, value any) {}
+func (noopSpan) SetError(err error)                 {}
+func (noopSpan) End()                               {}
+
+// startSpan starts a new span if tracing is enabled
+func (c *graphContext) startSpan(ctx context.Context, name string) (context.Context, Span) {
+	if c.tracer == nil {
+		return ctx, noopSpan{}
+	}
+	return c.tracer.Start(ctx, name)
+}
+
+type stepSpan struct {
+	ctx  context.Context
+	span Span
+	done bool
+}
+
+// startStepSpan starts a span of a step of an operation run through withLock.
+//
+// The attempt waiting for blob data does not end the span, it is continued
+// by the restarted attempt reaching the same occurrence of the step with
+// the same key. Steps already finished by previous attempts are not reported
+// again while the same step done again within a single attempt gets its own
+// span. That way each step is reported once and blob operations done between
+// attempts are its children. Returned function ends the span once the step
+// is done.
+//
+// The key is only built if tracing is enabled.
+func (c *graphContext) startStepSpan(
+	ctx context.Context,
+	name string,
+	key func() string,
+) (
+	context.Context,
+	Span,
+	func(err error),
+) {
+	bio := blobIOFromContext(ctx)
+	if c.tracer == nil || bio == nil {
+		ctx, span := c.startSpan(ctx, name)
+		return ctx, span, func(err error) { endSpan(span, err) }
+	}
+
+	stepKey := key()
+	occurrence := bio.stepCounts[stepKey]
+	bio.stepCounts[stepKey] = occurrence + 1
+	stepKey += "#" + strconv.Itoa(occurrence)
+
+	s, found := bio.spans[stepKey]
+	if found && s.done {
+		return ctx, noopSpan{}, func(err error) {}
+	}
+	if !found {
+		s.ctx, s.span = c.tracer.Start(ctx, name)
+		bio.spans[stepKey] = s
+	}
+
+	return s.ctx, s.span, func(err error) {
+		if errors.Is(err, errBlobIOPending) {
+			return
+		}
+		bio.spans[stepKey] = stepSpan{done: true}
+		endSpan(s.span, err)
+	}
+}
+
+// endSpan records the error, if any, and ends the span
+func endSpan(span Span, err error) {
+	if err != nil {
+		span.SetError(err)
+	}
+	span.End()
+}
+
+func tracePath(path []string) string {
+	return "/" + strings.Join(path, "/")
+}
+
+func entryType(ep *Entrypoint) string {
+	switch {
+	case ep.IsLink():
+		return "link"
+	case ep.IsDir():
+		return "dir"
+	default:
+		return "file"
+	}
+}
@@ -0,0 +1,221 @@
+/*
+Copyright © 2023 Bartłomiej Święcki (byo)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cinodefs_test
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cinode/go/pkg/blenc"
+	"github.com/cinode/go/pkg/cinodefs"
+	"github.com/cinode/go/pkg/datastore"
+	"github.com/stretchr/testify/require"
+)
+
+type recordedSpan struct {
+	name   string
+	parent *recordedSpan
+	attrs  map[string]any
+	err    error
+	ended  bool
+}
+
+func (s *recordedSpan) SetAttribute(key string, value any) { s.attrs[key] = value }
+func (s *recordedSpan) SetError(err error)                 { s.err = err }
+func (s *recordedSpan) End()                               { s.ended = true }
+
+type recordingTracer struct {
+	mutex sync.Mutex
+	spans []*recordedSpan
+}
+
+type recordedSpanKey struct{}
+
+func (r *recordingTracer) Start(ctx context.Context, name string) (context.Context, cinodefs.Span) {
+	parent, _ := ctx.Value(recordedSpanKey{}).(*recordedSpan)
+	span := &recordedSpan{name: name, parent: parent, attrs: map[string]any{}}
+
+	r.mutex.Lock()
+	r.spans = append(r.spans, span)
+	r.mutex.Unlock()
+
+	return context.WithValue(ctx, recordedSpanKey{}, span), span
+}
+
+func (r *recordingTracer) reset() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.spans = nil
+}
+
+func (r *recordingTracer) named(name string) []*recordedSpan {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	ret := []*recordedSpan{}
+	for _, s := range r.spans {
+		if s.name == name {
+			ret = append(ret, s)
+		}
+	}
+	return ret
+}
+
+func TestTracing(t *testing.T) {
+	ctx := context.Background()
+	path := []string{"dir", "sub", "file.txt"}
+
+	t.Run("nil tracer", func(t *testing.T) {
+		fs, err := cinodefs.New(ctx,
+			blenc.FromDatastore(datastore.InMemory()),
+			cinodefs.NewRootStaticDirectory(),
+			cinodefs.Tracing(nil),
+		)
+		require.ErrorIs(t, err, cinodefs.ErrInvalidNilTracer)
+		require.Nil(t, fs)
+	})
+
+	ds := datastore.InMemory()
+	writer := prepareLinkedDataset(t, ds, path)
+	rootEP, err := writer.RootEntrypoint()
+	require.NoError(t, err)
+
+	tracer := &recordingTracer{}
+	fs, err := cinodefs.New(ctx,
+		blenc.FromDatastore(ds),
+		cinodefs.RootEntrypoint(rootEP),
+		cinodefs.LinkCache(10, time.Minute),
+		cinodefs.Tracing(tracer),
+	)
+	require.NoError(t, err)
+
+	t.Run("find entry", func(t *testing.T) {
+		tracer.reset()
+		_, err := fs.FindEntry(ctx, path)
+		require.NoError(t, err)
+
+		traverse := tracer.named(cinodefs.SpanTraverse)
+		require.Len(t, traverse, 1)
+		require.Equal(t, "/dir/sub/file.txt", traverse[0].attrs[cinodefs.AttrPath])
+		require.True(t, traverse[0].ended)
+		require.NoError(t, traverse[0].err)
+
+		// root link, root dir, dir link, dir, sub dir
+		loads := tracer.named(cinodefs.SpanLoad)
+		require.Len(t, loads, 5)
+
+		links := 0
+		for _, l := range loads {
+			require.Same(t, traverse[0], l.parent)
+			require.True(t, l.ended)
+			require.NotEmpty(t, l.attrs[cinodefs.AttrBlobName])
+			if l.attrs[cinodefs.AttrEntryType] == "link" {
+				links++
+				require.Equal(t, false, l.attrs[cinodefs.AttrLinkCacheHit])
+			}
+		}
+		require.Equal(t, 2, links)
+		require.Equal(t, "/", loads[0].attrs[cinodefs.AttrPathSegment])
+		require.Equal(t, "dir", loads[3].attrs[cinodefs.AttrPathSegment])
+		require.Equal(t, 1, loads[3].attrs[cinodefs.AttrLinkDepth])
+		require.Equal(t, "sub", loads[4].attrs[cinodefs.AttrPathSegment])
+		require.Equal(t, 0, loads[4].attrs[cinodefs.AttrLinkDepth])
+
+		opens := tracer.named(cinodefs.SpanOpenBlob)
+		require.Len(t, opens, 5)
+		for _, o := range opens {
+			require.Equal(t, cinodefs.SpanLoad, o.parent.name)
+			require.Equal(t, o.parent.attrs[cinodefs.AttrBlobName], o.attrs[cinodefs.AttrBlobName])
+		}
+	})
+
+	t.Run("link cache hits", func(t *testing.T) {
+		// Flush unloads the in-memory tree, links are resolved again
+		require.NoError(t, fs.Flush(ctx))
+
+		tracer.reset()
+		_, err = fs.FindEntry(ctx, path)
+		require.NoError(t, err)
+
+		links := 0
+		for _, l := range tracer.named(cinodefs.SpanLoad) {
+			if l.attrs[cinodefs.AttrEntryType] == "link" {
+				links++
+				require.Equal(t, true, l.attrs[cinodefs.AttrLinkCacheHit])
+			}
+		}
+		require.Equal(t, 2, links)
+
+		// Only directories are read
+		require.Len(t, tracer.named(cinodefs.SpanOpenBlob), 3)
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		tracer.reset()
+		_, err := fs.FindEntry(ctx, []string{"missing"})
+		require.ErrorIs(t, err, cinodefs.ErrEntryNotFound)
+
+		traverse := tracer.named(cinodefs.SpanTraverse)
+		require.Len(t, traverse, 1)
+		require.ErrorIs(t, traverse[0].err, cinodefs.ErrEntryNotFound)
+	})
+
+	t.Run("same path traversed twice in one operation", func(t *testing.T) {
+		fs, err := cinodefs.New(ctx,
+			blenc.FromDatastore(datastore.InMemory()),
+			cinodefs.NewRootStaticDirectory(),
+			cinodefs.Tracing(tracer),
+		)
+		require.NoError(t, err)
+
+		tracer.reset()
+		err = fs.Batch(ctx, func(b cinodefs.BatchFS) error {
+			ep, err := fs.CreateFileEntrypoint(ctx, strings.NewReader("data"), cinodefs.SetMimeType("text/plain"))
+			if err != nil {
+				return err
+			}
+			for i := 0; i < 2; i++ {
+				err = b.SetEntry(ctx, []string{"file.txt"}, ep)
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		require.NoError(t, err)
+
+		traverse := tracer.named(cinodefs.SpanTraverse)
+		require.Len(t, traverse, 2)
+		for _, s := range traverse {
+			require.Equal(t, "/file.txt", s.attrs[cinodefs.AttrPath])
+			require.True(t, s.ended)
+		}
+	})
+
+	t.Run("flush", func(t *testing.T) {
+		tracer.reset()
+		require.NoError(t, fs.Flush(ctx))
+
+		flush := tracer.named(cinodefs.SpanFlush)
+		require.Len(t, flush, 1)
+		require.True(t, flush[0].ended)
+		require.NoError(t, flush[0].err)
+	})
+}
@@ -0,0 +1,111 @@
+/*
+Copyright © 2022 Bartłomiej Święcki (byo)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package uploader
+
+import (
+	"context"
+	"sync"
+)
+
+// Concurrency sets the maximum number of files uploaded in parallel, files
+// are uploaded one by one by default.
+//
+// The content of the uploaded tree does not depend on the concurrency,
+// only the order in which files are stored does. The first error stops the
+// upload, files already being uploaded are cancelled through the context.
+func Concurrency(n int) Option {
+	return Option(func(d *dirCompiler) {
+		d.concurrency = n
+	})
+}
+
+func (d *dirCompiler) compileParallel(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	d.workers = &uploadWorkers{
+		slots:  make(chan struct{}, d.concurrency),
+		cancel: cancel,
+	}
+
+	_, err := d.compilePath(ctx, ".", d.basePath)
+	if err != nil {
+		d.workers.fail(err)
+	}
+
+	// Even if failed, all started uploads must be finished before returning
+	return d.workers.wait()
+}
+
+// uploadWorkers runs uploads in background goroutines with a limited number
+// of uploads running at the same time
+type uploadWorkers struct {
+	slots  chan struct{}
+	wg     sync.WaitGroup
+	cancel context.CancelFunc
+
+	errMutex sync.Mutex
+	err      error
+}
+
+// start runs the upload in the background once there's a free slot, the
+// returned error is set if the upload could not be started
+func (w *uploadWorkers) start(ctx context.Context, upload func(ctx context.Context) error) error {
+	if err := ctx.Err(); err != nil {
+		// Don't start new uploads if there's a free slot but the upload
+		// has already failed
+		return err
+	}
+
+	select {
+	case w.slots <- struct{}{}:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+		defer func() { <-w.slots }()
+
+		err := upload(ctx)
+		if err != nil {
+			w.fail(err)
+		}
+	}()
+	return nil
+}
+
+// fail stores the first error and cancels remaining uploads
+func (w *uploadWorkers) fail(err error) {
+	w.errMutex.Lock()
+	defer w.errMutex.Unlock()
+
+	if w.err == nil {
+		w.err = err
+		w.cancel()
+	}
+}
+
+// wait waits for all started uploads to finish and returns the first error
+func (w *uploadWorkers) wait() error {
+	w.wg.Wait()
+
+	w.errMutex.Lock()
+	defer w.errMutex.Unlock()
+	return w.err
+}
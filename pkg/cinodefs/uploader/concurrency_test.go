@@ -0,0 +1,145 @@
+/*
+Copyright © 2022 Bartłomiej Święcki (byo)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package uploader_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"sync"
+	"sync/atomic"
+	"testing/fstest"
+
+	"github.com/cinode/go/pkg/blenc"
+	"github.com/cinode/go/pkg/cinodefs"
+	"github.com/cinode/go/pkg/cinodefs/uploader"
+	"github.com/cinode/go/pkg/datastore"
+	"github.com/stretchr/testify/require"
+)
+
+func generatedFS() fstest.MapFS {
+	fsys := fstest.MapFS{}
+	for i := 0; i < 5; i++ {
+		for j := 0; j < 10; j++ {
+			fsys[fmt.Sprintf("dir%d/file%d.txt", i, j)] = &fstest.MapFile{
+				Data: []byte(fmt.Sprintf("content of file %d in dir %d", j, i)),
+			}
+		}
+	}
+	fsys["dir1/sub/file.txt"] = &fstest.MapFile{Data: []byte("nested")}
+	fsys["empty"] = &fstest.MapFile{Mode: fs.ModeDir}
+	return fsys
+}
+
+func (s *DirectoryTestSuite) TestConcurrency() {
+	t := s.T()
+	ctx := context.Background()
+
+	rootForConcurrency := func(n int) string {
+		cfs, err := cinodefs.New(ctx,
+			blenc.FromDatastore(datastore.InMemory()),
+			cinodefs.NewRootStaticDirectory(),
+		)
+		require.NoError(t, err)
+
+		err = uploader.UploadStaticDirectory(ctx, generatedFS(), cfs,
+			uploader.Concurrency(n),
+			uploader.CreateIndexFile("index.html"),
+		)
+		require.NoError(t, err)
+		require.NoError(t, cfs.Flush(ctx))
+
+		ep, err := cfs.RootEntrypoint()
+		require.NoError(t, err)
+		return ep.String()
+	}
+
+	// Resulting tree does not depend on the concurrency
+	expected := rootForConcurrency(1)
+	for _, n := range []int{0, 2, 8, 100} {
+		require.Equal(t, expected, rootForConcurrency(n), "concurrency %d", n)
+	}
+}
+
+func (s *DirectoryTestSuite) TestConcurrencyLimit() {
+	t := s.T()
+
+	mutex := sync.Mutex{}
+	running, maxRunning := 0, 0
+	testFS := &wrapFS{FS: generatedFS()}
+	testFS.openFunc = func(path string) (fs.File, error) {
+		fl, err := testFS.FS.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		st, err := fl.Stat()
+		if err != nil || st.IsDir() {
+			return fl, err
+		}
+
+		mutex.Lock()
+		defer mutex.Unlock()
+		running++
+		maxRunning = max(maxRunning, running)
+		return &closeNotifyFile{File: fl, onClose: func() {
+			mutex.Lock()
+			defer mutex.Unlock()
+			running--
+		}}, nil
+	}
+
+	s.uploadFS(t, testFS, uploader.Concurrency(3))
+	require.LessOrEqual(t, maxRunning, 3)
+
+	readBack, err := s.readContent(t, "dir4", "file9.txt")
+	require.NoError(t, err)
+	require.Equal(t, "content of file 9 in dir 4", readBack)
+}
+
+type closeNotifyFile struct {
+	fs.File
+	onClose func()
+}
+
+func (c *closeNotifyFile) Close() error {
+	c.onClose()
+	return c.File.Close()
+}
+
+func (s *DirectoryTestSuite) TestConcurrencyFailure() {
+	t := s.T()
+
+	injectErr := errors.New("injected open error")
+	opened := atomic.Int32{}
+	testFS := &wrapFS{FS: generatedFS()}
+	testFS.openFunc = func(path string) (fs.File, error) {
+		if path == "dir0/file3.txt" {
+			return nil, injectErr
+		}
+		opened.Add(1)
+		return testFS.FS.Open(path)
+	}
+
+	err := uploader.UploadStaticDirectory(context.Background(), testFS, s.cfs,
+		uploader.Concurrency(4),
+	)
+	require.ErrorIs(t, err, injectErr)
+
+	// Remaining work is cancelled
+	require.Less(t, int(opened.Load()), len(generatedFS()))
+}
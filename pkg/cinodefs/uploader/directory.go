@@ -22,14 +22,18 @@ import (
 	"errors"
 	"fmt"
 	"html/template"
+	"io"
 	"io/fs"
 	"path"
+	"sync"
 
 	_ "embed"
 
 	"github.com/cinode/go/pkg/blenc"
+	"github.com/cinode/go/pkg/blobtypes"
 	"github.com/cinode/go/pkg/cinodefs"
 	"github.com/cinode/go/pkg/utilities/golang"
+	"github.com/cinode/go/pkg/utilities/progress"
 	"golang.org/x/exp/slog"
 )
 
@@ -60,6 +64,12 @@ func UploadStaticDirectory(
 		opt(&c)
 	}
 
+	c.startProgress()
+
+	if c.concurrency > 1 {
+		return c.compileParallel(ctx)
+	}
+
 	_, err := c.compilePath(ctx, ".", c.basePath)
 	if err != nil {
 		return err
@@ -83,6 +93,28 @@ func CreateIndexFile(indexFile string) Option {
 	})
 }
 
+// Incremental skips uploading files if the destination path already contains
+// a file with the same content, the existing entry is kept in such case.
+//
+// The content is compared by computing the name of the blob that would be
+// created from the source file. This requires reading the file twice thus
+// only files implementing io.ReaderAt can be skipped, other ones are always
+// uploaded.
+func Incremental() Option {
+	return Option(func(d *dirCompiler) {
+		d.incremental = true
+	})
+}
+
+// RecordModTime stores the modification time of the source file in the
+// entry. By default files are stored without modification times so that
+// the uploaded content only depends on names and data of files.
+func RecordModTime() Option {
+	return Option(func(d *dirCompiler) {
+		d.recordModTime = true
+	})
+}
+
 type dirCompiler struct {
 	ctx             context.Context
 	fsys            fs.FS
@@ -91,6 +123,18 @@ type dirCompiler struct {
 	basePath        []string
 	createIndexFile bool
 	indexFileName   string
+	incremental     bool
+	recordModTime   bool
+
+	concurrency int
+	workers     *uploadWorkers
+
+	progress      func(ev ProgressEvent)
+	bytesProgress progress.Callback
+	progressMutex sync.Mutex
+	totalFiles    int
+	uploadedFiles int
+	uploadedBytes *progress.Counter
 }
 
 type dirEntry struct {
@@ -130,16 +174,30 @@ func (d *dirCompiler) compilePath(
 	}
 
 	if st.Mode().IsRegular() {
+		entry := &dirEntry{
+			Name:  name,
+			IsDir: false,
+			Size:  st.Size(),
+		}
+		if d.workers != nil {
+			// Mime type is filled in once the upload finishes
+			err := d.workers.start(ctx, func(ctx context.Context) error {
+				mime, err := d.compileFile(ctx, srcPath, destPath)
+				entry.MimeType = mime
+				return err
+			})
+			if err != nil {
+				return nil, err
+			}
+			return entry, nil
+		}
+
 		mime, err := d.compileFile(ctx, srcPath, destPath)
 		if err != nil {
 			return nil, err
 		}
-		return &dirEntry{
-			Name:     name,
-			MimeType: mime,
-			IsDir:    false,
-			Size:     st.Size(),
-		}, nil
+		entry.MimeType = mime
+		return entry, nil
 	}
 
 	d.log.ErrorContext(ctx, "path is neither dir nor a regular file", "path", srcPath)
@@ -155,14 +213,70 @@ func (d *dirCompiler) compileFile(ctx context.Context, srcPath string, dstPath [
 	}
 	defer fl.Close()
 
-	ep, err := d.cfs.SetEntryFile(ctx, dstPath, fl)
+	if d.incremental {
+		ep, unchanged := d.unchangedEntry(ctx, fl, dstPath)
+		if unchanged {
+			d.log.InfoContext(ctx, "skipping unchanged file", "path", srcPath)
+			d.reportProgress(srcPath, ep.ContentLength(), true)
+			return ep.MimeType(), nil
+		}
+	}
+
+	var opts []cinodefs.EntrypointOption
+	if d.recordModTime {
+		st, err := fl.Stat()
+		if err != nil {
+			d.log.ErrorContext(ctx, "failed to stat file", "path", srcPath, "err", err)
+			return "", fmt.Errorf("couldn't stat file %v: %w", srcPath, err)
+		}
+		opts = append(opts, cinodefs.SetModTime(st.ModTime()))
+	}
+
+	ep, err := d.cfs.SetEntryFile(ctx, dstPath, d.uploadReader(fl), opts...)
 	if err != nil {
 		return "", fmt.Errorf("failed to upload file %v: %w", srcPath, err)
 	}
 
+	d.reportProgress(srcPath, ep.ContentLength(), false)
 	return ep.MimeType(), nil
 }
 
+// unchangedEntry returns the entry at the destination path if it is a file
+// with the same content as the source one
+func (d *dirCompiler) unchangedEntry(
+	ctx context.Context,
+	fl fs.File,
+	dstPath []string,
+) (*cinodefs.Entrypoint, bool) {
+	ra, ok := fl.(io.ReaderAt)
+	if !ok {
+		return nil, false
+	}
+
+	ep, err := d.cfs.FindEntry(ctx, dstPath)
+	if err != nil || ep.IsDir() || ep.IsLink() || ep.BlobName().Type() != blobtypes.Static {
+		// Errors are reported by the upload if there's a real problem
+		return nil, false
+	}
+
+	st, err := fl.Stat()
+	if err != nil {
+		return nil, false
+	}
+	if ep.ContentLength() != 0 && ep.ContentLength() != st.Size() {
+		return nil, false
+	}
+
+	// The existing blob may be encrypted or compressed differently than blobs
+	// created with default options, its key tells how it was created
+	name, _, err := blenc.StaticBlobNameForKey(ep.BlobKey(), ra, st.Size())
+	if err != nil || !name.Equal(ep.BlobName()) {
+		return nil, false
+	}
+
+	return ep, true
+}
+
 func (d *dirCompiler) compileDir(ctx context.Context, srcPath string, dstPath []string) (int, error) {
 	fileList, err := fs.ReadDir(d.fsys, srcPath)
 	if err != nil {
@@ -177,7 +291,9 @@ func (d *dirCompiler) compileDir(ctx context.Context, srcPath string, dstPath []
 		entry, err := d.compilePath(
 			ctx,
 			path.Join(srcPath, e.Name()),
-			append(dstPath, e.Name()),
+			// The path may be used by a background upload, it must not be
+			// overwritten by paths of subsequent entries
+			append(dstPath[:len(dstPath):len(dstPath)], e.Name()),
 		)
 		if err != nil {
 			return 0, err
@@ -191,6 +307,14 @@ func (d *dirCompiler) compileDir(ctx context.Context, srcPath string, dstPath []
 	}
 
 	if d.createIndexFile && !hasIndex {
+		if d.workers != nil {
+			// Mime types of entries are only known once uploaded
+			err = d.workers.wait()
+			if err != nil {
+				return 0, err
+			}
+		}
+
 		buf := bytes.NewBuffer(nil)
 		err = dirIndexTemplate.Execute(buf, map[string]any{
 			"entries":   entries,
@@ -205,11 +329,32 @@ func (d *dirCompiler) compileDir(ctx context.Context, srcPath string, dstPath []
 		if err != nil {
 			return 0, err
 		}
+	} else if len(fileList) == 0 {
+		err = d.ensureDir(ctx, dstPath)
+		if err != nil {
+			return 0, err
+		}
 	}
 
 	return len(fileList), nil
 }
 
+// ensureDir creates an empty directory unless there's already an entry
+// at given path, directories are otherwise only created along with their
+// entries
+func (d *dirCompiler) ensureDir(ctx context.Context, dstPath []string) error {
+	_, err := d.cfs.ListDir(ctx, dstPath)
+	if !errors.Is(err, cinodefs.ErrEntryNotFound) {
+		return err
+	}
+
+	err = d.cfs.ResetDir(ctx, dstPath)
+	if err != nil {
+		return fmt.Errorf("failed to create directory %v: %w", path.Join(dstPath...), err)
+	}
+	return nil
+}
+
 //go:embed templates/dir.html
 var _dirIndexTemplateStr string
 var dirIndexTemplate = golang.Must(
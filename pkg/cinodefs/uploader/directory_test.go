@@ -24,6 +24,7 @@ import (
 	"strings"
 	"testing"
 	"testing/fstest"
+	"time"
 
 	"github.com/cinode/go/pkg/blenc"
 	"github.com/cinode/go/pkg/cinodefs"
@@ -116,6 +117,40 @@ func (s *DirectoryTestSuite) TestSingleFileUploadDefaultOptions() {
 	require.Equal(s.T(), "hello", readBack)
 }
 
+func (s *DirectoryTestSuite) TestModTime() {
+	t := s.T()
+	ctx := context.Background()
+	modTime := time.Date(2023, 5, 6, 7, 8, 9, 0, time.UTC)
+	fsys := fstest.MapFS{
+		"file.txt": &fstest.MapFile{Data: []byte("hello"), ModTime: modTime},
+	}
+
+	s.uploadFS(t, fsys)
+	ep, err := s.cfs.FindEntry(ctx, []string{"file.txt"})
+	require.NoError(t, err)
+	require.True(t, ep.ModTime().IsZero())
+
+	s.uploadFS(t, fsys, uploader.RecordModTime())
+	ep, err = s.cfs.FindEntry(ctx, []string{"file.txt"})
+	require.NoError(t, err)
+	require.True(t, modTime.Equal(ep.ModTime()))
+}
+
+func (s *DirectoryTestSuite) TestWhitespaceInNames() {
+	s.uploadFS(s.T(), fstest.MapFS{
+		"a":  &fstest.MapFile{Data: []byte("first")},
+		"a ": &fstest.MapFile{Data: []byte("second")},
+	})
+
+	readBack, err := s.readContent(s.T(), "a")
+	require.NoError(s.T(), err)
+	require.Equal(s.T(), "first", readBack)
+
+	readBack, err = s.readContent(s.T(), "a ")
+	require.NoError(s.T(), err)
+	require.Equal(s.T(), "second", readBack)
+}
+
 func (s *DirectoryTestSuite) TestSingleFileUploadBasePath() {
 	s.uploadFS(s.T(), s.singleFileFs(), uploader.BasePath("sub", "dir"))
 
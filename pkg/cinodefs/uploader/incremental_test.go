@@ -0,0 +1,149 @@
+/*
+Copyright © 2022 Bartłomiej Święcki (byo)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package uploader_test
+
+import (
+	"context"
+	"io"
+	"io/fs"
+	"strings"
+	"testing/fstest"
+
+	"github.com/cinode/go/pkg/blenc"
+	"github.com/cinode/go/pkg/cinodefs"
+	"github.com/cinode/go/pkg/cinodefs/uploader"
+	"github.com/cinode/go/pkg/common"
+	"github.com/cinode/go/pkg/datastore"
+	"github.com/stretchr/testify/require"
+)
+
+type updateCountingDS struct {
+	datastore.DS
+	updates int
+}
+
+func (u *updateCountingDS) Update(ctx context.Context, name *common.BlobName, r io.Reader) error {
+	u.updates++
+	return u.DS.Update(ctx, name, r)
+}
+
+// readerOnlyFile hides the io.ReaderAt interface of the file
+type readerOnlyFile struct {
+	f fs.File
+}
+
+func (r *readerOnlyFile) Stat() (fs.FileInfo, error) { return r.f.Stat() }
+func (r *readerOnlyFile) Read(b []byte) (int, error) { return r.f.Read(b) }
+func (r *readerOnlyFile) Close() error               { return r.f.Close() }
+
+func (s *DirectoryTestSuite) TestIncremental() {
+	t := s.T()
+	ctx := context.Background()
+
+	ds := &updateCountingDS{DS: datastore.InMemory()}
+	cfs, err := cinodefs.New(ctx,
+		blenc.FromDatastore(ds),
+		cinodefs.NewRootStaticDirectory(),
+	)
+	require.NoError(t, err)
+
+	fsys := fstest.MapFS{
+		"a.txt":     &fstest.MapFile{Data: []byte("a")},
+		"dir/b.txt": &fstest.MapFile{Data: []byte("b")},
+		"dir/c.txt": &fstest.MapFile{Data: []byte("c")},
+	}
+	err = uploader.UploadStaticDirectory(ctx, fsys, cfs, uploader.Incremental())
+	require.NoError(t, err)
+	require.Equal(t, 3, ds.updates)
+
+	fsys["dir/c.txt"] = &fstest.MapFile{Data: []byte("changed")}
+	fsys["new.txt"] = &fstest.MapFile{Data: []byte("new")}
+
+	ds.updates = 0
+	skipped := map[string]bool{}
+	err = uploader.UploadStaticDirectory(ctx, fsys, cfs,
+		uploader.Incremental(),
+		uploader.ReportProgress(func(ev uploader.ProgressEvent) {
+			skipped[ev.Path] = ev.Skipped
+		}),
+	)
+	require.NoError(t, err)
+	require.Equal(t, 2, ds.updates)
+	require.Equal(t, map[string]bool{
+		"a.txt":     true,
+		"dir/b.txt": true,
+		"dir/c.txt": false,
+		"new.txt":   false,
+	}, skipped)
+
+	for path, expected := range map[string]string{
+		"a.txt":     "a",
+		"dir/c.txt": "changed",
+		"new.txt":   "new",
+	} {
+		rc, err := cfs.OpenEntryData(ctx, strings.Split(path, "/"))
+		require.NoError(t, err)
+		data, err := io.ReadAll(rc)
+		require.NoError(t, err)
+		require.NoError(t, rc.Close())
+		require.Equal(t, expected, string(data))
+	}
+
+	// Files that can not be read twice are always uploaded
+	ds.updates = 0
+	testFS := &wrapFS{FS: fsys}
+	testFS.openFunc = func(path string) (fs.File, error) {
+		fl, err := testFS.FS.Open(path)
+		if err != nil || path == "." || path == "dir" {
+			return fl, err
+		}
+		return &readerOnlyFile{f: fl}, nil
+	}
+	err = uploader.UploadStaticDirectory(ctx, testFS, cfs, uploader.Incremental())
+	require.NoError(t, err)
+	require.Equal(t, 4, ds.updates)
+}
+
+func (s *DirectoryTestSuite) TestIncrementalWithBlobOptions() {
+	for _, opts := range [][]blenc.Option{
+		{blenc.StaticEncryption(blenc.AES256CTR)},
+		{blenc.CompressStatic()},
+	} {
+		t := s.T()
+		ctx := context.Background()
+
+		ds := &updateCountingDS{DS: datastore.InMemory()}
+		cfs, err := cinodefs.New(ctx,
+			blenc.FromDatastore(ds, opts...),
+			cinodefs.NewRootStaticDirectory(),
+		)
+		require.NoError(t, err)
+
+		fsys := fstest.MapFS{
+			"a.txt":     &fstest.MapFile{Data: []byte(strings.Repeat("a", 1000))},
+			"dir/b.txt": &fstest.MapFile{Data: []byte("b")},
+		}
+		err = uploader.UploadStaticDirectory(ctx, fsys, cfs, uploader.Incremental())
+		require.NoError(t, err)
+		require.Equal(t, 2, ds.updates)
+
+		ds.updates = 0
+		err = uploader.UploadStaticDirectory(ctx, fsys, cfs, uploader.Incremental())
+		require.NoError(t, err)
+		require.Zero(t, ds.updates)
+	}
+}
@@ -0,0 +1,128 @@
+/*
+Copyright © 2022 Bartłomiej Święcki (byo)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package uploader
+
+import (
+	"io"
+	"io/fs"
+
+	"github.com/cinode/go/pkg/utilities/progress"
+)
+
+// ProgressEvent describes the upload progress, an event is reported
+// once each file is stored
+type ProgressEvent struct {
+	// Path of the uploaded file in the source filesystem
+	Path string
+
+	// Size of the uploaded file
+	Size int64
+
+	// Skipped is set if the file was not uploaded since the destination
+	// already contained the same content, see Incremental
+	Skipped bool
+
+	// Total number of bytes and files uploaded so far, including this file
+	// and skipped ones. With parallel uploads the number of bytes also
+	// includes data of files that are still being uploaded.
+	UploadedBytes int64
+	UploadedFiles int
+
+	// Total number of files to upload
+	TotalFiles int
+}
+
+// ReportProgress sets the function called after each file is uploaded.
+//
+// Files are counted before the upload starts so that the total number of files
+// is known. Generated index files are not reported.
+//
+// Events are reported in the upload order. The function is never called
+// concurrently, it should return quickly since it blocks the upload.
+func ReportProgress(f func(ev ProgressEvent)) Option {
+	return Option(func(d *dirCompiler) {
+		d.progress = f
+	})
+}
+
+// ReportBytes sets the function called with the number of bytes of file data
+// uploaded so far, see the progress package for details. The total number of
+// bytes is computed before the upload starts, skipped files are counted
+// as uploaded.
+func ReportBytes(cb progress.Callback) Option {
+	return Option(func(d *dirCompiler) {
+		d.bytesProgress = cb
+	})
+}
+
+// startProgress prepares progress tracking before the upload starts
+func (d *dirCompiler) startProgress() {
+	totalBytes := int64(-1)
+	if d.progress != nil || d.bytesProgress != nil {
+		d.totalFiles, totalBytes = countFiles(d.fsys)
+	}
+	d.uploadedBytes = progress.NewCounter(totalBytes, d.bytesProgress)
+}
+
+func countFiles(fsys fs.FS) (int, int64) {
+	count, size := 0, int64(0)
+	err := fs.WalkDir(fsys, ".", func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.Type().IsRegular() {
+			count++
+			if info, err := d.Info(); err == nil {
+				size += info.Size()
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		// Errors are reported during the upload
+		return 0, -1
+	}
+	return count, size
+}
+
+// uploadReader wraps the reader of the uploaded file to count uploaded bytes
+func (d *dirCompiler) uploadReader(r io.Reader) io.Reader {
+	return d.uploadedBytes.Reader(r)
+}
+
+func (d *dirCompiler) reportProgress(path string, size int64, skipped bool) {
+	if skipped {
+		d.uploadedBytes.Add(size)
+	}
+
+	if d.progress == nil {
+		return
+	}
+
+	d.progressMutex.Lock()
+	defer d.progressMutex.Unlock()
+
+	d.uploadedFiles++
+	d.progress(ProgressEvent{
+		Path:          path,
+		Size:          size,
+		Skipped:       skipped,
+		UploadedBytes: d.uploadedBytes.N(),
+		UploadedFiles: d.uploadedFiles,
+		TotalFiles:    d.totalFiles,
+	})
+}
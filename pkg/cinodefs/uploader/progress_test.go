@@ -0,0 +1,76 @@
+/*
+Copyright © 2022 Bartłomiej Święcki (byo)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package uploader_test
+
+import (
+	"io/fs"
+	"testing/fstest"
+
+	"github.com/cinode/go/pkg/cinodefs/uploader"
+	"github.com/stretchr/testify/require"
+)
+
+func (s *DirectoryTestSuite) TestProgress() {
+	t := s.T()
+	fsys := fstest.MapFS{
+		"a.txt":         &fstest.MapFile{Data: []byte("a")},
+		"dir/b.txt":     &fstest.MapFile{Data: []byte("bb")},
+		"dir/sub/c.txt": &fstest.MapFile{Data: []byte("ccc")},
+		"empty":         &fstest.MapFile{Mode: fs.ModeDir},
+		"z.txt":         &fstest.MapFile{Data: []byte("")},
+	}
+
+	events := []uploader.ProgressEvent{}
+	s.uploadFS(t, fsys,
+		uploader.CreateIndexFile("index.html"),
+		uploader.ReportProgress(func(ev uploader.ProgressEvent) {
+			events = append(events, ev)
+		}),
+	)
+
+	require.Equal(t, []uploader.ProgressEvent{
+		{Path: "a.txt", Size: 1, UploadedBytes: 1, UploadedFiles: 1, TotalFiles: 4},
+		{Path: "dir/b.txt", Size: 2, UploadedBytes: 3, UploadedFiles: 2, TotalFiles: 4},
+		{Path: "dir/sub/c.txt", Size: 3, UploadedBytes: 6, UploadedFiles: 3, TotalFiles: 4},
+		{Path: "z.txt", Size: 0, UploadedBytes: 6, UploadedFiles: 4, TotalFiles: 4},
+	}, events)
+}
+
+func (s *DirectoryTestSuite) TestReportBytes() {
+	t := s.T()
+	fsys := fstest.MapFS{
+		"a.txt":     &fstest.MapFile{Data: []byte("a")},
+		"dir/b.txt": &fstest.MapFile{Data: []byte("bb")},
+	}
+
+	for _, opts := range [][]uploader.Option{
+		{},
+		{uploader.Incremental()},
+		{uploader.Concurrency(4)},
+	} {
+		reported := []int64{}
+		s.uploadFS(t, fsys, append(opts,
+			uploader.ReportBytes(func(n, total int64) {
+				require.EqualValues(t, 3, total)
+				reported = append(reported, n)
+			}),
+		)...)
+
+		require.IsIncreasing(t, reported)
+		require.EqualValues(t, 3, reported[len(reported)-1])
+	}
+}
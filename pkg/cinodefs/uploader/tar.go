@@ -0,0 +1,204 @@
+/*
+Copyright © 2022 Bartłomiej Święcki (byo)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package uploader
+
+import (
+	"archive/tar"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/cinode/go/pkg/cinodefs"
+	"github.com/cinode/go/pkg/utilities/progress"
+)
+
+const (
+	// TarMimeTypePAXRecord is the name of the PAX record containing the mime
+	// type of a file in archives created with ExportTar
+	TarMimeTypePAXRecord = "CINODE.mimetype"
+)
+
+// ExportOption is an optional parameter of the ExportTar operation
+type ExportOption func(e *exportOptions)
+
+type exportOptions struct {
+	progress progress.Callback
+}
+
+// ExportProgress sets the function called with the number of bytes of file
+// data exported so far, the total number of bytes is not known upfront
+func ExportProgress(cb progress.Callback) ExportOption {
+	return ExportOption(func(e *exportOptions) {
+		e.progress = cb
+	})
+}
+
+// ExportTar writes the content of the directory at given path into
+// a tar archive. Directories, including empty ones, are stored as directory
+// headers, the mime type of files is stored in the TarMimeTypePAXRecord PAX
+// record. Names in the archive are relative to the exported directory.
+//
+// Links are followed transparently, the number of consecutive links is
+// limited by the MaxLinkRedirects setting of the filesystem. Symbolic links
+// are stored as symbolic links with the target relative to the link location.
+// The archive is not finalized if an error is returned.
+func ExportTar(
+	ctx context.Context,
+	cfs cinodefs.FS,
+	root []string,
+	w io.Writer,
+	opts ...ExportOption,
+) error {
+	e := exportOptions{}
+	for _, opt := range opts {
+		opt(&e)
+	}
+	exported := progress.NewCounter(-1, e.progress)
+
+	tw := tar.NewWriter(w)
+
+	for entry, err := range cfs.WalkStream(ctx, root) {
+		if err != nil {
+			return err
+		}
+
+		err = exportTarEntry(ctx, cfs, tw, root, entry, exported)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tw.Close()
+}
+
+func exportTarEntry(
+	ctx context.Context,
+	cfs cinodefs.FS,
+	tw *tar.Writer,
+	root []string,
+	entry cinodefs.WalkEntry,
+	exported *progress.Counter,
+) error {
+	name := strings.Join(entry.Path[len(root):], "/")
+
+	if entry.IsSymlink {
+		target, err := cfs.ReadSymlink(ctx, entry.Path)
+		if err != nil {
+			return fmt.Errorf("failed to read symbolic link %v: %w", name, err)
+		}
+		return tw.WriteHeader(&tar.Header{
+			Typeflag: tar.TypeSymlink,
+			Name:     name,
+			Linkname: relativeSymlinkTarget(entry.Path[:len(entry.Path)-1], target),
+			Mode:     0o777,
+		})
+	}
+
+	ep := entry.Entrypoint
+	isDir := entry.IsDir
+	if entry.IsLink {
+		// Find the target of the link
+		target, err := cfs.FindEntry(ctx, entry.Path)
+		switch {
+		case errors.Is(err, cinodefs.ErrModifiedDirectory):
+			ep, isDir = nil, true
+		case err != nil:
+			return fmt.Errorf("failed to resolve link %v: %w", name, err)
+		default:
+			ep, isDir = target, target.IsDir()
+		}
+	}
+
+	if isDir {
+		hdr := &tar.Header{
+			Typeflag: tar.TypeDir,
+			Name:     name + "/",
+			Mode:     0o755,
+		}
+		if ep != nil {
+			hdr.ModTime = ep.ModTime()
+		}
+		return tw.WriteHeader(hdr)
+	}
+
+	size := ep.ContentLength()
+	if size == 0 {
+		// Entries created before the content length was recorded,
+		// the length must be known before writing the data
+		var err error
+		size, err = exportTarFileSize(ctx, cfs, ep)
+		if err != nil {
+			return fmt.Errorf("failed to read file %v: %w", name, err)
+		}
+	}
+
+	err := tw.WriteHeader(&tar.Header{
+		Typeflag:   tar.TypeReg,
+		Name:       name,
+		Mode:       0o644,
+		Size:       size,
+		ModTime:    ep.ModTime(),
+		Format:     tar.FormatPAX,
+		PAXRecords: map[string]string{TarMimeTypePAXRecord: ep.MimeType()},
+	})
+	if err != nil {
+		return err
+	}
+
+	rc, err := cfs.OpenEntrypointData(ctx, ep)
+	if err != nil {
+		return fmt.Errorf("failed to open file %v: %w", name, err)
+	}
+	defer rc.Close()
+
+	_, err = io.Copy(tw, exported.Reader(rc))
+	if err != nil {
+		return fmt.Errorf("failed to export file %v: %w", name, err)
+	}
+	return nil
+}
+
+// relativeSymlinkTarget converts the target path of a symbolic link placed
+// in given directory to a path relative to that directory
+func relativeSymlinkTarget(dir, target []string) string {
+	common := 0
+	for common < len(dir) && common < len(target) && dir[common] == target[common] {
+		common++
+	}
+
+	parts := make([]string, 0, len(dir)-common+len(target)-common)
+	for range dir[common:] {
+		parts = append(parts, "..")
+	}
+	parts = append(parts, target[common:]...)
+	if len(parts) == 0 {
+		return "."
+	}
+	return strings.Join(parts, "/")
+}
+
+func exportTarFileSize(ctx context.Context, cfs cinodefs.FS, ep *cinodefs.Entrypoint) (int64, error) {
+	rc, err := cfs.OpenEntrypointData(ctx, ep)
+	if err != nil {
+		return 0, err
+	}
+	defer rc.Close()
+
+	return io.Copy(io.Discard, rc)
+}
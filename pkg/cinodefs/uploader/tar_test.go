@@ -0,0 +1,184 @@
+/*
+Copyright © 2023 Bartłomiej Święcki (byo)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package uploader_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"strings"
+
+	"github.com/cinode/go/pkg/cinodefs"
+	"github.com/cinode/go/pkg/cinodefs/uploader"
+	"github.com/stretchr/testify/require"
+)
+
+type tarEntry struct {
+	typeflag byte
+	content  string
+	mimeType string
+	linkname string
+}
+
+func readTar(t require.TestingT, r io.Reader) map[string]tarEntry {
+	ret := map[string]tarEntry{}
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return ret
+		}
+		require.NoError(t, err)
+
+		data, err := io.ReadAll(tr)
+		require.NoError(t, err)
+		ret[hdr.Name] = tarEntry{
+			typeflag: hdr.Typeflag,
+			content:  string(data),
+			mimeType: hdr.PAXRecords[uploader.TarMimeTypePAXRecord],
+			linkname: hdr.Linkname,
+		}
+	}
+}
+
+func (s *DirectoryTestSuite) TestExportTar() {
+	t := s.T()
+	ctx := context.Background()
+
+	zr := buildZip(t,
+		"file.txt",
+		"dir/a.txt",
+		"dir/sub/b.html",
+		"empty/",
+		"linked/c.txt",
+	)
+	require.NoError(t, s.uploadZip(t, zr))
+
+	_, err := s.cfs.InjectDynamicLink(ctx, []string{"linked"})
+	require.NoError(t, err)
+	require.NoError(t, s.cfs.Flush(ctx))
+
+	// Link pointing to a file
+	_, err = s.cfs.InjectDynamicLink(ctx, []string{"linked", "c.txt"})
+	require.NoError(t, err)
+	require.NoError(t, s.cfs.Flush(ctx))
+
+	s.Run("whole tree", func() {
+		t := s.T()
+		buf := bytes.NewBuffer(nil)
+		err := uploader.ExportTar(ctx, s.cfs, nil, buf)
+		require.NoError(t, err)
+
+		require.Equal(t, map[string]tarEntry{
+			"dir/":           {typeflag: tar.TypeDir},
+			"dir/a.txt":      {typeflag: tar.TypeReg, content: "content of dir/a.txt", mimeType: "text/plain; charset=utf-8"},
+			"dir/sub/":       {typeflag: tar.TypeDir},
+			"dir/sub/b.html": {typeflag: tar.TypeReg, content: "content of dir/sub/b.html", mimeType: "text/html; charset=utf-8"},
+			"empty/":         {typeflag: tar.TypeDir},
+			"file.txt":       {typeflag: tar.TypeReg, content: "content of file.txt", mimeType: "text/plain; charset=utf-8"},
+			"linked/":        {typeflag: tar.TypeDir},
+			"linked/c.txt":   {typeflag: tar.TypeReg, content: "content of linked/c.txt", mimeType: "text/plain; charset=utf-8"},
+		}, readTar(t, buf))
+	})
+
+	s.Run("progress", func() {
+		t := s.T()
+		reported := []int64{}
+		err := uploader.ExportTar(ctx, s.cfs, []string{"dir"}, io.Discard,
+			uploader.ExportProgress(func(n, total int64) {
+				require.EqualValues(t, -1, total)
+				reported = append(reported, n)
+			}),
+		)
+		require.NoError(t, err)
+		require.IsIncreasing(t, reported)
+		require.EqualValues(t,
+			len("content of dir/a.txt")+len("content of dir/sub/b.html"),
+			reported[len(reported)-1],
+		)
+	})
+
+	s.Run("subtree", func() {
+		t := s.T()
+		buf := bytes.NewBuffer(nil)
+		err := uploader.ExportTar(ctx, s.cfs, []string{"dir"}, buf)
+		require.NoError(t, err)
+
+		require.Equal(t, map[string]tarEntry{
+			"a.txt":      {typeflag: tar.TypeReg, content: "content of dir/a.txt", mimeType: "text/plain; charset=utf-8"},
+			"sub/":       {typeflag: tar.TypeDir},
+			"sub/b.html": {typeflag: tar.TypeReg, content: "content of dir/sub/b.html", mimeType: "text/html; charset=utf-8"},
+		}, readTar(t, buf))
+	})
+
+	s.Run("unsaved changes", func() {
+		t := s.T()
+		_, err := s.cfs.SetEntryFile(ctx, []string{"new", "d.txt"}, bytes.NewReader([]byte("d")))
+		require.NoError(t, err)
+
+		buf := bytes.NewBuffer(nil)
+		err = uploader.ExportTar(ctx, s.cfs, []string{"new"}, buf)
+		require.NoError(t, err)
+
+		require.Equal(t, map[string]tarEntry{
+			"d.txt": {typeflag: tar.TypeReg, content: "d", mimeType: "text/plain; charset=utf-8"},
+		}, readTar(t, buf))
+	})
+
+	s.Run("too many link redirects", func() {
+		t := s.T()
+		err := s.cfs.SetMaxLinkRedirects(0)
+		require.NoError(t, err)
+		defer s.cfs.SetMaxLinkRedirects(cinodefs.DefaultMaxLinksRedirects)
+
+		err = uploader.ExportTar(ctx, s.cfs, nil, io.Discard)
+		require.ErrorIs(t, err, cinodefs.ErrTooManyRedirects)
+	})
+
+	s.Run("missing path", func() {
+		t := s.T()
+		err := uploader.ExportTar(ctx, s.cfs, []string{"missing"}, io.Discard)
+		require.ErrorIs(t, err, cinodefs.ErrEntryNotFound)
+	})
+
+	s.Run("symbolic links", func() {
+		t := s.T()
+		for path, target := range map[string][]string{
+			"to-sub":      {"dir", "sub"},
+			"sub/to-file": {"file.txt"},
+			"sub/to-dir":  {"dir"},
+		} {
+			err := s.cfs.SetSymlink(ctx, append([]string{"dir"}, strings.Split(path, "/")...), target)
+			require.NoError(t, err)
+		}
+
+		buf := bytes.NewBuffer(nil)
+		err := uploader.ExportTar(ctx, s.cfs, []string{"dir"}, buf)
+		require.NoError(t, err)
+
+		require.Equal(t, map[string]tarEntry{
+			"a.txt":       {typeflag: tar.TypeReg, content: "content of dir/a.txt", mimeType: "text/plain; charset=utf-8"},
+			"sub/":        {typeflag: tar.TypeDir},
+			"sub/b.html":  {typeflag: tar.TypeReg, content: "content of dir/sub/b.html", mimeType: "text/html; charset=utf-8"},
+			"sub/to-dir":  {typeflag: tar.TypeSymlink, linkname: ".."},
+			"sub/to-file": {typeflag: tar.TypeSymlink, linkname: "../../file.txt"},
+			"to-sub":      {typeflag: tar.TypeSymlink, linkname: "sub"},
+		}, readTar(t, buf))
+	})
+}
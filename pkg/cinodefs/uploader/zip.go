@@ -0,0 +1,79 @@
+/*
+Copyright © 2022 Bartłomiej Święcki (byo)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package uploader
+
+import (
+	"archive/zip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+
+	"github.com/cinode/go/pkg/cinodefs"
+)
+
+var (
+	ErrInvalidZipArchive = errors.New("invalid zip archive")
+	ErrUnsafeZipEntry    = errors.New("unsafe zip entry path")
+)
+
+// UploadZip uploads the content of a zip archive, directories and files
+// from the archive are stored in the same way as with UploadStaticDirectory.
+//
+// Archives with entries that would be stored outside of the destination
+// directory (absolute paths, paths escaping through .. segments) are rejected
+// before any data is uploaded.
+func UploadZip(
+	ctx context.Context,
+	zipReader io.ReaderAt,
+	size int64,
+	cfs cinodefs.FS,
+	opts ...Option,
+) error {
+	zr, err := zip.NewReader(zipReader, size)
+	if err != nil && !errors.Is(err, zip.ErrInsecurePath) {
+		return fmt.Errorf("%w: %w", ErrInvalidZipArchive, err)
+	}
+
+	// Insecure paths are not rejected by default by the zip package,
+	// the io/fs view of the archive would silently move such entries
+	for _, f := range zr.File {
+		err := validateZipEntryName(f.Name)
+		if err != nil {
+			return err
+		}
+	}
+
+	return UploadStaticDirectory(ctx, zr, cfs, opts...)
+}
+
+func validateZipEntryName(name string) error {
+	switch {
+	case strings.Contains(name, `\`):
+		return fmt.Errorf("%w: %q contains backslash", ErrUnsafeZipEntry, name)
+	case path.IsAbs(name):
+		return fmt.Errorf("%w: %q is an absolute path", ErrUnsafeZipEntry, name)
+	}
+
+	cleaned := path.Clean(name)
+	if cleaned == ".." || strings.HasPrefix(cleaned, "../") {
+		return fmt.Errorf("%w: %q escapes the destination directory", ErrUnsafeZipEntry, name)
+	}
+	return nil
+}
@@ -0,0 +1,128 @@
+/*
+Copyright © 2023 Bartłomiej Święcki (byo)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package uploader_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/cinode/go/pkg/cinodefs"
+	"github.com/cinode/go/pkg/cinodefs/uploader"
+	"github.com/stretchr/testify/require"
+)
+
+func buildZip(t *testing.T, entries ...string) *bytes.Reader {
+	buf := bytes.NewBuffer(nil)
+	zw := zip.NewWriter(buf)
+	for _, name := range entries {
+		w, err := zw.Create(name)
+		require.NoError(t, err)
+		if !strings.HasSuffix(name, "/") {
+			_, err = w.Write([]byte("content of " + name))
+			require.NoError(t, err)
+		}
+	}
+	require.NoError(t, zw.Close())
+	return bytes.NewReader(buf.Bytes())
+}
+
+func (s *DirectoryTestSuite) uploadZip(t *testing.T, zr *bytes.Reader, opts ...uploader.Option) error {
+	return uploader.UploadZip(context.Background(), zr, zr.Size(), s.cfs, opts...)
+}
+
+func (s *DirectoryTestSuite) TestZipUpload() {
+	t := s.T()
+	zr := buildZip(t,
+		"file.txt",
+		"dir/",
+		"dir/a.txt",
+		"implicit/sub/b.txt",
+		"empty/",
+	)
+	require.NoError(t, s.uploadZip(t, zr))
+
+	for _, path := range []string{"file.txt", "dir/a.txt", "implicit/sub/b.txt"} {
+		readBack, err := s.readContent(t, strings.Split(path, "/")...)
+		require.NoError(t, err)
+		require.Equal(t, "content of "+path, readBack)
+	}
+
+	entries, err := s.cfs.ListDir(context.Background(), []string{"empty"})
+	require.NoError(t, err)
+	require.Empty(t, entries)
+}
+
+func (s *DirectoryTestSuite) TestZipUploadOptions() {
+	t := s.T()
+	zr := buildZip(t, "file.txt", "dir/a.txt", "empty/")
+	err := s.uploadZip(t, zr,
+		uploader.BasePath("sub", "dir"),
+		uploader.CreateIndexFile("index.html"),
+	)
+	require.NoError(t, err)
+
+	readBack, err := s.readContent(t, "sub", "dir", "dir", "a.txt")
+	require.NoError(t, err)
+	require.Equal(t, "content of dir/a.txt", readBack)
+
+	for _, path := range [][]string{
+		{"sub", "dir", "index.html"},
+		{"sub", "dir", "dir", "index.html"},
+		{"sub", "dir", "empty", "index.html"},
+	} {
+		readBack, err = s.readContent(t, path...)
+		require.NoError(t, err)
+		require.True(t, strings.HasPrefix(readBack, "<!DOCTYPE"))
+	}
+
+	_, err = s.readContent(t, "file.txt")
+	require.ErrorIs(t, err, cinodefs.ErrEntryNotFound)
+}
+
+func (s *DirectoryTestSuite) TestZipUploadUnsafePaths() {
+	for _, name := range []string{
+		"../evil.txt",
+		"dir/../../evil.txt",
+		"/etc/evil.txt",
+		`dir\..\..\evil.txt`,
+		"..",
+	} {
+		s.Run(name, func() {
+			t := s.T()
+			zr := buildZip(t, "file.txt", name)
+
+			err := s.uploadZip(t, zr)
+			require.ErrorIs(t, err, uploader.ErrUnsafeZipEntry)
+			require.ErrorContains(t, err, strconv.Quote(name))
+
+			// Nothing is uploaded if any entry is unsafe
+			_, err = s.readContent(t, "file.txt")
+			require.ErrorIs(t, err, cinodefs.ErrEntryNotFound)
+		})
+	}
+}
+
+func (s *DirectoryTestSuite) TestZipUploadInvalidArchive() {
+	t := s.T()
+	zr := bytes.NewReader([]byte("not a zip archive"))
+	err := s.uploadZip(t, zr)
+	require.ErrorIs(t, err, uploader.ErrInvalidZipArchive)
+}
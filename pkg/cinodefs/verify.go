@@ -0,0 +1,286 @@
+/*
+Copyright © 2023 Bartłomiej Święcki (byo)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cinodefs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/cinode/go/pkg/blenc"
+	"github.com/cinode/go/pkg/common"
+	"github.com/cinode/go/pkg/datastore"
+)
+
+var (
+	ErrVerificationFailed = errors.New("dataset verification failed")
+)
+
+// VerifyReachable walks the whole dataset starting at given root entrypoint
+// and ensures that every blob reachable from it is present in the datastore
+// and passes validation.
+//
+// Directories and links are decoded to discover further entries, file blobs
+// are read through the blenc layer only to trigger their validation, the
+// content itself is discarded.
+//
+// The first blob that is missing or invalid is reported through an error
+// wrapping ErrVerificationFailed, the name of the failing blob is included
+// in the error message and the underlying cause can be inspected with
+// errors.Is (i.e. ErrNotFound for missing blobs). With the SkipAndReport
+// policy, all failing blobs are reported through *SkippedEntriesError.
+func VerifyReachable(
+	ctx context.Context,
+	be blenc.BE,
+	root *Entrypoint,
+	maxRedirects int,
+	opts ...WalkOption,
+) error {
+	if be == nil {
+		return ErrInvalidBE
+	}
+	if root == nil {
+		return ErrNilEntrypoint
+	}
+	if maxRedirects < 0 {
+		return ErrNegativeMaxLinksRedirects
+	}
+	o, err := walkOptionsFrom(opts)
+	if err != nil {
+		return err
+	}
+
+	v := newReachabilityVerifier(be, maxRedirects, true, o.policy)
+	err = v.verify(ctx, root, nil, 0)
+	if err != nil {
+		return err
+	}
+
+	return v.errs.result()
+}
+
+// ReachableBlobs returns names of all blobs reachable from given root
+// entrypoint, including the root itself.
+//
+// Contrary to VerifyReachable, file blobs are not read, only directories
+// and links are loaded in order to discover further entries. Any failure
+// while loading those is reported in the same way as in VerifyReachable.
+// With the SkipAndReport policy, blobs found so far are returned together
+// with the *SkippedEntriesError, such partial result must not be used to
+// find orphaned blobs.
+//
+// The result can be used as the set of live blobs when looking
+// for orphaned blobs with datastore.FindBlobsNotIn, see also FindOrphans.
+func ReachableBlobs(
+	ctx context.Context,
+	be blenc.BE,
+	root *Entrypoint,
+	maxRedirects int,
+	opts ...WalkOption,
+) ([]*common.BlobName, error) {
+	if be == nil {
+		return nil, ErrInvalidBE
+	}
+	if root == nil {
+		return nil, ErrNilEntrypoint
+	}
+	if maxRedirects < 0 {
+		return nil, ErrNegativeMaxLinksRedirects
+	}
+	o, err := walkOptionsFrom(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	v := newReachabilityVerifier(be, maxRedirects, false, o.policy)
+	err = v.verify(ctx, root, nil, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	return v.reached, v.errs.result()
+}
+
+// FindOrphans returns blobs stored in given datastore that are not reachable
+// from any of the root entrypoints together with their total size. Blobs
+// reachable from roots are found with ReachableBlobs. This is a read-only
+// operation, no blob is deleted.
+//
+// The datastore should be the one used by the BE. Any failure while walking
+// the dataset is returned as an error, including those skipped with the
+// SkipAndReport policy, since a partial set of reachable blobs would report
+// live blobs as orphaned.
+func FindOrphans(
+	ctx context.Context,
+	be blenc.BE,
+	ds datastore.DS,
+	roots []*Entrypoint,
+	maxRedirects int,
+	opts ...WalkOption,
+) ([]*common.BlobName, int64, error) {
+	seen := map[string]struct{}{}
+	live := []*common.BlobName{}
+	for _, root := range roots {
+		blobs, err := ReachableBlobs(ctx, be, root, maxRedirects, opts...)
+		if err != nil {
+			return nil, 0, err
+		}
+		for _, bn := range blobs {
+			if _, found := seen[bn.String()]; !found {
+				seen[bn.String()] = struct{}{}
+				live = append(live, bn)
+			}
+		}
+	}
+
+	return datastore.FindBlobsNotIn(ctx, ds, live)
+}
+
+type reachabilityVerifier struct {
+	gc            graphContext
+	maxRedirects  int
+	validateFiles bool
+	visited       map[string]struct{}
+	reached       []*common.BlobName
+	reachedPaths  []string
+	errs          walkErrorHandler
+}
+
+func newReachabilityVerifier(
+	be blenc.BE,
+	maxRedirects int,
+	validateFiles bool,
+	policy WalkPolicy,
+) *reachabilityVerifier {
+	return &reachabilityVerifier{
+		gc: graphContext{
+			be:        be,
+			authInfos: map[string]*common.AuthInfo{},
+		},
+		maxRedirects:  maxRedirects,
+		validateFiles: validateFiles,
+		visited:       map[string]struct{}{},
+		errs:          walkErrorHandler{policy: policy},
+	}
+}
+
+func (v *reachabilityVerifier) verify(
+	ctx context.Context,
+	ep *Entrypoint,
+	path []string,
+	linkDepth int,
+) error {
+	if ep.IsLink() && linkDepth >= v.maxRedirects {
+		return v.errs.handle(strings.Join(path, "/"), ep.BlobName(), fmt.Errorf(
+			"%w: blob %s: %w",
+			ErrVerificationFailed, ep.BlobName(), ErrTooManyRedirects,
+		))
+	}
+
+	// Blobs can be referenced multiple times (i.e. the same file in different
+	// directories), there's no need to validate them more than once, this
+	// also protects against loops created with dynamic links.
+	bn := ep.BlobName().String()
+	if _, visited := v.visited[bn]; visited {
+		return nil
+	}
+	v.visited[bn] = struct{}{}
+	v.reached = append(v.reached, ep.BlobName())
+	v.reachedPaths = append(v.reachedPaths, strings.Join(path, "/"))
+
+	if !ep.IsLink() && !ep.IsDir() {
+		if !v.validateFiles {
+			return nil
+		}
+		err := v.errs.do(ctx, func() error { return v.verifyFile(ctx, ep) })
+		if err != nil {
+			return v.errs.handle(strings.Join(path, "/"), ep.BlobName(), err)
+		}
+		return nil
+	}
+
+	var loaded node
+	err := v.errs.do(ctx, func() error {
+		var err error
+		loaded, err = (&nodeUnloaded{ep: ep}).load(ctx, &v.gc)
+		if dir, isDir := loaded.(*nodeDirectory); isDir {
+			err = dir.loadAllShards(ctx, &v.gc)
+		}
+		return err
+	})
+	if err != nil {
+		return v.errs.handle(strings.Join(path, "/"), ep.BlobName(), fmt.Errorf(
+			"%w: blob %s: %w",
+			ErrVerificationFailed, ep.BlobName(), err,
+		))
+	}
+
+	switch n := loaded.(type) {
+	case *nodeLink:
+		target, err := n.target.entrypoint()
+		if err != nil {
+			return err
+		}
+		return v.verify(ctx, target, path, linkDepth+1)
+
+	case *nodeDirectory:
+		// Shards of a split directory are already validated while loading it
+		for _, shard := range n.shards {
+			if _, visited := v.visited[shard.ep.BlobName().String()]; !visited {
+				v.visited[shard.ep.BlobName().String()] = struct{}{}
+				v.reached = append(v.reached, shard.ep.BlobName())
+				v.reachedPaths = append(v.reachedPaths, strings.Join(path, "/"))
+			}
+		}
+
+		for _, name := range slices.Sorted(maps.Keys(n.entries)) {
+			if _, isSymlink := n.entries[name].(*nodeSymlink); isSymlink {
+				// Symbolic link is fully stored in the directory blob
+				continue
+			}
+			entryEP, err := n.entries[name].entrypoint()
+			if err != nil {
+				return err
+			}
+			err = v.verify(ctx, entryEP, append(path[:len(path):len(path)], name), 0)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (v *reachabilityVerifier) verifyFile(ctx context.Context, ep *Entrypoint) error {
+	rc, err := v.gc.getDataReader(ctx, ep)
+	if err != nil {
+		return fmt.Errorf("%w: blob %s: %w", ErrVerificationFailed, ep.BlobName(), err)
+	}
+	defer rc.Close()
+
+	_, err = io.Copy(io.Discard, rc)
+	if err != nil {
+		return fmt.Errorf("%w: blob %s: %w", ErrVerificationFailed, ep.BlobName(), err)
+	}
+
+	return nil
+}
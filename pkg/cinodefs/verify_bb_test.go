@@ -0,0 +1,196 @@
+/*
+Copyright © 2023 Bartłomiej Święcki (byo)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cinodefs_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/cinode/go/pkg/blenc"
+	"github.com/cinode/go/pkg/blobtypes"
+	"github.com/cinode/go/pkg/cinodefs"
+	"github.com/cinode/go/pkg/common"
+	"github.com/cinode/go/pkg/datastore"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerifyReachable(t *testing.T) {
+	ctx := context.Background()
+	ds := datastore.InMemory()
+	be := blenc.FromDatastore(ds)
+
+	fs, err := cinodefs.New(ctx, be, cinodefs.NewRootDynamicLink())
+	require.NoError(t, err)
+
+	files := map[string][]string{
+		"root file":   {"file.txt"},
+		"nested file": {"dir", "subdir", "file.txt"},
+		"linked file": {"linked", "file.txt"},
+	}
+	for name, path := range files {
+		_, err := fs.SetEntryFile(ctx, path, strings.NewReader("content of "+name))
+		require.NoError(t, err)
+	}
+
+	_, err = fs.InjectDynamicLink(ctx, []string{"linked"})
+	require.NoError(t, err)
+
+	require.NoError(t, fs.Flush(ctx))
+
+	root, err := fs.RootEntrypoint()
+	require.NoError(t, err)
+
+	t.Run("complete dataset", func(t *testing.T) {
+		err := cinodefs.VerifyReachable(ctx, be, root, cinodefs.DefaultMaxLinksRedirects)
+		require.NoError(t, err)
+	})
+
+	t.Run("too many redirects", func(t *testing.T) {
+		err := cinodefs.VerifyReachable(ctx, be, root, 0)
+		require.ErrorIs(t, err, cinodefs.ErrVerificationFailed)
+		require.ErrorIs(t, err, cinodefs.ErrTooManyRedirects)
+	})
+
+	t.Run("invalid arguments", func(t *testing.T) {
+		err := cinodefs.VerifyReachable(ctx, nil, root, 1)
+		require.ErrorIs(t, err, cinodefs.ErrInvalidBE)
+
+		err = cinodefs.VerifyReachable(ctx, be, nil, 1)
+		require.ErrorIs(t, err, cinodefs.ErrNilEntrypoint)
+
+		err = cinodefs.VerifyReachable(ctx, be, root, -1)
+		require.ErrorIs(t, err, cinodefs.ErrNegativeMaxLinksRedirects)
+	})
+
+	t.Run("missing blob", func(t *testing.T) {
+		ep, err := fs.FindEntry(ctx, files["linked file"])
+		require.NoError(t, err)
+
+		err = ds.Delete(ctx, ep.BlobName())
+		require.NoError(t, err)
+
+		err = cinodefs.VerifyReachable(ctx, be, root, cinodefs.DefaultMaxLinksRedirects)
+		require.ErrorIs(t, err, cinodefs.ErrVerificationFailed)
+		require.ErrorIs(t, err, datastore.ErrNotFound)
+		require.ErrorContains(t, err, ep.BlobName().String())
+	})
+}
+
+func TestReachableBlobsAndOrphans(t *testing.T) {
+	ctx := context.Background()
+	ds := datastore.InMemory()
+	be := blenc.FromDatastore(ds)
+
+	fs, err := cinodefs.New(ctx, be, cinodefs.NewRootDynamicLink())
+	require.NoError(t, err)
+
+	for _, path := range [][]string{
+		{"file.txt"},
+		{"dir", "file.txt"},
+		{"dir", "other.txt"},
+	} {
+		_, err := fs.SetEntryFile(ctx, path, strings.NewReader(strings.Join(path, "/")))
+		require.NoError(t, err)
+	}
+	require.NoError(t, fs.Flush(ctx))
+
+	root, err := fs.RootEntrypoint()
+	require.NoError(t, err)
+
+	names := func(bns []*common.BlobName) map[string]struct{} {
+		ret := map[string]struct{}{}
+		for _, bn := range bns {
+			ret[bn.String()] = struct{}{}
+		}
+		return ret
+	}
+
+	reachableBefore, err := cinodefs.ReachableBlobs(ctx, be, root, cinodefs.DefaultMaxLinksRedirects)
+	require.NoError(t, err)
+	// root link, root dir, sub dir and 3 files
+	require.Len(t, reachableBefore, 6)
+
+	orphans, size, err := datastore.FindBlobsNotIn(ctx, ds, reachableBefore)
+	require.NoError(t, err)
+	require.Empty(t, orphans)
+	require.Zero(t, size)
+
+	// Replace the file, that orphans the old file and directories leading to it
+	_, err = fs.SetEntryFile(ctx, []string{"dir", "file.txt"}, strings.NewReader("updated"))
+	require.NoError(t, err)
+	require.NoError(t, fs.Flush(ctx))
+
+	// Blobs not referenced from anywhere
+	extraOrphan, _, _, err := be.Create(ctx, blobtypes.Static, strings.NewReader("orphaned"))
+	require.NoError(t, err)
+
+	reachableAfter, err := cinodefs.ReachableBlobs(ctx, be, root, cinodefs.DefaultMaxLinksRedirects)
+	require.NoError(t, err)
+	require.Len(t, reachableAfter, 6)
+
+	after := names(reachableAfter)
+	expectedOrphans := map[string]struct{}{extraOrphan.String(): {}}
+	for bn := range names(reachableBefore) {
+		if _, found := after[bn]; !found {
+			expectedOrphans[bn] = struct{}{}
+		}
+	}
+	// old file, old sub dir, old root dir and the extra blob
+	require.Len(t, expectedOrphans, 4)
+
+	orphans, size, err = datastore.FindBlobsNotIn(ctx, ds, reachableAfter)
+	require.NoError(t, err)
+	require.Equal(t, expectedOrphans, names(orphans))
+	require.Positive(t, size)
+
+	t.Run("orphans of roots", func(t *testing.T) {
+		rootOrphans, rootSize, err := cinodefs.FindOrphans(ctx, be, ds, []*cinodefs.Entrypoint{root}, cinodefs.DefaultMaxLinksRedirects)
+		require.NoError(t, err)
+		require.Equal(t, expectedOrphans, names(rootOrphans))
+		require.Equal(t, size, rootSize)
+
+		// Overlapping roots
+		dirEP, err := fs.FindEntry(ctx, []string{"dir"})
+		require.NoError(t, err)
+		rootOrphans, _, err = cinodefs.FindOrphans(ctx, be, ds, []*cinodefs.Entrypoint{dirEP, root}, cinodefs.DefaultMaxLinksRedirects)
+		require.NoError(t, err)
+		require.Equal(t, expectedOrphans, names(rootOrphans))
+
+		// Without roots, everything is orphaned
+		rootOrphans, _, err = cinodefs.FindOrphans(ctx, be, ds, nil, cinodefs.DefaultMaxLinksRedirects)
+		require.NoError(t, err)
+		require.Len(t, rootOrphans, len(expectedOrphans)+len(reachableAfter))
+
+		_, _, err = cinodefs.FindOrphans(ctx, be, ds, []*cinodefs.Entrypoint{nil}, cinodefs.DefaultMaxLinksRedirects)
+		require.ErrorIs(t, err, cinodefs.ErrNilEntrypoint)
+	})
+
+	t.Run("invalid arguments", func(t *testing.T) {
+		_, err := cinodefs.ReachableBlobs(ctx, nil, root, 1)
+		require.ErrorIs(t, err, cinodefs.ErrInvalidBE)
+
+		_, err = cinodefs.ReachableBlobs(ctx, be, nil, 1)
+		require.ErrorIs(t, err, cinodefs.ErrNilEntrypoint)
+
+		_, err = cinodefs.ReachableBlobs(ctx, be, root, -1)
+		require.ErrorIs(t, err, cinodefs.ErrNegativeMaxLinksRedirects)
+
+		_, err = cinodefs.ReachableBlobs(ctx, be, root, 0)
+		require.ErrorIs(t, err, cinodefs.ErrTooManyRedirects)
+	})
+}
@@ -0,0 +1,395 @@
+/*
+Copyright © 2023 Bartłomiej Święcki (byo)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cinodefs
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"iter"
+	"slices"
+	"strings"
+
+	"github.com/cinode/go/pkg/common"
+	"github.com/cinode/go/pkg/utilities/golang"
+)
+
+// WalkEntry is a single entry reported by Walk
+type WalkEntry struct {
+	DirEntry
+
+	// Path is the full path of the entry
+	Path []string
+
+	// Entrypoint of the entry, for links this is the entrypoint of the link
+	// itself. It is nil for directories with unsaved modifications and for
+	// symbolic links.
+	Entrypoint *Entrypoint
+}
+
+// EntryOrder compares two directory entries, it returns a negative number
+// if a should be listed before b, a positive number if b should be listed
+// before a and zero if the order is not determined. Entries with undetermined
+// order are listed by name.
+type EntryOrder func(a, b *WalkEntry) int
+
+// OrderByName lists entries by their name, this is the default order
+// that also matches the order in which entries are stored
+func OrderByName(a, b *WalkEntry) int { return 0 }
+
+// OrderByModTime lists entries from the oldest to the most recently modified
+// ones, entries without modification time come first
+func OrderByModTime(a, b *WalkEntry) int { return a.ModTime.Compare(b.ModTime) }
+
+// OrderBySortWeight lists entries from the lowest to the highest sort weight
+func OrderBySortWeight(a, b *WalkEntry) int { return cmp.Compare(a.SortWeight, b.SortWeight) }
+
+type listOptions struct {
+	order  EntryOrder
+	policy WalkPolicy
+}
+
+// ListOption customizes the way entries of directories are listed
+type ListOption func(o *listOptions)
+
+// ListOrder sets the order in which entries of a single directory are listed
+func ListOrder(order EntryOrder) ListOption {
+	return func(o *listOptions) { o.order = order }
+}
+
+// ListWalkPolicy sets how Walk and WalkStream handle sub-directories that
+// can not be read, FailFast is used by default. With SkipAndReport, the walk
+// finishes with a *SkippedEntriesError listing paths of skipped directories.
+// The policy is not used when listing a single directory with ListDir.
+func ListWalkPolicy(policy WalkPolicy) ListOption {
+	return func(o *listOptions) { o.policy = policy }
+}
+
+func listOptionsFrom(opts []ListOption) listOptions {
+	o := listOptions{order: OrderByName}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// Walk calls fn for every entry below the root directory.
+//
+// Entries are visited in a depth-first order, a directory is visited before
+// its content and entries within a single directory are sorted by name
+// unless a different order is set with the ListOrder option.
+// Dynamic links pointing to directories are followed unless such link
+// already appears on the path leading to it. Symbolic links are reported
+// but never followed.
+//
+// The walk starts from the current state of the dataset, including
+// modifications that were not yet flushed. Content of a directory is read
+// before any of its entries is visited thus fn can safely modify entries of
+// the dataset. Sub-directories are walked from nodes found while listing
+// their parent thus modifications done by fn may not be reflected in the
+// remaining part of the walk. The walk stops on the first error returned
+// from fn. Sub-directories that can not be read are handled according to
+// the policy set with ListWalkPolicy.
+func (fs *cinodeFS) Walk(
+	ctx context.Context,
+	root []string,
+	fn func(entry WalkEntry) error,
+	opts ...ListOption,
+) error {
+	root, err := validatePath(root)
+	if err != nil {
+		return err
+	}
+
+	w := walker{
+		fs:           fs,
+		o:            listOptionsFrom(opts),
+		visitedLinks: map[string]struct{}{},
+		fn:           fn,
+	}
+	err = w.o.policy.validate()
+	if err != nil {
+		return err
+	}
+	w.errs.policy = w.o.policy
+
+	var entries []walkNode
+	err = w.errs.do(ctx, func() (err error) {
+		entries, err = fs.listDir(ctx, root, w.o)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	err = w.walk(ctx, entries)
+	if err != nil {
+		return err
+	}
+	return w.errs.result()
+}
+
+// WalkStream returns an iterator over all entries below the root directory.
+//
+// Entries are reported in the same order as with Walk. Directory blobs are
+// loaded only once the iteration reaches them. Symbolic links are reported
+// but never followed.
+//
+// Iteration stops after the first error which is yielded with an empty
+// entry, this includes the cancellation of the context.
+func (fs *cinodeFS) WalkStream(
+	ctx context.Context,
+	root []string,
+	opts ...ListOption,
+) iter.Seq2[WalkEntry, error] {
+	return func(yield func(WalkEntry, error) bool) {
+		err := fs.Walk(ctx, root, func(entry WalkEntry) error {
+			if !yield(entry, nil) {
+				return errWalkStopped
+			}
+			return nil
+		}, opts...)
+		if err != nil && !errors.Is(err, errWalkStopped) {
+			yield(WalkEntry{}, err)
+		}
+	}
+}
+
+// errWalkStopped is used internally once the consumer stops the iteration
+var errWalkStopped = errors.New("walk stopped")
+
+// walkNode is an entry listed during the walk together with its node, the
+// walk descends into the node directly instead of traversing the whole path
+// from the root again
+type walkNode struct {
+	WalkEntry
+	n node
+}
+
+// walker keeps the state of a single Walk call
+type walker struct {
+	fs           *cinodeFS
+	o            listOptions
+	visitedLinks map[string]struct{}
+	errs         walkErrorHandler
+	fn           func(entry WalkEntry) error
+}
+
+func (w *walker) walk(ctx context.Context, entries []walkNode) error {
+	for _, entry := range entries {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := w.fn(entry.WalkEntry); err != nil {
+			return err
+		}
+
+		var err error
+		switch {
+		case entry.IsDir:
+			err = w.walkSubDir(ctx, entry)
+
+		case entry.IsLink:
+			linkName := entry.Entrypoint.BlobName().String()
+			if _, visited := w.visitedLinks[linkName]; visited {
+				// Link pointing to one of its parents, don't loop forever
+				continue
+			}
+
+			w.visitedLinks[linkName] = struct{}{}
+			err = w.walkSubDir(ctx, entry)
+			delete(w.visitedLinks, linkName)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (w *walker) walkSubDir(ctx context.Context, dir walkNode) error {
+	var entries []walkNode
+	err := w.errs.do(ctx, func() (err error) {
+		entries, err = w.fs.listNode(ctx, dir, w.o)
+		return err
+	})
+	switch {
+	case err == nil:
+		return w.walk(ctx, entries)
+
+	case dir.IsLink && errors.Is(err, ErrNotADirectory):
+		// Link to a file
+		return nil
+
+	case ctx.Err() != nil:
+		return err
+
+	default:
+		var bn *common.BlobName
+		if dir.Entrypoint != nil {
+			bn = dir.Entrypoint.BlobName()
+		}
+		return w.errs.handle(strings.Join(dir.Path, "/"), bn, err)
+	}
+}
+
+// walkDir returns entries of a single directory in the listing order
+func (fs *cinodeFS) walkDir(ctx context.Context, path []string, o listOptions) ([]WalkEntry, error) {
+	entries, err := fs.listDir(ctx, path, o)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := make([]WalkEntry, len(entries))
+	for i := range entries {
+		ret[i] = entries[i].WalkEntry
+	}
+	return ret, nil
+}
+
+// listDir returns entries of the directory at given path in the listing order
+func (fs *cinodeFS) listDir(ctx context.Context, path []string, o listOptions) ([]walkNode, error) {
+	var ret []walkNode
+
+	err := fs.traverseGraph(
+		ctx,
+		path,
+		traverseOptions{
+			doNotCache: true,
+		},
+		func(ctx context.Context, reached node, _ bool) (node, dirtyState, error) {
+			var err error
+			ret, err = fs.listReached(ctx, reached, path)
+			if err != nil {
+				return nil, 0, err
+			}
+			return reached, dsClean, nil
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	sortWalkNodes(ret, o)
+	return ret, nil
+}
+
+// listNode returns entries of the directory node found by the walk, links
+// are followed the same way as if the node was reached by a traversal
+func (fs *cinodeFS) listNode(ctx context.Context, dir walkNode, o listOptions) ([]walkNode, error) {
+	var ret []walkNode
+
+	err := fs.withLock(ctx, func(ctx context.Context) error {
+		opts := traverseOptions{
+			doNotCache:       true,
+			maxLinkRedirects: blobIOFromContext(ctx).maxLinkRedirects,
+		}
+
+		_, _, err := dir.n.traverse(
+			ctx,           // context
+			&fs.c,         // graph context
+			dir.Path,      // path
+			len(dir.Path), // pathPosition - the node is the goal
+			0,             // linkDepth - the node is an entry of a directory
+			false,         // isWritable - nodes are never created
+			opts,          // traverseOptions
+			func(ctx context.Context, reached node, _ bool) (node, dirtyState, error) {
+				var err error
+				ret, err = fs.listReached(ctx, reached, dir.Path)
+				if err != nil {
+					return nil, 0, err
+				}
+				return reached, dsClean, nil
+			},
+		)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sortWalkNodes(ret, o)
+	return ret, nil
+}
+
+// listReached returns entries of a directory node reached by a traversal
+func (fs *cinodeFS) listReached(ctx context.Context, reached node, path []string) ([]walkNode, error) {
+	dir, isDir := reached.(*nodeDirectory)
+	if !isDir {
+		return nil, ErrNotADirectory
+	}
+	err := dir.loadAllShards(ctx, &fs.c)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := make([]walkNode, 0, len(dir.entries))
+	for name, entry := range dir.entries {
+		ret = append(ret, walkNode{
+			WalkEntry: walkEntryFromNode(path, name, entry),
+			n:         entry,
+		})
+	}
+	return ret, nil
+}
+
+func sortWalkNodes(entries []walkNode, o listOptions) {
+	slices.SortFunc(entries, func(a, b walkNode) int {
+		if c := o.order(&a.WalkEntry, &b.WalkEntry); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.Name, b.Name)
+	})
+}
+
+func walkEntryFromNode(dirPath []string, name string, n node) WalkEntry {
+	ret := WalkEntry{
+		DirEntry: DirEntry{Name: name},
+		Path:     append(slices.Clone(dirPath), name),
+	}
+
+	if dir, isDir := n.(*nodeDirectory); isDir {
+		// Directory may be modified, its entrypoint may not be known yet
+		ret.IsDir = true
+		ret.MimeType = CinodeDirMimeType
+		ret.Entrypoint, _ = dir.entrypoint()
+		if ret.Entrypoint != nil {
+			ret.ModTime = ret.Entrypoint.ModTime()
+			ret.SortWeight = ret.Entrypoint.SortWeight()
+		}
+		return ret
+	}
+
+	if _, isSymlink := n.(*nodeSymlink); isSymlink {
+		// Symbolic links have no entrypoint, target is resolved when traversed
+		ret.IsSymlink = true
+		return ret
+	}
+
+	// Entrypoint of a loaded link is the entrypoint of the link itself
+	ep, err := n.entrypoint()
+	golang.Assert(err == nil, "only directories and symbolic links can fail to return the entrypoint")
+
+	ret.IsDir = ep.IsDir()
+	ret.IsLink = ep.IsLink()
+	ret.MimeType = ep.MimeType()
+	ret.ModTime = ep.ModTime()
+	ret.SortWeight = ep.SortWeight()
+	ret.Entrypoint = ep
+	return ret
+}
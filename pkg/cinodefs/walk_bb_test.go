@@ -0,0 +1,392 @@
+/*
+Copyright © 2023 Bartłomiej Święcki (byo)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cinodefs_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cinode/go/pkg/blenc"
+	"github.com/cinode/go/pkg/cinodefs"
+	"github.com/cinode/go/pkg/datastore"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWalk(t *testing.T) {
+	ctx := context.Background()
+	be := blenc.FromDatastore(datastore.InMemory())
+	fs, err := cinodefs.New(ctx, be, cinodefs.NewRootDynamicLink())
+	require.NoError(t, err)
+
+	_, err = fs.SetEntryFile(ctx, []string{"b.txt"}, strings.NewReader("b"))
+	require.NoError(t, err)
+	_, err = fs.SetEntryFile(ctx, []string{"a", "file.html"}, strings.NewReader("a"))
+	require.NoError(t, err)
+	_, err = fs.SetEntryFile(ctx, []string{"c", "file.txt"}, strings.NewReader("c"))
+	require.NoError(t, err)
+	_, err = fs.InjectDynamicLink(ctx, []string{"c"})
+	require.NoError(t, err)
+
+	collect := func(t *testing.T, fs cinodefs.FS, root ...string) []string {
+		ret := []string{}
+		err := fs.Walk(ctx, root, func(e cinodefs.WalkEntry) error {
+			require.Equal(t, e.Name, e.Path[len(e.Path)-1])
+			kind := "file"
+			switch {
+			case e.IsDir:
+				kind = "dir"
+			case e.IsLink:
+				kind = "link"
+			}
+			ret = append(ret, strings.Join(e.Path, "/")+" "+kind+" "+e.MimeType)
+			return nil
+		})
+		require.NoError(t, err)
+		return ret
+	}
+
+	expected := []string{
+		"a dir " + cinodefs.CinodeDirMimeType,
+		"a/file.html file text/html; charset=utf-8",
+		"b.txt file text/plain; charset=utf-8",
+		"c link ",
+		"c/file.txt file text/plain; charset=utf-8",
+	}
+
+	t.Run("unflushed dataset", func(t *testing.T) {
+		require.Equal(t, expected, collect(t, fs))
+	})
+
+	require.NoError(t, fs.Flush(ctx))
+
+	t.Run("flushed dataset", func(t *testing.T) {
+		require.Equal(t, expected, collect(t, fs))
+	})
+
+	t.Run("dataset read from datastore", func(t *testing.T) {
+		wi, err := fs.RootWriterInfo(ctx)
+		require.NoError(t, err)
+
+		fs2, err := cinodefs.New(ctx, be, cinodefs.RootWriterInfo(wi))
+		require.NoError(t, err)
+
+		require.Equal(t, expected, collect(t, fs2))
+		require.Equal(t, []string{
+			"c/file.txt file text/plain; charset=utf-8",
+		}, collect(t, fs2, "c"))
+	})
+
+	t.Run("stop on error", func(t *testing.T) {
+		errStop := errors.New("stop")
+		visited := 0
+		err := fs.Walk(ctx, []string{}, func(e cinodefs.WalkEntry) error {
+			visited++
+			return errStop
+		})
+		require.ErrorIs(t, err, errStop)
+		require.Equal(t, 1, visited)
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		walkFn := func(e cinodefs.WalkEntry) error { return nil }
+
+		err := fs.Walk(ctx, []string{"b.txt"}, walkFn)
+		require.ErrorIs(t, err, cinodefs.ErrNotADirectory)
+
+		err = fs.Walk(ctx, []string{"missing"}, walkFn)
+		require.ErrorIs(t, err, cinodefs.ErrEntryNotFound)
+	})
+}
+
+func TestWalkReadsEachDirectoryOnce(t *testing.T) {
+	ctx := context.Background()
+	ds := &countingDatastore{DS: datastore.InMemory()}
+	be := blenc.FromDatastore(ds)
+
+	fs, err := cinodefs.New(ctx, be, cinodefs.NewRootStaticDirectory())
+	require.NoError(t, err)
+
+	const depth = 10
+	path := []string{}
+	for i := 0; i < depth; i++ {
+		path = append(path, "dir")
+		_, err = fs.SetEntryFile(ctx, append(path, "file.txt"), strings.NewReader("data"))
+		require.NoError(t, err)
+	}
+	require.NoError(t, fs.Flush(ctx))
+
+	ep, err := fs.RootEntrypoint()
+	require.NoError(t, err)
+	fs2, err := cinodefs.New(ctx, be, cinodefs.RootEntrypoint(ep))
+	require.NoError(t, err)
+
+	ds.opens.Store(0)
+	visited := 0
+	err = fs2.Walk(ctx, []string{}, func(e cinodefs.WalkEntry) error {
+		visited++
+		return nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, 2*depth, visited)
+
+	// Sub-directories are walked from loaded nodes, paths are not traversed
+	// from the root again
+	require.EqualValues(t, depth+1, ds.opens.Load())
+}
+
+func TestWalkOrder(t *testing.T) {
+	ctx := context.Background()
+	be := blenc.FromDatastore(datastore.InMemory())
+	fs, err := cinodefs.New(ctx, be, cinodefs.NewRootDynamicLink())
+	require.NoError(t, err)
+
+	baseTime := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	for _, d := range []struct {
+		name    string
+		modTime time.Time
+		weight  int64
+	}{
+		{"a.txt", baseTime.Add(3 * time.Hour), 2},
+		{"b.txt", baseTime.Add(1 * time.Hour), 3},
+		{"c.txt", baseTime.Add(2 * time.Hour), 1},
+		{"d.txt", time.Time{}, 2},
+	} {
+		_, err = fs.SetEntryFile(ctx,
+			[]string{d.name},
+			strings.NewReader(d.name),
+			cinodefs.SetModTime(d.modTime),
+			cinodefs.SetSortWeight(d.weight),
+		)
+		require.NoError(t, err)
+	}
+	require.NoError(t, fs.Flush(ctx))
+
+	walk := func(t *testing.T, fs cinodefs.FS, opts ...cinodefs.ListOption) []cinodefs.WalkEntry {
+		ret := []cinodefs.WalkEntry{}
+		err := fs.Walk(ctx, []string{}, func(e cinodefs.WalkEntry) error {
+			ret = append(ret, e)
+			return nil
+		}, opts...)
+		require.NoError(t, err)
+		return ret
+	}
+
+	names := func(entries []cinodefs.WalkEntry) []string {
+		ret := []string{}
+		for _, e := range entries {
+			ret = append(ret, e.Name)
+		}
+		return ret
+	}
+
+	for _, d := range []struct {
+		name     string
+		opts     []cinodefs.ListOption
+		expected []string
+	}{
+		{"default", nil, []string{"a.txt", "b.txt", "c.txt", "d.txt"}},
+		{"name", []cinodefs.ListOption{cinodefs.ListOrder(cinodefs.OrderByName)}, []string{"a.txt", "b.txt", "c.txt", "d.txt"}},
+		{"mod time", []cinodefs.ListOption{cinodefs.ListOrder(cinodefs.OrderByModTime)}, []string{"d.txt", "b.txt", "c.txt", "a.txt"}},
+		{"sort weight", []cinodefs.ListOption{cinodefs.ListOrder(cinodefs.OrderBySortWeight)}, []string{"c.txt", "a.txt", "d.txt", "b.txt"}},
+		{"custom", []cinodefs.ListOption{cinodefs.ListOrder(func(a, b *cinodefs.WalkEntry) int {
+			return strings.Compare(b.Name, a.Name)
+		})}, []string{"d.txt", "c.txt", "b.txt", "a.txt"}},
+	} {
+		t.Run(d.name, func(t *testing.T) {
+			require.Equal(t, d.expected, names(walk(t, fs, d.opts...)))
+		})
+	}
+
+	t.Run("entry details are preserved", func(t *testing.T) {
+		wi, err := fs.RootWriterInfo(ctx)
+		require.NoError(t, err)
+
+		fs2, err := cinodefs.New(ctx, be, cinodefs.RootWriterInfo(wi))
+		require.NoError(t, err)
+
+		entries := walk(t, fs2)
+		require.True(t, baseTime.Add(3*time.Hour).Equal(entries[0].ModTime))
+		require.EqualValues(t, 2, entries[0].SortWeight)
+		require.True(t, entries[3].ModTime.IsZero())
+
+		ep, err := fs2.FindEntry(ctx, []string{"b.txt"})
+		require.NoError(t, err)
+		require.True(t, baseTime.Add(1*time.Hour).Equal(ep.ModTime()))
+		require.EqualValues(t, 3, ep.SortWeight())
+	})
+}
+
+func TestWalkStream(t *testing.T) {
+	ctx := context.Background()
+	fs, err := cinodefs.New(ctx,
+		blenc.FromDatastore(datastore.InMemory()),
+		cinodefs.NewRootDynamicLink(),
+	)
+	require.NoError(t, err)
+
+	for _, path := range []string{
+		"b.txt",
+		"a/z.txt",
+		"a/c/d.txt",
+		"link/x.txt",
+		"flink",
+	} {
+		_, err := fs.SetEntryFile(ctx, strings.Split(path, "/"), strings.NewReader(path))
+		require.NoError(t, err)
+	}
+	_, err = fs.InjectDynamicLink(ctx, []string{"link"})
+	require.NoError(t, err)
+	_, err = fs.InjectDynamicLink(ctx, []string{"flink"})
+	require.NoError(t, err)
+
+	collect := func(t *testing.T, root ...string) []string {
+		ret := []string{}
+		for entry, err := range fs.WalkStream(ctx, root) {
+			require.NoError(t, err)
+
+			kind := "file"
+			switch {
+			case entry.IsDir:
+				kind = "dir"
+			case entry.IsLink:
+				kind = "link"
+			}
+			require.Equal(t, entry.Name, entry.Path[len(entry.Path)-1])
+			ret = append(ret, strings.Join(entry.Path, "/")+" "+kind)
+		}
+		return ret
+	}
+
+	expected := []string{
+		"a dir",
+		"a/c dir",
+		"a/c/d.txt file",
+		"a/z.txt file",
+		"b.txt file",
+		"flink link",
+		"link link",
+		"link/x.txt file",
+	}
+
+	t.Run("unsaved dataset", func(t *testing.T) {
+		require.Equal(t, expected, collect(t))
+
+		for entry, err := range fs.WalkStream(ctx, []string{}) {
+			require.NoError(t, err)
+			if entry.IsDir {
+				require.Nil(t, entry.Entrypoint)
+			}
+		}
+	})
+
+	require.NoError(t, fs.Flush(ctx))
+
+	t.Run("flushed dataset", func(t *testing.T) {
+		require.Equal(t, expected, collect(t))
+
+		for entry, err := range fs.WalkStream(ctx, []string{}) {
+			require.NoError(t, err)
+			require.NotNil(t, entry.Entrypoint)
+			if !entry.IsLink && !entry.IsDir {
+				ep, err := fs.FindEntry(ctx, entry.Path)
+				require.NoError(t, err)
+				require.Equal(t, ep.String(), entry.Entrypoint.String())
+			}
+		}
+	})
+
+	t.Run("subdirectory", func(t *testing.T) {
+		require.Equal(t, []string{
+			"a/c dir",
+			"a/c/d.txt file",
+			"a/z.txt file",
+		}, collect(t, "a"))
+	})
+
+	t.Run("link cycle", func(t *testing.T) {
+		// Link inside a linked directory pointing back to the root link
+		rootLink, err := fs.RootEntrypoint()
+		require.NoError(t, err)
+
+		err = fs.SetEntry(ctx, []string{"link", "up"}, rootLink)
+		require.NoError(t, err)
+		require.NoError(t, fs.Flush(ctx))
+
+		require.Equal(t, []string{
+			"a dir",
+			"a/c dir",
+			"a/c/d.txt file",
+			"a/z.txt file",
+			"b.txt file",
+			"flink link",
+			"link link",
+			"link/up link",
+			"link/up/a dir",
+			"link/up/a/c dir",
+			"link/up/a/c/d.txt file",
+			"link/up/a/z.txt file",
+			"link/up/b.txt file",
+			"link/up/flink link",
+			"link/up/link link",
+			"link/x.txt file",
+		}, collect(t))
+	})
+
+	t.Run("not a directory", func(t *testing.T) {
+		count := 0
+		for _, err := range fs.WalkStream(ctx, []string{"b.txt"}) {
+			require.ErrorIs(t, err, cinodefs.ErrNotADirectory)
+			count++
+		}
+		require.Equal(t, 1, count)
+	})
+
+	t.Run("stop iteration", func(t *testing.T) {
+		count := 0
+		for range fs.WalkStream(ctx, []string{}) {
+			count++
+			if count == 3 {
+				break
+			}
+		}
+		require.Equal(t, 3, count)
+	})
+
+	t.Run("context cancellation", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		entries := 0
+		var errs []error
+		for _, err := range fs.WalkStream(ctx, []string{}) {
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			entries++
+			if entries == 2 {
+				cancel()
+			}
+		}
+		require.Equal(t, 2, entries)
+		require.Len(t, errs, 1)
+		require.ErrorIs(t, errs[0], context.Canceled)
+	})
+}
@@ -0,0 +1,198 @@
+/*
+Copyright © 2022 Bartłomiej Święcki (byo)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cinodefs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/cinode/go/pkg/common"
+	"github.com/cinode/go/pkg/datastore"
+)
+
+var (
+	ErrEntriesSkipped    = errors.New("unreadable entries skipped")
+	ErrInvalidWalkPolicy = errors.New("invalid walk policy")
+)
+
+type walkPolicyMode int
+
+const (
+	walkFailFast walkPolicyMode = iota
+	walkSkipAndReport
+	walkRetry
+)
+
+// WalkOption can be used to customize operations walking over the dataset
+// such as VerifyReachable, ReachableBlobs or ExportPublicBlobs
+type WalkOption interface {
+	applyWalk(o *walkOptions)
+}
+
+type walkOptions struct {
+	policy WalkPolicy
+}
+
+func walkOptionsFrom(opts []WalkOption) (walkOptions, error) {
+	o := walkOptions{}
+	for _, opt := range opts {
+		opt.applyWalk(&o)
+	}
+	if err := o.policy.validate(); err != nil {
+		return walkOptions{}, err
+	}
+	return o, nil
+}
+
+// WalkPolicy determines how the walk over the dataset handles entries that
+// can not be read. FailFast is used by default.
+type WalkPolicy struct {
+	mode    walkPolicyMode
+	retries int
+	backoff datastore.RetryPolicy
+}
+
+func (p WalkPolicy) applyWalk(o *walkOptions) { o.policy = p }
+
+func (p WalkPolicy) validate() error {
+	if p.retries < 0 {
+		return fmt.Errorf("%w: negative number of retries: %d", ErrInvalidWalkPolicy, p.retries)
+	}
+	return nil
+}
+
+// FailFast aborts the walk on the first unreadable entry
+func FailFast() WalkPolicy { return WalkPolicy{mode: walkFailFast} }
+
+// SkipAndReport continues the walk when an entry can not be read. The partial
+// result is returned together with a *SkippedEntriesError listing paths of
+// all skipped entries.
+func SkipAndReport() WalkPolicy { return WalkPolicy{mode: walkSkipAndReport} }
+
+// Retry retries reading an entry up to n times before aborting the walk.
+// Only transient errors are retried, i.e. a blob missing in the datastore
+// fails the walk immediately. Retries are delayed with the default
+// exponential backoff of datastore.RetryPolicy.
+func Retry(n int) WalkPolicy { return WalkPolicy{mode: walkRetry, retries: n} }
+
+// RetryWithBackoff is the same as Retry but delays between retries are
+// computed from given policy. Only backoff settings of the policy are used,
+// the number of retries is given by n.
+func RetryWithBackoff(n int, backoff datastore.RetryPolicy) WalkPolicy {
+	return WalkPolicy{mode: walkRetry, retries: n, backoff: backoff}
+}
+
+// SkippedEntry describes an entry that could not be read during the walk
+type SkippedEntry struct {
+	Path     string
+	BlobName *common.BlobName
+	Err      error
+}
+
+// SkippedEntriesError is returned by walks using SkipAndReport policy if any
+// entry was skipped
+type SkippedEntriesError struct {
+	Entries []SkippedEntry
+}
+
+func (e *SkippedEntriesError) Error() string {
+	msgs := make([]string, len(e.Entries))
+	for i, entry := range e.Entries {
+		msgs[i] = fmt.Sprintf("/%s (blob %s): %v", entry.Path, entry.BlobName, entry.Err)
+	}
+	return fmt.Sprintf("%v: %s", ErrEntriesSkipped, strings.Join(msgs, "; "))
+}
+
+func (e *SkippedEntriesError) Unwrap() []error {
+	ret := []error{ErrEntriesSkipped}
+	for _, entry := range e.Entries {
+		ret = append(ret, entry.Err)
+	}
+	return ret
+}
+
+// walkErrorHandler applies the walk policy to errors found while walking
+type walkErrorHandler struct {
+	policy  WalkPolicy
+	skipped []SkippedEntry
+}
+
+// do runs given function, retrying it if allowed by the policy, waiting
+// between retries is interrupted once the context is cancelled
+func (h *walkErrorHandler) do(ctx context.Context, f func() error) error {
+	err := f()
+	for retry := 1; err != nil && retry <= h.retries(); retry++ {
+		if !isTransientWalkError(ctx, err) {
+			break
+		}
+
+		timer := time.NewTimer(h.policy.backoff.Backoff(retry))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+
+		err = f()
+	}
+	return err
+}
+
+func (h *walkErrorHandler) retries() int {
+	if h.policy.mode != walkRetry {
+		return 0
+	}
+	return h.policy.retries
+}
+
+// handle decides whether the error aborts the walk, nil is returned
+// if the entry should be skipped
+func (h *walkErrorHandler) handle(path string, bn *common.BlobName, err error) error {
+	if h.policy.mode != walkSkipAndReport {
+		return err
+	}
+	h.skipped = append(h.skipped, SkippedEntry{
+		Path:     path,
+		BlobName: bn,
+		Err:      err,
+	})
+	return nil
+}
+
+// result returns the error reporting skipped entries, nil if none was skipped
+func (h *walkErrorHandler) result() error {
+	if len(h.skipped) == 0 {
+		return nil
+	}
+	return &SkippedEntriesError{Entries: h.skipped}
+}
+
+func isTransientWalkError(ctx context.Context, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	return !errors.Is(err, datastore.ErrNotFound) &&
+		!errors.Is(err, ErrTooManyRedirects) &&
+		!errors.Is(err, ErrNotADirectory) &&
+		!errors.Is(err, ErrEntryNotFound) &&
+		!errors.Is(err, context.Canceled) &&
+		!errors.Is(err, context.DeadlineExceeded)
+}
@@ -0,0 +1,286 @@
+/*
+Copyright © 2022 Bartłomiej Święcki (byo)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cinodefs_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cinode/go/pkg/blenc"
+	"github.com/cinode/go/pkg/cinodefs"
+	"github.com/cinode/go/pkg/common"
+	"github.com/cinode/go/pkg/datastore"
+	"github.com/stretchr/testify/require"
+)
+
+var errTransient = errors.New("transient error")
+
+// flakyDS fails opening selected blobs given number of times
+type flakyDS struct {
+	datastore.DS
+	m        sync.Mutex
+	failures map[string]int
+	opened   map[string]int
+}
+
+func (f *flakyDS) Open(ctx context.Context, name *common.BlobName) (io.ReadCloser, error) {
+	f.m.Lock()
+	f.opened[name.String()]++
+	if f.failures[name.String()] > 0 {
+		f.failures[name.String()]--
+		f.m.Unlock()
+		return nil, errTransient
+	}
+	f.m.Unlock()
+	return f.DS.Open(ctx, name)
+}
+
+func TestWalkPolicy(t *testing.T) {
+	ctx := context.Background()
+
+	type dataset struct {
+		ds     *flakyDS
+		be     blenc.BE
+		root   *cinodefs.Entrypoint
+		file   *cinodefs.Entrypoint
+		dir    *cinodefs.Entrypoint
+		others int
+	}
+
+	newDataset := func(t *testing.T) *dataset {
+		ds := &flakyDS{
+			DS:       datastore.InMemory(),
+			failures: map[string]int{},
+			opened:   map[string]int{},
+		}
+		be := blenc.FromDatastore(ds)
+		fs, err := cinodefs.New(ctx, be, cinodefs.NewRootStaticDirectory())
+		require.NoError(t, err)
+
+		for _, path := range []string{"a.txt", "dir/b.txt", "dir/sub/c.txt", "z.txt"} {
+			_, err := fs.SetEntryFile(ctx, strings.Split(path, "/"), strings.NewReader(path))
+			require.NoError(t, err)
+		}
+		require.NoError(t, fs.Flush(ctx))
+
+		root, err := fs.RootEntrypoint()
+		require.NoError(t, err)
+		file, err := fs.FindEntry(ctx, []string{"dir", "b.txt"})
+		require.NoError(t, err)
+		dir, err := fs.FindEntry(ctx, []string{"dir", "sub"})
+		require.NoError(t, err)
+
+		return &dataset{ds: ds, be: be, root: root, file: file, dir: dir}
+	}
+
+	t.Run("invalid policy", func(t *testing.T) {
+		d := newDataset(t)
+
+		err := cinodefs.VerifyReachable(ctx, d.be, d.root, 10, cinodefs.Retry(-1))
+		require.ErrorIs(t, err, cinodefs.ErrInvalidWalkPolicy)
+
+		_, err = cinodefs.ReachableBlobs(ctx, d.be, d.root, 10, cinodefs.Retry(-1))
+		require.ErrorIs(t, err, cinodefs.ErrInvalidWalkPolicy)
+
+		_, err = cinodefs.ExportPublicBlobs(ctx, d.ds, datastore.InMemory(), d.root, 10, cinodefs.Retry(-1))
+		require.ErrorIs(t, err, cinodefs.ErrInvalidWalkPolicy)
+	})
+
+	t.Run("fail fast", func(t *testing.T) {
+		for _, policy := range [][]cinodefs.WalkOption{
+			nil,
+			{cinodefs.FailFast()},
+		} {
+			d := newDataset(t)
+			require.NoError(t, d.ds.Delete(ctx, d.file.BlobName()))
+
+			err := cinodefs.VerifyReachable(ctx, d.be, d.root, 10, policy...)
+			require.ErrorIs(t, err, cinodefs.ErrVerificationFailed)
+			require.ErrorIs(t, err, datastore.ErrNotFound)
+			require.NotErrorIs(t, err, cinodefs.ErrEntriesSkipped)
+
+			require.NoError(t, d.ds.Delete(ctx, d.dir.BlobName()))
+
+			blobs, err := cinodefs.ReachableBlobs(ctx, d.be, d.root, 10, policy...)
+			require.ErrorIs(t, err, datastore.ErrNotFound)
+			require.Nil(t, blobs)
+
+			dst := datastore.InMemory()
+			_, err = cinodefs.ExportPublicBlobs(ctx, d.ds, dst, d.root, 10, policy...)
+			require.ErrorIs(t, err, datastore.ErrNotFound)
+		}
+	})
+
+	t.Run("skip and report", func(t *testing.T) {
+		d := newDataset(t)
+		require.NoError(t, d.ds.Delete(ctx, d.file.BlobName()))
+
+		err := cinodefs.VerifyReachable(ctx, d.be, d.root, 10, cinodefs.SkipAndReport())
+		require.ErrorIs(t, err, cinodefs.ErrEntriesSkipped)
+		require.ErrorIs(t, err, datastore.ErrNotFound)
+
+		var skipped *cinodefs.SkippedEntriesError
+		require.ErrorAs(t, err, &skipped)
+		require.Len(t, skipped.Entries, 1)
+		require.Equal(t, "dir/b.txt", skipped.Entries[0].Path)
+		require.Equal(t, d.file.BlobName(), skipped.Entries[0].BlobName)
+		require.Contains(t, err.Error(), "/dir/b.txt")
+
+		// File blobs are not read while looking for reachable blobs
+		allBlobs, err := cinodefs.ReachableBlobs(ctx, d.be, d.root, 10, cinodefs.SkipAndReport())
+		require.NoError(t, err)
+		require.Len(t, allBlobs, 7)
+
+		// Missing file blob can not be exported, all other blobs are copied
+		dst := datastore.InMemory()
+		exported, err := cinodefs.ExportPublicBlobs(ctx, d.ds, dst, d.root, 10, cinodefs.SkipAndReport())
+		require.ErrorAs(t, err, &skipped)
+		require.Len(t, skipped.Entries, 1)
+		require.Equal(t, "dir/b.txt", skipped.Entries[0].Path)
+		require.Equal(t, 6, exported)
+
+		// Broken directory hides its entries
+		require.NoError(t, d.ds.Delete(ctx, d.dir.BlobName()))
+
+		blobs, err := cinodefs.ReachableBlobs(ctx, d.be, d.root, 10, cinodefs.SkipAndReport())
+		require.ErrorAs(t, err, &skipped)
+		require.Len(t, skipped.Entries, 1)
+		require.Equal(t, "dir/sub", skipped.Entries[0].Path)
+		require.Len(t, blobs, 6)
+
+		err = cinodefs.VerifyReachable(ctx, d.be, d.root, 10, cinodefs.SkipAndReport())
+		require.ErrorAs(t, err, &skipped)
+		require.Len(t, skipped.Entries, 2)
+		require.Equal(t, "dir/b.txt", skipped.Entries[0].Path)
+		require.Equal(t, "dir/sub", skipped.Entries[1].Path)
+	})
+
+	t.Run("retry", func(t *testing.T) {
+		d := newDataset(t)
+
+		// Transient errors are retried
+		d.ds.failures[d.file.BlobName().String()] = 2
+		d.ds.failures[d.dir.BlobName().String()] = 2
+		d.ds.opened = map[string]int{}
+		err := cinodefs.VerifyReachable(ctx, d.be, d.root, 10, cinodefs.Retry(2))
+		require.NoError(t, err)
+		require.Equal(t, 3, d.ds.opened[d.file.BlobName().String()])
+		require.Equal(t, 3, d.ds.opened[d.dir.BlobName().String()])
+
+		// Too many transient errors
+		d.ds.failures[d.file.BlobName().String()] = 3
+		err = cinodefs.VerifyReachable(ctx, d.be, d.root, 10, cinodefs.Retry(2))
+		require.ErrorIs(t, err, errTransient)
+
+		d.ds.failures[d.dir.BlobName().String()] = 1
+		_, err = cinodefs.ReachableBlobs(ctx, d.be, d.root, 10, cinodefs.FailFast())
+		require.ErrorIs(t, err, errTransient)
+
+		d.ds.failures[d.dir.BlobName().String()] = 1
+		_, err = cinodefs.ReachableBlobs(ctx, d.be, d.root, 10, cinodefs.Retry(1))
+		require.NoError(t, err)
+
+		d.ds.failures[d.file.BlobName().String()] = 1
+		exported, err := cinodefs.ExportPublicBlobs(ctx, d.ds, datastore.InMemory(), d.root, 10, cinodefs.Retry(1))
+		require.NoError(t, err)
+		require.Equal(t, 7, exported)
+
+		// Missing blob is not retried
+		require.NoError(t, d.ds.Delete(ctx, d.file.BlobName()))
+		d.ds.opened = map[string]int{}
+		err = cinodefs.VerifyReachable(ctx, d.be, d.root, 10, cinodefs.Retry(5))
+		require.ErrorIs(t, err, datastore.ErrNotFound)
+		require.Equal(t, 1, d.ds.opened[d.file.BlobName().String()])
+	})
+
+	t.Run("retry backoff", func(t *testing.T) {
+		d := newDataset(t)
+
+		d.ds.failures[d.dir.BlobName().String()] = 2
+		start := time.Now()
+		_, err := cinodefs.ReachableBlobs(ctx, d.be, d.root, 10, cinodefs.RetryWithBackoff(2, datastore.RetryPolicy{
+			InitialBackoff: 20 * time.Millisecond,
+			Multiplier:     2,
+		}))
+		require.NoError(t, err)
+		require.GreaterOrEqual(t, time.Since(start), 60*time.Millisecond)
+
+		// Waiting is interrupted by the context
+		d.ds.failures[d.dir.BlobName().String()] = 1
+		ctx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+		defer cancel()
+		_, err = cinodefs.ReachableBlobs(ctx, d.be, d.root, 10, cinodefs.RetryWithBackoff(1, datastore.RetryPolicy{
+			InitialBackoff: time.Hour,
+		}))
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+	})
+
+	t.Run("walk", func(t *testing.T) {
+		collect := func(t *testing.T, d *dataset, opts ...cinodefs.ListOption) ([]string, error) {
+			fs, err := cinodefs.New(ctx, d.be, cinodefs.RootEntrypoint(d.root))
+			require.NoError(t, err)
+
+			paths := []string{}
+			err = fs.Walk(ctx, []string{}, func(e cinodefs.WalkEntry) error {
+				paths = append(paths, strings.Join(e.Path, "/"))
+				return nil
+			}, opts...)
+			return paths, err
+		}
+		quickRetry := func(n int) cinodefs.ListOption {
+			return cinodefs.ListWalkPolicy(cinodefs.RetryWithBackoff(n, datastore.RetryPolicy{
+				InitialBackoff: time.Millisecond,
+			}))
+		}
+
+		d := newDataset(t)
+
+		_, err := collect(t, d, cinodefs.ListWalkPolicy(cinodefs.Retry(-1)))
+		require.ErrorIs(t, err, cinodefs.ErrInvalidWalkPolicy)
+
+		d.ds.failures[d.dir.BlobName().String()] = 1
+		_, err = collect(t, d)
+		require.ErrorIs(t, err, errTransient)
+
+		d.ds.failures[d.dir.BlobName().String()] = 2
+		d.ds.opened = map[string]int{}
+		paths, err := collect(t, d, quickRetry(2))
+		require.NoError(t, err)
+		require.Equal(t, []string{"a.txt", "dir", "dir/b.txt", "dir/sub", "dir/sub/c.txt", "z.txt"}, paths)
+		require.Equal(t, 3, d.ds.opened[d.dir.BlobName().String()])
+
+		// Missing blob is not retried
+		require.NoError(t, d.ds.Delete(ctx, d.dir.BlobName()))
+		d.ds.opened = map[string]int{}
+		_, err = collect(t, d, quickRetry(5))
+		require.ErrorIs(t, err, datastore.ErrNotFound)
+		require.Equal(t, 1, d.ds.opened[d.dir.BlobName().String()])
+
+		paths, err = collect(t, d, cinodefs.ListWalkPolicy(cinodefs.SkipAndReport()))
+		var skipped *cinodefs.SkippedEntriesError
+		require.ErrorAs(t, err, &skipped)
+		require.Len(t, skipped.Entries, 1)
+		require.Equal(t, "dir/sub", skipped.Entries[0].Path)
+		require.Equal(t, d.dir.BlobName(), skipped.Entries[0].BlobName)
+		require.Equal(t, []string{"a.txt", "dir", "dir/b.txt", "dir/sub", "z.txt"}, paths)
+	})
+}
@@ -0,0 +1,288 @@
+/*
+Copyright © 2023 Bartłomiej Święcki (byo)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package webdav exposes the cinodefs filesystem through a read-only subset
+// of the WebDAV protocol so that the published tree can be mounted as
+// a network drive
+package webdav
+
+import (
+	"encoding/xml"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/cinode/go/pkg/cinodefs"
+	"github.com/cinode/go/pkg/cinodefs/httphandler"
+	"golang.org/x/exp/slog"
+)
+
+const (
+	// Methods supported by the read-only handler
+	allowedMethods = "OPTIONS, GET, HEAD, PROPFIND"
+
+	// Maximum number of entries in a single PROPFIND response, listing
+	// of larger directories is rejected
+	maxPropfindEntries = 10000
+)
+
+// Handler returns the http handler serving given filesystem with the
+// read-only WebDAV protocol. PROPFIND requests describe directories using the
+// listing API, GET and HEAD requests for files are served by the httphandler.
+// Methods modifying the content are rejected.
+//
+// Returned hrefs are based on the request path thus the handler must not be
+// mounted with a stripped path prefix.
+func Handler(fs cinodefs.FS) http.Handler {
+	return &handler{
+		fs: fs,
+		files: &httphandler.Handler{
+			FS:  fs,
+			Log: slog.Default(),
+		},
+		log:        slog.Default(),
+		maxEntries: maxPropfindEntries,
+	}
+}
+
+type handler struct {
+	fs         cinodefs.FS
+	files      http.Handler
+	log        *slog.Logger
+	maxEntries int
+}
+
+func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodOptions:
+		w.Header().Set("DAV", "1")
+		w.Header().Set("Allow", allowedMethods)
+		w.Header().Set("MS-Author-Via", "DAV")
+		w.WriteHeader(http.StatusOK)
+
+	case http.MethodGet, http.MethodHead:
+		h.files.ServeHTTP(w, r)
+
+	case "PROPFIND":
+		h.servePropfind(w, r)
+
+	default:
+		// The filesystem is read-only
+		w.Header().Set("Allow", allowedMethods)
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// pathFromURL converts the WebDAV resource path to the cinodefs path
+func pathFromURL(urlPath string) []string {
+	ret := []string{}
+	for _, segment := range strings.Split(urlPath, "/") {
+		if segment != "" {
+			ret = append(ret, segment)
+		}
+	}
+	return ret
+}
+
+// hrefFromPath converts the cinodefs path to the escaped WebDAV href,
+// collections end with a slash
+func hrefFromPath(p []string, isCollection bool) string {
+	escaped := make([]string, len(p))
+	for i, segment := range p {
+		escaped[i] = url.PathEscape(segment)
+	}
+
+	href := "/" + strings.Join(escaped, "/")
+	if isCollection && len(p) > 0 {
+		href += "/"
+	}
+	return href
+}
+
+type multistatus struct {
+	XMLName   xml.Name   `xml:"D:multistatus"`
+	XMLNS     string     `xml:"xmlns:D,attr"`
+	Responses []response `xml:"D:response"`
+}
+
+type response struct {
+	Href     string   `xml:"D:href"`
+	Propstat propstat `xml:"D:propstat"`
+}
+
+type propstat struct {
+	Prop   prop   `xml:"D:prop"`
+	Status string `xml:"D:status"`
+}
+
+type prop struct {
+	DisplayName      string       `xml:"D:displayname"`
+	ResourceType     resourceType `xml:"D:resourcetype"`
+	GetContentType   string       `xml:"D:getcontenttype,omitempty"`
+	GetContentLength string       `xml:"D:getcontentlength,omitempty"`
+	GetLastModified  string       `xml:"D:getlastmodified,omitempty"`
+	SupportedLock    *struct{}    `xml:"D:supportedlock"`
+}
+
+type resourceType struct {
+	Collection *struct{} `xml:"D:collection"`
+}
+
+type propfindError struct {
+	XMLName             xml.Name  `xml:"D:error"`
+	XMLNS               string    `xml:"xmlns:D,attr"`
+	PropfindFiniteDepth *struct{} `xml:"D:propfind-finite-depth"`
+}
+
+// servePropfind describes the resource and, with the `Depth: 1` header, its
+// direct children. Requested properties are ignored, all supported
+// properties are always returned.
+func (h *handler) servePropfind(w http.ResponseWriter, r *http.Request) {
+	log := h.log.With(
+		slog.String("URL", r.URL.String()),
+		slog.String("Method", r.Method),
+	)
+
+	depth := r.Header.Get("Depth")
+	switch depth {
+	case "0", "1":
+	case "":
+		// Infinite depth is the default, most clients set the depth
+		// explicitly though thus be lenient and list direct children only
+		depth = "1"
+	default:
+		log.Warn("Unsupported PROPFIND depth", "depth", depth)
+		w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+		w.WriteHeader(http.StatusForbidden)
+		writeXML(w, &propfindError{
+			XMLNS:               "DAV:",
+			PropfindFiniteDepth: &struct{}{},
+		}, log)
+		return
+	}
+
+	p := pathFromURL(r.URL.Path)
+	self, err := h.describe(r, p)
+	if errors.Is(err, cinodefs.ErrEntryNotFound) || errors.Is(err, cinodefs.ErrNotADirectory) {
+		log.Warn("Not found")
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		log.Error("Error finding entry", "err", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	ms := multistatus{XMLNS: "DAV:", Responses: []response{*self}}
+
+	if depth == "1" && self.Propstat.Prop.ResourceType.Collection != nil {
+		entries, err := h.fs.ListDir(r.Context(), p)
+		if err != nil {
+			log.Error("Error listing directory", "err", err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		if len(entries) > h.maxEntries {
+			// Truncated listing would look like a complete one to the client
+			log.Warn("Directory too large to list", "entries", len(entries), "limit", h.maxEntries)
+			http.Error(w, http.StatusText(http.StatusInsufficientStorage), http.StatusInsufficientStorage)
+			return
+		}
+
+		for _, entry := range entries {
+			child, err := h.describe(r, append(p[:len(p):len(p)], entry.Name))
+			if err != nil {
+				// Unreadable entries, e.g. links to unavailable content,
+				// are not listed instead of failing the whole listing
+				log.Warn("Skipping unreadable entry", "name", entry.Name, "err", err)
+				continue
+			}
+			ms.Responses = append(ms.Responses, *child)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	w.WriteHeader(http.StatusMultiStatus)
+	writeXML(w, &ms, log)
+}
+
+// describe builds the PROPFIND response for the entry at given path, links
+// are followed so that the target of the link is described
+func (h *handler) describe(r *http.Request, p []string) (*response, error) {
+	name := "/"
+	if len(p) > 0 {
+		name = p[len(p)-1]
+	}
+
+	ep, err := h.fs.FindEntry(r.Context(), p)
+	if errors.Is(err, cinodefs.ErrModifiedDirectory) {
+		// Directory with unsaved changes, only known to be a collection
+		return &response{
+			Href: hrefFromPath(p, true),
+			Propstat: propstat{
+				Prop: prop{
+					DisplayName:   name,
+					ResourceType:  resourceType{Collection: &struct{}{}},
+					SupportedLock: &struct{}{},
+				},
+				Status: "HTTP/1.1 200 OK",
+			},
+		}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	ret := &response{
+		Href: hrefFromPath(p, ep.IsDir()),
+		Propstat: propstat{
+			Prop: prop{
+				DisplayName:   name,
+				SupportedLock: &struct{}{},
+			},
+			Status: "HTTP/1.1 200 OK",
+		},
+	}
+
+	if modTime := ep.ModTime(); !modTime.IsZero() {
+		ret.Propstat.Prop.GetLastModified = modTime.UTC().Format(http.TimeFormat)
+	}
+
+	if ep.IsDir() {
+		ret.Propstat.Prop.ResourceType.Collection = &struct{}{}
+		return ret, nil
+	}
+
+	ret.Propstat.Prop.GetContentType = ep.MimeType()
+	if l := ep.ContentLength(); l > 0 {
+		ret.Propstat.Prop.GetContentLength = strconv.FormatInt(l, 10)
+	}
+	return ret, nil
+}
+
+func writeXML(w http.ResponseWriter, v any, log *slog.Logger) {
+	_, err := w.Write([]byte(xml.Header))
+	if err == nil {
+		err = xml.NewEncoder(w).Encode(v)
+	}
+	if err != nil {
+		// Too late to send the error response
+		log.Error("Error sending response", "err", err)
+	}
+}
@@ -0,0 +1,216 @@
+/*
+Copyright © 2023 Bartłomiej Święcki (byo)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webdav
+
+import (
+	"context"
+	"encoding/xml"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/cinode/go/pkg/blenc"
+	"github.com/cinode/go/pkg/cinodefs"
+	"github.com/cinode/go/pkg/datastore"
+	"github.com/stretchr/testify/require"
+)
+
+type testMultistatus struct {
+	Responses []struct {
+		Href string `xml:"href"`
+		Prop struct {
+			DisplayName  string `xml:"displayname"`
+			ResourceType struct {
+				Collection *struct{} `xml:"collection"`
+			} `xml:"resourcetype"`
+			GetContentType   string `xml:"getcontenttype"`
+			GetContentLength string `xml:"getcontentlength"`
+		} `xml:"propstat>prop"`
+		Status string `xml:"propstat>status"`
+	} `xml:"response"`
+}
+
+func testHandler(t *testing.T) *handler {
+	ctx := context.Background()
+	fs, err := cinodefs.New(
+		ctx,
+		blenc.FromDatastore(datastore.InMemory()),
+		cinodefs.NewRootStaticDirectory(),
+	)
+	require.NoError(t, err)
+
+	for _, f := range []struct {
+		path    []string
+		content string
+	}{
+		{[]string{"index.html"}, "<html></html>"},
+		{[]string{"sub dir", "file.txt"}, "Hello world"},
+	} {
+		_, err := fs.SetEntryFile(ctx, f.path, strings.NewReader(f.content))
+		require.NoError(t, err)
+	}
+	require.NoError(t, fs.Flush(ctx))
+
+	return Handler(fs).(*handler)
+}
+
+func testServer(t *testing.T) *httptest.Server {
+	server := httptest.NewServer(testHandler(t))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func doRequest(t *testing.T, method, url string, headers map[string]string) (*http.Response, []byte) {
+	req, err := http.NewRequest(method, url, nil)
+	require.NoError(t, err)
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	return resp, body
+}
+
+func propfind(t *testing.T, url, depth string) *testMultistatus {
+	resp, body := doRequest(t, "PROPFIND", url, map[string]string{"Depth": depth})
+	require.Equal(t, http.StatusMultiStatus, resp.StatusCode)
+
+	ms := &testMultistatus{}
+	require.NoError(t, xml.Unmarshal(body, ms))
+	for _, r := range ms.Responses {
+		require.Equal(t, "HTTP/1.1 200 OK", r.Status)
+	}
+	return ms
+}
+
+func TestPropfind(t *testing.T) {
+	server := testServer(t)
+
+	t.Run("root with depth 0", func(t *testing.T) {
+		ms := propfind(t, server.URL+"/", "0")
+		require.Len(t, ms.Responses, 1)
+		require.Equal(t, "/", ms.Responses[0].Href)
+		require.NotNil(t, ms.Responses[0].Prop.ResourceType.Collection)
+	})
+
+	t.Run("root with depth 1", func(t *testing.T) {
+		ms := propfind(t, server.URL+"/", "1")
+		require.Len(t, ms.Responses, 3)
+
+		found := map[string]bool{}
+		for _, r := range ms.Responses[1:] {
+			found[r.Href] = r.Prop.ResourceType.Collection != nil
+		}
+		require.Equal(t, map[string]bool{
+			"/index.html": false,
+			"/sub%20dir/": true,
+		}, found)
+	})
+
+	t.Run("default depth", func(t *testing.T) {
+		ms := propfind(t, server.URL+"/sub%20dir", "")
+		require.Len(t, ms.Responses, 2)
+		require.Equal(t, "/sub%20dir/", ms.Responses[0].Href)
+		require.Equal(t, "sub dir", ms.Responses[0].Prop.DisplayName)
+
+		file := ms.Responses[1]
+		require.Equal(t, "/sub%20dir/file.txt", file.Href)
+		require.Equal(t, "file.txt", file.Prop.DisplayName)
+		require.Nil(t, file.Prop.ResourceType.Collection)
+		require.Equal(t, "11", file.Prop.GetContentLength)
+		require.Contains(t, file.Prop.GetContentType, "text/plain")
+	})
+
+	t.Run("file", func(t *testing.T) {
+		ms := propfind(t, server.URL+"/index.html", "1")
+		require.Len(t, ms.Responses, 1)
+		require.Equal(t, "/index.html", ms.Responses[0].Href)
+		require.Contains(t, ms.Responses[0].Prop.GetContentType, "text/html")
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		resp, _ := doRequest(t, "PROPFIND", server.URL+"/missing", map[string]string{"Depth": "0"})
+		require.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+		resp, _ = doRequest(t, "PROPFIND", server.URL+"/index.html/sub", map[string]string{"Depth": "0"})
+		require.Equal(t, http.StatusNotFound, resp.StatusCode)
+	})
+
+	t.Run("directory too large", func(t *testing.T) {
+		h := testHandler(t)
+		h.maxEntries = 1
+		server := httptest.NewServer(h)
+		t.Cleanup(server.Close)
+
+		resp, _ := doRequest(t, "PROPFIND", server.URL+"/", map[string]string{"Depth": "1"})
+		require.Equal(t, http.StatusInsufficientStorage, resp.StatusCode)
+
+		// Directory itself can still be described
+		ms := propfind(t, server.URL+"/", "0")
+		require.Len(t, ms.Responses, 1)
+
+		h.maxEntries = 2
+		ms = propfind(t, server.URL+"/", "1")
+		require.Len(t, ms.Responses, 3)
+	})
+
+	t.Run("infinite depth", func(t *testing.T) {
+		resp, body := doRequest(t, "PROPFIND", server.URL+"/", map[string]string{"Depth": "infinity"})
+		require.Equal(t, http.StatusForbidden, resp.StatusCode)
+		require.Contains(t, string(body), "propfind-finite-depth")
+	})
+}
+
+func TestMethods(t *testing.T) {
+	server := testServer(t)
+
+	t.Run("options", func(t *testing.T) {
+		resp, _ := doRequest(t, http.MethodOptions, server.URL+"/", nil)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		require.Equal(t, "1", resp.Header.Get("DAV"))
+		require.Contains(t, resp.Header.Get("Allow"), "PROPFIND")
+	})
+
+	t.Run("get", func(t *testing.T) {
+		resp, body := doRequest(t, http.MethodGet, server.URL+"/sub%20dir/file.txt", nil)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		require.Equal(t, "Hello world", string(body))
+	})
+
+	for _, method := range []string{
+		http.MethodPut,
+		http.MethodDelete,
+		"MKCOL",
+		"MOVE",
+		"COPY",
+		"PROPPATCH",
+		"LOCK",
+	} {
+		t.Run(method, func(t *testing.T) {
+			resp, _ := doRequest(t, method, server.URL+"/index.html", nil)
+			require.Equal(t, http.StatusMethodNotAllowed, resp.StatusCode)
+			require.Contains(t, resp.Header.Get("Allow"), "PROPFIND")
+		})
+	}
+}
@@ -23,7 +23,6 @@ import (
 	"github.com/cinode/go/pkg/cinodefs/protobuf"
 	"github.com/cinode/go/pkg/common"
 	"github.com/cinode/go/pkg/utilities/golang"
-	"github.com/jbenet/go-base58"
 	"google.golang.org/protobuf/proto"
 )
 
@@ -37,24 +36,15 @@ type WriterInfo struct {
 }
 
 func (wi *WriterInfo) Bytes() []byte {
-	return golang.Must(proto.Marshal(&wi.wi))
+	return golang.Must(marshalOptions.Marshal(&wi.wi))
 }
 
 func (wi *WriterInfo) String() string {
-	return base58.Encode(wi.Bytes())
+	return DefaultEncoding.WriterInfoString(wi)
 }
 
 func WriterInfoFromString(s string) (*WriterInfo, error) {
-	if len(s) == 0 {
-		return nil, fmt.Errorf("%w: empty string", ErrInvalidWriterInfoData)
-	}
-
-	b := base58.Decode(s)
-	if len(b) == 0 {
-		return nil, fmt.Errorf("%w: not a base58 string", ErrInvalidWriterInfoData)
-	}
-
-	return WriterInfoFromBytes(b)
+	return DefaultEncoding.WriterInfoFromString(s)
 }
 
 func WriterInfoFromBytes(b []byte) (*WriterInfo, error) {
@@ -0,0 +1,166 @@
+/*
+Copyright © 2023 Bartłomiej Święcki (byo)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cinodefs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/cinode/go/pkg/common"
+	"github.com/cinode/go/pkg/internal/blobtypes/dynamiclink"
+)
+
+var (
+	ErrWriterInfoInUse    = errors.New("writer info is needed to save unsaved changes")
+	ErrWriterInfoMismatch = fmt.Errorf("%w: auth info does not match the link", ErrInvalidWriterInfoData)
+)
+
+// PathWriterInfo is the writer info of the dynamic link at given path
+type PathWriterInfo struct {
+	Path       []string
+	WriterInfo *WriterInfo
+}
+
+// ListWriterInfos returns writer infos of all dynamic links in the filesystem
+// that can be written to, including the root link. The whole tree is walked,
+// a link reachable through multiple paths is reported for each of them.
+func (fs *cinodeFS) ListWriterInfos(ctx context.Context) ([]PathWriterInfo, error) {
+	fs.lock.Lock()
+	hasAuthInfos := len(fs.c.authInfos) > 0
+	fs.lock.Unlock()
+
+	ret := []PathWriterInfo{}
+	if !hasAuthInfos {
+		return ret, nil
+	}
+
+	add := func(path []string, ep *Entrypoint) error {
+		wi, err := fs.EntrypointWriterInfo(ctx, ep)
+		if errors.Is(err, ErrMissingWriterInfo) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		ret = append(ret, PathWriterInfo{Path: path, WriterInfo: wi})
+		return nil
+	}
+
+	rootEP, err := fs.RootEntrypoint()
+	if err == nil && rootEP.IsLink() {
+		err = add([]string{}, rootEP)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for entry, err := range fs.WalkStream(ctx, []string{}) {
+		if err != nil {
+			return nil, err
+		}
+		if !entry.IsLink {
+			continue
+		}
+		err = add(entry.Path, entry.Entrypoint)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return ret, nil
+}
+
+// ForgetWriterInfo removes the writer info of the dynamic link at given path
+// from the memory, further modifications of the content behind the link fail
+// with ErrMissingWriterInfo. Writer infos are kept per link thus the link
+// becomes read-only under all paths it is reachable through.
+//
+// ErrWriterInfoInUse is returned if there are unsaved changes behind the link,
+// those must be flushed first.
+func (fs *cinodeFS) ForgetWriterInfo(ctx context.Context, path []string) error {
+	path, err := validatePath(path)
+	if err != nil {
+		return err
+	}
+
+	return fs.withLock(ctx, func(ctx context.Context) error {
+		n := fs.rootEP
+		if len(path) > 0 {
+			n, err = fs.findEntryNodeLocked(ctx, path, false)
+			if err != nil {
+				return err
+			}
+		}
+
+		if n.dirty() != dsClean {
+			return ErrWriterInfoInUse
+		}
+
+		ep, err := n.entrypoint()
+		if err != nil {
+			return err
+		}
+		if !ep.IsLink() {
+			return ErrNotALink
+		}
+
+		bn := ep.BlobName().String()
+		if _, found := fs.c.authInfos[bn]; !found {
+			return ErrMissingWriterInfo
+		}
+		delete(fs.c.authInfos, bn)
+		return nil
+	})
+}
+
+// AddWriterInfo registers the writer info of a dynamic link in a running
+// filesystem. Once added, content behind the link can be modified under all
+// paths the link is reachable through.
+//
+// The auth info is validated against the blob name and the key of the link,
+// ErrWriterInfoMismatch is returned if it can not be used to update the link.
+func (fs *cinodeFS) AddWriterInfo(wi *WriterInfo) error {
+	if wi == nil {
+		return fmt.Errorf("%w: nil", ErrInvalidWriterInfoData)
+	}
+
+	bn, err := common.BlobNameFromBytes(wi.wi.BlobName)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidWriterInfoData, err)
+	}
+	key := common.BlobKeyFromBytes(wi.wi.Key)
+	if !EntrypointFromBlobNameAndKey(bn, key).IsLink() {
+		return fmt.Errorf("%w: %w", ErrInvalidWriterInfoData, ErrNotALink)
+	}
+
+	authInfo := common.AuthInfoFromBytes(wi.wi.AuthInfo)
+	publisher, err := dynamiclink.FromAuthInfo(authInfo)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidWriterInfoData, err)
+	}
+	if !publisher.BlobName().Equal(bn) ||
+		!publisher.EncryptionKey().Equal(key) {
+		return ErrWriterInfoMismatch
+	}
+
+	fs.lock.Lock()
+	defer fs.lock.Unlock()
+
+	fs.c.authInfos[bn.String()] = authInfo
+	return nil
+}
@@ -0,0 +1,334 @@
+/*
+Copyright © 2023 Bartłomiej Święcki (byo)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cinodefs_test
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/cinode/go/pkg/blenc"
+	"github.com/cinode/go/pkg/cinodefs"
+	"github.com/cinode/go/pkg/cinodefs/protobuf"
+	"github.com/cinode/go/pkg/datastore"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestWriterInfoTracking(t *testing.T) {
+	ctx := context.Background()
+
+	newFS := func(t *testing.T) cinodefs.FS {
+		fs, err := cinodefs.New(ctx,
+			blenc.FromDatastore(datastore.InMemory()),
+			cinodefs.NewRootDynamicLink(),
+		)
+		require.NoError(t, err)
+
+		for _, p := range [][]string{
+			{"tenant1", "file.txt"},
+			{"tenant2", "sub", "file.txt"},
+			{"shared", "file.txt"},
+		} {
+			_, err = fs.SetEntryFile(ctx, p, strings.NewReader("data"))
+			require.NoError(t, err)
+		}
+
+		_, err = fs.InjectDynamicLink(ctx, []string{"tenant1"})
+		require.NoError(t, err)
+		_, err = fs.InjectDynamicLink(ctx, []string{"tenant2", "sub"})
+		require.NoError(t, err)
+		require.NoError(t, fs.Flush(ctx))
+		return fs
+	}
+
+	paths := func(wis []cinodefs.PathWriterInfo) []string {
+		ret := []string{}
+		for _, wi := range wis {
+			ret = append(ret, "/"+strings.Join(wi.Path, "/"))
+		}
+		return ret
+	}
+
+	t.Run("list writer infos", func(t *testing.T) {
+		fs := newFS(t)
+
+		wis, err := fs.ListWriterInfos(ctx)
+		require.NoError(t, err)
+		require.Equal(t, []string{"/", "/tenant1", "/tenant2/sub"}, paths(wis))
+
+		rootWI, err := fs.RootWriterInfo(ctx)
+		require.NoError(t, err)
+		require.Equal(t, rootWI.String(), wis[0].WriterInfo.String())
+
+		ep, err := fs.FindEntry(ctx, []string{"tenant1"})
+		require.NoError(t, err)
+		require.True(t, ep.IsDir())
+	})
+
+	t.Run("read-only filesystem", func(t *testing.T) {
+		fs := newFS(t)
+		rootEP, err := fs.RootEntrypoint()
+		require.NoError(t, err)
+
+		ro, err := cinodefs.New(ctx,
+			blenc.FromDatastore(datastore.InMemory()),
+			cinodefs.RootEntrypoint(rootEP),
+		)
+		require.NoError(t, err)
+
+		wis, err := ro.ListWriterInfos(ctx)
+		require.NoError(t, err)
+		require.Empty(t, wis)
+	})
+
+	t.Run("forget writer info", func(t *testing.T) {
+		fs := newFS(t)
+
+		err := fs.ForgetWriterInfo(ctx, []string{"tenant1"})
+		require.NoError(t, err)
+
+		_, err = fs.SetEntryFile(ctx, []string{"tenant1", "new.txt"}, strings.NewReader("new"))
+		require.ErrorIs(t, err, cinodefs.ErrMissingWriterInfo)
+
+		// Other links and directories are still writable
+		_, err = fs.SetEntryFile(ctx, []string{"tenant2", "sub", "new.txt"}, strings.NewReader("new"))
+		require.NoError(t, err)
+		_, err = fs.SetEntryFile(ctx, []string{"shared", "new.txt"}, strings.NewReader("new"))
+		require.NoError(t, err)
+		require.NoError(t, fs.Flush(ctx))
+
+		wis, err := fs.ListWriterInfos(ctx)
+		require.NoError(t, err)
+		require.Equal(t, []string{"/", "/tenant2/sub"}, paths(wis))
+
+		// Content is still readable
+		require.Equal(t, "data", readFile(t, fs, []string{"tenant1", "file.txt"}))
+
+		err = fs.ForgetWriterInfo(ctx, []string{"tenant1"})
+		require.ErrorIs(t, err, cinodefs.ErrMissingWriterInfo)
+	})
+
+	t.Run("forget root writer info", func(t *testing.T) {
+		fs := newFS(t)
+
+		err := fs.ForgetWriterInfo(ctx, []string{})
+		require.NoError(t, err)
+
+		_, err = fs.SetEntryFile(ctx, []string{"new.txt"}, strings.NewReader("new"))
+		require.ErrorIs(t, err, cinodefs.ErrMissingWriterInfo)
+
+		_, err = fs.RootWriterInfo(ctx)
+		require.ErrorIs(t, err, cinodefs.ErrMissingWriterInfo)
+
+		// Nested links keep their writer info
+		_, err = fs.SetEntryFile(ctx, []string{"tenant1", "new.txt"}, strings.NewReader("new"))
+		require.NoError(t, err)
+	})
+
+	t.Run("invalid paths", func(t *testing.T) {
+		fs := newFS(t)
+
+		err := fs.ForgetWriterInfo(ctx, []string{"shared"})
+		require.ErrorIs(t, err, cinodefs.ErrNotALink)
+
+		err = fs.ForgetWriterInfo(ctx, []string{"shared", "file.txt"})
+		require.ErrorIs(t, err, cinodefs.ErrNotALink)
+
+		err = fs.ForgetWriterInfo(ctx, []string{"missing"})
+		require.ErrorIs(t, err, cinodefs.ErrEntryNotFound)
+
+		err = fs.ForgetWriterInfo(ctx, []string{"tenant1", ""})
+		require.ErrorIs(t, err, cinodefs.ErrEmptyName)
+	})
+
+	t.Run("unsaved changes behind the link", func(t *testing.T) {
+		fs := newFS(t)
+
+		_, err := fs.SetEntryFile(ctx, []string{"tenant1", "new.txt"}, strings.NewReader("new"))
+		require.NoError(t, err)
+
+		err = fs.ForgetWriterInfo(ctx, []string{"tenant1"})
+		require.ErrorIs(t, err, cinodefs.ErrWriterInfoInUse)
+
+		require.NoError(t, fs.Flush(ctx))
+		err = fs.ForgetWriterInfo(ctx, []string{"tenant1"})
+		require.NoError(t, err)
+	})
+}
+
+func TestAddWriterInfo(t *testing.T) {
+	ctx := context.Background()
+	be := blenc.FromDatastore(datastore.InMemory())
+
+	fs, err := cinodefs.New(ctx, be, cinodefs.NewRootDynamicLink())
+	require.NoError(t, err)
+
+	for _, p := range [][]string{
+		{"tenant1", "file.txt"},
+		{"tenant2", "file.txt"},
+	} {
+		_, err = fs.SetEntryFile(ctx, p, strings.NewReader("data"))
+		require.NoError(t, err)
+	}
+
+	wi1, err := fs.InjectDynamicLink(ctx, []string{"tenant1"})
+	require.NoError(t, err)
+	wi2, err := fs.InjectDynamicLink(ctx, []string{"tenant2"})
+	require.NoError(t, err)
+	require.NoError(t, fs.Flush(ctx))
+
+	rootEP, err := fs.RootEntrypoint()
+	require.NoError(t, err)
+
+	ro, err := cinodefs.New(ctx, be, cinodefs.RootEntrypoint(rootEP))
+	require.NoError(t, err)
+
+	_, err = ro.SetEntryFile(ctx, []string{"tenant1", "new.txt"}, strings.NewReader("new"))
+	require.ErrorIs(t, err, cinodefs.ErrMissingWriterInfo)
+
+	t.Run("invalid writer info", func(t *testing.T) {
+		err := ro.AddWriterInfo(nil)
+		require.ErrorIs(t, err, cinodefs.ErrInvalidWriterInfoData)
+
+		err = ro.AddWriterInfo(&cinodefs.WriterInfo{})
+		require.ErrorIs(t, err, cinodefs.ErrInvalidWriterInfoData)
+
+		fileEP, err := ro.FindEntry(ctx, []string{"tenant1", "file.txt"})
+		require.NoError(t, err)
+
+		withFields := func(t *testing.T, wi *cinodefs.WriterInfo, f func(*protobuf.WriterInfo)) *cinodefs.WriterInfo {
+			pb := &protobuf.WriterInfo{}
+			require.NoError(t, proto.Unmarshal(wi.Bytes(), pb))
+			f(pb)
+			b, err := proto.Marshal(pb)
+			require.NoError(t, err)
+			ret, err := cinodefs.WriterInfoFromBytes(b)
+			require.NoError(t, err)
+			return ret
+		}
+
+		err = ro.AddWriterInfo(withFields(t, wi1, func(pb *protobuf.WriterInfo) {
+			pb.BlobName = fileEP.BlobName().Bytes()
+		}))
+		require.ErrorIs(t, err, cinodefs.ErrInvalidWriterInfoData)
+		require.ErrorIs(t, err, cinodefs.ErrNotALink)
+
+		err = ro.AddWriterInfo(withFields(t, wi1, func(pb *protobuf.WriterInfo) {
+			pb.AuthInfo = []byte{1, 2, 3}
+		}))
+		require.ErrorIs(t, err, cinodefs.ErrInvalidWriterInfoData)
+
+		pb2 := &protobuf.WriterInfo{}
+		require.NoError(t, proto.Unmarshal(wi2.Bytes(), pb2))
+
+		err = ro.AddWriterInfo(withFields(t, wi1, func(pb *protobuf.WriterInfo) {
+			pb.AuthInfo = pb2.AuthInfo
+		}))
+		require.ErrorIs(t, err, cinodefs.ErrWriterInfoMismatch)
+
+		err = ro.AddWriterInfo(withFields(t, wi1, func(pb *protobuf.WriterInfo) {
+			pb.Key = pb2.Key
+		}))
+		require.ErrorIs(t, err, cinodefs.ErrWriterInfoMismatch)
+
+		_, err = ro.SetEntryFile(ctx, []string{"tenant1", "new.txt"}, strings.NewReader("new"))
+		require.ErrorIs(t, err, cinodefs.ErrMissingWriterInfo)
+	})
+
+	t.Run("valid writer info", func(t *testing.T) {
+		err := ro.AddWriterInfo(wi1)
+		require.NoError(t, err)
+
+		_, err = ro.SetEntryFile(ctx, []string{"tenant1", "new.txt"}, strings.NewReader("new"))
+		require.NoError(t, err)
+		require.NoError(t, ro.Flush(ctx))
+
+		// Root and other links remain read-only
+		_, err = ro.SetEntryFile(ctx, []string{"tenant2", "new.txt"}, strings.NewReader("new"))
+		require.ErrorIs(t, err, cinodefs.ErrMissingWriterInfo)
+		_, err = ro.SetEntryFile(ctx, []string{"new.txt"}, strings.NewReader("new"))
+		require.ErrorIs(t, err, cinodefs.ErrMissingWriterInfo)
+
+		wis, err := ro.ListWriterInfos(ctx)
+		require.NoError(t, err)
+		require.Len(t, wis, 1)
+		require.Equal(t, []string{"tenant1"}, wis[0].Path)
+		require.Equal(t, wi1.String(), wis[0].WriterInfo.String())
+
+		// Change is visible through the original filesystem
+		fs2, err := cinodefs.New(ctx, be, cinodefs.RootEntrypoint(rootEP))
+		require.NoError(t, err)
+		require.Equal(t, "new", readFile(t, fs2, []string{"tenant1", "new.txt"}))
+	})
+}
+
+func TestFlushLinkWithDirtySubtree(t *testing.T) {
+	ctx := context.Background()
+	ds := datastore.InMemory()
+
+	fs, err := cinodefs.New(ctx, blenc.FromDatastore(ds), cinodefs.NewRootDynamicLink())
+	require.NoError(t, err)
+	_, err = fs.SetEntryFile(ctx, []string{"sub", "file.txt"}, strings.NewReader("hello"))
+	require.NoError(t, err)
+	subWI, err := fs.InjectDynamicLink(ctx, []string{"sub"})
+	require.NoError(t, err)
+	require.NoError(t, fs.Flush(ctx))
+
+	rootEP, err := fs.RootEntrypoint()
+	require.NoError(t, err)
+
+	readRootLinkBlob := func() []byte {
+		rc, err := ds.Open(ctx, rootEP.BlobName())
+		require.NoError(t, err)
+		defer rc.Close()
+		data, err := io.ReadAll(rc)
+		require.NoError(t, err)
+		return data
+	}
+	rootLinkData := readRootLinkBlob()
+
+	// Only the writer info of the sub-link is known, the root link can not
+	// be updated but it does not have to - its target does not change
+	fs2, err := cinodefs.New(ctx, blenc.FromDatastore(ds), cinodefs.RootEntrypoint(rootEP))
+	require.NoError(t, err)
+
+	_, err = fs2.SetEntryFile(ctx, []string{"sub", "file.txt"}, strings.NewReader("updated"))
+	require.ErrorIs(t, err, cinodefs.ErrMissingWriterInfo)
+
+	require.NoError(t, fs2.AddWriterInfo(subWI))
+	_, err = fs2.SetEntryFile(ctx, []string{"sub", "file.txt"}, strings.NewReader("updated"))
+	require.NoError(t, err)
+
+	stats, err := cinodefs.GetCacheStats(fs2)
+	require.NoError(t, err)
+	require.NotZero(t, stats.DirtyNodes)
+
+	require.NoError(t, fs2.Flush(ctx))
+	require.Equal(t, rootLinkData, readRootLinkBlob())
+
+	fs3, err := cinodefs.New(ctx, blenc.FromDatastore(ds), cinodefs.RootEntrypoint(rootEP))
+	require.NoError(t, err)
+	data, err := fs3.OpenEntryDataPrefix(ctx, []string{"sub", "file.txt"}, 100)
+	require.NoError(t, err)
+	require.Equal(t, "updated", string(data))
+
+	// Change of the link target itself still requires the writer info
+	_, err = fs2.SetEntryFile(ctx, []string{"other.txt"}, strings.NewReader("other"))
+	require.ErrorIs(t, err, cinodefs.ErrMissingWriterInfo)
+}
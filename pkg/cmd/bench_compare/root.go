@@ -0,0 +1,131 @@
+/*
+Copyright © 2022 Bartłomiej Święcki (byo)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bench_compare
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/cinode/go/pkg/utilities/benchmark"
+	"github.com/spf13/cobra"
+)
+
+var (
+	ErrRegression = errors.New("performance regression detected")
+)
+
+func rootCmd() *cobra.Command {
+	var baselineFile string
+	var threshold float64
+
+	cmd := &cobra.Command{
+		Use:   "bench_compare --baseline <file> [current results file]",
+		Short: "Compare benchmark results with the stored baseline",
+		Long: strings.Join([]string{
+			"The bench_compare command compares results of `go test -bench` with",
+			"the baseline stored earlier with the same command. Current results",
+			"are read from the file given as an argument or from the standard input.",
+			"The command fails if any benchmark got slower by more than the threshold.",
+			"",
+			"Example:",
+			"",
+			"  go test -run '^$' -bench . -count 5 ./... > baseline.txt",
+			"  # ... apply changes ...",
+			"  go test -run '^$' -bench . -count 5 ./... | bench_compare --baseline baseline.txt",
+		}, "\n"),
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if baselineFile == "" {
+				return cmd.Help()
+			}
+
+			baseline, err := parseResultsFile(baselineFile)
+			if err != nil {
+				return fmt.Errorf("could not read baseline: %w", err)
+			}
+
+			var current map[string]benchmark.Result
+			if len(args) == 1 {
+				current, err = parseResultsFile(args[0])
+			} else {
+				current, err = benchmark.ParseResults(cmd.InOrStdin())
+			}
+			if err != nil {
+				return fmt.Errorf("could not read current results: %w", err)
+			}
+
+			cmd.SilenceUsage = true
+			return report(cmd.OutOrStdout(), benchmark.Compare(baseline, current), threshold)
+		},
+	}
+
+	cmd.Flags().StringVarP(
+		&baselineFile, "baseline", "b", "",
+		"file with baseline benchmark results",
+	)
+	cmd.Flags().Float64VarP(
+		&threshold, "threshold", "t", 0.1,
+		"maximal accepted slowdown, e.g. 0.1 accepts benchmarks slower by up to 10%",
+	)
+
+	return cmd
+}
+
+func parseResultsFile(fileName string) (map[string]benchmark.Result, error) {
+	fl, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer fl.Close()
+
+	return benchmark.ParseResults(fl)
+}
+
+func report(w io.Writer, cmp benchmark.Comparison, threshold float64) error {
+	for _, ch := range cmp.Changes {
+		fmt.Fprintf(w, "%-60s %14.0f ns/op %14.0f ns/op %+7.1f%%\n",
+			ch.Name, ch.Baseline, ch.Current, (ch.Ratio()-1)*100,
+		)
+	}
+	for _, name := range cmp.Missing {
+		fmt.Fprintf(w, "%-60s missing in current results\n", name)
+	}
+	for _, name := range cmp.Added {
+		fmt.Fprintf(w, "%-60s not in the baseline\n", name)
+	}
+
+	regressions := cmp.Regressions(threshold)
+	if len(regressions) == 0 {
+		fmt.Fprintf(w, "OK: no regressions above %.1f%%\n", threshold*100)
+		return nil
+	}
+
+	names := make([]string, len(regressions))
+	for i, r := range regressions {
+		names[i] = r.Name
+	}
+	return fmt.Errorf("%w: %s", ErrRegression, strings.Join(names, ", "))
+}
+
+// Execute runs the command, this is called by main.main()
+func Execute(ctx context.Context) error {
+	return rootCmd().ExecuteContext(ctx)
+}
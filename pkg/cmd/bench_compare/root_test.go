@@ -0,0 +1,87 @@
+/*
+Copyright © 2022 Bartłomiej Święcki (byo)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bench_compare
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBenchCompare(t *testing.T) {
+	dir := t.TempDir()
+
+	baseline := filepath.Join(dir, "baseline.txt")
+	require.NoError(t, os.WriteFile(baseline, []byte(strings.Join([]string{
+		"BenchmarkA-8   1000   1000 ns/op",
+		"BenchmarkB-8   1000   2000 ns/op",
+		"BenchmarkC-8   1000   3000 ns/op",
+	}, "\n")), 0o644))
+
+	run := func(stdin string, args ...string) (string, error) {
+		buf := bytes.NewBuffer(nil)
+		cmd := rootCmd()
+		cmd.SetArgs(args)
+		cmd.SetIn(strings.NewReader(stdin))
+		cmd.SetOut(buf)
+		cmd.SetErr(buf)
+		err := cmd.Execute()
+		return buf.String(), err
+	}
+
+	t.Run("no regressions", func(t *testing.T) {
+		out, err := run(strings.Join([]string{
+			"BenchmarkA-8   1000   1050 ns/op",
+			"BenchmarkB-8   1000   1500 ns/op",
+			"BenchmarkD-8   1000   4000 ns/op",
+		}, "\n"), "--baseline", baseline)
+		require.NoError(t, err)
+		require.Contains(t, out, "BenchmarkC")
+		require.Contains(t, out, "missing in current results")
+		require.Contains(t, out, "not in the baseline")
+		require.Contains(t, out, "OK")
+	})
+
+	t.Run("regression", func(t *testing.T) {
+		current := filepath.Join(dir, "current.txt")
+		require.NoError(t, os.WriteFile(current, []byte(
+			"BenchmarkA-8   1000   1500 ns/op\n",
+		), 0o644))
+
+		_, err := run("", "--baseline", baseline, current)
+		require.ErrorIs(t, err, ErrRegression)
+		require.ErrorContains(t, err, "BenchmarkA")
+
+		_, err = run("", "--baseline", baseline, "--threshold", "0.6", current)
+		require.NoError(t, err)
+	})
+
+	t.Run("invalid input", func(t *testing.T) {
+		_, err := run("", "--baseline", filepath.Join(dir, "missing.txt"))
+		require.ErrorIs(t, err, os.ErrNotExist)
+
+		_, err = run("not a benchmark output")
+		require.NoError(t, err) // no baseline - help is shown
+
+		_, err = run("BenchmarkA-8 1000 invalid ns/op", "--baseline", baseline)
+		require.Error(t, err)
+	})
+}
@@ -27,7 +27,6 @@ import (
 	"sort"
 	"strconv"
 	"strings"
-	"time"
 
 	"github.com/cinode/go/pkg/blenc"
 	"github.com/cinode/go/pkg/cinodefs"
@@ -81,7 +80,7 @@ func executeWithConfig(ctx context.Context, cfg *config) error {
 		"cpus", runtime.NumCPU(),
 	)
 
-	handler := setupCinodeProxy(ctx, mainDS, additionalDSs, entrypoint)
+	handler := setupCinodeProxy(ctx, mainDS, additionalDSs, entrypoint, cfg.compression)
 
 	return httpserver.RunGracefully(ctx,
 		handler,
@@ -95,24 +94,20 @@ func setupCinodeProxy(
 	mainDS datastore.DS,
 	additionalDSs []datastore.DS,
 	entrypoint *cinodefs.Entrypoint,
+	compression bool,
 ) http.Handler {
 	fs := golang.Must(cinodefs.New(
 		ctx,
-		blenc.FromDatastore(
-			datastore.NewMultiSource(
-				mainDS,
-				time.Hour,
-				additionalDSs...,
-			),
-		),
+		blenc.FromDatastores(mainDS, additionalDSs),
 		cinodefs.RootEntrypoint(entrypoint),
 		cinodefs.MaxLinkRedirects(10),
 	))
 
 	return &httphandler.Handler{
-		FS:        fs,
-		IndexFile: "index.html",
-		Log:       slog.Default(),
+		FS:          fs,
+		IndexFile:   "index.html",
+		Log:         slog.Default(),
+		Compression: compression,
 	}
 }
 
@@ -121,6 +116,7 @@ type config struct {
 	mainDSLocation        string
 	additionalDSLocations []string
 	port                  int
+	compression           bool
 }
 
 func getConfig() (*config, error) {
@@ -173,5 +169,13 @@ func getConfig() (*config, error) {
 		cfg.port = portNum
 	}
 
+	if compression := os.Getenv("CINODE_COMPRESSION"); compression != "" {
+		enabled, err := strconv.ParseBool(compression)
+		if err != nil {
+			return nil, fmt.Errorf("invalid compression setting %s: %w", compression, err)
+		}
+		cfg.compression = enabled
+	}
+
 	return &cfg, nil
 }
@@ -122,6 +122,23 @@ func TestGetConfig(t *testing.T) {
 		_, err := getConfig()
 		require.ErrorContains(t, err, "invalid listen port")
 	})
+
+	t.Run("enable compression", func(t *testing.T) {
+		cfg, err := getConfig()
+		require.NoError(t, err)
+		require.False(t, cfg.compression)
+
+		t.Setenv("CINODE_COMPRESSION", "true")
+		cfg, err = getConfig()
+		require.NoError(t, err)
+		require.True(t, cfg.compression)
+	})
+
+	t.Run("invalid compression setting", func(t *testing.T) {
+		t.Setenv("CINODE_COMPRESSION", "maybe")
+		_, err := getConfig()
+		require.ErrorContains(t, err, "invalid compression setting")
+	})
 }
 
 func TestWebProxyHandlerInvalidEntrypoint(t *testing.T) {
@@ -131,13 +148,14 @@ func TestWebProxyHandlerInvalidEntrypoint(t *testing.T) {
 	)
 	require.NoError(t, err)
 
-	key := cipherfactory.NewKeyGenerator(blobtypes.Static).Generate()
+	key := cipherfactory.NewKeyGenerator(cipherfactory.AlgorithmXChaCha20, blobtypes.Static).Generate()
 
 	handler := setupCinodeProxy(
 		context.Background(),
 		datastore.InMemory(),
 		[]datastore.DS{},
 		cinodefs.EntrypointFromBlobNameAndKey(n, key),
+		false,
 	)
 
 	server := httptest.NewServer(handler)
@@ -197,7 +215,7 @@ func TestWebProxyHandlerSimplePage(t *testing.T) {
 		return ep
 	}()
 
-	handler := setupCinodeProxy(context.Background(), ds, []datastore.DS{}, ep)
+	handler := setupCinodeProxy(context.Background(), ds, []datastore.DS{}, ep, false)
 
 	server := httptest.NewServer(handler)
 	defer server.Close()
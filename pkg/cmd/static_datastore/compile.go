@@ -18,9 +18,12 @@ package static_datastore
 
 import (
 	"context"
+	"crypto/sha256"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
+	"io/fs"
 	"log"
 	"os"
 	"strings"
@@ -30,6 +33,11 @@ import (
 	"github.com/cinode/go/pkg/cinodefs/uploader"
 	"github.com/cinode/go/pkg/datastore"
 	"github.com/spf13/cobra"
+	"golang.org/x/crypto/hkdf"
+)
+
+var (
+	ErrReproducibleMissingSeed = errors.New("reproducible compilation of a new dynamic link requires a seed")
 )
 
 func compileCmd() *cobra.Command {
@@ -37,6 +45,7 @@ func compileCmd() *cobra.Command {
 	var rootWriterInfoStr string
 	var rootWriterInfoFile string
 	var useRawFilesystem bool
+	var dryRun bool
 
 	cmd := &cobra.Command{
 		Use:   "compile --source <src_dir> --destination <dst_location>",
@@ -90,18 +99,43 @@ func compileCmd() *cobra.Command {
 				o.dstLocation = "file-raw://" + o.dstLocation
 			}
 
-			ep, wi, err := compileFS(cmd.Context(), o)
+			var ds datastore.DS
+			var err error
+			if dryRun {
+				// The destination must not be created nor modified
+				ds, err = datastore.FromExistingLocation(o.dstLocation)
+				if errors.Is(err, fs.ErrNotExist) {
+					ds, err = datastore.InMemory(), nil
+				}
+			} else {
+				ds, err = datastore.FromLocation(o.dstLocation)
+			}
+			if err != nil {
+				return fatalResult("could not open datastore: %s", err)
+			}
+			if dryRun {
+				ds = datastore.DryRun(ds)
+			}
+
+			ep, wi, err := compileFS(cmd.Context(), ds, o)
 			if err != nil {
 				return fatalResult("%s", err)
 			}
 
-			result := map[string]string{
+			result := map[string]any{
 				"result":     "OK",
 				"entrypoint": ep.String(),
 			}
 			if wi != nil {
 				result["writer-info"] = wi.String()
 			}
+			if dryRun {
+				blobs := []string{}
+				for _, name := range ds.(datastore.DryRunReporter).WrittenBlobs() {
+					blobs = append(blobs, name.String())
+				}
+				result["blobs"] = blobs
+			}
 			enc.Encode(result)
 
 			log.Println("DONE")
@@ -154,6 +188,24 @@ func compileCmd() *cobra.Command {
 		&o.append, "append", false,
 		"append file in existing datastore leaving existing unchanged files as is",
 	)
+	cmd.Flags().BoolVar(
+		&o.reproducible, "reproducible", false,
+		"produce a reproducible dataset - identical inputs will always result in identical blobs, "+
+			"dynamic links are created without timestamps and a new root link is derived from the --seed value",
+	)
+	cmd.Flags().BoolVar(
+		&o.modTime, "mod-time", false,
+		"store modification times of source files in file entries",
+	)
+	cmd.Flags().BoolVar(
+		&dryRun, "dry-run", false,
+		"do not write to the destination datastore, print names of blobs that would be written instead",
+	)
+	cmd.Flags().StringVar(
+		&o.seed, "seed", "",
+		"seed used to derive the root dynamic link in reproducible mode, "+
+			"anyone knowing the seed can derive the writer info so it must be kept secret",
+	)
 
 	return cmd
 }
@@ -166,22 +218,45 @@ type compileFSOptions struct {
 	generateIndexFiles bool
 	indexFile          string
 	append             bool
+	reproducible       bool
+	modTime            bool
+	seed               string
+}
+
+// reproducibleRandSource returns a deterministic stream of pseudo-random
+// bytes derived from given seed
+func reproducibleRandSource(seed string) io.Reader {
+	return hkdf.New(sha256.New, []byte(seed), nil, []byte("cinode reproducible compile"))
 }
 
 func compileFS(
 	ctx context.Context,
+	ds datastore.DS,
 	o compileFSOptions,
 ) (
 	*cinodefs.Entrypoint,
 	*cinodefs.WriterInfo,
 	error,
 ) {
-	ds, err := datastore.FromLocation(o.dstLocation)
-	if err != nil {
-		return nil, nil, fmt.Errorf("could not open datastore: %w", err)
+	opts := []cinodefs.Option{}
+	beOpts := []blenc.Option{}
+	if o.reproducible {
+		// Dynamic links are stored with a constant version instead
+		// of the current time, updates of existing links must still
+		// take precedence over the stored data
+		beOpts = append(beOpts,
+			blenc.VersionSource(func() uint64 { return 0 }),
+			blenc.VersionAboveStored(),
+		)
+
+		if !o.static && o.writerInfo == nil {
+			if o.seed == "" {
+				return nil, nil, ErrReproducibleMissingSeed
+			}
+			opts = append(opts, cinodefs.RandSource(reproducibleRandSource(o.seed)))
+		}
 	}
 
-	opts := []cinodefs.Option{}
 	if o.static {
 		opts = append(opts, cinodefs.NewRootStaticDirectory())
 	} else if o.writerInfo == nil {
@@ -192,7 +267,7 @@ func compileFS(
 
 	fs, err := cinodefs.New(
 		ctx,
-		blenc.FromDatastore(ds),
+		blenc.FromDatastore(ds, beOpts...),
 		opts...,
 	)
 	if err != nil {
@@ -210,6 +285,9 @@ func compileFS(
 	if o.generateIndexFiles {
 		genOpts = append(genOpts, uploader.CreateIndexFile(o.indexFile))
 	}
+	if o.modTime {
+		genOpts = append(genOpts, uploader.RecordModTime())
+	}
 
 	err = uploader.UploadStaticDirectory(
 		ctx,
@@ -0,0 +1,163 @@
+/*
+Copyright © 2023 Bartłomiej Święcki (byo)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package static_datastore
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/cinode/go/pkg/blenc"
+	"github.com/cinode/go/pkg/cinodefs"
+	"github.com/cinode/go/pkg/datastore"
+	"github.com/spf13/cobra"
+)
+
+func gcCmd() *cobra.Command {
+	var o gcOptions
+	var entrypointStrs []string
+
+	cmd := &cobra.Command{
+		Use:   "gc --datastore <location> --entrypoint <ep> [--entrypoint <ep>...] [--dry-run]",
+		Short: "Remove blobs not reachable from given root entrypoints",
+		Long: strings.Join([]string{
+			"The gc command walks the datasets starting from given root entrypoints,",
+			"following dynamic links to their current targets, and collects names of",
+			"all reachable blobs. Every other blob stored in the datastore is then",
+			"deleted. With --dry-run, blobs that would be deleted are only listed.",
+			"",
+			"WARNING: This command is intended for offline maintenance only. Blobs",
+			"written while the command is running (e.g. a dataset being published",
+			"at the same time) may not be reachable from the roots yet and could",
+			"be deleted. Make sure there are no writers using the datastore.",
+		}, "\n"),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if o.datastoreLocation == "" {
+				return cmd.Help()
+			}
+
+			enc := json.NewEncoder(cmd.OutOrStdout())
+			enc.SetIndent("", "  ")
+
+			fatalResult := func(format string, args ...interface{}) error {
+				msg := fmt.Sprintf(format, args...)
+
+				enc.Encode(map[string]string{
+					"result": "ERROR",
+					"msg":    msg,
+				})
+
+				cmd.SilenceUsage = true
+				cmd.SilenceErrors = true
+				return errors.New(msg)
+			}
+
+			if len(entrypointStrs) == 0 {
+				// Without roots every blob would be considered garbage
+				return fatalResult("At least one root entrypoint must be specified")
+			}
+			for _, epStr := range entrypointStrs {
+				ep, err := cinodefs.EntrypointFromString(epStr)
+				if err != nil {
+					return fatalResult("Couldn't parse entrypoint: %v", err)
+				}
+				o.roots = append(o.roots, ep)
+			}
+
+			res, err := gcDatastore(cmd.Context(), o)
+			if err != nil {
+				return fatalResult("%s", err)
+			}
+
+			enc.Encode(res)
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVarP(
+		&o.datastoreLocation, "datastore", "d", "",
+		"location of the datastore, can be a directory "+
+			"or an url prefixed with file://, file-raw://, http://, https://",
+	)
+	cmd.Flags().StringArrayVarP(
+		&entrypointStrs, "entrypoint", "e", nil,
+		"root entrypoint of a dataset to keep, can be specified multiple times",
+	)
+	cmd.Flags().BoolVar(
+		&o.dryRun, "dry-run", false,
+		"only list blobs that would be deleted, do not modify the datastore",
+	)
+
+	return cmd
+}
+
+type gcOptions struct {
+	datastoreLocation string
+	roots             []*cinodefs.Entrypoint
+	dryRun            bool
+}
+
+type gcResult struct {
+	Result       string   `json:"result"`
+	DryRun       bool     `json:"dry-run"`
+	Orphans      []string `json:"orphans"`
+	OrphansBytes int64    `json:"orphans-bytes"`
+	Deleted      int      `json:"deleted"`
+}
+
+func gcDatastore(ctx context.Context, o gcOptions) (*gcResult, error) {
+	ds, err := datastore.FromLocation(o.datastoreLocation)
+	if err != nil {
+		return nil, fmt.Errorf("could not open datastore: %w", err)
+	}
+	be := blenc.FromDatastore(ds)
+
+	orphans, size, err := cinodefs.FindOrphans(ctx, be, ds, o.roots, cinodefs.DefaultMaxLinksRedirects)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't find unreachable blobs: %w", err)
+	}
+
+	res := &gcResult{
+		Result:       "OK",
+		DryRun:       o.dryRun,
+		Orphans:      make([]string, 0, len(orphans)),
+		OrphansBytes: size,
+	}
+	for _, bn := range orphans {
+		res.Orphans = append(res.Orphans, bn.String())
+	}
+
+	if o.dryRun {
+		return res, nil
+	}
+
+	for _, bn := range orphans {
+		err := ds.Delete(ctx, bn)
+		if errors.Is(err, datastore.ErrNotFound) {
+			// Removed in the meantime
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("couldn't delete blob %s: %w", bn, err)
+		}
+		res.Deleted++
+	}
+
+	return res, nil
+}
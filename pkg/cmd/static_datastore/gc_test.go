@@ -0,0 +1,146 @@
+/*
+Copyright © 2023 Bartłomiej Święcki (byo)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package static_datastore
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/cinode/go/pkg/blenc"
+	"github.com/cinode/go/pkg/cinodefs"
+	"github.com/cinode/go/pkg/datastore"
+	"github.com/cinode/go/pkg/utilities/golang"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGC(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	ds := golang.Must(datastore.InRawFileSystem(dir))
+	be := blenc.FromDatastore(ds)
+
+	fs := golang.Must(cinodefs.New(ctx, be, cinodefs.NewRootDynamicLink()))
+	for _, name := range []string{"a.txt", "b.txt", "dir/c.txt"} {
+		_, err := fs.SetEntryFile(ctx, strings.Split(name, "/"), strings.NewReader("content of "+name))
+		require.NoError(t, err)
+	}
+	require.NoError(t, fs.Flush(ctx))
+	linkEP := golang.Must(fs.RootEntrypoint())
+
+	// Previous versions of changed files become garbage, the dynamic link
+	// only points to the current dataset
+	_, err := fs.SetEntryFile(ctx, []string{"a.txt"}, strings.NewReader("new content of a.txt"))
+	require.NoError(t, err)
+	require.NoError(t, fs.Flush(ctx))
+
+	staticFS := golang.Must(cinodefs.New(ctx, be, cinodefs.NewRootStaticDirectory()))
+	_, err = staticFS.SetEntryFile(ctx, []string{"b.txt"}, strings.NewReader("content of b.txt"))
+	require.NoError(t, err)
+	require.NoError(t, staticFS.Flush(ctx))
+	staticEP := golang.Must(staticFS.RootEntrypoint())
+
+	type gcOutput struct {
+		Result       string   `json:"result"`
+		Msg          string   `json:"msg"`
+		DryRun       bool     `json:"dry-run"`
+		Orphans      []string `json:"orphans"`
+		OrphansBytes int64    `json:"orphans-bytes"`
+		Deleted      int      `json:"deleted"`
+	}
+
+	runGC := func(t *testing.T, args ...string) (gcOutput, error) {
+		buf := bytes.NewBuffer(nil)
+		cmd := rootCmd()
+		cmd.SetArgs(append([]string{"gc", "-d", "file-raw://" + dir}, args...))
+		cmd.SetOut(buf)
+		err := cmd.Execute()
+
+		output := gcOutput{}
+		require.NoError(t, json.Unmarshal(buf.Bytes(), &output))
+		return output, err
+	}
+
+	countBlobs := func() int {
+		count := 0
+		for _, err := range ds.List(ctx) {
+			require.NoError(t, err)
+			count++
+		}
+		return count
+	}
+
+	t.Run("missing entrypoint", func(t *testing.T) {
+		output, err := runGC(t)
+		require.Error(t, err)
+		require.Equal(t, "ERROR", output.Result)
+	})
+
+	t.Run("invalid entrypoint", func(t *testing.T) {
+		output, err := runGC(t, "-e", "!@#$")
+		require.Error(t, err)
+		require.Equal(t, "ERROR", output.Result)
+	})
+
+	blobsBefore := countBlobs()
+	roots := []string{"-e", linkEP.String(), "-e", staticEP.String()}
+
+	t.Run("dry run", func(t *testing.T) {
+		output, err := runGC(t, append(roots, "--dry-run")...)
+		require.NoError(t, err)
+		require.Equal(t, "OK", output.Result)
+		require.True(t, output.DryRun)
+		require.NotEmpty(t, output.Orphans)
+		require.Positive(t, output.OrphansBytes)
+		require.Zero(t, output.Deleted)
+		require.Equal(t, blobsBefore, countBlobs())
+	})
+
+	t.Run("collect garbage", func(t *testing.T) {
+		output, err := runGC(t, roots...)
+		require.NoError(t, err)
+		require.Equal(t, "OK", output.Result)
+		require.False(t, output.DryRun)
+		require.Equal(t, len(output.Orphans), output.Deleted)
+		require.Equal(t, blobsBefore-output.Deleted, countBlobs())
+
+		for _, ep := range []*cinodefs.Entrypoint{linkEP, staticEP} {
+			err := cinodefs.VerifyReachable(ctx, be, ep, cinodefs.DefaultMaxLinksRedirects)
+			require.NoError(t, err)
+		}
+
+		output, err = runGC(t, append(roots, "--dry-run")...)
+		require.NoError(t, err)
+		require.Empty(t, output.Orphans)
+	})
+
+	t.Run("only the remaining root is kept", func(t *testing.T) {
+		blobsBefore := countBlobs()
+		output, err := runGC(t, "-e", linkEP.String())
+		require.NoError(t, err)
+		require.Positive(t, output.Deleted)
+		require.Equal(t, blobsBefore-output.Deleted, countBlobs())
+
+		err = cinodefs.VerifyReachable(ctx, be, linkEP, cinodefs.DefaultMaxLinksRedirects)
+		require.NoError(t, err)
+		err = cinodefs.VerifyReachable(ctx, be, staticEP, cinodefs.DefaultMaxLinksRedirects)
+		require.Error(t, err)
+	})
+}
@@ -0,0 +1,168 @@
+/*
+Copyright © 2023 Bartłomiej Święcki (byo)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package static_datastore
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/cinode/go/pkg/cinodefs"
+	"github.com/cinode/go/pkg/datastore"
+	"github.com/spf13/cobra"
+)
+
+func mirrorExportCmd() *cobra.Command {
+	var srcLocation string
+	var dstLocation string
+	var entrypointStr string
+	var maxLinkRedirects int
+	var onError string
+	var retries int
+
+	cmd := &cobra.Command{
+		Use:   "mirror-export --datastore <location> --entrypoint <ep> --destination <location>",
+		Short: "Export encrypted blobs of a dataset for a propagation-only mirror",
+		Long: strings.Join([]string{
+			"The mirror-export command copies all blobs reachable from the root",
+			"entrypoint into the destination datastore. Blobs are copied in their",
+			"encrypted form, neither the entrypoint nor any writer info is stored",
+			"in the destination. The result can be served by a propagation-only",
+			"node, reading the data still requires the entrypoint.",
+			"",
+			"Unreadable blobs abort the export by default. With --on-error=skip",
+			"those are skipped and reported, all remaining blobs are exported.",
+			"With --on-error=retry reading a blob is retried before giving up.",
+		}, "\n"),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if srcLocation == "" || dstLocation == "" {
+				return cmd.Help()
+			}
+
+			enc := json.NewEncoder(cmd.OutOrStdout())
+			enc.SetIndent("", "  ")
+
+			fatalResult := func(format string, args ...interface{}) error {
+				msg := fmt.Sprintf(format, args...)
+
+				enc.Encode(map[string]string{
+					"result": "ERROR",
+					"msg":    msg,
+				})
+
+				cmd.SilenceUsage = true
+				cmd.SilenceErrors = true
+				return errors.New(msg)
+			}
+
+			policy, err := walkPolicyFromFlags(onError, retries)
+			if err != nil {
+				return fatalResult("Invalid error handling policy: %v", err)
+			}
+
+			ep, err := cinodefs.EntrypointFromString(entrypointStr)
+			if err != nil {
+				return fatalResult("Couldn't parse entrypoint: %v", err)
+			}
+
+			src, err := datastore.FromLocation(srcLocation)
+			if err != nil {
+				return fatalResult("Could not open source datastore: %v", err)
+			}
+
+			dst, err := datastore.FromLocation(dstLocation)
+			if err != nil {
+				return fatalResult("Could not open destination datastore: %v", err)
+			}
+
+			count, err := cinodefs.ExportPublicBlobs(cmd.Context(), src, dst, ep, maxLinkRedirects, policy)
+
+			var skipped *cinodefs.SkippedEntriesError
+			if errors.As(err, &skipped) {
+				entries := []map[string]string{}
+				for _, e := range skipped.Entries {
+					entries = append(entries, map[string]string{
+						"path":  "/" + e.Path,
+						"blob":  e.BlobName.String(),
+						"error": e.Err.Error(),
+					})
+				}
+				enc.Encode(map[string]any{
+					"result":  "PARTIAL",
+					"blobs":   count,
+					"skipped": entries,
+				})
+				return nil
+			}
+			if err != nil {
+				return fatalResult("Export failed: %v", err)
+			}
+
+			enc.Encode(map[string]any{
+				"result": "OK",
+				"blobs":  count,
+			})
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVarP(
+		&srcLocation, "datastore", "d", "",
+		"location of the source datastore, can be a directory "+
+			"or an url prefixed with file://, file-raw://, http://, https://",
+	)
+	cmd.Flags().StringVarP(
+		&dstLocation, "destination", "o", "",
+		"location of the destination datastore, can be a directory "+
+			"or an url prefixed with file://, file-raw://, http://, https://",
+	)
+	cmd.Flags().StringVarP(
+		&entrypointStr, "entrypoint", "e", "",
+		"root entrypoint of the exported dataset",
+	)
+	cmd.Flags().IntVar(
+		&maxLinkRedirects, "max-link-redirects", cinodefs.DefaultMaxLinksRedirects,
+		"maximal number of consecutive dynamic link redirects",
+	)
+	cmd.Flags().StringVar(
+		&onError, "on-error", "fail",
+		"how to handle unreadable blobs: fail, skip or retry",
+	)
+	cmd.Flags().IntVar(
+		&retries, "retries", 3,
+		"number of retries of a failed read, used with --on-error=retry",
+	)
+
+	return cmd
+}
+
+func walkPolicyFromFlags(onError string, retries int) (cinodefs.WalkPolicy, error) {
+	switch onError {
+	case "fail":
+		return cinodefs.FailFast(), nil
+	case "skip":
+		return cinodefs.SkipAndReport(), nil
+	case "retry":
+		if retries < 0 {
+			return cinodefs.WalkPolicy{}, fmt.Errorf("negative number of retries: %d", retries)
+		}
+		return cinodefs.Retry(retries), nil
+	default:
+		return cinodefs.WalkPolicy{}, fmt.Errorf("unknown --on-error value: %s", onError)
+	}
+}
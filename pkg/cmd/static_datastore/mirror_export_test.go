@@ -0,0 +1,153 @@
+/*
+Copyright © 2023 Bartłomiej Święcki (byo)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package static_datastore
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/cinode/go/pkg/blenc"
+	"github.com/cinode/go/pkg/cinodefs"
+	"github.com/cinode/go/pkg/datastore"
+	"github.com/cinode/go/pkg/utilities/golang"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMirrorExport(t *testing.T) {
+	ctx := context.Background()
+	srcDir := t.TempDir()
+	dstDir := t.TempDir()
+
+	files := map[string]string{
+		"index.html":   "<html>index</html>",
+		"sub/file.txt": "file content",
+	}
+
+	ds := golang.Must(datastore.InFileSystem(srcDir))
+	fs := golang.Must(cinodefs.New(ctx,
+		blenc.FromDatastore(ds),
+		cinodefs.NewRootDynamicLink(),
+	))
+	for name, content := range files {
+		_, err := fs.SetEntryFile(ctx, strings.Split(name, "/"), strings.NewReader(content))
+		require.NoError(t, err)
+	}
+	require.NoError(t, fs.Flush(ctx))
+	ep := golang.Must(fs.RootEntrypoint())
+
+	runMirrorExport := func(args ...string) (map[string]any, error) {
+		buf := bytes.NewBuffer(nil)
+		cmd := rootCmd()
+		cmd.SetArgs(append([]string{"mirror-export"}, args...))
+		cmd.SetOut(buf)
+		err := cmd.Execute()
+
+		output := map[string]any{}
+		require.NoError(t, json.Unmarshal(buf.Bytes(), &output))
+		return output, err
+	}
+
+	t.Run("export", func(t *testing.T) {
+		output, err := runMirrorExport("-d", srcDir, "-o", dstDir, "-e", ep.String())
+		require.NoError(t, err)
+		require.Equal(t, "OK", output["result"])
+		// Root link, root directory, sub directory and two files
+		require.EqualValues(t, 5, output["blobs"])
+
+		// No entrypoint files are created in the destination
+		_, err = os.Stat(filepath.Join(dstDir, "entrypoint.txt"))
+		require.ErrorIs(t, err, os.ErrNotExist)
+
+		fs2 := golang.Must(cinodefs.New(ctx,
+			blenc.FromDatastore(golang.Must(datastore.InFileSystem(dstDir))),
+			cinodefs.RootEntrypoint(ep),
+		))
+		for name, content := range files {
+			rc, err := fs2.OpenEntryData(ctx, strings.Split(name, "/"))
+			require.NoError(t, err)
+			data, err := io.ReadAll(rc)
+			require.NoError(t, err)
+			require.NoError(t, rc.Close())
+			require.Equal(t, content, string(data))
+		}
+	})
+
+	t.Run("invalid entrypoint", func(t *testing.T) {
+		output, err := runMirrorExport("-d", srcDir, "-o", dstDir, "-e", "invalid!")
+		require.Error(t, err)
+		require.Equal(t, "ERROR", output["result"])
+		require.Contains(t, output["msg"], "Couldn't parse entrypoint")
+	})
+
+	t.Run("missing blobs", func(t *testing.T) {
+		output, err := runMirrorExport("-d", t.TempDir(), "-o", dstDir, "-e", ep.String())
+		require.Error(t, err)
+		require.Equal(t, "ERROR", output["result"])
+		require.Contains(t, output["msg"], "Export failed")
+	})
+
+	t.Run("skip unreadable blobs", func(t *testing.T) {
+		brokenDir := t.TempDir()
+		ds := golang.Must(datastore.InFileSystem(brokenDir))
+		fs := golang.Must(cinodefs.New(ctx,
+			blenc.FromDatastore(ds),
+			cinodefs.NewRootDynamicLink(),
+		))
+		for name, content := range files {
+			_, err := fs.SetEntryFile(ctx, strings.Split(name, "/"), strings.NewReader(content))
+			require.NoError(t, err)
+		}
+		require.NoError(t, fs.Flush(ctx))
+		ep := golang.Must(fs.RootEntrypoint())
+		fileEP := golang.Must(fs.FindEntry(ctx, []string{"sub", "file.txt"}))
+		require.NoError(t, ds.Delete(ctx, fileEP.BlobName()))
+
+		output, err := runMirrorExport("-d", brokenDir, "-o", t.TempDir(), "-e", ep.String())
+		require.Error(t, err)
+		require.Equal(t, "ERROR", output["result"])
+
+		output, err = runMirrorExport("-d", brokenDir, "-o", t.TempDir(), "-e", ep.String(), "--on-error", "skip")
+		require.NoError(t, err)
+		require.Equal(t, "PARTIAL", output["result"])
+		require.EqualValues(t, 4, output["blobs"])
+		require.Len(t, output["skipped"], 1)
+		skipped := output["skipped"].([]any)[0].(map[string]any)
+		require.Equal(t, "/sub/file.txt", skipped["path"])
+		require.Equal(t, fileEP.BlobName().String(), skipped["blob"])
+
+		output, err = runMirrorExport("-d", brokenDir, "-o", t.TempDir(), "-e", ep.String(), "--on-error", "retry")
+		require.Error(t, err)
+		require.Equal(t, "ERROR", output["result"])
+	})
+
+	t.Run("invalid error handling policy", func(t *testing.T) {
+		output, err := runMirrorExport("-d", srcDir, "-o", dstDir, "-e", ep.String(), "--on-error", "ignore")
+		require.Error(t, err)
+		require.Equal(t, "ERROR", output["result"])
+		require.Contains(t, output["msg"], "Invalid error handling policy")
+
+		output, err = runMirrorExport("-d", srcDir, "-o", dstDir, "-e", ep.String(), "--on-error", "retry", "--retries", "-1")
+		require.Error(t, err)
+		require.Equal(t, "ERROR", output["result"])
+	})
+}
@@ -0,0 +1,261 @@
+/*
+Copyright © 2023 Bartłomiej Święcki (byo)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package static_datastore
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/cinode/go/pkg/blenc"
+	"github.com/cinode/go/pkg/cinodefs"
+	"github.com/cinode/go/pkg/datastore"
+	"github.com/spf13/cobra"
+)
+
+func remimeCmd() *cobra.Command {
+	var o remimeOptions
+	var entrypointStr string
+	var rootWriterInfoStr string
+	var rootWriterInfoFile string
+
+	cmd := &cobra.Command{
+		Use:   "remime --datastore <location> (--writer-info <wi> | --entrypoint <ep> --dry-run)",
+		Short: "Recompute mime types of files in an existing dataset",
+		Long: strings.Join([]string{
+			"The remime command walks the whole dataset and recomputes the mime type",
+			"of every file using the same detection rules as the compile command -",
+			"first from the file name extension, then from the content. Entries are",
+			"only updated if the detected mime type differs from the stored one.",
+		}, "\n"),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if o.datastoreLocation == "" {
+				return cmd.Help()
+			}
+
+			enc := json.NewEncoder(cmd.OutOrStdout())
+			enc.SetIndent("", "  ")
+
+			fatalResult := func(format string, args ...interface{}) error {
+				msg := fmt.Sprintf(format, args...)
+
+				enc.Encode(map[string]string{
+					"result": "ERROR",
+					"msg":    msg,
+				})
+
+				cmd.SilenceUsage = true
+				cmd.SilenceErrors = true
+				return errors.New(msg)
+			}
+
+			if len(rootWriterInfoFile) > 0 {
+				data, err := os.ReadFile(rootWriterInfoFile)
+				if err != nil {
+					return fatalResult("Couldn't read data from the writer info file at '%s': %v", rootWriterInfoFile, err)
+				}
+				if len(data) == 0 {
+					return fatalResult("Writer info file at '%s' is empty", rootWriterInfoFile)
+				}
+				rootWriterInfoStr = string(data)
+			}
+			if len(rootWriterInfoStr) > 0 {
+				wi, err := cinodefs.WriterInfoFromString(rootWriterInfoStr)
+				if err != nil {
+					return fatalResult("Couldn't parse writer info: %v", err)
+				}
+				o.writerInfo = wi
+			}
+			if len(entrypointStr) > 0 {
+				ep, err := cinodefs.EntrypointFromString(entrypointStr)
+				if err != nil {
+					return fatalResult("Couldn't parse entrypoint: %v", err)
+				}
+				o.entrypoint = ep
+			}
+			if o.writerInfo == nil && o.entrypoint == nil {
+				return fatalResult("Either writer info or entrypoint must be specified")
+			}
+
+			ep, changed, err := remimeFS(cmd.Context(), o)
+			if err != nil {
+				return fatalResult("%s", err)
+			}
+
+			enc.Encode(map[string]any{
+				"result":        "OK",
+				"entrypoint":    ep.String(),
+				"changed-count": len(changed),
+				"changed":       changed,
+			})
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVarP(
+		&o.datastoreLocation, "datastore", "d", "",
+		"location of the datastore, can be a directory "+
+			"or an url prefixed with file://, file-raw://, http://, https://",
+	)
+	cmd.Flags().StringVarP(
+		&entrypointStr, "entrypoint", "e", "",
+		"root entrypoint of the dataset, without the writer info changes can only be listed with --dry-run",
+	)
+	cmd.Flags().StringVarP(
+		&rootWriterInfoStr, "writer-info", "w", "",
+		"writer info for the root dynamic link",
+	)
+	cmd.Flags().StringVarP(
+		&rootWriterInfoFile, "writer-info-file", "f", "",
+		"name of the file containing writer info for the root dynamic link",
+	)
+	cmd.Flags().BoolVar(
+		&o.dryRun, "dry-run", false,
+		"only report entries that would be changed, do not modify the dataset",
+	)
+
+	return cmd
+}
+
+type remimeOptions struct {
+	datastoreLocation string
+	entrypoint        *cinodefs.Entrypoint
+	writerInfo        *cinodefs.WriterInfo
+	dryRun            bool
+}
+
+type remimeChange struct {
+	Path    string `json:"path"`
+	OldMime string `json:"old"`
+	NewMime string `json:"new"`
+}
+
+func remimeFS(
+	ctx context.Context,
+	o remimeOptions,
+) (
+	*cinodefs.Entrypoint,
+	[]remimeChange,
+	error,
+) {
+	ds, err := datastore.FromLocation(o.datastoreLocation)
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not open datastore: %w", err)
+	}
+
+	var rootOpt cinodefs.Option
+	if o.writerInfo != nil {
+		rootOpt = cinodefs.RootWriterInfo(o.writerInfo)
+	} else {
+		rootOpt = cinodefs.RootEntrypoint(o.entrypoint)
+	}
+
+	fs, err := cinodefs.New(ctx, blenc.FromDatastore(ds), rootOpt)
+	if err != nil {
+		return nil, nil, fmt.Errorf("couldn't create cinode filesystem instance: %w", err)
+	}
+
+	changes := []remimeChange{}
+	err = fs.Walk(ctx, []string{}, func(e cinodefs.WalkEntry) error {
+		if e.IsDir || e.IsSymlink {
+			// Target of the symbolic link is processed under its own path
+			return nil
+		}
+		return remimeFile(ctx, fs, e.Path, o.dryRun, &changes)
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if !o.dryRun {
+		err = fs.Flush(ctx)
+		if err != nil {
+			return nil, nil, fmt.Errorf("couldn't flush changes: %w", err)
+		}
+	}
+
+	ep, err := fs.RootEntrypoint()
+	if err != nil {
+		return nil, nil, fmt.Errorf("couldn't get root entrypoint from cinodefs instance: %w", err)
+	}
+
+	return ep, changes, nil
+}
+
+func remimeFile(
+	ctx context.Context,
+	fs cinodefs.FS,
+	path []string,
+	dryRun bool,
+	changes *[]remimeChange,
+) error {
+	pathStr := "/" + strings.Join(path, "/")
+
+	ep, err := fs.FindEntry(ctx, path)
+	if errors.Is(err, cinodefs.ErrModifiedDirectory) || (err == nil && ep.IsDir()) {
+		// Link pointing to a directory, its content is visited by the walk
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("couldn't find entry %s: %w", pathStr, err)
+	}
+
+	// Same detection rules as used when creating files - extension first,
+	// then the content
+	mimeType := mime.TypeByExtension(filepath.Ext(path[len(path)-1]))
+	if mimeType == "" {
+		rc, err := fs.OpenEntryData(ctx, path)
+		if err != nil {
+			return fmt.Errorf("couldn't open file %s: %w", pathStr, err)
+		}
+		defer rc.Close()
+
+		head, err := io.ReadAll(io.LimitReader(rc, 512))
+		if err != nil {
+			return fmt.Errorf("couldn't read file %s: %w", pathStr, err)
+		}
+		mimeType = http.DetectContentType(head)
+	}
+
+	if mimeType == ep.MimeType() {
+		return nil
+	}
+
+	*changes = append(*changes, remimeChange{
+		Path:    pathStr,
+		OldMime: ep.MimeType(),
+		NewMime: mimeType,
+	})
+
+	if dryRun {
+		return nil
+	}
+
+	err = fs.SetEntryMimeType(ctx, path, mimeType)
+	if err != nil {
+		return fmt.Errorf("couldn't update mime type of %s: %w", pathStr, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,147 @@
+/*
+Copyright © 2023 Bartłomiej Święcki (byo)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package static_datastore
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/cinode/go/pkg/blenc"
+	"github.com/cinode/go/pkg/cinodefs"
+	"github.com/cinode/go/pkg/datastore"
+	"github.com/cinode/go/pkg/utilities/golang"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRemime(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	files := map[string]string{
+		"index.html":        "text/html; charset=utf-8",
+		"sub/file.txt":      "text/plain; charset=utf-8",
+		"sub/deep/noext":    "text/plain; charset=utf-8",
+		"sub/deep/data.png": "image/png",
+	}
+
+	ds := golang.Must(datastore.InFileSystem(dir))
+	fs := golang.Must(cinodefs.New(ctx,
+		blenc.FromDatastore(ds),
+		cinodefs.NewRootDynamicLink(),
+	))
+	for name := range files {
+		_, err := fs.SetEntryFile(ctx,
+			strings.Split(name, "/"),
+			strings.NewReader("plain text content"),
+			cinodefs.SetMimeType("application/x-wrong"),
+		)
+		require.NoError(t, err)
+	}
+	// One file already has the right mime type
+	_, err := fs.SetEntryFile(ctx,
+		[]string{"sub", "correct.txt"},
+		strings.NewReader("correct"),
+		cinodefs.SetMimeType("text/plain; charset=utf-8"),
+	)
+	require.NoError(t, err)
+	require.NoError(t, fs.Flush(ctx))
+
+	wi := golang.Must(fs.RootWriterInfo(ctx))
+	ep := golang.Must(fs.RootEntrypoint())
+
+	type remimeOutput struct {
+		Result       string         `json:"result"`
+		Msg          string         `json:"msg"`
+		EP           string         `json:"entrypoint"`
+		ChangedCount int            `json:"changed-count"`
+		Changed      []remimeChange `json:"changed"`
+	}
+
+	runRemime := func(t *testing.T, args ...string) remimeOutput {
+		buf := bytes.NewBuffer(nil)
+		cmd := rootCmd()
+		cmd.SetArgs(append([]string{"remime", "-d", dir}, args...))
+		cmd.SetOut(buf)
+		err := cmd.Execute()
+		require.NoError(t, err)
+
+		output := remimeOutput{}
+		err = json.Unmarshal(buf.Bytes(), &output)
+		require.NoError(t, err)
+		require.Equal(t, "OK", output.Result)
+		return output
+	}
+
+	checkMimeTypes := func(t *testing.T, expectFixed bool) {
+		fs := golang.Must(cinodefs.New(ctx,
+			blenc.FromDatastore(ds),
+			cinodefs.RootEntrypoint(ep),
+		))
+		for name, mimeType := range files {
+			ep, err := fs.FindEntry(ctx, strings.Split(name, "/"))
+			require.NoError(t, err)
+			if expectFixed {
+				require.Equal(t, mimeType, ep.MimeType(), name)
+			} else {
+				require.Equal(t, "application/x-wrong", ep.MimeType(), name)
+			}
+		}
+	}
+
+	t.Run("dry run", func(t *testing.T) {
+		output := runRemime(t, "--entrypoint", ep.String(), "--dry-run")
+		require.Len(t, output.Changed, len(files))
+		require.Equal(t, len(files), output.ChangedCount)
+		for _, c := range output.Changed {
+			require.Equal(t, "application/x-wrong", c.OldMime)
+			require.Equal(t, files[strings.TrimPrefix(c.Path, "/")], c.NewMime)
+		}
+		checkMimeTypes(t, false)
+	})
+
+	t.Run("fix mime types", func(t *testing.T) {
+		output := runRemime(t, "--writer-info", wi.String())
+		require.Len(t, output.Changed, len(files))
+		require.Equal(t, len(files), output.ChangedCount)
+		require.Equal(t, ep.String(), output.EP)
+		checkMimeTypes(t, true)
+	})
+
+	t.Run("no changes on second run", func(t *testing.T) {
+		output := runRemime(t, "--writer-info", wi.String())
+		require.Empty(t, output.Changed)
+		require.Zero(t, output.ChangedCount)
+	})
+
+	t.Run("invalid options", func(t *testing.T) {
+		for _, args := range [][]string{
+			{},
+			{"--entrypoint", "!!!"},
+			{"--writer-info", "!!!"},
+			{"--writer-info-file", "/non-existing/file"},
+		} {
+			cmd := rootCmd()
+			cmd.SetArgs(append([]string{"remime", "-d", dir}, args...))
+			cmd.SetOut(bytes.NewBuffer(nil))
+			err := cmd.Execute()
+			require.Error(t, err)
+		}
+	})
+}
@@ -43,6 +43,10 @@ node is stored in a plaintext in a file called 'entrypoint.txt'.
 	}
 
 	cmd.AddCommand(compileCmd())
+	cmd.AddCommand(remimeCmd())
+	cmd.AddCommand(mirrorExportCmd())
+	cmd.AddCommand(verifyCmd())
+	cmd.AddCommand(gcCmd())
 
 	return cmd
 }
@@ -21,6 +21,7 @@ import (
 	"context"
 	"encoding/json"
 	"io"
+	"io/fs"
 	"net/http"
 	"net/http/httptest"
 	"os"
@@ -102,10 +103,11 @@ func TestCompileAndReadTestSuite(t *testing.T) {
 }
 
 type testOutputParser struct {
-	Result string `json:"result"`
-	Msg    string `json:"msg"`
-	WI     string `json:"writer-info"`
-	EP     string `json:"entrypoint"`
+	Result string   `json:"result"`
+	Msg    string   `json:"msg"`
+	WI     string   `json:"writer-info"`
+	EP     string   `json:"entrypoint"`
+	Blobs  []string `json:"blobs"`
 }
 
 func (s *CompileAndReadTestSuite) uploadDatasetToDatastore(
@@ -267,6 +269,134 @@ func (s *CompileAndReadTestSuite) TestCompileAndRead() {
 
 }
 
+func (s *CompileAndReadTestSuite) TestReproducibleCompile() {
+	t := s.T()
+
+	datastore1 := t.TempDir()
+	datastore2 := t.TempDir()
+
+	wi1, ep1 := s.uploadDatasetToDatastore(t, s.initialTestDataset, datastore1,
+		"--reproducible", "--seed", "test-seed",
+	)
+	wi2, ep2 := s.uploadDatasetToDatastore(t, s.initialTestDataset, datastore2,
+		"--reproducible", "--seed", "test-seed",
+	)
+	require.Equal(t, ep1.String(), ep2.String())
+	require.Equal(t, wi1.String(), wi2.String())
+	s.validateDataset(t, s.initialTestDataset, ep1, datastore1)
+	s.validateDataset(t, s.initialTestDataset, ep2, datastore2)
+
+	t.Run("datastores contain identical blobs", func(t *testing.T) {
+		readAll := func(dir string) map[string][]byte {
+			ret := map[string][]byte{}
+			err := filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+				if err != nil || d.IsDir() {
+					return err
+				}
+				data, err := os.ReadFile(path)
+				if err != nil {
+					return err
+				}
+				ret[golang.Must(filepath.Rel(dir, path))] = data
+				return nil
+			})
+			require.NoError(t, err)
+			return ret
+		}
+
+		require.Equal(t, readAll(datastore1), readAll(datastore2))
+	})
+
+	t.Run("update reproducible dataset", func(t *testing.T) {
+		for i := 0; i < 4; i++ {
+			dataset := s.updatedTestDataset
+			if i%2 == 1 {
+				dataset = s.initialTestDataset
+			}
+			_, ep := s.uploadDatasetToDatastore(t, dataset, datastore1,
+				"--reproducible", "--writer-info", wi1.String(),
+			)
+			require.Equal(t, ep1.String(), ep.String())
+			s.validateDataset(t, dataset, ep, datastore1)
+		}
+	})
+
+	t.Run("different seed results in different entrypoint", func(t *testing.T) {
+		_, ep3 := s.uploadDatasetToDatastore(t, s.initialTestDataset, t.TempDir(),
+			"--reproducible", "--seed", "other-seed",
+		)
+		require.NotEqual(t, ep1.String(), ep3.String())
+	})
+
+	t.Run("static reproducible dataset does not need seed", func(t *testing.T) {
+		_, ep1 := s.uploadDatasetToDatastore(t, s.initialTestDataset, t.TempDir(),
+			"--reproducible", "--static",
+		)
+		_, ep2 := s.uploadDatasetToDatastore(t, s.initialTestDataset, t.TempDir(),
+			"--reproducible", "--static",
+		)
+		require.Equal(t, ep1.String(), ep2.String())
+	})
+}
+
+func (s *CompileAndReadTestSuite) TestDryRun() {
+	t := s.T()
+	ctx := context.Background()
+
+	srcDir := t.TempDir()
+	for _, td := range s.initialTestDataset {
+		err := os.MkdirAll(filepath.Join(srcDir, filepath.Dir(td.fName)), 0777)
+		require.NoError(t, err)
+		err = os.WriteFile(filepath.Join(srcDir, td.fName), []byte(td.contents), 0600)
+		require.NoError(t, err)
+	}
+
+	compile := func(dstDir string, extraArgs ...string) testOutputParser {
+		output, _, err := testExec(append([]string{
+			"compile", "-s", srcDir, "-d", dstDir, "--static",
+		}, extraArgs...))
+		require.NoError(t, err)
+
+		parsed := testOutputParser{}
+		require.NoError(t, json.Unmarshal(output, &parsed))
+		require.Equal(t, "OK", parsed.Result)
+		return parsed
+	}
+
+	listBlobs := func(dir string) []string {
+		ds, err := datastore.InFileSystem(dir)
+		require.NoError(t, err)
+
+		names := []string{}
+		for name, err := range ds.List(ctx) {
+			require.NoError(t, err)
+			names = append(names, name.String())
+		}
+		return names
+	}
+
+	dryRunDir := t.TempDir()
+	dryRun := compile(dryRunDir, "--dry-run")
+	require.NotEmpty(t, dryRun.Blobs)
+	entries, err := os.ReadDir(dryRunDir)
+	require.NoError(t, err)
+	require.Empty(t, entries)
+
+	// Missing destination is not created
+	missingDir := filepath.Join(t.TempDir(), "missing")
+	dryRunMissing := compile(missingDir, "--dry-run")
+	require.Equal(t, dryRun.EP, dryRunMissing.EP)
+	require.Equal(t, dryRun.Blobs, dryRunMissing.Blobs)
+	_, err = os.Stat(missingDir)
+	require.ErrorIs(t, err, fs.ErrNotExist)
+
+	dstDir := t.TempDir()
+	result := compile(dstDir)
+	require.Empty(t, result.Blobs)
+	require.Equal(t, result.EP, dryRun.EP)
+	require.ElementsMatch(t, listBlobs(dstDir), dryRun.Blobs)
+}
+
 func testExecCommand(cmd *cobra.Command, args []string) (output, stderr []byte, err error) {
 	outputBuff := bytes.NewBuffer(nil)
 	stderrBuff := bytes.NewBuffer(nil)
@@ -343,6 +473,16 @@ func TestInvalidOptions(t *testing.T) {
 			},
 			errorContains: "is empty",
 		},
+		{
+			name: "reproducible without seed",
+			args: []string{
+				"compile",
+				"--source", t.TempDir(),
+				"--destination", t.TempDir(),
+				"--reproducible",
+			},
+			errorContains: "requires a seed",
+		},
 	} {
 		t.Run(d.name, func(t *testing.T) {
 			output, _, err := testExec(d.args)
@@ -0,0 +1,164 @@
+/*
+Copyright © 2022 Bartłomiej Święcki (byo)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package static_datastore
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/cinode/go/pkg/blobtypes"
+	"github.com/cinode/go/pkg/common"
+	"github.com/cinode/go/pkg/datastore"
+	"github.com/cinode/go/pkg/internal/blobtypes/dynamiclink"
+	"github.com/cinode/go/pkg/propagation"
+	"github.com/spf13/cobra"
+	"golang.org/x/exp/slog"
+)
+
+func verifyCmd() *cobra.Command {
+	var location string
+
+	cmd := &cobra.Command{
+		Use:   "verify --datastore <location>",
+		Short: "Check integrity of all blobs in the datastore",
+		Long: strings.Join([]string{
+			"The verify command reads every blob stored in the datastore and validates",
+			"it the same way it is validated when being stored. The content of static",
+			"blobs must match their names, dynamic links must contain correctly",
+			"signed public data. Blobs failing the validation are reported and the",
+			"command fails if there's at least one such blob.",
+		}, "\n"),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if location == "" {
+				return cmd.Help()
+			}
+
+			enc := json.NewEncoder(cmd.OutOrStdout())
+			enc.SetIndent("", "  ")
+
+			fatalResult := func(format string, args ...interface{}) error {
+				msg := fmt.Sprintf(format, args...)
+
+				enc.Encode(map[string]string{
+					"result": "ERROR",
+					"msg":    msg,
+				})
+
+				cmd.SilenceUsage = true
+				cmd.SilenceErrors = true
+				return errors.New(msg)
+			}
+
+			ds, err := datastore.FromLocation(location)
+			if err != nil {
+				return fatalResult("could not open datastore: %s", err)
+			}
+
+			checked, bad, err := verifyDatastore(cmd.Context(), ds)
+			if err != nil {
+				return fatalResult("%s", err)
+			}
+
+			badNames := []string{}
+			for _, name := range bad {
+				badNames = append(badNames, name.String())
+			}
+
+			result := map[string]any{
+				"result":  "OK",
+				"checked": checked,
+				"bad":     badNames,
+			}
+			if len(bad) > 0 {
+				result["result"] = "ERROR"
+				result["msg"] = fmt.Sprintf("%d blob(s) failed validation", len(bad))
+			}
+			enc.Encode(result)
+
+			if len(bad) > 0 {
+				cmd.SilenceUsage = true
+				cmd.SilenceErrors = true
+				return errors.New(result["msg"].(string))
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVarP(
+		&location, "datastore", "d", "",
+		"location of the datastore, can be a directory "+
+			"or an url prefixed with file://, file-raw://, http://, https://",
+	)
+
+	return cmd
+}
+
+// verifyDatastore validates all blobs stored in the datastore, names of blobs
+// failing the validation are returned along with the number of checked blobs
+func verifyDatastore(ctx context.Context, ds datastore.DS) (int, []*common.BlobName, error) {
+	checked := 0
+	bad := []*common.BlobName{}
+
+	for name, err := range ds.List(ctx) {
+		if err != nil {
+			return 0, nil, fmt.Errorf("failed to list blobs: %w", err)
+		}
+
+		err := verifyBlob(ctx, ds, name)
+		if errors.Is(err, datastore.ErrNotFound) {
+			// Removed in the meantime
+			continue
+		}
+
+		checked++
+		if err != nil {
+			slog.ErrorContext(ctx, "blob failed validation", "blob", name, "err", err)
+			bad = append(bad, name)
+		}
+	}
+
+	return checked, bad, nil
+}
+
+func verifyBlob(ctx context.Context, ds datastore.DS, name *common.BlobName) error {
+	rc, err := ds.Open(ctx, name)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	switch name.Type() {
+	case blobtypes.Static:
+		_, err = io.Copy(io.Discard, propagation.StaticValidatingReader(name, rc))
+		return err
+
+	case blobtypes.DynamicLink:
+		dl, err := dynamiclink.FromPublicData(name, rc)
+		if err != nil {
+			return err
+		}
+		// Signature is only validated once the whole link data is read
+		_, err = io.Copy(io.Discard, dl.GetEncryptedLinkReader())
+		return err
+	}
+
+	return blobtypes.ErrUnknownBlobType
+}
@@ -0,0 +1,115 @@
+/*
+Copyright © 2022 Bartłomiej Święcki (byo)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package static_datastore
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/cinode/go/pkg/blenc"
+	"github.com/cinode/go/pkg/blobtypes"
+	"github.com/cinode/go/pkg/cinodefs"
+	"github.com/cinode/go/pkg/datastore"
+	"github.com/cinode/go/pkg/utilities/golang"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerify(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	ds := golang.Must(datastore.InRawFileSystem(dir))
+	fs := golang.Must(cinodefs.New(ctx,
+		blenc.FromDatastore(ds),
+		cinodefs.NewRootDynamicLink(),
+	))
+	for _, name := range []string{"a.txt", "b.txt", "dir/c.txt"} {
+		_, err := fs.SetEntryFile(ctx, strings.Split(name, "/"), strings.NewReader("content of "+name))
+		require.NoError(t, err)
+	}
+	require.NoError(t, fs.Flush(ctx))
+
+	type verifyOutput struct {
+		Result  string   `json:"result"`
+		Msg     string   `json:"msg"`
+		Checked int      `json:"checked"`
+		Bad     []string `json:"bad"`
+	}
+
+	runVerify := func(t *testing.T) (verifyOutput, error) {
+		buf := bytes.NewBuffer(nil)
+		cmd := rootCmd()
+		cmd.SetArgs([]string{"verify", "-d", "file-raw://" + dir})
+		cmd.SetOut(buf)
+		err := cmd.Execute()
+
+		output := verifyOutput{}
+		require.NoError(t, json.Unmarshal(buf.Bytes(), &output))
+		return output, err
+	}
+
+	blobCount := 0
+	var staticBlob, linkBlob string
+	for name, err := range ds.List(ctx) {
+		require.NoError(t, err)
+		blobCount++
+		if name.Type() == blobtypes.Static {
+			staticBlob = name.String()
+		} else {
+			linkBlob = name.String()
+		}
+	}
+	require.NotEmpty(t, staticBlob)
+	require.NotEmpty(t, linkBlob)
+
+	t.Run("valid datastore", func(t *testing.T) {
+		output, err := runVerify(t)
+		require.NoError(t, err)
+		require.Equal(t, "OK", output.Result)
+		require.Equal(t, blobCount, output.Checked)
+		require.Empty(t, output.Bad)
+	})
+
+	t.Run("corrupted blobs", func(t *testing.T) {
+		for _, name := range []string{staticBlob, linkBlob} {
+			fName := filepath.Join(dir, name)
+			data, err := os.ReadFile(fName)
+			require.NoError(t, err)
+			data[len(data)-1] ^= 0xFF
+			require.NoError(t, os.WriteFile(fName, data, 0600))
+		}
+
+		output, err := runVerify(t)
+		require.Error(t, err)
+		require.Equal(t, "ERROR", output.Result)
+		require.Equal(t, blobCount, output.Checked)
+		require.ElementsMatch(t, []string{staticBlob, linkBlob}, output.Bad)
+	})
+
+	t.Run("invalid datastore", func(t *testing.T) {
+		buf := bytes.NewBuffer(nil)
+		cmd := rootCmd()
+		cmd.SetArgs([]string{"verify", "-d", "http://"})
+		cmd.SetOut(buf)
+		require.Error(t, cmd.Execute())
+	})
+}
@@ -0,0 +1,194 @@
+/*
+Copyright © 2022 Bartłomiej Święcki (byo)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package datastore
+
+import (
+	"context"
+	"errors"
+	"io"
+	"iter"
+	"sync/atomic"
+
+	"github.com/cinode/go/pkg/blobtypes"
+	"github.com/cinode/go/pkg/common"
+)
+
+// CacheStats contains counters of reads done through the caching datastore
+type CacheStats struct {
+	// Hits is the number of static blobs read from the cache
+	Hits int64
+
+	// Misses is the number of static blobs that had to be read from
+	// the backend datastore
+	Misses int64
+}
+
+// CacheStatsReporter is implemented by datastores created with WithCache
+type CacheStatsReporter interface {
+	CacheStats() CacheStats
+}
+
+type cachedDatastore struct {
+	backend DS
+	cache   DS
+	hits    atomic.Int64
+	misses  atomic.Int64
+}
+
+var (
+	_ DS                 = (*cachedDatastore)(nil)
+	_ CacheStatsReporter = (*cachedDatastore)(nil)
+)
+
+// WithCache returns a datastore reading static blobs through the cache
+// datastore. Blobs missing in the cache are read from the backend and stored
+// in the cache before being returned. Static blobs never change thus cached
+// data is kept forever, dynamic links are always read from the backend since
+// those can be updated at any time.
+//
+// Updates are written to the backend only, deleted blobs are removed from
+// both datastores. Failures of the cache datastore are not fatal, the data
+// is read from the backend in such case.
+func WithCache(backend DS, cache DS) DS {
+	return &cachedDatastore{
+		backend: backend,
+		cache:   cache,
+	}
+}
+
+func (c *cachedDatastore) CacheStats() CacheStats {
+	return CacheStats{
+		Hits:   c.hits.Load(),
+		Misses: c.misses.Load(),
+	}
+}
+
+func (c *cachedDatastore) Kind() string {
+	return c.backend.Kind()
+}
+
+func (c *cachedDatastore) Address() string {
+	return c.backend.Address()
+}
+
+func (c *cachedDatastore) Open(ctx context.Context, name *common.BlobName) (io.ReadCloser, error) {
+	if name.Type() != blobtypes.Static {
+		return c.backend.Open(ctx, name)
+	}
+
+	rc, err := c.cache.Open(ctx, name)
+	if err == nil {
+		c.hits.Add(1)
+		return rc, nil
+	}
+	c.misses.Add(1)
+
+	rc, err = c.backend.Open(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	// Store in the cache first, the data is validated while being stored
+	err = c.cache.Update(ctx, name, rc)
+	rc.Close()
+	if errors.Is(err, blobtypes.ErrValidationFailed) {
+		return nil, err
+	}
+	if err == nil {
+		rc, err = c.cache.Open(ctx, name)
+		if err == nil {
+			return rc, nil
+		}
+	}
+
+	// The cache is not working, try the backend again
+	return c.backend.Open(ctx, name)
+}
+
+func (c *cachedDatastore) Update(ctx context.Context, name *common.BlobName, r io.Reader) error {
+	// Static blobs in the cache have the same content, links are not cached
+	return c.backend.Update(ctx, name, r)
+}
+
+func (c *cachedDatastore) Exists(ctx context.Context, name *common.BlobName) (bool, error) {
+	if name.Type() == blobtypes.Static {
+		exists, err := c.cache.Exists(ctx, name)
+		if err == nil && exists {
+			return true, nil
+		}
+	}
+
+	return c.backend.Exists(ctx, name)
+}
+
+func (c *cachedDatastore) Size(ctx context.Context, name *common.BlobName) (int64, error) {
+	if name.Type() == blobtypes.Static {
+		size, err := c.cache.Size(ctx, name)
+		if err == nil {
+			return size, nil
+		}
+	}
+
+	return c.backend.Size(ctx, name)
+}
+
+func (c *cachedDatastore) ExistsMany(ctx context.Context, names []*common.BlobName) ([]bool, error) {
+	ret := make([]bool, len(names))
+
+	cached, err := c.cache.ExistsMany(ctx, names)
+	if err != nil {
+		// Cache is not working, check all blobs in the backend
+		cached = ret
+	}
+
+	missingIdx := []int{}
+	missingNames := []*common.BlobName{}
+	for i, name := range names {
+		if cached[i] && name.Type() == blobtypes.Static {
+			ret[i] = true
+			continue
+		}
+		missingIdx = append(missingIdx, i)
+		missingNames = append(missingNames, name)
+	}
+	if len(missingNames) == 0 {
+		return ret, nil
+	}
+
+	exists, err := c.backend.ExistsMany(ctx, missingNames)
+	if err != nil {
+		return nil, err
+	}
+	for i, idx := range missingIdx {
+		ret[idx] = exists[i]
+	}
+	return ret, nil
+}
+
+func (c *cachedDatastore) Delete(ctx context.Context, name *common.BlobName) error {
+	err := c.cache.Delete(ctx, name)
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		return err
+	}
+
+	return c.backend.Delete(ctx, name)
+}
+
+// List enumerates blobs of the backend, the cache contains a subset of those
+func (c *cachedDatastore) List(ctx context.Context) iter.Seq2[*common.BlobName, error] {
+	return c.backend.List(ctx)
+}
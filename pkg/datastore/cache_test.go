@@ -0,0 +1,186 @@
+/*
+Copyright © 2023 Bartłomiej Święcki (byo)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package datastore
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/cinode/go/pkg/blobtypes"
+	"github.com/cinode/go/pkg/common"
+	"github.com/stretchr/testify/require"
+)
+
+// openCountingDS counts Open calls and can be switched to fail them
+type openCountingDS struct {
+	DS
+	opens   int
+	openErr error
+}
+
+func (o *openCountingDS) Open(ctx context.Context, name *common.BlobName) (io.ReadCloser, error) {
+	o.opens++
+	if o.openErr != nil {
+		return nil, o.openErr
+	}
+	return o.DS.Open(ctx, name)
+}
+
+// failingUpdateDS fails all updates with given error
+type failingUpdateDS struct {
+	DS
+	updateErr error
+}
+
+func (f *failingUpdateDS) Update(ctx context.Context, name *common.BlobName, r io.Reader) error {
+	return f.updateErr
+}
+
+func TestWithCache(t *testing.T) {
+	ctx := context.Background()
+
+	readAll := func(t *testing.T, ds DS, name *common.BlobName) []byte {
+		rc, err := ds.Open(ctx, name)
+		require.NoError(t, err)
+		defer rc.Close()
+		data, err := io.ReadAll(rc)
+		require.NoError(t, err)
+		return data
+	}
+
+	t.Run("static blobs are cached", func(t *testing.T) {
+		backend := &openCountingDS{DS: InMemory()}
+		cache := InMemory()
+		ds := WithCache(backend, cache)
+
+		b := testBlobs[0]
+		require.NoError(t, backend.Update(ctx, b.name, bytes.NewReader(b.data)))
+
+		require.Equal(t, b.expected, readAll(t, ds, b.name))
+		require.Equal(t, 1, backend.opens)
+		require.Equal(t, CacheStats{Hits: 0, Misses: 1}, ds.(CacheStatsReporter).CacheStats())
+
+		exists, err := cache.Exists(ctx, b.name)
+		require.NoError(t, err)
+		require.True(t, exists)
+
+		// Backend is not needed anymore
+		backend.openErr = errors.New("backend unavailable")
+		require.Equal(t, b.expected, readAll(t, ds, b.name))
+		require.Equal(t, b.expected, readAll(t, ds, b.name))
+		require.Equal(t, 1, backend.opens)
+		require.Equal(t, CacheStats{Hits: 2, Misses: 1}, ds.(CacheStatsReporter).CacheStats())
+	})
+
+	t.Run("dynamic links are not cached", func(t *testing.T) {
+		backend := &openCountingDS{DS: InMemory()}
+		cache := InMemory()
+		ds := WithCache(backend, cache)
+
+		name := dynamicLinkPropagationData[0].name
+		require.NoError(t, ds.Update(ctx, name, bytes.NewReader(dynamicLinkPropagationData[0].data)))
+		require.Equal(t, dynamicLinkPropagationData[0].data, readAll(t, ds, name))
+
+		require.NoError(t, ds.Update(ctx, name, bytes.NewReader(dynamicLinkPropagationData[1].data)))
+		require.Equal(t, dynamicLinkPropagationData[1].data, readAll(t, ds, name))
+		require.Equal(t, 2, backend.opens)
+
+		exists, err := cache.Exists(ctx, name)
+		require.NoError(t, err)
+		require.False(t, exists)
+		require.Equal(t, CacheStats{}, ds.(CacheStatsReporter).CacheStats())
+	})
+
+	t.Run("missing blob", func(t *testing.T) {
+		ds := WithCache(InMemory(), InMemory())
+
+		_, err := ds.Open(ctx, emptyBlobNameStatic)
+		require.ErrorIs(t, err, ErrNotFound)
+		require.Equal(t, CacheStats{Hits: 0, Misses: 1}, ds.(CacheStatsReporter).CacheStats())
+	})
+
+	t.Run("delete removes cached blob", func(t *testing.T) {
+		backend := InMemory()
+		cache := InMemory()
+		ds := WithCache(backend, cache)
+
+		b := testBlobs[1]
+		require.NoError(t, ds.Update(ctx, b.name, bytes.NewReader(b.data)))
+		require.Equal(t, b.expected, readAll(t, ds, b.name))
+
+		require.NoError(t, ds.Delete(ctx, b.name))
+
+		for _, d := range []DS{ds, backend, cache} {
+			exists, err := d.Exists(ctx, b.name)
+			require.NoError(t, err)
+			require.False(t, exists)
+		}
+		_, err := ds.Open(ctx, b.name)
+		require.ErrorIs(t, err, ErrNotFound)
+
+		// Blob present in the cache only
+		require.NoError(t, cache.Update(ctx, b.name, bytes.NewReader(b.data)))
+		exists, err := ds.Exists(ctx, b.name)
+		require.NoError(t, err)
+		require.True(t, exists)
+
+		err = ds.Delete(ctx, b.name)
+		require.ErrorIs(t, err, ErrNotFound)
+		exists, err = cache.Exists(ctx, b.name)
+		require.NoError(t, err)
+		require.False(t, exists)
+	})
+
+	t.Run("broken cache", func(t *testing.T) {
+		backend := &openCountingDS{DS: InMemory()}
+		cache := &failingUpdateDS{DS: InMemory(), updateErr: errors.New("cache is full")}
+		ds := WithCache(backend, cache)
+
+		b := testBlobs[0]
+		require.NoError(t, ds.Update(ctx, b.name, bytes.NewReader(b.data)))
+
+		require.Equal(t, b.expected, readAll(t, ds, b.name))
+		require.Equal(t, b.expected, readAll(t, ds, b.name))
+		require.Equal(t, 4, backend.opens)
+		require.Equal(t, CacheStats{Hits: 0, Misses: 2}, ds.(CacheStatsReporter).CacheStats())
+	})
+
+	t.Run("invalid backend data", func(t *testing.T) {
+		b := testBlobs[0]
+		backend := &openCountingDS{DS: InMemory()}
+		ds := WithCache(backend, InMemory())
+
+		// Backend returning data not matching the blob name
+		backend.DS = &corruptedDS{DS: backend.DS, data: testBlobs[1].data}
+
+		_, err := ds.Open(ctx, b.name)
+		require.ErrorIs(t, err, blobtypes.ErrValidationFailed)
+	})
+}
+
+// corruptedDS returns the same data for every blob
+type corruptedDS struct {
+	DS
+	data []byte
+}
+
+func (c *corruptedDS) Open(ctx context.Context, name *common.BlobName) (io.ReadCloser, error) {
+	return io.NopCloser(bytes.NewReader(c.data)), nil
+}
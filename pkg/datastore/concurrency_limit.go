@@ -0,0 +1,161 @@
+/*
+Copyright © 2023 Bartłomiej Święcki (byo)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package datastore
+
+import (
+	"context"
+	"io"
+	"iter"
+	"sync"
+
+	"github.com/cinode/go/pkg/common"
+)
+
+type concurrencyLimitedDatastore struct {
+	inner DS
+	sem   chan struct{}
+}
+
+var _ DS = (*concurrencyLimitedDatastore)(nil)
+
+// WithConcurrencyLimit returns a datastore that runs at most maxConcurrent
+// operations on the inner datastore at once. Remaining operations wait for
+// a free slot, waiting is interrupted if the operation's context is cancelled.
+//
+// A slot taken by the Open call is held until the returned reader is closed,
+// this limits the number of simultaneously opened blobs. A caller holding
+// maxConcurrent opened readers will block on further operations until one of
+// the readers is closed.
+//
+// Operations are not nested - the limiter only gates calls coming from
+// the outside, calls the inner datastore does internally are not counted.
+// If maxConcurrent is less than 1, the inner datastore is returned unchanged.
+func WithConcurrencyLimit(inner DS, maxConcurrent int) DS {
+	if maxConcurrent < 1 {
+		return inner
+	}
+	return &concurrencyLimitedDatastore{
+		inner: inner,
+		sem:   make(chan struct{}, maxConcurrent),
+	}
+}
+
+func (c *concurrencyLimitedDatastore) acquire(ctx context.Context) error {
+	select {
+	case c.sem <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (c *concurrencyLimitedDatastore) release() {
+	<-c.sem
+}
+
+func (c *concurrencyLimitedDatastore) Kind() string {
+	return c.inner.Kind()
+}
+
+func (c *concurrencyLimitedDatastore) Address() string {
+	return c.inner.Address()
+}
+
+func (c *concurrencyLimitedDatastore) Open(ctx context.Context, name *common.BlobName) (io.ReadCloser, error) {
+	err := c.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	rc, err := c.inner.Open(ctx, name)
+	if err != nil {
+		c.release()
+		return nil, err
+	}
+
+	return &concurrencyLimitedReader{ReadCloser: rc, release: c.release}, nil
+}
+
+func (c *concurrencyLimitedDatastore) Update(ctx context.Context, name *common.BlobName, r io.Reader) error {
+	err := c.acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer c.release()
+
+	return c.inner.Update(ctx, name, r)
+}
+
+func (c *concurrencyLimitedDatastore) Exists(ctx context.Context, name *common.BlobName) (bool, error) {
+	err := c.acquire(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer c.release()
+
+	return c.inner.Exists(ctx, name)
+}
+
+// ExistsMany takes a single slot for the whole batch
+func (c *concurrencyLimitedDatastore) ExistsMany(ctx context.Context, names []*common.BlobName) ([]bool, error) {
+	err := c.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer c.release()
+
+	return c.inner.ExistsMany(ctx, names)
+}
+
+func (c *concurrencyLimitedDatastore) Size(ctx context.Context, name *common.BlobName) (int64, error) {
+	err := c.acquire(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer c.release()
+
+	return c.inner.Size(ctx, name)
+}
+
+func (c *concurrencyLimitedDatastore) Delete(ctx context.Context, name *common.BlobName) error {
+	err := c.acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer c.release()
+
+	return c.inner.Delete(ctx, name)
+}
+
+// List is not limited, holding the slot for the whole iteration would block
+// operations done by the caller while processing listed blobs
+func (c *concurrencyLimitedDatastore) List(ctx context.Context) iter.Seq2[*common.BlobName, error] {
+	return c.inner.List(ctx)
+}
+
+// concurrencyLimitedReader releases the concurrency slot once closed
+type concurrencyLimitedReader struct {
+	io.ReadCloser
+	release   func()
+	closeOnce sync.Once
+}
+
+func (r *concurrencyLimitedReader) Close() error {
+	err := r.ReadCloser.Close()
+	r.closeOnce.Do(r.release)
+	return err
+}
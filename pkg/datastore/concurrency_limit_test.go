@@ -0,0 +1,200 @@
+/*
+Copyright © 2023 Bartłomiej Święcki (byo)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package datastore
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/cinode/go/pkg/common"
+	"github.com/stretchr/testify/require"
+)
+
+// concurrencyTrackingDS tracks the number of operations running in parallel
+type concurrencyTrackingDS struct {
+	DS
+	current atomic.Int32
+	max     atomic.Int32
+}
+
+func (c *concurrencyTrackingDS) enter() {
+	cur := c.current.Add(1)
+	for {
+		m := c.max.Load()
+		if cur <= m || c.max.CompareAndSwap(m, cur) {
+			break
+		}
+	}
+	time.Sleep(time.Millisecond)
+}
+
+func (c *concurrencyTrackingDS) leave() {
+	c.current.Add(-1)
+}
+
+func (c *concurrencyTrackingDS) Open(ctx context.Context, name *common.BlobName) (io.ReadCloser, error) {
+	c.enter()
+	rc, err := c.DS.Open(ctx, name)
+	if err != nil {
+		c.leave()
+		return nil, err
+	}
+	return &closeNotifyReader{ReadCloser: rc, onClose: c.leave}, nil
+}
+
+func (c *concurrencyTrackingDS) Update(ctx context.Context, name *common.BlobName, r io.Reader) error {
+	c.enter()
+	defer c.leave()
+	return c.DS.Update(ctx, name, r)
+}
+
+func (c *concurrencyTrackingDS) Exists(ctx context.Context, name *common.BlobName) (bool, error) {
+	c.enter()
+	defer c.leave()
+	return c.DS.Exists(ctx, name)
+}
+
+func (c *concurrencyTrackingDS) Delete(ctx context.Context, name *common.BlobName) error {
+	c.enter()
+	defer c.leave()
+	return c.DS.Delete(ctx, name)
+}
+
+type closeNotifyReader struct {
+	io.ReadCloser
+	onClose func()
+}
+
+func (r *closeNotifyReader) Close() error {
+	r.onClose()
+	return r.ReadCloser.Close()
+}
+
+func TestConcurrencyLimitNotExceeded(t *testing.T) {
+	const limit = 3
+
+	inner := &concurrencyTrackingDS{DS: InMemory()}
+	ds := WithConcurrencyLimit(inner, limit)
+	ctx := context.Background()
+
+	err := ds.Update(ctx, emptyBlobNameStatic, bytes.NewReader(nil))
+	require.NoError(t, err)
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			switch i % 4 {
+			case 0:
+				rc, err := ds.Open(ctx, emptyBlobNameStatic)
+				if err == nil {
+					time.Sleep(time.Millisecond)
+					io.ReadAll(rc)
+					rc.Close()
+				}
+			case 1:
+				ds.Update(ctx, emptyBlobNameStatic, bytes.NewReader(nil))
+			case 2:
+				ds.Exists(ctx, emptyBlobNameStatic)
+			case 3:
+				ds.Delete(ctx, emptyBlobNameDynamicLink)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	require.LessOrEqual(t, inner.max.Load(), int32(limit))
+	require.Greater(t, inner.max.Load(), int32(1))
+	require.Zero(t, inner.current.Load())
+}
+
+func TestConcurrencyLimitReaderHoldsSlot(t *testing.T) {
+	ctx := context.Background()
+	ds := WithConcurrencyLimit(InMemory(), 1)
+
+	err := ds.Update(ctx, emptyBlobNameStatic, bytes.NewReader(nil))
+	require.NoError(t, err)
+
+	rc, err := ds.Open(ctx, emptyBlobNameStatic)
+	require.NoError(t, err)
+
+	// The only slot is taken by the opened reader
+	ctxTimeout, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	_, err = ds.Exists(ctxTimeout, emptyBlobNameStatic)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+
+	// Closing twice must release the slot only once
+	require.NoError(t, rc.Close())
+	rc.Close()
+
+	exists, err := ds.Exists(ctx, emptyBlobNameStatic)
+	require.NoError(t, err)
+	require.True(t, exists)
+
+	// Failed open does not hold the slot
+	_, err = ds.Open(ctx, emptyBlobNameDynamicLink)
+	require.ErrorIs(t, err, ErrNotFound)
+
+	exists, err = ds.Exists(ctx, emptyBlobNameDynamicLink)
+	require.NoError(t, err)
+	require.False(t, exists)
+}
+
+func TestConcurrencyLimitCancelledWhileWaiting(t *testing.T) {
+	ctx := context.Background()
+	ds := WithConcurrencyLimit(InMemory(), 1)
+
+	err := ds.Update(ctx, emptyBlobNameStatic, bytes.NewReader(nil))
+	require.NoError(t, err)
+
+	rc, err := ds.Open(ctx, emptyBlobNameStatic)
+	require.NoError(t, err)
+	defer rc.Close()
+
+	cancelledCtx, cancel := context.WithCancel(ctx)
+	cancel()
+
+	_, err = ds.Open(cancelledCtx, emptyBlobNameStatic)
+	require.ErrorIs(t, err, context.Canceled)
+
+	err = ds.Update(cancelledCtx, emptyBlobNameStatic, bytes.NewReader(nil))
+	require.ErrorIs(t, err, context.Canceled)
+
+	_, err = ds.Exists(cancelledCtx, emptyBlobNameStatic)
+	require.ErrorIs(t, err, context.Canceled)
+
+	err = ds.Delete(cancelledCtx, emptyBlobNameStatic)
+	require.ErrorIs(t, err, context.Canceled)
+}
+
+func TestConcurrencyLimitPassthrough(t *testing.T) {
+	inner := InMemory()
+
+	require.Same(t, inner, WithConcurrencyLimit(inner, 0))
+	require.Same(t, inner, WithConcurrencyLimit(inner, -1))
+
+	ds := WithConcurrencyLimit(inner, 1)
+	require.Equal(t, inner.Kind(), ds.Kind())
+	require.Equal(t, inner.Address(), ds.Address())
+}
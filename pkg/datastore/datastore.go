@@ -18,7 +18,10 @@ package datastore
 
 import (
 	"context"
+	"fmt"
 	"io"
+	"iter"
+	"path/filepath"
 
 	"github.com/cinode/go/pkg/blobtypes"
 	"github.com/cinode/go/pkg/common"
@@ -26,6 +29,19 @@ import (
 
 type datastore struct {
 	s storage
+
+	// linkMetrics, if set, receives outcomes of dynamic link updates
+	linkMetrics LinkMetrics
+
+	// uploads coalesces concurrent updates of the same blob, nil if disabled
+	uploads *uploadCoalescer
+}
+
+func newDatastore(s storage) *datastore {
+	return &datastore{
+		s:       s,
+		uploads: newUploadCoalescer(),
+	}
 }
 
 var _ DS = (*datastore)(nil)
@@ -50,6 +66,12 @@ func (ds *datastore) Open(ctx context.Context, name *common.BlobName) (io.ReadCl
 }
 
 func (ds *datastore) Update(ctx context.Context, name *common.BlobName, updateStream io.Reader) error {
+	return ds.uploads.update(ctx, name, updateStream, func() error {
+		return ds.update(ctx, name, updateStream)
+	})
+}
+
+func (ds *datastore) update(ctx context.Context, name *common.BlobName, updateStream io.Reader) error {
 	switch name.Type() {
 	case blobtypes.Static:
 		return ds.updateStatic(ctx, name, updateStream)
@@ -64,28 +86,163 @@ func (ds *datastore) Exists(ctx context.Context, name *common.BlobName) (bool, e
 	return ds.s.exists(ctx, name)
 }
 
+func (ds *datastore) ExistsMany(ctx context.Context, names []*common.BlobName) ([]bool, error) {
+	return existsSequential(ctx, ds.s.exists, names)
+}
+
+func (ds *datastore) Size(ctx context.Context, name *common.BlobName) (int64, error) {
+	return ds.s.size(ctx, name)
+}
+
 func (ds *datastore) Delete(ctx context.Context, name *common.BlobName) error {
 	return ds.s.delete(ctx, name)
 }
 
+func (ds *datastore) List(ctx context.Context) iter.Seq2[*common.BlobName, error] {
+	return ds.s.list(ctx)
+}
+
 // InMemory constructs an in-memory datastore
 //
 // The content is lost if the datastore is destroyed (either by garbage collection
 // or by program termination)
 func InMemory() DS {
-	return &datastore{s: newStorageMemory()}
+	return newDatastore(newStorageMemory())
+}
+
+// InMemoryLRU constructs an in-memory datastore with the total size of static
+// blobs limited to maxBytes. Once the limit is exceeded, least recently used
+// static blobs are removed. Dynamic links are never removed and are not
+// counted towards the limit.
+//
+// The returned datastore implements LRUStatsReporter.
+func InMemoryLRU(maxBytes int64) DS {
+	s := newStorageMemory()
+	s.lru = newMemoryLRU(maxBytes)
+	return &lruMemoryDatastore{
+		datastore: newDatastore(s),
+		lru:       s.lru,
+	}
+}
+
+// FileSystemOption configures the filesystem datastore created with
+// InFileSystem or InFileSystemMmap.
+type FileSystemOption func(fs *fileSystem)
+
+// FileSystemOptionHashedNames makes the datastore store blobs in files
+// named after a keyed hash (HMAC) of the blob name instead of the blob
+// name itself.
+//
+// Names of static blobs are derived from their content, with plain names
+// anyone with access to the filesystem can confirm the presence of a known
+// content. With hashed names such check is not possible without the key.
+// Blob names used through the datastore API remain unchanged, the same
+// key must be used every time the datastore is opened.
+//
+// Since blob names can not be restored from hashes, blobs stored
+// that way can not be listed.
+func FileSystemOptionHashedNames(key []byte) FileSystemOption {
+	return func(fs *fileSystem) { fs.nameKey = append([]byte{}, key...) }
+}
+
+// FileSystemOptionShardDepth sets the number of nested directory levels
+// created from leading characters of the blob name, 3 levels are used
+// by default. Zero depth stores all blobs in a single directory.
+//
+// The layout is not detected when the datastore is opened, changing it for
+// an existing datastore makes stored blobs inaccessible. Existing data must be
+// re-imported, see MigrateFileSystemLayout.
+func FileSystemOptionShardDepth(depth int) FileSystemOption {
+	return func(fs *fileSystem) { fs.shardDepth = depth }
+}
+
+// FileSystemOptionShardWidth sets the number of blob name characters used for
+// a single directory level, 3 characters are used by default.
+//
+// As with the shard depth, changing the width of an existing datastore
+// requires re-importing the data, see MigrateFileSystemLayout.
+func FileSystemOptionShardWidth(width int) FileSystemOption {
+	return func(fs *fileSystem) { fs.shardWidth = width }
 }
 
 // InFileSystem constructs a datastore using filesystem as a storage layer.
 //
 // Contrary to InRawFileSystem, this datastore is optimized for large datastores
 // and concurrent use.
-func InFileSystem(path string) (DS, error) {
+func InFileSystem(path string, opts ...FileSystemOption) (DS, error) {
 	s, err := newStorageFilesystem(path)
 	if err != nil {
 		return nil, err
 	}
-	return &datastore{s: s}, nil
+	return fileSystemDatastore(s, opts)
+}
+
+func fileSystemDatastore(s *fileSystem, opts []FileSystemOption) (DS, error) {
+	for _, o := range opts {
+		o(s)
+	}
+	err := s.validateOptions()
+	if err != nil {
+		return nil, err
+	}
+	return newDatastore(s), nil
+}
+
+// MigrateFileSystemLayout copies all blobs from the InFileSystem datastore
+// at srcPath to the one at dstPath, each opened with its own options. This
+// way the data can be moved to a different shard layout. The source datastore
+// is not modified and can be removed once the migration succeeds.
+//
+// Blobs stored with hashed names can not be listed and thus can not be
+// migrated.
+func MigrateFileSystemLayout(
+	ctx context.Context,
+	srcPath string, srcOpts []FileSystemOption,
+	dstPath string, dstOpts []FileSystemOption,
+) (SyncStats, error) {
+	if filepath.Clean(srcPath) == filepath.Clean(dstPath) {
+		return SyncStats{}, fmt.Errorf(
+			"%w: source and destination path must differ",
+			ErrInvalidDatastorePath,
+		)
+	}
+
+	src, err := InFileSystem(srcPath, srcOpts...)
+	if err != nil {
+		return SyncStats{}, err
+	}
+
+	dst, err := InFileSystem(dstPath, dstOpts...)
+	if err != nil {
+		return SyncStats{}, err
+	}
+
+	return Sync(ctx, src, dst, SyncOptions{})
+}
+
+// InFileSystemMmap constructs a read-only datastore serving blobs from
+// the directory created by InFileSystem, all options must match those used
+// when the datastore was written.
+//
+// Blob files are memory-mapped when opened, the OS page cache is used for
+// caching and readers of the same blob share memory pages. All updates and
+// deletions fail with ErrReadOnly.
+//
+// Memory mapping is used on Linux, macOS and BSD systems, on other platforms
+// (including Windows) blob files are read with regular file reads.
+func InFileSystemMmap(path string, opts ...FileSystemOption) (DS, error) {
+	s, err := newStorageFilesystemMmap(path)
+	if err != nil {
+		return nil, err
+	}
+	for _, o := range opts {
+		o(s.fileSystem)
+	}
+	err = s.validateOptions()
+	if err != nil {
+		return nil, err
+	}
+	return newDatastore(s), nil
 }
 
 // InRawFilesystem is a simplified storage that uses filesystem as a storage layer.
@@ -99,5 +256,5 @@ func InRawFileSystem(path string) (DS, error) {
 	if err != nil {
 		return nil, err
 	}
-	return &datastore{s: s}, nil
+	return newDatastore(s), nil
 }
@@ -46,30 +46,37 @@ func (ds *datastore) openDynamicLink(ctx context.Context, name *common.BlobName)
 	}, nil
 }
 
-// loadCurrentDynamicLink returns existing dynamic link data if present (nil if not found). That link is not meant to be
-// read from - only for comparison
+// newLinkGreaterThanCurrent checks whether the new link data takes precedence
+// over the currently stored one (if there's any). The second returned value is
+// set if the new link data is superseded by the current one - that is false
+// if the new link data is the same as the current one.
 func (ds *datastore) newLinkGreaterThanCurrent(
 	ctx context.Context,
 	name *common.BlobName,
 	newLink *dynamiclink.PublicReader,
 ) (
-	bool, error,
+	greater bool,
+	superseded bool,
+	err error,
 ) {
 	rc, err := ds.s.openReadStream(ctx, name)
 	if errors.Is(err, ErrNotFound) {
-		return true, nil
+		return true, false, nil
 	}
 	if err != nil {
-		return false, err
+		return false, false, err
 	}
 	defer rc.Close()
 
 	dl, err := dynamiclink.FromPublicData(name, rc)
 	if err != nil {
-		return false, err
+		return false, false, err
 	}
 
-	return newLink.GreaterThan(dl), nil
+	if newLink.GreaterThan(dl) {
+		return true, false, nil
+	}
+	return false, dl.GreaterThan(newLink), nil
 }
 
 func (ds *datastore) updateDynamicLink(ctx context.Context, name *common.BlobName, updateStream io.Reader) error {
@@ -85,7 +92,7 @@ func (ds *datastore) updateDynamicLink(ctx context.Context, name *common.BlobNam
 		return err
 	}
 
-	greater, err := ds.newLinkGreaterThanCurrent(ctx, name, updatedLink)
+	greater, superseded, err := ds.newLinkGreaterThanCurrent(ctx, name, updatedLink)
 	if err != nil {
 		return err
 	}
@@ -105,6 +112,12 @@ func (ds *datastore) updateDynamicLink(ctx context.Context, name *common.BlobNam
 		if err != nil {
 			return err
 		}
+
+		if ds.linkMetrics != nil {
+			ds.linkMetrics.IncLinkUpdateAccepted(name)
+		}
+	} else if superseded && ds.linkMetrics != nil {
+		ds.linkMetrics.IncLinkUpdateSuperseded(name)
 	}
 
 	return nil
@@ -24,7 +24,7 @@ import (
 
 	"github.com/cinode/go/pkg/blobtypes"
 	"github.com/cinode/go/pkg/common"
-	"github.com/cinode/go/pkg/internal/utilities/validatingreader"
+	"github.com/cinode/go/pkg/propagation"
 )
 
 func (ds *datastore) openStatic(ctx context.Context, name *common.BlobName) (io.ReadCloser, error) {
@@ -37,12 +37,7 @@ func (ds *datastore) openStatic(ctx context.Context, name *common.BlobName) (io.
 		io.Reader
 		io.Closer
 	}{
-		Reader: validatingreader.NewHashValidation(
-			rc,
-			sha256.New(),
-			name.Hash(),
-			blobtypes.ErrValidationFailed,
-		),
+		Reader: propagation.StaticValidatingReader(name, rc),
 		Closer: rc,
 	}, nil
 }
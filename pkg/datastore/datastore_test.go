@@ -22,6 +22,9 @@ import (
 	"errors"
 	"io"
 	"io/fs"
+	"iter"
+	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/cinode/go/pkg/blobtypes"
@@ -35,7 +38,9 @@ type mockStore struct {
 	fOpenReadStream  func(ctx context.Context, name *common.BlobName) (io.ReadCloser, error)
 	fOpenWriteStream func(ctx context.Context, name *common.BlobName) (WriteCloseCanceller, error)
 	fExists          func(ctx context.Context, name *common.BlobName) (bool, error)
+	fSize            func(ctx context.Context, name *common.BlobName) (int64, error)
 	fDelete          func(ctx context.Context, name *common.BlobName) error
+	fList            func(ctx context.Context) iter.Seq2[*common.BlobName, error]
 }
 
 func (s *mockStore) kind() string {
@@ -53,9 +58,15 @@ func (s *mockStore) openWriteStream(ctx context.Context, name *common.BlobName)
 func (s *mockStore) exists(ctx context.Context, name *common.BlobName) (bool, error) {
 	return s.fExists(ctx, name)
 }
+func (s *mockStore) size(ctx context.Context, name *common.BlobName) (int64, error) {
+	return s.fSize(ctx, name)
+}
 func (s *mockStore) delete(ctx context.Context, name *common.BlobName) error {
 	return s.fDelete(ctx, name)
 }
+func (s *mockStore) list(ctx context.Context) iter.Seq2[*common.BlobName, error] {
+	return s.fList(ctx)
+}
 
 type mockWriteCloseCanceller struct {
 	fWrite  func([]byte) (int, error)
@@ -151,3 +162,57 @@ func TestInvalidInRawFileSystemParameters(t *testing.T) {
 	require.IsType(t, &fs.PathError{}, err)
 	require.Nil(t, ds)
 }
+
+func TestFileSystemConfigValidation(t *testing.T) {
+	for _, d := range []struct {
+		name string
+		f    func(path string) (DS, error)
+	}{
+		{"InFileSystem", func(path string) (DS, error) { return InFileSystem(path) }},
+		{"InRawFileSystem", InRawFileSystem},
+	} {
+		t.Run(d.name, func(t *testing.T) {
+			t.Run("empty path", func(t *testing.T) {
+				ds, err := d.f("")
+				require.ErrorIs(t, err, ErrInvalidDatastorePath)
+				require.Nil(t, ds)
+			})
+
+			t.Run("missing directory is created", func(t *testing.T) {
+				path := filepath.Join(t.TempDir(), "sub", "dir")
+				ds, err := d.f(path)
+				require.NoError(t, err)
+				require.NotNil(t, ds)
+				require.DirExists(t, path)
+
+				entries, err := os.ReadDir(path)
+				require.NoError(t, err)
+				require.Empty(t, entries)
+			})
+
+			t.Run("path is a file", func(t *testing.T) {
+				path := filepath.Join(t.TempDir(), "file")
+				require.NoError(t, os.WriteFile(path, nil, 0644))
+
+				ds, err := d.f(path)
+				require.ErrorContains(t, err, path)
+				require.Nil(t, ds)
+			})
+
+			t.Run("unwritable directory", func(t *testing.T) {
+				if os.Geteuid() == 0 {
+					t.Skip("directory permissions are not enforced for root")
+				}
+
+				path := t.TempDir()
+				require.NoError(t, os.Chmod(path, 0555))
+				defer os.Chmod(path, 0755)
+
+				ds, err := d.f(path)
+				require.ErrorIs(t, err, ErrInvalidDatastorePath)
+				require.ErrorContains(t, err, "not writable")
+				require.Nil(t, ds)
+			})
+		})
+	}
+}
@@ -0,0 +1,232 @@
+/*
+Copyright © 2022 Bartłomiej Święcki (byo)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package datastore
+
+import (
+	"context"
+	"errors"
+	"io"
+	"iter"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/cinode/go/pkg/blobtypes"
+	"github.com/cinode/go/pkg/common"
+	"github.com/cinode/go/pkg/utilities/progress"
+)
+
+var (
+	ErrDryRunDataDiscarded = errors.New("data of static blobs written in dry-run mode is not kept")
+)
+
+// DryRunReporter is implemented by datastores created with DryRun
+type DryRunReporter interface {
+	// WrittenBlobs returns names of blobs that would be written to the
+	// datastore, sorted by name
+	WrittenBlobs() []*common.BlobName
+}
+
+type dryRunDatastore struct {
+	backend DS
+
+	// links keeps dynamic links written in dry-run mode, those are small
+	// and further updates of the same link must be merged with them
+	links DS
+
+	m       sync.Mutex
+	written map[string]dryRunBlob
+	deleted map[string]struct{}
+}
+
+type dryRunBlob struct {
+	name *common.BlobName
+	size int64
+}
+
+var _ DS = (*dryRunDatastore)(nil)
+var _ DryRunReporter = (*dryRunDatastore)(nil)
+
+// DryRun returns a datastore that does not modify the given backend datastore.
+// Names and sizes of updated blobs are recorded, data of static blobs is
+// validated and discarded - such blobs are reported as existing but opening
+// them fails with ErrDryRunDataDiscarded unless the backend already contains
+// them. Dynamic links are kept in memory. Deleted blobs are hidden but are
+// not removed from the backend.
+//
+// The returned datastore implements DryRunReporter.
+func DryRun(backend DS) DS {
+	return &dryRunDatastore{
+		backend: backend,
+		links:   InMemory(),
+		written: map[string]dryRunBlob{},
+		deleted: map[string]struct{}{},
+	}
+}
+
+func (d *dryRunDatastore) Kind() string {
+	return "DryRun"
+}
+
+func (d *dryRunDatastore) Address() string {
+	return d.backend.Address()
+}
+
+func (d *dryRunDatastore) state(name *common.BlobName) (blob dryRunBlob, written, deleted bool) {
+	d.m.Lock()
+	defer d.m.Unlock()
+
+	blob, written = d.written[name.String()]
+	_, deleted = d.deleted[name.String()]
+	return blob, written, deleted
+}
+
+func (d *dryRunDatastore) Open(ctx context.Context, name *common.BlobName) (io.ReadCloser, error) {
+	_, written, deleted := d.state(name)
+	switch {
+	case deleted:
+		return nil, ErrNotFound
+	case written && name.Type() == blobtypes.DynamicLink:
+		return d.links.Open(ctx, name)
+	}
+
+	rc, err := d.backend.Open(ctx, name)
+	if written && errors.Is(err, ErrNotFound) {
+		return nil, ErrDryRunDataDiscarded
+	}
+	return rc, err
+}
+
+func (d *dryRunDatastore) Update(ctx context.Context, name *common.BlobName, r io.Reader) error {
+	var size int64
+	switch name.Type() {
+	case blobtypes.Static:
+		c := progress.NewCounter(0, nil)
+		err := validateStaticData(name, c.Reader(r))
+		if err != nil {
+			return err
+		}
+		size = c.N()
+
+	case blobtypes.DynamicLink:
+		err := d.links.Update(ctx, name, r)
+		if err != nil {
+			return err
+		}
+		size, err = d.links.Size(ctx, name)
+		if err != nil {
+			return err
+		}
+
+	default:
+		return blobtypes.ErrUnknownBlobType
+	}
+
+	d.m.Lock()
+	defer d.m.Unlock()
+
+	d.written[name.String()] = dryRunBlob{name: name, size: size}
+	delete(d.deleted, name.String())
+	return nil
+}
+
+func (d *dryRunDatastore) Exists(ctx context.Context, name *common.BlobName) (bool, error) {
+	_, written, deleted := d.state(name)
+	if written || deleted {
+		return written, nil
+	}
+	return d.backend.Exists(ctx, name)
+}
+
+func (d *dryRunDatastore) ExistsMany(ctx context.Context, names []*common.BlobName) ([]bool, error) {
+	return existsSequential(ctx, d.Exists, names)
+}
+
+func (d *dryRunDatastore) Size(ctx context.Context, name *common.BlobName) (int64, error) {
+	blob, written, deleted := d.state(name)
+	switch {
+	case deleted:
+		return 0, ErrNotFound
+	case written:
+		return blob.size, nil
+	}
+	return d.backend.Size(ctx, name)
+}
+
+func (d *dryRunDatastore) Delete(ctx context.Context, name *common.BlobName) error {
+	exists, err := d.Exists(ctx, name)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return ErrNotFound
+	}
+
+	if name.Type() == blobtypes.DynamicLink {
+		err = d.links.Delete(ctx, name)
+		if err != nil && !errors.Is(err, ErrNotFound) {
+			return err
+		}
+	}
+
+	d.m.Lock()
+	defer d.m.Unlock()
+
+	d.deleted[name.String()] = struct{}{}
+	delete(d.written, name.String())
+	return nil
+}
+
+func (d *dryRunDatastore) List(ctx context.Context) iter.Seq2[*common.BlobName, error] {
+	return func(yield func(*common.BlobName, error) bool) {
+		written := d.WrittenBlobs()
+		seen := map[string]struct{}{}
+		for _, name := range written {
+			seen[name.String()] = struct{}{}
+			if !yield(name, nil) {
+				return
+			}
+		}
+
+		for name, err := range d.backend.List(ctx) {
+			if err == nil {
+				_, _, deleted := d.state(name)
+				_, found := seen[name.String()]
+				if found || deleted {
+					continue
+				}
+			}
+			if !yield(name, err) || err != nil {
+				return
+			}
+		}
+	}
+}
+
+func (d *dryRunDatastore) WrittenBlobs() []*common.BlobName {
+	d.m.Lock()
+	defer d.m.Unlock()
+
+	ret := make([]*common.BlobName, 0, len(d.written))
+	for _, blob := range d.written {
+		ret = append(ret, blob.name)
+	}
+	slices.SortFunc(ret, func(a, b *common.BlobName) int {
+		return strings.Compare(a.String(), b.String())
+	})
+	return ret
+}
@@ -0,0 +1,126 @@
+/*
+Copyright © 2022 Bartłomiej Święcki (byo)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package datastore
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+
+	"github.com/cinode/go/pkg/blobtypes"
+	"github.com/cinode/go/pkg/common"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDryRun(t *testing.T) {
+	ctx := context.Background()
+
+	backend := InMemory()
+	require.NoError(t, backend.Update(ctx, testBlobs[0].name, bytes.NewReader(testBlobs[0].data)))
+
+	ds := DryRun(backend)
+	require.Empty(t, ds.(DryRunReporter).WrittenBlobs())
+
+	for _, b := range testBlobs[1:3] {
+		require.NoError(t, ds.Update(ctx, b.name, bytes.NewReader(b.data)))
+	}
+
+	// Backend is not modified
+	for _, b := range testBlobs[1:3] {
+		exists, err := backend.Exists(ctx, b.name)
+		require.NoError(t, err)
+		require.False(t, exists)
+	}
+
+	// Data of written static blobs is not kept, only names and sizes
+	for _, b := range testBlobs[1:3] {
+		exists, err := ds.Exists(ctx, b.name)
+		require.NoError(t, err)
+		require.True(t, exists)
+
+		size, err := ds.Size(ctx, b.name)
+		require.NoError(t, err)
+		require.EqualValues(t, len(b.data), size)
+
+		_, err = ds.Open(ctx, b.name)
+		require.ErrorIs(t, err, ErrDryRunDataDiscarded)
+	}
+
+	// Backend blobs can be read
+	rc, err := ds.Open(ctx, testBlobs[0].name)
+	require.NoError(t, err)
+	data, err := io.ReadAll(rc)
+	require.NoError(t, err)
+	require.NoError(t, rc.Close())
+	require.Equal(t, testBlobs[0].data, data)
+
+	// Invalid data is rejected
+	err = ds.Update(ctx, testBlobs[3].name, bytes.NewReader(testBlobs[1].data))
+	require.ErrorIs(t, err, blobtypes.ErrValidationFailed)
+
+	written := ds.(DryRunReporter).WrittenBlobs()
+	require.Len(t, written, 2)
+	require.ElementsMatch(t,
+		[]*common.BlobName{testBlobs[1].name, testBlobs[2].name},
+		written,
+	)
+	require.Less(t, written[0].String(), written[1].String())
+
+	// Deleted backend blobs are hidden but not removed
+	require.NoError(t, ds.Delete(ctx, testBlobs[0].name))
+	_, err = ds.Open(ctx, testBlobs[0].name)
+	require.ErrorIs(t, err, ErrNotFound)
+	exists, err := backend.Exists(ctx, testBlobs[0].name)
+	require.NoError(t, err)
+	require.True(t, exists)
+
+	names := []string{}
+	for name, err := range ds.List(ctx) {
+		require.NoError(t, err)
+		names = append(names, name.String())
+	}
+	require.ElementsMatch(t, []string{testBlobs[1].name.String(), testBlobs[2].name.String()}, names)
+}
+
+func TestDryRunDynamicLink(t *testing.T) {
+	ctx := context.Background()
+
+	backend := InMemory()
+	ds := DryRun(backend)
+
+	// Newer link versions replace those written earlier
+	for _, b := range dynamicLinkPropagationData[:2] {
+		require.NoError(t, ds.Update(ctx, b.name, bytes.NewReader(b.data)))
+
+		rc, err := ds.Open(ctx, b.name)
+		require.NoError(t, err)
+		data, err := io.ReadAll(rc)
+		require.NoError(t, err)
+		require.NoError(t, rc.Close())
+		require.Equal(t, b.data, data)
+
+		size, err := ds.Size(ctx, b.name)
+		require.NoError(t, err)
+		require.EqualValues(t, len(data), size)
+	}
+
+	exists, err := backend.Exists(ctx, dynamicLinkPropagationData[0].name)
+	require.NoError(t, err)
+	require.False(t, exists)
+	require.Len(t, ds.(DryRunReporter).WrittenBlobs(), 1)
+}
@@ -19,5 +19,8 @@ package datastore
 import "errors"
 
 var (
-	ErrUploadInProgress = errors.New("another upload is already in progress")
+	ErrUploadInProgress     = errors.New("another upload is already in progress")
+	ErrInvalidDatastorePath = errors.New("invalid datastore path")
+	ErrReadOnly             = errors.New("datastore is read-only")
+	ErrInvalidShardLayout   = errors.New("invalid filesystem shard layout")
 )
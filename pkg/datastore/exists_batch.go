@@ -0,0 +1,72 @@
+/*
+Copyright © 2022 Bartłomiej Święcki (byo)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package datastore
+
+import (
+	"context"
+	"errors"
+
+	"github.com/cinode/go/pkg/common"
+)
+
+const (
+	// webExistsBatchMaxNames is the maximum number of names sent in a single
+	// exists batch request to the web interface
+	webExistsBatchMaxNames = 10000
+)
+
+var (
+	ErrExistsBatchTooLarge = errors.New("too many blob names in a single exists batch")
+)
+
+// existsSequential implements ExistsMany for datastores that can only check
+// blobs one by one
+func existsSequential(
+	ctx context.Context,
+	exists func(ctx context.Context, name *common.BlobName) (bool, error),
+	names []*common.BlobName,
+) ([]bool, error) {
+	ret := make([]bool, len(names))
+	for i, name := range names {
+		var err error
+		ret[i], err = exists(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return ret, nil
+}
+
+// existsBitmap encodes results of the exists batch, i-th result is stored
+// in the (i%8)-th least significant bit of the (i/8)-th byte
+func existsBitmap(exists []bool) []byte {
+	ret := make([]byte, (len(exists)+7)/8)
+	for i, e := range exists {
+		if e {
+			ret[i/8] |= 1 << (i % 8)
+		}
+	}
+	return ret
+}
+
+func existsFromBitmap(bitmap []byte, n int) []bool {
+	ret := make([]bool, n)
+	for i := range ret {
+		ret[i] = bitmap[i/8]&(1<<(i%8)) != 0
+	}
+	return ret
+}
@@ -0,0 +1,158 @@
+/*
+Copyright © 2022 Bartłomiej Święcki (byo)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package datastore
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/cinode/go/pkg/blobtypes"
+	"github.com/cinode/go/pkg/common"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExistsBitmap(t *testing.T) {
+	for _, n := range []int{0, 1, 7, 8, 9, 17} {
+		t.Run(fmt.Sprint(n), func(t *testing.T) {
+			exists := make([]bool, n)
+			for i := range exists {
+				exists[i] = i%3 == 0
+			}
+			bitmap := existsBitmap(exists)
+			require.Len(t, bitmap, (n+7)/8)
+			require.Equal(t, exists, existsFromBitmap(bitmap, n))
+		})
+	}
+
+	require.Equal(t, []byte{0x05, 0x01}, existsBitmap([]bool{
+		true, false, true, false, false, false, false, false,
+		true,
+	}))
+}
+
+func generateStaticNames(t *testing.T, n int) []*common.BlobName {
+	names := make([]*common.BlobName, n)
+	for i := range names {
+		hash := sha256.Sum256([]byte(fmt.Sprint(i)))
+		name, err := common.BlobNameFromHashAndType(hash[:], blobtypes.Static)
+		require.NoError(t, err)
+		names[i] = name
+	}
+	return names
+}
+
+func TestWebExistsBatch(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("names split into multiple requests", func(t *testing.T) {
+		backend := InMemory()
+		handler := WebInterface(backend)
+
+		batches := atomic.Int32{}
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == http.MethodPost {
+				batches.Add(1)
+			}
+			handler.ServeHTTP(w, r)
+		}))
+		t.Cleanup(server.Close)
+
+		ds, err := FromWeb(server.URL + "/")
+		require.NoError(t, err)
+
+		err = ds.Update(ctx, testBlobs[0].name, strings.NewReader(string(testBlobs[0].data)))
+		require.NoError(t, err)
+
+		names := append(generateStaticNames(t, webExistsBatchMaxNames), testBlobs[0].name)
+		exists, err := ds.ExistsMany(ctx, names)
+		require.NoError(t, err)
+		require.Len(t, exists, len(names))
+		require.EqualValues(t, 2, batches.Load())
+		for i := range exists[:len(exists)-1] {
+			require.False(t, exists[i])
+		}
+		require.True(t, exists[len(exists)-1])
+	})
+
+	t.Run("fallback when batches are not supported", func(t *testing.T) {
+		handler := WebInterface(InMemory())
+		heads := atomic.Int32{}
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.Method {
+			case http.MethodPost:
+				http.Error(w, "Unsupported method", http.StatusMethodNotAllowed)
+				return
+			case http.MethodHead:
+				heads.Add(1)
+			}
+			handler.ServeHTTP(w, r)
+		}))
+		t.Cleanup(server.Close)
+
+		ds, err := FromWeb(server.URL + "/")
+		require.NoError(t, err)
+
+		err = ds.Update(ctx, testBlobs[1].name, strings.NewReader(string(testBlobs[1].data)))
+		require.NoError(t, err)
+
+		exists, err := ds.ExistsMany(ctx, []*common.BlobName{testBlobs[0].name, testBlobs[1].name})
+		require.NoError(t, err)
+		require.Equal(t, []bool{false, true}, exists)
+		require.EqualValues(t, 2, heads.Load())
+	})
+
+	t.Run("invalid response length", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte{0xFF, 0xFF})
+		}))
+		t.Cleanup(server.Close)
+
+		ds, err := FromWeb(server.URL + "/")
+		require.NoError(t, err)
+
+		_, err = ds.ExistsMany(ctx, generateStaticNames(t, 3))
+		require.ErrorIs(t, err, ErrWebConnectionError)
+	})
+
+	t.Run("invalid requests", func(t *testing.T) {
+		url := testServer(t)
+
+		testHTTPResponseOwnServer(t, http.MethodPost, url+"?exists-batch", strings.NewReader(""), http.StatusOK)
+		testHTTPResponseOwnServer(t, http.MethodPost, url+"?exists-batch", strings.NewReader("invalid\n"), http.StatusBadRequest)
+		testHTTPResponseOwnServer(t, http.MethodPost, url+"?exists-batch=1", strings.NewReader(""), http.StatusMethodNotAllowed)
+		testHTTPResponseOwnServer(t, http.MethodPost, url+emptyBlobNameStatic.String(), strings.NewReader(""), http.StatusMethodNotAllowed)
+
+		body := strings.Builder{}
+		for _, name := range generateStaticNames(t, webExistsBatchMaxNames+1) {
+			body.WriteString(name.String() + "\n")
+		}
+		req, err := http.NewRequest(http.MethodPost, url+"?exists-batch", strings.NewReader(body.String()))
+		require.NoError(t, err)
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+
+		w := &webConnector{}
+		require.ErrorIs(t, w.errCheck(resp), ErrExistsBatchTooLarge)
+	})
+}
@@ -24,6 +24,7 @@ import (
 const (
 	filePrefix     = "file://"
 	rawFilePrefix  = "file-raw://"
+	fileMmapPrefix = "file-mmap://"
 	webPrefixHttp  = "http://"
 	webPrefixHttps = "https://"
 	memoryPrefix   = "memory://"
@@ -38,17 +39,39 @@ var (
 // The string may be of the following form:
 //   - file://<path> - create datastore using local filesystem's path (optimized) as the storage, see InFileSystem for more details
 //   - file-raw://<path> - create datastore using local filesystem's path (simplified) as the storage, see InRawFileSystem for more details
+//   - file-mmap://<path> - create read-only datastore serving memory-mapped files from local filesystem's path, see InFileSystemMmap for more details
 //   - http://<address> or https://<address> - connects to datastore exposed through a http protocol, see FromWeb for more details
 //   - memory:// - creates a local in-process datastore without persistent storage
 //   - <path> - equivalent to file://<path>
 func FromLocation(location string) (DS, error) {
+	return fromLocation(location, true)
+}
+
+// FromExistingLocation works like FromLocation but never creates or modifies
+// the storage when opening it. Local directories must already exist,
+// an error matching fs.ErrNotExist is returned otherwise.
+func FromExistingLocation(location string) (DS, error) {
+	return fromLocation(location, false)
+}
+
+func fromLocation(location string, create bool) (DS, error) {
 	switch {
 	case strings.HasPrefix(location, filePrefix):
-		return InFileSystem(location[len(filePrefix):])
+		return fileSystemFromLocation(location[len(filePrefix):], create)
 
 	case strings.HasPrefix(location, rawFilePrefix):
+		if !create {
+			s, err := existingStorageRawFilesystem(location[len(rawFilePrefix):])
+			if err != nil {
+				return nil, err
+			}
+			return newDatastore(s), nil
+		}
 		return InRawFileSystem(location[len(rawFilePrefix):])
 
+	case strings.HasPrefix(location, fileMmapPrefix):
+		return InFileSystemMmap(location[len(fileMmapPrefix):])
+
 	case strings.HasPrefix(location, webPrefixHttp),
 		strings.HasPrefix(location, webPrefixHttps):
 		return FromWeb(location)
@@ -60,6 +83,18 @@ func FromLocation(location string) (DS, error) {
 		return InMemory(), nil
 
 	default:
-		return InFileSystem(location)
+		return fileSystemFromLocation(location, create)
+	}
+}
+
+func fileSystemFromLocation(path string, create bool) (DS, error) {
+	if create {
+		return InFileSystem(path)
+	}
+
+	s, err := existingStorageFilesystem(path)
+	if err != nil {
+		return nil, err
 	}
+	return fileSystemDatastore(s, nil)
 }
@@ -17,6 +17,9 @@ limitations under the License.
 package datastore
 
 import (
+	"io/fs"
+	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/stretchr/testify/require"
@@ -51,3 +54,33 @@ func TestNewFromLocation(t *testing.T) {
 		require.Nil(t, ds)
 	})
 }
+
+func TestNewFromExistingLocation(t *testing.T) {
+	for _, prefix := range []string{"file://", "file-raw://", ""} {
+		t.Run("existing directory "+prefix, func(t *testing.T) {
+			dir := t.TempDir()
+			ds, err := FromExistingLocation(prefix + dir)
+			require.NoError(t, err)
+			require.NotNil(t, ds)
+
+			// Nothing is written when opening the datastore
+			entries, err := os.ReadDir(dir)
+			require.NoError(t, err)
+			require.Empty(t, entries)
+		})
+
+		t.Run("missing directory "+prefix, func(t *testing.T) {
+			dir := filepath.Join(t.TempDir(), "missing")
+			ds, err := FromExistingLocation(prefix + dir)
+			require.ErrorIs(t, err, fs.ErrNotExist)
+			require.Nil(t, ds)
+
+			_, err = os.Stat(dir)
+			require.ErrorIs(t, err, fs.ErrNotExist)
+		})
+	}
+
+	ds, err := FromExistingLocation("memory://")
+	require.NoError(t, err)
+	require.IsType(t, &datastore{}, ds)
+}
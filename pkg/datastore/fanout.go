@@ -0,0 +1,110 @@
+/*
+Copyright © 2022 Bartłomiej Święcki (byo)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package datastore
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"time"
+
+	"github.com/cinode/go/pkg/blobtypes"
+	"github.com/cinode/go/pkg/common"
+)
+
+const (
+	// defaultFanoutRefreshTime is the time after which blobs backfilled
+	// by the fanout datastore are looked up again in fallback datastores
+	defaultFanoutRefreshTime = time.Hour
+)
+
+// NewFanout creates a datastore that reads blobs from the primary datastore
+// first and, if the blob is not found there, queries fallback datastores
+// in order. Dynamic links are read from all datastores, the newest valid
+// version is returned. Blobs are written and deleted in the primary
+// datastore only.
+//
+// This is a multi-source datastore (see NewMultiSource) that does not store
+// blobs found in fallback datastores in the primary one.
+func NewFanout(primary DS, fallbacks ...DS) DS {
+	ds := NewMultiSource(primary, defaultFanoutRefreshTime, fallbacks...).(*multiSourceDatastore)
+	ds.readThrough = true
+	return ds
+}
+
+// NewFanoutWithBackfill creates a fanout datastore that, in addition to what
+// NewFanout does, stores blobs found in fallback datastores in the primary one.
+//
+// This is a multi-source datastore (see NewMultiSource) refreshing dynamic
+// links once per hour. Failures of fallback datastores are logged, the blob
+// is then read from the primary datastore only.
+func NewFanoutWithBackfill(primary DS, fallbacks ...DS) DS {
+	return NewMultiSource(primary, defaultFanoutRefreshTime, fallbacks...)
+}
+
+func (m *multiSourceDatastore) sources() []DS {
+	return append([]DS{m.main}, m.additional...)
+}
+
+func (m *multiSourceDatastore) openReadThrough(ctx context.Context, name *common.BlobName) (io.ReadCloser, error) {
+	if name.Type() == blobtypes.DynamicLink {
+		_, newest := m.readLinkVersions(ctx, m.sources(), name)
+		if newest == nil {
+			return nil, ErrNotFound
+		}
+		return io.NopCloser(bytes.NewReader(newest.data)), nil
+	}
+
+	for _, ds := range m.sources() {
+		rc, err := ds.Open(ctx, name)
+		if errors.Is(err, ErrNotFound) {
+			continue
+		}
+		return rc, err
+	}
+	return nil, ErrNotFound
+}
+
+func (m *multiSourceDatastore) existsReadThrough(ctx context.Context, name *common.BlobName) (bool, error) {
+	for _, ds := range m.sources() {
+		exists, err := ds.Exists(ctx, name)
+		if err != nil || exists {
+			return exists, err
+		}
+	}
+	return false, nil
+}
+
+func (m *multiSourceDatastore) sizeReadThrough(ctx context.Context, name *common.BlobName) (int64, error) {
+	if name.Type() == blobtypes.DynamicLink {
+		_, newest := m.readLinkVersions(ctx, m.sources(), name)
+		if newest == nil {
+			return 0, ErrNotFound
+		}
+		return int64(len(newest.data)), nil
+	}
+
+	for _, ds := range m.sources() {
+		size, err := ds.Size(ctx, name)
+		if errors.Is(err, ErrNotFound) {
+			continue
+		}
+		return size, err
+	}
+	return 0, ErrNotFound
+}
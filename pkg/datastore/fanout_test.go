@@ -0,0 +1,167 @@
+/*
+Copyright © 2022 Bartłomiej Święcki (byo)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package datastore
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/cinode/go/pkg/common"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFanout(t *testing.T) {
+	ctx := context.Background()
+
+	readBlob := func(t *testing.T, ds DS, name *common.BlobName) []byte {
+		rc, err := ds.Open(ctx, name)
+		require.NoError(t, err)
+		defer rc.Close()
+		data, err := io.ReadAll(rc)
+		require.NoError(t, err)
+		return data
+	}
+
+	setup := func(t *testing.T) (primary, fallback1, fallback2 DS) {
+		primary, fallback1, fallback2 = InMemory(), InMemory(), InMemory()
+		for _, d := range []struct {
+			ds DS
+			b  int
+		}{{primary, 0}, {fallback1, 1}, {fallback2, 1}, {fallback2, 2}} {
+			b := testBlobs[d.b]
+			require.NoError(t, d.ds.Update(ctx, b.name, bytes.NewReader(b.data)))
+		}
+		return primary, fallback1, fallback2
+	}
+
+	t.Run("reads fall through to fallbacks", func(t *testing.T) {
+		primary, fallback1, fallback2 := setup(t)
+		ds := NewFanout(primary, fallback1, fallback2)
+
+		for _, b := range testBlobs[:3] {
+			require.Equal(t, b.data, readBlob(t, ds, b.name))
+
+			exists, err := ds.Exists(ctx, b.name)
+			require.NoError(t, err)
+			require.True(t, exists)
+
+			size, err := ds.Size(ctx, b.name)
+			require.NoError(t, err)
+			require.EqualValues(t, len(b.data), size)
+		}
+
+		_, err := ds.Open(ctx, testBlobs[3].name)
+		require.ErrorIs(t, err, ErrNotFound)
+
+		_, err = ds.Size(ctx, testBlobs[3].name)
+		require.ErrorIs(t, err, ErrNotFound)
+
+		exists, err := ds.Exists(ctx, testBlobs[3].name)
+		require.NoError(t, err)
+		require.False(t, exists)
+
+		// Without backfill, the primary datastore is not modified
+		exists, err = primary.Exists(ctx, testBlobs[1].name)
+		require.NoError(t, err)
+		require.False(t, exists)
+	})
+
+	t.Run("writes go to the primary datastore only", func(t *testing.T) {
+		primary, fallback1, fallback2 := setup(t)
+		ds := NewFanout(primary, fallback1, fallback2)
+
+		b := testBlobs[3]
+		require.NoError(t, ds.Update(ctx, b.name, bytes.NewReader(b.data)))
+		require.Equal(t, b.data, readBlob(t, primary, b.name))
+
+		for _, fb := range []DS{fallback1, fallback2} {
+			exists, err := fb.Exists(ctx, b.name)
+			require.NoError(t, err)
+			require.False(t, exists)
+		}
+
+		// Blobs from fallback datastores can not be deleted
+		require.ErrorIs(t, ds.Delete(ctx, testBlobs[1].name), ErrNotFound)
+		exists, err := fallback1.Exists(ctx, testBlobs[1].name)
+		require.NoError(t, err)
+		require.True(t, exists)
+	})
+
+	t.Run("backfill", func(t *testing.T) {
+		primary, fallback1, fallback2 := setup(t)
+		ds := NewFanoutWithBackfill(primary, fallback1, fallback2)
+
+		for _, b := range testBlobs[:3] {
+			require.Equal(t, b.data, readBlob(t, ds, b.name))
+			require.Equal(t, b.data, readBlob(t, primary, b.name))
+		}
+	})
+
+	t.Run("fallback error", func(t *testing.T) {
+		injectedErr := errors.New("open error")
+		ds := NewFanout(InMemory(), &datastore{s: &mockStore{
+			fOpenReadStream: func(ctx context.Context, name *common.BlobName) (io.ReadCloser, error) {
+				return nil, injectedErr
+			},
+		}}, InMemory())
+
+		_, err := ds.Open(ctx, testBlobs[0].name)
+		require.ErrorIs(t, err, injectedErr)
+	})
+
+	t.Run("backfill error", func(t *testing.T) {
+		injectedErr := errors.New("update error")
+		primary := &datastore{s: &mockStore{
+			fExists: func(ctx context.Context, name *common.BlobName) (bool, error) {
+				return false, nil
+			},
+			fOpenReadStream: func(ctx context.Context, name *common.BlobName) (io.ReadCloser, error) {
+				return nil, ErrNotFound
+			},
+			fOpenWriteStream: func(ctx context.Context, name *common.BlobName) (WriteCloseCanceller, error) {
+				return nil, injectedErr
+			},
+		}}
+		_, fallback1, _ := setup(t)
+		ds := NewFanoutWithBackfill(primary, fallback1)
+
+		// Blobs are only served from the primary datastore
+		_, err := ds.Open(ctx, testBlobs[1].name)
+		require.ErrorIs(t, err, ErrNotFound)
+	})
+
+	t.Run("newest link version", func(t *testing.T) {
+		older, newer := dynamicLinkPropagationData[0], dynamicLinkPropagationData[1]
+
+		primary, fallback := InMemory(), InMemory()
+		require.NoError(t, primary.Update(ctx, older.name, bytes.NewReader(older.data)))
+		require.NoError(t, fallback.Update(ctx, newer.name, bytes.NewReader(newer.data)))
+
+		ds := NewFanout(primary, fallback)
+		require.Equal(t, newer.data, readBlob(t, ds, newer.name))
+
+		size, err := ds.Size(ctx, newer.name)
+		require.NoError(t, err)
+		require.EqualValues(t, len(newer.data), size)
+
+		// Without backfill, the primary datastore keeps the older version
+		require.Equal(t, older.data, readBlob(t, primary, older.name))
+	})
+}
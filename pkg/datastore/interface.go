@@ -20,6 +20,7 @@ import (
 	"context"
 	"errors"
 	"io"
+	"iter"
 
 	"github.com/cinode/go/pkg/common"
 )
@@ -80,6 +81,18 @@ type DS interface {
 	// that there was an error while trying to check blob's existence.
 	Exists(ctx context.Context, name *common.BlobName) (bool, error)
 
+	// ExistsMany checks the existence of multiple blobs at once, the i-th
+	// element of the result corresponds to the i-th name. Datastores that
+	// can not check multiple blobs at once check them one by one.
+	ExistsMany(ctx context.Context, names []*common.BlobName) ([]bool, error)
+
+	// Size returns the size in bytes of the blob data, that is the number
+	// of bytes that would be read from the stream returned by Open. For
+	// dynamic links it is the size of the stored public dataset. In case
+	// blob is not found in datastore, returned error must be of
+	// ErrNotFound type.
+	Size(ctx context.Context, name *common.BlobName) (int64, error)
+
 	// Delete tries to remove blob with given name from the datastore.
 	// If blob does not exist (which includes partially written blobs)
 	// ErrNotFound will be returned. If blob is being opened at the moment
@@ -88,4 +101,11 @@ type DS interface {
 	// the blob with the `Open` should end up with an ErrNotFound error
 	// until the blob is updated again with a successful `Update` call.
 	Delete(ctx context.Context, name *common.BlobName) error
+
+	// List enumerates names of all blobs stored in the datastore. Names are
+	// returned lazily while iterating, partially written blobs are not
+	// included. Blobs added or removed while iterating may or may not be
+	// reported. An error stops the iteration, datastores that can not
+	// enumerate blobs report ErrListNotSupported.
+	List(ctx context.Context) iter.Seq2[*common.BlobName, error]
 }
@@ -59,16 +59,51 @@ func TestDatastoreTestSuite(t *testing.T) {
 		})
 	})
 
+	t.Run("InFileSystemHashedNames", func(t *testing.T) {
+		suite.Run(t, &DatastoreTestSuite{
+			createDS: func() (DS, error) {
+				return InFileSystem(t.TempDir(), FileSystemOptionHashedNames([]byte("secret")))
+			},
+		})
+	})
+
 	t.Run("InRawFileSystem", func(t *testing.T) {
 		suite.Run(t, &DatastoreTestSuite{
 			createDS: func() (DS, error) { return InRawFileSystem(t.TempDir()) },
 		})
 	})
 
+	t.Run("WithConcurrencyLimit", func(t *testing.T) {
+		suite.Run(t, &DatastoreTestSuite{
+			createDS: func() (DS, error) { return WithConcurrencyLimit(InMemory(), 2), nil },
+		})
+	})
+
+	t.Run("InMemoryLRU", func(t *testing.T) {
+		suite.Run(t, &DatastoreTestSuite{
+			createDS: func() (DS, error) { return InMemoryLRU(1 << 20), nil },
+		})
+	})
+
+	t.Run("WithCache", func(t *testing.T) {
+		suite.Run(t, &DatastoreTestSuite{
+			createDS: func() (DS, error) { return WithCache(InMemory(), InMemory()), nil },
+		})
+	})
+
+	t.Run("NewFanout", func(t *testing.T) {
+		suite.Run(t, &DatastoreTestSuite{
+			createDS: func() (DS, error) { return NewFanout(InMemory(), InMemory()), nil },
+		})
+	})
+
 	t.Run("FromWeb", func(t *testing.T) {
 		suite.Run(t, &DatastoreTestSuite{
 			createDS: func() (DS, error) {
-				server := httptest.NewServer(WebInterface(InMemory()))
+				server := httptest.NewServer(WebInterface(
+					InMemory(),
+					WebInterfaceOptionAllowList(),
+				))
 				t.Cleanup(func() { server.Close() })
 
 				return FromWeb(server.URL + "/")
@@ -244,6 +279,117 @@ func (s *DatastoreTestSuite) TestDeleteExisting() {
 	s.Require().Nil(r)
 }
 
+func (s *DatastoreTestSuite) TestList() {
+	ctx := context.Background()
+
+	listed := func() ([]string, error) {
+		names := []string{}
+		for name, err := range s.ds.List(ctx) {
+			if err != nil {
+				return nil, err
+			}
+			names = append(names, name.String())
+		}
+		return names, nil
+	}
+
+	names, err := listed()
+	if errors.Is(err, ErrListNotSupported) {
+		s.T().Skip("Listing not supported")
+	}
+	s.Require().NoError(err)
+	s.Require().Empty(names)
+
+	expected := []string{}
+	for _, b := range testBlobs {
+		err := s.ds.Update(ctx, b.name, bytes.NewReader(b.data))
+		s.Require().NoError(err)
+		expected = append(expected, b.name.String())
+	}
+	s.updateDynamicLink(0)
+	expected = append(expected, dynamicLinkPropagationData[0].name.String())
+
+	names, err = listed()
+	s.Require().NoError(err)
+	s.Require().ElementsMatch(expected, names)
+
+	// Early stop
+	count := 0
+	for _, err := range s.ds.List(ctx) {
+		s.Require().NoError(err)
+		count++
+		break
+	}
+	s.Require().Equal(1, count)
+
+	err = s.ds.Delete(ctx, testBlobs[0].name)
+	s.Require().NoError(err)
+
+	names, err = listed()
+	s.Require().NoError(err)
+	s.Require().ElementsMatch(expected[1:], names)
+}
+
+func (s *DatastoreTestSuite) TestExistsMany() {
+	ctx := context.Background()
+
+	exists, err := s.ds.ExistsMany(ctx, nil)
+	s.Require().NoError(err)
+	s.Require().Empty(exists)
+
+	names := []*common.BlobName{}
+	expected := []bool{}
+	for i, b := range testBlobs {
+		names = append(names, b.name)
+		expected = append(expected, i%2 == 0)
+		if i%2 == 0 {
+			err := s.ds.Update(ctx, b.name, bytes.NewReader(b.data))
+			s.Require().NoError(err)
+		}
+	}
+	s.updateDynamicLink(0)
+	names = append(names, dynamicLinkPropagationData[0].name, emptyBlobNameDynamicLink)
+	expected = append(expected, true, false)
+
+	exists, err = s.ds.ExistsMany(ctx, names)
+	s.Require().NoError(err)
+	s.Require().Equal(expected, exists)
+
+	for i, name := range names {
+		e, err := s.ds.Exists(ctx, name)
+		s.Require().NoError(err)
+		s.Require().Equal(expected[i], e)
+	}
+}
+
+func (s *DatastoreTestSuite) TestSize() {
+	ctx := context.Background()
+
+	for _, b := range testBlobs {
+		_, err := s.ds.Size(ctx, b.name)
+		s.Require().ErrorIs(err, ErrNotFound)
+
+		err = s.ds.Update(ctx, b.name, bytes.NewReader(b.data))
+		s.Require().NoError(err)
+
+		rc, err := s.ds.Open(ctx, b.name)
+		s.Require().NoError(err)
+		data, err := io.ReadAll(rc)
+		s.Require().NoError(err)
+		s.Require().NoError(rc.Close())
+
+		size, err := s.ds.Size(ctx, b.name)
+		s.Require().NoError(err)
+		s.Require().EqualValues(len(data), size)
+	}
+
+	err := s.ds.Delete(ctx, testBlobs[0].name)
+	s.Require().NoError(err)
+
+	_, err = s.ds.Size(ctx, testBlobs[0].name)
+	s.Require().ErrorIs(err, ErrNotFound)
+}
+
 func (s *DatastoreTestSuite) TestGetKind() {
 	k := s.ds.Kind()
 	s.Require().NotEmpty(k)
@@ -302,11 +448,6 @@ func (s *DatastoreTestSuite) TestSimultaneousUpdates() {
 			defer wg.Done()
 
 			err := s.ds.Update(context.Background(), b.name, bytes.NewReader(b.data))
-			if errors.Is(err, ErrUploadInProgress) {
-				// TODO: We should be able to handle this case
-				return
-			}
-
 			s.Require().NoError(err)
 
 			exists, err := s.ds.Exists(context.Background(), b.name)
@@ -0,0 +1,70 @@
+/*
+Copyright © 2022 Bartłomiej Święcki (byo)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package datastore
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/cinode/go/pkg/common"
+)
+
+var (
+	ErrLinkMetricsNotSupported = errors.New("link metrics not supported for given datastore")
+)
+
+// LinkMetrics receives outcomes of dynamic link updates. Only updates with
+// valid link data are reported, re-sending the link data that is already
+// stored is not counted. Implementations must be safe for concurrent use.
+//
+// Large number of superseded updates of a single link is a sign of writers
+// competing over that link.
+type LinkMetrics interface {
+	// IncLinkUpdateAccepted is called after the update replaced
+	// the link data stored so far
+	IncLinkUpdateAccepted(name *common.BlobName)
+
+	// IncLinkUpdateSuperseded is called when the update is discarded
+	// because the stored link data takes precedence over it
+	IncLinkUpdateSuperseded(name *common.BlobName)
+}
+
+// WithLinkMetrics returns a datastore that reports outcomes of dynamic link
+// updates to given metrics receiver. The returned datastore shares the storage
+// with the original one.
+//
+// Link updates are only resolved by datastores keeping the data locally,
+// ErrLinkMetricsNotSupported is returned for other datastore kinds.
+func WithLinkMetrics(ds DS, m LinkMetrics) (DS, error) {
+	switch ds := ds.(type) {
+	case *datastore:
+		return &datastore{s: ds.s, linkMetrics: m, uploads: ds.uploads}, nil
+	case *lruMemoryDatastore:
+		return &lruMemoryDatastore{
+			datastore: &datastore{s: ds.s, linkMetrics: m, uploads: ds.uploads},
+			lru:       ds.lru,
+		}, nil
+	case *concurrencyLimitedDatastore:
+		inner, err := WithLinkMetrics(ds.inner, m)
+		if err != nil {
+			return nil, err
+		}
+		return &concurrencyLimitedDatastore{inner: inner, sem: ds.sem}, nil
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrLinkMetricsNotSupported, ds.Kind())
+	}
+}
@@ -0,0 +1,143 @@
+/*
+Copyright © 2022 Bartłomiej Święcki (byo)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package datastore
+
+import (
+	"bytes"
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/cinode/go/pkg/common"
+	"github.com/stretchr/testify/require"
+)
+
+type testLinkMetrics struct {
+	m          sync.Mutex
+	accepted   map[string]int
+	superseded map[string]int
+}
+
+func newTestLinkMetrics() *testLinkMetrics {
+	return &testLinkMetrics{
+		accepted:   map[string]int{},
+		superseded: map[string]int{},
+	}
+}
+
+func (m *testLinkMetrics) IncLinkUpdateAccepted(name *common.BlobName) {
+	m.m.Lock()
+	defer m.m.Unlock()
+	m.accepted[name.String()]++
+}
+
+func (m *testLinkMetrics) IncLinkUpdateSuperseded(name *common.BlobName) {
+	m.m.Lock()
+	defer m.m.Unlock()
+	m.superseded[name.String()]++
+}
+
+func TestLinkMetrics(t *testing.T) {
+	ctx := context.Background()
+	metrics := newTestLinkMetrics()
+
+	ds, err := WithLinkMetrics(InMemory(), metrics)
+	require.NoError(t, err)
+
+	name := dynamicLinkPropagationData[0].name.String()
+	update := func(num int) {
+		err := ds.Update(ctx,
+			dynamicLinkPropagationData[num].name,
+			bytes.NewReader(dynamicLinkPropagationData[num].data),
+		)
+		require.NoError(t, err)
+	}
+
+	for _, d := range []struct {
+		num        int
+		accepted   int
+		superseded int
+	}{
+		{0, 1, 0}, // First update
+		{1, 2, 0}, // Newer version
+		{0, 2, 1}, // Stale version
+		{2, 2, 2}, // Stale version
+		{1, 2, 2}, // The same data as stored, not counted
+		{0, 2, 3}, // Stale version
+	} {
+		update(d.num)
+		require.Equal(t, d.accepted, metrics.accepted[name])
+		require.Equal(t, d.superseded, metrics.superseded[name])
+	}
+
+	t.Run("static blobs are not counted", func(t *testing.T) {
+		err := ds.Update(ctx, emptyBlobNameStatic, bytes.NewReader(nil))
+		require.NoError(t, err)
+		require.Len(t, metrics.accepted, 1)
+		require.Len(t, metrics.superseded, 1)
+	})
+
+	t.Run("invalid link data is not counted", func(t *testing.T) {
+		err := ds.Update(ctx,
+			dynamicLinkPropagationData[0].name,
+			bytes.NewReader(dynamicLinkPropagationData[0].data[:10]),
+		)
+		require.Error(t, err)
+		require.Equal(t, 2, metrics.accepted[name])
+		require.Equal(t, 3, metrics.superseded[name])
+	})
+}
+
+func TestWithLinkMetricsSupportedDatastores(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("shared storage", func(t *testing.T) {
+		base := InMemory()
+		metrics := newTestLinkMetrics()
+		ds, err := WithLinkMetrics(base, metrics)
+		require.NoError(t, err)
+
+		err = ds.Update(ctx,
+			dynamicLinkPropagationData[0].name,
+			bytes.NewReader(dynamicLinkPropagationData[0].data),
+		)
+		require.NoError(t, err)
+
+		exists, err := base.Exists(ctx, dynamicLinkPropagationData[0].name)
+		require.NoError(t, err)
+		require.True(t, exists)
+	})
+
+	t.Run("concurrency limited datastore", func(t *testing.T) {
+		metrics := newTestLinkMetrics()
+		ds, err := WithLinkMetrics(WithConcurrencyLimit(InMemory(), 2), metrics)
+		require.NoError(t, err)
+
+		err = ds.Update(ctx,
+			dynamicLinkPropagationData[0].name,
+			bytes.NewReader(dynamicLinkPropagationData[0].data),
+		)
+		require.NoError(t, err)
+		require.Len(t, metrics.accepted, 1)
+	})
+
+	t.Run("not supported", func(t *testing.T) {
+		ds, err := WithLinkMetrics(NewMultiSource(InMemory(), 0), newTestLinkMetrics())
+		require.ErrorIs(t, err, ErrLinkMetricsNotSupported)
+		require.Nil(t, ds)
+	})
+}
@@ -0,0 +1,225 @@
+/*
+Copyright © 2023 Bartłomiej Święcki (byo)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package datastore
+
+import (
+	"context"
+	"errors"
+	"io"
+	"iter"
+	"sync"
+	"time"
+
+	"github.com/cinode/go/pkg/common"
+)
+
+// Names of operations reported by the datastore returned from WithMetrics
+const (
+	MetricsOperationOpen       = "open"
+	MetricsOperationRead       = "read"
+	MetricsOperationUpdate     = "update"
+	MetricsOperationExists     = "exists"
+	MetricsOperationExistsMany = "exists_many"
+	MetricsOperationSize       = "size"
+	MetricsOperationDelete     = "delete"
+	MetricsOperationList       = "list"
+)
+
+// Metrics receives counts, errors and latencies of datastore operations
+// together with the number of transferred bytes, it can be adapted to
+// prometheus counter and histogram vectors labelled with the datastore kind
+// and the operation name. Implementations must be safe for concurrent use.
+type Metrics interface {
+	// IncOperation is called after the operation on the datastore of given
+	// kind finished. Failed is set if the operation returned an error,
+	// ErrNotFound is a regular result and is not treated as a failure.
+	//
+	// Reading the opened blob is reported as a separate "read" operation
+	// once the data is fully read, reading fails or the blob is closed.
+	// The duration of the "open" operation only includes the time until
+	// the blob is opened.
+	IncOperation(kind, operation string, duration time.Duration, failed bool)
+
+	// IncReadBytes is called with the number of bytes read from opened blobs
+	IncReadBytes(kind string, bytes int64)
+
+	// IncWrittenBytes is called with the number of bytes consumed by updates
+	IncWrittenBytes(kind string, bytes int64)
+}
+
+type metricsDatastore struct {
+	inner DS
+	kind  string
+	m     Metrics
+}
+
+var _ DS = (*metricsDatastore)(nil)
+
+// WithMetrics returns a datastore that reports counts, errors and latencies
+// of operations done on the inner datastore together with the number of bytes
+// transferred. Metrics are reported with the kind of the inner datastore.
+//
+// Bytes are counted as they are transferred, data read from a blob that fails
+// in the middle of the stream or partially consumed updates are included.
+func WithMetrics(inner DS, m Metrics) DS {
+	return &metricsDatastore{
+		inner: inner,
+		kind:  inner.Kind(),
+		m:     m,
+	}
+}
+
+// observe reports the operation that started at given time
+func (m *metricsDatastore) observe(operation string, start time.Time, err error) {
+	m.m.IncOperation(
+		m.kind,
+		operation,
+		time.Since(start),
+		err != nil && !errors.Is(err, ErrNotFound),
+	)
+}
+
+func (m *metricsDatastore) Kind() string {
+	return m.inner.Kind()
+}
+
+func (m *metricsDatastore) Address() string {
+	return m.inner.Address()
+}
+
+func (m *metricsDatastore) Open(ctx context.Context, name *common.BlobName) (io.ReadCloser, error) {
+	start := time.Now()
+	rc, err := m.inner.Open(ctx, name)
+	m.observe(MetricsOperationOpen, start, err)
+	if err != nil {
+		return nil, err
+	}
+	return &metricsReader{ReadCloser: rc, m: m, start: time.Now()}, nil
+}
+
+func (m *metricsDatastore) Update(ctx context.Context, name *common.BlobName, r io.Reader) error {
+	start := time.Now()
+	err := m.inner.Update(ctx, name, newMetricsWriteCounter(r, m))
+	m.observe(MetricsOperationUpdate, start, err)
+	return err
+}
+
+func (m *metricsDatastore) Exists(ctx context.Context, name *common.BlobName) (bool, error) {
+	start := time.Now()
+	exists, err := m.inner.Exists(ctx, name)
+	m.observe(MetricsOperationExists, start, err)
+	return exists, err
+}
+
+func (m *metricsDatastore) ExistsMany(ctx context.Context, names []*common.BlobName) ([]bool, error) {
+	start := time.Now()
+	exists, err := m.inner.ExistsMany(ctx, names)
+	m.observe(MetricsOperationExistsMany, start, err)
+	return exists, err
+}
+
+func (m *metricsDatastore) Size(ctx context.Context, name *common.BlobName) (int64, error) {
+	start := time.Now()
+	size, err := m.inner.Size(ctx, name)
+	m.observe(MetricsOperationSize, start, err)
+	return size, err
+}
+
+func (m *metricsDatastore) Delete(ctx context.Context, name *common.BlobName) error {
+	start := time.Now()
+	err := m.inner.Delete(ctx, name)
+	m.observe(MetricsOperationDelete, start, err)
+	return err
+}
+
+// List is observed once the iteration ends, the latency includes the time
+// spent by the caller processing listed names
+func (m *metricsDatastore) List(ctx context.Context) iter.Seq2[*common.BlobName, error] {
+	return func(yield func(*common.BlobName, error) bool) {
+		start := time.Now()
+		var listErr error
+		defer func() { m.observe(MetricsOperationList, start, listErr) }()
+
+		for name, err := range m.inner.List(ctx) {
+			if err != nil {
+				listErr = err
+			}
+			if !yield(name, err) {
+				return
+			}
+		}
+	}
+}
+
+// metricsReader counts bytes read from the opened blob and reports the read
+// operation once reading ends
+type metricsReader struct {
+	io.ReadCloser
+	m        *metricsDatastore
+	start    time.Time
+	reported sync.Once
+}
+
+func (r *metricsReader) Read(b []byte) (int, error) {
+	n, err := r.ReadCloser.Read(b)
+	if n > 0 {
+		r.m.m.IncReadBytes(r.m.kind, int64(n))
+	}
+	if err == io.EOF {
+		r.report(nil)
+	} else if err != nil {
+		r.report(err)
+	}
+	return n, err
+}
+
+func (r *metricsReader) Close() error {
+	// Blob closed before reaching its end is not a failure
+	r.report(nil)
+	return r.ReadCloser.Close()
+}
+
+func (r *metricsReader) report(err error) {
+	r.reported.Do(func() { r.m.observe(MetricsOperationRead, r.start, err) })
+}
+
+// metricsWriteCounter counts bytes consumed from the update stream
+type metricsWriteCounter struct {
+	r io.Reader
+	m *metricsDatastore
+}
+
+// newMetricsWriteCounter wraps the update stream, seekable streams stay
+// seekable so that inner datastores can still rewind them
+func newMetricsWriteCounter(r io.Reader, m *metricsDatastore) io.Reader {
+	w := &metricsWriteCounter{r: r, m: m}
+	if seeker, ok := r.(io.Seeker); ok {
+		return struct {
+			io.Reader
+			io.Seeker
+		}{w, seeker}
+	}
+	return w
+}
+
+func (w *metricsWriteCounter) Read(b []byte) (int, error) {
+	n, err := w.r.Read(b)
+	if n > 0 {
+		w.m.m.IncWrittenBytes(w.m.kind, int64(n))
+	}
+	return n, err
+}
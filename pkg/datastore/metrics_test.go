@@ -0,0 +1,197 @@
+/*
+Copyright © 2023 Bartłomiej Święcki (byo)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package datastore
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"testing"
+	"testing/iotest"
+	"time"
+
+	"github.com/cinode/go/pkg/common"
+	"github.com/stretchr/testify/require"
+)
+
+// testMetrics keeps reported values of the "Memory" datastore kind
+type testMetrics struct {
+	t            *testing.T
+	mutex        sync.Mutex
+	operations   map[string]int
+	failures     map[string]int
+	readBytes    int64
+	writtenBytes int64
+}
+
+func newTestMetrics(t *testing.T) *testMetrics {
+	return &testMetrics{
+		t:          t,
+		operations: map[string]int{},
+		failures:   map[string]int{},
+	}
+}
+
+func (m *testMetrics) IncOperation(kind, operation string, duration time.Duration, failed bool) {
+	require.Equal(m.t, "Memory", kind)
+	require.GreaterOrEqual(m.t, duration, time.Duration(0))
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.operations[operation]++
+	if failed {
+		m.failures[operation]++
+	}
+}
+
+func (m *testMetrics) IncReadBytes(kind string, bytes int64) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.readBytes += bytes
+}
+
+func (m *testMetrics) IncWrittenBytes(kind string, bytes int64) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.writtenBytes += bytes
+}
+
+// failingReadDS returns streams failing after the first byte
+type failingReadDS struct {
+	DS
+}
+
+func (f *failingReadDS) Open(ctx context.Context, name *common.BlobName) (io.ReadCloser, error) {
+	rc, err := f.DS.Open(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{
+		Reader: io.MultiReader(io.LimitReader(rc, 1), iotest.ErrReader(errors.New("read failure"))),
+		Closer: rc,
+	}, nil
+}
+
+func TestWithMetrics(t *testing.T) {
+	ctx := context.Background()
+	b := testBlobs[0]
+
+	t.Run("operations", func(t *testing.T) {
+		m := newTestMetrics(t)
+		ds := WithMetrics(InMemory(), m)
+		require.Equal(t, "Memory", ds.Kind())
+
+		_, err := ds.Open(ctx, b.name)
+		require.ErrorIs(t, err, ErrNotFound)
+
+		err = ds.Update(ctx, b.name, bytes.NewReader(b.data))
+		require.NoError(t, err)
+
+		exists, err := ds.Exists(ctx, b.name)
+		require.NoError(t, err)
+		require.True(t, exists)
+
+		_, err = ds.ExistsMany(ctx, []*common.BlobName{b.name})
+		require.NoError(t, err)
+
+		_, err = ds.Size(ctx, b.name)
+		require.NoError(t, err)
+
+		rc, err := ds.Open(ctx, b.name)
+		require.NoError(t, err)
+		data, err := io.ReadAll(rc)
+		require.NoError(t, err)
+		require.NoError(t, rc.Close())
+
+		for range ds.List(ctx) {
+		}
+
+		require.NoError(t, ds.Delete(ctx, b.name))
+		require.ErrorIs(t, ds.Delete(ctx, b.name), ErrNotFound)
+
+		err = ds.Update(ctx, b.name, bytes.NewReader([]byte("invalid data")))
+		require.Error(t, err)
+
+		require.Equal(t, map[string]int{
+			MetricsOperationOpen:       2,
+			MetricsOperationRead:       1,
+			MetricsOperationUpdate:     2,
+			MetricsOperationExists:     1,
+			MetricsOperationExistsMany: 1,
+			MetricsOperationSize:       1,
+			MetricsOperationDelete:     2,
+			MetricsOperationList:       1,
+		}, m.operations)
+
+		// Not found results are not failures
+		require.Equal(t, map[string]int{MetricsOperationUpdate: 1}, m.failures)
+
+		require.EqualValues(t, len(data), m.readBytes)
+		require.EqualValues(t, len(b.data)+len("invalid data"), m.writtenBytes)
+	})
+
+	t.Run("mid-stream read errors", func(t *testing.T) {
+		m := newTestMetrics(t)
+		inner := InMemory()
+		require.NoError(t, inner.Update(ctx, b.name, bytes.NewReader(b.data)))
+		ds := WithMetrics(&failingReadDS{DS: inner}, m)
+
+		rc, err := ds.Open(ctx, b.name)
+		require.NoError(t, err)
+		_, err = io.ReadAll(rc)
+		require.Error(t, err)
+		_, err = rc.Read(make([]byte, 1))
+		require.Error(t, err)
+		require.NoError(t, rc.Close())
+
+		require.Equal(t, map[string]int{
+			MetricsOperationOpen: 1,
+			MetricsOperationRead: 1,
+		}, m.operations)
+		require.Equal(t, map[string]int{MetricsOperationRead: 1}, m.failures)
+		require.EqualValues(t, 1, m.readBytes)
+	})
+
+	t.Run("blob closed before the end", func(t *testing.T) {
+		m := newTestMetrics(t)
+		ds := WithMetrics(InMemory(), m)
+		require.NoError(t, ds.Update(ctx, b.name, bytes.NewReader(b.data)))
+
+		rc, err := ds.Open(ctx, b.name)
+		require.NoError(t, err)
+		require.NoError(t, rc.Close())
+
+		require.Equal(t, 1, m.operations[MetricsOperationRead])
+		require.Empty(t, m.failures)
+	})
+
+	t.Run("seekable update stream", func(t *testing.T) {
+		inner := &flakyDS{DS: InMemory(), errs: []error{errTransient}}
+		m := newTestMetrics(t)
+		ds := WithMetrics(WithRetry(inner, RetryPolicy{InitialBackoff: 1}), m)
+
+		err := ds.Update(ctx, b.name, bytes.NewReader(b.data))
+		require.NoError(t, err)
+		require.Equal(t, 2, inner.calls)
+		require.EqualValues(t, 1+len(b.data), m.writtenBytes)
+	})
+}
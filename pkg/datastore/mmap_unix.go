@@ -0,0 +1,80 @@
+//go:build linux || darwin || freebsd || netbsd || openbsd || dragonfly
+
+/*
+Copyright © 2022 Bartłomiej Święcki (byo)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package datastore
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"sync"
+	"syscall"
+)
+
+const mmapSupported = true
+
+// mmapFile maps the whole file into memory. The mapping stays valid even
+// if the file is removed or replaced while being read, blob files are only
+// ever replaced by renaming thus never truncated in place.
+func mmapFile(path string) (io.ReadCloser, error) {
+	fl, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	// Mapping does not need the descriptor to be open
+	defer fl.Close()
+
+	st, err := fl.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if st.Size() == 0 {
+		// Empty files can not be mapped
+		return io.NopCloser(bytes.NewReader(nil)), nil
+	}
+
+	data, err := syscall.Mmap(int(fl.Fd()), 0, int(st.Size()), syscall.PROT_READ, syscall.MAP_SHARED)
+	if err != nil {
+		return nil, &os.PathError{Op: "mmap", Path: path, Err: err}
+	}
+
+	return &mmapReader{data: data, r: bytes.NewReader(data)}, nil
+}
+
+type mmapReader struct {
+	data []byte
+	r    *bytes.Reader
+	once sync.Once
+}
+
+func (m *mmapReader) Read(b []byte) (int, error) {
+	if m.r == nil {
+		return 0, os.ErrClosed
+	}
+	return m.r.Read(b)
+}
+
+func (m *mmapReader) Close() error {
+	var err error
+	m.once.Do(func() {
+		m.r = nil
+		err = syscall.Munmap(m.data)
+		m.data = nil
+	})
+	return err
+}
@@ -17,14 +17,18 @@ limitations under the License.
 package datastore
 
 import (
+	"bytes"
 	"context"
 	"io"
+	"iter"
 	"sync"
 	"time"
 
 	"golang.org/x/exp/slog"
 
+	"github.com/cinode/go/pkg/blobtypes"
 	"github.com/cinode/go/pkg/common"
+	"github.com/cinode/go/pkg/internal/blobtypes/dynamiclink"
 )
 
 type multiSourceDatastoreBlobState struct {
@@ -51,6 +55,14 @@ type multiSourceDatastore struct {
 	// Guard additional sources and update time map
 	m sync.Mutex
 
+	// If set, the newest version of a dynamic link is stored back
+	// in additional datastores that hold an outdated one
+	writeBack bool
+
+	// If set, blobs are read directly from additional datastores
+	// and are not stored in the main one, see NewFanout
+	readThrough bool
+
 	// Logger output
 	log *slog.Logger
 }
@@ -65,6 +77,16 @@ func NewMultiSource(main DS, refreshTime time.Duration, additional ...DS) DS {
 	}
 }
 
+// NewMultiSourceWithWriteBack creates multi-source datastore that, in addition
+// to what NewMultiSource does, stores the newest version of a dynamic link
+// found in any of datastores back to additional datastores holding
+// an outdated version of that link.
+func NewMultiSourceWithWriteBack(main DS, refreshTime time.Duration, additional ...DS) DS {
+	ds := NewMultiSource(main, refreshTime, additional...).(*multiSourceDatastore)
+	ds.writeBack = true
+	return ds
+}
+
 var _ DS = (*multiSourceDatastore)(nil)
 
 func (m *multiSourceDatastore) Kind() string {
@@ -76,6 +98,9 @@ func (m *multiSourceDatastore) Address() string {
 }
 
 func (m *multiSourceDatastore) Open(ctx context.Context, name *common.BlobName) (io.ReadCloser, error) {
+	if m.readThrough {
+		return m.openReadThrough(ctx, name)
+	}
 	m.fetch(ctx, name)
 	return m.main.Open(ctx, name)
 }
@@ -85,14 +110,36 @@ func (m *multiSourceDatastore) Update(ctx context.Context, name *common.BlobName
 }
 
 func (m *multiSourceDatastore) Exists(ctx context.Context, name *common.BlobName) (bool, error) {
+	if m.readThrough {
+		return m.existsReadThrough(ctx, name)
+	}
 	m.fetch(ctx, name)
 	return m.main.Exists(ctx, name)
 }
 
+func (m *multiSourceDatastore) ExistsMany(ctx context.Context, names []*common.BlobName) ([]bool, error) {
+	// Every blob may need to be fetched from additional datastores
+	return existsSequential(ctx, m.Exists, names)
+}
+
+func (m *multiSourceDatastore) Size(ctx context.Context, name *common.BlobName) (int64, error) {
+	if m.readThrough {
+		return m.sizeReadThrough(ctx, name)
+	}
+	m.fetch(ctx, name)
+	return m.main.Size(ctx, name)
+}
+
 func (m *multiSourceDatastore) Delete(ctx context.Context, name *common.BlobName) error {
 	return m.main.Delete(ctx, name)
 }
 
+// List enumerates blobs of the main datastore only, additional datastores
+// are not queried
+func (m *multiSourceDatastore) List(ctx context.Context) iter.Seq2[*common.BlobName, error] {
+	return m.main.List(ctx)
+}
+
 func (m *multiSourceDatastore) fetch(ctx context.Context, name *common.BlobName) {
 	// TODO:
 	// if not found locally, go over all additional sources and check if exists,
@@ -141,35 +188,10 @@ func (m *multiSourceDatastore) fetch(ctx context.Context, name *common.BlobName)
 			m.log.Info("Starting download",
 				"blob", name.String(),
 			)
-			wasUpdated := false
-			for i, ds := range m.additional {
-				r, err := ds.Open(ctx, name)
-				if err != nil {
-					m.log.Debug("Failed to fetch blob from additional datastore",
-						"blob", name.String(),
-						"datastore", ds.Address(),
-						"err", err,
-					)
-					continue
-				}
-
-				m.log.Info("Blob found in additional datastore",
-					"blob", name.String(),
-					"datastore-num", i+1,
-				)
-				err = m.main.Update(ctx, name, r)
-				r.Close()
-				if err != nil {
-					m.log.Error("Failed to store blob in local datastore", err,
-						"blob", name.String(),
-					)
-				}
-				wasUpdated = true
-			}
-			if !wasUpdated {
-				m.log.Warn("Did not find blob in any datastore",
-					"blob", name.String(),
-				)
+			if name.Type() == blobtypes.DynamicLink {
+				m.fetchDynamicLink(ctx, name)
+			} else {
+				m.fetchStatic(ctx, name)
 			}
 			defer close(waitChan)
 
@@ -189,3 +211,160 @@ func (m *multiSourceDatastore) fetch(ctx context.Context, name *common.BlobName)
 		<-waitChan
 	}
 }
+
+func (m *multiSourceDatastore) fetchStatic(ctx context.Context, name *common.BlobName) {
+	if exists, err := m.main.Exists(ctx, name); err == nil && exists {
+		// Static blob content is always the same, no need to look further
+		return
+	}
+
+	for i, ds := range m.additional {
+		r, err := ds.Open(ctx, name)
+		if err != nil {
+			m.log.Debug("Failed to fetch blob from additional datastore",
+				"blob", name.String(),
+				"datastore", ds.Address(),
+				"err", err,
+			)
+			continue
+		}
+
+		m.log.Info("Blob found in additional datastore",
+			"blob", name.String(),
+			"datastore-num", i+1,
+		)
+		err = m.main.Update(ctx, name, r)
+		r.Close()
+		if err != nil {
+			m.log.Error("Failed to store blob in local datastore",
+				"blob", name.String(),
+				"err", err,
+			)
+			continue
+		}
+
+		// Static blob content is always the same, no need to look further
+		return
+	}
+
+	m.log.Warn("Did not find blob in any datastore",
+		"blob", name.String(),
+	)
+}
+
+type multiSourceLinkVersion struct {
+	link *dynamiclink.PublicReader
+	data []byte
+}
+
+// readLinkVersion reads and validates the dynamic link from given datastore
+func readLinkVersion(ctx context.Context, ds DS, name *common.BlobName) (*multiSourceLinkVersion, error) {
+	rc, err := ds.Open(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	dl, err := dynamiclink.FromPublicData(name, rc)
+	if err != nil {
+		return nil, err
+	}
+
+	// Reading the whole public data completes the link validation
+	data, err := io.ReadAll(dl.GetPublicDataReader())
+	if err != nil {
+		return nil, err
+	}
+
+	return &multiSourceLinkVersion{link: dl, data: data}, nil
+}
+
+// readLinkVersions reads the link from given datastores, the valid version
+// read from each datastore (nil if not found or invalid) and the newest one
+// are returned
+func (m *multiSourceDatastore) readLinkVersions(
+	ctx context.Context,
+	sources []DS,
+	name *common.BlobName,
+) ([]*multiSourceLinkVersion, *multiSourceLinkVersion) {
+	versions := make([]*multiSourceLinkVersion, len(sources))
+	var newest *multiSourceLinkVersion
+	for i, ds := range sources {
+		v, err := readLinkVersion(ctx, ds, name)
+		if err != nil {
+			m.log.Debug("Failed to fetch blob from datastore",
+				"blob", name.String(),
+				"datastore", ds.Address(),
+				"err", err,
+			)
+			continue
+		}
+
+		versions[i] = v
+		if newest == nil || v.link.GreaterThan(newest.link) {
+			newest = v
+		}
+	}
+	return versions, newest
+}
+
+// fetchDynamicLink reads the link from all datastores and selects the newest
+// valid version of it, that version is then stored in the main datastore
+// and, if write-back is enabled, in additional datastores that hold
+// an outdated version of the link.
+func (m *multiSourceDatastore) fetchDynamicLink(ctx context.Context, name *common.BlobName) {
+	versions, newest := m.readLinkVersions(ctx, m.additional, name)
+	for i, v := range versions {
+		if v != nil {
+			m.log.Info("Blob found in additional datastore",
+				"blob", name.String(),
+				"datastore-num", i+1,
+			)
+		}
+	}
+
+	if newest == nil {
+		m.log.Warn("Did not find blob in any datastore",
+			"blob", name.String(),
+		)
+		return
+	}
+
+	// Main datastore only accepts the link if it is newer than the local one
+	err := m.main.Update(ctx, name, bytes.NewReader(newest.data))
+	if err != nil {
+		m.log.Error("Failed to store blob in local datastore",
+			"blob", name.String(),
+			"err", err,
+		)
+	}
+
+	if !m.writeBack {
+		return
+	}
+
+	// The main datastore may already contain a newer version
+	if local, err := readLinkVersion(ctx, m.main, name); err == nil && local.link.GreaterThan(newest.link) {
+		newest = local
+	}
+
+	for i, v := range versions {
+		if v == nil || !newest.link.GreaterThan(v.link) {
+			// Only datastores holding an outdated version are updated
+			continue
+		}
+
+		m.log.Info("Updating outdated link in additional datastore",
+			"blob", name.String(),
+			"datastore-num", i+1,
+		)
+		err := m.additional[i].Update(ctx, name, bytes.NewReader(newest.data))
+		if err != nil {
+			m.log.Error("Failed to update link in additional datastore",
+				"blob", name.String(),
+				"datastore-num", i+1,
+				"err", err,
+			)
+		}
+	}
+}
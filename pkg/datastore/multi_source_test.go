@@ -98,4 +98,70 @@ func TestMultiSourceDatastore(t *testing.T) {
 		// Should refresh by now
 		require.EqualValues(t, "Hello world", fetchBlob(ds, bn))
 	})
+	t.Run("Test dynamic link version reconciliation", func(t *testing.T) {
+		name := dynamicLinkPropagationData[0].name
+		older := dynamicLinkPropagationData[0].data
+		newer := dynamicLinkPropagationData[1].data
+
+		storeLink := func(ds DS, data []byte) {
+			err := ds.Update(context.Background(), name, bytes.NewReader(data))
+			require.NoError(t, err)
+		}
+
+		fetchLink := func(ds DS) []byte {
+			return []byte(fetchBlob(ds, name))
+		}
+
+		t.Run("newest version from additional datastores", func(t *testing.T) {
+			main := InMemory()
+			add1 := InMemory()
+			add2 := InMemory()
+
+			storeLink(main, older)
+			storeLink(add1, older)
+			storeLink(add2, newer)
+
+			ds := NewMultiSource(main, time.Hour, add1, add2)
+			require.Equal(t, newer, fetchLink(ds))
+			require.Equal(t, newer, fetchLink(main))
+
+			// Without write-back, additional datastores are not modified
+			require.Equal(t, older, fetchLink(add1))
+		})
+
+		t.Run("write back to outdated datastores", func(t *testing.T) {
+			main := InMemory()
+			add1 := InMemory()
+			add2 := InMemory()
+			add3 := InMemory()
+
+			storeLink(add1, newer)
+			storeLink(add2, older)
+
+			ds := NewMultiSourceWithWriteBack(main, time.Hour, add1, add2, add3)
+			require.Equal(t, newer, fetchLink(ds))
+			require.Equal(t, newer, fetchLink(add1))
+			require.Equal(t, newer, fetchLink(add2))
+
+			// Datastores that did not have the link at all are left untouched
+			ensureNotFound(add3, name)
+		})
+
+		t.Run("main datastore holds the newest version", func(t *testing.T) {
+			main := InMemory()
+			add := InMemory()
+
+			storeLink(main, newer)
+			storeLink(add, older)
+
+			ds := NewMultiSourceWithWriteBack(main, time.Hour, add)
+			require.Equal(t, newer, fetchLink(ds))
+			require.Equal(t, newer, fetchLink(add))
+		})
+
+		t.Run("link not found anywhere", func(t *testing.T) {
+			ds := NewMultiSourceWithWriteBack(InMemory(), time.Hour, InMemory())
+			ensureNotFound(ds, name)
+		})
+	})
 }
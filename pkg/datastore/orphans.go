@@ -0,0 +1,80 @@
+/*
+Copyright © 2023 Bartłomiej Święcki (byo)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package datastore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/cinode/go/pkg/common"
+)
+
+var (
+	ErrListNotSupported = errors.New("datastore does not support listing blobs")
+)
+
+// FindBlobsNotIn returns the list of blobs stored in given datastore that are
+// not in the live set together with their total size. This is a read-only
+// operation, no blob is deleted.
+//
+// No reachability walk is done - the datastore layer has no insight into the
+// encrypted blob content thus it can not follow references between blobs.
+// The live list must contain every blob that is still in use, not only the
+// roots of the dataset. Such list can be built by walking the dataset with
+// cinodefs.ReachableBlobs, cinodefs.FindOrphans does both steps at once.
+//
+// ErrListNotSupported is returned if the datastore can not enumerate its blobs.
+func FindBlobsNotIn(
+	ctx context.Context,
+	ds DS,
+	live []*common.BlobName,
+) (
+	[]*common.BlobName,
+	int64,
+	error,
+) {
+	liveSet := make(map[string]struct{}, len(live))
+	for _, bn := range live {
+		liveSet[bn.String()] = struct{}{}
+	}
+
+	orphans := []*common.BlobName{}
+	totalSize := int64(0)
+	for name, err := range ds.List(ctx) {
+		if err != nil {
+			return nil, 0, err
+		}
+		if _, isLive := liveSet[name.String()]; isLive {
+			continue
+		}
+
+		size, err := ds.Size(ctx, name)
+		if errors.Is(err, ErrNotFound) {
+			// Removed in the meantime
+			continue
+		}
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to get size of blob %s: %w", name, err)
+		}
+
+		orphans = append(orphans, name)
+		totalSize += size
+	}
+
+	return orphans, totalSize, nil
+}
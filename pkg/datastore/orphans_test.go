@@ -0,0 +1,96 @@
+/*
+Copyright © 2023 Bartłomiej Święcki (byo)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package datastore
+
+import (
+	"bytes"
+	"context"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/cinode/go/pkg/common"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFindBlobsNotIn(t *testing.T) {
+	for _, d := range []struct {
+		name     string
+		createDS func() (DS, error)
+	}{
+		{"InMemory", func() (DS, error) { return InMemory(), nil }},
+		{"InFileSystem", func() (DS, error) { return InFileSystem(t.TempDir()) }},
+		{"InRawFileSystem", func() (DS, error) { return InRawFileSystem(t.TempDir()) }},
+		{"NewMultiSource", func() (DS, error) { return NewMultiSource(InMemory(), time.Hour), nil }},
+		{"NewFanout", func() (DS, error) { return NewFanout(InMemory(), InMemory()), nil }},
+	} {
+		t.Run(d.name, func(t *testing.T) {
+			ctx := context.Background()
+			ds, err := d.createDS()
+			require.NoError(t, err)
+
+			orphans, size, err := FindBlobsNotIn(ctx, ds, nil)
+			require.NoError(t, err)
+			require.Empty(t, orphans)
+			require.Zero(t, size)
+
+			for _, b := range testBlobs {
+				err := ds.Update(ctx, b.name, bytes.NewReader(b.data))
+				require.NoError(t, err)
+			}
+
+			live := []*common.BlobName{testBlobs[0].name, testBlobs[3].name}
+			expectedOrphans := []string{}
+			expectedSize := int64(0)
+			for i, b := range testBlobs {
+				if i == 0 || i == 3 {
+					continue
+				}
+				expectedOrphans = append(expectedOrphans, b.name.String())
+				expectedSize += int64(len(b.data))
+			}
+
+			orphans, size, err = FindBlobsNotIn(ctx, ds, live)
+			require.NoError(t, err)
+
+			orphanNames := []string{}
+			for _, o := range orphans {
+				orphanNames = append(orphanNames, o.String())
+			}
+			require.ElementsMatch(t, expectedOrphans, orphanNames)
+			require.Equal(t, expectedSize, size)
+
+			// Listing must not modify the datastore
+			for _, b := range testBlobs {
+				exists, err := ds.Exists(ctx, b.name)
+				require.NoError(t, err)
+				require.True(t, exists)
+			}
+		})
+	}
+
+	t.Run("not supported for remote datastore", func(t *testing.T) {
+		server := httptest.NewServer(WebInterface(InMemory()))
+		defer server.Close()
+
+		ds, err := FromWeb(server.URL + "/")
+		require.NoError(t, err)
+
+		_, _, err = FindBlobsNotIn(context.Background(), ds, nil)
+		require.ErrorIs(t, err, ErrListNotSupported)
+	})
+}
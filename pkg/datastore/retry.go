@@ -0,0 +1,356 @@
+/*
+Copyright © 2023 Bartłomiej Święcki (byo)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package datastore
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"iter"
+	"math/rand/v2"
+	"net"
+	"time"
+
+	"github.com/cinode/go/pkg/blobtypes"
+	"github.com/cinode/go/pkg/common"
+)
+
+const (
+	defaultRetryMaxAttempts    = 3
+	defaultRetryInitialBackoff = 100 * time.Millisecond
+	defaultRetryMaxBackoff     = 5 * time.Second
+	defaultRetryMultiplier     = 2.0
+)
+
+// RetryPolicy configures retries done by the datastore returned from
+// WithRetry, zero values are replaced with defaults
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts of a single operation,
+	// including the first one (default 3)
+	MaxAttempts int
+
+	// InitialBackoff is the delay before the first retry (default 100ms)
+	InitialBackoff time.Duration
+
+	// MaxBackoff limits the delay between attempts (default 5s)
+	MaxBackoff time.Duration
+
+	// Multiplier is the factor by which the delay grows after each retry
+	// (default 2)
+	Multiplier float64
+
+	// Jitter is the fraction of the delay that is randomized, 0 means
+	// no randomization and 1 means the delay is anywhere between zero and
+	// the computed value
+	Jitter float64
+
+	// Retryable decides whether the error is transient, by default network
+	// errors and temporary web errors are retried
+	Retryable func(err error) bool
+}
+
+func (p RetryPolicy) withDefaults() RetryPolicy {
+	if p.MaxAttempts < 1 {
+		p.MaxAttempts = defaultRetryMaxAttempts
+	}
+	if p.InitialBackoff <= 0 {
+		p.InitialBackoff = defaultRetryInitialBackoff
+	}
+	if p.MaxBackoff <= 0 {
+		p.MaxBackoff = defaultRetryMaxBackoff
+	}
+	if p.Multiplier < 1 {
+		p.Multiplier = defaultRetryMultiplier
+	}
+	p.Jitter = min(max(p.Jitter, 0), 1)
+	if p.Retryable == nil {
+		p.Retryable = IsTransientError
+	}
+	return p
+}
+
+// Backoff returns the delay before given retry, starting from 1, zero values
+// of the policy are replaced with defaults
+func (p RetryPolicy) Backoff(retry int) time.Duration {
+	p = p.withDefaults()
+	return p.backoff(retry)
+}
+
+// backoff returns the delay before given retry, starting from 1
+func (p *RetryPolicy) backoff(retry int) time.Duration {
+	delay := float64(p.InitialBackoff)
+	for i := 1; i < retry && delay < float64(p.MaxBackoff); i++ {
+		delay *= p.Multiplier
+	}
+	delay = min(delay, float64(p.MaxBackoff))
+	delay -= delay * p.Jitter * rand.Float64()
+	return time.Duration(delay)
+}
+
+// IsTransientError returns true if the operation that failed with given error
+// may succeed when retried. Network errors and temporary web errors
+// (5xx, 408 and 429 responses) are transient. Cancelled contexts, validation
+// failures, missing blobs and other client errors are not.
+func IsTransientError(err error) bool {
+	if err == nil ||
+		errors.Is(err, context.Canceled) ||
+		errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	var webErr *WebError
+	if errors.As(err, &webErr) {
+		return webErr.Temporary()
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+
+	return errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+type retryDatastore struct {
+	inner  DS
+	policy RetryPolicy
+}
+
+var _ DS = (*retryDatastore)(nil)
+
+// WithRetry returns a datastore retrying operations on the inner datastore
+// that failed with transient errors, non-transient errors are returned
+// immediately. Retries are delayed with exponential backoff, waiting is
+// interrupted if the operation's context is cancelled.
+//
+// Open, Exists, ExistsMany and Size are retried. Read errors of the stream
+// returned from Open for static blobs are retried by opening the blob again
+// and skipping the data that was already read, the skipped data must match
+// the data already returned (ErrValidationFailed otherwise). Read errors of
+// dynamic links are returned as is - the link may be updated in the meantime
+// and resuming would join parts of different link versions. Update is only
+// retried if the update stream implements io.Seeker so that it can be
+// rewound, Delete and List are never retried.
+func WithRetry(inner DS, policy RetryPolicy) DS {
+	return &retryDatastore{
+		inner:  inner,
+		policy: policy.withDefaults(),
+	}
+}
+
+// do runs given function until it succeeds, fails with a non-transient error
+// or the number of attempts is exhausted
+func (r *retryDatastore) do(ctx context.Context, f func() error) error {
+	for attempt := 1; ; attempt++ {
+		err := f()
+		if err == nil || attempt >= r.policy.MaxAttempts || !r.policy.Retryable(err) {
+			return err
+		}
+
+		timer := time.NewTimer(r.policy.backoff(attempt))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+func (r *retryDatastore) Kind() string {
+	return r.inner.Kind()
+}
+
+func (r *retryDatastore) Address() string {
+	return r.inner.Address()
+}
+
+func (r *retryDatastore) Open(ctx context.Context, name *common.BlobName) (io.ReadCloser, error) {
+	var rc io.ReadCloser
+	err := r.do(ctx, func() (err error) {
+		rc, err = r.inner.Open(ctx, name)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if name.Type() != blobtypes.Static {
+		// Only static blobs are guaranteed to have the same content when
+		// opened again
+		return rc, nil
+	}
+
+	return &retryReader{ds: r, ctx: ctx, name: name, rc: rc, delivered: sha256.New()}, nil
+}
+
+func (r *retryDatastore) Update(ctx context.Context, name *common.BlobName, data io.Reader) error {
+	seeker, ok := data.(io.Seeker)
+	if !ok {
+		// Data that was already consumed can not be sent again
+		return r.inner.Update(ctx, name, data)
+	}
+
+	start, err := seeker.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return r.inner.Update(ctx, name, data)
+	}
+
+	first := true
+	return r.do(ctx, func() error {
+		if !first {
+			_, err := seeker.Seek(start, io.SeekStart)
+			if err != nil {
+				return err
+			}
+		}
+		first = false
+		return r.inner.Update(ctx, name, data)
+	})
+}
+
+func (r *retryDatastore) Exists(ctx context.Context, name *common.BlobName) (bool, error) {
+	var exists bool
+	err := r.do(ctx, func() (err error) {
+		exists, err = r.inner.Exists(ctx, name)
+		return err
+	})
+	return exists, err
+}
+
+func (r *retryDatastore) ExistsMany(ctx context.Context, names []*common.BlobName) ([]bool, error) {
+	var exists []bool
+	err := r.do(ctx, func() (err error) {
+		exists, err = r.inner.ExistsMany(ctx, names)
+		return err
+	})
+	return exists, err
+}
+
+func (r *retryDatastore) Size(ctx context.Context, name *common.BlobName) (int64, error) {
+	var size int64
+	err := r.do(ctx, func() (err error) {
+		size, err = r.inner.Size(ctx, name)
+		return err
+	})
+	return size, err
+}
+
+// Delete is not retried, a retry after a successful delete whose response
+// was lost would report ErrNotFound
+func (r *retryDatastore) Delete(ctx context.Context, name *common.BlobName) error {
+	return r.inner.Delete(ctx, name)
+}
+
+// List is not retried, names already returned would be reported again
+func (r *retryDatastore) List(ctx context.Context) iter.Seq2[*common.BlobName, error] {
+	return r.inner.List(ctx)
+}
+
+// retryReader reopens the blob on transient read errors and continues
+// reading from the position where the failed stream stopped.
+//
+// Only the content of the last opened stream is validated by the inner
+// datastore. Data already returned from previous streams is hashed and
+// compared with the skipped part of the reopened stream, thus the whole
+// returned content is the one that passed the validation.
+type retryReader struct {
+	ds        *retryDatastore
+	ctx       context.Context
+	name      *common.BlobName
+	rc        io.ReadCloser
+	pos       int64
+	delivered hash.Hash
+	failures  int
+	err       error
+}
+
+func (r *retryReader) Read(b []byte) (int, error) {
+	for {
+		if r.err != nil {
+			return 0, r.err
+		}
+
+		if r.rc == nil {
+			r.err = r.ds.do(r.ctx, r.reopen)
+			continue
+		}
+
+		n, err := r.rc.Read(b)
+		r.pos += int64(n)
+		r.delivered.Write(b[:n])
+		if n > 0 {
+			r.failures = 0
+		}
+		if err == nil || err == io.EOF {
+			return n, err
+		}
+
+		r.failures++
+		if r.failures >= r.ds.policy.MaxAttempts || !r.ds.policy.Retryable(err) {
+			r.err = err
+			return n, err
+		}
+
+		// The stream is reopened with the next read
+		r.rc.Close()
+		r.rc = nil
+		if n > 0 {
+			return n, nil
+		}
+	}
+}
+
+// reopen opens the blob again and skips the data that was already read
+func (r *retryReader) reopen() error {
+	rc, err := r.ds.inner.Open(r.ctx, r.name)
+	if err != nil {
+		return err
+	}
+
+	skipped := sha256.New()
+	_, err = io.CopyN(skipped, rc, r.pos)
+	if err == io.EOF {
+		// The blob is shorter than the data already read
+		err = io.ErrUnexpectedEOF
+	}
+	if err == nil && !bytes.Equal(skipped.Sum(nil), r.delivered.Sum(nil)) {
+		err = fmt.Errorf("%w: data already read differs from the reopened blob", blobtypes.ErrValidationFailed)
+	}
+	if err != nil {
+		rc.Close()
+		return err
+	}
+
+	r.rc = rc
+	return nil
+}
+
+func (r *retryReader) Close() error {
+	if r.err == nil {
+		r.err = io.ErrClosedPipe
+	}
+	if r.rc == nil {
+		return nil
+	}
+	err := r.rc.Close()
+	r.rc = nil
+	return err
+}
@@ -0,0 +1,353 @@
+/*
+Copyright © 2023 Bartłomiej Święcki (byo)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package datastore
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/iotest"
+	"time"
+
+	"github.com/cinode/go/pkg/blobtypes"
+	"github.com/cinode/go/pkg/common"
+	"github.com/stretchr/testify/require"
+)
+
+var errTransient = &net.OpError{Op: "read", Net: "tcp", Err: errors.New("connection reset")}
+
+// flakyDS fails operations with queued errors before calling the inner
+// datastore, opened streams can be set to fail after reading some data
+type flakyDS struct {
+	DS
+	errs        []error
+	calls       int
+	readFailPos []int
+
+	// tamper corrupts data returned before the read failure
+	tamper bool
+}
+
+// tamperingReader flips bits of the data read
+type tamperingReader struct{ r io.Reader }
+
+func (t tamperingReader) Read(b []byte) (int, error) {
+	n, err := t.r.Read(b)
+	for i := range b[:n] {
+		b[i] ^= 0xFF
+	}
+	return n, err
+}
+
+func (f *flakyDS) nextErr() error {
+	f.calls++
+	if len(f.errs) == 0 {
+		return nil
+	}
+	err := f.errs[0]
+	f.errs = f.errs[1:]
+	return err
+}
+
+func (f *flakyDS) Open(ctx context.Context, name *common.BlobName) (io.ReadCloser, error) {
+	if err := f.nextErr(); err != nil {
+		return nil, err
+	}
+	rc, err := f.DS.Open(ctx, name)
+	if err != nil || len(f.readFailPos) == 0 {
+		return rc, err
+	}
+
+	failPos := f.readFailPos[0]
+	f.readFailPos = f.readFailPos[1:]
+	var prefix io.Reader = io.LimitReader(rc, int64(failPos))
+	if f.tamper {
+		prefix = tamperingReader{prefix}
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{
+		Reader: io.MultiReader(
+			prefix,
+			iotest.ErrReader(errTransient),
+		),
+		Closer: rc,
+	}, nil
+}
+
+func (f *flakyDS) Update(ctx context.Context, name *common.BlobName, r io.Reader) error {
+	if err := f.nextErr(); err != nil {
+		// Consume some data to check that the stream is rewound
+		io.CopyN(io.Discard, r, 1)
+		return err
+	}
+	return f.DS.Update(ctx, name, r)
+}
+
+func (f *flakyDS) Exists(ctx context.Context, name *common.BlobName) (bool, error) {
+	if err := f.nextErr(); err != nil {
+		return false, err
+	}
+	return f.DS.Exists(ctx, name)
+}
+
+func (f *flakyDS) Size(ctx context.Context, name *common.BlobName) (int64, error) {
+	if err := f.nextErr(); err != nil {
+		return 0, err
+	}
+	return f.DS.Size(ctx, name)
+}
+
+func (f *flakyDS) Delete(ctx context.Context, name *common.BlobName) error {
+	if err := f.nextErr(); err != nil {
+		return err
+	}
+	return f.DS.Delete(ctx, name)
+}
+
+func TestIsTransientError(t *testing.T) {
+	for _, d := range []struct {
+		err       error
+		transient bool
+	}{
+		{nil, false},
+		{errTransient, true},
+		{io.ErrUnexpectedEOF, true},
+		{&WebError{StatusCode: http.StatusServiceUnavailable}, true},
+		{&WebError{StatusCode: http.StatusTooManyRequests}, true},
+		{&WebError{StatusCode: http.StatusForbidden}, false},
+		{ErrNotFound, false},
+		{blobtypes.ErrValidationFailed, false},
+		{context.Canceled, false},
+		{context.DeadlineExceeded, false},
+		{errors.New("other"), false},
+	} {
+		require.Equal(t, d.transient, IsTransientError(d.err), "%v", d.err)
+	}
+}
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	p := RetryPolicy{
+		InitialBackoff: time.Second,
+		MaxBackoff:     5 * time.Second,
+	}.withDefaults()
+
+	require.Equal(t, 3, p.MaxAttempts)
+	require.Equal(t, time.Second, p.backoff(1))
+	require.Equal(t, 2*time.Second, p.backoff(2))
+	require.Equal(t, 4*time.Second, p.backoff(3))
+	require.Equal(t, 5*time.Second, p.backoff(4))
+	require.Equal(t, 5*time.Second, p.backoff(1000))
+
+	p.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		d := p.backoff(2)
+		require.GreaterOrEqual(t, d, time.Second)
+		require.LessOrEqual(t, d, 2*time.Second)
+	}
+
+	// Defaults are applied to the exported variant
+	require.Equal(t, 100*time.Millisecond, RetryPolicy{}.Backoff(1))
+	require.Equal(t, 200*time.Millisecond, RetryPolicy{}.Backoff(2))
+}
+
+func TestWithRetry(t *testing.T) {
+	ctx := context.Background()
+	policy := RetryPolicy{
+		MaxAttempts:    3,
+		InitialBackoff: time.Millisecond,
+		Jitter:         0.5,
+	}
+	b := testBlobs[0]
+
+	newDS := func(t *testing.T, errs ...error) (*flakyDS, DS) {
+		inner := &flakyDS{DS: InMemory()}
+		require.NoError(t, inner.DS.Update(ctx, b.name, bytes.NewReader(b.data)))
+		inner.errs = errs
+		return inner, WithRetry(inner, policy)
+	}
+
+	t.Run("transient errors are retried", func(t *testing.T) {
+		inner, ds := newDS(t, errTransient, errTransient)
+		exists, err := ds.Exists(ctx, b.name)
+		require.NoError(t, err)
+		require.True(t, exists)
+		require.Equal(t, 3, inner.calls)
+
+		inner, ds = newDS(t, &WebError{StatusCode: http.StatusBadGateway})
+		size, err := ds.Size(ctx, b.name)
+		require.NoError(t, err)
+		require.EqualValues(t, len(b.data), size)
+		require.Equal(t, 2, inner.calls)
+
+		inner, ds = newDS(t, errTransient)
+		rc, err := ds.Open(ctx, b.name)
+		require.NoError(t, err)
+		data, err := io.ReadAll(rc)
+		require.NoError(t, err)
+		require.NoError(t, rc.Close())
+		require.Equal(t, b.expected, data)
+		require.Equal(t, 2, inner.calls)
+	})
+
+	t.Run("attempts are limited", func(t *testing.T) {
+		inner, ds := newDS(t, errTransient, errTransient, errTransient, errTransient)
+		_, err := ds.Exists(ctx, b.name)
+		require.ErrorIs(t, err, errTransient)
+		require.Equal(t, 3, inner.calls)
+	})
+
+	t.Run("non-transient errors are not retried", func(t *testing.T) {
+		for _, expectedErr := range []error{
+			&WebError{StatusCode: http.StatusForbidden},
+			blobtypes.ErrValidationFailed,
+			ErrNotFound,
+		} {
+			inner, ds := newDS(t, expectedErr, expectedErr)
+			_, err := ds.Open(ctx, b.name)
+			require.ErrorIs(t, err, expectedErr)
+			require.Equal(t, 1, inner.calls)
+		}
+	})
+
+	t.Run("delete is not retried", func(t *testing.T) {
+		inner, ds := newDS(t, errTransient)
+		err := ds.Delete(ctx, b.name)
+		require.ErrorIs(t, err, errTransient)
+		require.Equal(t, 1, inner.calls)
+	})
+
+	t.Run("seekable update is retried", func(t *testing.T) {
+		inner, ds := newDS(t, errTransient, errTransient)
+		require.NoError(t, inner.DS.Delete(ctx, b.name))
+
+		err := ds.Update(ctx, b.name, bytes.NewReader(b.data))
+		require.NoError(t, err)
+		require.Equal(t, 3, inner.calls)
+
+		exists, err := inner.DS.Exists(ctx, b.name)
+		require.NoError(t, err)
+		require.True(t, exists)
+	})
+
+	t.Run("non-seekable update is not retried", func(t *testing.T) {
+		inner, ds := newDS(t, errTransient)
+		err := ds.Update(ctx, b.name, io.MultiReader(bytes.NewReader(b.data)))
+		require.ErrorIs(t, err, errTransient)
+		require.Equal(t, 1, inner.calls)
+	})
+
+	t.Run("interrupted read is resumed", func(t *testing.T) {
+		inner, ds := newDS(t)
+		inner.readFailPos = []int{1, 2}
+
+		rc, err := ds.Open(ctx, b.name)
+		require.NoError(t, err)
+		data, err := io.ReadAll(rc)
+		require.NoError(t, err)
+		require.NoError(t, rc.Close())
+		require.Equal(t, b.expected, data)
+		require.Equal(t, 3, inner.calls)
+
+		_, err = rc.Read(make([]byte, 1))
+		require.Error(t, err)
+	})
+
+	t.Run("data read before the interruption is validated", func(t *testing.T) {
+		inner, ds := newDS(t)
+		inner.readFailPos = []int{5}
+		inner.tamper = true
+
+		rc, err := ds.Open(ctx, b.name)
+		require.NoError(t, err)
+		_, err = io.ReadAll(rc)
+		require.ErrorIs(t, err, blobtypes.ErrValidationFailed)
+		require.NoError(t, rc.Close())
+		require.Equal(t, 2, inner.calls)
+	})
+
+	t.Run("interrupted dynamic link read is not resumed", func(t *testing.T) {
+		inner := &flakyDS{DS: InMemory()}
+		ds := WithRetry(inner, policy)
+		link := dynamicLinkPropagationData[0]
+		require.NoError(t, inner.DS.Update(ctx, link.name, bytes.NewReader(link.data)))
+		inner.readFailPos = []int{1}
+
+		rc, err := ds.Open(ctx, link.name)
+		require.NoError(t, err)
+		_, err = io.ReadAll(rc)
+		require.ErrorIs(t, err, errTransient)
+		require.NoError(t, rc.Close())
+		require.Equal(t, 1, inner.calls)
+	})
+
+	t.Run("read without progress fails", func(t *testing.T) {
+		inner, ds := newDS(t)
+		inner.readFailPos = []int{0, 0, 0, 0}
+
+		rc, err := ds.Open(ctx, b.name)
+		require.NoError(t, err)
+		_, err = io.ReadAll(rc)
+		require.ErrorIs(t, err, errTransient)
+		require.NoError(t, rc.Close())
+		require.Equal(t, 3, inner.calls)
+	})
+
+	t.Run("waiting is interrupted by context", func(t *testing.T) {
+		inner := &flakyDS{DS: InMemory(), errs: []error{errTransient, errTransient}}
+		ds := WithRetry(inner, RetryPolicy{InitialBackoff: time.Hour})
+
+		ctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+		defer cancel()
+
+		_, err := ds.Exists(ctx, b.name)
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+		require.Equal(t, 1, inner.calls)
+	})
+
+	t.Run("web connector", func(t *testing.T) {
+		failures := 2
+		handler := WebInterface(InMemory())
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if failures > 0 {
+				failures--
+				http.Error(w, "Try again", http.StatusServiceUnavailable)
+				return
+			}
+			handler.ServeHTTP(w, r)
+		}))
+		defer server.Close()
+
+		web, err := FromWeb(server.URL + "/")
+		require.NoError(t, err)
+		ds := WithRetry(web, policy)
+
+		err = ds.Update(ctx, b.name, strings.NewReader(string(b.data)))
+		require.NoError(t, err)
+
+		failures = 3
+		_, err = ds.Exists(ctx, b.name)
+		require.ErrorAs(t, err, new(*WebError))
+	})
+}
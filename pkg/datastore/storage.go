@@ -19,6 +19,7 @@ package datastore
 import (
 	"context"
 	"io"
+	"iter"
 
 	"github.com/cinode/go/pkg/common"
 )
@@ -34,5 +35,7 @@ type storage interface {
 	openReadStream(ctx context.Context, name *common.BlobName) (io.ReadCloser, error)
 	openWriteStream(ctx context.Context, name *common.BlobName) (WriteCloseCanceller, error)
 	exists(ctx context.Context, name *common.BlobName) (bool, error)
+	size(ctx context.Context, name *common.BlobName) (int64, error)
 	delete(ctx context.Context, name *common.BlobName) error
+	list(ctx context.Context) iter.Seq2[*common.BlobName, error]
 }
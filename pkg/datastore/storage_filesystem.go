@@ -18,30 +18,113 @@ package datastore
 
 import (
 	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"errors"
+	"fmt"
 	"io"
+	"iter"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/cinode/go/pkg/common"
+	"github.com/jbenet/go-base58"
 )
 
 const (
 	fsSuffixCurrent = ".c"
 	fsSuffixUpload  = ".u"
+
+	defaultFsShardDepth = 3
+	defaultFsShardWidth = 3
 )
 
 type fileSystem struct {
 	path string
+
+	// If set, files are stored under names being a keyed hash of the blob name
+	nameKey []byte
+
+	// Number of nested directory levels and number of name characters
+	// used for each level
+	shardDepth int
+	shardWidth int
 }
 
 var _ storage = (*fileSystem)(nil)
 
 func newStorageFilesystem(path string) (*fileSystem, error) {
-	err := os.MkdirAll(path, 0755)
+	err := prepareStorageDir(path)
+	if err != nil {
+		return nil, err
+	}
+	return newFileSystem(path), nil
+}
+
+// existingStorageFilesystem opens the storage in an existing directory
+// without creating or modifying anything
+func existingStorageFilesystem(path string) (*fileSystem, error) {
+	err := checkStorageDir(path)
 	if err != nil {
 		return nil, err
 	}
-	return &fileSystem{path: path}, nil
+	return newFileSystem(path), nil
+}
+
+func newFileSystem(path string) *fileSystem {
+	return &fileSystem{
+		path:       path,
+		shardDepth: defaultFsShardDepth,
+		shardWidth: defaultFsShardWidth,
+	}
+}
+
+func (fs *fileSystem) validateOptions() error {
+	if fs.shardDepth < 0 {
+		return fmt.Errorf("%w: negative shard depth %d", ErrInvalidShardLayout, fs.shardDepth)
+	}
+	if fs.shardWidth < 1 {
+		return fmt.Errorf("%w: shard width %d must be positive", ErrInvalidShardLayout, fs.shardWidth)
+	}
+	return nil
+}
+
+// prepareStorageDir ensures the storage directory exists and is writable,
+// the directory is created if missing
+func prepareStorageDir(path string) error {
+	if path == "" {
+		return fmt.Errorf("%w: empty path", ErrInvalidDatastorePath)
+	}
+
+	err := os.MkdirAll(path, 0755)
+	if err != nil {
+		return err
+	}
+
+	fl, err := os.CreateTemp(path, ".write-check-*")
+	if err != nil {
+		return fmt.Errorf("%w: directory '%s' is not writable: %w", ErrInvalidDatastorePath, path, err)
+	}
+	fl.Close()
+	return os.Remove(fl.Name())
+}
+
+// checkStorageDir ensures the storage directory exists, the directory is
+// not modified
+func checkStorageDir(path string) error {
+	if path == "" {
+		return fmt.Errorf("%w: empty path", ErrInvalidDatastorePath)
+	}
+
+	st, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if !st.IsDir() {
+		return fmt.Errorf("%w: '%s' is not a directory", ErrInvalidDatastorePath, path)
+	}
+	return nil
 }
 
 func (fs *fileSystem) kind() string {
@@ -145,6 +228,17 @@ func (fs *fileSystem) exists(ctx context.Context, name *common.BlobName) (bool,
 	return true, nil
 }
 
+func (fs *fileSystem) size(ctx context.Context, name *common.BlobName) (int64, error) {
+	fi, err := os.Stat(fs.getFileName(name, fsSuffixCurrent))
+	if os.IsNotExist(err) {
+		return 0, ErrNotFound
+	}
+	if err != nil {
+		return 0, err
+	}
+	return fi.Size(), nil
+}
+
 func (fs *fileSystem) delete(ctx context.Context, name *common.BlobName) error {
 	err := os.Remove(fs.getFileName(name, fsSuffixCurrent))
 	if os.IsNotExist(err) {
@@ -153,17 +247,75 @@ func (fs *fileSystem) delete(ctx context.Context, name *common.BlobName) error {
 	return err
 }
 
+var errStopIteration = errors.New("stop iteration")
+
+func (fs *fileSystem) list(ctx context.Context) iter.Seq2[*common.BlobName, error] {
+	return func(yield func(*common.BlobName, error) bool) {
+		if fs.nameKey != nil {
+			// Original blob names can not be restored from keyed hashes
+			yield(nil, fmt.Errorf("%w: blob names are hashed", ErrListNotSupported))
+			return
+		}
+
+		err := filepath.WalkDir(fs.path, func(path string, d os.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			if d.IsDir() || !strings.HasSuffix(path, fsSuffixCurrent) {
+				// Skip directories and temporary upload files
+				return nil
+			}
+
+			// Blob name is split into sharding directories, joining all
+			// path fragments restores the original name
+			rel, err := filepath.Rel(fs.path, strings.TrimSuffix(path, fsSuffixCurrent))
+			if err != nil {
+				return err
+			}
+			nameStr := strings.ReplaceAll(rel, string(filepath.Separator), "")
+
+			bn, err := common.BlobNameFromString(nameStr)
+			if err != nil || bn.String() != nameStr {
+				// Not a blob file
+				return nil
+			}
+
+			if !yield(bn, nil) {
+				return errStopIteration
+			}
+			return nil
+		})
+		if err != nil && !errors.Is(err, errStopIteration) {
+			yield(nil, err)
+		}
+	}
+}
+
 func (fs *fileSystem) getFileName(name *common.BlobName, suffix string) string {
 	fNameParts := []string{fs.path}
 
-	nameStr := name.String()
-	for i := 0; i < 3; i++ {
-		if len(nameStr) > 3 {
-			fNameParts = append(fNameParts, nameStr[:3])
-			nameStr = nameStr[3:]
+	nameStr := fs.storedName(name)
+	for i := 0; i < fs.shardDepth; i++ {
+		if len(nameStr) > fs.shardWidth {
+			fNameParts = append(fNameParts, nameStr[:fs.shardWidth])
+			nameStr = nameStr[fs.shardWidth:]
 		}
 	}
 	fNameParts = append(fNameParts, nameStr+suffix)
 
 	return filepath.Join(fNameParts...)
 }
+
+// storedName returns the name under which the blob is stored on disk
+func (fs *fileSystem) storedName(name *common.BlobName) string {
+	if fs.nameKey == nil {
+		return name.String()
+	}
+
+	mac := hmac.New(sha256.New, fs.nameKey)
+	mac.Write(name.Bytes())
+	return base58.Encode(mac.Sum(nil))
+}
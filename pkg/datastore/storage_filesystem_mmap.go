@@ -0,0 +1,66 @@
+/*
+Copyright © 2022 Bartłomiej Święcki (byo)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package datastore
+
+import (
+	"context"
+	"io"
+	"os"
+
+	"github.com/cinode/go/pkg/common"
+)
+
+// fileSystemMmap is a read-only storage using the same layout as fileSystem,
+// blob files are memory-mapped when opened
+type fileSystemMmap struct {
+	*fileSystem
+}
+
+var _ storage = (*fileSystemMmap)(nil)
+
+func newStorageFilesystemMmap(path string) (*fileSystemMmap, error) {
+	s, err := existingStorageFilesystem(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return &fileSystemMmap{fileSystem: s}, nil
+}
+
+func (fs *fileSystemMmap) kind() string {
+	return "FileSystemMmap"
+}
+
+func (fs *fileSystemMmap) address() string {
+	return fileMmapPrefix + fs.path
+}
+
+func (fs *fileSystemMmap) openReadStream(ctx context.Context, name *common.BlobName) (io.ReadCloser, error) {
+	rc, err := mmapFile(fs.getFileName(name, fsSuffixCurrent))
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+	return rc, err
+}
+
+func (fs *fileSystemMmap) openWriteStream(ctx context.Context, name *common.BlobName) (WriteCloseCanceller, error) {
+	return nil, ErrReadOnly
+}
+
+func (fs *fileSystemMmap) delete(ctx context.Context, name *common.BlobName) error {
+	return ErrReadOnly
+}
@@ -0,0 +1,139 @@
+/*
+Copyright © 2022 Bartłomiej Święcki (byo)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package datastore
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestInFileSystemMmap(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	src, err := InFileSystem(dir)
+	require.NoError(t, err)
+	for _, b := range testBlobs {
+		err := src.Update(ctx, b.name, bytes.NewReader(b.data))
+		require.NoError(t, err)
+	}
+
+	ds, err := InFileSystemMmap(dir)
+	require.NoError(t, err)
+	require.Equal(t, "FileSystemMmap", ds.Kind())
+	require.Equal(t, "file-mmap://"+dir, ds.Address())
+
+	t.Run("reads match", func(t *testing.T) {
+		for _, b := range testBlobs {
+			exists, err := ds.Exists(ctx, b.name)
+			require.NoError(t, err)
+			require.True(t, exists)
+
+			rc, err := ds.Open(ctx, b.name)
+			require.NoError(t, err)
+			data, err := io.ReadAll(rc)
+			require.NoError(t, err)
+			require.NoError(t, rc.Close())
+			require.Equal(t, b.data, data)
+		}
+	})
+
+	t.Run("missing blob", func(t *testing.T) {
+		_, err := ds.Open(ctx, emptyBlobNameDynamicLink)
+		require.ErrorIs(t, err, ErrNotFound)
+	})
+
+	t.Run("writes are rejected", func(t *testing.T) {
+		for _, b := range testBlobs {
+			err := ds.Update(ctx, b.name, bytes.NewReader(b.data))
+			require.ErrorIs(t, err, ErrReadOnly)
+
+			err = ds.Delete(ctx, b.name)
+			require.ErrorIs(t, err, ErrReadOnly)
+
+			exists, err := src.Exists(ctx, b.name)
+			require.NoError(t, err)
+			require.True(t, exists)
+		}
+	})
+
+	t.Run("file removed while reading", func(t *testing.T) {
+		if !mmapSupported {
+			t.Skip("memory mapping not supported on this platform")
+		}
+
+		dir := t.TempDir()
+		src, err := InFileSystem(dir)
+		require.NoError(t, err)
+
+		b := testBlobs[0]
+		require.NoError(t, src.Update(ctx, b.name, bytes.NewReader(b.data)))
+
+		ds, err := InFileSystemMmap(dir)
+		require.NoError(t, err)
+
+		rc, err := ds.Open(ctx, b.name)
+		require.NoError(t, err)
+
+		require.NoError(t, src.Delete(ctx, b.name))
+
+		data, err := io.ReadAll(rc)
+		require.NoError(t, err)
+		require.Equal(t, b.data, data)
+
+		require.NoError(t, rc.Close())
+		require.NoError(t, rc.Close())
+	})
+
+	t.Run("read after close", func(t *testing.T) {
+		rc, err := mmapFile(ds.(*datastore).s.(*fileSystemMmap).getFileName(testBlobs[0].name, fsSuffixCurrent))
+		require.NoError(t, err)
+		require.NoError(t, rc.Close())
+
+		_, err = rc.Read(make([]byte, 1))
+		require.ErrorIs(t, err, os.ErrClosed)
+	})
+
+	t.Run("listing", func(t *testing.T) {
+		orphans, _, err := FindBlobsNotIn(ctx, ds, nil)
+		require.NoError(t, err)
+		require.Len(t, orphans, len(testBlobs))
+	})
+}
+
+func TestInFileSystemMmapConfigValidation(t *testing.T) {
+	_, err := InFileSystemMmap("")
+	require.ErrorIs(t, err, ErrInvalidDatastorePath)
+
+	_, err = InFileSystemMmap(filepath.Join(t.TempDir(), "missing"))
+	require.ErrorIs(t, err, os.ErrNotExist)
+
+	path := filepath.Join(t.TempDir(), "file")
+	require.NoError(t, os.WriteFile(path, nil, 0644))
+	_, err = InFileSystemMmap(path)
+	require.ErrorIs(t, err, ErrInvalidDatastorePath)
+
+	ds, err := FromLocation("file-mmap://" + t.TempDir())
+	require.NoError(t, err)
+	require.Equal(t, "FileSystemMmap", ds.Kind())
+}
@@ -17,11 +17,16 @@ limitations under the License.
 package datastore
 
 import (
+	"bytes"
 	"context"
+	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
+	"github.com/cinode/go/pkg/common"
 	"github.com/stretchr/testify/require"
 )
 
@@ -130,3 +135,173 @@ func TestFilesystemExistsFailure(t *testing.T) {
 	_, err = fs.exists(context.Background(), emptyBlobNameStatic)
 	require.IsType(t, &os.PathError{}, err)
 }
+
+func TestFilesystemHashedNames(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+
+	ds, err := InFileSystem(dir, FileSystemOptionHashedNames([]byte("secret")))
+	require.NoError(t, err)
+
+	for _, b := range testBlobs {
+		err := ds.Update(ctx, b.name, bytes.NewReader(b.data))
+		require.NoError(t, err)
+	}
+
+	t.Run("on-disk names differ from blob names", func(t *testing.T) {
+		files := []string{}
+		err := filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+			if err == nil && !d.IsDir() {
+				files = append(files, strings.ReplaceAll(
+					strings.TrimPrefix(path, dir), string(filepath.Separator), "",
+				))
+			}
+			return err
+		})
+		require.NoError(t, err)
+		require.Len(t, files, len(testBlobs))
+
+		for _, b := range testBlobs {
+			for _, f := range files {
+				require.NotContains(t, f, b.name.String())
+			}
+		}
+	})
+
+	t.Run("all operations work with original blob names", func(t *testing.T) {
+		for _, b := range testBlobs {
+			exists, err := ds.Exists(ctx, b.name)
+			require.NoError(t, err)
+			require.True(t, exists)
+
+			rc, err := ds.Open(ctx, b.name)
+			require.NoError(t, err)
+			data, err := io.ReadAll(rc)
+			require.NoError(t, err)
+			require.NoError(t, rc.Close())
+			require.Equal(t, b.data, data)
+		}
+
+		err := ds.Delete(ctx, testBlobs[0].name)
+		require.NoError(t, err)
+
+		exists, err := ds.Exists(ctx, testBlobs[0].name)
+		require.NoError(t, err)
+		require.False(t, exists)
+	})
+
+	t.Run("blobs are not visible with a different key", func(t *testing.T) {
+		ds2, err := InFileSystem(dir, FileSystemOptionHashedNames([]byte("other secret")))
+		require.NoError(t, err)
+
+		exists, err := ds2.Exists(ctx, testBlobs[1].name)
+		require.NoError(t, err)
+		require.False(t, exists)
+	})
+
+	t.Run("blobs can not be listed", func(t *testing.T) {
+		_, _, err := FindBlobsNotIn(ctx, ds, nil)
+		require.ErrorIs(t, err, ErrListNotSupported)
+	})
+}
+
+func TestFilesystemShardLayout(t *testing.T) {
+	ctx := context.Background()
+	name := testBlobs[0].name
+	nameStr := name.String()
+
+	for _, d := range []struct {
+		depth, width int
+		expected     string
+	}{
+		{3, 3, filepath.Join(nameStr[:3], nameStr[3:6], nameStr[6:9], nameStr[9:])},
+		{0, 3, nameStr},
+		{1, 2, filepath.Join(nameStr[:2], nameStr[2:])},
+		{2, 5, filepath.Join(nameStr[:5], nameStr[5:10], nameStr[10:])},
+		{100, 20, filepath.Join(nameStr[:20], nameStr[20:40], nameStr[40:])},
+	} {
+		t.Run(fmt.Sprintf("depth %d width %d", d.depth, d.width), func(t *testing.T) {
+			dir := t.TempDir()
+			ds, err := InFileSystem(dir,
+				FileSystemOptionShardDepth(d.depth),
+				FileSystemOptionShardWidth(d.width),
+			)
+			require.NoError(t, err)
+
+			for _, b := range testBlobs {
+				err := ds.Update(ctx, b.name, bytes.NewReader(b.data))
+				require.NoError(t, err)
+			}
+
+			require.FileExists(t, filepath.Join(dir, d.expected+fsSuffixCurrent))
+
+			listed := []*common.BlobName{}
+			for n, err := range ds.List(ctx) {
+				require.NoError(t, err)
+				listed = append(listed, n)
+			}
+			require.Len(t, listed, len(testBlobs))
+
+			rc, err := ds.Open(ctx, name)
+			require.NoError(t, err)
+			data, err := io.ReadAll(rc)
+			require.NoError(t, err)
+			require.NoError(t, rc.Close())
+			require.Equal(t, testBlobs[0].data, data)
+
+			require.NoError(t, ds.Delete(ctx, name))
+			exists, err := ds.Exists(ctx, name)
+			require.NoError(t, err)
+			require.False(t, exists)
+		})
+	}
+
+	t.Run("invalid layout", func(t *testing.T) {
+		_, err := InFileSystem(t.TempDir(), FileSystemOptionShardDepth(-1))
+		require.ErrorIs(t, err, ErrInvalidShardLayout)
+
+		_, err = InFileSystem(t.TempDir(), FileSystemOptionShardWidth(0))
+		require.ErrorIs(t, err, ErrInvalidShardLayout)
+
+		_, err = InFileSystemMmap(t.TempDir(), FileSystemOptionShardWidth(0))
+		require.ErrorIs(t, err, ErrInvalidShardLayout)
+	})
+}
+
+func TestMigrateFileSystemLayout(t *testing.T) {
+	ctx := context.Background()
+	srcDir, dstDir := t.TempDir(), t.TempDir()
+
+	src, err := InFileSystem(srcDir)
+	require.NoError(t, err)
+	for _, b := range testBlobs {
+		err := src.Update(ctx, b.name, bytes.NewReader(b.data))
+		require.NoError(t, err)
+	}
+
+	dstOpts := []FileSystemOption{
+		FileSystemOptionShardDepth(1),
+		FileSystemOptionShardWidth(2),
+	}
+	stats, err := MigrateFileSystemLayout(ctx, srcDir, nil, dstDir, dstOpts)
+	require.NoError(t, err)
+	require.Equal(t, len(testBlobs), stats.Copied)
+
+	// Data is not visible when opened with a different layout
+	wrongLayout, err := InFileSystem(dstDir)
+	require.NoError(t, err)
+	exists, err := wrongLayout.Exists(ctx, testBlobs[0].name)
+	require.NoError(t, err)
+	require.False(t, exists)
+
+	dst, err := InFileSystem(dstDir, dstOpts...)
+	require.NoError(t, err)
+	for _, b := range testBlobs {
+		exists, err := dst.Exists(ctx, b.name)
+		require.NoError(t, err)
+		require.True(t, exists)
+	}
+
+	_, err = MigrateFileSystemLayout(ctx, srcDir, nil, srcDir+"/", dstOpts)
+	require.ErrorIs(t, err, ErrInvalidDatastorePath)
+}
@@ -20,8 +20,10 @@ import (
 	"bytes"
 	"context"
 	"io"
+	"iter"
 	"sync"
 
+	"github.com/cinode/go/pkg/blobtypes"
 	"github.com/cinode/go/pkg/common"
 )
 
@@ -35,6 +37,9 @@ type memory struct {
 
 	// Mutex to blobs
 	rw sync.RWMutex
+
+	// Optional eviction of least recently used static blobs
+	lru *memoryLRU
 }
 
 var _ storage = (*memory)(nil)
@@ -62,14 +67,19 @@ func (m *memory) openReadStream(ctx context.Context, name *common.BlobName) (io.
 	if !ok {
 		return nil, ErrNotFound
 	}
+	if m.lru != nil {
+		m.lru.touch(name.String())
+	}
 
+	// Evicting the blob does not affect readers, the data is not modified
 	return io.NopCloser(bytes.NewReader(b)), nil
 }
 
 type memoryWriteCloser struct {
-	b *bytes.Buffer
-	n string
-	m *memory
+	b      *bytes.Buffer
+	n      string
+	m      *memory
+	static bool
 }
 
 func (w *memoryWriteCloser) Write(b []byte) (int, error) {
@@ -88,7 +98,11 @@ func (w *memoryWriteCloser) Close() error {
 	defer w.m.rw.Unlock()
 
 	delete(w.m.block, w.n)
+	old := w.m.bmap[w.n]
 	w.m.bmap[w.n] = w.b.Bytes()
+	if w.m.lru != nil && w.static {
+		w.m.lru.stored(w.m.bmap, w.n, int64(len(old)), int64(w.b.Len()))
+	}
 	return nil
 }
 
@@ -105,9 +119,10 @@ func (m *memory) openWriteStream(ctx context.Context, name *common.BlobName) (Wr
 	m.block[ns] = struct{}{}
 
 	return &memoryWriteCloser{
-		b: bytes.NewBuffer(nil),
-		n: ns,
-		m: m,
+		b:      bytes.NewBuffer(nil),
+		n:      ns,
+		m:      m,
+		static: name.Type() == blobtypes.Static,
 	}, nil
 }
 
@@ -122,15 +137,55 @@ func (m *memory) exists(ctx context.Context, n *common.BlobName) (bool, error) {
 	return true, nil
 }
 
+func (m *memory) size(ctx context.Context, n *common.BlobName) (int64, error) {
+	m.rw.RLock()
+	defer m.rw.RUnlock()
+
+	b, ok := m.bmap[n.String()]
+	if !ok {
+		return 0, ErrNotFound
+	}
+
+	return int64(len(b)), nil
+}
+
 func (m *memory) delete(ctx context.Context, n *common.BlobName) error {
 	m.rw.Lock()
 	defer m.rw.Unlock()
 
-	_, ok := m.bmap[n.String()]
+	b, ok := m.bmap[n.String()]
 	if !ok {
 		return ErrNotFound
 	}
 
 	delete(m.bmap, n.String())
+	if m.lru != nil {
+		m.lru.deleted(n.String(), int64(len(b)))
+	}
 	return nil
 }
+
+func (m *memory) list(ctx context.Context) iter.Seq2[*common.BlobName, error] {
+	return func(yield func(*common.BlobName, error) bool) {
+		// Take a snapshot of names, that way blobs can be modified
+		// while the iteration is in progress
+		m.rw.RLock()
+		names := make([]string, 0, len(m.bmap))
+		for n := range m.bmap {
+			names = append(names, n)
+		}
+		m.rw.RUnlock()
+
+		for _, n := range names {
+			if err := ctx.Err(); err != nil {
+				yield(nil, err)
+				return
+			}
+
+			bn, err := common.BlobNameFromString(n)
+			if !yield(bn, err) {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,137 @@
+/*
+Copyright © 2022 Bartłomiej Święcki (byo)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package datastore
+
+import (
+	"container/list"
+	"sync"
+)
+
+// LRUStats contains usage statistics of a size-bound in-memory datastore
+type LRUStats struct {
+	// UsedBytes is the total size of stored static blobs
+	UsedBytes int64
+
+	// MaxBytes is the limit of the total size of static blobs
+	MaxBytes int64
+
+	// Evictions is the number of static blobs removed to fit the limit
+	Evictions int64
+}
+
+// LRUStatsReporter is implemented by datastores created with InMemoryLRU
+type LRUStatsReporter interface {
+	LRUStats() LRUStats
+}
+
+// memoryLRU tracks the usage order of static blobs stored in the memory
+// storage. Only static blobs are tracked and evicted, dynamic links are small
+// and can not be restored from their name thus those are always kept.
+type memoryLRU struct {
+	maxBytes int64
+
+	// mutex protects the fields below, it is taken while holding the memory
+	// storage mutex or alone when only the usage order is updated
+	mutex     sync.Mutex
+	order     *list.List // front = most recently used, values are names
+	elements  map[string]*list.Element
+	usedBytes int64
+	evictions int64
+}
+
+func newMemoryLRU(maxBytes int64) *memoryLRU {
+	return &memoryLRU{
+		maxBytes: maxBytes,
+		order:    list.New(),
+		elements: map[string]*list.Element{},
+	}
+}
+
+// touch marks the blob as the most recently used one
+func (l *memoryLRU) touch(name string) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if e, found := l.elements[name]; found {
+		l.order.MoveToFront(e)
+	}
+}
+
+// stored starts tracking the blob that was just stored and removes least
+// recently used blobs from the blob map if the limit is exceeded. The stored
+// blob itself is never evicted, even if it alone exceeds the limit. Must be
+// called with the memory storage write lock held.
+func (l *memoryLRU) stored(bmap map[string][]byte, name string, oldSize, newSize int64) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if e, found := l.elements[name]; found {
+		l.order.MoveToFront(e)
+		l.usedBytes -= oldSize
+	} else {
+		l.elements[name] = l.order.PushFront(name)
+	}
+	l.usedBytes += newSize
+
+	for l.usedBytes > l.maxBytes && l.order.Len() > 1 {
+		oldest := l.order.Remove(l.order.Back()).(string)
+		delete(l.elements, oldest)
+		l.usedBytes -= int64(len(bmap[oldest]))
+		delete(bmap, oldest)
+		l.evictions++
+	}
+}
+
+// deleted stops tracking the blob, must be called with the memory storage
+// write lock held
+func (l *memoryLRU) deleted(name string, size int64) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if e, found := l.elements[name]; found {
+		l.order.Remove(e)
+		delete(l.elements, name)
+		l.usedBytes -= size
+	}
+}
+
+func (l *memoryLRU) stats() LRUStats {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	return LRUStats{
+		UsedBytes: l.usedBytes,
+		MaxBytes:  l.maxBytes,
+		Evictions: l.evictions,
+	}
+}
+
+// lruMemoryDatastore exposes statistics of the memory storage with LRU
+// eviction enabled
+type lruMemoryDatastore struct {
+	*datastore
+	lru *memoryLRU
+}
+
+var (
+	_ DS               = (*lruMemoryDatastore)(nil)
+	_ LRUStatsReporter = (*lruMemoryDatastore)(nil)
+)
+
+func (ds *lruMemoryDatastore) LRUStats() LRUStats {
+	return ds.lru.stats()
+}
@@ -0,0 +1,189 @@
+/*
+Copyright © 2023 Bartłomiej Święcki (byo)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package datastore
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"testing"
+
+	"github.com/cinode/go/pkg/blobtypes"
+	"github.com/cinode/go/pkg/common"
+	"github.com/stretchr/testify/require"
+)
+
+func lruTestBlob(t require.TestingT, content string) (*common.BlobName, []byte) {
+	data := []byte(content)
+	hash := sha256.Sum256(data)
+	bn, err := common.BlobNameFromHashAndType(hash[:], blobtypes.Static)
+	require.NoError(t, err)
+	return bn, data
+}
+
+func TestInMemoryLRU(t *testing.T) {
+	ctx := context.Background()
+
+	store := func(t *testing.T, ds DS, content string) *common.BlobName {
+		bn, data := lruTestBlob(t, content)
+		require.NoError(t, ds.Update(ctx, bn, bytes.NewReader(data)))
+		return bn
+	}
+
+	exists := func(t *testing.T, ds DS, bn *common.BlobName) bool {
+		exists, err := ds.Exists(ctx, bn)
+		require.NoError(t, err)
+		return exists
+	}
+
+	read := func(t *testing.T, ds DS, bn *common.BlobName) {
+		rc, err := ds.Open(ctx, bn)
+		require.NoError(t, err)
+		_, err = io.Copy(io.Discard, rc)
+		require.NoError(t, err)
+		require.NoError(t, rc.Close())
+	}
+
+	stats := func(ds DS) LRUStats {
+		return ds.(LRUStatsReporter).LRUStats()
+	}
+
+	t.Run("evict least recently used", func(t *testing.T) {
+		ds := InMemoryLRU(30)
+
+		a := store(t, ds, "aaaaaaaaaa")
+		b := store(t, ds, "bbbbbbbbbb")
+		c := store(t, ds, "cccccccccc")
+		require.Equal(t, LRUStats{UsedBytes: 30, MaxBytes: 30}, stats(ds))
+
+		// Reading a blob makes it the most recently used one
+		read(t, ds, a)
+
+		d := store(t, ds, "dddddddddd")
+		require.True(t, exists(t, ds, a))
+		require.False(t, exists(t, ds, b))
+		require.True(t, exists(t, ds, c))
+		require.True(t, exists(t, ds, d))
+		require.Equal(t, LRUStats{UsedBytes: 30, MaxBytes: 30, Evictions: 1}, stats(ds))
+
+		// Evicted blob can be stored again
+		store(t, ds, "bbbbbbbbbb")
+		require.True(t, exists(t, ds, b))
+		require.False(t, exists(t, ds, c))
+		require.Equal(t, LRUStats{UsedBytes: 30, MaxBytes: 30, Evictions: 2}, stats(ds))
+
+		// Storing the same blob again does not change the usage
+		store(t, ds, "bbbbbbbbbb")
+		require.Equal(t, LRUStats{UsedBytes: 30, MaxBytes: 30, Evictions: 2}, stats(ds))
+	})
+
+	t.Run("oversized blob", func(t *testing.T) {
+		ds := InMemoryLRU(5)
+
+		a := store(t, ds, "aaa")
+		b := store(t, ds, "bbbbbbbbbb")
+		require.False(t, exists(t, ds, a))
+		require.True(t, exists(t, ds, b))
+		require.Equal(t, LRUStats{UsedBytes: 10, MaxBytes: 5, Evictions: 1}, stats(ds))
+
+		c := store(t, ds, "ccc")
+		require.False(t, exists(t, ds, b))
+		require.True(t, exists(t, ds, c))
+		require.Equal(t, LRUStats{UsedBytes: 3, MaxBytes: 5, Evictions: 2}, stats(ds))
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		ds := InMemoryLRU(30)
+
+		a := store(t, ds, "aaaaaaaaaa")
+		store(t, ds, "bbbbbbbbbb")
+		require.NoError(t, ds.Delete(ctx, a))
+		require.Equal(t, LRUStats{UsedBytes: 10, MaxBytes: 30}, stats(ds))
+
+		store(t, ds, "cccccccccc")
+		store(t, ds, "dddddddddd")
+		require.Equal(t, LRUStats{UsedBytes: 30, MaxBytes: 30}, stats(ds))
+	})
+
+	t.Run("dynamic links are not evicted", func(t *testing.T) {
+		ds := InMemoryLRU(10)
+
+		link := dynamicLinkPropagationData[0]
+		require.NoError(t, ds.Update(ctx, link.name, bytes.NewReader(link.data)))
+
+		for i := 0; i < 10; i++ {
+			store(t, ds, fmt.Sprintf("blob-%05d", i))
+		}
+		require.True(t, exists(t, ds, link.name))
+		require.Equal(t, LRUStats{UsedBytes: 10, MaxBytes: 10, Evictions: 9}, stats(ds))
+
+		require.NoError(t, ds.Delete(ctx, link.name))
+		require.Equal(t, LRUStats{UsedBytes: 10, MaxBytes: 10, Evictions: 9}, stats(ds))
+	})
+
+	t.Run("concurrent reads and updates", func(t *testing.T) {
+		const threadCnt = 10
+		const opCnt = 200
+
+		ds := InMemoryLRU(100)
+
+		wg := sync.WaitGroup{}
+		wg.Add(threadCnt)
+		for i := 0; i < threadCnt; i++ {
+			go func(i int) {
+				defer wg.Done()
+				for n := 0; n < opCnt; n++ {
+					bn, data := lruTestBlob(t, fmt.Sprintf("blob-%05d", (i+n)%30))
+
+					rc, err := ds.Open(ctx, bn)
+					if errors.Is(err, ErrNotFound) {
+						err = ds.Update(ctx, bn, bytes.NewReader(data))
+						if errors.Is(err, ErrUploadInProgress) {
+							continue
+						}
+						require.NoError(t, err)
+						continue
+					}
+					require.NoError(t, err)
+
+					readBack, err := io.ReadAll(rc)
+					require.NoError(t, err)
+					require.Equal(t, data, readBack)
+					require.NoError(t, rc.Close())
+				}
+			}(i)
+		}
+		wg.Wait()
+
+		st := stats(ds)
+		require.LessOrEqual(t, st.UsedBytes, int64(100))
+		require.Positive(t, st.Evictions)
+	})
+
+	t.Run("link metrics and orphans", func(t *testing.T) {
+		ds, err := WithLinkMetrics(InMemoryLRU(100), newTestLinkMetrics())
+		require.NoError(t, err)
+		require.Implements(t, (*LRUStatsReporter)(nil), ds)
+
+		_, _, err = FindBlobsNotIn(context.Background(), ds, nil)
+		require.NoError(t, err)
+	})
+}
@@ -20,6 +20,7 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"iter"
 	"os"
 	"path/filepath"
 	"sync/atomic"
@@ -35,7 +36,17 @@ type rawFileSystem struct {
 var _ storage = (*rawFileSystem)(nil)
 
 func newStorageRawFilesystem(path string) (*rawFileSystem, error) {
-	err := os.MkdirAll(path, 0755)
+	err := prepareStorageDir(path)
+	if err != nil {
+		return nil, err
+	}
+	return &rawFileSystem{path: path}, nil
+}
+
+// existingStorageRawFilesystem opens the storage in an existing directory
+// without creating or modifying anything
+func existingStorageRawFilesystem(path string) (*rawFileSystem, error) {
+	err := checkStorageDir(path)
 	if err != nil {
 		return nil, err
 	}
@@ -108,6 +119,17 @@ func (fs *rawFileSystem) exists(ctx context.Context, name *common.BlobName) (boo
 	return true, nil
 }
 
+func (fs *rawFileSystem) size(ctx context.Context, name *common.BlobName) (int64, error) {
+	fi, err := os.Stat(filepath.Join(fs.path, name.String()))
+	if os.IsNotExist(err) {
+		return 0, ErrNotFound
+	}
+	if err != nil {
+		return 0, err
+	}
+	return fi.Size(), nil
+}
+
 func (fs *rawFileSystem) delete(ctx context.Context, name *common.BlobName) error {
 	err := os.Remove(filepath.Join(fs.path, name.String()))
 	if os.IsNotExist(err) {
@@ -115,3 +137,33 @@ func (fs *rawFileSystem) delete(ctx context.Context, name *common.BlobName) erro
 	}
 	return err
 }
+
+func (fs *rawFileSystem) list(ctx context.Context) iter.Seq2[*common.BlobName, error] {
+	return func(yield func(*common.BlobName, error) bool) {
+		entries, err := os.ReadDir(fs.path)
+		if err != nil {
+			yield(nil, err)
+			return
+		}
+
+		for _, e := range entries {
+			if err := ctx.Err(); err != nil {
+				yield(nil, err)
+				return
+			}
+			if !e.Type().IsRegular() {
+				continue
+			}
+
+			// Skip temporary files and any other files not being a blob
+			bn, err := common.BlobNameFromString(e.Name())
+			if err != nil || bn.String() != e.Name() {
+				continue
+			}
+
+			if !yield(bn, nil) {
+				return
+			}
+		}
+	}
+}
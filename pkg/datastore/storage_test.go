@@ -245,3 +245,57 @@ func TestStorageSaveWhileDeleting(t *testing.T) {
 		})
 	}
 }
+
+func TestStorageList(t *testing.T) {
+	rawFS, err := newStorageRawFilesystem(t.TempDir())
+	require.NoError(t, err)
+
+	for _, st := range append(allTestStorages(t), rawFS) {
+		t.Run(st.kind(), func(t *testing.T) {
+			for _, b := range testBlobs {
+				w, err := st.openWriteStream(context.Background(), b.name)
+				require.NoError(t, err)
+				_, err = w.Write(b.data)
+				require.NoError(t, err)
+				require.NoError(t, w.Close())
+			}
+
+			// Upload in progress must not be listed
+			w, err := st.openWriteStream(context.Background(), emptyBlobNameStatic)
+			require.NoError(t, err)
+			defer w.Cancel()
+
+			expected := []string{}
+			for _, b := range testBlobs {
+				expected = append(expected, b.name.String())
+			}
+
+			listed := []string{}
+			for bn, err := range st.list(context.Background()) {
+				require.NoError(t, err)
+				listed = append(listed, bn.String())
+			}
+			require.ElementsMatch(t, expected, listed)
+
+			t.Run("stop iteration early", func(t *testing.T) {
+				cnt := 0
+				for _, err := range st.list(context.Background()) {
+					require.NoError(t, err)
+					cnt++
+					break
+				}
+				require.Equal(t, 1, cnt)
+			})
+
+			t.Run("cancelled context", func(t *testing.T) {
+				ctx, cancel := context.WithCancel(context.Background())
+				cancel()
+
+				for bn, err := range st.list(ctx) {
+					require.ErrorIs(t, err, context.Canceled)
+					require.Nil(t, bn)
+				}
+			})
+		})
+	}
+}
@@ -0,0 +1,151 @@
+/*
+Copyright © 2022 Bartłomiej Święcki (byo)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package datastore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/cinode/go/pkg/blobtypes"
+	"github.com/cinode/go/pkg/common"
+	"github.com/cinode/go/pkg/utilities/progress"
+)
+
+const (
+	defaultSyncBatchSize = 1000
+)
+
+// SyncOptions contains optional parameters of the Sync operation
+type SyncOptions struct {
+	// BatchSize is the number of static blobs checked with a single ExistsMany
+	// call on the destination datastore, a default value is used if zero
+	BatchSize int
+
+	// Progress is called with the number of bytes copied so far, the total
+	// number of bytes is not known upfront
+	Progress progress.Callback
+}
+
+// SyncStats contains statistics gathered during the Sync operation
+type SyncStats struct {
+	// Copied is the number of blobs sent to the destination datastore
+	Copied int
+	// Skipped is the number of blobs that did not have to be copied
+	Skipped int
+	// Bytes is the total size of copied blobs
+	Bytes int64
+}
+
+// Sync copies blobs that are stored in the src datastore but are missing in
+// the dst one.
+//
+// Static blobs are only copied if they do not exist in the destination yet.
+// Dynamic links are always copied, the destination datastore keeps
+// the version that takes precedence over the other one.
+//
+// Statistics gathered until the failure are returned along with the error.
+func Sync(ctx context.Context, src, dst DS, opts SyncOptions) (SyncStats, error) {
+	batchSize := opts.BatchSize
+	if batchSize <= 0 {
+		batchSize = defaultSyncBatchSize
+	}
+
+	stats := SyncStats{}
+	copied := progress.NewCounter(-1, opts.Progress)
+	batch := make([]*common.BlobName, 0, batchSize)
+
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		exists, err := dst.ExistsMany(ctx, batch)
+		if err != nil {
+			return fmt.Errorf("failed to check blobs existence in the destination datastore: %w", err)
+		}
+		for i, name := range batch {
+			if exists[i] {
+				stats.Skipped++
+				continue
+			}
+			err := syncBlob(ctx, src, dst, name, copied, &stats)
+			if err != nil {
+				return err
+			}
+		}
+		batch = batch[:0]
+		return nil
+	}
+
+	for name, err := range src.List(ctx) {
+		if err != nil {
+			return stats, fmt.Errorf("failed to list blobs in the source datastore: %w", err)
+		}
+
+		if name.Type() != blobtypes.Static {
+			err := syncBlob(ctx, src, dst, name, copied, &stats)
+			if err != nil {
+				return stats, err
+			}
+			continue
+		}
+
+		batch = append(batch, name)
+		if len(batch) >= batchSize {
+			err := flush()
+			if err != nil {
+				return stats, err
+			}
+		}
+	}
+
+	err := flush()
+	if err != nil {
+		return stats, err
+	}
+
+	return stats, nil
+}
+
+func syncBlob(
+	ctx context.Context,
+	src, dst DS,
+	name *common.BlobName,
+	copied *progress.Counter,
+	stats *SyncStats,
+) error {
+	rc, err := src.Open(ctx, name)
+	if errors.Is(err, ErrNotFound) {
+		// Removed in the meantime
+		stats.Skipped++
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read blob %s: %w", name, err)
+	}
+	defer rc.Close()
+
+	copiedBefore := copied.N()
+	err = dst.Update(ctx, name, copied.Reader(rc))
+	if err != nil {
+		return fmt.Errorf("failed to store blob %s: %w", name, err)
+	}
+
+	stats.Copied++
+	stats.Bytes += copied.N() - copiedBefore
+	return nil
+}
@@ -0,0 +1,133 @@
+/*
+Copyright © 2022 Bartłomiej Święcki (byo)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package datastore
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"iter"
+	"testing"
+
+	"github.com/cinode/go/pkg/common"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSync(t *testing.T) {
+	ctx := context.Background()
+
+	readLink := func(t *testing.T, ds DS) []byte {
+		r, err := ds.Open(ctx, dynamicLinkPropagationData[0].name)
+		require.NoError(t, err)
+		defer r.Close()
+		data := bytes.NewBuffer(nil)
+		_, err = data.ReadFrom(r)
+		require.NoError(t, err)
+		return data.Bytes()
+	}
+
+	for _, batchSize := range []int{0, 1, 2} {
+		t.Run(fmt.Sprintf("batch size %d", batchSize), func(t *testing.T) {
+			src := InMemory()
+			dst, err := InFileSystem(t.TempDir())
+			require.NoError(t, err)
+
+			for _, b := range testBlobs {
+				require.NoError(t, src.Update(ctx, b.name, bytes.NewReader(b.data)))
+			}
+			link := dynamicLinkPropagationData[0]
+			require.NoError(t, src.Update(ctx, link.name, bytes.NewReader(link.data)))
+
+			// Destination already contains some blobs and a newer link version
+			require.NoError(t, dst.Update(ctx, testBlobs[0].name, bytes.NewReader(testBlobs[0].data)))
+			newerLink := dynamicLinkPropagationData[1]
+			require.NoError(t, dst.Update(ctx, newerLink.name, bytes.NewReader(newerLink.data)))
+
+			reported := []int64{}
+			stats, err := Sync(ctx, src, dst, SyncOptions{
+				BatchSize: batchSize,
+				Progress: func(n, total int64) {
+					require.EqualValues(t, -1, total)
+					reported = append(reported, n)
+				},
+			})
+			require.NoError(t, err)
+
+			expectedBytes := int64(len(link.data))
+			for _, b := range testBlobs[1:] {
+				expectedBytes += int64(len(b.data))
+			}
+			require.Equal(t, SyncStats{
+				Copied:  len(testBlobs),
+				Skipped: 1,
+				Bytes:   expectedBytes,
+			}, stats)
+			require.IsIncreasing(t, reported)
+			require.Equal(t, expectedBytes, reported[len(reported)-1])
+
+			for _, b := range testBlobs {
+				exists, err := dst.Exists(ctx, b.name)
+				require.NoError(t, err)
+				require.True(t, exists)
+			}
+
+			// Newer link version is kept in the destination
+			require.Equal(t, newerLink.data, readLink(t, dst))
+
+			// The newer link propagates back to the source, dynamic links
+			// are always copied
+			stats, err = Sync(ctx, dst, src, SyncOptions{BatchSize: batchSize})
+			require.NoError(t, err)
+			require.Equal(t, 4, stats.Copied)
+			require.Equal(t, 3, stats.Skipped)
+			require.Equal(t, newerLink.data, readLink(t, src))
+		})
+	}
+
+	t.Run("listing error", func(t *testing.T) {
+		src := &datastore{s: &mockStore{
+			fList: func(ctx context.Context) iter.Seq2[*common.BlobName, error] {
+				return func(yield func(*common.BlobName, error) bool) {
+					yield(nil, ErrListNotSupported)
+				}
+			},
+		}}
+		_, err := Sync(ctx, src, InMemory(), SyncOptions{})
+		require.ErrorIs(t, err, ErrListNotSupported)
+	})
+
+	t.Run("update error", func(t *testing.T) {
+		src := InMemory()
+		for _, b := range testBlobs {
+			require.NoError(t, src.Update(ctx, b.name, bytes.NewReader(b.data)))
+		}
+
+		injectedErr := errors.New("update error")
+		dst := &datastore{s: &mockStore{
+			fExists: func(ctx context.Context, name *common.BlobName) (bool, error) {
+				return false, nil
+			},
+			fOpenWriteStream: func(ctx context.Context, name *common.BlobName) (WriteCloseCanceller, error) {
+				return nil, injectedErr
+			},
+		}}
+		stats, err := Sync(ctx, src, dst, SyncOptions{})
+		require.ErrorIs(t, err, injectedErr)
+		require.Zero(t, stats.Copied)
+	})
+}
@@ -0,0 +1,111 @@
+/*
+Copyright © 2022 Bartłomiej Święcki (byo)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package datastore
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"io"
+	"sync"
+
+	"github.com/cinode/go/pkg/blobtypes"
+	"github.com/cinode/go/pkg/common"
+)
+
+// uploadCoalescer tracks updates in progress so that concurrent updates of
+// the same blob name within a single process don't fail with
+// ErrUploadInProgress. The first update does the work, others wait for it
+// to finish.
+type uploadCoalescer struct {
+	mutex   sync.Mutex
+	uploads map[string]*inflightUpload
+}
+
+type inflightUpload struct {
+	done chan struct{}
+	err  error
+}
+
+func newUploadCoalescer() *uploadCoalescer {
+	return &uploadCoalescer{
+		uploads: map[string]*inflightUpload{},
+	}
+}
+
+// update runs the update function unless there's already an update of the
+// same blob in progress in which case it waits for that update to finish.
+//
+// Static blob content is determined by its name, if the concurrent update
+// succeeded, the data is only validated without storing it again. In other
+// cases (failed concurrent update, dynamic links) the update is retried once
+// the concurrent one finishes.
+func (c *uploadCoalescer) update(
+	ctx context.Context,
+	name *common.BlobName,
+	updateStream io.Reader,
+	updateFunc func() error,
+) error {
+	if c == nil {
+		return updateFunc()
+	}
+
+	key := name.String()
+	for {
+		c.mutex.Lock()
+		upload, inProgress := c.uploads[key]
+		if !inProgress {
+			upload = &inflightUpload{done: make(chan struct{})}
+			c.uploads[key] = upload
+		}
+		c.mutex.Unlock()
+
+		if !inProgress {
+			upload.err = updateFunc()
+
+			c.mutex.Lock()
+			delete(c.uploads, key)
+			c.mutex.Unlock()
+
+			close(upload.done)
+			return upload.err
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-upload.done:
+		}
+
+		if upload.err == nil && name.Type() == blobtypes.Static {
+			return validateStaticData(name, updateStream)
+		}
+	}
+}
+
+func validateStaticData(name *common.BlobName, r io.Reader) error {
+	hasher := sha256.New()
+	_, err := io.Copy(hasher, r)
+	if err != nil {
+		return err
+	}
+
+	if !bytes.Equal(name.Hash(), hasher.Sum(nil)) {
+		return blobtypes.ErrValidationFailed
+	}
+	return nil
+}
@@ -0,0 +1,178 @@
+/*
+Copyright © 2022 Bartłomiej Święcki (byo)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package datastore
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/cinode/go/pkg/blobtypes"
+	"github.com/cinode/go/pkg/common"
+	"github.com/stretchr/testify/require"
+)
+
+// waitCountingContext counts calls to Done, in the datastore update path
+// it is only called by updates waiting for a concurrent one
+type waitCountingContext struct {
+	context.Context
+	waiting *atomic.Int32
+}
+
+func (c waitCountingContext) Done() <-chan struct{} {
+	c.waiting.Add(1)
+	return c.Context.Done()
+}
+
+// gatedStorage blocks writes until released and counts opened write streams
+type gatedStorage struct {
+	storage
+	release     chan struct{}
+	writes      atomic.Int32
+	failWriters atomic.Int32
+}
+
+type gatedWriter struct {
+	WriteCloseCanceller
+	s *gatedStorage
+}
+
+func (w *gatedWriter) Write(b []byte) (int, error) {
+	<-w.s.release
+	if w.s.failWriters.Add(-1) >= 0 {
+		return 0, errors.New("write failed")
+	}
+	return w.WriteCloseCanceller.Write(b)
+}
+
+func (s *gatedStorage) openWriteStream(ctx context.Context, name *common.BlobName) (WriteCloseCanceller, error) {
+	w, err := s.storage.openWriteStream(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	s.writes.Add(1)
+	return &gatedWriter{WriteCloseCanceller: w, s: s}, nil
+}
+
+func TestCoalescedConcurrentUpdates(t *testing.T) {
+	const threadCnt = 20
+	b := testBlobs[0]
+
+	startUpdates := func(t *testing.T, ds *datastore, data func(i int) []byte) []error {
+		errs := make([]error, threadCnt)
+		waiting := atomic.Int32{}
+		ctx := waitCountingContext{Context: context.Background(), waiting: &waiting}
+		wg := sync.WaitGroup{}
+		wg.Add(threadCnt)
+		for i := 0; i < threadCnt; i++ {
+			go func(i int) {
+				defer wg.Done()
+				errs[i] = ds.Update(ctx, b.name, bytes.NewReader(data(i)))
+			}(i)
+		}
+
+		require.Eventually(t, func() bool {
+			return waiting.Load() == threadCnt-1
+		}, 10*time.Second, time.Millisecond)
+		close(ds.s.(*gatedStorage).release)
+
+		wg.Wait()
+		return errs
+	}
+
+	t.Run("all updates succeed with blob stored once", func(t *testing.T) {
+		st := &gatedStorage{storage: newStorageMemory(), release: make(chan struct{})}
+		ds := newDatastore(st)
+
+		errs := startUpdates(t, ds, func(i int) []byte { return b.data })
+		for _, err := range errs {
+			require.NoError(t, err)
+		}
+		require.EqualValues(t, 1, st.writes.Load())
+
+		exists, err := ds.Exists(context.Background(), b.name)
+		require.NoError(t, err)
+		require.True(t, exists)
+	})
+
+	t.Run("invalid data is rejected while waiting", func(t *testing.T) {
+		st := &gatedStorage{storage: newStorageMemory(), release: make(chan struct{})}
+		ds := newDatastore(st)
+
+		errs := startUpdates(t, ds, func(i int) []byte {
+			if i%2 == 1 {
+				return []byte("invalid data")
+			}
+			return b.data
+		})
+
+		failed := 0
+		for _, err := range errs {
+			if err != nil {
+				require.ErrorIs(t, err, blobtypes.ErrValidationFailed)
+				failed++
+			}
+		}
+		require.Equal(t, threadCnt/2, failed)
+	})
+
+	t.Run("waiting update retries after failure", func(t *testing.T) {
+		st := &gatedStorage{storage: newStorageMemory(), release: make(chan struct{})}
+		st.failWriters.Store(1)
+		ds := newDatastore(st)
+
+		errs := startUpdates(t, ds, func(i int) []byte { return b.data })
+
+		failed := 0
+		for _, err := range errs {
+			if err != nil {
+				failed++
+			}
+		}
+		require.Equal(t, 1, failed)
+		require.GreaterOrEqual(t, st.writes.Load(), int32(2))
+
+		exists, err := ds.Exists(context.Background(), b.name)
+		require.NoError(t, err)
+		require.True(t, exists)
+	})
+
+	t.Run("context cancelled while waiting", func(t *testing.T) {
+		st := &gatedStorage{storage: newStorageMemory(), release: make(chan struct{})}
+		ds := newDatastore(st)
+
+		firstDone := make(chan error)
+		go func() {
+			firstDone <- ds.Update(context.Background(), b.name, bytes.NewReader(b.data))
+		}()
+		require.Eventually(t, func() bool {
+			return st.writes.Load() == 1
+		}, 10*time.Second, time.Millisecond)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		err := ds.Update(ctx, b.name, bytes.NewReader(b.data))
+		require.ErrorIs(t, err, context.Canceled)
+
+		close(st.release)
+		require.NoError(t, <-firstDone)
+	})
+}
@@ -35,6 +35,8 @@ var (
 		"INVALID_BLOB_NAME":  common.ErrInvalidBlobName,
 		"UPLOAD_IN_PROGRESS": ErrUploadInProgress,
 		"NO_FORM_FIELD":      errNoData,
+		"LIST_NOT_SUPPORTED": ErrListNotSupported,
+		"BATCH_TOO_LARGE":    ErrExistsBatchTooLarge,
 	}
 )
 
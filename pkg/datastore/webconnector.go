@@ -17,64 +17,204 @@ limitations under the License.
 package datastore
 
 import (
+	"bufio"
 	"bytes"
 	"context"
-	"crypto/sha256"
+	"crypto/tls"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"iter"
 	"net/http"
 	"net/url"
+	"strings"
+	"time"
 
 	"github.com/cinode/go/pkg/blobtypes"
 	"github.com/cinode/go/pkg/common"
 	"github.com/cinode/go/pkg/internal/blobtypes/dynamiclink"
-	"github.com/cinode/go/pkg/internal/utilities/validatingreader"
+	"github.com/cinode/go/pkg/propagation"
 )
 
 var (
 	ErrWebConnectionError = errors.New("connection error")
+	ErrWebInvalidURL      = errors.New("invalid datastore url")
 )
 
+const (
+	defaultWebMaxIdleConnsPerHost = 64
+	defaultWebIdleConnTimeout     = 90 * time.Second
+
+	// Limits for reading the body of an error response
+	webErrorMaxBodyRead = 64 * 1024
+	webErrorMaxSnippet  = 256
+)
+
+// WebError is returned by the web connector when the remote datastore responds
+// with an error status other than 404 Not Found, which is reported as
+// ErrNotFound instead. WebError matches ErrWebConnectionError with errors.Is.
+type WebError struct {
+	// StatusCode and Status of the http response
+	StatusCode int
+	Status     string
+
+	// Code and Message are taken from the json error response if present
+	Code    string
+	Message string
+
+	// Body contains the beginning of the response body
+	Body string
+}
+
+func (e *WebError) Error() string {
+	msg := fmt.Sprintf(
+		"%v: response status code: %v (%v)",
+		ErrWebConnectionError,
+		e.StatusCode,
+		e.Status,
+	)
+	if e.Code != "" || e.Message != "" {
+		return fmt.Sprintf("%s, error code: %v, error message: %v", msg, e.Code, e.Message)
+	}
+	if e.Body != "" {
+		return fmt.Sprintf("%s, response: %q", msg, e.Body)
+	}
+	return msg
+}
+
+func (e *WebError) Unwrap() error { return ErrWebConnectionError }
+
+// Temporary returns true if the request may succeed when retried, that is
+// for server-side errors and explicit requests to retry later. Other client
+// errors are permanent.
+func (e *WebError) Temporary() bool {
+	switch {
+	case e.StatusCode >= 500,
+		e.StatusCode == http.StatusRequestTimeout,
+		e.StatusCode == http.StatusTooManyRequests:
+		return true
+	}
+	return false
+}
+
+// webErrorSnippet returns the beginning of the error response body
+// with invalid utf-8 sequences removed
+func webErrorSnippet(body []byte) string {
+	if len(body) > webErrorMaxSnippet {
+		body = body[:webErrorMaxSnippet]
+	}
+	return strings.TrimSpace(strings.ToValidUTF8(string(body), ""))
+}
+
 type webConnector struct {
 	baseURL          string
 	client           *http.Client
 	customizeRequest func(*http.Request) error
+	transport        webTransportConfig
+	notFound         *webNegativeCache
+}
+
+// webTransportConfig contains tuning parameters for the http transport
+// created when no custom http client is provided
+type webTransportConfig struct {
+	maxIdleConnsPerHost int
+	idleConnTimeout     time.Duration
+	disableHTTP2        bool
 }
 
 var _ DS = (*webConnector)(nil)
 
 type webConnectorOption func(*webConnector)
 
+// WebOptionHttpClient sets the http client used to connect to the remote
+// datastore. The client is used as is, transport tuning options are ignored.
 func WebOptionHttpClient(client *http.Client) webConnectorOption {
 	return func(wc *webConnector) { wc.client = client }
 }
 
+// WebOptionMaxIdleConnsPerHost sets the maximum number of idle keep-alive
+// connections kept open to the remote datastore
+func WebOptionMaxIdleConnsPerHost(n int) webConnectorOption {
+	return func(wc *webConnector) { wc.transport.maxIdleConnsPerHost = n }
+}
+
+// WebOptionIdleConnTimeout sets the time after which idle keep-alive
+// connections are closed, zero means no limit
+func WebOptionIdleConnTimeout(d time.Duration) webConnectorOption {
+	return func(wc *webConnector) { wc.transport.idleConnTimeout = d }
+}
+
+// WebOptionHTTP2 enables or disables attempting HTTP/2 connections,
+// HTTP/2 is enabled by default
+func WebOptionHTTP2(enabled bool) webConnectorOption {
+	return func(wc *webConnector) { wc.transport.disableHTTP2 = !enabled }
+}
+
+// WebOptionNegativeCache enables caching of not found responses for given
+// time. Repeated Open, Exists and Size requests for a blob that was recently
+// reported as missing are answered locally without contacting the remote
+// datastore. Writing the blob through the same datastore instance removes
+// it from the cache, blobs written by other clients may be reported as
+// missing until the cache entry expires.
+func WebOptionNegativeCache(ttl time.Duration) webConnectorOption {
+	return func(wc *webConnector) {
+		wc.notFound = nil
+		if ttl > 0 {
+			wc.notFound = newWebNegativeCache(ttl)
+		}
+	}
+}
+
 func WebOptionCustomizeRequest(f func(*http.Request) error) webConnectorOption {
 	return func(wc *webConnector) { wc.customizeRequest = f }
 }
 
 // FromWeb returns Datastore implementation that connects to external url
 func FromWeb(baseURL string, options ...webConnectorOption) (DS, error) {
-	_, err := url.Parse(baseURL)
+	u, err := url.Parse(baseURL)
 	if err != nil {
 		return nil, err
 	}
+	if !u.IsAbs() || u.Host == "" {
+		return nil, fmt.Errorf("%w: '%s' is not an absolute url", ErrWebInvalidURL, baseURL)
+	}
 
 	ret := &webConnector{
 		baseURL:          baseURL,
-		client:           http.DefaultClient,
 		customizeRequest: func(r *http.Request) error { return nil },
+		transport: webTransportConfig{
+			maxIdleConnsPerHost: defaultWebMaxIdleConnsPerHost,
+			idleConnTimeout:     defaultWebIdleConnTimeout,
+		},
 	}
 
 	for _, o := range options {
 		o(ret)
 	}
 
+	if ret.client == nil {
+		ret.client = &http.Client{Transport: ret.transport.newTransport()}
+	}
+
 	return ret, nil
 }
 
+func (c *webTransportConfig) newTransport() *http.Transport {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.MaxIdleConnsPerHost = c.maxIdleConnsPerHost
+	if c.maxIdleConnsPerHost > t.MaxIdleConns {
+		t.MaxIdleConns = c.maxIdleConnsPerHost
+	}
+	t.IdleConnTimeout = c.idleConnTimeout
+	t.ForceAttemptHTTP2 = !c.disableHTTP2
+	if c.disableHTTP2 {
+		// Non-nil empty map disables HTTP/2 upgrade through TLS ALPN
+		t.TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{}
+	}
+	return t
+}
+
 func (w *webConnector) Kind() string {
 	return "Web"
 }
@@ -84,14 +224,26 @@ func (w *webConnector) Address() string {
 }
 
 func (w *webConnector) Open(ctx context.Context, name *common.BlobName) (io.ReadCloser, error) {
+	var open func(context.Context, *common.BlobName) (io.ReadCloser, error)
 	switch name.Type() {
 	case blobtypes.Static:
-		return w.openStatic(ctx, name)
+		open = w.openStatic
 	case blobtypes.DynamicLink:
-		return w.openDynamicLink(ctx, name)
+		open = w.openDynamicLink
 	default:
 		return nil, blobtypes.ErrUnknownBlobType
 	}
+
+	notFound, generation := w.notFound.notFound(name.String())
+	if notFound {
+		return nil, ErrNotFound
+	}
+
+	rc, err := open(ctx, name)
+	if errors.Is(err, ErrNotFound) {
+		w.notFound.add(name.String(), generation)
+	}
+	return rc, err
 }
 
 func (w *webConnector) openStatic(ctx context.Context, name *common.BlobName) (io.ReadCloser, error) {
@@ -120,7 +272,7 @@ func (w *webConnector) openStatic(ctx context.Context, name *common.BlobName) (i
 		io.Reader
 		io.Closer
 	}{
-		Reader: validatingreader.NewHashValidation(res.Body, sha256.New(), name.Hash(), blobtypes.ErrValidationFailed),
+		Reader: propagation.StaticValidatingReader(name, res.Body),
 		Closer: res.Body,
 	}, nil
 }
@@ -157,6 +309,11 @@ func (w *webConnector) openDynamicLink(ctx context.Context, name *common.BlobNam
 }
 
 func (w *webConnector) Update(ctx context.Context, name *common.BlobName, r io.Reader) error {
+	// Invalidated also once done, the blob may have been reported as
+	// missing by requests running while the update was in progress
+	w.notFound.invalidate(name.String())
+	defer w.notFound.invalidate(name.String())
+
 	req, err := http.NewRequestWithContext(
 		ctx,
 		http.MethodPut,
@@ -175,10 +332,19 @@ func (w *webConnector) Update(ctx context.Context, name *common.BlobName, r io.R
 	}
 	defer res.Body.Close()
 
-	return w.errCheck(res)
+	err = w.errCheck(res)
+
+	// Unread response body prevents reusing the connection
+	io.Copy(io.Discard, res.Body)
+	return err
 }
 
 func (w *webConnector) Exists(ctx context.Context, name *common.BlobName) (bool, error) {
+	notFound, generation := w.notFound.notFound(name.String())
+	if notFound {
+		return false, nil
+	}
+
 	req, err := http.NewRequestWithContext(
 		ctx,
 		http.MethodHead,
@@ -196,6 +362,7 @@ func (w *webConnector) Exists(ctx context.Context, name *common.BlobName) (bool,
 
 	err = w.errCheck(res)
 	if errors.Is(err, ErrNotFound) {
+		w.notFound.add(name.String(), generation)
 		return false, nil
 	}
 
@@ -205,6 +372,118 @@ func (w *webConnector) Exists(ctx context.Context, name *common.BlobName) (bool,
 	return false, err
 }
 
+// Size reads the blob size from the Content-Length header of the HEAD response.
+// If the remote side does not report it, the blob data is read to get its size.
+func (w *webConnector) Size(ctx context.Context, name *common.BlobName) (int64, error) {
+	notFound, generation := w.notFound.notFound(name.String())
+	if notFound {
+		return 0, ErrNotFound
+	}
+
+	req, err := http.NewRequestWithContext(
+		ctx,
+		http.MethodHead,
+		w.baseURL+name.String(),
+		nil,
+	)
+	if err != nil {
+		return 0, err
+	}
+	res, err := w.do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+
+	err = w.errCheck(res)
+	if errors.Is(err, ErrNotFound) {
+		w.notFound.add(name.String(), generation)
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	if res.ContentLength >= 0 {
+		return res.ContentLength, nil
+	}
+
+	rc, err := w.Open(ctx, name)
+	if err != nil {
+		return 0, err
+	}
+	defer rc.Close()
+
+	return io.Copy(io.Discard, rc)
+}
+
+// ExistsMany sends names in batches using the exists batch endpoint of
+// the web interface. Blobs are checked one by one if the remote side does not
+// support batches.
+func (w *webConnector) ExistsMany(ctx context.Context, names []*common.BlobName) ([]bool, error) {
+	ret := make([]bool, 0, len(names))
+	for len(names) > 0 {
+		batch := names[:min(len(names), webExistsBatchMaxNames)]
+		names = names[len(batch):]
+
+		exists, err := w.existsBatch(ctx, batch)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, exists...)
+	}
+	return ret, nil
+}
+
+func (w *webConnector) existsBatch(ctx context.Context, names []*common.BlobName) ([]bool, error) {
+	body := bytes.NewBuffer(nil)
+	for _, name := range names {
+		body.WriteString(name.String())
+		body.WriteByte('\n')
+	}
+
+	req, err := http.NewRequestWithContext(
+		ctx,
+		http.MethodPost,
+		w.baseURL+"?exists-batch",
+		body,
+	)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "text/plain")
+
+	res, err := w.do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode == http.StatusMethodNotAllowed {
+		// Older web interface without batch support
+		io.Copy(io.Discard, res.Body)
+		return existsSequential(ctx, w.Exists, names)
+	}
+
+	err = w.errCheck(res)
+	if err != nil {
+		return nil, err
+	}
+
+	bitmapLen := (len(names) + 7) / 8
+	bitmap, err := io.ReadAll(io.LimitReader(res.Body, int64(bitmapLen)+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(bitmap) != bitmapLen {
+		return nil, fmt.Errorf(
+			"%w: invalid exists batch response length %d, expected %d",
+			ErrWebConnectionError, len(bitmap), bitmapLen,
+		)
+	}
+
+	return existsFromBitmap(bitmap, len(names)), nil
+}
+
 func (w *webConnector) Delete(ctx context.Context, name *common.BlobName) error {
 	req, err := http.NewRequestWithContext(
 		ctx,
@@ -222,7 +501,52 @@ func (w *webConnector) Delete(ctx context.Context, name *common.BlobName) error
 	}
 	defer res.Body.Close()
 
-	return w.errCheck(res)
+	err = w.errCheck(res)
+	io.Copy(io.Discard, res.Body)
+	return err
+}
+
+func (w *webConnector) List(ctx context.Context) iter.Seq2[*common.BlobName, error] {
+	return func(yield func(*common.BlobName, error) bool) {
+		req, err := http.NewRequestWithContext(
+			ctx,
+			http.MethodGet,
+			w.baseURL+"?list",
+			nil,
+		)
+		if err != nil {
+			yield(nil, err)
+			return
+		}
+
+		res, err := w.do(req)
+		if err != nil {
+			yield(nil, err)
+			return
+		}
+		defer res.Body.Close()
+
+		err = w.errCheck(res)
+		if err != nil {
+			yield(nil, err)
+			return
+		}
+
+		scanner := bufio.NewScanner(res.Body)
+		for scanner.Scan() {
+			name, err := common.BlobNameFromString(scanner.Text())
+			if err != nil {
+				yield(nil, err)
+				return
+			}
+			if !yield(name, nil) {
+				return
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			yield(nil, fmt.Errorf("%w: %w", ErrWebConnectionError, err))
+		}
+	}
 }
 
 func (w *webConnector) do(req *http.Request) (*http.Response, error) {
@@ -238,32 +562,28 @@ func (w *webConnector) errCheck(res *http.Response) error {
 	if res.StatusCode == http.StatusNotFound {
 		return ErrNotFound
 	}
+	if res.StatusCode < 400 {
+		return nil
+	}
+
+	body, _ := io.ReadAll(io.LimitReader(res.Body, webErrorMaxBodyRead))
+	webErr := &WebError{
+		StatusCode: res.StatusCode,
+		Status:     res.Status,
+		Body:       webErrorSnippet(body),
+	}
+
 	if res.StatusCode == http.StatusBadRequest {
 		msg := webErrResponse{}
-		err := json.NewDecoder(res.Body).Decode(&msg)
-		if err == nil {
+		if json.Unmarshal(body, &msg) == nil {
 			err := webErrFromCode(msg.Code)
 			if err != nil {
 				return err
 			}
-			return fmt.Errorf(
-				"%w: response status code: %v (%v), error code: %v, error message: %v",
-				ErrWebConnectionError,
-				res.StatusCode,
-				res.Status,
-				msg.Code,
-				msg.Message,
-			)
+			webErr.Code = msg.Code
+			webErr.Message = msg.Message
 		}
-		// Fallthrough to code below if can't decode json error
-	}
-	if res.StatusCode >= 400 {
-		return fmt.Errorf(
-			"%w: response status code: %v (%v)",
-			ErrWebConnectionError,
-			res.StatusCode,
-			res.Status,
-		)
+		// Fallthrough to the generic error if can't decode json error
 	}
-	return nil
+	return webErr
 }
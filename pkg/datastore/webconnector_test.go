@@ -23,12 +23,16 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/cinode/go/pkg/blobtypes"
+	"github.com/cinode/go/pkg/common"
 	"github.com/stretchr/testify/require"
 )
 
@@ -52,6 +56,22 @@ func TestWebConnectorInvalidUrl(t *testing.T) {
 	require.IsType(t, &url.Error{}, err)
 }
 
+func TestWebConnectorNotAbsoluteUrl(t *testing.T) {
+	for _, u := range []string{
+		"",
+		"/relative/path",
+		"datastore.local/path",
+		"http:///no-host",
+	} {
+		t.Run(u, func(t *testing.T) {
+			ds, err := FromWeb(u)
+			require.ErrorIs(t, err, ErrWebInvalidURL)
+			require.ErrorContains(t, err, "not an absolute url")
+			require.Nil(t, ds)
+		})
+	}
+}
+
 func TestWebConnectorInvalidContext(t *testing.T) {
 
 	var nilCtx context.Context
@@ -100,6 +120,10 @@ func TestWebConnectorServerSideError(t *testing.T) {
 			require.ErrorIs(t, err, ErrWebConnectionError)
 		})
 	}
+
+	for _, err := range c.List(context.Background()) {
+		require.ErrorIs(t, err, ErrWebConnectionError)
+	}
 }
 
 func TestWebConnectorDetectInvalidBlobRead(t *testing.T) {
@@ -113,6 +137,10 @@ func TestWebConnectorDetectInvalidBlobRead(t *testing.T) {
 	ds2, err := FromWeb(server.URL + "/")
 	require.NoError(t, err)
 
+	for _, err := range ds2.List(context.Background()) {
+		require.ErrorIs(t, err, common.ErrInvalidBlobName)
+	}
+
 	for _, name := range emptyBlobNamesOfAllTypes {
 		t.Run(fmt.Sprint(name.Type()), func(t *testing.T) {
 			rc, err := ds2.Open(context.Background(), name)
@@ -169,4 +197,323 @@ func TestWebConnectorOptions(t *testing.T) {
 		require.Equal(t, testErr, ds.(*webConnector).customizeRequest(nil))
 	})
 
+	t.Run("default transport tuning", func(t *testing.T) {
+		ds, err := FromWeb("http://test.local/")
+		require.NoError(t, err)
+
+		tr := ds.(*webConnector).client.Transport.(*http.Transport)
+		require.Equal(t, defaultWebMaxIdleConnsPerHost, tr.MaxIdleConnsPerHost)
+		require.Equal(t, defaultWebIdleConnTimeout, tr.IdleConnTimeout)
+		require.True(t, tr.ForceAttemptHTTP2)
+	})
+
+	t.Run("custom transport tuning", func(t *testing.T) {
+		ds, err := FromWeb("http://test.local/",
+			WebOptionMaxIdleConnsPerHost(500),
+			WebOptionIdleConnTimeout(time.Minute),
+			WebOptionHTTP2(false),
+		)
+		require.NoError(t, err)
+
+		tr := ds.(*webConnector).client.Transport.(*http.Transport)
+		require.Equal(t, 500, tr.MaxIdleConnsPerHost)
+		require.GreaterOrEqual(t, tr.MaxIdleConns, 500)
+		require.Equal(t, time.Minute, tr.IdleConnTimeout)
+		require.False(t, tr.ForceAttemptHTTP2)
+		require.NotNil(t, tr.TLSNextProto)
+	})
+
+	t.Run("custom client is not modified by transport tuning", func(t *testing.T) {
+		tr := &http.Transport{}
+		cl := &http.Client{Transport: tr}
+		ds, err := FromWeb("http://test.local/",
+			WebOptionHttpClient(cl),
+			WebOptionMaxIdleConnsPerHost(500),
+			WebOptionHTTP2(false),
+		)
+		require.NoError(t, err)
+		require.Same(t, cl, ds.(*webConnector).client)
+		require.Same(t, tr, cl.Transport)
+		require.Zero(t, tr.MaxIdleConnsPerHost)
+		require.Nil(t, tr.TLSNextProto)
+	})
+}
+
+func TestWebConnectorConnectionReuse(t *testing.T) {
+	newConnections := atomic.Int32{}
+
+	server := httptest.NewUnstartedServer(WebInterface(InMemory()))
+	server.Config.ConnState = func(c net.Conn, cs http.ConnState) {
+		if cs == http.StateNew {
+			newConnections.Add(1)
+		}
+	}
+	server.Start()
+	defer server.Close()
+
+	ds, err := FromWeb(server.URL + "/")
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	for _, b := range testBlobs {
+		err := ds.Update(ctx, b.name, bytes.NewReader(b.data))
+		require.NoError(t, err)
+	}
+
+	for i := 0; i < 50; i++ {
+		b := testBlobs[i%len(testBlobs)]
+
+		rc, err := ds.Open(ctx, b.name)
+		require.NoError(t, err)
+		_, err = io.Copy(io.Discard, rc)
+		require.NoError(t, err)
+		require.NoError(t, rc.Close())
+
+		exists, err := ds.Exists(ctx, b.name)
+		require.NoError(t, err)
+		require.True(t, exists)
+	}
+
+	require.EqualValues(t, 1, newConnections.Load())
+}
+
+func TestWebConnectorSizeWithoutContentLength(t *testing.T) {
+	ctx := context.Background()
+	handler := WebInterface(InMemory())
+
+	// Server not reporting blob size in HEAD responses
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodHead {
+			return
+		}
+		handler.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	ds, err := FromWeb(server.URL + "/")
+	require.NoError(t, err)
+
+	b := testBlobs[0]
+	err = ds.Update(ctx, b.name, bytes.NewReader(b.data))
+	require.NoError(t, err)
+
+	size, err := ds.Size(ctx, b.name)
+	require.NoError(t, err)
+	require.EqualValues(t, len(b.data), size)
+}
+
+func TestWebConnectorWebError(t *testing.T) {
+	for _, d := range []struct {
+		status    int
+		body      string
+		temporary bool
+	}{
+		{http.StatusInternalServerError, "Internal failure", true},
+		{http.StatusBadGateway, "", true},
+		{http.StatusServiceUnavailable, "Try later", true},
+		{http.StatusTooManyRequests, "Slow down", true},
+		{http.StatusForbidden, "Access denied", false},
+		{http.StatusUnauthorized, "Who are you?", false},
+		{http.StatusBadRequest, "not a json", false},
+	} {
+		t.Run(fmt.Sprint(d.status), func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(d.status)
+				w.Write([]byte(d.body + "\n"))
+			}))
+			defer server.Close()
+
+			c, err := FromWeb(server.URL + "/")
+			require.NoError(t, err)
+
+			checkErr := func(err error, expectedBody string) {
+				require.ErrorIs(t, err, ErrWebConnectionError)
+				require.NotErrorIs(t, err, ErrNotFound)
+
+				webErr := &WebError{}
+				require.ErrorAs(t, err, &webErr)
+				require.Equal(t, d.status, webErr.StatusCode)
+				require.Equal(t, expectedBody, webErr.Body)
+				require.Equal(t, d.temporary, webErr.Temporary())
+				require.Contains(t, webErr.Error(), fmt.Sprint(d.status))
+			}
+
+			ctx := context.Background()
+			_, err = c.Open(ctx, emptyBlobNameStatic)
+			checkErr(err, d.body)
+
+			_, err = c.Open(ctx, emptyBlobNameDynamicLink)
+			checkErr(err, d.body)
+
+			// HEAD responses have no body
+			_, err = c.Exists(ctx, emptyBlobNameStatic)
+			checkErr(err, "")
+
+			err = c.Update(ctx, emptyBlobNameStatic, bytes.NewReader(nil))
+			checkErr(err, d.body)
+
+			err = c.Delete(ctx, emptyBlobNameStatic)
+			checkErr(err, d.body)
+		})
+	}
+
+	t.Run("json error response", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(&webErrResponse{
+				Code:    "SOME_UNKNOWN_CODE",
+				Message: "Unknown error",
+			})
+		}))
+		defer server.Close()
+
+		c, err := FromWeb(server.URL + "/")
+		require.NoError(t, err)
+
+		_, err = c.Open(context.Background(), emptyBlobNameStatic)
+		webErr := &WebError{}
+		require.ErrorAs(t, err, &webErr)
+		require.Equal(t, "SOME_UNKNOWN_CODE", webErr.Code)
+		require.Equal(t, "Unknown error", webErr.Message)
+		require.False(t, webErr.Temporary())
+		require.Contains(t, webErr.Error(), "SOME_UNKNOWN_CODE")
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		server := httptest.NewServer(http.NotFoundHandler())
+		defer server.Close()
+
+		c, err := FromWeb(server.URL + "/")
+		require.NoError(t, err)
+
+		_, err = c.Open(context.Background(), emptyBlobNameStatic)
+		require.ErrorIs(t, err, ErrNotFound)
+		require.False(t, errors.As(err, new(*WebError)))
+
+		exists, err := c.Exists(context.Background(), emptyBlobNameStatic)
+		require.NoError(t, err)
+		require.False(t, exists)
+	})
+
+	t.Run("body snippet", func(t *testing.T) {
+		body := bytes.Repeat([]byte("ą"), webErrorMaxSnippet)
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write(body)
+		}))
+		defer server.Close()
+
+		c, err := FromWeb(server.URL + "/")
+		require.NoError(t, err)
+
+		_, err = c.Open(context.Background(), emptyBlobNameStatic)
+		webErr := &WebError{}
+		require.ErrorAs(t, err, &webErr)
+		require.Equal(t, string(body[:webErrorMaxSnippet]), webErr.Body)
+	})
+}
+
+func TestWebConnectorNegativeCache(t *testing.T) {
+	ctx := context.Background()
+
+	newDS := func(t *testing.T, options ...webConnectorOption) (*webConnector, *atomic.Int32) {
+		requests := &atomic.Int32{}
+		handler := WebInterface(InMemory())
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requests.Add(1)
+			handler.ServeHTTP(w, r)
+		}))
+		t.Cleanup(server.Close)
+
+		ds, err := FromWeb(server.URL+"/", options...)
+		require.NoError(t, err)
+		return ds.(*webConnector), requests
+	}
+
+	t.Run("disabled by default", func(t *testing.T) {
+		ds, requests := newDS(t)
+		for i := 0; i < 3; i++ {
+			exists, err := ds.Exists(ctx, testBlobs[0].name)
+			require.NoError(t, err)
+			require.False(t, exists)
+		}
+		require.EqualValues(t, 3, requests.Load())
+	})
+
+	t.Run("missing blobs are cached", func(t *testing.T) {
+		ds, requests := newDS(t, WebOptionNegativeCache(time.Minute))
+		now := time.Now()
+		ds.notFound.now = func() time.Time { return now }
+
+		for _, b := range testBlobs {
+			_, err := ds.Open(ctx, b.name)
+			require.ErrorIs(t, err, ErrNotFound)
+
+			exists, err := ds.Exists(ctx, b.name)
+			require.NoError(t, err)
+			require.False(t, exists)
+
+			_, err = ds.Size(ctx, b.name)
+			require.ErrorIs(t, err, ErrNotFound)
+		}
+		require.EqualValues(t, len(testBlobs), requests.Load())
+
+		now = now.Add(time.Minute)
+		exists, err := ds.Exists(ctx, testBlobs[0].name)
+		require.NoError(t, err)
+		require.False(t, exists)
+		require.EqualValues(t, len(testBlobs)+1, requests.Load())
+	})
+
+	t.Run("update invalidates the cache", func(t *testing.T) {
+		ds, _ := newDS(t, WebOptionNegativeCache(time.Hour))
+
+		for _, b := range testBlobs {
+			_, err := ds.Open(ctx, b.name)
+			require.ErrorIs(t, err, ErrNotFound)
+
+			err = ds.Update(ctx, b.name, bytes.NewReader(b.data))
+			require.NoError(t, err)
+
+			exists, err := ds.Exists(ctx, b.name)
+			require.NoError(t, err)
+			require.True(t, exists)
+
+			rc, err := ds.Open(ctx, b.name)
+			require.NoError(t, err)
+			_, err = io.ReadAll(rc)
+			require.NoError(t, err)
+			require.NoError(t, rc.Close())
+		}
+	})
+
+	t.Run("results of requests started before invalidation are not cached", func(t *testing.T) {
+		c := newWebNegativeCache(time.Hour)
+
+		_, generation := c.notFound("name")
+		c.invalidate("name")
+		c.add("name", generation)
+
+		notFound, generation := c.notFound("name")
+		require.False(t, notFound)
+
+		c.add("name", generation)
+		notFound, _ = c.notFound("name")
+		require.True(t, notFound)
+	})
+
+	t.Run("number of entries is limited", func(t *testing.T) {
+		c := newWebNegativeCache(time.Hour)
+		c.maxEntries = 10
+
+		for i := 0; i < 100; i++ {
+			_, generation := c.notFound(fmt.Sprint(i))
+			c.add(fmt.Sprint(i), generation)
+			require.LessOrEqual(t, len(c.entries), 10)
+		}
+
+		notFound, _ := c.notFound("99")
+		require.True(t, notFound)
+	})
 }
@@ -17,11 +17,15 @@ limitations under the License.
 package datastore
 
 import (
+	"bufio"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
+	"iter"
 	"mime/multipart"
 	"net/http"
+	"strconv"
 
 	"github.com/cinode/go/pkg/common"
 	"golang.org/x/exp/slog"
@@ -33,8 +37,9 @@ var (
 
 // WebInterface provides simple web interface for given Datastore
 type webInterface struct {
-	ds  DS
-	log *slog.Logger
+	ds        DS
+	log       *slog.Logger
+	allowList bool
 }
 
 type webInterfaceOption func(i *webInterface)
@@ -43,6 +48,13 @@ func WebInterfaceOptionLogger(log *slog.Logger) webInterfaceOption {
 	return func(i *webInterface) { i.log = log }
 }
 
+// WebInterfaceOptionAllowList enables enumeration of all stored blobs through
+// the `GET /?list` request. Listing is disabled by default since it reveals
+// names of all blobs kept in the datastore.
+func WebInterfaceOptionAllowList() webInterfaceOption {
+	return func(i *webInterface) { i.allowList = true }
+}
+
 // WebInterface returns http handler representing web interface to given
 // Datastore instance
 func WebInterface(ds DS, opts ...webInterfaceOption) http.Handler {
@@ -71,6 +83,8 @@ func (i *webInterface) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		i.serveDelete(w, r)
 	case http.MethodHead:
 		i.serveHead(w, r)
+	case http.MethodPost:
+		i.servePost(w, r)
 	default:
 		http.Error(w, "Unsupported method", http.StatusMethodNotAllowed)
 	}
@@ -134,6 +148,11 @@ func (i *webInterface) checkErr(err error, w http.ResponseWriter, r *http.Reques
 }
 
 func (i *webInterface) serveGet(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/" && r.URL.RawQuery == "list" {
+		i.serveList(w, r)
+		return
+	}
+
 	name, err := i.getName(w, r)
 	if !i.checkErr(err, w, r) {
 		return
@@ -150,6 +169,84 @@ func (i *webInterface) serveGet(w http.ResponseWriter, r *http.Request) {
 	// thus we have to assume that the blob will be validated on the other side
 }
 
+// serveList sends names of all blobs, one name per line. The response
+// is streamed, if listing fails after the response was started, the
+// connection is aborted so that the client does not get a truncated list.
+func (i *webInterface) serveList(w http.ResponseWriter, r *http.Request) {
+	if !i.allowList {
+		i.checkErr(ErrListNotSupported, w, r)
+		return
+	}
+
+	next, stop := iter.Pull2(i.ds.List(r.Context()))
+	defer stop()
+
+	name, err, ok := next()
+	if !i.checkErr(err, w, r) {
+		return
+	}
+
+	w.Header().Set("Content-type", "text/plain")
+	for ; ok; name, err, ok = next() {
+		if err != nil {
+			i.log.Error("Failed to list blobs",
+				slog.String("remoteAddr", r.RemoteAddr),
+				slog.Any("err", err),
+			)
+			panic(http.ErrAbortHandler)
+		}
+
+		_, err = fmt.Fprintln(w, name.String())
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (i *webInterface) servePost(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/" && r.URL.RawQuery == "exists-batch" {
+		i.serveExistsBatch(w, r)
+		return
+	}
+	http.Error(w, "Unsupported method", http.StatusMethodNotAllowed)
+}
+
+// serveExistsBatch checks the existence of blobs with names sent in the
+// request body, one name per line. The result is a bitmap where the i-th bit
+// is set if the i-th blob exists.
+func (i *webInterface) serveExistsBatch(w http.ResponseWriter, r *http.Request) {
+	names := []*common.BlobName{}
+
+	scanner := bufio.NewScanner(r.Body)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			continue
+		}
+		if len(names) >= webExistsBatchMaxNames {
+			i.checkErr(ErrExistsBatchTooLarge, w, r)
+			return
+		}
+
+		name, err := common.BlobNameFromString(line)
+		if !i.checkErr(err, w, r) {
+			return
+		}
+		names = append(names, name)
+	}
+	if !i.checkErr(scanner.Err(), w, r) {
+		return
+	}
+
+	exists, err := i.ds.ExistsMany(r.Context(), names)
+	if !i.checkErr(err, w, r) {
+		return
+	}
+
+	w.Header().Set("Content-type", "application/octet-stream")
+	w.Write(existsBitmap(exists))
+}
+
 type partReader struct {
 	p *multipart.Part
 	b io.Closer
@@ -241,12 +338,10 @@ func (i *webInterface) serveHead(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	exists, err := i.ds.Exists(r.Context(), name)
+	size, err := i.ds.Size(r.Context(), name)
 	if !i.checkErr(err, w, r) {
 		return
 	}
 
-	if !exists {
-		http.NotFound(w, r)
-	}
+	w.Header().Set("Content-Length", strconv.FormatInt(size, 10))
 }
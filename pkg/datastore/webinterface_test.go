@@ -21,6 +21,7 @@ import (
 	"context"
 	"errors"
 	"io"
+	"iter"
 	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
@@ -97,7 +98,7 @@ func TestWebInterfaceDeleteQueryString(t *testing.T) {
 func TestWebIntefaceExistsFailure(t *testing.T) {
 	server := httptest.NewServer(WebInterface(&datastore{
 		s: &mockStore{
-			fExists: func(ctx context.Context, name *common.BlobName) (bool, error) { return false, errors.New("fail") },
+			fSize: func(ctx context.Context, name *common.BlobName) (int64, error) { return 0, errors.New("fail") },
 		},
 	}))
 	defer server.Close()
@@ -105,6 +106,83 @@ func TestWebIntefaceExistsFailure(t *testing.T) {
 	testHTTPResponseOwnServer(t, http.MethodHead, server.URL+"/"+emptyBlobNameStatic.String(), nil, http.StatusInternalServerError)
 }
 
+func TestWebInterfaceList(t *testing.T) {
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	newServer := func(list iter.Seq2[*common.BlobName, error]) DS {
+		server := httptest.NewServer(WebInterface(
+			&datastore{s: &mockStore{
+				fList: func(ctx context.Context) iter.Seq2[*common.BlobName, error] { return list },
+			}},
+			WebInterfaceOptionLogger(log),
+			WebInterfaceOptionAllowList(),
+		))
+		t.Cleanup(server.Close)
+
+		ds, err := FromWeb(server.URL + "/")
+		require.NoError(t, err)
+		return ds
+	}
+
+	collect := func(ds DS) ([]*common.BlobName, error) {
+		names := []*common.BlobName{}
+		for name, err := range ds.List(context.Background()) {
+			if err != nil {
+				return names, err
+			}
+			names = append(names, name)
+		}
+		return names, nil
+	}
+
+	t.Run("listing not supported", func(t *testing.T) {
+		ds := newServer(func(yield func(*common.BlobName, error) bool) {
+			yield(nil, ErrListNotSupported)
+		})
+		_, err := collect(ds)
+		require.ErrorIs(t, err, ErrListNotSupported)
+	})
+
+	t.Run("error while listing", func(t *testing.T) {
+		injectedErr := errors.New("list error")
+		ds := newServer(func(yield func(*common.BlobName, error) bool) {
+			if !yield(emptyBlobNameStatic, nil) {
+				return
+			}
+			yield(nil, injectedErr)
+		})
+		// Depending on buffering, the request itself or reading the
+		// response fails, the client must not see a truncated list
+		_, err := collect(ds)
+		require.Error(t, err)
+	})
+
+	t.Run("listing disabled by default", func(t *testing.T) {
+		server := httptest.NewServer(WebInterface(InMemory(), WebInterfaceOptionLogger(log)))
+		t.Cleanup(server.Close)
+
+		ds, err := FromWeb(server.URL + "/")
+		require.NoError(t, err)
+		_, err = collect(ds)
+		require.ErrorIs(t, err, ErrListNotSupported)
+
+		testHTTPResponseOwnServer(t, http.MethodGet, server.URL+"/?list", nil, http.StatusBadRequest)
+	})
+
+	t.Run("invalid query", func(t *testing.T) {
+		server := httptest.NewServer(WebInterface(
+			InMemory(),
+			WebInterfaceOptionLogger(log),
+			WebInterfaceOptionAllowList(),
+		))
+		t.Cleanup(server.Close)
+		url := server.URL + "/"
+
+		testHTTPResponseOwnServer(t, http.MethodGet, url+"?list", nil, http.StatusOK)
+		testHTTPResponseOwnServer(t, http.MethodGet, url+"?list=all", nil, http.StatusBadRequest)
+		testHTTPResponseOwnServer(t, http.MethodPut, url+"?list", nil, http.StatusBadRequest)
+	})
+}
+
 func TestWebInterfaceMultipartSave(t *testing.T) {
 	url := testServer(t)
 
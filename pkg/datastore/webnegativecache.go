@@ -0,0 +1,117 @@
+/*
+Copyright © 2023 Bartłomiej Święcki (byo)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package datastore
+
+import (
+	"sync"
+	"time"
+)
+
+// Maximum number of names remembered by the negative cache
+const webNegativeCacheMaxEntries = 16384
+
+// webNegativeCache remembers names of blobs that were recently reported as
+// not found by the remote datastore so that repeated requests for missing
+// blobs are not sent again until the entry expires
+type webNegativeCache struct {
+	ttl        time.Duration
+	maxEntries int
+	now        func() time.Time
+
+	mutex   sync.Mutex
+	entries map[string]time.Time // name -> expiry time
+
+	// generation is increased on each invalidation, results of requests
+	// started before the invalidation are not cached
+	generation uint64
+}
+
+func newWebNegativeCache(ttl time.Duration) *webNegativeCache {
+	return &webNegativeCache{
+		ttl:        ttl,
+		maxEntries: webNegativeCacheMaxEntries,
+		now:        time.Now,
+		entries:    map[string]time.Time{},
+	}
+}
+
+// notFound returns true if the blob is known to be missing, it also returns
+// the generation that must be passed to add once the request is done
+func (c *webNegativeCache) notFound(name string) (bool, uint64) {
+	if c == nil {
+		return false, 0
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	expires, found := c.entries[name]
+	if found && c.now().Before(expires) {
+		return true, c.generation
+	}
+	if found {
+		delete(c.entries, name)
+	}
+	return false, c.generation
+}
+
+// add remembers the missing blob unless the cache was invalidated
+// since given generation
+func (c *webNegativeCache) add(name string, generation uint64) {
+	if c == nil {
+		return
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if generation != c.generation {
+		return
+	}
+
+	now := c.now()
+	if len(c.entries) >= c.maxEntries {
+		for n, expires := range c.entries {
+			if !now.Before(expires) {
+				delete(c.entries, n)
+			}
+		}
+	}
+	if len(c.entries) >= c.maxEntries {
+		// Still full, drop a random entry
+		for n := range c.entries {
+			delete(c.entries, n)
+			break
+		}
+	}
+
+	c.entries[name] = now.Add(c.ttl)
+}
+
+// invalidate forgets that the blob is missing, it must be called
+// before the blob is written
+func (c *webNegativeCache) invalidate(name string) {
+	if c == nil {
+		return
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	delete(c.entries, name)
+	c.generation++
+}
@@ -219,6 +219,16 @@ func (d *PublicReader) toSignDataHasherPrefilled() hash.Hash {
 	return h
 }
 
+// ContentVersion returns the content version of the link data
+func (d *PublicReader) ContentVersion() uint64 {
+	return d.contentVersion
+}
+
+// GreaterThan returns true if this link data should take precedence over d2.
+//
+// Higher content version always wins. For equal versions (including the
+// common case of version 0) the link data with the greater hash of its
+// signature wins.
 func (d *PublicReader) GreaterThan(d2 *PublicReader) bool {
 	// First step - compare versions
 	if d.contentVersion > d2.contentVersion {
@@ -236,8 +246,8 @@ func (d *PublicReader) GreaterThan(d2 *PublicReader) bool {
 	return bytes.Compare(hs1[:], hs2[:]) > 0
 }
 
-func (d *PublicReader) ivGeneratorPrefilled() cipherfactory.IVGenerator {
-	ivGenerator := cipherfactory.NewIVGenerator(blobtypes.DynamicLink)
+func (d *PublicReader) ivGeneratorPrefilled(alg cipherfactory.Algorithm) cipherfactory.IVGenerator {
+	ivGenerator := cipherfactory.NewIVGenerator(alg, blobtypes.DynamicLink)
 
 	storeDynamicSizeBuff(ivGenerator, d.BlobName().Bytes())
 	storeUint64(ivGenerator, d.contentVersion)
@@ -266,7 +276,7 @@ func (d *PublicReader) validateKeyInLinkData(key *common.BlobKey, r io.Reader) e
 	}
 
 	// That signature is fed into the key generator and builds the key
-	keyGenerator := cipherfactory.NewKeyGenerator(blobtypes.DynamicLink)
+	keyGenerator := cipherfactory.NewKeyGenerator(cipherfactory.KeyAlgorithm(key), blobtypes.DynamicLink)
 	keyGenerator.Write(signature)
 	generatedKey := keyGenerator.Generate()
 
@@ -286,7 +296,7 @@ func (d *PublicReader) GetLinkDataReader(key *common.BlobKey) (io.Reader, error)
 
 	// While reading the data, it will be tee-ed to the hasher for IV calculation.
 	// That hasher will then
-	ivHasher := d.ivGeneratorPrefilled()
+	ivHasher := d.ivGeneratorPrefilled(cipherfactory.KeyAlgorithm(key))
 	r = io.TeeReader(r, ivHasher)
 
 	// Check the reserved byte, must be 0 now
@@ -22,6 +22,8 @@ import (
 	"encoding/binary"
 	"errors"
 	"io"
+	"math"
+	"sync"
 
 	"github.com/cinode/go/pkg/blobtypes"
 	"github.com/cinode/go/pkg/common"
@@ -30,11 +32,19 @@ import (
 
 var (
 	ErrInvalidDynamicLinkAuthInfo = errors.New("invalid dynamic link auth info")
+	ErrLinkDataFromDifferentLink  = errors.New("link data belongs to a different dynamic link")
+	ErrContentVersionOverflow     = errors.New("dynamic link content version overflow")
 )
 
 type Publisher struct {
 	Public
 	privKey ed25519.PrivateKey
+
+	// Highest content version known to be stored for this link, used
+	// to automatically assign versions to new link data
+	versionLock    sync.Mutex
+	currentVersion uint64
+	hasVersion     bool
 }
 
 func nonceFromRand(randSource io.Reader) (uint64, error) {
@@ -116,7 +126,7 @@ func (dl *Publisher) calculateEncryptionKey() (*common.BlobKey, []byte) {
 
 	signature := ed25519.Sign(dl.privKey, dataSeed)
 
-	keyGenerator := cipherfactory.NewKeyGenerator(blobtypes.DynamicLink)
+	keyGenerator := cipherfactory.NewKeyGenerator(cipherfactory.AlgorithmXChaCha20, blobtypes.DynamicLink)
 	keyGenerator.Write(signature)
 	key := keyGenerator.Generate()
 
@@ -129,7 +139,85 @@ func (dl *Publisher) EncryptionKey() *common.BlobKey {
 	return key
 }
 
+// UpdateLinkData generates new link data with given content version.
+//
+// Among multiple link data for the same link, the one with the highest
+// version wins. If versions are equal (e.g. when version 0 is used for
+// every update), the winner is selected deterministically by comparing
+// hashes of signatures which is effectively a random choice. Callers
+// that do not want to manage versions manually should use
+// UpdateLinkDataAutoVersion instead.
 func (dl *Publisher) UpdateLinkData(r io.Reader, version uint64) (*PublicReader, *common.BlobKey, error) {
+	dl.versionLock.Lock()
+	defer dl.versionLock.Unlock()
+
+	return dl.updateLinkData(r, version)
+}
+
+// UpdateLinkDataAutoVersion generates new link data with the content version
+// one above the current version of the link.
+//
+// The current version is the highest version known to this publisher -
+// versions of link data it generated itself and those passed to SyncVersion.
+// The version of the link data already stored in the datastore must thus be
+// passed to SyncVersion first. Version 0 is used if no version is known yet.
+func (dl *Publisher) UpdateLinkDataAutoVersion(r io.Reader) (*PublicReader, *common.BlobKey, error) {
+	return dl.UpdateLinkDataMinVersion(r, 0)
+}
+
+// UpdateLinkDataMinVersion works like UpdateLinkDataAutoVersion but the
+// content version is never below minVersion (e.g. the current time as used
+// for regular updates).
+func (dl *Publisher) UpdateLinkDataMinVersion(r io.Reader, minVersion uint64) (*PublicReader, *common.BlobKey, error) {
+	dl.versionLock.Lock()
+	defer dl.versionLock.Unlock()
+
+	version := minVersion
+	if dl.hasVersion {
+		var err error
+		version, err = versionAbove(version, dl.currentVersion)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	return dl.updateLinkData(r, version)
+}
+
+// versionAbove returns the version if it is above the other one,
+// the other version increased by one is returned otherwise
+func versionAbove(version, other uint64) (uint64, error) {
+	if version > other {
+		return version, nil
+	}
+	if other == math.MaxUint64 {
+		return 0, ErrContentVersionOverflow
+	}
+	return other + 1, nil
+}
+
+// SyncVersion updates the version known to this publisher with the one
+// from given link data, typically the one currently stored in the datastore.
+func (dl *Publisher) SyncVersion(pr *PublicReader) error {
+	if !pr.BlobName().Equal(dl.BlobName()) {
+		return ErrLinkDataFromDifferentLink
+	}
+
+	dl.versionLock.Lock()
+	defer dl.versionLock.Unlock()
+
+	dl.observeVersion(pr.contentVersion)
+	return nil
+}
+
+func (dl *Publisher) observeVersion(version uint64) {
+	if !dl.hasVersion || version > dl.currentVersion {
+		dl.currentVersion = version
+		dl.hasVersion = true
+	}
+}
+
+func (dl *Publisher) updateLinkData(r io.Reader, version uint64) (*PublicReader, *common.BlobKey, error) {
 	encryptionKey, kvb := dl.calculateEncryptionKey()
 
 	// key validation block precedes the link data
@@ -150,7 +238,7 @@ func (dl *Publisher) UpdateLinkData(r io.Reader, version uint64) (*PublicReader,
 
 	pr.contentVersion = version
 
-	ivGenerator := pr.ivGeneratorPrefilled()
+	ivGenerator := pr.ivGeneratorPrefilled(cipherfactory.KeyAlgorithm(encryptionKey))
 	ivGenerator.Write(unencryptedLink)
 	pr.iv = ivGenerator.Generate()
 
@@ -173,5 +261,7 @@ func (dl *Publisher) UpdateLinkData(r io.Reader, version uint64) (*PublicReader,
 	pr.signature = ed25519.Sign(dl.privKey, signatureHasher.Sum(nil))
 	pr.r = bytes.NewReader(encryptedLinkBuff.Bytes())
 
+	dl.observeVersion(version)
+
 	return &pr, encryptionKey, nil
 }
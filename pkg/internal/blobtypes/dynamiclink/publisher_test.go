@@ -17,10 +17,14 @@ limitations under the License.
 package dynamiclink
 
 import (
+	"bytes"
 	"crypto/ed25519"
 	"crypto/rand"
+	"crypto/sha256"
 	"errors"
 	"io"
+	"math"
+	"sync"
 	"testing"
 	"testing/iotest"
 
@@ -137,3 +141,185 @@ func TestPublisherUpdateLinkData(t *testing.T) {
 		require.Nil(t, key2)
 	})
 }
+
+func TestPublisherUpdateLinkDataAutoVersion(t *testing.T) {
+	t.Run("versions increment starting from zero", func(t *testing.T) {
+		dl, err := Create(rand.Reader)
+		require.NoError(t, err)
+
+		for i := uint64(0); i <= 3; i++ {
+			pr, _, err := dl.UpdateLinkDataAutoVersion(io.LimitReader(rand.Reader, 32))
+			require.NoError(t, err)
+			require.Equal(t, i, pr.ContentVersion())
+		}
+	})
+
+	t.Run("versions increment starting from the minimal version", func(t *testing.T) {
+		dl, err := Create(rand.Reader)
+		require.NoError(t, err)
+
+		for i := uint64(1); i <= 3; i++ {
+			pr, _, err := dl.UpdateLinkDataMinVersion(io.LimitReader(rand.Reader, 32), 1)
+			require.NoError(t, err)
+			require.Equal(t, i, pr.ContentVersion())
+		}
+
+		// Minimal version above known versions is used as is
+		pr, _, err := dl.UpdateLinkDataMinVersion(io.LimitReader(rand.Reader, 32), 1000)
+		require.NoError(t, err)
+		require.EqualValues(t, 1000, pr.ContentVersion())
+	})
+
+	t.Run("minimal version below stored link data", func(t *testing.T) {
+		dl, err := Create(rand.Reader)
+		require.NoError(t, err)
+
+		stored, _, err := dl.UpdateLinkData(io.LimitReader(rand.Reader, 32), 2000)
+		require.NoError(t, err)
+
+		dl2, err := FromAuthInfo(dl.AuthInfo())
+		require.NoError(t, err)
+		require.NoError(t, dl2.SyncVersion(stored))
+
+		pr, _, err := dl2.UpdateLinkDataMinVersion(io.LimitReader(rand.Reader, 32), 1000)
+		require.NoError(t, err)
+		require.EqualValues(t, 2001, pr.ContentVersion())
+		require.True(t, pr.GreaterThan(stored))
+
+		pr, _, err = dl2.UpdateLinkDataMinVersion(io.LimitReader(rand.Reader, 32), 3000)
+		require.NoError(t, err)
+		require.EqualValues(t, 3000, pr.ContentVersion())
+	})
+
+	t.Run("continue after explicit version", func(t *testing.T) {
+		dl, err := Create(rand.Reader)
+		require.NoError(t, err)
+
+		pr0, _, err := dl.UpdateLinkData(io.LimitReader(rand.Reader, 32), 0)
+		require.NoError(t, err)
+
+		pr1, _, err := dl.UpdateLinkDataAutoVersion(io.LimitReader(rand.Reader, 32))
+		require.NoError(t, err)
+		require.EqualValues(t, 1, pr1.ContentVersion())
+		require.True(t, pr1.GreaterThan(pr0))
+
+		_, _, err = dl.UpdateLinkData(io.LimitReader(rand.Reader, 32), 10)
+		require.NoError(t, err)
+
+		// Lower explicit version does not decrease the known version
+		_, _, err = dl.UpdateLinkData(io.LimitReader(rand.Reader, 32), 5)
+		require.NoError(t, err)
+
+		pr11, _, err := dl.UpdateLinkDataAutoVersion(io.LimitReader(rand.Reader, 32))
+		require.NoError(t, err)
+		require.EqualValues(t, 11, pr11.ContentVersion())
+	})
+
+	t.Run("sync version from stored data", func(t *testing.T) {
+		dl, err := Create(rand.Reader)
+		require.NoError(t, err)
+
+		stored, _, err := dl.UpdateLinkData(io.LimitReader(rand.Reader, 32), 7)
+		require.NoError(t, err)
+
+		dl2, err := FromAuthInfo(dl.AuthInfo())
+		require.NoError(t, err)
+
+		err = dl2.SyncVersion(stored)
+		require.NoError(t, err)
+
+		pr, _, err := dl2.UpdateLinkDataAutoVersion(io.LimitReader(rand.Reader, 32))
+		require.NoError(t, err)
+		require.EqualValues(t, 8, pr.ContentVersion())
+		require.True(t, pr.GreaterThan(stored))
+	})
+
+	t.Run("sync version from different link", func(t *testing.T) {
+		dl, err := Create(rand.Reader)
+		require.NoError(t, err)
+
+		dl2, err := Create(rand.Reader)
+		require.NoError(t, err)
+
+		pr, _, err := dl2.UpdateLinkData(io.LimitReader(rand.Reader, 32), 7)
+		require.NoError(t, err)
+
+		err = dl.SyncVersion(pr)
+		require.ErrorIs(t, err, ErrLinkDataFromDifferentLink)
+	})
+
+	t.Run("version overflow", func(t *testing.T) {
+		dl, err := Create(rand.Reader)
+		require.NoError(t, err)
+
+		_, _, err = dl.UpdateLinkData(io.LimitReader(rand.Reader, 32), math.MaxUint64)
+		require.NoError(t, err)
+
+		pr, key, err := dl.UpdateLinkDataAutoVersion(io.LimitReader(rand.Reader, 32))
+		require.ErrorIs(t, err, ErrContentVersionOverflow)
+		require.Nil(t, pr)
+		require.Nil(t, key)
+	})
+
+	t.Run("failed data reader does not bump the version", func(t *testing.T) {
+		dl, err := Create(rand.Reader)
+		require.NoError(t, err)
+
+		_, _, err = dl.UpdateLinkDataMinVersion(iotest.ErrReader(errors.New("test")), 1)
+		require.Error(t, err)
+
+		pr, _, err := dl.UpdateLinkDataMinVersion(io.LimitReader(rand.Reader, 32), 1)
+		require.NoError(t, err)
+		require.EqualValues(t, 1, pr.ContentVersion())
+	})
+
+	t.Run("concurrent updates get unique versions", func(t *testing.T) {
+		dl, err := Create(rand.Reader)
+		require.NoError(t, err)
+
+		const count = 50
+		versions := make(chan uint64, count)
+		wg := sync.WaitGroup{}
+		for i := 0; i < count; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				pr, _, err := dl.UpdateLinkDataAutoVersion(io.LimitReader(rand.Reader, 32))
+				require.NoError(t, err)
+				versions <- pr.ContentVersion()
+			}()
+		}
+		wg.Wait()
+		close(versions)
+
+		seen := map[uint64]bool{}
+		for v := range versions {
+			require.False(t, seen[v])
+			seen[v] = true
+		}
+		require.Len(t, seen, count)
+	})
+}
+
+func TestVersionZeroTiebreak(t *testing.T) {
+	dl, err := Create(rand.Reader)
+	require.NoError(t, err)
+
+	pr1, _, err := dl.UpdateLinkData(io.LimitReader(rand.Reader, 32), 0)
+	require.NoError(t, err)
+	pr2, _, err := dl.UpdateLinkData(io.LimitReader(rand.Reader, 32), 0)
+	require.NoError(t, err)
+
+	// Exactly one of the two wins, selected by the signature hash
+	require.NotEqual(t, pr1.GreaterThan(pr2), pr2.GreaterThan(pr1))
+
+	hs1 := sha256.Sum256(pr1.signature)
+	hs2 := sha256.Sum256(pr2.signature)
+	require.Equal(t, bytes.Compare(hs1[:], hs2[:]) > 0, pr1.GreaterThan(pr2))
+
+	// Any higher version wins regardless of the signature
+	pr3, _, err := dl.UpdateLinkDataAutoVersion(io.LimitReader(rand.Reader, 32))
+	require.NoError(t, err)
+	require.True(t, pr3.GreaterThan(pr1))
+	require.True(t, pr3.GreaterThan(pr2))
+}
@@ -17,10 +17,14 @@ limitations under the License.
 package cipherfactory
 
 import (
+	"crypto/aes"
 	"crypto/cipher"
+	"encoding/binary"
 	"errors"
 	"fmt"
 	"io"
+	"math"
+	"math/bits"
 
 	"github.com/cinode/go/pkg/common"
 	"golang.org/x/crypto/chacha20"
@@ -32,44 +36,176 @@ var (
 	ErrInvalidEncryptionConfig = errors.New("invalid encryption config")
 
 	ErrInvalidEncryptionConfigKeyType = fmt.Errorf("%w: wrong key type", ErrInvalidEncryptionConfig)
-	ErrInvalidEncryptionConfigKeySize = fmt.Errorf("%w: wrong XChaCha20 key size, expected %d bytes", ErrInvalidEncryptionConfig, chacha20.KeySize+1)
-	ErrInvalidEncryptionConfigIVSize  = fmt.Errorf("%w: wrong XChaCha20 iv size, expected %d bytes", ErrInvalidEncryptionConfig, chacha20.NonceSizeX)
+	ErrInvalidEncryptionConfigKeySize = fmt.Errorf("%w: wrong key size", ErrInvalidEncryptionConfig)
+	ErrInvalidEncryptionConfigIVSize  = fmt.Errorf("%w: wrong iv size", ErrInvalidEncryptionConfig)
+
+	ErrInvalidStreamOffset = errors.New("invalid stream offset")
 )
 
+// Algorithm identifies the encryption algorithm, it is stored as the first
+// byte of the key so that the right cipher can be selected when reading data
+type Algorithm byte
+
 const (
-	reservedByteForKeyType byte = 0
+	// AlgorithmXChaCha20 is the default encryption algorithm
+	AlgorithmXChaCha20 Algorithm = 0
+
+	// AlgorithmAES256CTR uses AES-256 in the counter mode, it is usually
+	// faster than XChaCha20 on CPUs with AES hardware acceleration
+	AlgorithmAES256CTR Algorithm = 1
+)
+
+const (
+	// Size of a single XChaCha20 keystream block
+	chacha20BlockSize = 64
+
+	// AES-256 key size
+	aes256KeySize = 32
 )
 
+// Valid checks whether the algorithm is supported
+func (a Algorithm) Valid() bool {
+	return a.keySize() > 0
+}
+
+func (a Algorithm) String() string {
+	switch a {
+	case AlgorithmXChaCha20:
+		return "XChaCha20"
+	case AlgorithmAES256CTR:
+		return "AES256-CTR"
+	}
+	return fmt.Sprintf("Unknown(%d)", byte(a))
+}
+
+func (a Algorithm) keySize() int {
+	switch a {
+	case AlgorithmXChaCha20:
+		return chacha20.KeySize
+	case AlgorithmAES256CTR:
+		return aes256KeySize
+	}
+	return 0
+}
+
+func (a Algorithm) ivSize() int {
+	switch a {
+	case AlgorithmXChaCha20:
+		return chacha20.NonceSizeX
+	case AlgorithmAES256CTR:
+		return aes.BlockSize
+	}
+	return 0
+}
+
+// KeyAlgorithm returns the encryption algorithm of given key, the key itself
+// is not validated
+func KeyAlgorithm(key *common.BlobKey) Algorithm {
+	keyBytes := key.Bytes()
+	if len(keyBytes) == 0 {
+		return AlgorithmXChaCha20
+	}
+	return Algorithm(keyBytes[0])
+}
+
 func StreamCipherReader(key *common.BlobKey, iv *common.BlobIV, r io.Reader) (io.Reader, error) {
-	stream, err := _cipherForKeyIV(key, iv)
+	stream, err := _cipherForKeyIV(key, iv, 0)
+	if err != nil {
+		return nil, err
+	}
+	return &cipher.StreamReader{S: stream, R: r}, nil
+}
+
+// StreamCipherReaderAt works like StreamCipherReader but the data read from
+// r is assumed to start at given offset of the encrypted stream
+func StreamCipherReaderAt(key *common.BlobKey, iv *common.BlobIV, r io.Reader, offset int64) (io.Reader, error) {
+	if offset < 0 {
+		return nil, fmt.Errorf("%w: %d", ErrInvalidStreamOffset, offset)
+	}
+
+	stream, err := _cipherForKeyIV(key, iv, offset)
 	if err != nil {
 		return nil, err
 	}
+
 	return &cipher.StreamReader{S: stream, R: r}, nil
 }
 
 func StreamCipherWriter(key *common.BlobKey, iv *common.BlobIV, w io.Writer) (io.Writer, error) {
-	stream, err := _cipherForKeyIV(key, iv)
+	stream, err := _cipherForKeyIV(key, iv, 0)
 	if err != nil {
 		return nil, err
 	}
 	return cipher.StreamWriter{S: stream, W: w}, nil
 }
 
-func _cipherForKeyIV(key *common.BlobKey, iv *common.BlobIV) (cipher.Stream, error) {
+// _cipherForKeyIV creates the cipher stream positioned at given offset
+func _cipherForKeyIV(key *common.BlobKey, iv *common.BlobIV, offset int64) (cipher.Stream, error) {
 	keyBytes := key.Bytes()
-	if len(keyBytes) == 0 || keyBytes[0] != reservedByteForKeyType {
+	if len(keyBytes) == 0 || !Algorithm(keyBytes[0]).Valid() {
 		return nil, ErrInvalidEncryptionConfigKeyType
 	}
+	alg := Algorithm(keyBytes[0])
 
-	if len(keyBytes) != chacha20.KeySize+1 {
-		return nil, fmt.Errorf("%w, got %d bytes", ErrInvalidEncryptionConfigKeySize, len(keyBytes)+1)
+	if len(keyBytes) != alg.keySize()+1 {
+		return nil, fmt.Errorf("%w, expected %d bytes for %s, got %d bytes",
+			ErrInvalidEncryptionConfigKeySize, alg.keySize()+1, alg, len(keyBytes))
 	}
 
 	ivBytes := iv.Bytes()
-	if len(ivBytes) != chacha20.NonceSizeX {
-		return nil, fmt.Errorf("%w, got %d bytes", ErrInvalidEncryptionConfigIVSize, len(ivBytes))
+	if len(ivBytes) != alg.ivSize() {
+		return nil, fmt.Errorf("%w, expected %d bytes for %s, got %d bytes",
+			ErrInvalidEncryptionConfigIVSize, alg.ivSize(), alg, len(ivBytes))
 	}
 
-	return chacha20.NewUnauthenticatedCipher(keyBytes[1:], ivBytes)
+	switch alg {
+	case AlgorithmAES256CTR:
+		return _aesCTRAt(keyBytes[1:], ivBytes, offset)
+	default:
+		return _chacha20At(keyBytes[1:], ivBytes, offset)
+	}
+}
+
+func _chacha20At(key, iv []byte, offset int64) (cipher.Stream, error) {
+	if offset/chacha20BlockSize > math.MaxUint32 {
+		return nil, fmt.Errorf("%w: %d", ErrInvalidStreamOffset, offset)
+	}
+
+	stream, err := chacha20.NewUnauthenticatedCipher(key, iv)
+	if err != nil {
+		return nil, err
+	}
+
+	// Skip whole keystream blocks by setting the block counter, the
+	// remaining part of the block is discarded
+	stream.SetCounter(uint32(offset / chacha20BlockSize))
+	var skip [chacha20BlockSize]byte
+	stream.XORKeyStream(skip[:offset%chacha20BlockSize], skip[:offset%chacha20BlockSize])
+
+	return stream, nil
+}
+
+func _aesCTRAt(key, iv []byte, offset int64) (cipher.Stream, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	// The counter block is a 128-bit big-endian number increased for each
+	// keystream block, whole blocks are skipped by advancing the initial
+	// counter value, the remaining part of the block is discarded
+	hi := binary.BigEndian.Uint64(iv[:8])
+	lo := binary.BigEndian.Uint64(iv[8:])
+	lo, carry := bits.Add64(lo, uint64(offset/aes.BlockSize), 0)
+	hi += carry
+
+	var counter [aes.BlockSize]byte
+	binary.BigEndian.PutUint64(counter[:8], hi)
+	binary.BigEndian.PutUint64(counter[8:], lo)
+
+	stream := cipher.NewCTR(block, counter[:])
+	var skip [aes.BlockSize]byte
+	stream.XORKeyStream(skip[:offset%aes.BlockSize], skip[:offset%aes.BlockSize])
+
+	return stream, nil
 }
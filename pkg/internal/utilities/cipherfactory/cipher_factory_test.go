@@ -18,7 +18,10 @@ package cipherfactory
 
 import (
 	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
 	"io"
+	"math"
 	"testing"
 
 	"github.com/cinode/go/pkg/common"
@@ -58,6 +61,30 @@ func TestCipherForKeyIV(t *testing.T) {
 			make([]byte, chacha20.NonceSizeX),
 			nil,
 		},
+		{
+			"Unknown key type",
+			append([]byte{0xFB}, make([]byte, chacha20.KeySize)...),
+			make([]byte, chacha20.NonceSizeX),
+			ErrInvalidEncryptionConfigKeyType,
+		},
+		{
+			"Invalid AES key size",
+			append([]byte{byte(AlgorithmAES256CTR)}, make([]byte, aes256KeySize-1)...),
+			make([]byte, aes.BlockSize),
+			ErrInvalidEncryptionConfigKeySize,
+		},
+		{
+			"Invalid AES iv size",
+			append([]byte{byte(AlgorithmAES256CTR)}, make([]byte, aes256KeySize)...),
+			make([]byte, chacha20.NonceSizeX),
+			ErrInvalidEncryptionConfigIVSize,
+		},
+		{
+			"Valid AES key",
+			append([]byte{byte(AlgorithmAES256CTR)}, make([]byte, aes256KeySize)...),
+			make([]byte, aes.BlockSize),
+			nil,
+		},
 	} {
 		t.Run(d.desc, func(t *testing.T) {
 			sr, err := StreamCipherReader(
@@ -104,3 +131,108 @@ func TestStreamCipherRoundtrip(t *testing.T) {
 	require.NoError(t, err)
 	require.Equal(t, data, readBack)
 }
+
+func TestStreamCipherReaderAt(t *testing.T) {
+	key := common.BlobKeyFromBytes(make([]byte, chacha20.KeySize+1))
+	iv := common.BlobIVFromBytes(make([]byte, chacha20.NonceSizeX))
+
+	data := make([]byte, 1000)
+	for i := range data {
+		data[i] = byte(i)
+	}
+	buf := bytes.NewBuffer(nil)
+
+	writer, err := StreamCipherWriter(key, iv, buf)
+	require.NoError(t, err)
+	_, err = writer.Write(data)
+	require.NoError(t, err)
+	encrypted := buf.Bytes()
+
+	for _, offset := range []int64{0, 1, 63, 64, 65, 128, 500, 999, 1000} {
+		reader, err := StreamCipherReaderAt(key, iv, bytes.NewReader(encrypted[offset:]), offset)
+		require.NoError(t, err)
+
+		readBack, err := io.ReadAll(reader)
+		require.NoError(t, err)
+		require.Equal(t, data[offset:], readBack, "offset %d", offset)
+	}
+
+	t.Run("invalid offset", func(t *testing.T) {
+		for _, offset := range []int64{-1, (math.MaxUint32 + 1) * chacha20BlockSize} {
+			_, err := StreamCipherReaderAt(key, iv, bytes.NewReader(nil), offset)
+			require.ErrorIs(t, err, ErrInvalidStreamOffset)
+		}
+	})
+
+	t.Run("invalid key", func(t *testing.T) {
+		_, err := StreamCipherReaderAt(common.BlobKeyFromBytes(nil), iv, bytes.NewReader(nil), 0)
+		require.ErrorIs(t, err, ErrInvalidEncryptionConfigKeyType)
+	})
+}
+
+func TestAESStreamCipher(t *testing.T) {
+	keyBytes := append([]byte{byte(AlgorithmAES256CTR)}, bytes.Repeat([]byte{0x5A}, aes256KeySize)...)
+	key := common.BlobKeyFromBytes(keyBytes)
+
+	data := make([]byte, 1000)
+	for i := range data {
+		data[i] = byte(i)
+	}
+
+	for _, d := range []struct {
+		desc string
+		iv   []byte
+	}{
+		{"zero iv", make([]byte, aes.BlockSize)},
+		{"counter carry", append(bytes.Repeat([]byte{0x01}, 8), bytes.Repeat([]byte{0xFF}, 8)...)},
+		{"counter wraparound", bytes.Repeat([]byte{0xFF}, aes.BlockSize)},
+	} {
+		t.Run(d.desc, func(t *testing.T) {
+			iv := common.BlobIVFromBytes(d.iv)
+
+			buf := bytes.NewBuffer(nil)
+			writer, err := StreamCipherWriter(key, iv, buf)
+			require.NoError(t, err)
+			_, err = writer.Write(data)
+			require.NoError(t, err)
+			encrypted := buf.Bytes()
+
+			// Compare with the standard library implementation
+			block, err := aes.NewCipher(keyBytes[1:])
+			require.NoError(t, err)
+			expected := make([]byte, len(data))
+			cipher.NewCTR(block, d.iv).XORKeyStream(expected, data)
+			require.Equal(t, expected, encrypted)
+
+			for _, offset := range []int64{0, 1, 15, 16, 17, 32, 500, 999, 1000} {
+				reader, err := StreamCipherReaderAt(key, iv, bytes.NewReader(encrypted[offset:]), offset)
+				require.NoError(t, err)
+
+				readBack, err := io.ReadAll(reader)
+				require.NoError(t, err)
+				require.Equal(t, data[offset:], readBack, "offset %d", offset)
+			}
+		})
+	}
+
+	t.Run("large offset", func(t *testing.T) {
+		// Offsets are not limited by the block counter size as for XChaCha20
+		iv := common.BlobIVFromBytes(make([]byte, aes.BlockSize))
+		_, err := StreamCipherReaderAt(key, iv, bytes.NewReader(nil), (math.MaxUint32+1)*chacha20BlockSize)
+		require.NoError(t, err)
+	})
+}
+
+func TestKeyAlgorithm(t *testing.T) {
+	require.Equal(t, AlgorithmXChaCha20, KeyAlgorithm(common.BlobKeyFromBytes(nil)))
+	require.Equal(t, AlgorithmXChaCha20, KeyAlgorithm(common.BlobKeyFromBytes([]byte{0, 1, 2})))
+	require.Equal(t, AlgorithmAES256CTR, KeyAlgorithm(common.BlobKeyFromBytes([]byte{1, 1, 2})))
+
+	require.True(t, AlgorithmXChaCha20.Valid())
+	require.True(t, AlgorithmAES256CTR.Valid())
+	require.False(t, Algorithm(0xFB).Valid())
+
+	require.Equal(t, "XChaCha20", AlgorithmXChaCha20.String())
+	require.Equal(t, "AES256-CTR", AlgorithmAES256CTR.String())
+	require.Equal(t, "Unknown(251)", Algorithm(0xFB).String())
+}
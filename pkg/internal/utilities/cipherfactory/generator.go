@@ -18,11 +18,13 @@ package cipherfactory
 
 import (
 	"crypto/sha256"
+	"encoding"
+	"errors"
+	"fmt"
 	"hash"
 	"io"
 
 	"github.com/cinode/go/pkg/common"
-	"golang.org/x/crypto/chacha20"
 )
 
 const (
@@ -31,21 +33,39 @@ const (
 	preambleHashDefaultIV = 0x03
 )
 
+var (
+	ErrInvalidKeyGeneratorState = errors.New("invalid key generator state")
+)
+
 type KeyGenerator interface {
 	io.Writer
 	Generate() *common.BlobKey
+
+	// Algorithm returns the encryption algorithm of generated keys
+	Algorithm() Algorithm
+
+	// MarshalBinary returns the intermediate state of the generator
+	// that can be restored with KeyGeneratorFromState
+	encoding.BinaryMarshaler
 }
 
 type keyGenerator struct {
-	h hash.Hash
+	alg Algorithm
+	h   hash.Hash
 }
 
 func (g keyGenerator) Write(b []byte) (int, error) { return g.h.Write(b) }
 
+func (g keyGenerator) Algorithm() Algorithm { return g.alg }
+
+func (g keyGenerator) MarshalBinary() ([]byte, error) {
+	return g.h.(encoding.BinaryMarshaler).MarshalBinary()
+}
+
 func (g keyGenerator) Generate() *common.BlobKey {
 	return common.BlobKeyFromBytes(append(
-		[]byte{reservedByteForKeyType},
-		g.h.Sum(nil)[:chacha20.KeySize]...,
+		[]byte{byte(g.alg)},
+		g.h.Sum(nil)[:g.alg.keySize()]...,
 	))
 }
 
@@ -55,33 +75,59 @@ type IVGenerator interface {
 }
 
 type ivGenerator struct {
-	h hash.Hash
+	alg Algorithm
+	h   hash.Hash
 }
 
 func (g ivGenerator) Write(b []byte) (int, error) { return g.h.Write(b) }
 
 func (g ivGenerator) Generate() *common.BlobIV {
-	return common.BlobIVFromBytes(g.h.Sum(nil)[:chacha20.NonceSizeX])
+	return common.BlobIVFromBytes(g.h.Sum(nil)[:g.alg.ivSize()])
 }
 
-func NewKeyGenerator(t common.BlobType) KeyGenerator {
+// NewKeyGenerator creates the generator of keys for given encryption
+// algorithm, the algorithm is a part of the hashed data thus the same
+// data results in unrelated keys for different algorithms
+func NewKeyGenerator(alg Algorithm, t common.BlobType) KeyGenerator {
 	h := sha256.New()
-	h.Write([]byte{preambleHashKey, reservedByteForKeyType, t.IDByte()})
-	return keyGenerator{h: h}
+	h.Write([]byte{preambleHashKey, byte(alg), t.IDByte()})
+	return keyGenerator{alg: alg, h: h}
 }
 
-func NewIVGenerator(t common.BlobType) IVGenerator {
+// KeyGeneratorFromState restores the key generator from the state
+// obtained with the MarshalBinary method, the state does not contain
+// the encryption algorithm thus it must be the one used originally
+func KeyGeneratorFromState(alg Algorithm, state []byte) (KeyGenerator, error) {
 	h := sha256.New()
-	h.Write([]byte{preambleHashIV, reservedByteForKeyType, t.IDByte()})
-	return ivGenerator{h: h}
+	err := h.(encoding.BinaryUnmarshaler).UnmarshalBinary(state)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidKeyGeneratorState, err)
+	}
+	return keyGenerator{alg: alg, h: h}, nil
 }
 
-var defaultXChaCha20IV = func() *common.BlobIV {
+func NewIVGenerator(alg Algorithm, t common.BlobType) IVGenerator {
 	h := sha256.New()
-	h.Write([]byte{preambleHashDefaultIV, reservedByteForKeyType})
-	return common.BlobIVFromBytes(h.Sum(nil)[:chacha20.NonceSizeX])
-}()
+	h.Write([]byte{preambleHashIV, byte(alg), t.IDByte()})
+	return ivGenerator{alg: alg, h: h}
+}
+
+func defaultIVForAlgorithm(alg Algorithm) *common.BlobIV {
+	h := sha256.New()
+	h.Write([]byte{preambleHashDefaultIV, byte(alg)})
+	return common.BlobIVFromBytes(h.Sum(nil)[:alg.ivSize()])
+}
+
+var defaultIVs = map[Algorithm]*common.BlobIV{
+	AlgorithmXChaCha20: defaultIVForAlgorithm(AlgorithmXChaCha20),
+	AlgorithmAES256CTR: defaultIVForAlgorithm(AlgorithmAES256CTR),
+}
 
+// DefaultIV returns the constant iv for the encryption algorithm of given
+// key, it can only be used if the key is never reused for different data
 func DefaultIV(k *common.BlobKey) *common.BlobIV {
-	return defaultXChaCha20IV
+	if iv, found := defaultIVs[KeyAlgorithm(k)]; found {
+		return iv
+	}
+	return defaultIVs[AlgorithmXChaCha20]
 }
@@ -17,6 +17,7 @@ limitations under the License.
 package cipherfactory
 
 import (
+	"crypto/aes"
 	"testing"
 
 	"github.com/cinode/go/pkg/blobtypes"
@@ -27,7 +28,7 @@ func TestGenerator(t *testing.T) {
 	t.Run("successful generation", func(t *testing.T) {
 		buff := []byte{1, 2, 3, 4, 5}
 
-		kg := NewKeyGenerator(blobtypes.Static)
+		kg := NewKeyGenerator(AlgorithmXChaCha20, blobtypes.Static)
 
 		n, err := kg.Write(buff)
 		require.NoError(t, err)
@@ -35,7 +36,7 @@ func TestGenerator(t *testing.T) {
 
 		key := kg.Generate()
 
-		ig := NewIVGenerator(blobtypes.Static)
+		ig := NewIVGenerator(AlgorithmXChaCha20, blobtypes.Static)
 
 		n, err = ig.Write(buff)
 		require.NoError(t, err)
@@ -43,10 +44,10 @@ func TestGenerator(t *testing.T) {
 
 		iv := ig.Generate()
 
-		_, err = _cipherForKeyIV(key, iv)
+		_, err = _cipherForKeyIV(key, iv, 0)
 		require.NoError(t, err)
 
-		_, err = _cipherForKeyIV(key, DefaultIV(key))
+		_, err = _cipherForKeyIV(key, DefaultIV(key), 0)
 		require.NoError(t, err)
 
 		// Check initial bytes of keys only - since key and IV are of different
@@ -61,8 +62,72 @@ func TestGenerator(t *testing.T) {
 		require.NotEqual(t, keyBytes[1:1+8], ivBytes[:8])
 		require.NotEqual(t, keyBytes[1:1+8], defIvBytes[:8])
 		require.NotEqual(t, ivBytes[:8], defIvBytes[:8])
+	})
+
+	t.Run("different algorithms", func(t *testing.T) {
+		buff := []byte{1, 2, 3, 4, 5}
+
+		kgChaCha := NewKeyGenerator(AlgorithmXChaCha20, blobtypes.Static)
+		kgChaCha.Write(buff)
+		keyChaCha := kgChaCha.Generate()
+
+		kgAES := NewKeyGenerator(AlgorithmAES256CTR, blobtypes.Static)
+		kgAES.Write(buff)
+		keyAES := kgAES.Generate()
+
+		require.Equal(t, AlgorithmAES256CTR, kgAES.Algorithm())
+		require.Equal(t, AlgorithmAES256CTR, KeyAlgorithm(keyAES))
+		require.Len(t, keyAES.Bytes(), aes256KeySize+1)
+
+		// Algorithm is hashed together with the data, the same data
+		// must result in unrelated keys
+		require.NotEqual(t, keyChaCha.Bytes()[1:], keyAES.Bytes()[1:])
+
+		igAES := NewIVGenerator(AlgorithmAES256CTR, blobtypes.Static)
+		igAES.Write(buff)
+		ivAES := igAES.Generate()
+		require.Len(t, ivAES.Bytes(), aes.BlockSize)
+
+		_, err := _cipherForKeyIV(keyAES, ivAES, 0)
+		require.NoError(t, err)
 
-		// Note: once other key types are introduced, we should also check
-		// that for different key types there are different hashes
+		_, err = _cipherForKeyIV(keyAES, DefaultIV(keyAES), 0)
+		require.NoError(t, err)
+		require.Len(t, DefaultIV(keyAES).Bytes(), aes.BlockSize)
+		require.NotEqual(t, DefaultIV(keyChaCha).Bytes()[:aes.BlockSize], DefaultIV(keyAES).Bytes())
 	})
 }
+
+func TestKeyGeneratorState(t *testing.T) {
+	data := []byte("some data hashed in two separate parts")
+
+	kgFull := NewKeyGenerator(AlgorithmXChaCha20, blobtypes.Static)
+	_, err := kgFull.Write(data)
+	require.NoError(t, err)
+
+	kgPart := NewKeyGenerator(AlgorithmXChaCha20, blobtypes.Static)
+	_, err = kgPart.Write(data[:10])
+	require.NoError(t, err)
+
+	state, err := kgPart.MarshalBinary()
+	require.NoError(t, err)
+
+	kgRestored, err := KeyGeneratorFromState(AlgorithmXChaCha20, state)
+	require.NoError(t, err)
+
+	_, err = kgRestored.Write(data[10:])
+	require.NoError(t, err)
+	require.Equal(t, kgFull.Generate(), kgRestored.Generate())
+
+	kgAES := NewKeyGenerator(AlgorithmAES256CTR, blobtypes.Static)
+	_, err = kgAES.Write(data)
+	require.NoError(t, err)
+	state, err = kgAES.MarshalBinary()
+	require.NoError(t, err)
+	kgAESRestored, err := KeyGeneratorFromState(AlgorithmAES256CTR, state)
+	require.NoError(t, err)
+	require.Equal(t, kgAES.Generate(), kgAESRestored.Generate())
+
+	_, err = KeyGeneratorFromState(AlgorithmXChaCha20, []byte("invalid state"))
+	require.ErrorIs(t, err, ErrInvalidKeyGeneratorState)
+}
@@ -0,0 +1,178 @@
+/*
+Copyright © 2022 Bartłomiej Święcki (byo)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package securefifo
+
+import (
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"golang.org/x/crypto/chacha20"
+)
+
+var (
+	ErrInvalidState = errors.New("invalid secure fifo state")
+)
+
+const chacha20BlockSize = 64
+
+// State contains data needed to resume writing to a persistent secure fifo.
+//
+// The state contains the key used to encrypt the fifo data thus it must be
+// protected the same way as the data written to the fifo.
+type State struct {
+	Key    []byte
+	Nonce  []byte
+	Offset int64
+}
+
+// PersistentWriter is a secure fifo writer backed by a named file that
+// outlives the writer. Writing can be resumed from a previously taken
+// checkpoint, even in a different process. The file is not removed once
+// closed, it is up to the caller to remove it once no longer needed.
+type PersistentWriter interface {
+	Writer
+
+	// Checkpoint flushes the written data to the disk and returns the state
+	// needed to resume writing at the current position
+	Checkpoint() (State, error)
+}
+
+type persistentWriter struct {
+	writer
+	offset int64
+}
+
+func (w *persistentWriter) Write(b []byte) (int, error) {
+	n, err := w.writer.Write(b)
+	w.offset += int64(n)
+	return n, err
+}
+
+func (w *persistentWriter) Checkpoint() (State, error) {
+	err := w.sf.fl.Sync()
+	if err != nil {
+		return State{}, err
+	}
+
+	return State{
+		Key:    w.sf.key,
+		Nonce:  w.sf.nonce,
+		Offset: w.offset,
+	}, nil
+}
+
+// NewPersistent creates new persistent secure fifo stored in a file
+// at given path, existing file is overwritten
+func NewPersistent(path string) (PersistentWriter, error) {
+	var randData [chacha20.KeySize + chacha20.NonceSize]byte
+	_, err := rand.Read(randData[:])
+	if err != nil {
+		return nil, err
+	}
+
+	fl, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	sf := &secureFifo{
+		key:   randData[:chacha20.KeySize],
+		nonce: randData[chacha20.KeySize:],
+		fl:    fl,
+	}
+
+	return &persistentWriter{
+		writer: writer{
+			sf: sf,
+			w:  cipher.StreamWriter{S: sf.getStream(), W: fl},
+		},
+	}, nil
+}
+
+// ResumePersistent opens the persistent secure fifo at given path and
+// continues writing at the position stored in the state. Any data written
+// after the state was taken is discarded.
+func ResumePersistent(path string, state State) (PersistentWriter, error) {
+	if len(state.Key) != chacha20.KeySize ||
+		len(state.Nonce) != chacha20.NonceSize ||
+		state.Offset < 0 {
+		return nil, ErrInvalidState
+	}
+
+	fl, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	stream, err := resumeStream(fl, state)
+	if err != nil {
+		fl.Close()
+		return nil, err
+	}
+
+	return &persistentWriter{
+		writer: writer{
+			sf: &secureFifo{
+				key:   state.Key,
+				nonce: state.Nonce,
+				fl:    fl,
+			},
+			w: cipher.StreamWriter{S: stream, W: fl},
+		},
+		offset: state.Offset,
+	}, nil
+}
+
+func resumeStream(fl *os.File, state State) (cipher.Stream, error) {
+	st, err := fl.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if st.Size() < state.Offset {
+		return nil, fmt.Errorf(
+			"%w: file is shorter (%d bytes) than the resumed position (%d bytes)",
+			ErrInvalidState, st.Size(), state.Offset,
+		)
+	}
+
+	err = fl.Truncate(state.Offset)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = fl.Seek(state.Offset, io.SeekStart)
+	if err != nil {
+		return nil, err
+	}
+
+	stream, err := chacha20.NewUnauthenticatedCipher(state.Key, state.Nonce)
+	if err != nil {
+		return nil, err
+	}
+
+	// Move the key stream to the resumed position
+	stream.SetCounter(uint32(state.Offset / chacha20BlockSize))
+	var skip [chacha20BlockSize]byte
+	partial := skip[:state.Offset%chacha20BlockSize]
+	stream.XORKeyStream(partial, partial)
+
+	return stream, nil
+}
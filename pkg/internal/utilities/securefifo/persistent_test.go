@@ -0,0 +1,106 @@
+/*
+Copyright © 2023 Bartłomiej Święcki (byo)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package securefifo
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPersistentSecureFifoResume(t *testing.T) {
+	data := bytes.Repeat([]byte("0123456789abcdef"), 1000)
+
+	for _, split := range []int{0, 1, 63, 64, 65, 1000, len(data)} {
+		path := filepath.Join(t.TempDir(), "fifo")
+
+		w, err := NewPersistent(path)
+		require.NoError(t, err)
+
+		_, err = w.Write(data[:split])
+		require.NoError(t, err)
+
+		state, err := w.Checkpoint()
+		require.NoError(t, err)
+		require.EqualValues(t, split, state.Offset)
+
+		// Data written after the checkpoint must be discarded
+		_, err = w.Write([]byte("garbage"))
+		require.NoError(t, err)
+		require.NoError(t, w.Close())
+
+		// The file must remain on disk and must not reveal the data
+		fileData, err := os.ReadFile(path)
+		require.NoError(t, err)
+		require.Len(t, fileData, split+len("garbage"))
+		if split > 16 {
+			require.NotContains(t, string(fileData), string(data[:16]))
+		}
+
+		w, err = ResumePersistent(path, state)
+		require.NoError(t, err)
+
+		_, err = w.Write(data[split:])
+		require.NoError(t, err)
+
+		r, err := w.Done()
+		require.NoError(t, err)
+
+		readBack, err := io.ReadAll(r)
+		require.NoError(t, err)
+		require.Equal(t, data, readBack)
+		require.NoError(t, r.Close())
+	}
+}
+
+func TestPersistentSecureFifoInvalidState(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "fifo")
+
+	w, err := NewPersistent(path)
+	require.NoError(t, err)
+
+	_, err = w.Write([]byte("data"))
+	require.NoError(t, err)
+
+	state, err := w.Checkpoint()
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+
+	for _, d := range []struct {
+		desc  string
+		state State
+	}{
+		{"invalid key", State{Key: state.Key[1:], Nonce: state.Nonce}},
+		{"invalid nonce", State{Key: state.Key, Nonce: state.Nonce[1:]}},
+		{"negative offset", State{Key: state.Key, Nonce: state.Nonce, Offset: -1}},
+		{"offset beyond file size", State{Key: state.Key, Nonce: state.Nonce, Offset: 5}},
+	} {
+		t.Run(d.desc, func(t *testing.T) {
+			_, err := ResumePersistent(path, d.state)
+			require.ErrorIs(t, err, ErrInvalidState)
+		})
+	}
+
+	t.Run("missing file", func(t *testing.T) {
+		_, err := ResumePersistent(path+".missing", state)
+		require.ErrorIs(t, err, os.ErrNotExist)
+	})
+}
@@ -0,0 +1,64 @@
+/*
+Copyright © 2023 Bartłomiej Święcki (byo)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package propagation
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/cinode/go/pkg/blobtypes"
+	"github.com/cinode/go/pkg/common"
+	"github.com/cinode/go/pkg/internal/blobtypes/dynamiclink"
+)
+
+// FormatInfo describes the format of a blob as stored in the datastore
+type FormatInfo struct {
+	// Type of the blob, the same as the type of its name
+	Type common.BlobType
+
+	// Version of the blob format, all blob types currently
+	// use the initial format version 0
+	Version int
+
+	// LinkContentVersion is the content version of the dynamic link data,
+	// it is always 0 for other blob types
+	LinkContentVersion uint64
+}
+
+// BlobFormatInfo detects the format of given blob based on its name and
+// the public part of its data, the blob content is never decrypted.
+//
+// Static blobs have no header, their data is not read at all. For dynamic
+// links the public header is parsed and validated.
+func BlobFormatInfo(name *common.BlobName, r io.Reader) (FormatInfo, error) {
+	switch name.Type() {
+	case blobtypes.Static:
+		return FormatInfo{Type: blobtypes.Static}, nil
+
+	case blobtypes.DynamicLink:
+		dl, err := dynamiclink.FromPublicData(name, r)
+		if err != nil {
+			return FormatInfo{}, fmt.Errorf("%w: %w", blobtypes.ErrValidationFailed, err)
+		}
+		return FormatInfo{
+			Type:               blobtypes.DynamicLink,
+			LinkContentVersion: dl.ContentVersion(),
+		}, nil
+	}
+
+	return FormatInfo{}, blobtypes.ErrUnknownBlobType
+}
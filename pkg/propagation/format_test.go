@@ -0,0 +1,86 @@
+/*
+Copyright © 2023 Bartłomiej Święcki (byo)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package propagation
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/cinode/go/pkg/blobtypes"
+	"github.com/cinode/go/pkg/common"
+	"github.com/cinode/go/pkg/internal/blobtypes/dynamiclink"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBlobFormatInfo(t *testing.T) {
+	// Blobs are created directly since the datastore depends on this package
+	t.Run("static", func(t *testing.T) {
+		raw := []byte("hello")
+		hash := sha256.Sum256(raw)
+		name, err := common.BlobNameFromHashAndType(hash[:], blobtypes.Static)
+		require.NoError(t, err)
+
+		fi, err := BlobFormatInfo(name, bytes.NewReader(raw))
+		require.NoError(t, err)
+		require.Equal(t, FormatInfo{Type: blobtypes.Static}, fi)
+
+		// Static blobs have no header
+		fi, err = BlobFormatInfo(name, nil)
+		require.NoError(t, err)
+		require.Equal(t, FormatInfo{Type: blobtypes.Static}, fi)
+	})
+
+	t.Run("dynamic link", func(t *testing.T) {
+		dl, err := dynamiclink.Create(rand.Reader)
+		require.NoError(t, err)
+		pr, _, err := dl.UpdateLinkData(strings.NewReader("hello"), 1234)
+		require.NoError(t, err)
+		name := dl.BlobName()
+
+		raw, err := io.ReadAll(pr.GetPublicDataReader())
+		require.NoError(t, err)
+		fi, err := BlobFormatInfo(name, bytes.NewReader(raw))
+		require.NoError(t, err)
+		require.Equal(t, FormatInfo{
+			Type:               blobtypes.DynamicLink,
+			LinkContentVersion: 1234,
+		}, fi)
+
+		t.Run("invalid data", func(t *testing.T) {
+			corrupted := bytes.Clone(raw)
+			corrupted[0] = 0xFF
+
+			_, err := BlobFormatInfo(name, bytes.NewReader(corrupted))
+			require.ErrorIs(t, err, blobtypes.ErrValidationFailed)
+
+			_, err = BlobFormatInfo(name, bytes.NewReader(raw[:10]))
+			require.ErrorIs(t, err, blobtypes.ErrValidationFailed)
+		})
+	})
+
+	t.Run("unknown blob type", func(t *testing.T) {
+		name, err := common.BlobNameFromHashAndType(sha256.New().Sum(nil), common.NewBlobType(0xFF))
+		require.NoError(t, err)
+
+		_, err = BlobFormatInfo(name, bytes.NewReader(nil))
+		require.ErrorIs(t, err, blobtypes.ErrUnknownBlobType)
+	})
+}
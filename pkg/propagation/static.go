@@ -0,0 +1,50 @@
+/*
+Copyright © 2023 Bartłomiej Święcki (byo)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package propagation
+
+import (
+	"crypto/sha256"
+	"io"
+
+	"github.com/cinode/go/pkg/blobtypes"
+	"github.com/cinode/go/pkg/common"
+	"github.com/cinode/go/pkg/internal/utilities/validatingreader"
+)
+
+// StaticValidatingReader returns a reader streaming the encrypted data of
+// a static blob while validating it against the blob name. The data is not
+// buffered, once the underlying reader reaches EOF, blobtypes.ErrValidationFailed
+// is returned instead of io.EOF if the data does not match the name.
+//
+// Callers must not trust the data until EOF is reached without an error.
+// Names of other blob types are rejected with blobtypes.ErrUnknownBlobType.
+func StaticValidatingReader(name *common.BlobName, r io.Reader) io.Reader {
+	if name.Type() != blobtypes.Static {
+		return errorReader{blobtypes.ErrUnknownBlobType}
+	}
+
+	return validatingreader.NewHashValidation(
+		r,
+		sha256.New(),
+		name.Hash(),
+		blobtypes.ErrValidationFailed,
+	)
+}
+
+type errorReader struct{ err error }
+
+func (e errorReader) Read([]byte) (int, error) { return 0, e.err }
@@ -0,0 +1,92 @@
+/*
+Copyright © 2023 Bartłomiej Święcki (byo)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package propagation
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"io"
+	"testing"
+	"testing/iotest"
+
+	"github.com/cinode/go/pkg/blobtypes"
+	"github.com/cinode/go/pkg/common"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStaticValidatingReader(t *testing.T) {
+	data := bytes.Repeat([]byte("encrypted blob data "), 1000)
+	hash := sha256.Sum256(data)
+	name, err := common.BlobNameFromHashAndType(hash[:], blobtypes.Static)
+	require.NoError(t, err)
+
+	t.Run("matching content", func(t *testing.T) {
+		read, err := io.ReadAll(StaticValidatingReader(name, bytes.NewReader(data)))
+		require.NoError(t, err)
+		require.Equal(t, data, read)
+	})
+
+	t.Run("matching content read in small chunks", func(t *testing.T) {
+		err := iotest.TestReader(
+			StaticValidatingReader(name, iotest.OneByteReader(bytes.NewReader(data))),
+			data,
+		)
+		require.NoError(t, err)
+	})
+
+	t.Run("mismatching content", func(t *testing.T) {
+		corrupted := bytes.Clone(data)
+		corrupted[len(corrupted)/2] ^= 0xFF
+
+		read, err := io.ReadAll(StaticValidatingReader(name, bytes.NewReader(corrupted)))
+		require.ErrorIs(t, err, blobtypes.ErrValidationFailed)
+		require.Equal(t, corrupted, read)
+	})
+
+	t.Run("truncated content", func(t *testing.T) {
+		for _, l := range []int{0, 1, len(data) / 2, len(data) - 1} {
+			_, err := io.ReadAll(StaticValidatingReader(name, bytes.NewReader(data[:l])))
+			require.ErrorIs(t, err, blobtypes.ErrValidationFailed, l)
+		}
+	})
+
+	t.Run("extra content", func(t *testing.T) {
+		extended := append(bytes.Clone(data), 0)
+
+		_, err := io.ReadAll(StaticValidatingReader(name, bytes.NewReader(extended)))
+		require.ErrorIs(t, err, blobtypes.ErrValidationFailed)
+	})
+
+	t.Run("read error", func(t *testing.T) {
+		injectedErr := errors.New("read error")
+
+		_, err := io.ReadAll(StaticValidatingReader(name, io.MultiReader(
+			bytes.NewReader(data),
+			iotest.ErrReader(injectedErr),
+		)))
+		require.ErrorIs(t, err, injectedErr)
+	})
+
+	t.Run("not a static blob", func(t *testing.T) {
+		linkName, err := common.BlobNameFromHashAndType(hash[:], blobtypes.DynamicLink)
+		require.NoError(t, err)
+
+		_, err = io.ReadAll(StaticValidatingReader(linkName, bytes.NewReader(data)))
+		require.ErrorIs(t, err, blobtypes.ErrUnknownBlobType)
+	})
+}
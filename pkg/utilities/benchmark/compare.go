@@ -0,0 +1,152 @@
+/*
+Copyright © 2022 Bartłomiej Święcki (byo)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package benchmark
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrInvalidBenchmarkOutput = errors.New("invalid benchmark output")
+)
+
+// Result is the result of a single benchmark
+type Result struct {
+	Name    string
+	NsPerOp float64
+}
+
+var gomaxprocsSuffix = regexp.MustCompile(`-\d+$`)
+
+// ParseResults parses the output of `go test -bench`, lines other than
+// benchmark results are ignored. If the same benchmark was run multiple
+// times (e.g. with -count flag), the fastest run is used as it is the least
+// affected by the noise. Benchmark names are stored without the GOMAXPROCS
+// suffix so that results from machines with different number of CPUs can
+// be compared.
+func ParseResults(r io.Reader) (map[string]Result, error) {
+	ret := map[string]Result{}
+
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 4 || !strings.HasPrefix(fields[0], "Benchmark") {
+			continue
+		}
+
+		// Fields: name, iterations, then value-unit pairs
+		nsPerOp := -1.0
+		for i := 2; i+1 < len(fields); i += 2 {
+			if fields[i+1] != "ns/op" {
+				continue
+			}
+			v, err := strconv.ParseFloat(fields[i], 64)
+			if err != nil {
+				return nil, fmt.Errorf("%w: line %d: %w", ErrInvalidBenchmarkOutput, line, err)
+			}
+			nsPerOp = v
+		}
+		if nsPerOp < 0 {
+			continue
+		}
+
+		name := gomaxprocsSuffix.ReplaceAllString(fields[0], "")
+		if prev, found := ret[name]; found && prev.NsPerOp <= nsPerOp {
+			continue
+		}
+		ret[name] = Result{Name: name, NsPerOp: nsPerOp}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return ret, nil
+}
+
+// Change describes the difference between the baseline and the current
+// result of a single benchmark
+type Change struct {
+	Name     string
+	Baseline float64
+	Current  float64
+}
+
+// Ratio returns the ratio of the current time to the baseline one,
+// values above 1 mean the benchmark got slower
+func (c Change) Ratio() float64 {
+	return c.Current / c.Baseline
+}
+
+// Comparison is the result of comparing benchmark results with the baseline
+type Comparison struct {
+	// Benchmarks present in both baseline and current results
+	Changes []Change
+
+	// Benchmarks present only in the baseline
+	Missing []string
+
+	// Benchmarks present only in current results
+	Added []string
+}
+
+// Compare compares current benchmark results with the baseline,
+// all lists in the result are sorted by benchmark name
+func Compare(baseline, current map[string]Result) Comparison {
+	ret := Comparison{}
+
+	for name, b := range baseline {
+		c, found := current[name]
+		if !found {
+			ret.Missing = append(ret.Missing, name)
+			continue
+		}
+		ret.Changes = append(ret.Changes, Change{
+			Name:     name,
+			Baseline: b.NsPerOp,
+			Current:  c.NsPerOp,
+		})
+	}
+	for name := range current {
+		if _, found := baseline[name]; !found {
+			ret.Added = append(ret.Added, name)
+		}
+	}
+
+	slices.SortFunc(ret.Changes, func(a, b Change) int { return strings.Compare(a.Name, b.Name) })
+	slices.Sort(ret.Missing)
+	slices.Sort(ret.Added)
+	return ret
+}
+
+// Regressions returns benchmarks that got slower by more than given
+// threshold, e.g. 0.1 reports benchmarks slower by more than 10%
+func (c Comparison) Regressions(threshold float64) []Change {
+	var ret []Change
+	for _, ch := range c.Changes {
+		if ch.Ratio() > 1+threshold {
+			ret = append(ret, ch)
+		}
+	}
+	return ret
+}
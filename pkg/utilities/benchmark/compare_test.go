@@ -0,0 +1,75 @@
+/*
+Copyright © 2022 Bartłomiej Święcki (byo)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package benchmark
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const sampleOutput = `goos: linux
+goarch: amd64
+pkg: github.com/cinode/go/pkg/blenc
+cpu: Some CPU
+BenchmarkStaticCreate/size=1KiB-8         	   20000	     60000 ns/op	  17.07 MB/s	    4000 B/op	      50 allocs/op
+BenchmarkStaticCreate/size=1KiB-8         	   20000	     55000 ns/op	  18.62 MB/s	    4000 B/op	      50 allocs/op
+BenchmarkStaticCreate/size=1MiB-8         	     100	  10000000 ns/op
+BenchmarkNoTime-8                         	     100	      5000 B/op
+--- BENCH: BenchmarkSomething
+PASS
+ok  	github.com/cinode/go/pkg/blenc	3.000s
+`
+
+func TestParseResults(t *testing.T) {
+	results, err := ParseResults(strings.NewReader(sampleOutput))
+	require.NoError(t, err)
+	require.Equal(t, map[string]Result{
+		"BenchmarkStaticCreate/size=1KiB": {Name: "BenchmarkStaticCreate/size=1KiB", NsPerOp: 55000},
+		"BenchmarkStaticCreate/size=1MiB": {Name: "BenchmarkStaticCreate/size=1MiB", NsPerOp: 10000000},
+	}, results)
+
+	_, err = ParseResults(strings.NewReader("BenchmarkX-8 100 abc ns/op\n"))
+	require.ErrorIs(t, err, ErrInvalidBenchmarkOutput)
+}
+
+func TestCompare(t *testing.T) {
+	baseline := map[string]Result{
+		"BenchmarkA": {Name: "BenchmarkA", NsPerOp: 100},
+		"BenchmarkB": {Name: "BenchmarkB", NsPerOp: 100},
+		"BenchmarkC": {Name: "BenchmarkC", NsPerOp: 100},
+		"BenchmarkD": {Name: "BenchmarkD", NsPerOp: 100},
+	}
+	current := map[string]Result{
+		"BenchmarkA": {Name: "BenchmarkA", NsPerOp: 105},
+		"BenchmarkB": {Name: "BenchmarkB", NsPerOp: 150},
+		"BenchmarkC": {Name: "BenchmarkC", NsPerOp: 50},
+		"BenchmarkE": {Name: "BenchmarkE", NsPerOp: 100},
+	}
+
+	cmp := Compare(baseline, current)
+	require.Equal(t, []string{"BenchmarkD"}, cmp.Missing)
+	require.Equal(t, []string{"BenchmarkE"}, cmp.Added)
+	require.Len(t, cmp.Changes, 3)
+	require.Equal(t, "BenchmarkA", cmp.Changes[0].Name)
+	require.InDelta(t, 1.05, cmp.Changes[0].Ratio(), 1e-9)
+
+	require.Equal(t, []Change{{Name: "BenchmarkB", Baseline: 100, Current: 150}}, cmp.Regressions(0.1))
+	require.Len(t, cmp.Regressions(0.01), 2)
+	require.Empty(t, cmp.Regressions(1))
+}
@@ -0,0 +1,44 @@
+/*
+Copyright © 2022 Bartłomiej Święcki (byo)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package benchmark contains helpers for building deterministic benchmark
+// fixtures and for comparing benchmark results against a stored baseline.
+package benchmark
+
+import (
+	"encoding/binary"
+	"math/rand/v2"
+)
+
+// Data returns size bytes of pseudo-random data, the same seed always
+// produces the same data
+func Data(seed uint64, size int) []byte {
+	var chachaSeed [32]byte
+	binary.LittleEndian.PutUint64(chachaSeed[:], seed)
+
+	ret := make([]byte, size)
+	rand.NewChaCha8(chachaSeed).Read(ret)
+	return ret
+}
+
+// RandSource returns a deterministic source of random bytes, it can be used
+// where a random source is needed to generate keys, e.g. for dynamic links
+func RandSource(seed uint64) *rand.ChaCha8 {
+	var chachaSeed [32]byte
+	binary.LittleEndian.PutUint64(chachaSeed[:], seed)
+	chachaSeed[31] = 0xFF // Different stream than the one used by Data
+	return rand.NewChaCha8(chachaSeed)
+}
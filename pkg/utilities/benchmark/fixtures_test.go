@@ -0,0 +1,37 @@
+/*
+Copyright © 2022 Bartłomiej Święcki (byo)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package benchmark
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestData(t *testing.T) {
+	require.Equal(t, Data(1, 1024), Data(1, 1024))
+	require.NotEqual(t, Data(1, 1024), Data(2, 1024))
+	require.Equal(t, Data(1, 1024)[:100], Data(1, 100))
+	require.Len(t, Data(3, 0), 0)
+
+	b1 := make([]byte, 64)
+	b2 := make([]byte, 64)
+	RandSource(1).Read(b1)
+	RandSource(1).Read(b2)
+	require.Equal(t, b1, b2)
+	require.NotEqual(t, Data(1, 64), b1)
+}
@@ -0,0 +1,123 @@
+/*
+Copyright © 2023 Bartłomiej Święcki (byo)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package progress
+
+import (
+	"io"
+	"sync"
+)
+
+// Callback is called with the number of bytes processed so far and the
+// expected total number of bytes (negative if unknown)
+type Callback func(n, total int64)
+
+// Counter accumulates the number of bytes processed by any number of readers
+// and writers and reports the accumulated value to a single callback.
+//
+// The callback is called under a lock, that way it never runs concurrently
+// and always observes monotonically increasing byte counts. Nil callback
+// is allowed, the counter only accumulates bytes in such case.
+type Counter struct {
+	total int64
+	cb    Callback
+
+	m sync.Mutex
+	n int64
+}
+
+// NewCounter creates a counter expecting given total number of bytes
+// (negative if unknown)
+func NewCounter(total int64, cb Callback) *Counter {
+	return &Counter{total: total, cb: cb}
+}
+
+// Add increases the number of processed bytes and reports it to the callback
+func (c *Counter) Add(n int64) {
+	if n <= 0 {
+		return
+	}
+
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	c.n += n
+	if c.cb != nil {
+		c.cb(c.n, c.total)
+	}
+}
+
+// N returns the number of bytes processed so far
+func (c *Counter) N() int64 {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	return c.n
+}
+
+type reader struct {
+	r io.Reader
+	c *Counter
+}
+
+func (r *reader) Read(b []byte) (int, error) {
+	n, err := r.r.Read(b)
+	r.c.Add(int64(n))
+	return n, err
+}
+
+// Reader wraps given reader and adds the number of bytes read through it
+// to the counter after every successful read.
+func (c *Counter) Reader(r io.Reader) io.Reader {
+	return &reader{r: r, c: c}
+}
+
+type writer struct {
+	w io.Writer
+	c *Counter
+}
+
+func (w *writer) Write(b []byte) (int, error) {
+	n, err := w.w.Write(b)
+	w.c.Add(int64(n))
+	return n, err
+}
+
+// Writer wraps given writer and adds the number of bytes written through it
+// to the counter after every successful write.
+func (c *Counter) Writer(w io.Writer) io.Writer {
+	return &writer{w: w, c: c}
+}
+
+// Reader wraps given reader and reports the number of bytes read
+// through it to the callback after every successful read. The reader is
+// returned unchanged if the callback is nil.
+func Reader(r io.Reader, total int64, cb Callback) io.Reader {
+	if cb == nil {
+		return r
+	}
+	return NewCounter(total, cb).Reader(r)
+}
+
+// Writer wraps given writer and reports the number of bytes written
+// through it to the callback after every successful write. The writer is
+// returned unchanged if the callback is nil.
+func Writer(w io.Writer, total int64, cb Callback) io.Writer {
+	if cb == nil {
+		return w
+	}
+	return NewCounter(total, cb).Writer(w)
+}
@@ -0,0 +1,154 @@
+/*
+Copyright © 2023 Bartłomiej Święcki (byo)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package progress
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"sync"
+	"testing"
+	"testing/iotest"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestReader(t *testing.T) {
+	data := bytes.Repeat([]byte("0123456789"), 1000)
+
+	reported := []int64{}
+	r := Reader(
+		iotest.HalfReader(bytes.NewReader(data)),
+		int64(len(data)),
+		func(n, total int64) {
+			require.EqualValues(t, len(data), total)
+			reported = append(reported, n)
+		},
+	)
+
+	read, err := io.ReadAll(r)
+	require.NoError(t, err)
+	require.Equal(t, data, read)
+
+	require.NotEmpty(t, reported)
+	require.IsIncreasing(t, reported)
+	require.EqualValues(t, len(data), reported[len(reported)-1])
+}
+
+func TestReaderError(t *testing.T) {
+	injectedErr := errors.New("error")
+
+	called := false
+	r := Reader(iotest.ErrReader(injectedErr), 10, func(n, total int64) { called = true })
+
+	_, err := io.ReadAll(r)
+	require.ErrorIs(t, err, injectedErr)
+	require.False(t, called)
+}
+
+func TestWriter(t *testing.T) {
+	data := bytes.Repeat([]byte("0123456789"), 1000)
+
+	reported := []int64{}
+	buf := bytes.NewBuffer(nil)
+	w := Writer(buf, -1, func(n, total int64) {
+		require.EqualValues(t, -1, total)
+		reported = append(reported, n)
+	})
+
+	_, err := io.Copy(w, iotest.OneByteReader(bytes.NewReader(data)))
+	require.NoError(t, err)
+	require.Equal(t, data, buf.Bytes())
+
+	require.Len(t, reported, len(data))
+	require.IsIncreasing(t, reported)
+	require.EqualValues(t, len(data), reported[len(reported)-1])
+}
+
+type lockedWriter struct {
+	m sync.Mutex
+	b bytes.Buffer
+}
+
+func (w *lockedWriter) Write(b []byte) (int, error) {
+	w.m.Lock()
+	defer w.m.Unlock()
+	return w.b.Write(b)
+}
+
+func TestWriterConcurrent(t *testing.T) {
+	const threads = 10
+	const writes = 100
+
+	last := int64(0)
+	w := Writer(&lockedWriter{}, threads*writes, func(n, total int64) {
+		// Callback is never called concurrently thus no locking is needed here
+		require.Greater(t, n, last)
+		last = n
+	})
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < threads; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < writes; j++ {
+				w.Write([]byte{byte(j)})
+			}
+		}()
+	}
+	wg.Wait()
+
+	require.EqualValues(t, threads*writes, last)
+}
+
+func TestNilCallback(t *testing.T) {
+	data := []byte("0123456789")
+
+	r := Reader(bytes.NewReader(data), int64(len(data)), nil)
+	read, err := io.ReadAll(r)
+	require.NoError(t, err)
+	require.Equal(t, data, read)
+
+	buf := bytes.NewBuffer(nil)
+	w := Writer(buf, -1, nil)
+	_, err = w.Write(data)
+	require.NoError(t, err)
+	require.Equal(t, data, buf.Bytes())
+
+	c := NewCounter(-1, nil)
+	_, err = io.Copy(c.Writer(io.Discard), c.Reader(bytes.NewReader(data)))
+	require.NoError(t, err)
+	require.EqualValues(t, 2*len(data), c.N())
+}
+
+func TestCounterShared(t *testing.T) {
+	reported := []int64{}
+	c := NewCounter(20, func(n, total int64) {
+		require.EqualValues(t, 20, total)
+		reported = append(reported, n)
+	})
+
+	for i := 0; i < 2; i++ {
+		_, err := io.ReadAll(c.Reader(iotest.OneByteReader(bytes.NewReader(make([]byte, 10)))))
+		require.NoError(t, err)
+	}
+
+	require.Len(t, reported, 20)
+	require.IsIncreasing(t, reported)
+	require.EqualValues(t, 20, c.N())
+}
@@ -28,6 +28,7 @@ package main
 
 import (
 	"bytes"
+	"crypto/aes"
 	"crypto/cipher"
 	"crypto/ed25519"
 	"crypto/sha256"
@@ -108,6 +109,16 @@ type gp struct {
 	truncateAt int
 }
 
+const keyTypeAES256CTR = 0x01
+
+// aes256ctr switches generation parameters to the AES-256-CTR encryption
+func aes256ctr(gp gp) gp {
+	def(&gp.keyGenHashEncryptionAlg, keyTypeAES256CTR)
+	def(&gp.keyType, keyTypeAES256CTR)
+	def(&gp.ivGenEncryptionAlg, keyTypeAES256CTR)
+	return gp
+}
+
 func def[T any](b **T, v T) {
 	if *b == nil {
 		*b = &v
@@ -239,15 +250,28 @@ func genAll(gp gp) ([]byte, []byte, []byte, []byte) {
 	ivGenHasher.Write(verBuff[:])
 	ivGenHasher.Write(gp.ivGenLinkData(unencryptedDataBuff))
 
-	iv := gp.ivCorrupt(ivGenHasher.Sum(nil)[:chacha20.NonceSizeX])
+	var iv []byte
+	var stream cipher.Stream
+	if *gp.keyType == keyTypeAES256CTR {
+		iv = gp.ivCorrupt(ivGenHasher.Sum(nil)[:aes.BlockSize])
 
-	ccc, err := chacha20.NewUnauthenticatedCipher(key[1:], iv)
-	if err != nil {
-		panic(err)
+		block, err := aes.NewCipher(key[1:])
+		if err != nil {
+			panic(err)
+		}
+		stream = cipher.NewCTR(block, iv)
+	} else {
+		iv = gp.ivCorrupt(ivGenHasher.Sum(nil)[:chacha20.NonceSizeX])
+
+		ccc, err := chacha20.NewUnauthenticatedCipher(key[1:], iv)
+		if err != nil {
+			panic(err)
+		}
+		stream = ccc
 	}
 	encryptedLinkDataBuff := bytes.NewBuffer(nil)
 	cipher.StreamWriter{
-		S: ccc,
+		S: stream,
 		W: encryptedLinkDataBuff,
 	}.Write(gp.unencryptedDataBuffCorruption(unencryptedDataBuff))
 
@@ -1256,4 +1280,83 @@ func generateTestVectorsForDynamicLinks() {
 		ValidPublicly:   true,
 		GoErrorContains: "data truncated while reading key validation block",
 	})
+
+	// Links encrypted with AES-256-CTR, the encryption algorithm is hashed
+	// while generating the key and iv and is stored in the key type byte
+	for i := 10; i < 13; i++ {
+		linkData := []byte(fmt.Sprintf("Link data %02d", i))
+		gp := aes256ctr(gp{
+			linkData: &linkData,
+		})
+		writeLinkData(TestCase{
+			Description:      fmt.Sprintf("Correct link - AES-256-CTR - %02d", i),
+			Name:             fmt.Sprintf("dynamic/correct/%03d_correct_link_aes256ctr", i),
+			WhenAdded:        "2026-10-17",
+			UpdateDataset:    genLink(gp),
+			BlobName:         blobName(gp),
+			EncryptionKey:    key(gp),
+			DecryptedDataset: decrypted(gp),
+			ValidPublicly:    true,
+			ValidPrivately:   true,
+		})
+	}
+
+	writeLinkData(TestCase{
+		Details: `
+			Encryption key contains encryption algorithm type information encoded before
+			key bytes. The same algorithm must also be used in the hashed data while
+			generating the key.
+
+			This test ensures that the AES-256-CTR key generated with the hash
+			for the XChaCha20 algorithm is rejected.
+		`,
+		Description: "Invalid encryption key - AES key generated with XChaCha20 keygen hash",
+		Name:        "dynamic/attacks/private/024_aes256ctr_keygen_hash_encryption_alg",
+		WhenAdded:   "2026-10-17",
+		UpdateDataset: genLink(aes256ctr(gp{
+			keyGenHashEncryptionAlg: bytep(0x00),
+		})),
+		BlobName: blobName(gp{}),
+		EncryptionKey: key(aes256ctr(gp{
+			keyGenHashEncryptionAlg: bytep(0x00),
+		})),
+		ValidPublicly:   true,
+		GoErrorContains: "key mismatch",
+	})
+
+	writeLinkData(TestCase{
+		Details: `
+			Data link encryption iv is calculated by using a hash function
+			with the encryption algorithm information in the hashed data.
+
+			This test ensures that the AES-256-CTR iv generated with the hash
+			for the XChaCha20 algorithm is rejected.
+		`,
+		Description: "Invalid encryption iv - AES iv generated with XChaCha20 iv gen hash",
+		Name:        "dynamic/attacks/private/025_aes256ctr_iv_gen_hash_encryption_alg",
+		WhenAdded:   "2026-10-17",
+		UpdateDataset: genLink(aes256ctr(gp{
+			ivGenEncryptionAlg: bytep(0x00),
+		})),
+		BlobName:        blobName(gp{}),
+		EncryptionKey:   key(aes256ctr(gp{})),
+		ValidPublicly:   true,
+		GoErrorContains: "iv mismatch",
+	})
+
+	writeLinkData(TestCase{
+		Details: `
+			The encryption algorithm is selected by the key type. The iv size
+			depends on the algorithm thus the link encrypted with XChaCha20
+			can not be read with the AES-256-CTR key.
+		`,
+		Description:     "Invalid encryption key - AES key for XChaCha20 link",
+		Name:            "dynamic/attacks/private/026_aes256ctr_key_for_xchacha20_link",
+		WhenAdded:       "2026-10-17",
+		UpdateDataset:   genLink(gp{}),
+		BlobName:        blobName(gp{}),
+		EncryptionKey:   key(aes256ctr(gp{})),
+		ValidPublicly:   true,
+		GoErrorContains: "wrong iv size",
+	})
 }